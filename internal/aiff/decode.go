@@ -0,0 +1,330 @@
+// Package aiff provides an AIFF decoder producing 16bit stereo PCM streams, as Ebitengine's audio package plays them.
+package aiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"musicplayer/internal/resample"
+)
+
+const (
+	// Output format: signed 16bit little endian, 2 channels
+	bytesPerSample = 4
+)
+
+// Stream is a decoded AIFF stream.
+//
+// The format is signed 16bit integer little endian PCM. The channel count is 2.
+type Stream struct {
+	inner      io.ReadSeeker
+	size       int64
+	sampleRate int
+}
+
+// Read is implementation of io.Reader's Read.
+func (s *Stream) Read(p []byte) (int, error) {
+	return s.inner.Read(p)
+}
+
+// Seek is implementation of io.Seeker's Seek.
+func (s *Stream) Seek(offset int64, whence int) (int64, error) {
+	return s.inner.Seek(offset, whence)
+}
+
+// Length returns the size of decoded stream in bytes.
+func (s *Stream) Length() int64 {
+	return s.size
+}
+
+// SampleRate returns the sample rate of the decoded stream.
+func (s *Stream) SampleRate() int {
+	return s.sampleRate
+}
+
+// common holds the fields of the COMM chunk needed for decoding.
+type common struct {
+	channels      int
+	sampleFrames  int64
+	bitsPerSample int
+	sampleRate    int
+	littleEndian  bool // AIFF-C "sowt" stores samples byte swapped
+}
+
+// DecodeWithoutResampling decodes AIFF data to playable stream in signed 16bit integer, little endian, 2 channels (stereo) format.
+//
+// Both AIFF and uncompressed AIFF-C are accepted. The source must be 1 or 2 channels.
+// Samples of other bit depths are converted into 16bit.
+//
+// The whole file is decoded into memory, so the returned Stream is always seekable
+// and src can be closed once DecodeWithoutResampling returns.
+func DecodeWithoutResampling(src io.Reader) (*Stream, error) {
+	comm, data, err := readChunks(src)
+	if err != nil {
+		return nil, err
+	}
+
+	pcm := convert(data, comm)
+
+	return &Stream{
+		inner:      bytes.NewReader(pcm),
+		size:       int64(len(pcm)),
+		sampleRate: comm.sampleRate,
+	}, nil
+}
+
+// DecodeWithSampleRate decodes AIFF data to playable stream in signed 16bit integer, little endian, 2 channels (stereo) format.
+//
+// DecodeWithSampleRate automatically resamples the stream to fit with sampleRate if necessary.
+func DecodeWithSampleRate(sampleRate int, src io.Reader) (*Stream, error) {
+	s, err := DecodeWithoutResampling(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if sampleRate == s.sampleRate {
+		return s, nil
+	}
+
+	r := resample.NewReader(s.inner, s.size, s.sampleRate, sampleRate)
+	return &Stream{
+		inner:      r,
+		size:       r.Length(),
+		sampleRate: sampleRate,
+	}, nil
+}
+
+// Info is the sample format of an AIFF file as stored, before conversion.
+type Info struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+}
+
+// ReadInfo reads the sample format from the COMM chunk without reading the sample data.
+func ReadInfo(src io.Reader) (*Info, error) {
+	formType, err := readFormHeader(src)
+	if err != nil {
+		return nil, err
+	}
+
+	chunkHeader := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(src, chunkHeader); err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("aiff: missing COMM chunk")
+			}
+			return nil, fmt.Errorf("aiff: failed to read chunk header: %v", err)
+		}
+		id := string(chunkHeader[0:4])
+		size := int64(binary.BigEndian.Uint32(chunkHeader[4:8]))
+		padded := size + size%2
+
+		if id != "COMM" {
+			if _, err := io.CopyN(io.Discard, src, padded); err != nil {
+				return nil, fmt.Errorf("aiff: failed to skip %q chunk: %v", id, err)
+			}
+			continue
+		}
+		chunk, err := readChunkData(src, size, size)
+		if err != nil {
+			return nil, fmt.Errorf("aiff: failed to read COMM chunk: %v", err)
+		}
+		c, err := parseCommon(chunk, formType == "AIFC")
+		if err != nil {
+			return nil, err
+		}
+		return &Info{
+			SampleRate:    c.sampleRate,
+			Channels:      c.channels,
+			BitsPerSample: c.bitsPerSample,
+		}, nil
+	}
+}
+
+// readChunkData reads the padded data of a chunk, of which at least size bytes must be present.
+// The buffer grows as the data is read instead of being allocated up front, since the declared
+// size of a truncated or corrupt file can be up to 4GiB.
+func readChunkData(r io.Reader, padded, size int64) ([]byte, error) {
+	chunk, err := io.ReadAll(io.LimitReader(r, padded))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(chunk)) < size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return chunk, nil
+}
+
+// readFormHeader checks the FORM header and returns the form type, AIFF or AIFC.
+func readFormHeader(r io.Reader) (string, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", fmt.Errorf("aiff: failed to read FORM header: %v", err)
+	}
+	if string(header[0:4]) != "FORM" {
+		return "", fmt.Errorf("aiff: invalid FORM header")
+	}
+	formType := string(header[8:12])
+	if formType != "AIFF" && formType != "AIFC" {
+		return "", fmt.Errorf("aiff: unsupported form type: %q", formType)
+	}
+	return formType, nil
+}
+
+// readChunks checks the FORM header and returns the COMM chunk and the sample data of the SSND chunk.
+func readChunks(r io.Reader) (*common, []byte, error) {
+	formType, err := readFormHeader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var comm *common
+	var data []byte
+	chunkHeader := make([]byte, 8)
+	for comm == nil || data == nil {
+		if _, err := io.ReadFull(r, chunkHeader); err != nil {
+			if err == io.EOF && comm == nil {
+				return nil, nil, fmt.Errorf("aiff: missing COMM chunk")
+			}
+			if err == io.EOF {
+				return nil, nil, fmt.Errorf("aiff: missing SSND chunk")
+			}
+			return nil, nil, fmt.Errorf("aiff: failed to read chunk header: %v", err)
+		}
+		id := string(chunkHeader[0:4])
+		size := int64(binary.BigEndian.Uint32(chunkHeader[4:8]))
+		// Chunks are padded to an even size
+		padded := size + size%2
+
+		switch id {
+		case "COMM":
+			chunk, err := readChunkData(r, padded, padded)
+			if err != nil {
+				return nil, nil, fmt.Errorf("aiff: failed to read COMM chunk: %v", err)
+			}
+			c, err := parseCommon(chunk[:size], formType == "AIFC")
+			if err != nil {
+				return nil, nil, err
+			}
+			comm = c
+		case "SSND":
+			// The last chunk may lack its pad byte
+			chunk, err := readChunkData(r, padded, size)
+			if err != nil {
+				return nil, nil, fmt.Errorf("aiff: failed to read SSND chunk: %v", err)
+			}
+			if size < 8 {
+				return nil, nil, fmt.Errorf("aiff: SSND chunk too short")
+			}
+			offset := int64(binary.BigEndian.Uint32(chunk[0:4]))
+			if 8+offset > size {
+				return nil, nil, fmt.Errorf("aiff: invalid SSND data offset: %d", offset)
+			}
+			data = chunk[8+offset : size]
+		default:
+			if _, err := io.CopyN(io.Discard, r, padded); err != nil {
+				return nil, nil, fmt.Errorf("aiff: failed to skip %q chunk: %v", id, err)
+			}
+		}
+	}
+
+	return comm, data, nil
+}
+
+// parseCommon parses the COMM chunk. AIFF-C adds a compression type, of which only
+// uncompressed PCM is supported.
+func parseCommon(chunk []byte, isAIFC bool) (*common, error) {
+	if len(chunk) < 18 {
+		return nil, fmt.Errorf("aiff: COMM chunk too short")
+	}
+	c := &common{
+		channels:      int(binary.BigEndian.Uint16(chunk[0:2])),
+		sampleFrames:  int64(binary.BigEndian.Uint32(chunk[2:6])),
+		bitsPerSample: int(binary.BigEndian.Uint16(chunk[6:8])),
+		sampleRate:    int(math.Round(extendedToFloat64(chunk[8:18]))),
+	}
+
+	if isAIFC {
+		if len(chunk) < 22 {
+			return nil, fmt.Errorf("aiff: COMM chunk too short for AIFF-C")
+		}
+		switch compression := string(chunk[18:22]); compression {
+		case "NONE", "twos":
+		case "sowt":
+			c.littleEndian = true
+		default:
+			return nil, fmt.Errorf("aiff: unsupported compression type: %q", compression)
+		}
+	}
+
+	if c.channels != 1 && c.channels != 2 {
+		return nil, fmt.Errorf("aiff: unsupported channel count: %d", c.channels)
+	}
+	if c.bitsPerSample < 1 || c.bitsPerSample > 32 {
+		return nil, fmt.Errorf("aiff: unsupported bits per sample: %d", c.bitsPerSample)
+	}
+	if c.littleEndian && c.bitsPerSample != 16 {
+		return nil, fmt.Errorf("aiff: unsupported bits per sample for sowt: %d", c.bitsPerSample)
+	}
+	if c.sampleRate <= 0 {
+		return nil, fmt.Errorf("aiff: invalid sample rate")
+	}
+	return c, nil
+}
+
+// extendedToFloat64 converts an 80bit IEEE 754 extended precision number, as used for the sample rate.
+func extendedToFloat64(b []byte) float64 {
+	sign := 1.0
+	if b[0]&0x80 != 0 {
+		sign = -1
+	}
+	exponent := int(binary.BigEndian.Uint16(b[0:2]) & 0x7fff)
+	mantissa := binary.BigEndian.Uint64(b[2:10])
+	if exponent == 0 && mantissa == 0 {
+		return 0
+	}
+	// The mantissa has an explicit integer bit, so its value is mantissa / 2^63
+	return sign * math.Ldexp(float64(mantissa), exponent-16383-63)
+}
+
+// convert converts sample frames to 16bit stereo PCM.
+func convert(data []byte, c *common) []byte {
+	bytesPerChannel := (c.bitsPerSample + 7) / 8
+	frameSize := bytesPerChannel * c.channels
+	frames := int64(len(data) / frameSize)
+	if c.sampleFrames < frames {
+		frames = c.sampleFrames
+	}
+
+	out := make([]byte, frames*bytesPerSample)
+	for i := int64(0); i < frames; i++ {
+		frame := data[i*int64(frameSize):]
+		// Mono is duplicated into both channels
+		left := readSample(frame, bytesPerChannel, c.littleEndian)
+		right := left
+		if c.channels > 1 {
+			right = readSample(frame[bytesPerChannel:], bytesPerChannel, c.littleEndian)
+		}
+		binary.LittleEndian.PutUint16(out[i*4:], uint16(left))
+		binary.LittleEndian.PutUint16(out[i*4+2:], uint16(right))
+	}
+	return out
+}
+
+// readSample reads one sample of the given width and scales it to 16bit.
+// Samples are left-justified within their bytes, so the most significant bits are kept.
+func readSample(b []byte, width int, littleEndian bool) int16 {
+	if littleEndian {
+		return int16(binary.LittleEndian.Uint16(b))
+	}
+	switch width {
+	case 1:
+		return int16(int8(b[0])) << 8
+	default:
+		return int16(binary.BigEndian.Uint16(b))
+	}
+}
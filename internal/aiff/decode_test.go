@@ -0,0 +1,174 @@
+package aiff_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"musicplayer/internal/aiff"
+)
+
+// extended encodes a positive integer as an 80bit IEEE 754 extended precision number
+func extended(v int) []byte {
+	b := make([]byte, 10)
+	exponent := 16383 + 63
+	mantissa := uint64(v)
+	for mantissa&(1<<63) == 0 {
+		mantissa <<= 1
+		exponent--
+	}
+	binary.BigEndian.PutUint16(b[0:2], uint16(exponent))
+	binary.BigEndian.PutUint64(b[2:10], mantissa)
+	return b
+}
+
+// encode builds an AIFF file of 16bit samples. With compression set, an AIFF-C file is built instead.
+// An odd sized chunk is put before the sound data to check that padding is skipped.
+func encode(channels [][]int16, sampleRate int, compression string) []byte {
+	frames := len(channels[0])
+
+	comm := &bytes.Buffer{}
+	binary.Write(comm, binary.BigEndian, uint16(len(channels)))
+	binary.Write(comm, binary.BigEndian, uint32(frames))
+	binary.Write(comm, binary.BigEndian, uint16(16))
+	comm.Write(extended(sampleRate))
+	formType := "AIFF"
+	if compression != "" {
+		formType = "AIFC"
+		comm.WriteString(compression)
+		comm.Write([]byte{0, 0}) // Empty compression name
+	}
+
+	ssnd := &bytes.Buffer{}
+	ssnd.Write(make([]byte, 8)) // Offset and block size
+	for i := 0; i < frames; i++ {
+		for _, ch := range channels {
+			if compression == "sowt" {
+				binary.Write(ssnd, binary.LittleEndian, ch[i])
+			} else {
+				binary.Write(ssnd, binary.BigEndian, ch[i])
+			}
+		}
+	}
+
+	body := &bytes.Buffer{}
+	body.WriteString(formType)
+	writeChunk := func(id string, data []byte) {
+		body.WriteString(id)
+		binary.Write(body, binary.BigEndian, uint32(len(data)))
+		body.Write(data)
+		if len(data)%2 == 1 {
+			body.WriteByte(0)
+		}
+	}
+	writeChunk("COMM", comm.Bytes())
+	writeChunk("NAME", []byte("odd"))
+	writeChunk("SSND", ssnd.Bytes())
+
+	out := &bytes.Buffer{}
+	out.WriteString("FORM")
+	binary.Write(out, binary.BigEndian, uint32(body.Len()))
+	out.Write(body.Bytes())
+	return out.Bytes()
+}
+
+func TestDecodeWithoutResampling(t *testing.T) {
+	left := []int16{0, 1000, -1000, 32767, -32768}
+	right := []int16{5, -5, 12345, -12345, 0}
+
+	for _, compression := range []string{"", "NONE", "sowt"} {
+		t.Run("compression "+compression, func(t *testing.T) {
+			data := encode([][]int16{left, right}, 44100, compression)
+
+			s, err := aiff.DecodeWithoutResampling(bytes.NewReader(data))
+			require.NoError(t, err)
+			assert.Equal(t, 44100, s.SampleRate())
+			assert.Equal(t, int64(len(left)*4), s.Length())
+
+			pcm, err := io.ReadAll(s)
+			require.NoError(t, err)
+			require.Len(t, pcm, len(left)*4)
+			for i := range left {
+				assert.Equal(t, left[i], int16(binary.LittleEndian.Uint16(pcm[i*4:])), "left sample %d", i)
+				assert.Equal(t, right[i], int16(binary.LittleEndian.Uint16(pcm[i*4+2:])), "right sample %d", i)
+			}
+		})
+	}
+}
+
+func TestDecodeWithoutResampling_Mono(t *testing.T) {
+	mono := []int16{100, -200, 300}
+	data := encode([][]int16{mono}, 48000, "")
+
+	s, err := aiff.DecodeWithoutResampling(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	pcm, err := io.ReadAll(s)
+	require.NoError(t, err)
+	require.Len(t, pcm, len(mono)*4)
+	for i := range mono {
+		assert.Equal(t, mono[i], int16(binary.LittleEndian.Uint16(pcm[i*4:])))
+		assert.Equal(t, mono[i], int16(binary.LittleEndian.Uint16(pcm[i*4+2:])))
+	}
+}
+
+func TestDecodeWithSampleRate(t *testing.T) {
+	samples := make([]int16, 4410)
+	data := encode([][]int16{samples, samples}, 44100, "")
+
+	s, err := aiff.DecodeWithSampleRate(48000, bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 48000, s.SampleRate())
+	assert.InDelta(t, 4800*4, s.Length(), 8)
+
+	_, err = s.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	_, err := aiff.DecodeWithoutResampling(bytes.NewReader([]byte("RIFF0000WAVE")))
+	assert.Error(t, err)
+
+	// Compressed AIFF-C isn't supported
+	data := encode([][]int16{{0}}, 44100, "ulaw")
+	_, err = aiff.DecodeWithoutResampling(bytes.NewReader(data))
+	assert.Error(t, err)
+
+	// Truncated chunks declaring nearly 4GiB fail without allocating their declared size
+	for _, id := range []string{"COMM", "SSND"} {
+		data := encode([][]int16{{1, 2}}, 44100, "")
+		i := bytes.Index(data, []byte(id))
+		binary.BigEndian.PutUint32(data[i+4:], 0xfffffff0)
+		_, err = aiff.DecodeWithoutResampling(bytes.NewReader(data))
+		assert.Error(t, err, id)
+	}
+	data = encode([][]int16{{1, 2}}, 44100, "")
+	binary.BigEndian.PutUint32(data[bytes.Index(data, []byte("COMM"))+4:], 0xfffffff0)
+	_, err = aiff.ReadInfo(bytes.NewReader(data))
+	assert.Error(t, err)
+}
+
+func TestExtendedSampleRates(t *testing.T) {
+	for _, rate := range []int{8000, 22050, 44100, 48000, 96000} {
+		s, err := aiff.DecodeWithoutResampling(bytes.NewReader(encode([][]int16{{0}}, rate, "")))
+		require.NoError(t, err)
+		assert.Equal(t, rate, s.SampleRate(), "sample rate %d", rate)
+	}
+}
+
+func TestReadInfo(t *testing.T) {
+	for _, compression := range []string{"", "sowt"} {
+		data := encode([][]int16{{0, 1}, {2, 3}}, 22050, compression)
+
+		info, err := aiff.ReadInfo(bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, &aiff.Info{SampleRate: 22050, Channels: 2, BitsPerSample: 16}, info, "compression %q", compression)
+	}
+
+	_, err := aiff.ReadInfo(bytes.NewReader([]byte("RIFF0000WAVE")))
+	assert.Error(t, err)
+}
@@ -0,0 +1,41 @@
+package files
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// OpenInFileManager opens the OS file manager at the given file.
+// The file is selected on Windows and macOS; on Linux and BSD its containing folder is opened with xdg-open.
+// The file manager runs on its own, so this returns once it has been launched.
+func OpenInFileManager(path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %v", path, err)
+	}
+	if _, err := os.Stat(absPath); err != nil {
+		return fmt.Errorf("cannot open %s in the file manager: %v", path, err)
+	}
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("explorer", "/select,"+absPath)
+	case "darwin":
+		cmd = exec.Command("open", "-R", absPath)
+	case "linux", "freebsd", "openbsd", "netbsd", "dragonfly":
+		cmd = exec.Command("xdg-open", filepath.Dir(absPath))
+	default:
+		return fmt.Errorf("opening the file manager is not supported on %s", runtime.GOOS)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to launch the file manager: %v", err)
+	}
+	// Reap the process; explorer exits with a non-zero status even on success, so the result is ignored
+	go cmd.Wait()
+	return nil
+}
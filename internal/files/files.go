@@ -1,14 +1,20 @@
 package files
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+
+	"musicplayer/internal/logging"
 )
 
 // MusicDirectory represents a directory where music files are stored
@@ -17,36 +23,162 @@ type MusicDirectory string
 // DefaultMusicDir is the default music directory path
 const DefaultMusicDir MusicDirectory = "musics"
 
-// FileChangeHandler is a function type for file change notifications
+// defaultDebounceInterval is how long the watcher waits for a burst of events to settle
+const defaultDebounceInterval = 500 * time.Millisecond
+
+const (
+	// watcherErrorLimit is how many errors within watcherErrorWindow make the watcher start over,
+	// as fsnotify may stop delivering events after them
+	watcherErrorLimit  = 3
+	watcherErrorWindow = 10 * time.Second
+
+	// watcherRetryInterval is how long the watcher waits to start over again after failing to
+	watcherRetryInterval = 5 * time.Second
+)
+
+// FileChangeHandler is a function type for file change notifications.
+// Handlers are called one after another, in the order of the scans, on the goroutine that scanned;
+// they must not block or call NotifyChange, and should hand the files over, e.g. with
+// MusicPlayer.QueueMusicFiles.
 type FileChangeHandler func([]string)
 
-// DirectoryWatcher watches for changes in the music directory
+// DirectoryWatcher watches for changes in one or more music directories
 type DirectoryWatcher struct {
-	watcher     *fsnotify.Watcher
+	watcher     *fsnotify.Watcher // Replaced when the watcher starts over; nil while it can't
+	healthy     bool              // Whether file system events are expected to arrive
+	closed      bool
+	roots       []MusicDirectory // Watched music directories, rescanned on changes
+	watchedDirs map[string]bool  // Directories registered with fsnotify, including subdirectories
 	handlers    []FileChangeHandler
-	debounceMap map[string]time.Time
+	debounce    time.Duration // Quiet period after the last event before rescanning
+	recursive   bool          // Whether subdirectories are scanned and watched
+	followLinks bool          // Whether symlinks to directories are scanned and watched, when recursive
+	logger      logging.Logger
 	mu          sync.Mutex
 	done        chan struct{}
+
+	// Periodic rescanning, for file systems where events don't arrive reliably
+	pollInterval   time.Duration
+	pollIntervalCh chan time.Duration // Hands a new interval over to watchLoop
+	lastFiles      []string           // Sorted file list last passed to the handlers
+	hasLastFiles   bool
+
+	// Rescans run on their own goroutines; this keeps an older scan from being recorded and
+	// delivered after a newer one, as the handlers are called while it is held
+	scanMu sync.Mutex
 }
 
 // NewDirectoryWatcher creates a new directory watcher
 func NewDirectoryWatcher() (*DirectoryWatcher, error) {
+	return NewDirectoryWatcherWithDebounce(defaultDebounceInterval)
+}
+
+// NewDirectoryWatcherWithDebounce creates a new directory watcher that rescans once
+// no events have arrived for the given interval, so a burst of changes triggers a single rescan
+func NewDirectoryWatcherWithDebounce(debounce time.Duration) (*DirectoryWatcher, error) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create watcher: %v", err)
 	}
 
 	dw := &DirectoryWatcher{
-		watcher:     watcher,
-		handlers:    make([]FileChangeHandler, 0),
-		debounceMap: make(map[string]time.Time),
-		done:        make(chan struct{}),
+		watcher:        watcher,
+		healthy:        true,
+		handlers:       make([]FileChangeHandler, 0),
+		watchedDirs:    make(map[string]bool),
+		debounce:       debounce,
+		recursive:      true,
+		logger:         logging.Default(),
+		done:           make(chan struct{}),
+		pollIntervalCh: make(chan time.Duration, 1),
 	}
 
 	go dw.watchLoop()
 	return dw, nil
 }
 
+// SetRecursive sets whether subdirectories of the music directories are scanned and watched.
+// It should be called before adding directories; the default is true.
+func (dw *DirectoryWatcher) SetRecursive(recursive bool) {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	dw.recursive = recursive
+}
+
+// SetFollowSymlinks sets whether symlinks to directories are followed when scanning and watching
+// subdirectories. It should be called before adding directories; the default is false.
+func (dw *DirectoryWatcher) SetFollowSymlinks(follow bool) {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	dw.followLinks = follow
+}
+
+// IsFollowingSymlinks returns whether symlinks to directories are followed
+func (dw *DirectoryWatcher) IsFollowingSymlinks() bool {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	return dw.followLinks
+}
+
+// SetLogger sets the logger for errors while watching; nil discards them.
+// The standard logger is used by default.
+func (dw *DirectoryWatcher) SetLogger(logger logging.Logger) {
+	if logger == nil {
+		logger = logging.Discard()
+	}
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	dw.logger = logger
+}
+
+// getLogger returns the logger; it is used from the watch goroutine
+func (dw *DirectoryWatcher) getLogger() logging.Logger {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	return dw.logger
+}
+
+// SetPollInterval makes the watcher also rescan the music directories at the interval,
+// for network drives and the like where file system events don't arrive reliably.
+// Handlers are only called when the set of files has changed since they were last called,
+// so a change seen both by the rescan and by an event is reported once. Zero, the default, disables it.
+func (dw *DirectoryWatcher) SetPollInterval(interval time.Duration) {
+	interval = max(interval, 0)
+
+	dw.mu.Lock()
+	dw.pollInterval = interval
+	needBaseline := interval > 0 && !dw.hasLastFiles
+	dw.mu.Unlock()
+
+	// Remember the current files, so the first rescan doesn't report them as a change
+	if needBaseline {
+		if files, err := dw.findFiles(); err == nil {
+			dw.filesChanged(files)
+		}
+	}
+
+	// Replace an interval watchLoop hasn't picked up yet
+	select {
+	case <-dw.pollIntervalCh:
+	default:
+	}
+	dw.pollIntervalCh <- interval
+}
+
+// PollInterval returns the interval of periodic rescans, or zero if they are disabled
+func (dw *DirectoryWatcher) PollInterval() time.Duration {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	return dw.pollInterval
+}
+
+// IsRecursive returns whether subdirectories of the music directories are scanned and watched
+func (dw *DirectoryWatcher) IsRecursive() bool {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	return dw.recursive
+}
+
 // AddHandler adds a new file change handler
 func (dw *DirectoryWatcher) AddHandler(handler FileChangeHandler) {
 	dw.mu.Lock()
@@ -56,49 +188,102 @@ func (dw *DirectoryWatcher) AddHandler(handler FileChangeHandler) {
 
 // watchLoop handles file system events
 func (dw *DirectoryWatcher) watchLoop() {
-	const debounceInterval = 500 * time.Millisecond
+	// Events are debounced globally: every event restarts the timer and
+	// the file list is rescanned once when it fires
+	debounceTimer := time.NewTimer(dw.debounce)
+	debounceTimer.Stop()
+	defer debounceTimer.Stop()
+
+	// Periodic rescans are off until SetPollInterval; a nil channel never fires
+	var pollTicker *time.Ticker
+	var pollC <-chan time.Time
+	defer func() {
+		if pollTicker != nil {
+			pollTicker.Stop()
+		}
+	}()
+
+	// Repeated errors make the watcher start over, retrying until it succeeds
+	var errorTimes []time.Time
+	retryTimer := time.NewTimer(watcherRetryInterval)
+	retryTimer.Stop()
+	defer retryTimer.Stop()
+	restart := func() {
+		errorTimes = nil
+		if err := dw.reinitialize(); err != nil {
+			dw.getLogger().Error("Failed to restart the directory watcher: %v", err)
+			retryTimer.Reset(watcherRetryInterval)
+			return
+		}
+		// Changes made while the events weren't arriving are picked up by a rescan
+		go dw.notifyIfChanged()
+	}
 
 	for {
+		// Events and errors are read from the current watcher; nil channels never deliver
+		var events chan fsnotify.Event
+		var errs chan error
+		if w := dw.fsWatcher(); w != nil {
+			events, errs = w.Events, w.Errors
+		}
+
 		select {
-		case event, ok := <-dw.watcher.Events:
+		case event, ok := <-events:
 			if !ok {
-				return
+				if dw.isClosed() {
+					return
+				}
+				dw.getLogger().Error("Directory watcher stopped unexpectedly; restarting it")
+				restart()
+				continue
+			}
+			if dw.handleEvent(event) {
+				// Notify after the burst settles
+				debounceTimer.Reset(dw.debounce)
 			}
 
-			// Skip temporary files and directories
-			if strings.HasPrefix(filepath.Base(event.Name), ".") {
-				continue
+		case <-debounceTimer.C:
+			// Notify about the change
+			go dw.notifyIfChanged()
+
+		case interval := <-dw.pollIntervalCh:
+			if pollTicker != nil {
+				pollTicker.Stop()
+				pollTicker, pollC = nil, nil
+			}
+			if interval > 0 {
+				pollTicker = time.NewTicker(interval)
+				pollC = pollTicker.C
 			}
 
-			// Handle the event
-			if event.Op&(fsnotify.Create|fsnotify.Remove) != 0 {
-				dw.mu.Lock()
-				lastEvent, exists := dw.debounceMap[event.Name]
-				now := time.Now()
-				dw.debounceMap[event.Name] = now
-				dw.mu.Unlock()
-
-				// Debounce events
-				if exists && now.Sub(lastEvent) < debounceInterval {
-					continue
-				}
+		case <-pollC:
+			go dw.notifyIfChanged()
 
-				// If a directory is created, watch it
-				if event.Op&fsnotify.Create != 0 {
-					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
-						dw.watchDirectory(event.Name)
-					}
+		case err, ok := <-errs:
+			if !ok {
+				if dw.isClosed() {
+					return
 				}
-
-				// Notify about the change
-				go dw.notifyChange()
+				dw.getLogger().Error("Directory watcher stopped unexpectedly; restarting it")
+				restart()
+				continue
+			}
+			dw.getLogger().Error("Error watching directory: %v", err)
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				debounceTimer.Reset(dw.debounce) // Events were dropped, so rescan
 			}
 
-		case err, ok := <-dw.watcher.Errors:
-			if !ok {
-				return
+			now := time.Now()
+			errorTimes = slices.DeleteFunc(append(errorTimes, now), func(t time.Time) bool {
+				return now.Sub(t) > watcherErrorWindow
+			})
+			if len(errorTimes) >= watcherErrorLimit {
+				dw.getLogger().Error("Repeated errors watching directories; restarting the watcher")
+				restart()
 			}
-			fmt.Printf("Error watching directory: %v\n", err)
+
+		case <-retryTimer.C:
+			restart()
 
 		case <-dw.done:
 			return
@@ -106,29 +291,263 @@ func (dw *DirectoryWatcher) watchLoop() {
 	}
 }
 
-// watchDirectory adds a directory and its subdirectories to the watch list
-func (dw *DirectoryWatcher) watchDirectory(dir string) error {
-	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+// handleEvent updates the watch list for a file system event and returns whether the event
+// may change the music files, so the directories should be rescanned once the burst settles.
+// Temporary files and directories, whose names start with ".", are ignored.
+func (dw *DirectoryWatcher) handleEvent(event fsnotify.Event) bool {
+	if strings.HasPrefix(filepath.Base(event.Name), ".") {
+		return false
+	}
+	if event.Op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+		return false
+	}
+
+	// If a directory is created, watch it
+	if event.Op&fsnotify.Create != 0 && dw.IsRecursive() {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			if err := dw.watchDirectory(event.Name); err != nil {
+				dw.getLogger().Error("Error watching directory %s: %v", event.Name, err)
+			}
+		}
+	}
+
+	// If a watched directory is removed or moved away, stop watching it
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		dw.unwatchDirectory(event.Name)
+	}
+	return true
+}
+
+// reinitialize replaces the fsnotify watcher with a new one and watches the music directories
+// again, for when the old one stopped delivering events. The watcher is healthy again if all of
+// them could be watched. If no new watcher can be created, there is none until the next attempt.
+// It is called from the watch goroutine.
+func (dw *DirectoryWatcher) reinitialize() error {
+	watcher, err := fsnotify.NewWatcher()
+
+	dw.mu.Lock()
+	if dw.closed {
+		dw.mu.Unlock()
+		if watcher != nil {
+			watcher.Close()
+		}
+		return nil
+	}
+	old := dw.watcher
+	dw.watcher = watcher // nil if it couldn't be created
+	dw.watchedDirs = make(map[string]bool)
+	dw.healthy = false
+	roots := slices.Clone(dw.roots)
+	dw.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %v", err)
+	}
+
+	for _, md := range roots {
+		dir, err := md.Abs()
 		if err != nil {
+			return fmt.Errorf("failed to get absolute path: %v", err)
+		}
+		if err := dw.watchDirectory(dir); err != nil {
+			return fmt.Errorf("failed to watch directory %s: %v", dir, err)
+		}
+	}
+
+	dw.mu.Lock()
+	dw.healthy = true
+	dw.mu.Unlock()
+	return nil
+}
+
+// IsHealthy reports whether changes to the music directories are expected to be noticed.
+// It is false from repeated watch errors until the watcher has started over successfully,
+// e.g. for the UI to tell that live updates aren't working.
+func (dw *DirectoryWatcher) IsHealthy() bool {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	return dw.healthy
+}
+
+// fsWatcher returns the current fsnotify watcher, which reinitialize may replace
+func (dw *DirectoryWatcher) fsWatcher() *fsnotify.Watcher {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	return dw.watcher
+}
+
+// isClosed reports whether Close has been called
+func (dw *DirectoryWatcher) isClosed() bool {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	return dw.closed
+}
+
+// watchDirectory adds a directory and, when recursive, its subdirectories to the watch list
+func (dw *DirectoryWatcher) watchDirectory(dir string) error {
+	watcher := dw.fsWatcher()
+	if watcher == nil {
+		return fmt.Errorf("the directory watcher is not running")
+	}
+	if !dw.IsRecursive() {
+		if err := watcher.Add(dir); err != nil {
 			return err
 		}
-		if info.IsDir() {
-			return dw.watcher.Add(path)
+		dw.mu.Lock()
+		dw.watchedDirs[dir] = true
+		dw.mu.Unlock()
+		return nil
+	}
+
+	return walkMusicTree(dir, dw.IsFollowingSymlinks(), func(path string, isDir bool) error {
+		if isDir {
+			if err := watcher.Add(path); err != nil {
+				return err
+			}
+			dw.mu.Lock()
+			dw.watchedDirs[path] = true
+			dw.mu.Unlock()
 		}
 		return nil
 	})
 }
 
+// unwatchDirectory removes a directory and its subdirectories from the watch list.
+// Paths that aren't watched directories are ignored.
+func (dw *DirectoryWatcher) unwatchDirectory(dir string) {
+	prefix := dir + string(filepath.Separator)
+
+	dw.mu.Lock()
+	removed := []string{}
+	for path := range dw.watchedDirs {
+		if path == dir || strings.HasPrefix(path, prefix) {
+			delete(dw.watchedDirs, path)
+			removed = append(removed, path)
+		}
+	}
+	dw.mu.Unlock()
+
+	watcher := dw.fsWatcher()
+	if watcher == nil {
+		return
+	}
+	for _, path := range removed {
+		// The OS may already have dropped the watch for a deleted directory
+		if err := watcher.Remove(path); err != nil && !errors.Is(err, fsnotify.ErrNonExistentWatch) {
+			dw.getLogger().Error("Error removing watch for %s: %v", path, err)
+		}
+	}
+}
+
+// WatchedDirectories returns the directories currently registered for watching
+func (dw *DirectoryWatcher) WatchedDirectories() []string {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	dirs := make([]string, 0, len(dw.watchedDirs))
+	for path := range dw.watchedDirs {
+		dirs = append(dirs, path)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// AddRoot starts watching another music directory.
+// Files from all watched directories are reported together to the handlers.
+func (dw *DirectoryWatcher) AddRoot(md MusicDirectory) error {
+	// Ensure directory exists
+	dir, err := md.EnsureMusicDirectory()
+	if err != nil {
+		return err
+	}
+
+	// Start watching the directory
+	if err := dw.watchDirectory(dir); err != nil {
+		return fmt.Errorf("failed to watch directory: %v", err)
+	}
+
+	dw.mu.Lock()
+	dw.roots = append(dw.roots, md)
+	dw.mu.Unlock()
+	return nil
+}
+
+// Roots returns the watched music directories
+func (dw *DirectoryWatcher) Roots() []MusicDirectory {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	roots := make([]MusicDirectory, len(dw.roots))
+	copy(roots, dw.roots)
+	return roots
+}
+
+// NotifyChange rescans the watched directories and notifies the handlers, as if a change was detected.
+// It can be called at any time, including before any file system event has arrived.
+// The scan runs synchronously, and the handlers are called before it returns.
+func (dw *DirectoryWatcher) NotifyChange() {
+	dw.notifyChange()
+}
+
 // notifyChange notifies the callback with updated file list
 func (dw *DirectoryWatcher) notifyChange() {
-	// Get the updated file list
-	files, err := DefaultMusicDir.FindMusicFiles()
+	dw.scanMu.Lock()
+	defer dw.scanMu.Unlock()
+
+	files, err := dw.findFiles()
+	if err != nil {
+		dw.getLogger().Error("Error finding music files: %v", err)
+		return
+	}
+	dw.filesChanged(files)
+	dw.notify(files)
+}
+
+// notifyIfChanged rescans the watched directories and notifies the handlers
+// only if the set of files differs from the one they were last given
+func (dw *DirectoryWatcher) notifyIfChanged() {
+	dw.scanMu.Lock()
+	defer dw.scanMu.Unlock()
+
+	files, err := dw.findFiles()
 	if err != nil {
-		fmt.Printf("Error finding music files: %v\n", err)
+		dw.getLogger().Error("Error finding music files: %v", err)
 		return
 	}
+	if dw.filesChanged(files) {
+		dw.notify(files)
+	}
+}
+
+// findFiles gets the file list from all watched directories
+func (dw *DirectoryWatcher) findFiles() ([]string, error) {
+	find := FindMusicFilesIn
+	switch {
+	case !dw.IsRecursive():
+		find = FindMusicFilesInShallow
+	case dw.IsFollowingSymlinks():
+		find = FindMusicFilesInFollowingSymlinks
+	}
+	return find(dw.Roots()...)
+}
+
+// filesChanged records the files as the last ones reported and returns whether the set differs
+// from the previous one, ignoring order. Before anything was recorded, every set counts as a change.
+func (dw *DirectoryWatcher) filesChanged(files []string) bool {
+	sorted := slices.Clone(files)
+	slices.Sort(sorted)
 
-	// Notify the handlers
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	changed := !dw.hasLastFiles || !slices.Equal(sorted, dw.lastFiles)
+	dw.lastFiles, dw.hasLastFiles = sorted, true
+	return changed
+}
+
+// notify calls the handlers with the files in turn. It is called with scanMu held, so the
+// handlers see the scans in order and a stale list can't arrive after a newer one.
+func (dw *DirectoryWatcher) notify(files []string) {
 	dw.mu.Lock()
 	handlers := make([]FileChangeHandler, len(dw.handlers))
 	copy(handlers, dw.handlers)
@@ -136,36 +555,60 @@ func (dw *DirectoryWatcher) notifyChange() {
 
 	for _, handler := range handlers {
 		if handler != nil {
-			go handler(files)
+			handler(files)
 		}
 	}
 }
 
 // Close stops watching and cleans up resources
 func (dw *DirectoryWatcher) Close() error {
+	dw.mu.Lock()
+	dw.closed = true
+	watcher := dw.watcher
+	dw.mu.Unlock()
+
 	close(dw.done)
-	return dw.watcher.Close()
+	if watcher == nil {
+		return nil
+	}
+	return watcher.Close()
 }
 
 // Watch starts watching the music directory for changes
 func (md MusicDirectory) Watch() (*DirectoryWatcher, error) {
+	return WatchDirectories(md)
+}
+
+// WatchDirectories starts watching several music directories, including subdirectories, with a single watcher
+func WatchDirectories(dirs ...MusicDirectory) (*DirectoryWatcher, error) {
+	return watchDirectories(true, false, dirs...)
+}
+
+// WatchDirectoriesShallow starts watching the top level of several music directories with a single watcher
+func WatchDirectoriesShallow(dirs ...MusicDirectory) (*DirectoryWatcher, error) {
+	return watchDirectories(false, false, dirs...)
+}
+
+// WatchDirectoriesFollowingSymlinks watches several music directories and their subdirectories,
+// including directories reached through symlinks
+func WatchDirectoriesFollowingSymlinks(dirs ...MusicDirectory) (*DirectoryWatcher, error) {
+	return watchDirectories(true, true, dirs...)
+}
+
+func watchDirectories(recursive, followSymlinks bool, dirs ...MusicDirectory) (*DirectoryWatcher, error) {
 	// Create watcher
 	dw, err := NewDirectoryWatcher()
 	if err != nil {
 		return nil, err
 	}
+	dw.SetRecursive(recursive)
+	dw.SetFollowSymlinks(followSymlinks)
 
-	// Ensure directory exists
-	dir, err := md.EnsureMusicDirectory()
-	if err != nil {
-		dw.Close()
-		return nil, err
-	}
-
-	// Start watching the directory
-	if err := dw.watchDirectory(dir); err != nil {
-		dw.Close()
-		return nil, fmt.Errorf("failed to watch directory: %v", err)
+	for _, md := range dirs {
+		if err := dw.AddRoot(md); err != nil {
+			dw.Close()
+			return nil, err
+		}
 	}
 
 	return dw, nil
@@ -186,6 +629,27 @@ func IsMp3File(path string) bool {
 	return strings.ToLower(filepath.Ext(path)) == ".mp3"
 }
 
+// IsFlacFile checks if the file is a FLAC file
+func IsFlacFile(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".flac"
+}
+
+// IsAiffFile checks if the file is an AIFF file, with either the .aiff or .aif extension
+func IsAiffFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".aiff" || ext == ".aif"
+}
+
+// IsOpusFile checks if the file is an Opus file
+func IsOpusFile(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".opus"
+}
+
+// IsMusicFile checks if the file is a supported audio file
+func IsMusicFile(path string) bool {
+	return IsWavFile(path) || IsOggFile(path) || IsMp3File(path) || IsFlacFile(path) || IsAiffFile(path) || IsOpusFile(path)
+}
+
 // Path returns the directory path as a string
 func (md MusicDirectory) Path() string {
 	return string(md)
@@ -196,8 +660,42 @@ func (md MusicDirectory) Abs() (string, error) {
 	return filepath.Abs(md.Path())
 }
 
-// FindMusicFiles searches for music files in the music directory
+// RelativePath returns the path relative to the music directory with forward slashes for display,
+// or false if the path is not inside the directory
+func (md MusicDirectory) RelativePath(path string) (string, bool) {
+	absDir, err := md.Abs()
+	if err != nil {
+		return "", false
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// FindMusicFiles searches for music files in the music directory and its subdirectories.
+// The files are in ComparePaths order, as are those of the other FindMusicFiles variants.
 func (md MusicDirectory) FindMusicFiles() ([]string, error) {
+	return md.findMusicFiles(true, false)
+}
+
+// FindMusicFilesShallow searches for music files in the top level of the music directory only
+func (md MusicDirectory) FindMusicFilesShallow() ([]string, error) {
+	return md.findMusicFiles(false, false)
+}
+
+// FindMusicFilesFollowingSymlinks searches for music files in the music directory and its subdirectories,
+// including directories reached through symlinks. Each directory is scanned once, however many links lead to it.
+func (md MusicDirectory) FindMusicFilesFollowingSymlinks() ([]string, error) {
+	return md.findMusicFiles(true, true)
+}
+
+func (md MusicDirectory) findMusicFiles(recursive, followSymlinks bool) ([]string, error) {
 	musicFiles := []string{}
 
 	// Check if the directory exists
@@ -208,17 +706,29 @@ func (md MusicDirectory) FindMusicFiles() ([]string, error) {
 		return musicFiles, nil
 	}
 
-	// Walk through the music directory
-	err := filepath.Walk(md.Path(), func(path string, info os.FileInfo, err error) error {
+	if !recursive {
+		entries, err := os.ReadDir(md.Path())
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("failed to read music directory: %v", err)
 		}
-		if info.IsDir() {
+		for _, entry := range entries {
+			path := filepath.Join(md.Path(), entry.Name())
+			if !entry.IsDir() && IsMusicFile(path) {
+				musicFiles = append(musicFiles, path)
+			}
+		}
+		slices.SortFunc(musicFiles, ComparePaths)
+		return musicFiles, nil
+	}
+
+	// Walk through the music directory
+	err := walkMusicTree(md.Path(), followSymlinks, func(path string, isDir bool) error {
+		if isDir {
 			return nil
 		}
 
 		// Check if the file is a supported audio file
-		if IsWavFile(path) || IsOggFile(path) || IsMp3File(path) {
+		if IsMusicFile(path) {
 			// Add the file to the list
 			musicFiles = append(musicFiles, path)
 		}
@@ -229,6 +739,100 @@ func (md MusicDirectory) FindMusicFiles() ([]string, error) {
 		return nil, fmt.Errorf("failed to walk music directory: %v", err)
 	}
 
+	slices.SortFunc(musicFiles, ComparePaths)
+	return musicFiles, nil
+}
+
+// walkMusicTree calls fn for root and everything below it, as filepath.WalkDir does.
+// Symlinks are passed as files unless followSymlinks is set. Then the root and links to
+// directories are walked as well, with the paths below the links, and broken links are skipped.
+// Each directory is visited once by its resolved path, so links pointing back up the tree
+// don't make the walk loop.
+func walkMusicTree(root string, followSymlinks bool, fn func(path string, isDir bool) error) error {
+	if !followSymlinks {
+		return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			return fn(path, d.IsDir())
+		})
+	}
+
+	visited := make(map[string]bool)
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		// Walk the resolved directory, where no path goes through a link, and report the paths below dir
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return err
+		}
+		return filepath.WalkDir(resolved, func(realPath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			path := dir + strings.TrimPrefix(realPath, resolved)
+
+			if d.Type()&fs.ModeSymlink != 0 {
+				info, err := os.Stat(realPath)
+				if err != nil {
+					return nil
+				}
+				if info.IsDir() {
+					return walk(path)
+				}
+				return fn(path, false)
+			}
+			if d.IsDir() {
+				if visited[realPath] {
+					return filepath.SkipDir
+				}
+				visited[realPath] = true
+			}
+			return fn(path, d.IsDir())
+		})
+	}
+	return walk(root)
+}
+
+// FindMusicFilesIn searches for music files in several music directories and their subdirectories.
+// The result is merged in directory order, with files found through overlapping directories listed once.
+func FindMusicFilesIn(dirs ...MusicDirectory) ([]string, error) {
+	return findMusicFilesIn(true, false, dirs...)
+}
+
+// FindMusicFilesInShallow searches for music files in the top level of several music directories
+func FindMusicFilesInShallow(dirs ...MusicDirectory) ([]string, error) {
+	return findMusicFilesIn(false, false, dirs...)
+}
+
+// FindMusicFilesInFollowingSymlinks searches for music files in several music directories and their
+// subdirectories, including directories reached through symlinks
+func FindMusicFilesInFollowingSymlinks(dirs ...MusicDirectory) ([]string, error) {
+	return findMusicFilesIn(true, true, dirs...)
+}
+
+func findMusicFilesIn(recursive, followSymlinks bool, dirs ...MusicDirectory) ([]string, error) {
+	musicFiles := []string{}
+	seen := make(map[string]bool)
+
+	for _, md := range dirs {
+		found, err := md.findMusicFiles(recursive, followSymlinks)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range found {
+			key, err := filepath.Abs(path)
+			if err != nil {
+				key = path
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			musicFiles = append(musicFiles, path)
+		}
+	}
+
 	return musicFiles, nil
 }
 
@@ -240,32 +844,38 @@ func (md MusicDirectory) EnsureMusicDirectory() (string, error) {
 		return "", fmt.Errorf("failed to get absolute path: %v", err)
 	}
 
-	if _, err := os.Stat(musicDir); os.IsNotExist(err) {
+	info, err := os.Stat(musicDir)
+	if os.IsNotExist(err) {
 		if err := os.MkdirAll(musicDir, 0755); err != nil {
 			return "", fmt.Errorf("failed to create music directory: %v", err)
 		}
+		return musicDir, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to access music directory: %v", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("music directory %s exists but is not a directory", musicDir)
 	}
 
 	return musicDir, nil
 }
 
-// GetUsageInstructions returns instructions for using the application
+// GetUsageInstructions returns instructions for using the application.
+// The controls are listed from KeyBindings.
 func (md MusicDirectory) GetUsageInstructions() string {
 	return fmt.Sprintf(`No music files found in the '%s' directory.
 
 Instructions:
-1. Place .wav, .ogg, or .mp3 files in the '%s' directory
+1. Place .wav, .ogg, .mp3, .flac, or .aiff files in the '%s' directory
 2. Restart the application
 3. Use the list to select and play music
-4. Space: Toggle pause
-5. N: Skip to next track
-6. Use sliders to adjust loop and interval durations
-`, md.Path(), md.Path())
+`, md.Path(), md.Path()) + numberedKeyBindings(4)
 }
 
 // GetHowToUseMessage returns instruction message about required files
 func GetHowToUseMessage() string {
-	message := "Warning: Music files are needed. Please place WAV, OGG, or MP3 files in the musics directory and run again.\n\n"
+	message := "Warning: Music files are needed. Please place WAV, OGG, MP3, FLAC, or AIFF files in the musics directory and run again.\n\n"
 	message += "Example:\n"
 	message += "musics/\n"
 	message += "├── song1.wav\n"
@@ -287,6 +897,17 @@ func EnsureMusicDirectory() (string, error) {
 	return DefaultMusicDir.EnsureMusicDirectory()
 }
 
+// RelativeToMusicDir returns the path relative to the first of the music directories that contains it,
+// for display. Paths outside all of them are returned as they are. Either way, separators are forward slashes.
+func RelativeToMusicDir(path string, dirs ...MusicDirectory) string {
+	for _, dir := range dirs {
+		if rel, ok := dir.RelativePath(path); ok {
+			return rel
+		}
+	}
+	return filepath.ToSlash(path)
+}
+
 // GetUsageInstructions returns instructions for using the application
 func GetUsageInstructions() string {
 	return DefaultMusicDir.GetUsageInstructions()
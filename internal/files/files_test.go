@@ -1,12 +1,17 @@
 package files_test
 
 import (
+	"bytes"
+	"log"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"musicplayer/internal/files"
+	"musicplayer/internal/logging"
 )
 
 // TestIsWavFile tests the IsWavFile function
@@ -87,6 +92,109 @@ func TestIsMp3File(t *testing.T) {
 	}
 }
 
+// TestIsFlacFile tests the IsFlacFile function
+func TestIsFlacFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		expected bool
+	}{
+		{"Standard FLAC file", "test.flac", true},
+		{"Uppercase extension", "test.FLAC", true},
+		{"Mixed case extension", "test.FlaC", true},
+		{"No extension", "testflac", false},
+		{"Different extension", "test.ogg", false},
+		{"Path with dots", "/path/to/test.flac", true},
+		{"Windows path", "C:\\path\\to\\test.flac", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := files.IsFlacFile(tt.path)
+			if result != tt.expected {
+				t.Errorf("IsFlacFile(%q) = %v, want %v", tt.path, result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestIsAiffFile tests the IsAiffFile function
+func TestIsAiffFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		expected bool
+	}{
+		{"Standard AIFF file", "test.aiff", true},
+		{"Short extension", "test.aif", true},
+		{"Uppercase extension", "test.AIFF", true},
+		{"AIFF-C extension", "test.aifc", false},
+		{"Different extension", "test.wav", false},
+		{"Path with dots", "/path/to/test.aif", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := files.IsAiffFile(tt.path)
+			if result != tt.expected {
+				t.Errorf("IsAiffFile(%q) = %v, want %v", tt.path, result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestIsOpusFile tests the IsOpusFile function
+func TestIsOpusFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		expected bool
+	}{
+		{"Standard Opus file", "test.opus", true},
+		{"Uppercase extension", "test.OPUS", true},
+		{"Ogg file", "test.ogg", false},
+		{"No extension", "testopus", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := files.IsOpusFile(tt.path)
+			if result != tt.expected {
+				t.Errorf("IsOpusFile(%q) = %v, want %v", tt.path, result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestIsMusicFile tests the IsMusicFile function
+func TestIsMusicFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		expected bool
+	}{
+		{"WAV file", "test.wav", true},
+		{"OGG file", "test.ogg", true},
+		{"MP3 file", "test.mp3", true},
+		{"FLAC file", "test.flac", true},
+		{"AIFF file", "test.aiff", true},
+		{"AIF file", "test.aif", true},
+		{"Opus file", "test.opus", true},
+		{"Text file", "test.txt", false},
+		{"Playlist file", "test.m3u", false},
+		{"No extension", "test", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := files.IsMusicFile(tt.path)
+			if result != tt.expected {
+				t.Errorf("IsMusicFile(%q) = %v, want %v", tt.path, result, tt.expected)
+			}
+		})
+	}
+}
+
 // TestMusicDirectory_Path tests the Path method
 func TestMusicDirectory_Path(t *testing.T) {
 	md := files.MusicDirectory("test_dir")
@@ -125,8 +233,8 @@ func TestMusicDirectory_FindMusicFiles(t *testing.T) {
 			t.Fatalf("MusicDirectory.FindMusicFiles() error = %v", err)
 		}
 
-		// Check results (4 music files: sample.wav, sample.ogg, sample.mp3, subdir/sample.wav)
-		expectedCount := 4
+		// Check results (5 music files: sample.wav, sample.ogg, sample.mp3, sample.flac, subdir/sample.wav)
+		expectedCount := 5
 		if len(foundFiles) != expectedCount {
 			t.Errorf("MusicDirectory.FindMusicFiles() got %d files, want %d", len(foundFiles), expectedCount)
 		}
@@ -183,6 +291,42 @@ func TestMusicDirectory_FindMusicFiles(t *testing.T) {
 	})
 }
 
+// TestFindMusicFilesIn tests the FindMusicFilesIn function
+func TestFindMusicFilesIn(t *testing.T) {
+	tests := []struct {
+		name          string
+		dirs          []files.MusicDirectory
+		expectedCount int
+	}{
+		{"No directories", nil, 0},
+		{"Single directory", []files.MusicDirectory{"testdata"}, 5},
+		{"Separate directories", []files.MusicDirectory{"testdata/subdir", "testdata"}, 5},
+		{"Same directory twice", []files.MusicDirectory{"testdata", "testdata"}, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			foundFiles, err := files.FindMusicFilesIn(tt.dirs...)
+			if err != nil {
+				t.Fatalf("FindMusicFilesIn() error = %v", err)
+			}
+			if len(foundFiles) != tt.expectedCount {
+				t.Errorf("FindMusicFilesIn() got %d files, want %d: %v", len(foundFiles), tt.expectedCount, foundFiles)
+			}
+		})
+	}
+
+	t.Run("Directory order is kept", func(t *testing.T) {
+		foundFiles, err := files.FindMusicFilesIn("testdata/subdir", "testdata")
+		if err != nil {
+			t.Fatalf("FindMusicFilesIn() error = %v", err)
+		}
+		if len(foundFiles) == 0 || !strings.Contains(foundFiles[0], "subdir") {
+			t.Errorf("FindMusicFilesIn() should list files of the first directory first, got %v", foundFiles)
+		}
+	})
+}
+
 // TestMusicDirectory_EnsureMusicDirectory tests the EnsureMusicDirectory method
 func TestMusicDirectory_EnsureMusicDirectory(t *testing.T) {
 	t.Run("Create non-existent directory", func(t *testing.T) {
@@ -227,6 +371,14 @@ func TestMusicDirectory_EnsureMusicDirectory(t *testing.T) {
 			t.Errorf("MusicDirectory.EnsureMusicDirectory() with existing dir got %s, want %s", musicDir, expectedAbsPath)
 		}
 	})
+
+	t.Run("For existing file", func(t *testing.T) {
+		md := files.MusicDirectory("testdata/sample.wav")
+
+		if _, err := md.EnsureMusicDirectory(); err == nil || !strings.Contains(err.Error(), "not a directory") {
+			t.Errorf("MusicDirectory.EnsureMusicDirectory() with a file should fail, got %v", err)
+		}
+	})
 }
 
 // TestMusicDirectory_GetUsageInstructions tests the GetUsageInstructions method
@@ -245,7 +397,7 @@ func TestMusicDirectory_GetUsageInstructions(t *testing.T) {
 	// Check if expected phrases are included
 	expectedPhrases := []string{
 		"No music files found",
-		"Place .wav, .ogg, or .mp3 files",
+		"Place .wav, .ogg, .mp3, .flac, or .aiff files",
 		"Restart the application",
 		"Space: Toggle pause",
 		"N: Skip to next track",
@@ -265,7 +417,7 @@ func TestGetHowToUseMessage(t *testing.T) {
 	// Check if expected phrases are included
 	expectedPhrases := []string{
 		"Warning: Music files are needed",
-		"Please place WAV, OGG, or MP3 files in the musics directory",
+		"Please place WAV, OGG, MP3, FLAC, or AIFF files in the musics directory",
 		"song1.wav",
 		"song2.mp3",
 		"song3.ogg",
@@ -340,3 +492,611 @@ func TestDefaultFunctions(t *testing.T) {
 		}
 	})
 }
+
+// TestLoadPlaylist tests the LoadPlaylist function
+func TestLoadPlaylist(t *testing.T) {
+	t.Run("Relative entries in testdata playlist", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		logger := logging.NewStdLogger(log.New(buf, "", 0), logging.LevelWarn)
+		foundFiles, err := files.LoadPlaylist(filepath.Join("testdata", "playlist.m3u"), logger)
+		if err != nil {
+			t.Fatalf("LoadPlaylist() error = %v", err)
+		}
+
+		// Comments, blank lines, missing and non-music entries are skipped; order is preserved
+		expected := []string{
+			filepath.Join("testdata", "sample.wav"),
+			filepath.Join("testdata", "subdir", "sample.wav"),
+			filepath.Join("testdata", "sample.ogg"),
+		}
+		if len(foundFiles) != len(expected) {
+			t.Fatalf("LoadPlaylist() got %v, want %v", foundFiles, expected)
+		}
+		for i := range expected {
+			if foundFiles[i] != expected[i] {
+				t.Errorf("LoadPlaylist()[%d] = %s, want %s", i, foundFiles[i], expected[i])
+			}
+		}
+
+		// The skipped entries are reported to the logger
+		for _, entry := range []string{"missing.mp3", "sample.txt"} {
+			if !strings.Contains(buf.String(), entry) {
+				t.Errorf("LoadPlaylist() didn't log skipped entry %s, got %q", entry, buf.String())
+			}
+		}
+	})
+
+	t.Run("Absolute entries", func(t *testing.T) {
+		absPath, err := filepath.Abs(filepath.Join("testdata", "sample.mp3"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		playlist := filepath.Join(t.TempDir(), "abs.m3u")
+		if err := os.WriteFile(playlist, []byte(absPath+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		foundFiles, err := files.LoadPlaylist(playlist, nil)
+		if err != nil {
+			t.Fatalf("LoadPlaylist() error = %v", err)
+		}
+		if len(foundFiles) != 1 || foundFiles[0] != absPath {
+			t.Errorf("LoadPlaylist() got %v, want [%s]", foundFiles, absPath)
+		}
+	})
+
+	t.Run("Non-existent playlist", func(t *testing.T) {
+		if _, err := files.LoadPlaylist(filepath.Join(t.TempDir(), "missing.m3u"), nil); err == nil {
+			t.Error("LoadPlaylist() with missing playlist should return an error")
+		}
+	})
+}
+
+// TestMusicDirectory_Watch tests that changes are reported with files from the watched directory
+func TestMusicDirectory_Watch(t *testing.T) {
+	md := files.MusicDirectory(t.TempDir())
+
+	dw, err := md.Watch()
+	if err != nil {
+		t.Fatalf("MusicDirectory.Watch() error = %v", err)
+	}
+	defer dw.Close()
+
+	received := make(chan []string, 10)
+	dw.AddHandler(func(musicFiles []string) {
+		received <- musicFiles
+	})
+
+	newFile := filepath.Join(md.Path(), "new.wav")
+	if err := os.WriteFile(newFile, []byte("dummy"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case musicFiles := <-received:
+		if len(musicFiles) != 1 || musicFiles[0] != newFile {
+			t.Errorf("Watch handler got %v, want [%s]", musicFiles, newFile)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch handler was not called")
+	}
+}
+
+// TestNewDirectoryWatcherWithDebounce tests that a burst of changes triggers a single notification
+func TestNewDirectoryWatcherWithDebounce(t *testing.T) {
+	md := files.MusicDirectory(t.TempDir())
+
+	dw, err := files.NewDirectoryWatcherWithDebounce(200 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewDirectoryWatcherWithDebounce() error = %v", err)
+	}
+	defer dw.Close()
+	if err := dw.AddRoot(md); err != nil {
+		t.Fatalf("DirectoryWatcher.AddRoot() error = %v", err)
+	}
+
+	received := make(chan []string, 10)
+	dw.AddHandler(func(musicFiles []string) {
+		received <- musicFiles
+	})
+
+	// Several distinct files in one batch
+	for _, name := range []string{"a.wav", "b.ogg", "c.mp3"} {
+		if err := os.WriteFile(filepath.Join(md.Path(), name), []byte("dummy"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case musicFiles := <-received:
+		if len(musicFiles) != 3 {
+			t.Errorf("Watch handler got %v, want 3 files", musicFiles)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch handler was not called")
+	}
+
+	// No further rescans for the same batch
+	select {
+	case musicFiles := <-received:
+		t.Errorf("Watch handler called again with %v, want a single notification", musicFiles)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+// TestDirectoryWatcher_PollInterval tests that periodic rescans report new files once,
+// even when file system events don't arrive
+func TestDirectoryWatcher_PollInterval(t *testing.T) {
+	md := files.MusicDirectory(t.TempDir())
+	if err := os.WriteFile(filepath.Join(md.Path(), "existing.wav"), []byte("dummy"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Events settle far too late to be reported during the test, so only rescans notify
+	dw, err := files.NewDirectoryWatcherWithDebounce(time.Hour)
+	if err != nil {
+		t.Fatalf("NewDirectoryWatcherWithDebounce() error = %v", err)
+	}
+	defer dw.Close()
+	if err := dw.AddRoot(md); err != nil {
+		t.Fatalf("DirectoryWatcher.AddRoot() error = %v", err)
+	}
+	if dw.PollInterval() != 0 {
+		t.Errorf("PollInterval() = %v, want rescans off by default", dw.PollInterval())
+	}
+
+	received := make(chan []string, 10)
+	dw.AddHandler(func(musicFiles []string) {
+		received <- musicFiles
+	})
+	dw.SetPollInterval(50 * time.Millisecond)
+
+	// The files present when rescanning starts aren't a change
+	select {
+	case musicFiles := <-received:
+		t.Errorf("Rescan reported unchanged files %v", musicFiles)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(filepath.Join(md.Path(), "new.ogg"), []byte("dummy"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case musicFiles := <-received:
+		if len(musicFiles) != 2 {
+			t.Errorf("Rescan handler got %v, want 2 files", musicFiles)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Rescan did not call the handler")
+	}
+
+	// Later rescans find nothing new
+	select {
+	case musicFiles := <-received:
+		t.Errorf("Handler called again with %v, want a single notification", musicFiles)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+// TestDirectoryWatcher_RemovedDirectory tests that watches for deleted directories are dropped
+func TestDirectoryWatcher_RemovedDirectory(t *testing.T) {
+	root := t.TempDir()
+	subdir := filepath.Join(root, "album")
+	nested := filepath.Join(subdir, "disc1")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dw, err := files.NewDirectoryWatcherWithDebounce(50 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewDirectoryWatcherWithDebounce() error = %v", err)
+	}
+	defer dw.Close()
+	if err := dw.AddRoot(files.MusicDirectory(root)); err != nil {
+		t.Fatalf("DirectoryWatcher.AddRoot() error = %v", err)
+	}
+
+	if got := len(dw.WatchedDirectories()); got != 3 {
+		t.Fatalf("DirectoryWatcher.WatchedDirectories() got %d dirs, want 3: %v", got, dw.WatchedDirectories())
+	}
+
+	if err := os.RemoveAll(subdir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for the removal events to be processed
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if dirs := dw.WatchedDirectories(); len(dirs) == 1 && dirs[0] == root {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("DirectoryWatcher.WatchedDirectories() got %v, want [%s]", dw.WatchedDirectories(), root)
+}
+
+func TestSortMusicFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	paths := []string{
+		filepath.Join(tempDir, "b", "Alpha.wav"),
+		filepath.Join(tempDir, "a", "charlie.wav"),
+		filepath.Join(tempDir, "a", "bravo.wav"),
+	}
+	now := time.Now()
+	for i, path := range paths {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		// Alpha is the oldest, bravo the newest
+		modTime := now.Add(time.Duration(i) * time.Hour)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	missing := filepath.Join(tempDir, "missing.wav")
+	input := append([]string{missing}, paths...)
+
+	durations := map[string]time.Duration{
+		paths[0]: 3 * time.Minute,
+		paths[1]: time.Minute,
+		paths[2]: 2 * time.Minute,
+	}
+	durationOf := func(path string) (time.Duration, error) {
+		if d, ok := durations[path]; ok {
+			return d, nil
+		}
+		return 0, os.ErrNotExist
+	}
+
+	tests := []struct {
+		mode     files.SortMode
+		expected []string
+	}{
+		{files.SortNone, input},
+		{files.SortByName, []string{paths[0], paths[2], paths[1], missing}},
+		{files.SortByModTime, []string{paths[2], paths[1], paths[0], missing}},
+		{files.SortByDuration, []string{paths[1], paths[2], paths[0], missing}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode.String(), func(t *testing.T) {
+			sorted := files.SortMusicFiles(input, tt.mode, durationOf)
+			if strings.Join(sorted, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("SortMusicFiles() = %v, want %v", sorted, tt.expected)
+			}
+		})
+	}
+
+	if input[0] != missing {
+		t.Error("SortMusicFiles should not modify its input")
+	}
+	if files.SortByDuration.Next() != files.SortNone {
+		t.Error("Expected sort modes to cycle back to SortNone")
+	}
+}
+
+func TestFindMusicFiles_Order(t *testing.T) {
+	tempDir := t.TempDir()
+	// Created out of order, with mixed case and a subdirectory sorting between the files
+	names := []string{"c.WAV", "b.wav", "Sub/a.wav", "A.wav", "a.mp3", "sub-b.wav", "z/a.ogg"}
+	for _, name := range names {
+		path := filepath.Join(tempDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var expected []string
+	for _, name := range []string{"a.mp3", "A.wav", "b.wav", "c.WAV", "Sub/a.wav", "sub-b.wav", "z/a.ogg"} {
+		expected = append(expected, filepath.Join(tempDir, filepath.FromSlash(name)))
+	}
+
+	for i := 0; i < 2; i++ {
+		foundFiles, err := files.MusicDirectory(tempDir).FindMusicFiles()
+		if err != nil {
+			t.Fatalf("FindMusicFiles() error = %v", err)
+		}
+		if !reflect.DeepEqual(foundFiles, expected) {
+			t.Errorf("FindMusicFiles() = %v, want %v", foundFiles, expected)
+		}
+	}
+
+	// Paths differing only in case are ordered by their bytes, so the order doesn't depend on the OS
+	if files.ComparePaths("x/Song.wav", "x/song.wav") >= 0 || files.ComparePaths("x/song.wav", "X/Song.wav") <= 0 {
+		t.Error("Expected paths differing only in case to be ordered by their bytes")
+	}
+	if files.ComparePaths("a/b.wav", "a/b.wav") != 0 {
+		t.Error("Expected equal paths to compare equal")
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tempDir := t.TempDir()
+
+	id3Header := []byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, 4, 0, 0, 0, 0}
+
+	tests := []struct {
+		name      string
+		fileName  string
+		content   []byte
+		expected  files.Format
+		expectErr bool
+	}{
+		{"WAV", "a.wav", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), files.FormatWav, false},
+		{"OGG", "a.ogg", []byte("OggS\x00\x02"), files.FormatOgg, false},
+		{"OGG Vorbis", "b.ogg", oggPage("\x01vorbis"), files.FormatOgg, false},
+		{"OGG Opus", "a.opus", oggPage("OpusHead"), files.FormatOpus, false},
+		{"Opus mislabeled as OGG", "c.ogg", oggPage("OpusHead"), files.FormatOpus, false},
+		{"FLAC", "a.flac", []byte("fLaC\x00\x00\x00\x22"), files.FormatFlac, false},
+		{"AIFF", "a.aiff", []byte("FORM\x00\x00\x00\x2eAIFFCOMM"), files.FormatAiff, false},
+		{"AIFF-C", "a.aif", []byte("FORM\x00\x00\x00\x2eAIFCFVER"), files.FormatAiff, false},
+		{"MP3 with ID3", "a.mp3", append(id3Header, 0xff, 0xfb, 0x90, 0x00), files.FormatMp3, false},
+		{"MP3 frame sync", "a.mp3", []byte{0xff, 0xfb, 0x90, 0x00}, files.FormatMp3, false},
+		{"FLAC with ID3", "b.flac", append(id3Header, 'f', 'L', 'a', 'C'), files.FormatFlac, false},
+		{"Mislabeled WAV", "b.mp3", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), files.FormatWav, false},
+		{"Unknown", "c.wav", []byte("not audio"), files.FormatUnknown, true},
+		{"Empty", "d.wav", nil, files.FormatUnknown, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tempDir, tt.fileName)
+			if err := os.WriteFile(path, tt.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			format, err := files.DetectFormat(path)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("DetectFormat() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if format != tt.expected {
+				t.Errorf("DetectFormat() = %v, want %v", format, tt.expected)
+			}
+		})
+	}
+
+	if _, err := files.DetectFormat(filepath.Join(tempDir, "missing.wav")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+	if files.FormatFromExtension("a.OGG") != files.FormatOgg || files.FormatFromExtension("a.opus") != files.FormatOpus || files.FormatFromExtension("a.txt") != files.FormatUnknown {
+		t.Error("Unexpected FormatFromExtension result")
+	}
+}
+
+// oggPage returns the start of a first Ogg page holding a single packet that begins with the given bytes
+func oggPage(packet string) []byte {
+	page := make([]byte, 27, 64)
+	copy(page, "OggS")
+	page[5] = 0x02                 // Beginning of stream
+	page[26] = 1                   // One segment
+	page = append(page, 19)        // Segment size
+	page = append(page, packet...) // Packet
+	return append(page, make([]byte, 19-len(packet))...)
+}
+
+func TestMusicDirectory_FindMusicFilesShallow(t *testing.T) {
+	foundFiles, err := files.MusicDirectory("testdata").FindMusicFilesShallow()
+	if err != nil {
+		t.Fatalf("FindMusicFilesShallow() error = %v", err)
+	}
+	if len(foundFiles) != 4 {
+		t.Errorf("FindMusicFilesShallow() got %d files, want 4: %v", len(foundFiles), foundFiles)
+	}
+	for _, path := range foundFiles {
+		if strings.Contains(path, "subdir") {
+			t.Errorf("FindMusicFilesShallow() should skip subdirectories, got %s", path)
+		}
+	}
+
+	foundFiles, err = files.FindMusicFilesInShallow("testdata/subdir", "testdata")
+	if err != nil {
+		t.Fatalf("FindMusicFilesInShallow() error = %v", err)
+	}
+	if len(foundFiles) != 5 {
+		t.Errorf("FindMusicFilesInShallow() got %d files, want 5: %v", len(foundFiles), foundFiles)
+	}
+}
+
+func TestMusicDirectory_FindMusicFilesFollowingSymlinks(t *testing.T) {
+	root := t.TempDir()
+	external := t.TempDir()
+	for _, path := range []string{filepath.Join(root, "a.wav"), filepath.Join(external, "b.wav")} {
+		if err := os.WriteFile(path, []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The linked directory links back to the music directory and to itself
+	links := map[string]string{
+		filepath.Join(root, "linked"):   external,
+		filepath.Join(external, "loop"): root,
+		filepath.Join(external, "self"): external,
+		filepath.Join(root, "broken"):   filepath.Join(root, "missing"),
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skipf("Symlinks aren't supported: %v", err)
+		}
+	}
+	md := files.MusicDirectory(root)
+
+	foundFiles, err := md.FindMusicFiles()
+	if err != nil {
+		t.Fatalf("FindMusicFiles() error = %v", err)
+	}
+	if want := []string{filepath.Join(root, "a.wav")}; !reflect.DeepEqual(foundFiles, want) {
+		t.Errorf("FindMusicFiles() = %v, want %v without following symlinks", foundFiles, want)
+	}
+
+	foundFiles, err = md.FindMusicFilesFollowingSymlinks()
+	if err != nil {
+		t.Fatalf("FindMusicFilesFollowingSymlinks() error = %v", err)
+	}
+	want := []string{filepath.Join(root, "a.wav"), filepath.Join(root, "linked", "b.wav")}
+	if !reflect.DeepEqual(foundFiles, want) {
+		t.Errorf("FindMusicFilesFollowingSymlinks() = %v, want %v", foundFiles, want)
+	}
+
+	// A music directory that is itself a link is followed too
+	foundFiles, err = files.MusicDirectory(filepath.Join(root, "linked")).FindMusicFilesFollowingSymlinks()
+	if err != nil {
+		t.Fatalf("FindMusicFilesFollowingSymlinks() error = %v", err)
+	}
+	want = []string{filepath.Join(root, "linked", "b.wav"), filepath.Join(root, "linked", "loop", "a.wav")}
+	if !reflect.DeepEqual(foundFiles, want) {
+		t.Errorf("FindMusicFilesFollowingSymlinks() through a linked directory = %v, want %v", foundFiles, want)
+	}
+
+	dw, err := files.WatchDirectoriesFollowingSymlinks(md)
+	if err != nil {
+		t.Fatalf("WatchDirectoriesFollowingSymlinks() error = %v", err)
+	}
+	defer dw.Close()
+	if watched, want := dw.WatchedDirectories(), []string{root, filepath.Join(root, "linked")}; !reflect.DeepEqual(watched, want) {
+		t.Errorf("Expected the linked directory to be watched once, got %v, want %v", watched, want)
+	}
+}
+
+func TestWatchDirectoriesShallow(t *testing.T) {
+	md := files.MusicDirectory(t.TempDir())
+	if err := os.Mkdir(filepath.Join(md.Path(), "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dw, err := files.WatchDirectoriesShallow(md)
+	if err != nil {
+		t.Fatalf("WatchDirectoriesShallow() error = %v", err)
+	}
+	defer dw.Close()
+
+	if dw.IsRecursive() {
+		t.Error("Expected a non-recursive watcher")
+	}
+	if watched := dw.WatchedDirectories(); len(watched) != 1 || watched[0] != md.Path() {
+		t.Errorf("Expected only the top level to be watched, got %v", watched)
+	}
+}
+
+func TestDirectoryWatcher_NotifyChange(t *testing.T) {
+	md := files.MusicDirectory(t.TempDir())
+	existing := filepath.Join(md.Path(), "existing.wav")
+	if err := os.WriteFile(existing, []byte("dummy"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dw, err := md.Watch()
+	if err != nil {
+		t.Fatalf("MusicDirectory.Watch() error = %v", err)
+	}
+	defer dw.Close()
+
+	received := make(chan []string, 10)
+	dw.AddHandler(func(musicFiles []string) {
+		received <- musicFiles
+	})
+
+	// No file system event has happened yet; the handler is called before NotifyChange returns
+	dw.NotifyChange()
+
+	select {
+	case musicFiles := <-received:
+		if len(musicFiles) != 1 || musicFiles[0] != existing {
+			t.Errorf("NotifyChange handler got %v, want [%s]", musicFiles, existing)
+		}
+	default:
+		t.Fatal("NotifyChange did not call the handler")
+	}
+
+	// Later scans reach the handler after earlier ones, so the newest list is the last one seen
+	added := filepath.Join(md.Path(), "added.wav")
+	if err := os.WriteFile(added, []byte("dummy"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dw.NotifyChange()
+	var last []string
+	for len(received) > 0 {
+		last = <-received
+	}
+	if len(last) != 2 {
+		t.Errorf("Expected the last notification to list both files, got %v", last)
+	}
+}
+
+func TestOpenInFileManager_MissingFile(t *testing.T) {
+	// Only the failure case is tested, so no file manager is launched
+	missing := filepath.Join(t.TempDir(), "missing.wav")
+	if err := files.OpenInFileManager(missing); err == nil {
+		t.Error("OpenInFileManager() expected an error for a missing file")
+	}
+}
+
+func TestRelativeToMusicDir(t *testing.T) {
+	tempDir := t.TempDir()
+	custom := files.MusicDirectory(filepath.Join(tempDir, "assets", "bgm"))
+	other := files.MusicDirectory(filepath.Join(tempDir, "other"))
+
+	tests := []struct {
+		name     string
+		path     string
+		dirs     []files.MusicDirectory
+		expected string
+	}{
+		{"Top level", filepath.Join(custom.Path(), "a.wav"), []files.MusicDirectory{custom}, "a.wav"},
+		{"Nested", filepath.Join(custom.Path(), "stage1", "a.wav"), []files.MusicDirectory{custom}, "stage1/a.wav"},
+		{"Second directory", filepath.Join(custom.Path(), "a.wav"), []files.MusicDirectory{other, custom}, "a.wav"},
+		{"Relative path", filepath.Join("musics", "sub", "a.ogg"), []files.MusicDirectory{files.DefaultMusicDir}, "sub/a.ogg"},
+		{"Outside", filepath.Join(tempDir, "a.wav"), []files.MusicDirectory{custom}, filepath.ToSlash(filepath.Join(tempDir, "a.wav"))},
+		{"Sibling with common prefix", filepath.Join(tempDir, "assets", "bgm2", "a.wav"), []files.MusicDirectory{custom}, filepath.ToSlash(filepath.Join(tempDir, "assets", "bgm2", "a.wav"))},
+		{"No directories", filepath.Join("musics", "a.wav"), nil, "musics/a.wav"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := files.RelativeToMusicDir(tt.path, tt.dirs...); got != tt.expected {
+				t.Errorf("RelativeToMusicDir(%q) = %q, want %q", tt.path, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGroupMusicFiles(t *testing.T) {
+	musicDir := files.MusicDirectory(filepath.Join(t.TempDir(), "musics"))
+	root := filepath.Join(musicDir.Path(), "title.wav")
+	bgm1 := filepath.Join(musicDir.Path(), "bgm", "stage1.ogg")
+	bgm2 := filepath.Join(musicDir.Path(), "bgm", "boss", "stage2.ogg")
+	sfx := filepath.Join(musicDir.Path(), "sfx", "jump.wav")
+
+	groups := files.GroupMusicFiles([]string{sfx, bgm1, root, bgm2}, musicDir)
+	expected := map[string][]string{
+		files.RootGroup: {root},
+		"bgm":           {bgm1, bgm2},
+		"sfx":           {sfx},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("GroupMusicFiles() = %v, want %v", groups, expected)
+	}
+
+	if names := files.GroupNames(groups); !reflect.DeepEqual(names, []string{files.RootGroup, "bgm", "sfx"}) {
+		t.Errorf("GroupNames() = %v, want the root group first and the rest sorted", names)
+	}
+
+	// Files outside the music directories count as the root group
+	if got := files.GroupOf(filepath.Join(t.TempDir(), "a.wav"), musicDir); got != files.RootGroup {
+		t.Errorf("GroupOf(outside) = %q, want %q", got, files.RootGroup)
+	}
+}
+
+func TestKeyBindings(t *testing.T) {
+	instructions := files.GetUsageInstructions()
+	for _, binding := range files.KeyBindings {
+		if binding.Keys == "" || binding.Action == "" {
+			t.Errorf("Key binding %+v should have both keys and an action", binding)
+		}
+		if !strings.Contains(instructions, binding.String()) {
+			t.Errorf("GetUsageInstructions() should list %q", binding)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package files
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Format is the audio format of a music file
+type Format int
+
+const (
+	FormatUnknown Format = iota
+	FormatWav
+	FormatOgg
+	FormatMp3
+	FormatFlac
+	FormatOpus
+	FormatAiff
+)
+
+// String returns a display name for the format
+func (f Format) String() string {
+	switch f {
+	case FormatWav:
+		return "WAV"
+	case FormatOgg:
+		return "OGG"
+	case FormatMp3:
+		return "MP3"
+	case FormatFlac:
+		return "FLAC"
+	case FormatOpus:
+		return "Opus"
+	case FormatAiff:
+		return "AIFF"
+	default:
+		return "Unknown"
+	}
+}
+
+// FormatFromExtension returns the format indicated by the file extension
+func FormatFromExtension(path string) Format {
+	switch {
+	case IsWavFile(path):
+		return FormatWav
+	case IsOggFile(path):
+		return FormatOgg
+	case IsMp3File(path):
+		return FormatMp3
+	case IsFlacFile(path):
+		return FormatFlac
+	case IsOpusFile(path):
+		return FormatOpus
+	case IsAiffFile(path):
+		return FormatAiff
+	default:
+		return FormatUnknown
+	}
+}
+
+// DetectFormat returns the format of a music file by its magic bytes, regardless of the extension.
+// It returns FormatUnknown and an error if the content is not recognized.
+func DetectFormat(path string) (Format, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FormatUnknown, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	// Long enough for the first packet of an Ogg page
+	header := make([]byte, 64)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return FormatUnknown, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	header = header[:n]
+
+	// Skip an ID3v2 tag, which may precede MP3 and (rarely) FLAC data
+	if len(header) >= 10 && bytes.HasPrefix(header, []byte("ID3")) {
+		size := int64(header[6]&0x7f)<<21 | int64(header[7]&0x7f)<<14 | int64(header[8]&0x7f)<<7 | int64(header[9]&0x7f)
+		if header[5]&0x10 != 0 {
+			size += 10 // Footer
+		}
+		next := make([]byte, 4)
+		if _, err := f.ReadAt(next, 10+size); err == nil && bytes.Equal(next, []byte("fLaC")) {
+			return FormatFlac, nil
+		}
+		return FormatMp3, nil
+	}
+
+	switch {
+	case len(header) >= 12 && bytes.Equal(header[0:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WAVE")):
+		return FormatWav, nil
+	case len(header) >= 12 && bytes.Equal(header[0:4], []byte("FORM")) && (bytes.Equal(header[8:12], []byte("AIFF")) || bytes.Equal(header[8:12], []byte("AIFC"))):
+		return FormatAiff, nil
+	case bytes.HasPrefix(header, []byte("OggS")):
+		// Ogg holds either Vorbis or Opus; Opus streams start with an OpusHead packet
+		if isOggOpus(header) {
+			return FormatOpus, nil
+		}
+		return FormatOgg, nil
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return FormatFlac, nil
+	case len(header) >= 2 && header[0] == 0xff && header[1]&0xe0 == 0xe0:
+		// MPEG audio frame sync
+		return FormatMp3, nil
+	}
+	return FormatUnknown, fmt.Errorf("unrecognized audio format: %s", path)
+}
+
+// isOggOpus reports whether the first Ogg page starts with an Opus identification header
+func isOggOpus(page []byte) bool {
+	const segmentCountOffset = 26
+	if len(page) <= segmentCountOffset {
+		return false
+	}
+	packetStart := segmentCountOffset + 1 + int(page[segmentCountOffset])
+	return len(page) >= packetStart+8 && bytes.Equal(page[packetStart:packetStart+8], []byte("OpusHead"))
+}
@@ -0,0 +1,51 @@
+package files
+
+import (
+	"sort"
+	"strings"
+)
+
+// RootGroup is the group of music files directly in a music directory
+const RootGroup = "(root)"
+
+// GroupOf returns the group of a music file: the name of its immediate subdirectory under
+// the first of the music directories that contains it. Files directly in a music directory,
+// or outside all of them, belong to RootGroup.
+func GroupOf(path string, dirs ...MusicDirectory) string {
+	for _, dir := range dirs {
+		rel, ok := dir.RelativePath(path)
+		if !ok {
+			continue
+		}
+		if group, _, found := strings.Cut(rel, "/"); found {
+			return group
+		}
+		return RootGroup
+	}
+	return RootGroup
+}
+
+// GroupMusicFiles groups music files by GroupOf. Each group keeps the files in their original order.
+func GroupMusicFiles(musicFiles []string, dirs ...MusicDirectory) map[string][]string {
+	groups := make(map[string][]string)
+	for _, path := range musicFiles {
+		group := GroupOf(path, dirs...)
+		groups[group] = append(groups[group], path)
+	}
+	return groups
+}
+
+// GroupNames returns the names of the groups, RootGroup first and the rest sorted by name
+func GroupNames(groups map[string][]string) []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		if name != RootGroup {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if _, ok := groups[RootGroup]; ok {
+		names = append([]string{RootGroup}, names...)
+	}
+	return names
+}
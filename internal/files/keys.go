@@ -0,0 +1,69 @@
+package files
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeyBinding is a control of the player: the keys or mouse action, and what it does
+type KeyBinding struct {
+	Keys   string
+	Action string
+}
+
+// KeyBindings lists the controls of the player in the order they are documented.
+// The usage instructions and the in-app help are both generated from it, so add new bindings here.
+var KeyBindings = []KeyBinding{
+	{"Space", "Toggle pause"},
+	{"X", "Stop and rewind / play"},
+	{"N", "Skip to next track"},
+	{"P", "Skip to previous track"},
+	{"J", "Jump to a random other track, keeping the playback order"},
+	{"R", "Cycle repeat mode (All, One, Off)"},
+	{"Shift+R", "Toggle stopping after each track instead of advancing"},
+	{"D", "Cycle loop duration presets (0.5, 1, 2, 5 minutes by default)"},
+	{"T", "Play or stop a 1kHz -12dBFS reference tone, pausing the track"},
+	{"A / Shift+A", "Cut / boost the preview EQ's low shelf by 3dB"},
+	{"Z / Shift+Z", "Cut / boost the preview EQ's high shelf by 3dB"},
+	{"Q", "Bypass the preview EQ"},
+	{"S", "Toggle shuffle"},
+	{"O", "Cycle sort order (None, Name, Modified, Duration)"},
+	{"[ / ]", "Decrease / increase playback speed"},
+	{"Up / Down", "Increase / decrease volume"},
+	{"Click the list, then Up / Down and Enter", "Choose a track to play"},
+	{"M", "Toggle mute"},
+	{"Shift+M", "Toggle folding playback to mono"},
+	{", / .", "Pan playback left / right"},
+	{"F", "Show the current track in the file manager"},
+	{"Shift+F", "Flag the current track as a favorite (marked with *)"},
+	{"G", "Toggle volume normalization"},
+	{"Shift+G", "Cycle the subdirectory the list is limited to (all, (root), then each folder)"},
+	{"B", "Go back to the previously played track"},
+	{"U", "Toggle pausing while the window is unfocused"},
+	{"W", "Switch between the full window and a compact, always-on-top mini window"},
+	{"0-9 then Enter", "Jump to a track by number"},
+	{"I", "Start the next track now, skipping the fade-out and interval"},
+	{"L", "Toggle replaying the few seconds across the loop seam"},
+	{"Shift+C", "Mark the current track as B for comparison"},
+	{"C", "Switch between the selected track and B at the same position"},
+	{"Alt+Up/Down", "Move the current track up or down the list (O returns to sorting)"},
+	{"Drag a track in the list", "Move it to where it is dropped (O returns to sorting)"},
+	{"Click the note field", "Write a note on the current track"},
+	{"E / Shift+E", "Export the review report as CSV / JSON"},
+	{"H or ?", "Show or hide this list of controls"},
+	{"Sliders", "Adjust volume, loop and interval durations"},
+}
+
+// String returns the binding as "Keys: Action"
+func (b KeyBinding) String() string {
+	return b.Keys + ": " + b.Action
+}
+
+// numberedKeyBindings returns KeyBindings as lines of a numbered list starting at first
+func numberedKeyBindings(first int) string {
+	var sb strings.Builder
+	for i, binding := range KeyBindings {
+		fmt.Fprintf(&sb, "%d. %s\n", first+i, binding)
+	}
+	return sb.String()
+}
@@ -0,0 +1,67 @@
+package files
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"musicplayer/internal/logging"
+)
+
+// LoadPlaylist reads an M3U playlist and returns the listed music files in order.
+//
+// Lines starting with '#' are comments (including #EXTM3U and #EXTINF) and are ignored.
+// Relative paths are resolved against the playlist's directory.
+// Entries that don't exist or aren't supported music files are skipped with a warning
+// to logger; nil discards the warnings.
+func LoadPlaylist(path string, logger logging.Logger) ([]string, error) {
+	if logger == nil {
+		logger = logging.Discard()
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open playlist: %v", err)
+	}
+	defer f.Close()
+
+	baseDir := filepath.Dir(path)
+	musicFiles := []string{}
+
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if lineNum == 1 {
+			line = strings.TrimPrefix(line, "\ufeff") // UTF-8 BOM
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entry := filepath.FromSlash(line)
+		if !filepath.IsAbs(entry) {
+			entry = filepath.Join(baseDir, entry)
+		}
+
+		if !IsMusicFile(entry) {
+			logger.Warn("Skipping unsupported playlist entry %s (%s:%d)", line, path, lineNum)
+			continue
+		}
+		if info, err := os.Stat(entry); err != nil || info.IsDir() {
+			logger.Warn("Skipping missing playlist entry %s (%s:%d)", line, path, lineNum)
+			continue
+		}
+
+		musicFiles = append(musicFiles, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read playlist: %v", err)
+	}
+
+	return musicFiles, nil
+}
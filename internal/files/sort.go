@@ -0,0 +1,129 @@
+package files
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SortMode specifies the order of the music file list
+type SortMode int
+
+const (
+	SortNone       SortMode = iota // Keep the order files were found or listed in
+	SortByName                     // File name, ignoring the directory and case
+	SortByModTime                  // Most recently modified first
+	SortByDuration                 // Shortest first
+)
+
+// String returns a display name for the sort mode
+func (m SortMode) String() string {
+	switch m {
+	case SortNone:
+		return "None"
+	case SortByName:
+		return "Name"
+	case SortByModTime:
+		return "Modified"
+	case SortByDuration:
+		return "Duration"
+	default:
+		return fmt.Sprintf("SortMode(%d)", int(m))
+	}
+}
+
+// Next returns the sort mode that follows m when cycling through modes
+func (m SortMode) Next() SortMode {
+	if m >= SortByDuration || m < SortNone {
+		return SortNone
+	}
+	return m + 1
+}
+
+// DurationFunc returns the duration of a music file
+type DurationFunc func(path string) (time.Duration, error)
+
+// SortMusicFiles returns a sorted copy of the music files.
+//
+// durationOf is only used by SortByDuration and may be nil for the other modes.
+// Files whose modification time or duration can't be determined are placed last.
+// Ties are broken by path. SortNone and unknown modes return the files unchanged.
+func SortMusicFiles(musicFiles []string, mode SortMode, durationOf DurationFunc) []string {
+	sorted := make([]string, len(musicFiles))
+	copy(sorted, musicFiles)
+
+	switch mode {
+	case SortByName:
+		sort.SliceStable(sorted, func(i, j int) bool {
+			a, b := strings.ToLower(filepath.Base(sorted[i])), strings.ToLower(filepath.Base(sorted[j]))
+			if a != b {
+				return a < b
+			}
+			return sorted[i] < sorted[j]
+		})
+
+	case SortByModTime:
+		modTimes := make(map[string]time.Time, len(sorted))
+		for _, path := range sorted {
+			if info, err := os.Stat(path); err == nil {
+				modTimes[path] = info.ModTime()
+			}
+		}
+		sortByKnownValue(sorted, func(path string) (time.Time, bool) {
+			t, ok := modTimes[path]
+			return t, ok
+		}, func(a, b time.Time) bool { return a.After(b) })
+
+	case SortByDuration:
+		durations := make(map[string]time.Duration, len(sorted))
+		if durationOf != nil {
+			for _, path := range sorted {
+				if d, err := durationOf(path); err == nil {
+					durations[path] = d
+				}
+			}
+		}
+		sortByKnownValue(sorted, func(path string) (time.Duration, bool) {
+			d, ok := durations[path]
+			return d, ok
+		}, func(a, b time.Duration) bool { return a < b })
+	}
+
+	return sorted
+}
+
+// ComparePaths is the order music files are found in: by path, one directory level at a time,
+// ignoring case, so a directory's files come together and the order is the same on every OS.
+// Paths that differ only in case are ordered by their bytes. It returns a negative number if a
+// comes first, a positive number if b does and zero if they are the same path.
+func ComparePaths(a, b string) int {
+	partsA := strings.Split(filepath.ToSlash(a), "/")
+	partsB := strings.Split(filepath.ToSlash(b), "/")
+	for i := range min(len(partsA), len(partsB)) {
+		if c := strings.Compare(strings.ToLower(partsA[i]), strings.ToLower(partsB[i])); c != 0 {
+			return c
+		}
+	}
+	if len(partsA) != len(partsB) {
+		return len(partsA) - len(partsB)
+	}
+	return strings.Compare(a, b)
+}
+
+// sortByKnownValue sorts paths by a looked-up value, placing paths without a value last.
+func sortByKnownValue[T comparable](paths []string, value func(string) (T, bool), less func(a, b T) bool) {
+	sort.SliceStable(paths, func(i, j int) bool {
+		a, okA := value(paths[i])
+		b, okB := value(paths[j])
+		if okA != okB {
+			return okA
+		}
+		if okA && a != b {
+			return less(a, b)
+		}
+		return paths[i] < paths[j]
+	})
+}
@@ -0,0 +1,284 @@
+package files
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// TestDirectoryWatcher_HandleEvent tests which events lead to a rescan, without real file system events
+func TestDirectoryWatcher_HandleEvent(t *testing.T) {
+	dir := t.TempDir()
+
+	dw, err := NewDirectoryWatcher()
+	if err != nil {
+		t.Fatalf("NewDirectoryWatcher() error = %v", err)
+	}
+	defer dw.Close()
+
+	tests := []struct {
+		name  string
+		event fsnotify.Event
+		want  bool
+	}{
+		{"Created file", fsnotify.Event{Name: filepath.Join(dir, "a.wav"), Op: fsnotify.Create}, true},
+		{"Removed file", fsnotify.Event{Name: filepath.Join(dir, "a.wav"), Op: fsnotify.Remove}, true},
+		{"Renamed file", fsnotify.Event{Name: filepath.Join(dir, "a.wav"), Op: fsnotify.Rename}, true},
+		{"Written file", fsnotify.Event{Name: filepath.Join(dir, "a.wav"), Op: fsnotify.Write}, false},
+		{"Changed permissions", fsnotify.Event{Name: filepath.Join(dir, "a.wav"), Op: fsnotify.Chmod}, false},
+		{"Temporary file", fsnotify.Event{Name: filepath.Join(dir, ".a.wav.swp"), Op: fsnotify.Create}, false},
+		{"Hidden directory", fsnotify.Event{Name: filepath.Join(dir, ".cache"), Op: fsnotify.Remove}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dw.handleEvent(tt.event); got != tt.want {
+				t.Errorf("handleEvent(%v) = %v, want %v", tt.event, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDirectoryWatcher_HandleEvent_Directories tests that created directories are watched,
+// with their subdirectories, and removed ones are dropped
+func TestDirectoryWatcher_HandleEvent_Directories(t *testing.T) {
+	dir := t.TempDir()
+	album := filepath.Join(dir, "album")
+	disc := filepath.Join(album, "disc1")
+	if err := os.MkdirAll(disc, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dw, err := NewDirectoryWatcher()
+	if err != nil {
+		t.Fatalf("NewDirectoryWatcher() error = %v", err)
+	}
+	defer dw.Close()
+
+	if !dw.handleEvent(fsnotify.Event{Name: album, Op: fsnotify.Create}) {
+		t.Error("Expected a created directory to lead to a rescan")
+	}
+	if got, want := dw.WatchedDirectories(), []string{album, disc}; !slices.Equal(got, want) {
+		t.Errorf("WatchedDirectories() = %v, want %v", got, want)
+	}
+
+	if !dw.handleEvent(fsnotify.Event{Name: album, Op: fsnotify.Rename}) {
+		t.Error("Expected a moved directory to lead to a rescan")
+	}
+	if got := dw.WatchedDirectories(); len(got) != 0 {
+		t.Errorf("WatchedDirectories() = %v after the directory moved away, want none", got)
+	}
+
+	// Shallow watchers don't watch subdirectories
+	dw.SetRecursive(false)
+	if !dw.handleEvent(fsnotify.Event{Name: album, Op: fsnotify.Create}) {
+		t.Error("Expected a created directory to lead to a rescan")
+	}
+	if got := dw.WatchedDirectories(); len(got) != 0 {
+		t.Errorf("WatchedDirectories() = %v for a shallow watcher, want none", got)
+	}
+}
+
+// TestDirectoryWatcher_Debounce feeds simulated events to the watch loop and tests that a burst
+// is reported once it settles, and that ignored events aren't reported at all
+func TestDirectoryWatcher_Debounce(t *testing.T) {
+	md := MusicDirectory(t.TempDir())
+	if err := os.WriteFile(filepath.Join(md.Path(), "a.wav"), []byte("dummy"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	const debounce = 100 * time.Millisecond
+	dw, err := NewDirectoryWatcherWithDebounce(debounce)
+	if err != nil {
+		t.Fatalf("NewDirectoryWatcherWithDebounce() error = %v", err)
+	}
+	defer dw.Close()
+	dw.mu.Lock()
+	dw.roots = append(dw.roots, md) // Not watched, so only the simulated events arrive
+	dw.mu.Unlock()
+
+	received := make(chan time.Time, 10)
+	dw.AddHandler(func([]string) {
+		received <- time.Now()
+	})
+
+	// A burst of events restarts the timer each time, so it is reported once, after the last event
+	var last time.Time
+	for range 5 {
+		dw.watcher.Events <- fsnotify.Event{Name: filepath.Join(md.Path(), "a.wav"), Op: fsnotify.Create}
+		last = time.Now()
+		time.Sleep(debounce / 4)
+	}
+	select {
+	case at := <-received:
+		if at.Sub(last) < debounce {
+			t.Errorf("Notified %v after the last event, want at least %v", at.Sub(last), debounce)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Handler was not called")
+	}
+	select {
+	case <-received:
+		t.Error("Handler called again, want a single notification for the burst")
+	case <-time.After(3 * debounce):
+	}
+
+	// Temporary files don't start a rescan, even when the music files changed meanwhile
+	if err := os.WriteFile(filepath.Join(md.Path(), "b.wav"), []byte("dummy"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dw.watcher.Events <- fsnotify.Event{Name: filepath.Join(md.Path(), ".b.wav.part"), Op: fsnotify.Create}
+	dw.watcher.Events <- fsnotify.Event{Name: filepath.Join(md.Path(), "b.wav"), Op: fsnotify.Write}
+	select {
+	case <-received:
+		t.Error("Handler called for ignored events")
+	case <-time.After(3 * debounce):
+	}
+}
+
+// TestDirectoryWatcher_Reinitialize tests that repeated errors make the watcher start over with a
+// new fsnotify watcher, watching the same directories and delivering events again
+func TestDirectoryWatcher_Reinitialize(t *testing.T) {
+	md := MusicDirectory(t.TempDir())
+	sub := filepath.Join(md.Path(), "album")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dw, err := NewDirectoryWatcherWithDebounce(50 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewDirectoryWatcherWithDebounce() error = %v", err)
+	}
+	defer dw.Close()
+	if err := dw.AddRoot(md); err != nil {
+		t.Fatalf("AddRoot() error = %v", err)
+	}
+	watched := dw.WatchedDirectories()
+	received := make(chan []string, 10)
+	dw.AddHandler(func(files []string) {
+		received <- files
+	})
+
+	// A single error is only logged
+	old := dw.fsWatcher()
+	old.Errors <- errors.New("simulated error")
+	if !dw.IsHealthy() {
+		t.Error("Expected the watcher to stay healthy after a single error")
+	}
+
+	for range watcherErrorLimit - 1 {
+		old.Errors <- errors.New("simulated error")
+	}
+	waitFor(t, 5*time.Second, "the watcher to be replaced and healthy after repeated errors", func() bool {
+		return dw.fsWatcher() != old && dw.IsHealthy()
+	})
+	if got := dw.WatchedDirectories(); !slices.Equal(got, watched) {
+		t.Errorf("WatchedDirectories() = %v after starting over, want %v", got, watched)
+	}
+
+	// The rescan after starting over reports the files, then events arrive from the new watcher
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a rescan after starting over")
+	}
+	path := filepath.Join(sub, "new.wav")
+	if err := os.WriteFile(path, []byte("dummy"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case files := <-received:
+		if !slices.Contains(files, path) {
+			t.Errorf("Expected %s in the notified files, got %v", path, files)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected an event from the new watcher")
+	}
+}
+
+// TestDirectoryWatcher_ReinitializeFailure tests that the watcher is unhealthy while the music
+// directories can't be watched again, and keeps retrying until they can
+func TestDirectoryWatcher_ReinitializeFailure(t *testing.T) {
+	md := MusicDirectory(filepath.Join(t.TempDir(), "music"))
+
+	dw, err := NewDirectoryWatcher()
+	if err != nil {
+		t.Fatalf("NewDirectoryWatcher() error = %v", err)
+	}
+	defer dw.Close()
+	dw.SetLogger(nil)
+	if err := dw.AddRoot(md); err != nil {
+		t.Fatalf("AddRoot() error = %v", err)
+	}
+
+	if err := os.Remove(md.Path()); err != nil {
+		t.Fatal(err)
+	}
+	old := dw.fsWatcher()
+	for range watcherErrorLimit {
+		old.Errors <- errors.New("simulated error")
+	}
+	waitFor(t, 5*time.Second, "the watcher to be unhealthy", func() bool {
+		return !dw.IsHealthy()
+	})
+
+	if err := os.Mkdir(md.Path(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 2*watcherRetryInterval, "the watcher to recover once the directory is back", dw.IsHealthy)
+}
+
+// TestDirectoryWatcher_RescansOneAtATime tests that a rescan waits for the one in progress,
+// so the results are recorded and delivered in the order of the scans
+func TestDirectoryWatcher_RescansOneAtATime(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.wav"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dw, err := NewDirectoryWatcher()
+	if err != nil {
+		t.Fatalf("NewDirectoryWatcher() error = %v", err)
+	}
+	defer dw.Close()
+	if err := dw.AddRoot(MusicDirectory(dir)); err != nil {
+		t.Fatalf("AddRoot() error = %v", err)
+	}
+	notified := make(chan []string, 2)
+	dw.AddHandler(func(files []string) { notified <- files })
+
+	// A scan in progress holds back the next one
+	dw.scanMu.Lock()
+	go dw.notifyIfChanged()
+	select {
+	case files := <-notified:
+		t.Fatalf("Expected the rescan to wait for the one in progress, got %v", files)
+	case <-time.After(50 * time.Millisecond):
+	}
+	dw.scanMu.Unlock()
+
+	select {
+	case files := <-notified:
+		if len(files) != 1 {
+			t.Errorf("Expected the rescan to find a.wav, got %v", files)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the rescan")
+	}
+}
+
+// waitFor polls the condition until it holds, failing the test after the timeout
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,240 @@
+// Package flac provides a FLAC decoder producing 16bit stereo PCM streams, as Ebitengine's audio package plays them.
+package flac
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"musicplayer/internal/resample"
+)
+
+const (
+	// Output format: signed 16bit little endian, 2 channels
+	bytesPerSample = 4
+
+	blockTypeStreamInfo = 0
+)
+
+// Stream is a decoded FLAC stream.
+//
+// The format is signed 16bit integer little endian PCM. The channel count is 2.
+type Stream struct {
+	inner      io.ReadSeeker
+	size       int64
+	sampleRate int
+}
+
+// Read is implementation of io.Reader's Read.
+func (s *Stream) Read(p []byte) (int, error) {
+	return s.inner.Read(p)
+}
+
+// Seek is implementation of io.Seeker's Seek.
+func (s *Stream) Seek(offset int64, whence int) (int64, error) {
+	return s.inner.Seek(offset, whence)
+}
+
+// Length returns the size of decoded stream in bytes.
+func (s *Stream) Length() int64 {
+	return s.size
+}
+
+// SampleRate returns the sample rate of the decoded stream.
+func (s *Stream) SampleRate() int {
+	return s.sampleRate
+}
+
+// streamInfo holds the fields of the STREAMINFO metadata block needed for decoding.
+type streamInfo struct {
+	sampleRate    int
+	channels      int
+	bitsPerSample int
+	totalSamples  int64
+}
+
+// Info is the sample format of a FLAC stream as stored, before conversion.
+type Info struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+}
+
+// ReadInfo reads the sample format from the STREAMINFO block without decoding any audio frames.
+func ReadInfo(src io.Reader) (*Info, error) {
+	info, err := readMetadata(src)
+	if err != nil {
+		return nil, err
+	}
+	return &Info{
+		SampleRate:    info.sampleRate,
+		Channels:      info.channels,
+		BitsPerSample: info.bitsPerSample,
+	}, nil
+}
+
+// DecodeWithoutResampling decodes FLAC data to playable stream in signed 16bit integer, little endian, 2 channels (stereo) format.
+//
+// The source must be 1 or 2 channels. Samples of other bit depths are converted into 16bit.
+//
+// The whole file is decoded into memory, so the returned Stream is always seekable
+// and src can be closed once DecodeWithoutResampling returns.
+func DecodeWithoutResampling(src io.Reader) (*Stream, error) {
+	br := bufio.NewReader(src)
+
+	info, err := readMetadata(br)
+	if err != nil {
+		return nil, err
+	}
+	if info.channels != 1 && info.channels != 2 {
+		return nil, fmt.Errorf("flac: unsupported channel count: %d", info.channels)
+	}
+
+	pcm, err := decodeFrames(br, info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Stream{
+		inner:      bytes.NewReader(pcm),
+		size:       int64(len(pcm)),
+		sampleRate: info.sampleRate,
+	}, nil
+}
+
+// DecodeWithSampleRate decodes FLAC data to playable stream in signed 16bit integer, little endian, 2 channels (stereo) format.
+//
+// DecodeWithSampleRate automatically resamples the stream to fit with sampleRate if necessary.
+func DecodeWithSampleRate(sampleRate int, src io.Reader) (*Stream, error) {
+	s, err := DecodeWithoutResampling(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if sampleRate == s.sampleRate {
+		return s, nil
+	}
+
+	r := resample.NewReader(s.inner, s.size, s.sampleRate, sampleRate)
+	return &Stream{
+		inner:      r,
+		size:       r.Length(),
+		sampleRate: sampleRate,
+	}, nil
+}
+
+// readMetadata checks the stream marker and reads the metadata blocks, returning STREAMINFO.
+func readMetadata(r io.Reader) (*streamInfo, error) {
+	marker := make([]byte, 4)
+	if _, err := io.ReadFull(r, marker); err != nil {
+		return nil, fmt.Errorf("flac: failed to read stream marker: %v", err)
+	}
+
+	// Some taggers prepend an ID3v2 tag; skip it
+	if string(marker[:3]) == "ID3" {
+		header := make([]byte, 6)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, fmt.Errorf("flac: failed to read ID3 header: %v", err)
+		}
+		// Tag size is a 28bit syncsafe integer following the version and flags bytes
+		size := int64(header[2])<<21 | int64(header[3])<<14 | int64(header[4])<<7 | int64(header[5])
+		if _, err := io.CopyN(io.Discard, r, size); err != nil {
+			return nil, fmt.Errorf("flac: failed to skip ID3 tag: %v", err)
+		}
+		if _, err := io.ReadFull(r, marker); err != nil {
+			return nil, fmt.Errorf("flac: failed to read stream marker: %v", err)
+		}
+	}
+
+	if string(marker) != "fLaC" {
+		return nil, fmt.Errorf("flac: invalid stream marker")
+	}
+
+	var info *streamInfo
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, fmt.Errorf("flac: failed to read metadata block header: %v", err)
+		}
+		isLast := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+
+		if blockType == blockTypeStreamInfo {
+			block := make([]byte, length)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return nil, fmt.Errorf("flac: failed to read STREAMINFO: %v", err)
+			}
+			if len(block) < 18 {
+				return nil, fmt.Errorf("flac: STREAMINFO too short")
+			}
+			// Bytes 10-17: sample rate (20 bits), channels-1 (3 bits),
+			// bits per sample-1 (5 bits), total samples (36 bits)
+			v := binary.BigEndian.Uint64(block[10:18])
+			info = &streamInfo{
+				sampleRate:    int(v >> 44),
+				channels:      int(v>>41&0x7) + 1,
+				bitsPerSample: int(v>>36&0x1f) + 1,
+				totalSamples:  int64(v & 0xfffffffff),
+			}
+		} else if _, err := io.CopyN(io.Discard, r, length); err != nil {
+			return nil, fmt.Errorf("flac: failed to skip metadata block: %v", err)
+		}
+
+		if isLast {
+			break
+		}
+	}
+
+	if info == nil {
+		return nil, fmt.Errorf("flac: missing STREAMINFO")
+	}
+	if info.sampleRate == 0 {
+		return nil, fmt.Errorf("flac: invalid sample rate")
+	}
+	return info, nil
+}
+
+// decodeFrames decodes all audio frames and returns them as 16bit stereo PCM.
+// The buffer isn't sized from STREAMINFO's total samples, which a corrupt file can set to billions.
+func decodeFrames(r io.ByteReader, info *streamInfo) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	br := &bitReader{r: r}
+	var decoded int64
+	for info.totalSamples == 0 || decoded < info.totalSamples {
+		f, err := decodeFrame(br, info)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("flac: failed to decode frame: %v", err)
+		}
+
+		// Mono is duplicated into both channels
+		left := f.samples[0]
+		right := f.samples[0]
+		if len(f.samples) > 1 {
+			right = f.samples[1]
+		}
+		out := make([]byte, len(left)*bytesPerSample)
+		for i := range left {
+			binary.LittleEndian.PutUint16(out[i*4:], uint16(to16Bit(left[i], f.bitsPerSample)))
+			binary.LittleEndian.PutUint16(out[i*4+2:], uint16(to16Bit(right[i], f.bitsPerSample)))
+		}
+		buf.Write(out)
+		decoded += int64(len(left))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// to16Bit scales a sample of the given bit depth to 16bit.
+func to16Bit(sample int32, bitsPerSample int) int16 {
+	if bitsPerSample > 16 {
+		return int16(sample >> (bitsPerSample - 16))
+	}
+	return int16(sample << (16 - bitsPerSample))
+}
@@ -0,0 +1,163 @@
+package flac_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"musicplayer/internal/flac"
+)
+
+// bitWriter writes big endian bit fields for building test streams
+type bitWriter struct {
+	buf   bytes.Buffer
+	cache uint64
+	n     uint
+}
+
+func (w *bitWriter) write(v uint64, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		w.cache = w.cache<<1 | (v>>uint(i))&1
+		w.n++
+		if w.n == 8 {
+			w.buf.WriteByte(byte(w.cache))
+			w.cache = 0
+			w.n = 0
+		}
+	}
+}
+
+func (w *bitWriter) align() {
+	for w.n != 0 {
+		w.write(0, 1)
+	}
+}
+
+// encodeVerbatim builds a 16bit FLAC stream with a single frame of verbatim subframes.
+// CRCs are left zero since the decoder doesn't verify them.
+func encodeVerbatim(channels [][]int16, sampleRate int) []byte {
+	w := &bitWriter{}
+	blockSize := len(channels[0])
+
+	w.buf.WriteString("fLaC")
+
+	// STREAMINFO, marked as the last metadata block
+	w.write(1, 1)
+	w.write(0, 7)
+	w.write(34, 24)
+	w.write(uint64(blockSize), 16)
+	w.write(uint64(blockSize), 16)
+	w.write(0, 24)
+	w.write(0, 24)
+	w.write(uint64(sampleRate), 20)
+	w.write(uint64(len(channels)-1), 3)
+	w.write(15, 5)
+	w.write(uint64(blockSize), 36)
+	w.write(0, 64)
+	w.write(0, 64)
+
+	// Frame header
+	w.write(0x3ffe, 14)
+	w.write(0, 2)
+	w.write(7, 4) // 16bit block size at the end of the header
+	w.write(0, 4) // Sample rate from STREAMINFO
+	w.write(uint64(len(channels)-1), 4)
+	w.write(4, 3) // 16bit samples
+	w.write(0, 1)
+	w.write(0, 8) // Frame number 0
+	w.write(uint64(blockSize-1), 16)
+	w.write(0, 8)
+
+	for _, samples := range channels {
+		w.write(0, 1)
+		w.write(1, 6) // Verbatim
+		w.write(0, 1)
+		for _, s := range samples {
+			w.write(uint64(uint16(s)), 16)
+		}
+	}
+	w.align()
+	w.write(0, 16)
+
+	return w.buf.Bytes()
+}
+
+func TestDecodeWithoutResampling(t *testing.T) {
+	left := []int16{0, 1000, -1000, 32767, -32768}
+	right := []int16{5, -5, 12345, -12345, 0}
+	data := encodeVerbatim([][]int16{left, right}, 44100)
+
+	s, err := flac.DecodeWithoutResampling(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 44100, s.SampleRate())
+	assert.Equal(t, int64(len(left)*4), s.Length())
+
+	pcm, err := io.ReadAll(s)
+	require.NoError(t, err)
+	require.Len(t, pcm, len(left)*4)
+	for i := range left {
+		assert.Equal(t, left[i], int16(binary.LittleEndian.Uint16(pcm[i*4:])), "left sample %d", i)
+		assert.Equal(t, right[i], int16(binary.LittleEndian.Uint16(pcm[i*4+2:])), "right sample %d", i)
+	}
+}
+
+func TestDecodeWithoutResampling_Mono(t *testing.T) {
+	mono := []int16{100, -200, 300}
+	data := encodeVerbatim([][]int16{mono}, 48000)
+
+	s, err := flac.DecodeWithoutResampling(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	pcm, err := io.ReadAll(s)
+	require.NoError(t, err)
+	require.Len(t, pcm, len(mono)*4)
+	for i := range mono {
+		assert.Equal(t, mono[i], int16(binary.LittleEndian.Uint16(pcm[i*4:])))
+		assert.Equal(t, mono[i], int16(binary.LittleEndian.Uint16(pcm[i*4+2:])))
+	}
+}
+
+func TestDecodeWithSampleRate(t *testing.T) {
+	samples := make([]int16, 4410)
+	data := encodeVerbatim([][]int16{samples, samples}, 44100)
+
+	s, err := flac.DecodeWithSampleRate(48000, bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 48000, s.SampleRate())
+	assert.InDelta(t, 4800*4, s.Length(), 8)
+
+	_, err = s.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+}
+
+func TestDecode_CorruptTotalSamples(t *testing.T) {
+	samples := []int16{1, 2, 3}
+	data := encodeVerbatim([][]int16{samples}, 48000)
+	// Claim the maximum total samples in STREAMINFO; only the frames present are decoded
+	data[8+13] |= 0x0f
+	copy(data[8+14:8+18], []byte{0xff, 0xff, 0xff, 0xff})
+
+	s, err := flac.DecodeWithoutResampling(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(samples)*4), s.Length())
+}
+
+func TestDecode_InvalidMarker(t *testing.T) {
+	_, err := flac.DecodeWithoutResampling(bytes.NewReader([]byte("RIFF0000WAVE")))
+	assert.Error(t, err)
+}
+
+func TestReadInfo(t *testing.T) {
+	data := encodeVerbatim([][]int16{{1, 2, 3}}, 22050)
+
+	info, err := flac.ReadInfo(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, &flac.Info{SampleRate: 22050, Channels: 1, BitsPerSample: 16}, info)
+
+	_, err = flac.ReadInfo(bytes.NewReader([]byte("OggS")))
+	assert.Error(t, err)
+}
@@ -0,0 +1,483 @@
+package flac
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// Channel assignments for inter-channel decorrelation
+const (
+	channelsLeftSide  = 8
+	channelsSideRight = 9
+	channelsMidSide   = 10
+)
+
+// frame is a decoded audio frame.
+type frame struct {
+	samples       [][]int32 // Samples per channel
+	bitsPerSample int
+}
+
+// decodeFrame reads a single frame, returning io.EOF when no more frames are available.
+func decodeFrame(br *bitReader, info *streamInfo) (*frame, error) {
+	// Sync code (14 bits), reserved bit and blocking strategy bit
+	sync, err := br.readBits(16)
+	if err != nil {
+		return nil, err
+	}
+	if sync>>2 != 0x3ffe {
+		return nil, fmt.Errorf("invalid frame sync code: %#x", sync)
+	}
+
+	blockSizeCode, err := br.readBits(4)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	sampleRateCode, err := br.readBits(4)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	channelAssignment, err := br.readBits(4)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	sampleSizeCode, err := br.readBits(3)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	if _, err := br.readBits(1); err != nil {
+		return nil, unexpected(err)
+	}
+
+	// Frame or sample number, coded like UTF-8; the value itself isn't needed
+	first, err := br.readBits(8)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	for extra := bits.LeadingZeros8(^uint8(first)) - 1; extra > 0; extra-- {
+		if _, err := br.readBits(8); err != nil {
+			return nil, unexpected(err)
+		}
+	}
+
+	var blockSize int
+	switch {
+	case blockSizeCode == 1:
+		blockSize = 192
+	case blockSizeCode >= 2 && blockSizeCode <= 5:
+		blockSize = 576 << (blockSizeCode - 2)
+	case blockSizeCode == 6:
+		v, err := br.readBits(8)
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		blockSize = int(v) + 1
+	case blockSizeCode == 7:
+		v, err := br.readBits(16)
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		blockSize = int(v) + 1
+	case blockSizeCode >= 8:
+		blockSize = 256 << (blockSizeCode - 8)
+	default:
+		return nil, fmt.Errorf("reserved block size code")
+	}
+
+	// The sample rate always comes from STREAMINFO, but the extra header bytes must be skipped
+	switch sampleRateCode {
+	case 12:
+		if _, err := br.readBits(8); err != nil {
+			return nil, unexpected(err)
+		}
+	case 13, 14:
+		if _, err := br.readBits(16); err != nil {
+			return nil, unexpected(err)
+		}
+	case 15:
+		return nil, fmt.Errorf("invalid sample rate code")
+	}
+
+	bitsPerSample := info.bitsPerSample
+	switch sampleSizeCode {
+	case 1:
+		bitsPerSample = 8
+	case 2:
+		bitsPerSample = 12
+	case 3:
+		return nil, fmt.Errorf("reserved sample size code")
+	case 4:
+		bitsPerSample = 16
+	case 5:
+		bitsPerSample = 20
+	case 6:
+		bitsPerSample = 24
+	case 7:
+		bitsPerSample = 32
+	}
+
+	// CRC-8 of the header
+	if _, err := br.readBits(8); err != nil {
+		return nil, unexpected(err)
+	}
+
+	channels := int(channelAssignment) + 1
+	if channelAssignment >= channelsLeftSide {
+		if channelAssignment > channelsMidSide {
+			return nil, fmt.Errorf("reserved channel assignment: %d", channelAssignment)
+		}
+		channels = 2
+	}
+
+	samples := make([][]int32, channels)
+	for ch := range samples {
+		// The side channel carries one extra bit
+		subframeBits := bitsPerSample
+		if (channelAssignment == channelsLeftSide && ch == 1) ||
+			(channelAssignment == channelsSideRight && ch == 0) ||
+			(channelAssignment == channelsMidSide && ch == 1) {
+			subframeBits++
+		}
+		s, err := decodeSubframe(br, blockSize, subframeBits)
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		samples[ch] = s
+	}
+
+	switch channelAssignment {
+	case channelsLeftSide:
+		for i := range samples[0] {
+			samples[1][i] = samples[0][i] - samples[1][i]
+		}
+	case channelsSideRight:
+		for i := range samples[0] {
+			samples[0][i] += samples[1][i]
+		}
+	case channelsMidSide:
+		for i := range samples[0] {
+			mid := samples[0][i]<<1 | samples[1][i]&1
+			side := samples[1][i]
+			samples[0][i] = (mid + side) >> 1
+			samples[1][i] = (mid - side) >> 1
+		}
+	}
+
+	// Padding to the byte boundary and CRC-16 of the frame
+	br.align()
+	if _, err := br.readBits(16); err != nil {
+		return nil, unexpected(err)
+	}
+
+	return &frame{samples: samples, bitsPerSample: bitsPerSample}, nil
+}
+
+// decodeSubframe decodes one channel of a frame.
+func decodeSubframe(br *bitReader, blockSize int, bitsPerSample int) ([]int32, error) {
+	header, err := br.readBits(8)
+	if err != nil {
+		return nil, err
+	}
+	if header&0x80 != 0 {
+		return nil, fmt.Errorf("invalid subframe padding")
+	}
+	subframeType := header >> 1 & 0x3f
+
+	// Wasted bits-per-sample, unary coded
+	wasted := 0
+	if header&1 != 0 {
+		n, err := br.readUnary()
+		if err != nil {
+			return nil, err
+		}
+		wasted = int(n) + 1
+		bitsPerSample -= wasted
+	}
+
+	samples := make([]int32, blockSize)
+	switch {
+	case subframeType == 0:
+		// Constant
+		v, err := br.readSigned(uint(bitsPerSample))
+		if err != nil {
+			return nil, err
+		}
+		for i := range samples {
+			samples[i] = int32(v)
+		}
+
+	case subframeType == 1:
+		// Verbatim
+		for i := range samples {
+			v, err := br.readSigned(uint(bitsPerSample))
+			if err != nil {
+				return nil, err
+			}
+			samples[i] = int32(v)
+		}
+
+	case subframeType >= 8 && subframeType <= 12:
+		// Fixed predictor
+		order := int(subframeType - 8)
+		if err := decodeFixed(br, samples, order, bitsPerSample); err != nil {
+			return nil, err
+		}
+
+	case subframeType >= 32:
+		// Linear predictor
+		order := int(subframeType-32) + 1
+		if err := decodeLPC(br, samples, order, bitsPerSample); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("reserved subframe type: %d", subframeType)
+	}
+
+	if wasted > 0 {
+		for i := range samples {
+			samples[i] <<= wasted
+		}
+	}
+	return samples, nil
+}
+
+// fixedCoefficients are the predictor coefficients for fixed orders 0 to 4.
+var fixedCoefficients = [][]int64{
+	{},
+	{1},
+	{2, -1},
+	{3, -3, 1},
+	{4, -6, 4, -1},
+}
+
+// decodeFixed decodes a subframe using one of the fixed polynomial predictors.
+func decodeFixed(br *bitReader, samples []int32, order int, bitsPerSample int) error {
+	if order > len(samples) {
+		return fmt.Errorf("predictor order %d exceeds block size %d", order, len(samples))
+	}
+	for i := 0; i < order; i++ {
+		v, err := br.readSigned(uint(bitsPerSample))
+		if err != nil {
+			return err
+		}
+		samples[i] = int32(v)
+	}
+	if err := decodeResidual(br, samples, order); err != nil {
+		return err
+	}
+	predict(samples, fixedCoefficients[order], 0)
+	return nil
+}
+
+// decodeLPC decodes a subframe using a linear predictor with explicit coefficients.
+func decodeLPC(br *bitReader, samples []int32, order int, bitsPerSample int) error {
+	if order > len(samples) {
+		return fmt.Errorf("predictor order %d exceeds block size %d", order, len(samples))
+	}
+	for i := 0; i < order; i++ {
+		v, err := br.readSigned(uint(bitsPerSample))
+		if err != nil {
+			return err
+		}
+		samples[i] = int32(v)
+	}
+
+	precision, err := br.readBits(4)
+	if err != nil {
+		return err
+	}
+	if precision == 0xf {
+		return fmt.Errorf("invalid coefficient precision")
+	}
+	shift, err := br.readSigned(5)
+	if err != nil {
+		return err
+	}
+	if shift < 0 {
+		return fmt.Errorf("negative predictor shift: %d", shift)
+	}
+
+	coefficients := make([]int64, order)
+	for i := range coefficients {
+		c, err := br.readSigned(uint(precision) + 1)
+		if err != nil {
+			return err
+		}
+		coefficients[i] = c
+	}
+
+	if err := decodeResidual(br, samples, order); err != nil {
+		return err
+	}
+	predict(samples, coefficients, uint(shift))
+	return nil
+}
+
+// predict adds the prediction to the residuals stored in samples[order:].
+func predict(samples []int32, coefficients []int64, shift uint) {
+	order := len(coefficients)
+	for i := order; i < len(samples); i++ {
+		var sum int64
+		for j, c := range coefficients {
+			sum += c * int64(samples[i-1-j])
+		}
+		samples[i] += int32(sum >> shift)
+	}
+}
+
+// decodeResidual reads the Rice coded residual into samples[order:].
+func decodeResidual(br *bitReader, samples []int32, order int) error {
+	method, err := br.readBits(2)
+	if err != nil {
+		return err
+	}
+	var paramBits uint
+	switch method {
+	case 0:
+		paramBits = 4
+	case 1:
+		paramBits = 5
+	default:
+		return fmt.Errorf("reserved residual coding method: %d", method)
+	}
+	escape := uint64(1)<<paramBits - 1
+
+	partitionOrder, err := br.readBits(4)
+	if err != nil {
+		return err
+	}
+	partitions := 1 << partitionOrder
+	partitionSize := len(samples) >> partitionOrder
+	if partitionSize < order {
+		return fmt.Errorf("invalid residual partition order: %d", partitionOrder)
+	}
+
+	i := order
+	for p := 0; p < partitions; p++ {
+		n := partitionSize
+		if p == 0 {
+			n -= order
+		}
+
+		param, err := br.readBits(paramBits)
+		if err != nil {
+			return err
+		}
+		if param == escape {
+			rawBits, err := br.readBits(5)
+			if err != nil {
+				return err
+			}
+			for j := 0; j < n; j++ {
+				var v int64
+				if rawBits > 0 {
+					v, err = br.readSigned(uint(rawBits))
+					if err != nil {
+						return err
+					}
+				}
+				samples[i] = int32(v)
+				i++
+			}
+			continue
+		}
+
+		for j := 0; j < n; j++ {
+			q, err := br.readUnary()
+			if err != nil {
+				return err
+			}
+			r, err := br.readBits(uint(param))
+			if err != nil {
+				return err
+			}
+			u := q<<param | r
+			samples[i] = int32(u>>1) ^ -int32(u&1)
+			i++
+		}
+	}
+	return nil
+}
+
+// unexpected converts io.EOF in the middle of a frame into io.ErrUnexpectedEOF.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// bitReader reads big endian bit fields from a byte stream.
+type bitReader struct {
+	r io.ByteReader
+	// cache holds n not yet consumed bits in its least significant bits
+	cache uint64
+	n     uint
+}
+
+// fill ensures at least n bits are cached. n must not exceed 56.
+func (b *bitReader) fill(n uint) error {
+	for b.n < n {
+		c, err := b.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		b.cache = b.cache<<8 | uint64(c)
+		b.n += 8
+	}
+	return nil
+}
+
+// readBits reads n bits (up to 32) as an unsigned value.
+func (b *bitReader) readBits(n uint) (uint64, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	if err := b.fill(n); err != nil {
+		return 0, err
+	}
+	b.n -= n
+	v := b.cache >> b.n & (1<<n - 1)
+	b.cache &= 1<<b.n - 1
+	return v, nil
+}
+
+// readSigned reads n bits as a two's complement signed value.
+func (b *bitReader) readSigned(n uint) (int64, error) {
+	v, err := b.readBits(n)
+	if err != nil {
+		return 0, err
+	}
+	shift := 64 - n
+	return int64(v<<shift) >> shift, nil
+}
+
+// readUnary counts zero bits up to the next one bit, consuming both.
+func (b *bitReader) readUnary() (uint64, error) {
+	var count uint64
+	for {
+		if b.n == 0 {
+			if err := b.fill(8); err != nil {
+				return 0, err
+			}
+		}
+		if b.cache == 0 {
+			count += uint64(b.n)
+			b.n = 0
+			continue
+		}
+		l := uint(bits.Len64(b.cache))
+		count += uint64(b.n - l)
+		b.n = l - 1
+		b.cache &= 1<<b.n - 1
+		return count, nil
+	}
+}
+
+// align discards the bits remaining in the current byte.
+func (b *bitReader) align() {
+	b.n -= b.n % 8
+	b.cache &= 1<<b.n - 1
+}
@@ -0,0 +1,121 @@
+// Package logging provides the leveled logger used by the player and the directory watcher,
+// so an embedding application can redirect or silence their output.
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Level is the severity of a log message
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelOff // Suppresses all messages
+)
+
+// String returns a display name for the level
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "Debug"
+	case LevelInfo:
+		return "Info"
+	case LevelWarn:
+		return "Warn"
+	case LevelError:
+		return "Error"
+	case LevelOff:
+		return "Off"
+	default:
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+}
+
+// ParseLevel returns the level with the given name, e.g. "warn", ignoring case
+func ParseLevel(name string) (Level, error) {
+	for level := LevelDebug; level <= LevelOff; level++ {
+		if strings.EqualFold(name, level.String()) {
+			return level, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level: %s", name)
+}
+
+// Logger receives log messages at four levels. The arguments are formatted as with fmt.Sprintf.
+type Logger interface {
+	Debug(format string, args ...any)
+	Info(format string, args ...any)
+	Warn(format string, args ...any)
+	Error(format string, args ...any)
+}
+
+// StdLogger is a Logger writing to a standard library logger.
+// Warnings are prefixed with "Warning: " and debug messages with "Debug: ";
+// info and error messages are written as is.
+type StdLogger struct {
+	logger *log.Logger
+	level  Level
+}
+
+// NewStdLogger creates a StdLogger writing messages at level or above to logger.
+// A nil logger writes to the standard logger of the log package.
+func NewStdLogger(logger *log.Logger, level Level) *StdLogger {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &StdLogger{logger: logger, level: level}
+}
+
+// Default returns the logger used unless another is set: the standard logger at LevelInfo
+func Default() Logger {
+	return NewStdLogger(nil, LevelInfo)
+}
+
+// Discard returns a logger that drops every message
+func Discard() Logger {
+	return NewStdLogger(nil, LevelOff)
+}
+
+// Level returns the minimum level of the messages written
+func (l *StdLogger) Level() Level {
+	return l.level
+}
+
+// SetLevel sets the minimum level of the messages written
+func (l *StdLogger) SetLevel(level Level) {
+	l.level = level
+}
+
+// Debug writes a debug message
+func (l *StdLogger) Debug(format string, args ...any) {
+	l.output(LevelDebug, "Debug: ", format, args)
+}
+
+// Info writes an informational message
+func (l *StdLogger) Info(format string, args ...any) {
+	l.output(LevelInfo, "", format, args)
+}
+
+// Warn writes a warning
+func (l *StdLogger) Warn(format string, args ...any) {
+	l.output(LevelWarn, "Warning: ", format, args)
+}
+
+// Error writes an error message
+func (l *StdLogger) Error(format string, args ...any) {
+	l.output(LevelError, "", format, args)
+}
+
+// output writes the message if its level is enabled
+func (l *StdLogger) output(level Level, prefix string, format string, args []any) {
+	if level < l.level {
+		return
+	}
+	l.logger.Print(prefix + fmt.Sprintf(format, args...))
+}
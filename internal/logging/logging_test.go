@@ -0,0 +1,53 @@
+package logging_test
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"musicplayer/internal/logging"
+)
+
+func TestStdLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := logging.NewStdLogger(log.New(buf, "", 0), logging.LevelInfo)
+
+	logger.Debug("hidden %d", 1)
+	logger.Info("loaded %d files", 2)
+	logger.Warn("failed to close: %v", "closed")
+	logger.Error("Failed to play: %v", "no device")
+	assert.Equal(t, "loaded 2 files\nWarning: failed to close: closed\nFailed to play: no device\n", buf.String())
+
+	buf.Reset()
+	logger.SetLevel(logging.LevelDebug)
+	logger.Debug("shown")
+	assert.Equal(t, "Debug: shown\n", buf.String())
+
+	buf.Reset()
+	logger.SetLevel(logging.LevelOff)
+	logger.Error("dropped")
+	assert.Empty(t, buf.String())
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		level logging.Level
+	}{
+		{"debug", logging.LevelDebug},
+		{"Info", logging.LevelInfo},
+		{"WARN", logging.LevelWarn},
+		{"error", logging.LevelError},
+		{"off", logging.LevelOff},
+	} {
+		level, err := logging.ParseLevel(tt.name)
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.level, level, tt.name)
+	}
+
+	_, err := logging.ParseLevel("verbose")
+	assert.Error(t, err)
+}
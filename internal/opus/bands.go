@@ -0,0 +1,778 @@
+package opus
+
+// CELT band shape decoding (RFC 6716 section 4.3.4): the bands are split recursively in halves
+// or into mid and side, until they are small enough to be coded as a single PVQ vector.
+
+const epsilon = float32(1e-15)
+
+func lcgRand(seed uint32) uint32 {
+	return 1664525*seed + 1013904223
+}
+
+// fracMul16 multiplies two Q15 values with rounding
+func fracMul16(a, b int) int {
+	return (16384 + int(int32(int16(a))*int32(int16(b)))) >> 15
+}
+
+// bitexactCos is a cos() approximation giving the same result on any platform, as it affects the bit allocation
+func bitexactCos(x int) int {
+	x2 := int(int16((4096 + int32(int16(x))*int32(int16(x))) >> 13))
+	x2 = int(int16((32767 - x2) + fracMul16(x2, -7651+fracMul16(x2, 8277+fracMul16(-626, x2)))))
+	return 1 + x2
+}
+
+func bitexactLog2tan(isin, icos int) int {
+	lc := ilog(uint32(icos))
+	ls := ilog(uint32(isin))
+	icos <<= 15 - lc
+	isin <<= 15 - ls
+	return (ls-lc)*(1<<11) +
+		fracMul16(isin, fracMul16(isin, -2597)+7932) -
+		fracMul16(icos, fracMul16(icos, -2597)+7932)
+}
+
+// isqrt32 returns the integer square root of val, rounded down
+func isqrt32(val uint32) uint32 {
+	var g uint32
+	bshift := (ilog(val) - 1) >> 1
+	b := uint32(1) << bshift
+	for ; bshift >= 0; bshift-- {
+		t := (g<<1 + b) << bshift
+		if t <= val {
+			g += b
+			val -= t
+		}
+		b >>= 1
+	}
+	return g
+}
+
+// denormaliseBands scales the unit-norm bands of x by their energy into freq
+func denormaliseBands(x, freq []float32, bandLogE []float32, start, end, m int, silence bool) {
+	n := m * celtShortMdctSize
+	bound := m * eBands[end]
+	if silence {
+		bound = 0
+		start, end = 0, 0
+	}
+	clear(freq[:m*eBands[start]])
+	for i := start; i < end; i++ {
+		g := celtExp2(bandLogE[i] + eMeans[i])
+		for j := m * eBands[i]; j < m*eBands[i+1]; j++ {
+			freq[j] = x[j] * g
+		}
+	}
+	clear(freq[bound:n])
+}
+
+// antiCollapse fills the short MDCTs which got no pulses with noise, so transients don't collapse
+func antiCollapse(x []float32, collapseMasks []uint8, lm, c, size, start, end int, logE, prev1LogE, prev2LogE []float32, pulses []int, seed uint32) {
+	for i := start; i < end; i++ {
+		n0 := eBands[i+1] - eBands[i]
+		// Depth in 1/8 bits
+		depth := udiv(1+pulses[i], n0) >> lm
+		thresh := .5 * celtExp2(-.125*float32(depth))
+		sqrt1 := 1 / celtSqrt(float32(n0<<lm))
+
+		for ch := 0; ch < c; ch++ {
+			prev1 := prev1LogE[ch*celtNbEBands+i]
+			prev2 := prev2LogE[ch*celtNbEBands+i]
+			if c == 1 {
+				prev1 = max(prev1, prev1LogE[celtNbEBands+i])
+				prev2 = max(prev2, prev2LogE[celtNbEBands+i])
+			}
+			ediff := max(0, logE[ch*celtNbEBands+i]-min(prev1, prev2))
+
+			// r is multiplied by 2 or 2*sqrt(2) depending on LM, because short blocks
+			// don't have the same energy as long ones
+			r := 2 * celtExp2(-ediff)
+			if lm == 3 {
+				r *= 1.41421356
+			}
+			r = min(thresh, r)
+			r *= sqrt1
+
+			band := x[ch*size+eBands[i]<<lm : ch*size+eBands[i+1]<<lm]
+			renormalize := false
+			for k := 0; k < 1<<lm; k++ {
+				// Fill the collapsed blocks with noise
+				if collapseMasks[i*c+ch]&(1<<k) == 0 {
+					for j := 0; j < n0; j++ {
+						seed = lcgRand(seed)
+						if seed&0x8000 != 0 {
+							band[j<<lm+k] = r
+						} else {
+							band[j<<lm+k] = -r
+						}
+					}
+					renormalize = true
+				}
+			}
+			// Energy was added, so the band is normalised again
+			if renormalize {
+				renormaliseVector(band, 1)
+			}
+		}
+	}
+}
+
+// stereoMerge turns the decoded mid and side into left and right
+func stereoMerge(x, y []float32, mid float32) {
+	var xp, side float32
+	for j := range y {
+		xp += y[j] * x[j]
+		side += y[j] * y[j]
+	}
+	// Compensating for the mid normalization
+	xp = mid * xp
+	mid2 := mid
+	el := mid2*mid2 + side - 2*xp
+	er := mid2*mid2 + side + 2*xp
+	if er < 6e-4 || el < 6e-4 {
+		copy(y, x)
+		return
+	}
+
+	lgain := 1 / celtSqrt(el)
+	rgain := 1 / celtSqrt(er)
+	for j := range x {
+		// Apply mid scaling (side is already scaled)
+		l := mid * x[j]
+		r := y[j]
+		x[j] = lgain * (l - r)
+		y[j] = rgain * (l + r)
+	}
+}
+
+// orderyTable converts from the natural Hadamard order to an ordery one, for N=2, 4, 8 and 16
+var orderyTable = []int{
+	1, 0,
+	3, 0, 2, 1,
+	7, 0, 4, 3, 6, 1, 5, 2,
+	15, 0, 8, 7, 12, 3, 11, 4, 14, 1, 9, 6, 13, 2, 10, 5,
+}
+
+func deinterleaveHadamard(x []float32, n0, stride int, hadamard bool) {
+	n := n0 * stride
+	tmp := make([]float32, n)
+	if hadamard {
+		ordery := orderyTable[stride-2:]
+		for i := 0; i < stride; i++ {
+			for j := 0; j < n0; j++ {
+				tmp[ordery[i]*n0+j] = x[j*stride+i]
+			}
+		}
+	} else {
+		for i := 0; i < stride; i++ {
+			for j := 0; j < n0; j++ {
+				tmp[i*n0+j] = x[j*stride+i]
+			}
+		}
+	}
+	copy(x, tmp)
+}
+
+func interleaveHadamard(x []float32, n0, stride int, hadamard bool) {
+	n := n0 * stride
+	tmp := make([]float32, n)
+	if hadamard {
+		ordery := orderyTable[stride-2:]
+		for i := 0; i < stride; i++ {
+			for j := 0; j < n0; j++ {
+				tmp[j*stride+i] = x[ordery[i]*n0+j]
+			}
+		}
+	} else {
+		for i := 0; i < stride; i++ {
+			for j := 0; j < n0; j++ {
+				tmp[j*stride+i] = x[i*n0+j]
+			}
+		}
+	}
+	copy(x, tmp)
+}
+
+// haar1 applies a Haar transform to the pairs of samples of each of the stride interleaved vectors
+func haar1(x []float32, n0, stride int) {
+	n0 >>= 1
+	for i := 0; i < stride; i++ {
+		for j := 0; j < n0; j++ {
+			tmp1 := .70710678 * x[stride*2*j+i]
+			tmp2 := .70710678 * x[stride*(2*j+1)+i]
+			x[stride*2*j+i] = tmp1 + tmp2
+			x[stride*(2*j+1)+i] = tmp1 - tmp2
+		}
+	}
+}
+
+// computeQn returns the number of steps the split angle is coded with
+func computeQn(n, b, offset, pulseCap int, stereo bool) int {
+	exp2Table8 := [8]int{16384, 17866, 19483, 21247, 23170, 25267, 27554, 30048}
+	n2 := 2*n - 1
+	if stereo && n == 2 {
+		n2--
+	}
+	// The upper limit ensures that in a stereo split with itheta==16384, there are always
+	// enough bits left over to code at least one pulse in the side
+	qb := (b + n2*offset) / n2
+	qb = min(b-pulseCap-(4<<bitRes), qb)
+	qb = min(8<<bitRes, qb)
+	if qb < (1 << bitRes >> 1) {
+		return 1
+	}
+	qn := exp2Table8[qb&0x7] >> (14 - qb>>bitRes)
+	return (qn + 1) >> 1 << 1
+}
+
+// bandCtx is the state shared by the decoding of the bands of a frame
+type bandCtx struct {
+	dec           *rangeDecoder
+	i             int
+	intensity     int
+	spread        int
+	tfChange      int
+	remainingBits int
+	seed          uint32
+}
+
+// split is the result of computeTheta
+type split struct {
+	inv    bool
+	imid   int
+	iside  int
+	delta  int
+	itheta int
+	qalloc int
+}
+
+// computeTheta decodes the angle between the two halves, or mid and side, of a split
+func (ctx *bandCtx) computeTheta(n int, b *int, bb, b0, lm int, stereo bool, fill *int) split {
+	dec := ctx.dec
+	i := ctx.i
+	itheta := 0
+	inv := false
+
+	// Decide on the resolution to give to the split parameter theta
+	pulseCap := logN[i] + lm*(1<<bitRes)
+	offset := pulseCap>>1 - celtQThetaOffset
+	if stereo && n == 2 {
+		offset = pulseCap>>1 - celtQThetaOffsetTwoPhase
+	}
+	qn := computeQn(n, *b, offset, pulseCap, stereo)
+	if stereo && i >= ctx.intensity {
+		qn = 1
+	}
+	tell := int(dec.tellFrac())
+	if qn != 1 {
+		switch {
+		case stereo && n > 2:
+			// A step pdf: a probability of p0 up to itheta=8192 and 1 after
+			const p0 = 3
+			x0 := qn / 2
+			ft := uint32(p0*(x0+1) + x0)
+			fs := int(dec.decode(ft))
+			var x int
+			if fs < (x0+1)*p0 {
+				x = fs / p0
+			} else {
+				x = x0 + 1 + (fs - (x0+1)*p0)
+			}
+			if x <= x0 {
+				dec.update(uint32(p0*x), uint32(p0*(x+1)), ft)
+			} else {
+				dec.update(uint32((x-1-x0)+(x0+1)*p0), uint32((x-x0)+(x0+1)*p0), ft)
+			}
+			itheta = x
+		case b0 > 1 || stereo:
+			// Uniform pdf
+			itheta = int(dec.uint(uint32(qn + 1)))
+		default:
+			// Triangular pdf
+			var fs, fl int
+			ft := ((qn >> 1) + 1) * ((qn >> 1) + 1)
+			fm := int(dec.decode(uint32(ft)))
+			if fm < ((qn>>1)*((qn>>1)+1))>>1 {
+				itheta = int(isqrt32(8*uint32(fm)+1)-1) >> 1
+				fs = itheta + 1
+				fl = itheta * (itheta + 1) >> 1
+			} else {
+				itheta = (2*(qn+1) - int(isqrt32(8*uint32(ft-fm-1)+1))) >> 1
+				fs = qn + 1 - itheta
+				fl = ft - ((qn + 1 - itheta) * (qn + 2 - itheta) >> 1)
+			}
+			dec.update(uint32(fl), uint32(fl+fs), uint32(ft))
+		}
+		itheta = udiv(itheta*16384, qn)
+	} else if stereo {
+		if *b > 2<<bitRes && ctx.remainingBits > 2<<bitRes {
+			inv = dec.bitLogp(2)
+		}
+		itheta = 0
+	}
+	qalloc := int(dec.tellFrac()) - tell
+	*b -= qalloc
+
+	s := split{inv: inv, itheta: itheta, qalloc: qalloc}
+	switch itheta {
+	case 0:
+		s.imid = 32767
+		s.iside = 0
+		*fill &= (1 << bb) - 1
+		s.delta = -16384
+	case 16384:
+		s.imid = 0
+		s.iside = 32767
+		*fill &= ((1 << bb) - 1) << bb
+		s.delta = 16384
+	default:
+		s.imid = bitexactCos(itheta)
+		s.iside = bitexactCos(16384 - itheta)
+		// The mid vs side allocation that minimizes squared error in the band
+		s.delta = fracMul16((n-1)<<7, bitexactLog2tan(s.iside, s.imid))
+	}
+	return s
+}
+
+// quantBandN1 decodes the sign of a band of one sample
+func (ctx *bandCtx) quantBandN1(x, y []float32, lowbandOut []float32) uint {
+	v := x
+	for ch := 0; ch < 1+boolInt(y != nil); ch++ {
+		sign := uint32(0)
+		if ctx.remainingBits >= 1<<bitRes {
+			sign = ctx.dec.bits(1)
+			ctx.remainingBits -= 1 << bitRes
+		}
+		if sign != 0 {
+			v[0] = -1
+		} else {
+			v[0] = 1
+		}
+		v = y
+	}
+	if lowbandOut != nil {
+		lowbandOut[0] = x[0]
+	}
+	return 1
+}
+
+// quantPartition decodes a mono partition, splitting it in two halves when it has more bits
+// than a single PVQ vector can use. It can be called recursively, so bands can be split in 8 parts.
+func (ctx *bandCtx) quantPartition(x []float32, n, b, bb int, lowband []float32, lm int, gain float32, fill int) uint {
+	b0 := bb
+	i := ctx.i
+	var cm uint
+
+	// Split the band in two if it has more bits than a vector can use
+	if lm != -1 && b > splitThreshold(i, lm) && n > 2 {
+		n >>= 1
+		y := x[n:]
+		lm--
+		if bb == 1 {
+			fill = fill&1 | fill<<1
+		}
+		bb = (bb + 1) >> 1
+
+		s := ctx.computeTheta(n, &b, bb, b0, lm, false, &fill)
+		mid := (1. / 32768) * float32(s.imid)
+		side := (1. / 32768) * float32(s.iside)
+		delta := s.delta
+
+		// Give more bits to low-energy MDCTs than they would otherwise deserve
+		if b0 > 1 && s.itheta&0x3fff != 0 {
+			if s.itheta > 8192 {
+				// Rough approximation for pre-echo masking
+				delta -= delta >> (4 - lm)
+			} else {
+				// Corresponds to a forward-masking slope of 1.5 dB per 10 ms
+				delta = min(0, delta+(n<<bitRes>>(5-lm)))
+			}
+		}
+		mbits := max(0, min(b, (b-delta)/2))
+		sbits := b - mbits
+		ctx.remainingBits -= s.qalloc
+
+		var nextLowband2 []float32
+		if lowband != nil {
+			nextLowband2 = lowband[n:]
+		}
+
+		rebalance := ctx.remainingBits
+		if mbits >= sbits {
+			cm = ctx.quantPartition(x, n, mbits, bb, lowband, lm, gain*mid, fill)
+			rebalance = mbits - (rebalance - ctx.remainingBits)
+			if rebalance > 3<<bitRes && s.itheta != 0 {
+				sbits += rebalance - (3 << bitRes)
+			}
+			cm |= ctx.quantPartition(y, n, sbits, bb, nextLowband2, lm, gain*side, fill>>bb) << (b0 >> 1)
+		} else {
+			cm = ctx.quantPartition(y, n, sbits, bb, nextLowband2, lm, gain*side, fill>>bb) << (b0 >> 1)
+			rebalance = sbits - (rebalance - ctx.remainingBits)
+			if rebalance > 3<<bitRes && s.itheta != 16384 {
+				mbits += rebalance - (3 << bitRes)
+			}
+			cm |= ctx.quantPartition(x, n, mbits, bb, lowband, lm, gain*mid, fill)
+		}
+		return cm
+	}
+
+	// The basic no-split case
+	q := bits2pulses(i, lm, b)
+	currBits := pulses2bits(i, lm, q)
+	ctx.remainingBits -= currBits
+	// Never bust the budget
+	for ctx.remainingBits < 0 && q > 0 {
+		ctx.remainingBits += currBits
+		q--
+		currBits = pulses2bits(i, lm, q)
+		ctx.remainingBits -= currBits
+	}
+
+	if q != 0 {
+		return algUnquant(x[:n], getPulses(q), ctx.spread, bb, ctx.dec, gain)
+	}
+
+	// Without pulses, the band is filled anyway
+	cmMask := uint(1)<<bb - 1
+	fill &= int(cmMask)
+	if fill == 0 {
+		clear(x[:n])
+		return 0
+	}
+	if lowband == nil {
+		// Noise
+		for j := 0; j < n; j++ {
+			ctx.seed = lcgRand(ctx.seed)
+			x[j] = float32(int32(ctx.seed) >> 20)
+		}
+		cm = cmMask
+	} else {
+		// Folded spectrum
+		for j := 0; j < n; j++ {
+			ctx.seed = lcgRand(ctx.seed)
+			// About 48 dB below the "normal" folding level
+			tmp := float32(1.0 / 256)
+			if ctx.seed&0x8000 == 0 {
+				tmp = -tmp
+			}
+			x[j] = lowband[j] + tmp
+		}
+		cm = uint(fill)
+	}
+	renormaliseVector(x[:n], gain)
+	return cm
+}
+
+// splitThreshold returns the bits above which a partition is split: 1.5 bits more than the most
+// a single vector can use
+func splitThreshold(band, lm int) int {
+	cache := pulseCache(band, lm)
+	return int(cache[cache[0]]) + 12
+}
+
+var (
+	bitInterleaveTable   = [16]uint8{0, 1, 1, 1, 2, 3, 3, 3, 2, 3, 3, 3, 2, 3, 3, 3}
+	bitDeinterleaveTable = [16]uint8{
+		0x00, 0x03, 0x0C, 0x0F, 0x30, 0x33, 0x3C, 0x3F,
+		0xC0, 0xC3, 0xCC, 0xCF, 0xF0, 0xF3, 0xFC, 0xFF,
+	}
+)
+
+// quantBand decodes a band of a mono frame, or one of the channels of a dual stereo one
+func (ctx *bandCtx) quantBand(x []float32, n, b, bb int, lowband []float32, lm int, lowbandOut []float32, gain float32, lowbandScratch []float32, fill int) uint {
+	n0 := n
+	nb := n
+	b0 := bb
+	timeDivide := 0
+	recombine := 0
+	longBlocks := b0 == 1
+	tfChange := ctx.tfChange
+
+	nb = udiv(nb, bb)
+
+	// Special case for one sample
+	if n == 1 {
+		return ctx.quantBandN1(x, nil, lowbandOut)
+	}
+
+	if tfChange > 0 {
+		recombine = tfChange
+	}
+	// Band recombining to increase frequency resolution
+	if lowbandScratch != nil && lowband != nil && (recombine != 0 || (nb&1 == 0 && tfChange < 0) || b0 > 1) {
+		copy(lowbandScratch[:n], lowband[:n])
+		lowband = lowbandScratch
+	}
+
+	for k := 0; k < recombine; k++ {
+		if lowband != nil {
+			haar1(lowband, n>>k, 1<<k)
+		}
+		fill = int(bitInterleaveTable[fill&0xF]) | int(bitInterleaveTable[fill>>4])<<2
+	}
+	bb >>= recombine
+	nb <<= recombine
+
+	// Increasing the time resolution
+	for nb&1 == 0 && tfChange < 0 {
+		if lowband != nil {
+			haar1(lowband, nb, bb)
+		}
+		fill |= fill << bb
+		bb <<= 1
+		nb >>= 1
+		timeDivide++
+		tfChange++
+	}
+	b0 = bb
+	nb0 := nb
+
+	// Reorganize the samples in time order instead of frequency order
+	if b0 > 1 && lowband != nil {
+		deinterleaveHadamard(lowband, nb>>recombine, b0<<recombine, longBlocks)
+	}
+
+	cm := ctx.quantPartition(x, n, b, bb, lowband, lm, gain, fill)
+
+	// Undo the sample reorganization going from time order to frequency order
+	if b0 > 1 {
+		interleaveHadamard(x, nb>>recombine, b0<<recombine, longBlocks)
+	}
+
+	// Undo the time-frequency changes done earlier
+	nb = nb0
+	bb = b0
+	for k := 0; k < timeDivide; k++ {
+		bb >>= 1
+		nb <<= 1
+		cm |= cm >> bb
+		haar1(x, nb, bb)
+	}
+	for k := 0; k < recombine; k++ {
+		cm = uint(bitDeinterleaveTable[cm])
+		haar1(x, n0>>k, 1<<k)
+	}
+	bb <<= recombine
+
+	// Scale output for later folding
+	if lowbandOut != nil {
+		g := celtSqrt(float32(n0))
+		for j := 0; j < n0; j++ {
+			lowbandOut[j] = g * x[j]
+		}
+	}
+	return cm & (1<<bb - 1)
+}
+
+// quantBandStereo decodes a band of a stereo frame as mid and side
+func (ctx *bandCtx) quantBandStereo(x, y []float32, n, b, bb int, lowband []float32, lm int, lowbandOut, lowbandScratch []float32, fill int) uint {
+	// Special case for one sample
+	if n == 1 {
+		return ctx.quantBandN1(x, y, lowbandOut)
+	}
+
+	origFill := fill
+	s := ctx.computeTheta(n, &b, bb, bb, lm, true, &fill)
+	mid := (1. / 32768) * float32(s.imid)
+	side := (1. / 32768) * float32(s.iside)
+
+	var cm uint
+	if n == 2 {
+		// The mid and side are orthogonal, so the side is coded with just a sign
+		mbits := b
+		sbits := 0
+		if s.itheta != 0 && s.itheta != 16384 {
+			sbits = 1 << bitRes
+		}
+		mbits -= sbits
+		c := s.itheta > 8192
+		ctx.remainingBits -= s.qalloc + sbits
+
+		x2, y2 := x, y
+		if c {
+			x2, y2 = y, x
+		}
+		sign := 0
+		if sbits != 0 {
+			sign = int(ctx.dec.bits(1))
+		}
+		sign = 1 - 2*sign
+		// orig_fill is used as the side is folded, but the low bits of fill were cleared if itheta==16384
+		cm = ctx.quantBand(x2, n, mbits, bb, lowband, lm, lowbandOut, 1, lowbandScratch, origFill)
+		// N=2 bands aren't split, so cm is either 1 or 0 (for a fold-collapse)
+		y2[0] = -float32(sign) * x2[1]
+		y2[1] = float32(sign) * x2[0]
+		x[0] = mid * x[0]
+		x[1] = mid * x[1]
+		y[0] = side * y[0]
+		y[1] = side * y[1]
+		tmp := x[0]
+		x[0] = tmp - y[0]
+		y[0] = tmp + y[0]
+		tmp = x[1]
+		x[1] = tmp - y[1]
+		y[1] = tmp + y[1]
+	} else {
+		// The normal split
+		mbits := max(0, min(b, (b-s.delta)/2))
+		sbits := b - mbits
+		ctx.remainingBits -= s.qalloc
+
+		// The mid isn't scaled as the normalized mid is needed for folding later.
+		// The high bits of fill are always zero, so the side isn't folded.
+		rebalance := ctx.remainingBits
+		if mbits >= sbits {
+			cm = ctx.quantBand(x, n, mbits, bb, lowband, lm, lowbandOut, 1, lowbandScratch, fill)
+			rebalance = mbits - (rebalance - ctx.remainingBits)
+			if rebalance > 3<<bitRes && s.itheta != 0 {
+				sbits += rebalance - (3 << bitRes)
+			}
+			cm |= ctx.quantBand(y, n, sbits, bb, nil, lm, nil, side, nil, fill>>bb)
+		} else {
+			cm = ctx.quantBand(y, n, sbits, bb, nil, lm, nil, side, nil, fill>>bb)
+			rebalance = sbits - (rebalance - ctx.remainingBits)
+			if rebalance > 3<<bitRes && s.itheta != 16384 {
+				mbits += rebalance - (3 << bitRes)
+			}
+			cm |= ctx.quantBand(x, n, mbits, bb, lowband, lm, lowbandOut, 1, lowbandScratch, fill)
+		}
+	}
+
+	if n != 2 {
+		stereoMerge(x[:n], y[:n], mid)
+	}
+	if s.inv {
+		for j := 0; j < n; j++ {
+			y[j] = -y[j]
+		}
+	}
+	return cm
+}
+
+// quantAllBands decodes the shapes of the bands into x and, for stereo, y
+func quantAllBands(start, end int, x, y []float32, collapseMasks []uint8, pulses []int, shortBlocks bool, spread int,
+	dualStereo bool, intensity int, tfRes []int, totalBits, balance int, dec *rangeDecoder, lm, codedBands int, seed *uint32) {
+	m := 1 << lm
+	bb := 1
+	if shortBlocks {
+		bb = m
+	}
+	c := 1
+	if y != nil {
+		c = 2
+	}
+	normOffset := m * eBands[start]
+	// The last band needs no folding output
+	normLen := m*eBands[celtNbEBands-1] - normOffset
+	normBuf := make([]float32, c*normLen)
+	norm := normBuf[:normLen]
+	norm2 := normBuf[normLen:]
+	// The last band is used as scratch space, as it needs none
+	lowbandScratch := x[m*eBands[celtNbEBands-1]:]
+
+	lowbandOffset := 0
+	updateLowband := true
+	ctx := &bandCtx{dec: dec, intensity: intensity, spread: spread, seed: *seed}
+	for i := start; i < end; i++ {
+		ctx.i = i
+		last := i == end-1
+
+		bx := x[m*eBands[i]:]
+		var by []float32
+		if y != nil {
+			by = y[m*eBands[i]:]
+		}
+		n := m*eBands[i+1] - m*eBands[i]
+		tell := int(dec.tellFrac())
+
+		// Compute how many bits are allocated to this band
+		if i != start {
+			balance -= tell
+		}
+		remainingBits := totalBits - tell - 1
+		ctx.remainingBits = remainingBits
+		b := 0
+		if i <= codedBands-1 {
+			currBalance := balance / min(3, codedBands-i)
+			b = max(0, min(16383, min(remainingBits+1, pulses[i]+currBalance)))
+		}
+
+		if m*eBands[i]-n >= m*eBands[start] && (updateLowband || lowbandOffset == 0) {
+			lowbandOffset = i
+		}
+
+		ctx.tfChange = tfRes[i]
+		if i == end-1 {
+			lowbandScratch = nil
+		}
+
+		// A conservative estimate of the collapse masks of the bands folded from
+		effectiveLowband := -1
+		var xcm, ycm uint
+		if lowbandOffset != 0 && (spread != spreadAggressive || bb > 1 || ctx.tfChange < 0) {
+			// This ensures spectral content is never repeated within one band
+			effectiveLowband = max(0, m*eBands[lowbandOffset]-normOffset-n)
+			foldStart := lowbandOffset
+			for {
+				foldStart--
+				if m*eBands[foldStart] <= effectiveLowband+normOffset {
+					break
+				}
+			}
+			foldEnd := lowbandOffset - 1
+			for {
+				foldEnd++
+				if m*eBands[foldEnd] >= effectiveLowband+normOffset+n {
+					break
+				}
+			}
+			for foldI := foldStart; foldI < foldEnd; foldI++ {
+				xcm |= uint(collapseMasks[foldI*c+0])
+				ycm |= uint(collapseMasks[foldI*c+c-1])
+			}
+		} else {
+			// Otherwise the LCG is used to fold, so all blocks will (almost always) be non-zero
+			xcm = 1<<bb - 1
+			ycm = xcm
+		}
+
+		if dualStereo && i == intensity {
+			// Switch off dual stereo to do intensity
+			dualStereo = false
+			for j := 0; j < m*eBands[i]-normOffset; j++ {
+				norm[j] = .5 * (norm[j] + norm2[j])
+			}
+		}
+
+		var lowband, lowband2, lowbandOut, lowbandOut2 []float32
+		if effectiveLowband != -1 {
+			lowband = norm[effectiveLowband:]
+			if y != nil {
+				lowband2 = norm2[effectiveLowband:]
+			}
+		}
+		if !last {
+			lowbandOut = norm[m*eBands[i]-normOffset:]
+			if y != nil {
+				lowbandOut2 = norm2[m*eBands[i]-normOffset:]
+			}
+		}
+		if dualStereo {
+			xcm = ctx.quantBand(bx, n, b/2, bb, lowband, lm, lowbandOut, 1, lowbandScratch, int(xcm))
+			ycm = ctx.quantBand(by, n, b/2, bb, lowband2, lm, lowbandOut2, 1, lowbandScratch, int(ycm))
+		} else {
+			if by != nil {
+				xcm = ctx.quantBandStereo(bx, by, n, b, bb, lowband, lm, lowbandOut, lowbandScratch, int(xcm|ycm))
+			} else {
+				xcm = ctx.quantBand(bx, n, b, bb, lowband, lm, lowbandOut, 1, lowbandScratch, int(xcm|ycm))
+			}
+			ycm = xcm
+		}
+		collapseMasks[i*c+0] = uint8(xcm)
+		collapseMasks[i*c+c-1] = uint8(ycm)
+		balance += pulses[i] + tell
+
+		// Update the folding position only as long as there is 1 bit/sample depth
+		updateLowband = b > n<<bitRes
+	}
+	*seed = ctx.seed
+}
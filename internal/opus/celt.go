@@ -0,0 +1,646 @@
+package opus
+
+// CELT decoder (RFC 6716 section 4.3)
+
+const (
+	decodeBufferSize = 2048
+
+	combFilterMinPeriod = 15
+
+	// The pitch range searched by the packet loss concealment, 66.67 Hz to 480 Hz
+	plcPitchLagMax = 720
+	plcPitchLagMin = 100
+)
+
+// celtDecoder holds the state of a CELT decoder, kept between frames
+type celtDecoder struct {
+	channels       int // output channels
+	streamChannels int // channels coded in the stream
+	start, end     int // range of the coded bands
+
+	rng                 uint32
+	lastPitchIndex      int
+	lossCount           int
+	postfilterPeriod    int
+	postfilterPeriodOld int
+	postfilterGain      float32
+	postfilterGainOld   float32
+	postfilterTapset    int
+	postfilterTapsetOld int
+
+	preemphMem [2]float32
+	// decodeMem holds the past output of each channel before the de-emphasis,
+	// followed by the overlap of the next frame
+	decodeMem      [2][]float32
+	lpc            [2][lpcOrder]float32
+	oldBandE       [2 * celtNbEBands]float32
+	oldLogE        [2 * celtNbEBands]float32
+	oldLogE2       [2 * celtNbEBands]float32
+	backgroundLogE [2 * celtNbEBands]float32
+}
+
+func newCeltDecoder(channels int) *celtDecoder {
+	d := &celtDecoder{
+		channels:       channels,
+		streamChannels: channels,
+		end:            celtNbEBands,
+	}
+	for c := 0; c < channels; c++ {
+		d.decodeMem[c] = make([]float32, decodeBufferSize+celtOverlap)
+	}
+	d.reset()
+	return d
+}
+
+// reset clears the state kept between frames
+func (d *celtDecoder) reset() {
+	d.rng = 0
+	d.lastPitchIndex = 0
+	d.lossCount = 0
+	d.postfilterPeriod, d.postfilterPeriodOld = 0, 0
+	d.postfilterGain, d.postfilterGainOld = 0, 0
+	d.postfilterTapset, d.postfilterTapsetOld = 0, 0
+	d.preemphMem = [2]float32{}
+	for c := 0; c < d.channels; c++ {
+		clear(d.decodeMem[c])
+	}
+	d.lpc = [2][lpcOrder]float32{}
+	d.oldBandE = [2 * celtNbEBands]float32{}
+	for i := range d.oldLogE {
+		d.oldLogE[i] = -28
+		d.oldLogE2[i] = -28
+	}
+	d.backgroundLogE = [2 * celtNbEBands]float32{}
+}
+
+// outSyn returns the part of the decoder memory the n samples of a frame are synthesized into
+func (d *celtDecoder) outSyn(n int) [][]float32 {
+	out := make([][]float32, d.channels)
+	for c := range out {
+		out[c] = d.decodeMem[c][decodeBufferSize-n:]
+	}
+	return out
+}
+
+// decode decodes a frame of frameSize samples into the interleaved pcm. dec is the range
+// decoder of the packet when it is shared with SILK, otherwise nil. A nil data conceals a lost frame.
+func (d *celtDecoder) decode(data []byte, pcm []float32, frameSize int, dec *rangeDecoder) error {
+	lm := 0
+	for lm <= celtMaxLM && celtShortMdctSize<<lm != frameSize {
+		lm++
+	}
+	if lm > celtMaxLM {
+		return errInvalidFrameSize
+	}
+	m := 1 << lm
+	n := m * celtShortMdctSize
+	cc := d.channels
+	c := d.streamChannels
+	start, end := d.start, d.end
+	outSyn := d.outSyn(n)
+
+	if len(data) <= 1 {
+		d.decodeLost(n, lm)
+		d.deemphasis(outSyn, pcm, n)
+		return nil
+	}
+
+	if dec == nil {
+		dec = &rangeDecoder{}
+		dec.init(data)
+	}
+
+	if c == 1 {
+		for i := 0; i < celtNbEBands; i++ {
+			d.oldBandE[i] = max(d.oldBandE[i], d.oldBandE[celtNbEBands+i])
+		}
+	}
+
+	totalBits := len(data) * 8
+	tell := dec.tell()
+	silence := false
+	if tell >= totalBits {
+		silence = true
+	} else if tell == 1 {
+		silence = dec.bitLogp(15)
+	}
+	if silence {
+		// Pretend all the remaining bits were read
+		tell = len(data) * 8
+		dec.nbitsTotal += tell - dec.tell()
+	}
+
+	postfilterGain := float32(0)
+	postfilterPitch := 0
+	postfilterTapset := 0
+	if start == 0 && tell+16 <= totalBits {
+		if dec.bitLogp(1) {
+			octave := int(dec.uint(6))
+			postfilterPitch = 16<<octave + int(dec.bits(uint(4+octave))) - 1
+			qg := int(dec.bits(3))
+			if dec.tell()+2 <= totalBits {
+				postfilterTapset = dec.icdf(tapsetICDF, 2)
+			}
+			postfilterGain = .09375 * float32(qg+1)
+		}
+		tell = dec.tell()
+	}
+
+	isTransient := false
+	if lm > 0 && tell+3 <= totalBits {
+		isTransient = dec.bitLogp(3)
+		tell = dec.tell()
+	}
+
+	// Decode the global flags (first symbols in the stream)
+	intra := false
+	if tell+3 <= totalBits {
+		intra = dec.bitLogp(3)
+	}
+	// Get the band energies
+	unquantCoarseEnergy(start, end, d.oldBandE[:], intra, dec, c, lm)
+
+	var tfRes [celtNbEBands]int
+	tfDecode(start, end, isTransient, tfRes[:], lm, dec)
+
+	tell = dec.tell()
+	spread := spreadNormal
+	if tell+4 <= totalBits {
+		spread = dec.icdf(spreadICDF, 5)
+	}
+
+	var caps, offsets [celtNbEBands]int
+	initCaps(caps[:], lm, c)
+
+	dynallocLogp := 6
+	totalBits <<= bitRes
+	tell = int(dec.tellFrac())
+	for i := start; i < end; i++ {
+		width := c * (eBands[i+1] - eBands[i]) << lm
+		// quanta is 6 bits, but no more than 1 bit/sample and no less than 1/8 bit/sample
+		quanta := min(width<<bitRes, max(6<<bitRes, width))
+		dynallocLoopLogp := dynallocLogp
+		boost := 0
+		for tell+dynallocLoopLogp<<bitRes < totalBits && boost < caps[i] {
+			flag := dec.bitLogp(uint(dynallocLoopLogp))
+			tell = int(dec.tellFrac())
+			if !flag {
+				break
+			}
+			boost += quanta
+			totalBits -= quanta
+			dynallocLoopLogp = 1
+		}
+		offsets[i] = boost
+		// Making dynalloc more likely
+		if boost > 0 {
+			dynallocLogp = max(2, dynallocLogp-1)
+		}
+	}
+
+	allocTrim := 5
+	if tell+6<<bitRes <= totalBits {
+		allocTrim = dec.icdf(trimICDF, 7)
+	}
+
+	bits := len(data)*8<<bitRes - int(dec.tellFrac()) - 1
+	antiCollapseRsv := 0
+	if isTransient && lm >= 2 && bits >= (lm+2)<<bitRes {
+		antiCollapseRsv = 1 << bitRes
+	}
+	bits -= antiCollapseRsv
+
+	alloc := computeAllocation(start, end, offsets[:], caps[:], allocTrim, bits, c, lm, dec)
+
+	unquantFineEnergy(start, end, d.oldBandE[:], alloc.fineQuant[:], dec, c)
+
+	for ch := 0; ch < cc; ch++ {
+		copy(d.decodeMem[ch], d.decodeMem[ch][n:decodeBufferSize+celtOverlap/2])
+	}
+
+	// Decode the fixed codebook
+	collapseMasks := make([]uint8, c*celtNbEBands)
+	x := make([]float32, c*n)
+	var y []float32
+	if c == 2 {
+		y = x[n:]
+	}
+	quantAllBands(start, end, x[:n], y, collapseMasks, alloc.pulses[:], isTransient, spread,
+		alloc.dualStereo, alloc.intensity, tfRes[:], len(data)*8<<bitRes-antiCollapseRsv, alloc.balance,
+		dec, lm, alloc.codedBands, &d.rng)
+
+	antiCollapseOn := false
+	if antiCollapseRsv > 0 {
+		antiCollapseOn = dec.bits(1) != 0
+	}
+
+	unquantEnergyFinalise(start, end, d.oldBandE[:], alloc.fineQuant[:], alloc.finePriority[:],
+		len(data)*8-dec.tell(), dec, c)
+
+	if antiCollapseOn {
+		antiCollapse(x, collapseMasks, lm, c, n, start, end, d.oldBandE[:], d.oldLogE[:], d.oldLogE2[:],
+			alloc.pulses[:], d.rng)
+	}
+
+	if silence {
+		for i := 0; i < c*celtNbEBands; i++ {
+			d.oldBandE[i] = -28
+		}
+	}
+
+	d.synthesis(x, outSyn, start, end, c, isTransient, lm, silence)
+
+	for ch := 0; ch < cc; ch++ {
+		d.postfilterPeriod = max(d.postfilterPeriod, combFilterMinPeriod)
+		d.postfilterPeriodOld = max(d.postfilterPeriodOld, combFilterMinPeriod)
+		buf := d.decodeMem[ch]
+		off := decodeBufferSize - n
+		combFilter(buf[off:], buf, off, d.postfilterPeriodOld, d.postfilterPeriod, celtShortMdctSize,
+			d.postfilterGainOld, d.postfilterGain, d.postfilterTapsetOld, d.postfilterTapset, celtWindow[:])
+		if lm != 0 {
+			off += celtShortMdctSize
+			combFilter(buf[off:], buf, off, d.postfilterPeriod, postfilterPitch, n-celtShortMdctSize,
+				d.postfilterGain, postfilterGain, d.postfilterTapset, postfilterTapset, celtWindow[:])
+		}
+	}
+	d.postfilterPeriodOld = d.postfilterPeriod
+	d.postfilterGainOld = d.postfilterGain
+	d.postfilterTapsetOld = d.postfilterTapset
+	d.postfilterPeriod = postfilterPitch
+	d.postfilterGain = postfilterGain
+	d.postfilterTapset = postfilterTapset
+	if lm != 0 {
+		d.postfilterPeriodOld = d.postfilterPeriod
+		d.postfilterGainOld = d.postfilterGain
+		d.postfilterTapsetOld = d.postfilterTapset
+	}
+
+	if c == 1 {
+		copy(d.oldBandE[celtNbEBands:], d.oldBandE[:celtNbEBands])
+	}
+
+	// In case start or end were to change
+	if !isTransient {
+		d.oldLogE2 = d.oldLogE
+		d.oldLogE = d.oldBandE
+		// The noise floor may only increase by 2.4 dB/second, but by 6 dB
+		// for each update in DTX
+		maxBackgroundIncrease := float32(1)
+		if d.lossCount < 10 {
+			maxBackgroundIncrease = float32(m) * .001
+		}
+		for i := range d.backgroundLogE {
+			d.backgroundLogE[i] = min(d.backgroundLogE[i]+maxBackgroundIncrease, d.oldBandE[i])
+		}
+	} else {
+		for i := range d.oldLogE {
+			d.oldLogE[i] = min(d.oldLogE[i], d.oldBandE[i])
+		}
+	}
+	for ch := 0; ch < 2; ch++ {
+		for i := 0; i < celtNbEBands; i++ {
+			if i >= start && i < end {
+				continue
+			}
+			d.oldBandE[ch*celtNbEBands+i] = 0
+			d.oldLogE[ch*celtNbEBands+i] = -28
+			d.oldLogE2[ch*celtNbEBands+i] = -28
+		}
+	}
+	d.rng = dec.rng
+
+	d.deemphasis(outSyn, pcm, n)
+	d.lossCount = 0
+	if dec.tell() > 8*len(data) {
+		return errInvalidPacket
+	}
+	return nil
+}
+
+// tfDecode decodes the time-frequency resolution change of each band
+func tfDecode(start, end int, isTransient bool, tfRes []int, lm int, dec *rangeDecoder) {
+	budget := int(dec.storage) * 8
+	tell := dec.tell()
+	logp := 4
+	if isTransient {
+		logp = 2
+	}
+	tfSelectRsv := lm > 0 && tell+logp+1 <= budget
+	if tfSelectRsv {
+		budget--
+	}
+	tfChanged, curr := 0, 0
+	for i := start; i < end; i++ {
+		if tell+logp <= budget {
+			curr ^= boolInt(dec.bitLogp(uint(logp)))
+			tell = dec.tell()
+			tfChanged |= curr
+		}
+		tfRes[i] = curr
+		logp = 5
+		if isTransient {
+			logp = 4
+		}
+	}
+	transient := 4 * boolInt(isTransient)
+	tfSelect := 0
+	if tfSelectRsv && tfSelectTable[lm][transient+tfChanged] != tfSelectTable[lm][transient+2+tfChanged] {
+		tfSelect = boolInt(dec.bitLogp(1))
+	}
+	for i := start; i < end; i++ {
+		tfRes[i] = tfSelectTable[lm][transient+2*tfSelect+tfRes[i]]
+	}
+}
+
+// initCaps computes the maximum 1/8 bits each band can use
+func initCaps(caps []int, lm, c int) {
+	for i := range caps {
+		n := (eBands[i+1] - eBands[i]) << lm
+		caps[i] = (int(cacheCaps[celtNbEBands*(2*lm+c-1)+i]) + 64) * c * n >> 2
+	}
+}
+
+// synthesis denormalises the bands of x and computes their inverse MDCT into outSyn.
+// c is the number of coded channels, which are mixed or duplicated to the output ones.
+func (d *celtDecoder) synthesis(x []float32, outSyn [][]float32, start, end, c int, isTransient bool, lm int, silence bool) {
+	m := 1 << lm
+	n := m * celtShortMdctSize
+	b := 1
+	nb := n
+	shift := celtMaxLM - lm
+	if isTransient {
+		b = m
+		nb = celtShortMdctSize
+		shift = celtMaxLM
+	}
+
+	freq := make([]float32, n)
+	imdctBlocks := func(freq, out []float32) {
+		for i := 0; i < b; i++ {
+			imdct(freq[i:], out[nb*i:], celtWindow[:], celtOverlap, shift, b)
+		}
+	}
+	switch {
+	case d.channels == 2 && c == 1:
+		// Copying a mono stream to two channels; the IMDCT destroys its input
+		denormaliseBands(x, freq, d.oldBandE[:], start, end, m, silence)
+		freq2 := make([]float32, n)
+		copy(freq2, freq)
+		imdctBlocks(freq2, outSyn[0])
+		imdctBlocks(freq, outSyn[1])
+	case d.channels == 1 && c == 2:
+		// Downmixing a stereo stream to mono
+		freq2 := make([]float32, n)
+		denormaliseBands(x, freq, d.oldBandE[:], start, end, m, silence)
+		denormaliseBands(x[n:], freq2, d.oldBandE[celtNbEBands:], start, end, m, silence)
+		for i := range freq {
+			freq[i] = .5 * (freq[i] + freq2[i])
+		}
+		imdctBlocks(freq, outSyn[0])
+	default:
+		for ch := 0; ch < c; ch++ {
+			denormaliseBands(x[ch*n:], freq, d.oldBandE[ch*celtNbEBands:], start, end, m, silence)
+			imdctBlocks(freq, outSyn[ch])
+		}
+	}
+}
+
+var combFilterGains = [3][3]float32{
+	{0.3066406250, 0.2170410156, 0.1296386719},
+	{0.4638671875, 0.2680664062, 0},
+	{0.7998046875, 0.1000976562, 0},
+}
+
+// combFilter applies the pitch post-filter to the n samples of x from off into y, crossfading
+// from the period t0, gain g0 and tapset0 to t1, g1 and tapset1 over the window. y may be x[off:],
+// the filter then being recursive.
+func combFilter(y, x []float32, off, t0, t1, n int, g0, g1 float32, tapset0, tapset1 int, window []float32) {
+	if g0 == 0 && g1 == 0 {
+		copy(y[:n], x[off:off+n])
+		return
+	}
+	g00 := g0 * combFilterGains[tapset0][0]
+	g01 := g0 * combFilterGains[tapset0][1]
+	g02 := g0 * combFilterGains[tapset0][2]
+	g10 := g1 * combFilterGains[tapset1][0]
+	g11 := g1 * combFilterGains[tapset1][1]
+	g12 := g1 * combFilterGains[tapset1][2]
+	x1 := x[off-t1+1]
+	x2 := x[off-t1]
+	x3 := x[off-t1-1]
+	x4 := x[off-t1-2]
+	// If the filter didn't change, the overlap isn't needed
+	overlap := len(window)
+	if g0 == g1 && t0 == t1 && tapset0 == tapset1 {
+		overlap = 0
+	}
+	i := 0
+	for ; i < overlap; i++ {
+		j := off + i
+		x0 := x[j-t1+2]
+		f := window[i] * window[i]
+		y[i] = x[j] +
+			(1-f)*g00*x[j-t0] +
+			(1-f)*g01*(x[j-t0+1]+x[j-t0-1]) +
+			(1-f)*g02*(x[j-t0+2]+x[j-t0-2]) +
+			f*g10*x2 +
+			f*g11*(x1+x3) +
+			f*g12*(x0+x4)
+		x4, x3, x2, x1 = x3, x2, x1, x0
+	}
+	if g1 == 0 {
+		copy(y[i:n], x[off+i:off+n])
+		return
+	}
+	// The part with the constant filter
+	x4 = x[off+i-t1-2]
+	x3 = x[off+i-t1-1]
+	x2 = x[off+i-t1]
+	x1 = x[off+i-t1+1]
+	for ; i < n; i++ {
+		j := off + i
+		x0 := x[j-t1+2]
+		y[i] = x[j] + g10*x2 + g11*(x1+x3) + g12*(x0+x4)
+		x4, x3, x2, x1 = x3, x2, x1, x0
+	}
+}
+
+// deemphasis undoes the pre-emphasis of the n samples of the channels of in into the interleaved pcm
+func (d *celtDecoder) deemphasis(in [][]float32, pcm []float32, n int) {
+	cc := d.channels
+	for c := 0; c < cc; c++ {
+		m := d.preemphMem[c]
+		x := in[c]
+		for j := 0; j < n; j++ {
+			tmp := x[j] + m + 1e-30
+			m = celtPreemph * tmp
+			pcm[j*cc+c] = tmp * (1. / 32768)
+		}
+		d.preemphMem[c] = m
+	}
+}
+
+// decodeLost conceals a lost frame of n samples, with noise when several frames in a row were lost
+// or for the upper band of hybrid frames, otherwise by repeating the last pitch period
+func (d *celtDecoder) decodeLost(n, lm int) {
+	cc := d.channels
+	outSyn := d.outSyn(n)
+	start, end := d.start, d.end
+
+	if d.lossCount >= 5 || start != 0 {
+		// Noise-based PLC/CNG
+		decay := float32(.5)
+		if d.lossCount == 0 {
+			decay = 1.5
+		}
+		for c := 0; c < cc; c++ {
+			for i := start; i < end; i++ {
+				e := &d.oldBandE[c*celtNbEBands+i]
+				*e = max(d.backgroundLogE[c*celtNbEBands+i], *e-decay)
+			}
+		}
+		x := make([]float32, cc*n)
+		seed := d.rng
+		for c := 0; c < cc; c++ {
+			for i := start; i < end; i++ {
+				band := x[n*c+eBands[i]<<lm : n*c+eBands[i+1]<<lm]
+				for j := range band {
+					seed = lcgRand(seed)
+					band[j] = float32(int32(seed) >> 20)
+				}
+				renormaliseVector(band, 1)
+			}
+		}
+		d.rng = seed
+
+		for c := 0; c < cc; c++ {
+			copy(d.decodeMem[c], d.decodeMem[c][n:decodeBufferSize+celtOverlap/2])
+		}
+		d.synthesis(x, outSyn, start, end, cc, false, lm, false)
+		d.lossCount++
+		return
+	}
+
+	// Pitch-based PLC
+	fade := float32(1)
+	pitchIndex := d.lastPitchIndex
+	if d.lossCount == 0 {
+		pitchIndex = d.plcPitchSearch()
+		d.lastPitchIndex = pitchIndex
+	} else {
+		fade = .8
+	}
+
+	etmp := make([]float32, celtOverlap)
+	exc := make([]float32, celtMaxPeriod)
+	for c := 0; c < cc; c++ {
+		buf := d.decodeMem[c]
+		copy(exc, buf[decodeBufferSize-celtMaxPeriod:decodeBufferSize])
+		lpc := d.lpc[c][:]
+
+		if d.lossCount == 0 {
+			// Compute the LPC coefficients of the last samples before the first loss,
+			// to work in the excitation-filter domain
+			var ac [lpcOrder + 1]float32
+			autocorr(exc, ac[:], celtWindow[:])
+			// Add a noise floor of -40 dB
+			ac[0] *= 1.0001
+			// Use lag windowing to stabilize the Levinson-Durbin recursion
+			for i := 1; i <= lpcOrder; i++ {
+				ac[i] -= ac[i] * (0.008 * 0.008) * float32(i) * float32(i)
+			}
+			lpcFromAutocorr(lpc, ac[:])
+		}
+
+		// The excitation of 2 pitch periods is needed to look for a decaying signal
+		excLength := min(2*pitchIndex, celtMaxPeriod)
+		var lpcMem [lpcOrder]float32
+		for i := range lpcMem {
+			lpcMem[i] = buf[decodeBufferSize-excLength-1-i]
+		}
+		e := exc[celtMaxPeriod-excLength:]
+		firFilter(e, lpc, e, lpcMem[:])
+
+		// Check if the waveform is decaying, and if so how fast, to avoid adding energy
+		// when concealing a segment with a decaying energy
+		e1, e2 := float32(1), float32(1)
+		decayLength := excLength >> 1
+		for i := 0; i < decayLength; i++ {
+			v := exc[celtMaxPeriod-decayLength+i]
+			e1 += v * v
+			v = exc[celtMaxPeriod-2*decayLength+i]
+			e2 += v * v
+		}
+		e1 = min(e1, e2)
+		decay := celtSqrt(.5 * e1 / e2)
+
+		// Move the decoder memory one frame to the left, ignoring the overlap
+		// past the end of the buffer as it isn't used
+		copy(buf, buf[n:decodeBufferSize])
+
+		// Extrapolate from the end of the excitation with the pitch period,
+		// scaling down each period by an additional factor of decay
+		extrapolationOffset := celtMaxPeriod - pitchIndex
+		// Cover a complete MDCT window, with the overlap on both sides
+		extrapolationLen := n + celtOverlap
+		attenuation := fade * decay
+		var s1 float32
+		for i, j := 0, 0; i < extrapolationLen; i, j = i+1, j+1 {
+			if j >= pitchIndex {
+				j -= pitchIndex
+				attenuation *= decay
+			}
+			buf[decodeBufferSize-n+i] = attenuation * exc[extrapolationOffset+j]
+			// The energy of the previously decoded signal whose excitation is copied
+			tmp := buf[decodeBufferSize-celtMaxPeriod-n+extrapolationOffset+j]
+			s1 += tmp * tmp
+		}
+
+		// Continue from the last decoded samples before the overlap
+		for i := range lpcMem {
+			lpcMem[i] = buf[decodeBufferSize-n-1-i]
+		}
+		// Convert the excitation back into the signal domain
+		syn := buf[decodeBufferSize-n : decodeBufferSize-n+extrapolationLen]
+		iirFilter(syn, lpc, syn, lpcMem[:])
+
+		// Attenuate if the synthesis energy is higher than expected,
+		// which can happen when the signal changes during the window
+		var s2 float32
+		for _, v := range syn {
+			s2 += v * v
+		}
+		// Written this way to catch NaNs from the IIR filter too
+		if !(s1 > .2*s2) {
+			clear(syn)
+		} else if s1 < s2 {
+			ratio := celtSqrt((.5*s1 + 1) / (s2 + 1))
+			for i := 0; i < celtOverlap; i++ {
+				syn[i] *= 1 - celtWindow[i]*(1-ratio)
+			}
+			for i := celtOverlap; i < extrapolationLen; i++ {
+				syn[i] *= ratio
+			}
+		}
+
+		// Apply the pre-filter to the MDCT overlap of the next frame, as the post-filter
+		// is applied again after it
+		combFilter(etmp, buf, decodeBufferSize, d.postfilterPeriod, d.postfilterPeriod, celtOverlap,
+			-d.postfilterGain, -d.postfilterGain, d.postfilterTapset, d.postfilterTapset, nil)
+
+		// Simulate the TDAC on the concealed audio so it blends with the MDCT of the next frame
+		for i := 0; i < celtOverlap/2; i++ {
+			buf[decodeBufferSize+i] = celtWindow[i]*etmp[celtOverlap-1-i] + celtWindow[celtOverlap-i-1]*etmp[i]
+		}
+	}
+	d.lossCount++
+}
+
+// plcPitchSearch returns the pitch period of the past output
+func (d *celtDecoder) plcPitchSearch() int {
+	lpPitchBuf := make([]float32, decodeBufferSize>>1)
+	pitchDownsample(d.decodeMem[:d.channels], lpPitchBuf)
+	pitchIndex := pitchSearch(lpPitchBuf[plcPitchLagMax>>1:], lpPitchBuf,
+		decodeBufferSize-plcPitchLagMax, plcPitchLagMax-plcPitchLagMin)
+	return plcPitchLagMax - pitchIndex
+}
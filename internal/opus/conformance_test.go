@@ -0,0 +1,75 @@
+package opus_test
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"musicplayer/internal/opus"
+)
+
+// TestDecode_Conformance compares the decoded streams with the output of the reference decoder.
+//
+// The RFC 6716 test vectors are too large to keep in the repository, so each stream in
+// testdata/conformance was encoded with libopus 1.1.2 to exercise one mode of the codec,
+// and the .pcm file next to it is what libopus's opus_decode returned for its packets,
+// after the pre-skip, in 16bit little endian at the stream's channel count.
+// The reference decoder was the floating point build, which rounds differently from Go,
+// so samples may differ by one; SILK decodes in fixed point and matches exactly.
+func TestDecode_Conformance(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels int
+		exact    bool
+	}{
+		{"silk-nb-mono", 1, true},           // SILK narrowband, 20ms frames
+		{"silk-wb-stereo-60ms", 2, true},    // SILK wideband stereo, 60ms frames of three SILK frames
+		{"silk-wb-mono-dtx", 1, true},       // SILK wideband with DTX over a silent gap, concealed by PLC
+		{"hybrid-fb-stereo-10ms", 2, false}, // Hybrid fullband stereo, 10ms frames
+		{"hybrid-swb-stereo", 2, false},     // Hybrid superwideband stereo, 20ms frames
+		{"hybrid-multiframe", 2, false},     // Hybrid packets of two or three frames (codes 1, 2 and 3)
+		{"celt-fb-stereo", 2, false},        // CELT fullband stereo, 20ms frames
+		{"celt-mono-2.5ms", 1, false},       // CELT mono, 2.5ms frames
+		{"mode-switching", 2, false},        // SILK, Hybrid and CELT in turn, with redundancy frames
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := os.ReadFile(filepath.Join("testdata", "conformance", tt.name+".pcm"))
+			require.NoError(t, err)
+			f, err := os.Open(filepath.Join("testdata", "conformance", tt.name+".opus"))
+			require.NoError(t, err)
+			defer f.Close()
+
+			s, err := opus.DecodeWithoutResampling(f)
+			require.NoError(t, err)
+			got, err := io.ReadAll(s)
+			require.NoError(t, err)
+
+			frames := len(want) / (2 * tt.channels)
+			require.Len(t, got, frames*4)
+
+			var mismatches, maxDiff int
+			for i := range frames {
+				for c := range 2 {
+					// Mono streams are output in both channels
+					w := int16(binary.LittleEndian.Uint16(want[(i*tt.channels+min(c, tt.channels-1))*2:]))
+					g := int16(binary.LittleEndian.Uint16(got[(i*2+c)*2:]))
+					diff := max(int(g)-int(w), int(w)-int(g))
+					maxDiff = max(maxDiff, diff)
+					if diff > 1 {
+						mismatches++
+					}
+				}
+			}
+			assert.Zero(t, mismatches, "samples differing by more than 1 (the largest difference is %d)", maxDiff)
+			if tt.exact {
+				assert.Zero(t, maxDiff, "SILK should decode exactly")
+			}
+		})
+	}
+}
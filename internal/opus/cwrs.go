@@ -0,0 +1,74 @@
+package opus
+
+// Pulse vector decoding (RFC 6716 section 4.3.4.2). The counts of the combinations, the U(n, k)
+// rows, are computed as they are needed instead of being kept in a table.
+
+// unext computes the next row of a recurrence u[i][j] = u[i-1][j] + u[i][j-1] + u[i-1][j-1],
+// with ui0 as its first value
+func unext(ui []uint32, ui0 uint32) {
+	j := 1
+	for ; j < len(ui); j++ {
+		ui1 := ui[j] + ui[j-1] + ui0
+		ui[j-1] = ui0
+		ui0 = ui1
+	}
+	ui[j-1] = ui0
+}
+
+// uprev computes the previous row of the same recurrence
+func uprev(ui []uint32, ui0 uint32) {
+	j := 1
+	for ; j < len(ui); j++ {
+		ui1 := ui[j] - ui[j-1] - ui0
+		ui[j-1] = ui0
+		ui0 = ui1
+	}
+	ui[j-1] = ui0
+}
+
+// ncwrsURow fills u with U(n, 0..k+1) and returns V(n, k), the number of vectors of n
+// elements with k pulses. n is at least 2 and k at least 1.
+func ncwrsURow(n, k int, u []uint32) uint32 {
+	u[0] = 0
+	u[1] = 1
+	for i := 2; i < k+2; i++ {
+		u[i] = uint32(i<<1 - 1)
+	}
+	for i := 2; i < n; i++ {
+		unext(u[1:k+2], 1)
+	}
+	return u[k] + u[k+1]
+}
+
+// cwrsi writes the i'th vector of n elements with k pulses to y and returns its squared norm.
+// u holds U(n, 0..k+1) and is overwritten.
+func cwrsi(n, k int, i uint32, y []int, u []uint32) float32 {
+	var yy float32
+	for j := 0; j < n; j++ {
+		p := u[k+1]
+		s := 0
+		if i >= p {
+			s = -1
+			i -= p
+		}
+		yj := k
+		p = u[k]
+		for p > i {
+			k--
+			p = u[k]
+		}
+		i -= p
+		yj -= k
+		val := (yj + s) ^ s
+		y[j] = val
+		yy += float32(val * val)
+		uprev(u[:k+2], 0)
+	}
+	return yy
+}
+
+// decodePulses decodes a vector of n elements with k pulses into y and returns its squared norm
+func decodePulses(y []int, n, k int, dec *rangeDecoder) float32 {
+	u := make([]uint32, k+2)
+	return cwrsi(n, k, dec.uint(ncwrsURow(n, k, u)), y, u)
+}
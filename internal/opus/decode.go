@@ -0,0 +1,97 @@
+// Package opus provides an Ogg Opus decoder producing 16bit stereo PCM streams, as Ebitengine's audio package plays them.
+//
+// The decoder is a port of the reference decoder of RFC 6716 (libopus); its license is in COPYING.
+package opus
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math"
+
+	"musicplayer/internal/resample"
+)
+
+const (
+	// Output format: signed 16bit little endian, 2 channels
+	bytesPerSample = 4
+
+	// sampleRate is the rate Opus always decodes at
+	sampleRate = 48000
+)
+
+// Stream is a decoded Opus stream.
+//
+// The format is signed 16bit integer little endian PCM. The channel count is 2.
+type Stream struct {
+	inner      io.ReadSeeker
+	size       int64
+	sampleRate int
+}
+
+// Read is implementation of io.Reader's Read.
+func (s *Stream) Read(p []byte) (int, error) {
+	return s.inner.Read(p)
+}
+
+// Seek is implementation of io.Seeker's Seek.
+func (s *Stream) Seek(offset int64, whence int) (int64, error) {
+	return s.inner.Seek(offset, whence)
+}
+
+// Length returns the size of decoded stream in bytes.
+func (s *Stream) Length() int64 {
+	return s.size
+}
+
+// SampleRate returns the sample rate of the decoded stream.
+func (s *Stream) SampleRate() int {
+	return s.sampleRate
+}
+
+// DecodeWithoutResampling decodes Ogg Opus data to playable stream in signed 16bit integer, little endian, 2 channels (stereo) format.
+//
+// The source must be 1 or 2 channels, with channel mapping family 0. The stream is at 48kHz, the rate Opus decodes at.
+//
+// The whole file is decoded into memory, so the returned Stream is always seekable
+// and src can be closed once DecodeWithoutResampling returns.
+func DecodeWithoutResampling(src io.Reader) (*Stream, error) {
+	pcm, err := decodeOggOpus(bufio.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Stream{
+		inner:      bytes.NewReader(pcm),
+		size:       int64(len(pcm)),
+		sampleRate: sampleRate,
+	}, nil
+}
+
+// DecodeWithSampleRate decodes Ogg Opus data to playable stream in signed 16bit integer, little endian, 2 channels (stereo) format.
+//
+// DecodeWithSampleRate automatically resamples the stream to fit with sampleRate if necessary.
+func DecodeWithSampleRate(sampleRate int, src io.Reader) (*Stream, error) {
+	s, err := DecodeWithoutResampling(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if sampleRate == s.sampleRate {
+		return s, nil
+	}
+
+	r := resample.NewReader(s.inner, s.size, s.sampleRate, sampleRate)
+	return &Stream{
+		inner:      r,
+		size:       r.Length(),
+		sampleRate: sampleRate,
+	}, nil
+}
+
+// float2Int16 converts a sample in ±1 to 16bit, rounding to nearest even
+func float2Int16(x float32) int16 {
+	x *= 32768
+	x = max(-32768, min(32767, x))
+	return int16(math.RoundToEven(float64(x)))
+}
@@ -0,0 +1,144 @@
+package opus_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"musicplayer/internal/opus"
+)
+
+// silentPacket is a CELT fullband 20ms mono packet without frame data, which decodes to silence
+var silentPacket = []byte{0xf8}
+
+// encodeOgg wraps the packets into an Ogg stream with a page per packet.
+// The last page carries granule, and CRCs are left zero since the decoder doesn't verify them.
+func encodeOgg(packets [][]byte, granule int64) []byte {
+	var buf bytes.Buffer
+	for i, p := range packets {
+		var flags byte
+		var g int64
+		switch {
+		case i == 0:
+			flags = 0x02 // Beginning of stream
+		case i == len(packets)-1:
+			flags = 0x04 // End of stream
+			g = granule
+		}
+
+		buf.WriteString("OggS")
+		buf.WriteByte(0)
+		buf.WriteByte(flags)
+		binary.Write(&buf, binary.LittleEndian, g)
+		binary.Write(&buf, binary.LittleEndian, uint32(1))
+		binary.Write(&buf, binary.LittleEndian, uint32(i))
+		binary.Write(&buf, binary.LittleEndian, uint32(0))
+
+		var segments []byte
+		n := len(p)
+		for ; n >= 255; n -= 255 {
+			segments = append(segments, 255)
+		}
+		segments = append(segments, byte(n))
+		buf.WriteByte(byte(len(segments)))
+		buf.Write(segments)
+		buf.Write(p)
+	}
+	return buf.Bytes()
+}
+
+// opusHead builds an identification header with channel mapping family 0
+func opusHead(channels, preSkip int) []byte {
+	head := []byte("OpusHead")
+	head = append(head, 1, byte(channels))
+	head = binary.LittleEndian.AppendUint16(head, uint16(preSkip))
+	head = binary.LittleEndian.AppendUint32(head, 48000)
+	head = binary.LittleEndian.AppendUint16(head, 0)
+	return append(head, 0)
+}
+
+func opusTags() []byte {
+	return append([]byte("OpusTags"), 0, 0, 0, 0, 0, 0, 0, 0)
+}
+
+func TestDecodeWithoutResampling(t *testing.T) {
+	// 20000 samples of 440Hz in the left and 660Hz in the right, at half the full scale
+	f, err := os.Open("testdata/sine.opus")
+	require.NoError(t, err)
+	defer f.Close()
+
+	s, err := opus.DecodeWithoutResampling(f)
+	require.NoError(t, err)
+	assert.Equal(t, 48000, s.SampleRate())
+	assert.Equal(t, int64(20000*4), s.Length())
+
+	pcm, err := io.ReadAll(s)
+	require.NoError(t, err)
+	require.Len(t, pcm, 20000*4)
+
+	var peakLeft, peakRight int16
+	var differ bool
+	for i := 0; i < len(pcm); i += 4 {
+		l := int16(binary.LittleEndian.Uint16(pcm[i:]))
+		r := int16(binary.LittleEndian.Uint16(pcm[i+2:]))
+		peakLeft = max(peakLeft, l)
+		peakRight = max(peakRight, r)
+		differ = differ || l != r
+	}
+	assert.InDelta(t, 16384, peakLeft, 3000)
+	assert.InDelta(t, 16384, peakRight, 3000)
+	assert.True(t, differ)
+}
+
+func TestDecodeWithoutResampling_Mono(t *testing.T) {
+	// The pre-skip drops 312 of the 3 frames, and the granule position trims the end
+	data := encodeOgg([][]byte{opusHead(1, 312), opusTags(), silentPacket, silentPacket, silentPacket}, 312+2000)
+
+	s, err := opus.DecodeWithoutResampling(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2000*4), s.Length())
+
+	pcm, err := io.ReadAll(s)
+	require.NoError(t, err)
+	assert.Equal(t, make([]byte, 2000*4), pcm)
+}
+
+func TestDecodeWithSampleRate(t *testing.T) {
+	packets := [][]byte{opusHead(1, 0), opusTags()}
+	for range 50 {
+		packets = append(packets, silentPacket)
+	}
+	data := encodeOgg(packets, 48000)
+
+	s, err := opus.DecodeWithSampleRate(44100, bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 44100, s.SampleRate())
+	assert.InDelta(t, 44100*4, s.Length(), 8)
+
+	_, err = s.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not Ogg", []byte("RIFF0000WAVE")},
+		{"Vorbis", encodeOgg([][]byte{[]byte("\x01vorbis"), silentPacket}, 0)},
+		{"missing comment header", encodeOgg([][]byte{opusHead(2, 0)}, 0)},
+		{"surround", encodeOgg([][]byte{opusHead(6, 0), opusTags()}, 0)},
+		{"invalid packet", encodeOgg([][]byte{opusHead(1, 0), opusTags(), {0xfb}}, 960)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := opus.DecodeWithoutResampling(bytes.NewReader(tt.data))
+			assert.Error(t, err)
+		})
+	}
+}
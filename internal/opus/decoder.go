@@ -0,0 +1,591 @@
+package opus
+
+import "errors"
+
+// Opus packet decoding (RFC 6716 section 3 and 4.5), always at 48 kHz
+
+var (
+	errInvalidPacket    = errors.New("opus: invalid packet")
+	errInvalidFrameSize = errors.New("opus: invalid frame size")
+)
+
+const (
+	modeNone = iota
+	modeSILKOnly
+	modeHybrid
+	modeCELTOnly
+)
+
+const (
+	bandwidthNarrowband = iota
+	bandwidthMediumband
+	bandwidthWideband
+	bandwidthSuperwideband
+	bandwidthFullband
+)
+
+const (
+	// maxFrameSize is the number of samples of the longest frame, 60 ms
+	maxFrameSize = 2880
+	// maxPacketSize is the number of samples of the longest packet, 120 ms
+	maxPacketSize = 5760
+	// maxFrameBytes is the size of the largest frame in a packet
+	maxFrameBytes = 1275
+
+	frameSize20ms  = 960
+	frameSize10ms  = 480
+	frameSize5ms   = 240
+	frameSize2_5ms = 120
+)
+
+// decoder decodes the packets of one Opus stream
+type decoder struct {
+	channels int
+	celt     *celtDecoder
+	silk     silkDecoder
+
+	// Parameters of the current packet
+	mode           int
+	bandwidth      int
+	frameSize      int
+	streamChannels int
+
+	// Parameters kept for the SILK decoder between packets
+	silkChannels   int
+	silkSampleRate int
+
+	prevMode       int
+	prevRedundancy bool
+	decodeGain     int // in Q8 dB
+	softClipMem    [2]float32
+}
+
+func newDecoder(channels int, decodeGain int) *decoder {
+	d := &decoder{
+		channels:       channels,
+		celt:           newCeltDecoder(channels),
+		streamChannels: channels,
+		frameSize:      48000 / 400,
+		decodeGain:     decodeGain,
+	}
+	d.silk.init()
+	return d
+}
+
+// packetMode returns the coding mode of the packet from its TOC byte
+func packetMode(toc byte) int {
+	switch {
+	case toc&0x80 != 0:
+		return modeCELTOnly
+	case toc&0x60 == 0x60:
+		return modeHybrid
+	default:
+		return modeSILKOnly
+	}
+}
+
+// packetBandwidth returns the audio bandwidth of the packet from its TOC byte
+func packetBandwidth(toc byte) int {
+	switch {
+	case toc&0x80 != 0:
+		bw := bandwidthMediumband + int(toc>>5)&0x3
+		if bw == bandwidthMediumband {
+			bw = bandwidthNarrowband
+		}
+		return bw
+	case toc&0x60 == 0x60:
+		if toc&0x10 != 0 {
+			return bandwidthFullband
+		}
+		return bandwidthSuperwideband
+	default:
+		return bandwidthNarrowband + int(toc>>5)&0x3
+	}
+}
+
+// packetFrameSize returns the number of samples per frame of the packet from its TOC byte
+func packetFrameSize(toc byte) int {
+	switch {
+	case toc&0x80 != 0:
+		return (48000 << (toc >> 3 & 0x3)) / 400
+	case toc&0x60 == 0x60:
+		if toc&0x08 != 0 {
+			return 48000 / 50
+		}
+		return 48000 / 100
+	default:
+		size := int(toc >> 3 & 0x3)
+		if size == 3 {
+			return 48000 * 60 / 1000
+		}
+		return (48000 << size) / 100
+	}
+}
+
+// packetChannels returns the number of channels of the packet from its TOC byte
+func packetChannels(toc byte) int {
+	if toc&0x4 != 0 {
+		return 2
+	}
+	return 1
+}
+
+// parseSize reads a frame length of 1 or 2 bytes, and returns it with the number of bytes read
+func parseSize(data []byte) (size, n int, err error) {
+	switch {
+	case len(data) < 1:
+		return 0, 0, errInvalidPacket
+	case data[0] < 252:
+		return int(data[0]), 1, nil
+	case len(data) < 2:
+		return 0, 0, errInvalidPacket
+	default:
+		return 4*int(data[1]) + int(data[0]), 2, nil
+	}
+}
+
+// parsePacket splits the packet into its frames
+func parsePacket(data []byte) ([][]byte, error) {
+	if len(data) < 1 {
+		return nil, errInvalidPacket
+	}
+	toc := data[0]
+	data = data[1:]
+	var sizes []int
+	lastSize := len(data)
+
+	switch toc & 0x3 {
+	case 0:
+		// One frame
+	case 1:
+		// Two frames of the same size
+		if len(data)&1 != 0 {
+			return nil, errInvalidPacket
+		}
+		lastSize = len(data) / 2
+		sizes = append(sizes, lastSize)
+	case 2:
+		// Two frames of different sizes
+		size, n, err := parseSize(data)
+		if err != nil {
+			return nil, err
+		}
+		data = data[n:]
+		if size > len(data) {
+			return nil, errInvalidPacket
+		}
+		sizes = append(sizes, size)
+		lastSize = len(data) - size
+	default:
+		// Any number of frames, with optional padding
+		if len(data) < 1 {
+			return nil, errInvalidPacket
+		}
+		ch := data[0]
+		data = data[1:]
+		count := int(ch & 0x3F)
+		if count == 0 || count*packetFrameSize(toc) > maxPacketSize {
+			return nil, errInvalidPacket
+		}
+		n := len(data)
+		if ch&0x40 != 0 {
+			for {
+				if n <= 0 {
+					return nil, errInvalidPacket
+				}
+				p := int(data[0])
+				data = data[1:]
+				n--
+				n -= min(p, 254)
+				if p != 255 {
+					break
+				}
+			}
+		}
+		if n < 0 {
+			return nil, errInvalidPacket
+		}
+		// The padding is at the end of the packet
+		data = data[:n]
+		if ch&0x80 != 0 {
+			lastSize = n
+			for i := 0; i < count-1; i++ {
+				size, bytes, err := parseSize(data)
+				if err != nil {
+					return nil, err
+				}
+				data = data[bytes:]
+				if size > len(data) {
+					return nil, errInvalidPacket
+				}
+				sizes = append(sizes, size)
+				lastSize -= bytes + size
+			}
+			if lastSize < 0 {
+				return nil, errInvalidPacket
+			}
+		} else {
+			lastSize = n / count
+			if lastSize*count != n {
+				return nil, errInvalidPacket
+			}
+			for i := 0; i < count-1; i++ {
+				sizes = append(sizes, lastSize)
+			}
+		}
+	}
+	if lastSize > maxFrameBytes {
+		return nil, errInvalidPacket
+	}
+	sizes = append(sizes, lastSize)
+
+	frames := make([][]byte, len(sizes))
+	for i, size := range sizes {
+		frames[i] = data[:size]
+		data = data[size:]
+	}
+	return frames, nil
+}
+
+// decodePacket decodes a packet into the interleaved pcm, and returns the number of samples per channel
+func (d *decoder) decodePacket(data []byte, pcm []float32) (int, error) {
+	frames, err := parsePacket(data)
+	if err != nil {
+		return 0, err
+	}
+	toc := data[0]
+	d.mode = packetMode(toc)
+	d.bandwidth = packetBandwidth(toc)
+	d.frameSize = packetFrameSize(toc)
+	d.streamChannels = packetChannels(toc)
+
+	n := 0
+	for _, frame := range frames {
+		samples, err := d.decodeFrame(frame, pcm[n*d.channels:], len(frames)*d.frameSize-n)
+		if err != nil {
+			return 0, err
+		}
+		n += samples
+	}
+	softClip(pcm[:n*d.channels], d.channels, d.softClipMem[:])
+	return n, nil
+}
+
+// decodeFrame decodes a frame of up to frameSize samples into the interleaved pcm, and returns the
+// number of samples per channel. A frame of at most 1 byte is concealed.
+func (d *decoder) decodeFrame(data []byte, pcm []float32, frameSize int) (int, error) {
+	ch := d.channels
+	if frameSize < frameSize2_5ms {
+		return 0, errInvalidFrameSize
+	}
+	frameSize = min(frameSize, maxFrameSize)
+	if len(data) <= 1 {
+		data = nil
+		// Don't conceal more than the TOC says
+		frameSize = min(frameSize, d.frameSize)
+	}
+
+	var dec rangeDecoder
+	audioSize := frameSize
+	mode := d.prevMode
+	if data != nil {
+		audioSize = d.frameSize
+		mode = d.mode
+		dec.init(data)
+	} else {
+		if mode == modeNone {
+			// Nothing to conceal before the first packet
+			clear(pcm[:audioSize*ch])
+			return audioSize, nil
+		}
+		// Conceal only in sizes of 2.5, 5, 10 or 20 ms
+		if audioSize > frameSize20ms {
+			for audioSize > 0 {
+				n, err := d.decodeFrame(nil, pcm, min(audioSize, frameSize20ms))
+				if err != nil {
+					return 0, err
+				}
+				pcm = pcm[n*ch:]
+				audioSize -= n
+			}
+			return frameSize, nil
+		}
+		if audioSize < frameSize20ms && audioSize > frameSize10ms {
+			audioSize = frameSize10ms
+		} else if mode != modeSILKOnly && audioSize > frameSize5ms && audioSize < frameSize10ms {
+			audioSize = frameSize5ms
+		}
+	}
+
+	transition := data != nil && d.prevMode != modeNone &&
+		(mode == modeCELTOnly && d.prevMode != modeCELTOnly && !d.prevRedundancy ||
+			mode != modeCELTOnly && d.prevMode == modeCELTOnly)
+	var pcmTransition []float32
+	if transition && mode == modeCELTOnly {
+		pcmTransition = make([]float32, frameSize5ms*ch)
+		if _, err := d.decodeFrame(nil, pcmTransition, min(frameSize5ms, audioSize)); err != nil {
+			return 0, err
+		}
+	}
+	if audioSize > frameSize {
+		return 0, errInvalidFrameSize
+	}
+	frameSize = audioSize
+
+	var pcmSILK []int16
+	if mode != modeCELTOnly {
+		pcmSILK = make([]int16, max(frameSize10ms, frameSize)*ch)
+		if d.prevMode == modeCELTOnly {
+			d.silk.init()
+		}
+		// The SILK concealment can't produce frames of less than 10 ms
+		payloadSizeMS := max(10, 1000*audioSize/48000)
+		if data != nil {
+			d.silkChannels = d.streamChannels
+			switch {
+			case mode == modeSILKOnly && d.bandwidth == bandwidthNarrowband:
+				d.silkSampleRate = 8000
+			case mode == modeSILKOnly && d.bandwidth == bandwidthMediumband:
+				d.silkSampleRate = 12000
+			default:
+				d.silkSampleRate = 16000
+			}
+		}
+		for decoded := 0; decoded < frameSize; {
+			decoded += d.silk.decode(&dec, pcmSILK[decoded*ch:], data == nil, decoded == 0,
+				ch, d.silkChannels, payloadSizeMS, d.silkSampleRate)
+		}
+	}
+
+	// Check for a redundant CELT frame of the 0 to 8 kHz band
+	redundancy, celtToSILK := false, false
+	redundancyBytes := 0
+	size := len(data)
+	if mode != modeCELTOnly && data != nil && dec.tell()+17+20*boolInt(mode == modeHybrid) <= 8*size {
+		redundancy = mode != modeHybrid || dec.bitLogp(12)
+		if redundancy {
+			celtToSILK = dec.bitLogp(1)
+			if mode == modeHybrid {
+				redundancyBytes = int(dec.uint(256)) + 2
+			} else {
+				redundancyBytes = size - (dec.tell()+7)>>3
+			}
+			size -= redundancyBytes
+			if size*8 < dec.tell() {
+				size = 0
+				redundancyBytes = 0
+				redundancy = false
+			}
+			// The redundant frame is not range coded
+			dec.storage -= uint32(redundancyBytes)
+		}
+	}
+	startBand := 0
+	if mode != modeCELTOnly {
+		startBand = 17
+	}
+	switch d.bandwidth {
+	case bandwidthNarrowband:
+		d.celt.end = 13
+	case bandwidthMediumband, bandwidthWideband:
+		d.celt.end = 17
+	case bandwidthSuperwideband:
+		d.celt.end = 19
+	default:
+		d.celt.end = 21
+	}
+	d.celt.streamChannels = d.streamChannels
+
+	if redundancy {
+		transition = false
+	}
+	if transition && mode != modeCELTOnly {
+		pcmTransition = make([]float32, frameSize5ms*ch)
+		if _, err := d.decodeFrame(nil, pcmTransition, min(frameSize5ms, audioSize)); err != nil {
+			return 0, err
+		}
+	}
+
+	var redundantAudio []float32
+	if redundancy {
+		redundantAudio = make([]float32, frameSize5ms*ch)
+	}
+	if redundancy && celtToSILK {
+		// 5 ms redundant frame for the transition from CELT to SILK
+		d.celt.start = 0
+		if err := d.celt.decode(data[size:size+redundancyBytes], redundantAudio, frameSize5ms, nil); err != nil {
+			return 0, err
+		}
+	}
+
+	// Must be after the concealment
+	d.celt.start = startBand
+
+	if mode != modeSILKOnly {
+		// Discard any previous CELT state
+		if mode != d.prevMode && d.prevMode != modeNone && !d.prevRedundancy {
+			d.celt.reset()
+		}
+		if err := d.celt.decode(data[:size], pcm, min(frameSize20ms, frameSize), &dec); err != nil {
+			return 0, err
+		}
+	} else {
+		clear(pcm[:frameSize*ch])
+		// Fade out the CELT state from hybrid frames by decoding a silence frame
+		if d.prevMode == modeHybrid && !(redundancy && celtToSILK && d.prevRedundancy) {
+			d.celt.start = 0
+			if err := d.celt.decode([]byte{0xFF, 0xFF}, pcm, frameSize2_5ms, nil); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if mode != modeCELTOnly {
+		for i := 0; i < frameSize*ch; i++ {
+			pcm[i] += (1. / 32768) * float32(pcmSILK[i])
+		}
+	}
+
+	if redundancy && !celtToSILK {
+		// 5 ms redundant frame for the transition from SILK to CELT
+		d.celt.reset()
+		d.celt.start = 0
+		if err := d.celt.decode(data[size:size+redundancyBytes], redundantAudio, frameSize5ms, nil); err != nil {
+			return 0, err
+		}
+		end := pcm[ch*(frameSize-frameSize2_5ms):]
+		smoothFade(end, redundantAudio[ch*frameSize2_5ms:], end, frameSize2_5ms, ch)
+	}
+	if redundancy && celtToSILK {
+		copy(pcm[:ch*frameSize2_5ms], redundantAudio)
+		smoothFade(redundantAudio[ch*frameSize2_5ms:], pcm[ch*frameSize2_5ms:], pcm[ch*frameSize2_5ms:], frameSize2_5ms, ch)
+	}
+	if transition {
+		if audioSize >= frameSize5ms {
+			copy(pcm[:ch*frameSize2_5ms], pcmTransition)
+			smoothFade(pcmTransition[ch*frameSize2_5ms:], pcm[ch*frameSize2_5ms:], pcm[ch*frameSize2_5ms:], frameSize2_5ms, ch)
+		} else {
+			// Not enough time for a clean transition, but fade anyway
+			smoothFade(pcmTransition, pcm, pcm, frameSize2_5ms, ch)
+		}
+	}
+
+	if d.decodeGain != 0 {
+		gain := celtExp2(6.48814081e-4 * float32(d.decodeGain))
+		for i := 0; i < frameSize*ch; i++ {
+			pcm[i] *= gain
+		}
+	}
+
+	d.prevMode = mode
+	d.prevRedundancy = redundancy && !celtToSILK
+	return audioSize, nil
+}
+
+// smoothFade cross-fades from in1 to in2 into out over the overlap, with the squared CELT window
+func smoothFade(in1, in2, out []float32, overlap, channels int) {
+	for c := 0; c < channels; c++ {
+		for i := 0; i < overlap; i++ {
+			w := celtWindow[i] * celtWindow[i]
+			out[i*channels+c] = w*in2[i*channels+c] + (1-w)*in1[i*channels+c]
+		}
+	}
+}
+
+// softClip bends the samples of the interleaved pcm beyond ±1 back into range, without
+// discontinuities. mem holds the curve of each channel at the end of the previous call.
+func softClip(pcm []float32, channels int, mem []float32) {
+	n := len(pcm) / channels
+	if n < 1 {
+		return
+	}
+	// Saturate to ±2, the highest level the curve handles, where its derivative is zero
+	for i := range pcm {
+		pcm[i] = max(-2, min(2, pcm[i]))
+	}
+	x := make([]float32, n)
+	for c := 0; c < channels; c++ {
+		for i := range x {
+			x[i] = pcm[i*channels+c]
+		}
+		mem[c] = softClipChannel(x, mem[c])
+		for i := range x {
+			pcm[i*channels+c] = x[i]
+		}
+	}
+}
+
+// softClipChannel soft clips the samples of one channel, continuing the curve a, and returns
+// the curve at the end
+func softClipChannel(x []float32, a float32) float32 {
+	n := len(x)
+	// Continue the curve of the previous call to avoid a discontinuity
+	for i := 0; i < n; i++ {
+		if x[i]*a >= 0 {
+			break
+		}
+		x[i] += a * x[i] * x[i]
+	}
+
+	curr := 0
+	x0 := x[0]
+	for {
+		i := curr
+		for ; i < n; i++ {
+			if x[i] > 1 || x[i] < -1 {
+				break
+			}
+		}
+		if i == n {
+			return 0
+		}
+		peakPos := i
+		start, end := i, i
+		maxVal := absFloat(x[i])
+		// Look for the zero crossings around the clipped part
+		for start > 0 && x[i]*x[start-1] >= 0 {
+			start--
+		}
+		for end < n && x[i]*x[end] >= 0 {
+			// Look for other peaks until the next zero crossing
+			if absFloat(x[end]) > maxVal {
+				maxVal = absFloat(x[end])
+				peakPos = end
+			}
+			end++
+		}
+		// Detect clipping before the first zero crossing
+		special := start == 0 && x[i]*x[0] >= 0
+
+		// Compute a such that maxVal + a*maxVal^2 = 1
+		a = (maxVal - 1) / (maxVal * maxVal)
+		if x[i] > 0 {
+			a = -a
+		}
+		for i := start; i < end; i++ {
+			x[i] += a * x[i] * x[i]
+		}
+
+		if special && peakPos >= 2 {
+			// Ramp from the first sample to the peak, to avoid a discontinuity at the start
+			offset := x0 - x[0]
+			delta := offset / float32(peakPos)
+			for i := curr; i < peakPos; i++ {
+				offset -= delta
+				x[i] += offset
+				x[i] = max(-1, min(1, x[i]))
+			}
+		}
+		curr = end
+		if curr == n {
+			return a
+		}
+	}
+}
+
+func absFloat(x float32) float32 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
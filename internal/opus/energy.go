@@ -0,0 +1,72 @@
+package opus
+
+// CELT band energy decoding (RFC 6716 section 4.3.2). Energies are log2 of the band amplitude.
+
+// unquantCoarseEnergy decodes the coarse energy of the bands with a Laplace distribution,
+// predicted from the previous band and, unless intra, from the previous frame
+func unquantCoarseEnergy(start, end int, oldEBands []float32, intra bool, dec *rangeDecoder, c, lm int) {
+	probModel := eProbModel[lm][boolInt(intra)][:]
+	var prev [2]float32
+	coef, beta := predCoef[lm], betaCoef[lm]
+	if intra {
+		coef, beta = 0, betaIntra
+	}
+
+	budget := int(dec.storage) * 8
+	// Decode at a fixed coarse resolution
+	for i := start; i < end; i++ {
+		for ch := 0; ch < c; ch++ {
+			var qi int
+			tell := dec.tell()
+			switch {
+			case budget-tell >= 15:
+				pi := 2 * min(i, 20)
+				qi = dec.laplace(uint32(probModel[pi])<<7, int(probModel[pi+1])<<6)
+			case budget-tell >= 2:
+				qi = dec.icdf(smallEnergyICDF, 2)
+				qi = (qi >> 1) ^ -(qi & 1)
+			case budget-tell >= 1:
+				qi = -boolInt(dec.bitLogp(1))
+			default:
+				qi = -1
+			}
+			q := float32(qi)
+
+			e := &oldEBands[i+ch*celtNbEBands]
+			*e = max(-9, *e)
+			*e = coef**e + prev[ch] + q
+			prev[ch] = prev[ch] + q - beta*q
+		}
+	}
+}
+
+// unquantFineEnergy decodes the fine energy bits of the bands
+func unquantFineEnergy(start, end int, oldEBands []float32, fineQuant []int, dec *rangeDecoder, c int) {
+	for i := start; i < end; i++ {
+		if fineQuant[i] <= 0 {
+			continue
+		}
+		for ch := 0; ch < c; ch++ {
+			q2 := dec.bits(uint(fineQuant[i]))
+			offset := (float32(q2)+.5)*float32(int(1)<<(14-fineQuant[i]))*(1./16384) - .5
+			oldEBands[i+ch*celtNbEBands] += offset
+		}
+	}
+}
+
+// unquantEnergyFinalise uses up the bits left after the PVQ to refine the energy further
+func unquantEnergyFinalise(start, end int, oldEBands []float32, fineQuant, finePriority []int, bitsLeft int, dec *rangeDecoder, c int) {
+	for prio := 0; prio < 2; prio++ {
+		for i := start; i < end && bitsLeft >= c; i++ {
+			if fineQuant[i] >= celtMaxFineBits || finePriority[i] != prio {
+				continue
+			}
+			for ch := 0; ch < c; ch++ {
+				q2 := dec.bits(1)
+				offset := (float32(q2) - .5) * float32(int(1)<<(14-fineQuant[i]-1)) * (1. / 16384)
+				oldEBands[i+ch*celtNbEBands] += offset
+				bitsLeft--
+			}
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package opus
+
+import "math"
+
+// Inverse MDCT of the CELT mode, computed with a mixed radix complex FFT of a quarter of its size
+
+// mdctSize is the size of the longest MDCT, 20 ms at 48kHz
+const mdctSize = 1920
+
+type complex32 struct {
+	r, i float32
+}
+
+// fftState is an FFT of one size; the sizes are the base size divided by 1<<shift
+// and share the twiddles of the base size
+type fftState struct {
+	nfft    int
+	shift   int
+	factors []int // radix and remaining length of each stage
+	bitrev  []int
+}
+
+var (
+	fftTwiddles [mdctSize / 4]complex32
+	fftStates   = [4]fftState{
+		{nfft: 480, shift: 0, factors: []int{5, 96, 3, 32, 4, 8, 2, 4, 4, 1}},
+		{nfft: 240, shift: 1, factors: []int{5, 48, 3, 16, 4, 4, 4, 1}},
+		{nfft: 120, shift: 2, factors: []int{5, 24, 3, 8, 2, 4, 4, 1}},
+		{nfft: 60, shift: 3, factors: []int{5, 12, 3, 4, 4, 1}},
+	}
+	// mdctTrig holds the rotation of each MDCT size, longest first
+	mdctTrig []float32
+)
+
+func init() {
+	for i := range fftTwiddles {
+		phase := -2 * math.Pi / float64(len(fftTwiddles)) * float64(i)
+		fftTwiddles[i] = complex32{float32(math.Cos(phase)), float32(math.Sin(phase))}
+	}
+	for i := range fftStates {
+		st := &fftStates[i]
+		st.bitrev = make([]int, st.nfft)
+		computeBitrev(0, st.bitrev, 1, st.factors)
+	}
+	for n := mdctSize; n >= mdctSize>>3; n >>= 1 {
+		for i := 0; i < n/2; i++ {
+			mdctTrig = append(mdctTrig, float32(math.Cos(2*float64(float32(pi))*(float64(i)+.125)/float64(n))))
+		}
+	}
+}
+
+// computeBitrev fills f with the output index of each input of an FFT stage and the ones after it
+func computeBitrev(fout int, f []int, fstride int, factors []int) {
+	p, m := factors[0], factors[1]
+	if m == 1 {
+		for j := 0; j < p; j++ {
+			f[j*fstride] = fout + j
+		}
+		return
+	}
+	for j := 0; j < p; j++ {
+		computeBitrev(fout, f[j*fstride:], fstride*p, factors[2:])
+		fout += m
+	}
+}
+
+// fft transforms fout in place; the input must already be in bit-reversed order
+func (st *fftState) fft(fout []complex32) {
+	var fstride [8]int
+	fstride[0] = 1
+	stages := 0
+	for {
+		p, m := st.factors[2*stages], st.factors[2*stages+1]
+		fstride[stages+1] = fstride[stages] * p
+		stages++
+		if m == 1 {
+			break
+		}
+	}
+	m := st.factors[2*stages-1]
+	for i := stages - 1; i >= 0; i-- {
+		m2 := 1
+		if i != 0 {
+			m2 = st.factors[2*i-1]
+		}
+		switch st.factors[2*i] {
+		case 2:
+			fftBfly2(fout, fstride[i])
+		case 3:
+			fftBfly3(fout, fstride[i]<<st.shift, m, fstride[i], m2)
+		case 4:
+			fftBfly4(fout, fstride[i]<<st.shift, m, fstride[i], m2)
+		case 5:
+			fftBfly5(fout, fstride[i]<<st.shift, m, fstride[i], m2)
+		}
+		m = m2
+	}
+}
+
+func cmul(a, b complex32) complex32 {
+	return complex32{a.r*b.r - a.i*b.i, a.r*b.i + a.i*b.r}
+}
+
+func cadd(a, b complex32) complex32 {
+	return complex32{a.r + b.r, a.i + b.i}
+}
+
+func csub(a, b complex32) complex32 {
+	return complex32{a.r - b.r, a.i - b.i}
+}
+
+// fftBfly2 is a radix 2 stage; it always follows a radix 4 one, so m is 4
+func fftBfly2(fout []complex32, n int) {
+	const tw = float32(0.7071067812)
+	for i := 0; i < n; i++ {
+		f := fout[i*8 : i*8+8]
+		t := f[4]
+		f[4] = csub(f[0], t)
+		f[0] = cadd(f[0], t)
+
+		t = complex32{(f[5].r + f[5].i) * tw, (f[5].i - f[5].r) * tw}
+		f[5] = csub(f[1], t)
+		f[1] = cadd(f[1], t)
+
+		t = complex32{f[6].i, -f[6].r}
+		f[6] = csub(f[2], t)
+		f[2] = cadd(f[2], t)
+
+		t = complex32{(f[7].i - f[7].r) * tw, (-f[7].i - f[7].r) * tw}
+		f[7] = csub(f[3], t)
+		f[3] = cadd(f[3], t)
+	}
+}
+
+func fftBfly3(fout []complex32, fstride, m, n, mm int) {
+	m2 := 2 * m
+	epi3 := fftTwiddles[fstride*m]
+	for i := 0; i < n; i++ {
+		f := fout[i*mm:]
+		tw1, tw2 := 0, 0
+		for k := 0; k < m; k++ {
+			s1 := cmul(f[k+m], fftTwiddles[tw1])
+			s2 := cmul(f[k+m2], fftTwiddles[tw2])
+			s3 := cadd(s1, s2)
+			s0 := csub(s1, s2)
+			tw1 += fstride
+			tw2 += fstride * 2
+
+			f[k+m].r = f[k].r - s3.r*.5
+			f[k+m].i = f[k].i - s3.i*.5
+			s0.r *= epi3.i
+			s0.i *= epi3.i
+			f[k] = cadd(f[k], s3)
+			f[k+m2].r = f[k+m].r + s0.i
+			f[k+m2].i = f[k+m].i - s0.r
+			f[k+m].r -= s0.i
+			f[k+m].i += s0.r
+		}
+	}
+}
+
+func fftBfly4(fout []complex32, fstride, m, n, mm int) {
+	if m == 1 {
+		// All the twiddles are 1
+		for i := 0; i < n; i++ {
+			f := fout[i*4 : i*4+4]
+			s0 := csub(f[0], f[2])
+			f[0] = cadd(f[0], f[2])
+			s1 := cadd(f[1], f[3])
+			f[2] = csub(f[0], s1)
+			f[0] = cadd(f[0], s1)
+			s1 = csub(f[1], f[3])
+			f[1] = complex32{s0.r + s1.i, s0.i - s1.r}
+			f[3] = complex32{s0.r - s1.i, s0.i + s1.r}
+		}
+		return
+	}
+	m2, m3 := 2*m, 3*m
+	for i := 0; i < n; i++ {
+		f := fout[i*mm:]
+		tw1, tw2, tw3 := 0, 0, 0
+		for j := 0; j < m; j++ {
+			s0 := cmul(f[j+m], fftTwiddles[tw1])
+			s1 := cmul(f[j+m2], fftTwiddles[tw2])
+			s2 := cmul(f[j+m3], fftTwiddles[tw3])
+			s5 := csub(f[j], s1)
+			f[j] = cadd(f[j], s1)
+			s3 := cadd(s0, s2)
+			s4 := csub(s0, s2)
+			f[j+m2] = csub(f[j], s3)
+			tw1 += fstride
+			tw2 += fstride * 2
+			tw3 += fstride * 3
+			f[j] = cadd(f[j], s3)
+			f[j+m] = complex32{s5.r + s4.i, s5.i - s4.r}
+			f[j+m3] = complex32{s5.r - s4.i, s5.i + s4.r}
+		}
+	}
+}
+
+func fftBfly5(fout []complex32, fstride, m, n, mm int) {
+	ya := fftTwiddles[fstride*m]
+	yb := fftTwiddles[fstride*2*m]
+	for i := 0; i < n; i++ {
+		f := fout[i*mm:]
+		for u := 0; u < m; u++ {
+			s0 := f[u]
+			s1 := cmul(f[u+m], fftTwiddles[u*fstride])
+			s2 := cmul(f[u+2*m], fftTwiddles[2*u*fstride])
+			s3 := cmul(f[u+3*m], fftTwiddles[3*u*fstride])
+			s4 := cmul(f[u+4*m], fftTwiddles[4*u*fstride])
+
+			s7 := cadd(s1, s4)
+			s10 := csub(s1, s4)
+			s8 := cadd(s2, s3)
+			s9 := csub(s2, s3)
+
+			f[u].r += s7.r + s8.r
+			f[u].i += s7.i + s8.i
+
+			s5 := complex32{s0.r + s7.r*ya.r + s8.r*yb.r, s0.i + s7.i*ya.r + s8.i*yb.r}
+			s6 := complex32{s10.i*ya.i + s9.i*yb.i, -s10.r*ya.i - s9.r*yb.i}
+			f[u+m] = csub(s5, s6)
+			f[u+4*m] = cadd(s5, s6)
+
+			s11 := complex32{s0.r + s7.r*yb.r + s8.r*ya.r, s0.i + s7.i*yb.r + s8.i*ya.r}
+			s12 := complex32{-s10.i*yb.i + s9.i*ya.i, s10.r*yb.i - s9.r*ya.i}
+			f[u+2*m] = cadd(s11, s12)
+			f[u+3*m] = csub(s11, s12)
+		}
+	}
+}
+
+// imdct computes the inverse MDCT of the coefficients in[0], in[stride], ... of the size
+// mdctSize>>shift and adds the windowed overlap to out, which holds overlap/2 samples of the
+// previous frame's tail before the N/2 new ones
+func imdct(in []float32, out []float32, window []float32, overlap, shift, stride int) {
+	n := mdctSize >> shift
+	trigOffset := 0
+	for i, s := 0, mdctSize; i < shift; i++ {
+		trigOffset += s / 2
+		s >>= 1
+	}
+	trig := mdctTrig[trigOffset:]
+	n2 := n >> 1
+	n4 := n >> 2
+	st := &fftStates[shift]
+
+	// Pre-rotate, storing in bit-reversed order; real and imaginary parts are swapped
+	// as an FFT is used instead of an inverse FFT
+	buf := make([]complex32, n4)
+	xp1, xp2 := 0, stride*(n2-1)
+	for i := 0; i < n4; i++ {
+		yr := in[xp2]*trig[i] + in[xp1]*trig[n4+i]
+		yi := in[xp1]*trig[i] - in[xp2]*trig[n4+i]
+		buf[st.bitrev[i]] = complex32{yi, yr}
+		xp1 += 2 * stride
+		xp2 -= 2 * stride
+	}
+
+	st.fft(buf)
+
+	// Post-rotate and de-shuffle from both ends of the buffer at once
+	yp := out[overlap>>1 : overlap>>1+n2]
+	for i := range buf {
+		yp[2*i] = buf[i].r
+		yp[2*i+1] = buf[i].i
+	}
+	yp0, yp1 := 0, n2-2
+	for i := 0; i < (n4+1)>>1; i++ {
+		re, im := yp[yp0+1], yp[yp0]
+		t0, t1 := trig[i], trig[n4+i]
+		yr := re*t0 + im*t1
+		yi := re*t1 - im*t0
+		re, im = yp[yp1+1], yp[yp1]
+		yp[yp0] = yr
+		yp[yp1+1] = yi
+
+		t0, t1 = trig[n4-i-1], trig[n2-i-1]
+		yr = re*t0 + im*t1
+		yi = re*t1 - im*t0
+		yp[yp1] = yr
+		yp[yp0+1] = yi
+		yp0 += 2
+		yp1 -= 2
+	}
+
+	// Mirror on both sides for TDAC
+	xp, yo := overlap-1, 0
+	wp1, wp2 := 0, overlap-1
+	for i := 0; i < overlap/2; i++ {
+		x1, x2 := out[xp], out[yo]
+		out[yo] = window[wp2]*x2 - window[wp1]*x1
+		out[xp] = window[wp1]*x2 + window[wp2]*x1
+		yo++
+		xp--
+		wp1++
+		wp2--
+	}
+}
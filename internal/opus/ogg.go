@@ -0,0 +1,240 @@
+package opus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Ogg encapsulation of Opus (RFC 7845)
+
+const (
+	pageHeaderSize = 27
+
+	pageFlagContinued = 0x01
+	pageFlagBOS       = 0x02
+	pageFlagEOS       = 0x04
+)
+
+// oggPacket is a packet of the logical stream. granule is the granule position of the page the packet
+// ends, if it is the last packet ending on that page, and -1 otherwise.
+type oggPacket struct {
+	data    []byte
+	granule int64
+	eos     bool
+}
+
+// oggReader reads the packets of the first logical stream of an Ogg file
+type oggReader struct {
+	r       io.Reader
+	serial  uint32
+	started bool
+	pending []oggPacket
+	partial []byte
+	done    bool
+}
+
+func newOggReader(r io.Reader) *oggReader {
+	return &oggReader{r: r}
+}
+
+// next returns the next packet, or io.EOF after the last one
+func (o *oggReader) next() (oggPacket, error) {
+	for len(o.pending) == 0 {
+		if o.done {
+			return oggPacket{}, io.EOF
+		}
+		if err := o.readPage(); err != nil {
+			return oggPacket{}, err
+		}
+	}
+	p := o.pending[0]
+	o.pending = o.pending[1:]
+	return p, nil
+}
+
+// readPage reads a page, and queues the packets it completes
+func (o *oggReader) readPage() error {
+	header := make([]byte, pageHeaderSize)
+	if _, err := io.ReadFull(o.r, header); err != nil {
+		if err == io.EOF && o.started {
+			// The stream ended without an end of stream flag
+			o.done = true
+			return nil
+		}
+		return fmt.Errorf("opus: failed to read Ogg page: %v", err)
+	}
+	if string(header[:4]) != "OggS" || header[4] != 0 {
+		return fmt.Errorf("opus: invalid Ogg page")
+	}
+	flags := header[5]
+	granule := int64(binary.LittleEndian.Uint64(header[6:14]))
+	serial := binary.LittleEndian.Uint32(header[14:18])
+
+	segments := make([]byte, header[26])
+	if _, err := io.ReadFull(o.r, segments); err != nil {
+		return fmt.Errorf("opus: failed to read Ogg page: %v", err)
+	}
+	var size int
+	for _, s := range segments {
+		size += int(s)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(o.r, body); err != nil {
+		return fmt.Errorf("opus: failed to read Ogg page: %v", err)
+	}
+
+	if !o.started {
+		if flags&pageFlagBOS == 0 {
+			return fmt.Errorf("opus: invalid Ogg stream")
+		}
+		o.serial = serial
+		o.started = true
+	} else if serial != o.serial {
+		// Skip the pages of other logical streams
+		return nil
+	}
+	if flags&pageFlagContinued == 0 {
+		// Drop a packet left incomplete by a lost page
+		o.partial = nil
+	}
+
+	// A packet ends at the first segment shorter than 255 bytes
+	var packets []oggPacket
+	for _, s := range segments {
+		o.partial = append(o.partial, body[:s]...)
+		body = body[s:]
+		if s < 255 {
+			packets = append(packets, oggPacket{data: o.partial, granule: -1})
+			o.partial = nil
+		}
+	}
+	if len(packets) > 0 {
+		packets[len(packets)-1].granule = granule
+	}
+	if flags&pageFlagEOS != 0 {
+		o.done = true
+		if len(packets) > 0 {
+			packets[len(packets)-1].eos = true
+		}
+	}
+	o.pending = append(o.pending, packets...)
+	return nil
+}
+
+// opusHead is the identification header of an Ogg Opus stream
+type opusHead struct {
+	channels   int
+	preSkip    int
+	outputGain int // in Q8 dB
+}
+
+// parseOpusHead parses the identification header, the first packet of the stream
+func parseOpusHead(packet []byte) (*opusHead, error) {
+	if !bytes.HasPrefix(packet, []byte("OpusHead")) || len(packet) < 19 {
+		return nil, fmt.Errorf("opus: invalid identification header")
+	}
+	// Only the major version, in the upper 4 bits, is incompatible
+	if packet[8]>>4 != 0 {
+		return nil, fmt.Errorf("opus: unsupported version: %d", packet[8])
+	}
+	head := &opusHead{
+		channels:   int(packet[9]),
+		preSkip:    int(binary.LittleEndian.Uint16(packet[10:12])),
+		outputGain: int(int16(binary.LittleEndian.Uint16(packet[16:18]))),
+	}
+	// Channel mapping family 0 is a single mono or stereo stream
+	if family := packet[18]; family != 0 {
+		return nil, fmt.Errorf("opus: unsupported channel mapping family: %d", family)
+	}
+	if head.channels != 1 && head.channels != 2 {
+		return nil, fmt.Errorf("opus: unsupported channel count: %d", head.channels)
+	}
+	return head, nil
+}
+
+// decodeOggOpus decodes all the audio of an Ogg Opus stream and returns it as 16bit stereo PCM at 48kHz.
+func decodeOggOpus(r io.Reader) ([]byte, error) {
+	ogg := newOggReader(r)
+
+	packet, err := ogg.next()
+	if err != nil {
+		return nil, err
+	}
+	head, err := parseOpusHead(packet.data)
+	if err != nil {
+		return nil, err
+	}
+	// The comment header follows, and is not needed
+	if packet, err = ogg.next(); err != nil {
+		return nil, fmt.Errorf("opus: missing comment header: %v", err)
+	}
+	if !bytes.HasPrefix(packet.data, []byte("OpusTags")) {
+		return nil, fmt.Errorf("opus: invalid comment header")
+	}
+
+	dec := newDecoder(head.channels, head.outputGain)
+	pcm := make([]float32, maxPacketSize*head.channels)
+	var out bytes.Buffer
+	var decoded int64
+	// startGranule is the granule position of the first decoded sample
+	startGranule := int64(-1)
+	endGranule := int64(-1)
+	for {
+		packet, err := ogg.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(packet.data) == 0 {
+			continue
+		}
+		n, err := dec.decodePacket(packet.data, pcm)
+		if err != nil {
+			return nil, err
+		}
+		writeSamples(&out, pcm[:n*head.channels], head.channels)
+		decoded += int64(n)
+
+		if packet.granule >= 0 {
+			if startGranule < 0 {
+				startGranule = max(packet.granule-decoded, 0)
+				if packet.eos {
+					// The granule position of a single page stream trims its end
+					startGranule = 0
+				}
+			}
+			endGranule = packet.granule
+		}
+	}
+
+	// Discard the pre-skip at the start and the padding at the end
+	pcmBytes := out.Bytes()
+	end := int64(len(pcmBytes)) / bytesPerSample
+	if endGranule >= 0 {
+		end = min(end, endGranule-startGranule)
+	}
+	start := int64(head.preSkip)
+	if start >= end {
+		return nil, nil
+	}
+	return pcmBytes[start*bytesPerSample : end*bytesPerSample], nil
+}
+
+// writeSamples converts the interleaved float samples to 16bit stereo, duplicating mono
+func writeSamples(out *bytes.Buffer, pcm []float32, channels int) {
+	b := make([]byte, len(pcm)/channels*bytesPerSample)
+	for i := 0; i < len(pcm)/channels; i++ {
+		l := float2Int16(pcm[i*channels])
+		r := l
+		if channels == 2 {
+			r = float2Int16(pcm[i*channels+1])
+		}
+		binary.LittleEndian.PutUint16(b[i*bytesPerSample:], uint16(l))
+		binary.LittleEndian.PutUint16(b[i*bytesPerSample+2:], uint16(r))
+	}
+	out.Write(b)
+}
@@ -0,0 +1,227 @@
+package opus
+
+// Linear prediction and pitch search for the CELT packet loss concealment
+
+const lpcOrder = 24
+
+// lpcFromAutocorr computes the LPC coefficients of the autocorrelation ac with the Levinson-Durbin recursion
+func lpcFromAutocorr(lpc, ac []float32) {
+	p := len(lpc)
+	clear(lpc)
+	if ac[0] == 0 {
+		return
+	}
+	e := ac[0]
+	for i := 0; i < p; i++ {
+		// Sum up this iteration's reflection coefficient
+		var rr float32
+		for j := 0; j < i; j++ {
+			rr += lpc[j] * ac[i-j]
+		}
+		rr += ac[i+1]
+		r := -rr / e
+		// Update the LPC coefficients and the total error
+		lpc[i] = r
+		for j := 0; j < (i+1)>>1; j++ {
+			tmp1, tmp2 := lpc[j], lpc[i-1-j]
+			lpc[j] = tmp1 + r*tmp2
+			lpc[i-1-j] = tmp2 + r*tmp1
+		}
+		e -= r * r * e
+		// Bail out once we get 30 dB gain
+		if e < .001*ac[0] {
+			break
+		}
+	}
+}
+
+// autocorr computes the autocorrelation of x, windowed at both ends, for the lags 0 to len(ac)-1
+func autocorr(x []float32, ac []float32, window []float32) {
+	n := len(x)
+	xx := x
+	if len(window) > 0 {
+		xx = make([]float32, n)
+		copy(xx, x)
+		for i := range window {
+			xx[i] = x[i] * window[i]
+			xx[n-i-1] = x[n-i-1] * window[i]
+		}
+	}
+	for k := range ac {
+		var d float32
+		for i := k; i < n; i++ {
+			d += xx[i] * xx[i-k]
+		}
+		ac[k] = d
+	}
+}
+
+// firFilter filters x into y with the LPC analysis filter num; mem holds the last inputs, latest first
+func firFilter(x, num, y, mem []float32) {
+	ord := len(num)
+	buf := make([]float32, len(x)+ord)
+	for i := 0; i < ord; i++ {
+		buf[i] = mem[ord-i-1]
+	}
+	copy(buf[ord:], x)
+	for i := 0; i < ord; i++ {
+		mem[i] = x[len(x)-i-1]
+	}
+	for i := range x {
+		sum := buf[i+ord]
+		for j := 0; j < ord; j++ {
+			sum += num[ord-j-1] * buf[i+j]
+		}
+		y[i] = sum
+	}
+}
+
+// iirFilter filters x into y with the LPC synthesis filter den; mem holds the last outputs, latest first
+func iirFilter(x, den, y, mem []float32) {
+	for i := range x {
+		sum := x[i]
+		for j := range den {
+			sum -= den[j] * mem[j]
+		}
+		copy(mem[1:], mem[:len(mem)-1])
+		mem[0] = sum
+		y[i] = sum
+	}
+}
+
+// pitchDownsample low-passes and decimates the channels of x by 2 into xLP, whitening the result
+func pitchDownsample(x [][]float32, xLP []float32) {
+	n := len(xLP)
+	for ch := range x {
+		xc := x[ch]
+		v := .5 * (.5*xc[1] + xc[0])
+		if ch == 0 {
+			xLP[0] = v
+		} else {
+			xLP[0] += v
+		}
+		for i := 1; i < n; i++ {
+			v := .5 * (.5*(xc[2*i-1]+xc[2*i+1]) + xc[2*i])
+			if ch == 0 {
+				xLP[i] = v
+			} else {
+				xLP[i] += v
+			}
+		}
+	}
+
+	var ac [5]float32
+	autocorr(xLP, ac[:], nil)
+	// Noise floor -40 dB
+	ac[0] *= 1.0001
+	// Lag windowing
+	for i := 1; i <= 4; i++ {
+		ac[i] -= ac[i] * (.008 * float32(i)) * (.008 * float32(i))
+	}
+	var lpc [4]float32
+	lpcFromAutocorr(lpc[:], ac[:])
+	tmp := float32(1)
+	for i := range lpc {
+		tmp *= .9
+		lpc[i] *= tmp
+	}
+	// Add a zero
+	const c1 = float32(.8)
+	lpc2 := [5]float32{lpc[0] + .8, lpc[1] + c1*lpc[0], lpc[2] + c1*lpc[1], lpc[3] + c1*lpc[2], c1 * lpc[3]}
+	var mem [5]float32
+	for i := range xLP {
+		sum := xLP[i]
+		for j := range lpc2 {
+			sum += lpc2[j] * mem[j]
+		}
+		copy(mem[1:], mem[:4])
+		mem[0] = xLP[i]
+		xLP[i] = sum
+	}
+}
+
+// pitchXcorr computes the cross-correlation of x with y at each of the lags of xcorr
+func pitchXcorr(x, y, xcorr []float32) {
+	for i := range xcorr {
+		xcorr[i] = innerProd(x, y[i:i+len(x)])
+	}
+}
+
+// findBestPitch returns the two lags with the highest normalized correlation
+func findBestPitch(xcorr, y []float32, n int) [2]int {
+	syy := float32(1)
+	bestNum := [2]float32{-1, -1}
+	var bestDen [2]float32
+	bestPitch := [2]int{0, 1}
+	for j := 0; j < n; j++ {
+		syy += y[j] * y[j]
+	}
+	for i := range xcorr {
+		if xcorr[i] > 0 {
+			// Avoids both underflows and overflows when squaring
+			xcorr16 := xcorr[i] * 1e-12
+			num := xcorr16 * xcorr16
+			if num*bestDen[1] > bestNum[1]*syy {
+				if num*bestDen[0] > bestNum[0]*syy {
+					bestNum[1], bestDen[1], bestPitch[1] = bestNum[0], bestDen[0], bestPitch[0]
+					bestNum[0], bestDen[0], bestPitch[0] = num, syy, i
+				} else {
+					bestNum[1], bestDen[1], bestPitch[1] = num, syy, i
+				}
+			}
+		}
+		syy += y[i+n]*y[i+n] - y[i]*y[i]
+		syy = max(1, syy)
+	}
+	return bestPitch
+}
+
+// pitchSearch returns the lag, up to maxPitch, at which y best matches the n samples of xLP
+func pitchSearch(xLP, y []float32, n, maxPitch int) int {
+	lag := n + maxPitch
+	// Downsample by 2 again
+	xLP4 := make([]float32, n>>2)
+	yLP4 := make([]float32, lag>>2)
+	for j := range xLP4 {
+		xLP4[j] = xLP[2*j]
+	}
+	for j := range yLP4 {
+		yLP4[j] = y[2*j]
+	}
+
+	// Coarse search with 4x decimation
+	xcorr := make([]float32, maxPitch>>1)
+	pitchXcorr(xLP4, yLP4, xcorr[:maxPitch>>2])
+	bestPitch := findBestPitch(xcorr[:maxPitch>>2], yLP4, n>>2)
+
+	// Finer search with 2x decimation
+	for i := range xcorr {
+		xcorr[i] = 0
+		if abs(i-2*bestPitch[0]) > 2 && abs(i-2*bestPitch[1]) > 2 {
+			continue
+		}
+		xcorr[i] = max(-1, innerProd(xLP[:n>>1], y[i:i+n>>1]))
+	}
+	bestPitch = findBestPitch(xcorr, y, n>>1)
+
+	// Refine by pseudo-interpolation
+	offset := 0
+	if bestPitch[0] > 0 && bestPitch[0] < (maxPitch>>1)-1 {
+		a := xcorr[bestPitch[0]-1]
+		b := xcorr[bestPitch[0]]
+		c := xcorr[bestPitch[0]+1]
+		if c-a > .7*(b-a) {
+			offset = 1
+		} else if a-c > .7*(b-c) {
+			offset = -1
+		}
+	}
+	return 2*bestPitch[0] - offset
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
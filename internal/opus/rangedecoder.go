@@ -0,0 +1,239 @@
+package opus
+
+import "math/bits"
+
+// Range decoder constants (RFC 6716 section 4.1)
+const (
+	ecSymBits   = 8
+	ecCodeBits  = 32
+	ecSymMax    = 1<<ecSymBits - 1
+	ecCodeTop   = 1 << (ecCodeBits - 1)
+	ecCodeBot   = ecCodeTop >> ecSymBits
+	ecCodeExtra = (ecCodeBits-2)%ecSymBits + 1
+	ecUintBits  = 8
+	ecWindow    = 32
+
+	// bitRes is the resolution of fractional bit counts: 1/8 bit
+	bitRes = 3
+)
+
+// rangeDecoder is the entropy decoder shared by SILK and CELT. Range coded symbols are read
+// from the start of the frame, raw bits from its end.
+type rangeDecoder struct {
+	buf        []byte
+	storage    uint32
+	endOffs    uint32
+	endWindow  uint32
+	nendBits   int
+	nbitsTotal int
+	offs       uint32
+	rng        uint32
+	val        uint32
+	ext        uint32
+	rem        int
+	err        bool
+}
+
+// ilog returns the number of bits needed to hold v, 0 for 0
+func ilog(v uint32) int {
+	return bits.Len32(v)
+}
+
+// init starts decoding buf
+func (d *rangeDecoder) init(buf []byte) {
+	*d = rangeDecoder{
+		buf:        buf,
+		storage:    uint32(len(buf)),
+		nbitsTotal: ecCodeBits + 1 - ((ecCodeBits-ecCodeExtra)/ecSymBits)*ecSymBits,
+		rng:        1 << ecCodeExtra,
+	}
+	d.rem = d.readByte()
+	d.val = d.rng - 1 - uint32(d.rem>>(ecSymBits-ecCodeExtra))
+	d.normalize()
+}
+
+func (d *rangeDecoder) readByte() int {
+	if d.offs < d.storage {
+		b := d.buf[d.offs]
+		d.offs++
+		return int(b)
+	}
+	return 0
+}
+
+func (d *rangeDecoder) readByteFromEnd() int {
+	if d.endOffs < d.storage {
+		d.endOffs++
+		return int(d.buf[d.storage-d.endOffs])
+	}
+	return 0
+}
+
+// normalize reads input until the range spans more than a symbol
+func (d *rangeDecoder) normalize() {
+	for d.rng <= ecCodeBot {
+		d.nbitsTotal += ecSymBits
+		d.rng <<= ecSymBits
+		sym := d.rem
+		d.rem = d.readByte()
+		sym = (sym<<ecSymBits | d.rem) >> (ecSymBits - ecCodeExtra)
+		d.val = ((d.val << ecSymBits) + (ecSymMax &^ uint32(sym))) & (ecCodeTop - 1)
+	}
+}
+
+// decode returns the cumulative frequency of the next symbol out of ft; update must follow
+func (d *rangeDecoder) decode(ft uint32) uint32 {
+	d.ext = d.rng / ft
+	s := d.val / d.ext
+	return ft - min(s+1, ft)
+}
+
+// decodeBin is decode with ft being 1<<bits
+func (d *rangeDecoder) decodeBin(bits uint) uint32 {
+	d.ext = d.rng >> bits
+	s := d.val / d.ext
+	return 1<<bits - min(s+1, 1<<bits)
+}
+
+// update consumes the symbol with the cumulative frequencies fl to fh out of ft
+func (d *rangeDecoder) update(fl, fh, ft uint32) {
+	s := d.ext * (ft - fh)
+	d.val -= s
+	if fl > 0 {
+		d.rng = d.ext * (fh - fl)
+	} else {
+		d.rng -= s
+	}
+	d.normalize()
+}
+
+// bitLogp decodes a bit whose probability of being 1 is 1/(1<<logp)
+func (d *rangeDecoder) bitLogp(logp uint) bool {
+	r := d.rng
+	v := d.val
+	s := r >> logp
+	ret := v < s
+	if ret {
+		d.rng = s
+	} else {
+		d.val = v - s
+		d.rng = r - s
+	}
+	d.normalize()
+	return ret
+}
+
+// icdf decodes a symbol with an inverse cumulative distribution table of 1<<ftb
+func (d *rangeDecoder) icdf(icdf []uint8, ftb uint) int {
+	s := d.rng
+	v := d.val
+	r := s >> ftb
+	ret := -1
+	var t uint32
+	for {
+		t = s
+		ret++
+		s = r * uint32(icdf[ret])
+		if v >= s {
+			break
+		}
+	}
+	d.val = v - s
+	d.rng = t - s
+	d.normalize()
+	return ret
+}
+
+// uint decodes an integer from 0 to ft-1
+func (d *rangeDecoder) uint(ft uint32) uint32 {
+	ft--
+	ftb := ilog(ft)
+	if ftb > ecUintBits {
+		ftb -= ecUintBits
+		f := ft>>uint(ftb) + 1
+		s := d.decode(f)
+		d.update(s, s+1, f)
+		t := s<<uint(ftb) | d.bits(uint(ftb))
+		if t <= ft {
+			return t
+		}
+		d.err = true
+		return ft
+	}
+	ft++
+	s := d.decode(ft)
+	d.update(s, s+1, ft)
+	return s
+}
+
+// bits reads raw bits from the end of the frame
+func (d *rangeDecoder) bits(n uint) uint32 {
+	window := d.endWindow
+	available := d.nendBits
+	if available < int(n) {
+		for {
+			window |= uint32(d.readByteFromEnd()) << uint(available)
+			available += ecSymBits
+			if available > ecWindow-ecSymBits {
+				break
+			}
+		}
+	}
+	ret := window & (1<<n - 1)
+	window >>= n
+	available -= int(n)
+	d.endWindow = window
+	d.nendBits = available
+	d.nbitsTotal += int(n)
+	return ret
+}
+
+// tell returns the number of bits used so far, rounded up
+func (d *rangeDecoder) tell() int {
+	return d.nbitsTotal - ilog(d.rng)
+}
+
+// tellFrac returns the number of bits used so far in 1/8 bits, rounded up
+func (d *rangeDecoder) tellFrac() uint32 {
+	correction := [8]uint32{35733, 38967, 42495, 46340, 50535, 55109, 60097, 65535}
+	nbits := uint32(d.nbitsTotal) << bitRes
+	l := ilog(d.rng)
+	r := d.rng >> uint(l-16)
+	b := (r >> 12) - 8
+	if r > correction[b] {
+		b++
+	}
+	return nbits - (uint32(l)<<3 + b)
+}
+
+// laplace decodes an energy delta with a Laplace distribution (CELT coarse energy)
+func (d *rangeDecoder) laplace(fs uint32, decay int) int {
+	const minP = 1
+	const nMin = 16
+	val := 0
+	fm := d.decodeBin(15)
+	fl := uint32(0)
+	if fm >= fs {
+		val++
+		fl = fs
+		fs = (32768-minP*(2*nMin)-fs)*uint32(16384-decay)>>15 + minP
+		for fs > minP && fm >= fl+2*fs {
+			fs *= 2
+			fl += fs
+			fs = uint32(int32(fs-2*minP)*int32(decay)>>15) + minP
+			val++
+		}
+		if fs <= minP {
+			di := (fm - fl) >> 1
+			val += int(di)
+			fl += 2 * di * minP
+		}
+		if fm < fl+fs {
+			val = -val
+		} else {
+			fl += fs
+		}
+	}
+	d.update(fl, min(fl+fs, 32768), 32768)
+	return val
+}
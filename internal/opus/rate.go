@@ -0,0 +1,361 @@
+package opus
+
+// CELT bit allocation (RFC 6716 section 4.3.3)
+
+const allocSteps = 6
+
+// getPulses returns the number of pulses of a pseudo-pulse index
+func getPulses(i int) int {
+	if i < 8 {
+		return i
+	}
+	return (8 + i&7) << (i>>3 - 1)
+}
+
+// pulseCache returns the cached bit counts of a band for a frame size
+func pulseCache(band, lm int) []uint8 {
+	return cacheBits[cacheIndex[(lm+1)*celtNbEBands+band]:]
+}
+
+// bits2pulses returns the pseudo-pulse index fitting best in bits 1/8 bits
+func bits2pulses(band, lm, bits int) int {
+	cache := pulseCache(band, lm)
+	lo, hi := 0, int(cache[0])
+	bits--
+	for i := 0; i < 6; i++ {
+		mid := (lo + hi + 1) >> 1
+		if int(cache[mid]) >= bits {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	loBits := -1
+	if lo != 0 {
+		loBits = int(cache[lo])
+	}
+	if bits-loBits <= int(cache[hi])-bits {
+		return lo
+	}
+	return hi
+}
+
+// pulses2bits returns the 1/8 bits needed for a pseudo-pulse index
+func pulses2bits(band, lm, pulses int) int {
+	if pulses == 0 {
+		return 0
+	}
+	return int(pulseCache(band, lm)[pulses]) + 1
+}
+
+// udiv divides as unsigned 32bit integers
+func udiv(n, d int) int {
+	return int(int32(uint32(n) / uint32(d)))
+}
+
+// allocation is the result of computeAllocation
+type allocation struct {
+	codedBands   int
+	intensity    int
+	dualStereo   bool
+	balance      int
+	pulses       [celtNbEBands]int
+	fineQuant    [celtNbEBands]int
+	finePriority [celtNbEBands]int
+}
+
+// computeAllocation splits total 1/8 bits between the PVQ and the fine energy of the bands,
+// reading the skipped bands and the stereo parameters
+func computeAllocation(start, end int, offsets, caps []int, allocTrim int, total int, c, lm int, dec *rangeDecoder) *allocation {
+	var bits1, bits2, thresh, trimOffset [celtNbEBands]int
+
+	total = max(total, 0)
+	skipStart := start
+	// Reserve a bit to signal the end of manually skipped bands
+	skipRsv := 0
+	if total >= 1<<bitRes {
+		skipRsv = 1 << bitRes
+	}
+	total -= skipRsv
+	// Reserve bits for the intensity and dual stereo parameters
+	intensityRsv, dualStereoRsv := 0, 0
+	if c == 2 {
+		intensityRsv = log2FracTable[end-start]
+		if intensityRsv > total {
+			intensityRsv = 0
+		} else {
+			total -= intensityRsv
+			if total >= 1<<bitRes {
+				dualStereoRsv = 1 << bitRes
+			}
+			total -= dualStereoRsv
+		}
+	}
+
+	for j := start; j < end; j++ {
+		n := eBands[j+1] - eBands[j]
+		// Below this threshold, no PVQ bits are allocated
+		thresh[j] = max(c<<bitRes, (3*n<<lm<<bitRes)>>4)
+		// Tilt of the allocation curve
+		trimOffset[j] = c * n * (allocTrim - 5 - lm) * (end - j - 1) * (1 << (lm + bitRes)) >> 6
+		// Single-coefficient bands get less resolution
+		if n<<lm == 1 {
+			trimOffset[j] -= c << bitRes
+		}
+	}
+	lo, hi := 1, len(bandAllocation)/celtNbEBands-1
+	for lo <= hi {
+		done := false
+		psum := 0
+		mid := (lo + hi) >> 1
+		for j := end - 1; j >= start; j-- {
+			n := eBands[j+1] - eBands[j]
+			bitsj := c * n * int(bandAllocation[mid*celtNbEBands+j]) << lm >> 2
+			if bitsj > 0 {
+				bitsj = max(0, bitsj+trimOffset[j])
+			}
+			bitsj += offsets[j]
+			if bitsj >= thresh[j] || done {
+				done = true
+				psum += min(bitsj, caps[j])
+			} else if bitsj >= c<<bitRes {
+				psum += c << bitRes
+			}
+		}
+		if psum > total {
+			hi = mid - 1
+		} else {
+			lo = mid + 1
+		}
+	}
+	hi = lo
+	lo--
+	for j := start; j < end; j++ {
+		n := eBands[j+1] - eBands[j]
+		bits1j := c * n * int(bandAllocation[lo*celtNbEBands+j]) << lm >> 2
+		bits2j := caps[j]
+		if hi < len(bandAllocation)/celtNbEBands {
+			bits2j = c * n * int(bandAllocation[hi*celtNbEBands+j]) << lm >> 2
+		}
+		if bits1j > 0 {
+			bits1j = max(0, bits1j+trimOffset[j])
+		}
+		if bits2j > 0 {
+			bits2j = max(0, bits2j+trimOffset[j])
+		}
+		if lo > 0 {
+			bits1j += offsets[j]
+		}
+		bits2j += offsets[j]
+		if offsets[j] > 0 {
+			skipStart = j
+		}
+		bits1[j] = bits1j
+		bits2[j] = max(0, bits2j-bits1j)
+	}
+	return interpBits2Pulses(start, end, skipStart, bits1[:], bits2[:], thresh[:], caps, total,
+		skipRsv, intensityRsv, dualStereoRsv, c, lm, dec)
+}
+
+// interpBits2Pulses interpolates between two allocation vectors to use up total 1/8 bits
+func interpBits2Pulses(start, end, skipStart int, bits1, bits2, thresh, caps []int, total int,
+	skipRsv, intensityRsv, dualStereoRsv int, c, lm int, dec *rangeDecoder) *allocation {
+	a := &allocation{}
+	bits := a.pulses[:]
+	ebits := a.fineQuant[:]
+	allocFloor := c << bitRes
+	stereo := 0
+	if c > 1 {
+		stereo = 1
+	}
+	logM := lm << bitRes
+
+	lo, hi := 0, 1<<allocSteps
+	for i := 0; i < allocSteps; i++ {
+		mid := (lo + hi) >> 1
+		psum := 0
+		done := false
+		for j := end - 1; j >= start; j-- {
+			tmp := bits1[j] + (mid * bits2[j] >> allocSteps)
+			if tmp >= thresh[j] || done {
+				done = true
+				// Don't allocate more than can actually be used
+				psum += min(tmp, caps[j])
+			} else if tmp >= allocFloor {
+				psum += allocFloor
+			}
+		}
+		if psum > total {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	psum := 0
+	done := false
+	for j := end - 1; j >= start; j-- {
+		tmp := bits1[j] + (lo * bits2[j] >> allocSteps)
+		if tmp < thresh[j] && !done {
+			if tmp >= allocFloor {
+				tmp = allocFloor
+			} else {
+				tmp = 0
+			}
+		} else {
+			done = true
+		}
+		tmp = min(tmp, caps[j])
+		bits[j] = tmp
+		psum += tmp
+	}
+
+	// Decide which bands to skip, working backwards from the end
+	codedBands := end
+	for ; ; codedBands-- {
+		j := codedBands - 1
+		// Never skip the first band, nor a band that has been boosted by dynalloc
+		if j <= skipStart {
+			// Give the bit reserved to end skipping back
+			total += skipRsv
+			break
+		}
+		// The left-over bits this band would get, including those taken back from skipped bands
+		left := total - psum
+		percoeff := udiv(left, eBands[codedBands]-eBands[start])
+		left -= (eBands[codedBands] - eBands[start]) * percoeff
+		rem := max(left-(eBands[j]-eBands[start]), 0)
+		bandWidth := eBands[codedBands] - eBands[j]
+		bandBits := bits[j] + percoeff*bandWidth + rem
+		// A skip decision is only coded above the threshold of the band, otherwise it is skipped
+		if bandBits >= max(thresh[j], allocFloor+(1<<bitRes)) {
+			if dec.bitLogp(1) {
+				break
+			}
+			// A bit was used to skip this band
+			psum += 1 << bitRes
+			bandBits -= 1 << bitRes
+		}
+		// Reclaim the bits originally allocated to this band
+		psum -= bits[j] + intensityRsv
+		if intensityRsv > 0 {
+			intensityRsv = log2FracTable[j-start]
+		}
+		psum += intensityRsv
+		if bandBits >= allocFloor {
+			// Enough for a fine energy bit per channel
+			psum += allocFloor
+			bits[j] = allocFloor
+		} else {
+			bits[j] = 0
+		}
+	}
+
+	// The intensity and dual stereo parameters
+	if intensityRsv > 0 {
+		a.intensity = start + int(dec.uint(uint32(codedBands+1-start)))
+	}
+	if a.intensity <= start {
+		total += dualStereoRsv
+		dualStereoRsv = 0
+	}
+	if dualStereoRsv > 0 {
+		a.dualStereo = dec.bitLogp(1)
+	}
+
+	// Allocate the remaining bits
+	left := total - psum
+	percoeff := udiv(left, eBands[codedBands]-eBands[start])
+	left -= (eBands[codedBands] - eBands[start]) * percoeff
+	for j := start; j < codedBands; j++ {
+		bits[j] += percoeff * (eBands[j+1] - eBands[j])
+	}
+	for j := start; j < codedBands; j++ {
+		tmp := min(left, eBands[j+1]-eBands[j])
+		bits[j] += tmp
+		left -= tmp
+	}
+
+	balance := 0
+	j := start
+	for ; j < codedBands; j++ {
+		n0 := eBands[j+1] - eBands[j]
+		n := n0 << lm
+		bit := bits[j] + balance
+		var excess int
+		if n > 1 {
+			excess = max(bit-caps[j], 0)
+			bits[j] = bit - excess
+
+			// Compensate for the extra degree of freedom in stereo
+			den := c * n
+			if c == 2 && n > 2 && !a.dualStereo && j < a.intensity {
+				den++
+			}
+			nclogn := den * (logN[j] + logM)
+
+			// Offset for the number of fine bits by log2(N)/2 + FINE_OFFSET
+			// compared to their "fair share" of total/N
+			offset := nclogn>>1 - den*celtFineOffset
+			// N=2 is the only point that doesn't match the curve
+			if n == 2 {
+				offset += den << bitRes >> 2
+			}
+			// Changing the offset for allocating the second and third fine energy bit
+			if bits[j]+offset < den*2<<bitRes {
+				offset += nclogn >> 2
+			} else if bits[j]+offset < den*3<<bitRes {
+				offset += nclogn >> 3
+			}
+
+			// Divide with rounding
+			ebits[j] = max(0, bits[j]+offset+(den<<(bitRes-1)))
+			ebits[j] = udiv(ebits[j], den) >> bitRes
+			// Make sure not to bust
+			if c*ebits[j] > bits[j]>>bitRes {
+				ebits[j] = bits[j] >> stereo >> bitRes
+			}
+			// More than that is useless because that's about as far as PVQ can go
+			ebits[j] = min(ebits[j], celtMaxFineBits)
+
+			// Bands rounded down or capped are candidates for the final fine energy pass
+			a.finePriority[j] = boolInt(ebits[j]*(den<<bitRes) >= bits[j]+offset)
+
+			// The rest of the bits go to PVQ
+			bits[j] -= c * ebits[j] << bitRes
+		} else {
+			// For N=1, all bits go to fine energy except for a single sign bit
+			excess = max(0, bit-(c<<bitRes))
+			bits[j] = bit - excess
+			ebits[j] = 0
+			a.finePriority[j] = 1
+		}
+
+		// Fine energy can't take advantage of the re-balancing in quantAllBands, so it is done here
+		if excess > 0 {
+			extraFine := min(excess>>(stereo+bitRes), celtMaxFineBits-ebits[j])
+			ebits[j] += extraFine
+			extraBits := extraFine * c << bitRes
+			a.finePriority[j] = boolInt(extraBits >= excess-balance)
+			excess -= extraBits
+		}
+		balance = excess
+	}
+	// The bits left over the caps are kept for the re-balancing in quantAllBands
+	a.balance = balance
+
+	// The skipped bands use all their bits for fine energy
+	for ; j < end; j++ {
+		ebits[j] = bits[j] >> stereo >> bitRes
+		bits[j] = 0
+		a.finePriority[j] = boolInt(ebits[j] < 1)
+	}
+	a.codedBands = codedBands
+	return a
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
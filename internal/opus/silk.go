@@ -0,0 +1,840 @@
+package opus
+
+// SILK frame decoding (RFC 6716 section 4.2)
+
+const (
+	maxNbSubfr            = 4
+	ltpOrder              = 5
+	maxLPCOrder           = 16
+	minLPCOrder           = 10
+	maxFrameLength        = 320
+	maxSubFrameLength     = 80
+	shellCodecFrameLength = 16
+	silkMaxPulses         = 16
+	nRateLevels           = 10
+
+	nlsfQuantMaxAmplitude = 4
+	nlsfQuantLevelAdjQ10  = 102
+	bweAfterLossQ16       = 63570
+
+	typeNoVoiceActivity = 0
+	typeUnvoiced        = 1
+	typeVoiced          = 2
+
+	codeIndependently             = 0
+	codeIndependentlyNoLTPScaling = 1
+	codeConditionally             = 2
+)
+
+// silkIndices are the quantization indices of one SILK frame
+type silkIndices struct {
+	gainsIndices     [maxNbSubfr]int8
+	ltpIndex         [maxNbSubfr]int8
+	nlsfIndices      [maxLPCOrder + 1]int8
+	lagIndex         int16
+	contourIndex     int8
+	signalType       int8
+	quantOffsetType  int8
+	nlsfInterpCoefQ2 int8
+	perIndex         int8
+	ltpScaleIndex    int8
+	seed             int8
+}
+
+// silkDecoderControl holds the parameters of one SILK frame
+type silkDecoderControl struct {
+	pitchL      [maxNbSubfr]int
+	gainsQ16    [maxNbSubfr]int32
+	predCoefQ12 [2][maxLPCOrder]int16
+	ltpCoefQ14  [ltpOrder * maxNbSubfr]int16
+	ltpScaleQ14 int32
+}
+
+// silkChannelDecoder is the decoder state of one SILK channel
+type silkChannelDecoder struct {
+	prevGainQ16   int32
+	excQ14        [maxFrameLength]int32
+	sLPCQ14Buf    [maxLPCOrder]int32
+	outBuf        [maxFrameLength + 2*maxSubFrameLength]int16
+	lagPrev       int
+	lastGainIndex int8
+	fsKHz         int
+	fsAPIHz       int
+	nbSubfr       int
+	frameLength   int
+	subfrLength   int
+	ltpMemLength  int
+	lpcOrder      int
+	prevNLSFQ15   [maxLPCOrder]int16
+
+	firstFrameAfterReset bool
+	pitchLagLowBitsICDF  []uint8
+	pitchContourICDF     []uint8
+
+	nFramesDecoded   int
+	nFramesPerPacket int
+
+	ecPrevSignalType int
+	ecPrevLagIndex   int16
+
+	vadFlags  [3]bool
+	lbrrFlag  bool
+	lbrrFlags [3]bool
+
+	resampler silkResampler
+	nlsfCB    *silkNLSFCodebook
+	indices   silkIndices
+	cng       silkCNG
+	plc       silkPLC
+
+	lossCnt        int
+	prevSignalType int
+}
+
+// init resets the channel to its initial state
+func (d *silkChannelDecoder) init() {
+	*d = silkChannelDecoder{
+		firstFrameAfterReset: true,
+		prevGainQ16:          65536,
+	}
+	d.resetCNG()
+	d.resetPLC()
+}
+
+// setFs sets the internal sampling rate fsKHz and the output rate fsAPIHz
+func (d *silkChannelDecoder) setFs(fsKHz, fsAPIHz int) {
+	d.subfrLength = 5 * fsKHz
+	frameLength := d.nbSubfr * d.subfrLength
+
+	// Initialize the resampler when switching internal or external sampling frequency
+	if d.fsKHz != fsKHz || d.fsAPIHz != fsAPIHz {
+		d.resampler.init(fsKHz*1000, fsAPIHz)
+		d.fsAPIHz = fsAPIHz
+	}
+
+	if d.fsKHz != fsKHz || frameLength != d.frameLength {
+		switch {
+		case fsKHz == 8 && d.nbSubfr == maxNbSubfr:
+			d.pitchContourICDF = silkPitchContourNBICDF[:]
+		case fsKHz == 8:
+			d.pitchContourICDF = silkPitchContour10msNBICDF[:]
+		case d.nbSubfr == maxNbSubfr:
+			d.pitchContourICDF = silkPitchContourICDF[:]
+		default:
+			d.pitchContourICDF = silkPitchContour10msICDF[:]
+		}
+		if d.fsKHz != fsKHz {
+			d.ltpMemLength = 20 * fsKHz
+			if fsKHz == 8 || fsKHz == 12 {
+				d.lpcOrder = minLPCOrder
+				d.nlsfCB = silkNLSFCodebookNBMB
+			} else {
+				d.lpcOrder = maxLPCOrder
+				d.nlsfCB = silkNLSFCodebookWB
+			}
+			switch fsKHz {
+			case 16:
+				d.pitchLagLowBitsICDF = silkUniform8ICDF[:]
+			case 12:
+				d.pitchLagLowBitsICDF = silkUniform6ICDF[:]
+			default:
+				d.pitchLagLowBitsICDF = silkUniform4ICDF[:]
+			}
+			d.firstFrameAfterReset = true
+			d.lagPrev = 100
+			d.lastGainIndex = 10
+			d.prevSignalType = typeNoVoiceActivity
+			clear(d.outBuf[:])
+			clear(d.sLPCQ14Buf[:])
+		}
+		d.fsKHz = fsKHz
+		d.frameLength = frameLength
+	}
+}
+
+// decodeFrame decodes one frame into out, or conceals it if lost
+func (d *silkChannelDecoder) decodeFrame(dec *rangeDecoder, out []int16, lost bool, condCoding int) {
+	n := d.frameLength
+	var ctrl silkDecoderControl
+
+	if !lost {
+		pulses := make([]int16, (n+shellCodecFrameLength-1)&^(shellCodecFrameLength-1))
+		d.decodeIndices(dec, d.nFramesDecoded, false, condCoding)
+		decodePulsesSILK(dec, pulses, int(d.indices.signalType), int(d.indices.quantOffsetType), n)
+		d.decodeParameters(&ctrl, condCoding)
+		d.decodeCore(&ctrl, out, pulses)
+		d.runPLC(&ctrl, out, false)
+		d.lossCnt = 0
+		d.prevSignalType = int(d.indices.signalType)
+		d.firstFrameAfterReset = false
+	} else {
+		d.runPLC(&ctrl, out, true)
+	}
+
+	// Update the output buffer
+	mvLen := d.ltpMemLength - n
+	copy(d.outBuf[:mvLen], d.outBuf[n:n+mvLen])
+	copy(d.outBuf[mvLen:], out[:n])
+
+	d.runCNG(&ctrl, out[:n])
+	d.glueFrames(out[:n])
+
+	d.lagPrev = ctrl.pitchL[d.nbSubfr-1]
+}
+
+// decodeIndices decodes the side information of a frame
+func (d *silkChannelDecoder) decodeIndices(dec *rangeDecoder, frameIndex int, decodeLBRR bool, condCoding int) {
+	idx := &d.indices
+
+	// Signal type and quantizer offset
+	var ix int
+	if decodeLBRR || d.vadFlags[frameIndex] {
+		ix = dec.icdf(silkTypeOffsetVADICDF[:], 8) + 2
+	} else {
+		ix = dec.icdf(silkTypeOffsetNoVADICDF[:], 8)
+	}
+	idx.signalType = int8(ix >> 1)
+	idx.quantOffsetType = int8(ix & 1)
+
+	// Gains
+	if condCoding == codeConditionally {
+		idx.gainsIndices[0] = int8(dec.icdf(silkDeltaGainICDF[:], 8))
+	} else {
+		// Independent coding, in two stages: MSB bits followed by 3 LSBs
+		idx.gainsIndices[0] = int8(dec.icdf(silkGainICDF[idx.signalType][:], 8) << 3)
+		idx.gainsIndices[0] += int8(dec.icdf(silkUniform8ICDF[:], 8))
+	}
+	for i := 1; i < d.nbSubfr; i++ {
+		idx.gainsIndices[i] = int8(dec.icdf(silkDeltaGainICDF[:], 8))
+	}
+
+	// Normalized line spectral frequencies
+	cb := d.nlsfCB
+	idx.nlsfIndices[0] = int8(dec.icdf(cb.cb1ICDF[int(idx.signalType>>1)*cb.nVectors:], 8))
+	var ecIx [maxLPCOrder]int
+	var predQ8 [maxLPCOrder]uint8
+	nlsfUnpack(ecIx[:], predQ8[:], cb, int(idx.nlsfIndices[0]))
+	for i := 0; i < cb.order; i++ {
+		ix := dec.icdf(cb.ecICDF[ecIx[i]:], 8)
+		if ix == 0 {
+			ix -= dec.icdf(silkNLSFExtICDF[:], 8)
+		} else if ix == 2*nlsfQuantMaxAmplitude {
+			ix += dec.icdf(silkNLSFExtICDF[:], 8)
+		}
+		idx.nlsfIndices[i+1] = int8(ix - nlsfQuantMaxAmplitude)
+	}
+
+	// Interpolation factor
+	if d.nbSubfr == maxNbSubfr {
+		idx.nlsfInterpCoefQ2 = int8(dec.icdf(silkNLSFInterpolationFactorICDF[:], 8))
+	} else {
+		idx.nlsfInterpCoefQ2 = 4
+	}
+
+	if idx.signalType == typeVoiced {
+		// Pitch lags
+		absolute := true
+		if condCoding == codeConditionally && d.ecPrevSignalType == typeVoiced {
+			delta := int16(dec.icdf(silkPitchDeltaICDF[:], 8))
+			if delta > 0 {
+				idx.lagIndex = d.ecPrevLagIndex + delta - 9
+				absolute = false
+			}
+		}
+		if absolute {
+			idx.lagIndex = int16(dec.icdf(silkPitchLagICDF[:], 8) * (d.fsKHz >> 1))
+			idx.lagIndex += int16(dec.icdf(d.pitchLagLowBitsICDF, 8))
+		}
+		d.ecPrevLagIndex = idx.lagIndex
+		idx.contourIndex = int8(dec.icdf(d.pitchContourICDF, 8))
+
+		// Long-term prediction gains
+		idx.perIndex = int8(dec.icdf(silkLTPPerIndexICDF[:], 8))
+		for k := 0; k < d.nbSubfr; k++ {
+			idx.ltpIndex[k] = int8(dec.icdf(silkLTPGainICDF(int(idx.perIndex)), 8))
+		}
+		if condCoding == codeIndependently {
+			idx.ltpScaleIndex = int8(dec.icdf(silkLTPScaleICDF[:], 8))
+		} else {
+			idx.ltpScaleIndex = 0
+		}
+	}
+	d.ecPrevSignalType = int(idx.signalType)
+
+	idx.seed = int8(dec.icdf(silkUniform4ICDF[:], 8))
+}
+
+func silkLTPGainICDF(perIndex int) []uint8 {
+	switch perIndex {
+	case 0:
+		return silkLTPGainICDF0[:]
+	case 1:
+		return silkLTPGainICDF1[:]
+	default:
+		return silkLTPGainICDF2[:]
+	}
+}
+
+func silkLTPGainVQ(perIndex, index int) []int8 {
+	switch perIndex {
+	case 0:
+		return silkLTPGainVQ0[index][:]
+	case 1:
+		return silkLTPGainVQ1[index][:]
+	default:
+		return silkLTPGainVQ2[index][:]
+	}
+}
+
+// decodePulsesSILK decodes the excitation pulses of a frame
+func decodePulsesSILK(dec *rangeDecoder, pulses []int16, signalType, quantOffsetType, frameLength int) {
+	rateLevelIndex := dec.icdf(silkRateLevelsICDF[signalType>>1][:], 8)
+
+	// Number of shell blocks; 10 ms at 12 kHz needs a partial block
+	iter := frameLength / shellCodecFrameLength
+	if iter*shellCodecFrameLength < frameLength {
+		iter++
+	}
+
+	// Sum-weighted pulses
+	var sumPulses, nLshifts [maxFrameLength/shellCodecFrameLength + 1]int
+	for i := 0; i < iter; i++ {
+		sumPulses[i] = dec.icdf(silkPulsesPerBlockICDF[rateLevelIndex][:], 8)
+		// An escape code signals more LSBs
+		for sumPulses[i] == silkMaxPulses+1 {
+			nLshifts[i]++
+			// After 10 LSBs the escape code is no longer allowed
+			sumPulses[i] = dec.icdf(silkPulsesPerBlockICDF[nRateLevels-1][boolInt(nLshifts[i] == 10):], 8)
+		}
+	}
+
+	// Shell decoding
+	for i := 0; i < iter; i++ {
+		block := pulses[i*shellCodecFrameLength : (i+1)*shellCodecFrameLength]
+		if sumPulses[i] > 0 {
+			shellDecoder(block, dec, sumPulses[i])
+		} else {
+			clear(block)
+		}
+	}
+
+	// LSBs
+	for i := 0; i < iter; i++ {
+		if nLshifts[i] == 0 {
+			continue
+		}
+		block := pulses[i*shellCodecFrameLength : (i+1)*shellCodecFrameLength]
+		for k := range block {
+			absQ := int(block[k])
+			for j := 0; j < nLshifts[i]; j++ {
+				absQ = absQ<<1 + dec.icdf(silkLSBICDF[:], 8)
+			}
+			block[k] = int16(absQ)
+		}
+		// Mark the number of pulses non-zero for the sign decoding
+		sumPulses[i] |= nLshifts[i] << 5
+	}
+
+	// Signs
+	icdf := []uint8{0, 0}
+	signICDF := silkSignICDF[7*(quantOffsetType+signalType<<1):]
+	for i := 0; i < (frameLength+shellCodecFrameLength/2)/shellCodecFrameLength; i++ {
+		p := sumPulses[i]
+		if p <= 0 {
+			continue
+		}
+		icdf[0] = signICDF[min(p&0x1f, 6)]
+		block := pulses[i*shellCodecFrameLength : (i+1)*shellCodecFrameLength]
+		for j := range block {
+			if block[j] > 0 {
+				block[j] *= int16(2*dec.icdf(icdf, 8) - 1)
+			}
+		}
+	}
+}
+
+// shellDecoder splits the pulses of a block of 16 samples recursively in halves
+func shellDecoder(pulses0 []int16, dec *rangeDecoder, pulses4 int) {
+	var pulses3 [2]int16
+	var pulses2 [4]int16
+	var pulses1 [8]int16
+	decodeSplit := func(child []int16, p int16, table []uint8) {
+		if p > 0 {
+			child[0] = int16(dec.icdf(table[silkShellCodeTableOffsets[p]:], 8))
+			child[1] = p - child[0]
+		} else {
+			child[0], child[1] = 0, 0
+		}
+	}
+	decodeSplit(pulses3[0:], int16(pulses4), silkShellCodeTable3[:])
+	decodeSplit(pulses2[0:], pulses3[0], silkShellCodeTable2[:])
+	decodeSplit(pulses1[0:], pulses2[0], silkShellCodeTable1[:])
+	decodeSplit(pulses0[0:], pulses1[0], silkShellCodeTable0[:])
+	decodeSplit(pulses0[2:], pulses1[1], silkShellCodeTable0[:])
+	decodeSplit(pulses1[2:], pulses2[1], silkShellCodeTable1[:])
+	decodeSplit(pulses0[4:], pulses1[2], silkShellCodeTable0[:])
+	decodeSplit(pulses0[6:], pulses1[3], silkShellCodeTable0[:])
+	decodeSplit(pulses2[2:], pulses3[1], silkShellCodeTable2[:])
+	decodeSplit(pulses1[4:], pulses2[2], silkShellCodeTable1[:])
+	decodeSplit(pulses0[8:], pulses1[4], silkShellCodeTable0[:])
+	decodeSplit(pulses0[10:], pulses1[5], silkShellCodeTable0[:])
+	decodeSplit(pulses1[6:], pulses2[3], silkShellCodeTable1[:])
+	decodeSplit(pulses0[12:], pulses1[6], silkShellCodeTable0[:])
+	decodeSplit(pulses0[14:], pulses1[7], silkShellCodeTable0[:])
+}
+
+// decodeParameters dequantizes the gains, filters and pitch of a frame
+func (d *silkChannelDecoder) decodeParameters(ctrl *silkDecoderControl, condCoding int) {
+	idx := &d.indices
+	gainsDequant(ctrl.gainsQ16[:], idx.gainsIndices[:], &d.lastGainIndex, condCoding == codeConditionally, d.nbSubfr)
+
+	var nlsfQ15, nlsf0Q15 [maxLPCOrder]int16
+	order := d.lpcOrder
+	nlsfDecode(nlsfQ15[:order], idx.nlsfIndices[:], d.nlsfCB)
+	nlsf2A(ctrl.predCoefQ12[1][:order], nlsfQ15[:order])
+
+	// Do not interpolate right after a reset, which improves the loss of the first frame after a switch
+	if d.firstFrameAfterReset {
+		idx.nlsfInterpCoefQ2 = 4
+	}
+	if idx.nlsfInterpCoefQ2 < 4 {
+		// Interpolate between the previous and the current NLSFs for the first half
+		for i := 0; i < order; i++ {
+			nlsf0Q15[i] = d.prevNLSFQ15[i] + int16((int32(idx.nlsfInterpCoefQ2)*(int32(nlsfQ15[i])-int32(d.prevNLSFQ15[i])))>>2)
+		}
+		nlsf2A(ctrl.predCoefQ12[0][:order], nlsf0Q15[:order])
+	} else {
+		ctrl.predCoefQ12[0] = ctrl.predCoefQ12[1]
+	}
+	copy(d.prevNLSFQ15[:order], nlsfQ15[:order])
+
+	// Widen the bandwidth of the filters after a packet loss
+	if d.lossCnt != 0 {
+		bwexpander(ctrl.predCoefQ12[0][:order], bweAfterLossQ16)
+		bwexpander(ctrl.predCoefQ12[1][:order], bweAfterLossQ16)
+	}
+
+	if idx.signalType == typeVoiced {
+		decodePitch(idx.lagIndex, int(idx.contourIndex), ctrl.pitchL[:], d.fsKHz, d.nbSubfr)
+		for k := 0; k < d.nbSubfr; k++ {
+			cb := silkLTPGainVQ(int(idx.perIndex), int(idx.ltpIndex[k]))
+			for i := 0; i < ltpOrder; i++ {
+				ctrl.ltpCoefQ14[k*ltpOrder+i] = int16(cb[i]) << 7
+			}
+		}
+		ctrl.ltpScaleQ14 = silkLTPScalesQ14[idx.ltpScaleIndex]
+	} else {
+		clear(ctrl.pitchL[:d.nbSubfr])
+		clear(ctrl.ltpCoefQ14[:ltpOrder*d.nbSubfr])
+		idx.perIndex = 0
+		ctrl.ltpScaleQ14 = 0
+	}
+}
+
+// gainsDequant converts the gain indices to Q16 gains
+func gainsDequant(gainQ16 []int32, ind []int8, prevInd *int8, conditional bool, nbSubfr int) {
+	const (
+		minDeltaGainQuant = -4
+		maxDeltaGainQuant = 36
+		nLevelsQGain      = 64
+		offset            = 2090
+		invScaleQ16       = 1907825
+	)
+	for k := 0; k < nbSubfr; k++ {
+		prev := int(*prevInd)
+		if k == 0 && !conditional {
+			// The gain index is not allowed to go down more than 16 steps (~21.8 dB)
+			prev = max(int(ind[k]), prev-16)
+		} else {
+			// Accumulate the deltas
+			indTmp := int(ind[k]) + minDeltaGainQuant
+			doubleStepSizeThreshold := 2*maxDeltaGainQuant - nLevelsQGain + prev
+			if indTmp > doubleStepSizeThreshold {
+				prev += indTmp<<1 - doubleStepSizeThreshold
+			} else {
+				prev += indTmp
+			}
+		}
+		prev = min(max(prev, 0), nLevelsQGain-1)
+		*prevInd = int8(prev)
+		// Convert to linear scale; 3967 is 31 in Q7
+		gainQ16[k] = log2lin(min(smulwb(invScaleQ16, int32(prev))+offset, 3967))
+	}
+}
+
+// decodePitch converts the lag and contour indices to the pitch lags of the subframes
+func decodePitch(lagIndex int16, contourIndex int, pitchLags []int, fsKHz, nbSubfr int) {
+	var lagCB [][]int8
+	switch {
+	case fsKHz == 8 && nbSubfr == maxNbSubfr:
+		lagCB = [][]int8{silkCBLagsStage2[0][:], silkCBLagsStage2[1][:], silkCBLagsStage2[2][:], silkCBLagsStage2[3][:]}
+	case fsKHz == 8:
+		lagCB = [][]int8{silkCBLagsStage2_10ms[0][:], silkCBLagsStage2_10ms[1][:]}
+	case nbSubfr == maxNbSubfr:
+		lagCB = [][]int8{silkCBLagsStage3[0][:], silkCBLagsStage3[1][:], silkCBLagsStage3[2][:], silkCBLagsStage3[3][:]}
+	default:
+		lagCB = [][]int8{silkCBLagsStage3_10ms[0][:], silkCBLagsStage3_10ms[1][:]}
+	}
+	minLag := 2 * fsKHz
+	maxLag := 18 * fsKHz
+	lag := minLag + int(lagIndex)
+	for k := 0; k < nbSubfr; k++ {
+		pitchLags[k] = min(max(lag+int(lagCB[k][contourIndex]), minLag), maxLag)
+	}
+}
+
+// nlsfUnpack returns the entropy table indices and predictor coefficients of the first stage vector cb1Index
+func nlsfUnpack(ecIx []int, predQ8 []uint8, cb *silkNLSFCodebook, cb1Index int) {
+	ecSel := cb.ecSel[cb1Index*cb.order/2:]
+	for i := 0; i < cb.order; i += 2 {
+		entry := ecSel[i/2]
+		ecIx[i] = int((entry>>1)&7) * (2*nlsfQuantMaxAmplitude + 1)
+		predQ8[i] = cb.predQ8[i+int(entry&1)*(cb.order-1)]
+		ecIx[i+1] = int((entry>>5)&7) * (2*nlsfQuantMaxAmplitude + 1)
+		predQ8[i+1] = cb.predQ8[i+int((entry>>4)&1)*(cb.order-1)+1]
+	}
+}
+
+// nlsfDecode dequantizes the NLSF vector of the codebook path indices
+func nlsfDecode(nlsfQ15 []int16, indices []int8, cb *silkNLSFCodebook) {
+	order := cb.order
+	// First stage
+	cb1 := cb.cb1Q8[int(indices[0])*order:]
+	for i := 0; i < order; i++ {
+		nlsfQ15[i] = int16(cb1[i]) << 7
+	}
+
+	var ecIx [maxLPCOrder]int
+	var predQ8 [maxLPCOrder]uint8
+	nlsfUnpack(ecIx[:], predQ8[:], cb, int(indices[0]))
+
+	// Predictive residual dequantizer
+	var resQ10 [maxLPCOrder]int16
+	var outQ10 int32
+	for i := order - 1; i >= 0; i-- {
+		predQ10 := smulbb(outQ10, int32(predQ8[i])) >> 8
+		outQ10 = int32(indices[i+1]) << 10
+		if outQ10 > 0 {
+			outQ10 -= nlsfQuantLevelAdjQ10
+		} else if outQ10 < 0 {
+			outQ10 += nlsfQuantLevelAdjQ10
+		}
+		outQ10 = smlawb(predQ10, outQ10, cb.quantStepSizeQ16)
+		resQ10[i] = int16(outQ10)
+	}
+
+	// Apply the inverse square-rooted Laroia weights of the codebook vector
+	var w [maxLPCOrder]int16
+	nlsfWeightsLaroia(w[:order], nlsfQ15)
+	for i := 0; i < order; i++ {
+		wQ9 := sqrtApprox(int32(w[i]) << 16)
+		tmp := int32(nlsfQ15[i]) + (int32(resQ10[i])<<14)/wQ9
+		nlsfQ15[i] = int16(min(max(tmp, 0), 32767))
+	}
+
+	nlsfStabilize(nlsfQ15, cb.deltaMinQ15)
+}
+
+// nlsfWeightsLaroia computes the Laroia weights of the NLSF vector in Q2
+func nlsfWeightsLaroia(w []int16, nlsfQ15 []int16) {
+	const one = 1 << (15 + 2)
+	d := len(w)
+	tmp1 := one / max(int32(nlsfQ15[0]), 1)
+	tmp2 := one / max(int32(nlsfQ15[1])-int32(nlsfQ15[0]), 1)
+	w[0] = int16(min(tmp1+tmp2, 32767))
+	for k := 1; k < d-1; k += 2 {
+		tmp1 = one / max(int32(nlsfQ15[k+1])-int32(nlsfQ15[k]), 1)
+		w[k] = int16(min(tmp1+tmp2, 32767))
+		tmp2 = one / max(int32(nlsfQ15[k+2])-int32(nlsfQ15[k+1]), 1)
+		w[k+1] = int16(min(tmp1+tmp2, 32767))
+	}
+	tmp1 = one / max(1<<15-int32(nlsfQ15[d-1]), 1)
+	w[d-1] = int16(min(tmp1+tmp2, 32767))
+}
+
+// nlsfStabilize moves the NLSFs apart to at least the minimum distances deltaMin
+func nlsfStabilize(nlsfQ15 []int16, deltaMinQ15 []int32) {
+	const maxLoops = 20
+	l := len(nlsfQ15)
+	for loops := 0; loops < maxLoops; loops++ {
+		// Find the smallest distance
+		minDiff := int32(nlsfQ15[0]) - deltaMinQ15[0]
+		i := 0
+		for j := 1; j <= l-1; j++ {
+			diff := int32(nlsfQ15[j]) - (int32(nlsfQ15[j-1]) + deltaMinQ15[j])
+			if diff < minDiff {
+				minDiff, i = diff, j
+			}
+		}
+		if diff := 1<<15 - (int32(nlsfQ15[l-1]) + deltaMinQ15[l]); diff < minDiff {
+			minDiff, i = diff, l
+		}
+		if minDiff >= 0 {
+			return
+		}
+
+		switch i {
+		case 0:
+			// Move away from the lower limit
+			nlsfQ15[0] = int16(deltaMinQ15[0])
+		case l:
+			// Move away from the higher limit
+			nlsfQ15[l-1] = int16(1<<15 - deltaMinQ15[l])
+		default:
+			// Find the extremes of the center frequency
+			var minCenter int32
+			for k := 0; k < i; k++ {
+				minCenter += deltaMinQ15[k]
+			}
+			minCenter += deltaMinQ15[i] >> 1
+			maxCenter := int32(1 << 15)
+			for k := l; k > i; k-- {
+				maxCenter -= deltaMinQ15[k]
+			}
+			maxCenter -= deltaMinQ15[i] >> 1
+
+			// Move apart, keeping the same center frequency
+			center := int16(limit32(rshiftRound(int32(nlsfQ15[i-1])+int32(nlsfQ15[i]), 1), minCenter, maxCenter))
+			nlsfQ15[i-1] = center - int16(deltaMinQ15[i]>>1)
+			nlsfQ15[i] = nlsfQ15[i-1] + int16(deltaMinQ15[i])
+		}
+	}
+
+	// Fall back to sorting and spacing the values
+	for i := 1; i < l; i++ {
+		v := nlsfQ15[i]
+		j := i - 1
+		for ; j >= 0 && v < nlsfQ15[j]; j-- {
+			nlsfQ15[j+1] = nlsfQ15[j]
+		}
+		nlsfQ15[j+1] = v
+	}
+	nlsfQ15[0] = int16(max(int32(nlsfQ15[0]), deltaMinQ15[0]))
+	for i := 1; i < l; i++ {
+		nlsfQ15[i] = int16(max(int32(nlsfQ15[i]), int32(nlsfQ15[i-1])+deltaMinQ15[i]))
+	}
+	nlsfQ15[l-1] = int16(min(int32(nlsfQ15[l-1]), 1<<15-deltaMinQ15[l]))
+	for i := l - 2; i >= 0; i-- {
+		nlsfQ15[i] = int16(min(int32(nlsfQ15[i]), int32(nlsfQ15[i+1])-deltaMinQ15[i+1]))
+	}
+}
+
+// nlsf2A converts the NLSFs to the Q12 coefficients of a stable LPC filter
+func nlsf2A(aQ12 []int16, nlsf []int16) {
+	const qa = 16
+	ordering16 := [16]int{0, 15, 8, 7, 4, 11, 12, 3, 2, 13, 10, 5, 6, 9, 14, 1}
+	ordering10 := [10]int{0, 9, 6, 3, 4, 5, 8, 1, 2, 7}
+	d := len(aQ12)
+	ordering := ordering10[:]
+	if d == 16 {
+		ordering = ordering16[:]
+	}
+
+	// Convert the LSFs to 2*cos(LSF) with a piecewise linear table
+	var cosLSFQA [maxLPCOrder]int32
+	for k := 0; k < d; k++ {
+		fInt := int32(nlsf[k]) >> (15 - 7)
+		fFrac := int32(nlsf[k]) - fInt<<(15-7)
+		cosVal := silkLSFCosTabQ12[fInt]
+		delta := silkLSFCosTabQ12[fInt+1] - cosVal
+		cosLSFQA[ordering[k]] = rshiftRound(cosVal<<8+delta*fFrac, 20-qa)
+	}
+
+	// Generate the even and odd polynomials by convolution
+	dd := d >> 1
+	findPoly := func(out []int32, cLSF []int32) {
+		out[0] = 1 << qa
+		out[1] = -cLSF[0]
+		for k := 1; k < dd; k++ {
+			ftmp := cLSF[2*k]
+			out[k+1] = out[k-1]<<1 - int32(rshiftRound64(int64(ftmp)*int64(out[k]), qa))
+			for n := k; n > 1; n-- {
+				out[n] += out[n-2] - int32(rshiftRound64(int64(ftmp)*int64(out[n-1]), qa))
+			}
+			out[1] -= ftmp
+		}
+	}
+	var p, q [maxLPCOrder/2 + 1]int32
+	findPoly(p[:], cosLSFQA[0:])
+	findPoly(q[:], cosLSFQA[1:])
+
+	var a32QA1 [maxLPCOrder]int32
+	for k := 0; k < dd; k++ {
+		ptmp := p[k+1] + p[k]
+		qtmp := q[k+1] - q[k]
+		a32QA1[k] = -qtmp - ptmp
+		a32QA1[d-k-1] = qtmp - ptmp
+	}
+	a32 := a32QA1[:d]
+
+	// Limit the magnitude of the coefficients to fit in 16 bits
+	i := 0
+	for ; i < 10; i++ {
+		var maxAbs int32
+		idx := 0
+		for k := range a32 {
+			if v := abs32(a32[k]); v > maxAbs {
+				maxAbs, idx = v, k
+			}
+		}
+		maxAbs = rshiftRound(maxAbs, qa+1-12)
+		if maxAbs <= 32767 {
+			break
+		}
+		// Reduce the magnitude of the prediction coefficients
+		maxAbs = min(maxAbs, 163838)
+		scQ16 := 65470 - ((maxAbs-32767)<<14)/((maxAbs*int32(idx+1))>>2)
+		bwexpander32(a32, scQ16)
+	}
+	if i == 10 {
+		// Clip the coefficients at the last iteration
+		for k := range a32 {
+			aQ12[k] = int16(sat16(rshiftRound(a32[k], qa+1-12)))
+			a32[k] = int32(aQ12[k]) << (qa + 1 - 12)
+		}
+	} else {
+		for k := range a32 {
+			aQ12[k] = int16(rshiftRound(a32[k], qa+1-12))
+		}
+	}
+
+	// Widen the bandwidth until the filter is stable
+	for i := 0; i < 16; i++ {
+		if lpcInversePredGain(aQ12) >= 107374 { // 1e-4 in Q30
+			break
+		}
+		bwexpander32(a32, 65536-int32(2)<<i)
+		for k := range a32 {
+			aQ12[k] = int16(rshiftRound(a32[k], qa+1-12))
+		}
+	}
+}
+
+// decodeCore synthesizes the frame from the excitation pulses with the long- and short-term prediction filters
+func (d *silkChannelDecoder) decodeCore(ctrl *silkDecoderControl, xq []int16, pulses []int16) {
+	const quantLevelAdjustQ10 = 80
+	idx := &d.indices
+	sLTP := make([]int16, d.ltpMemLength)
+	sLTPQ15 := make([]int32, d.ltpMemLength+d.frameLength)
+	resQ14 := make([]int32, d.subfrLength)
+	sLPCQ14 := make([]int32, d.subfrLength+maxLPCOrder)
+
+	offsetQ10 := silkQuantizationOffsetsQ10[idx.signalType>>1][idx.quantOffsetType]
+	nlsfInterpolation := idx.nlsfInterpCoefQ2 < 1<<2
+
+	// Decode the excitation
+	randSeed := int32(idx.seed)
+	for i := 0; i < d.frameLength; i++ {
+		randSeed = silkRand(randSeed)
+		e := int32(pulses[i]) << 14
+		if e > 0 {
+			e -= quantLevelAdjustQ10 << 4
+		} else if e < 0 {
+			e += quantLevelAdjustQ10 << 4
+		}
+		e += offsetQ10 << 4
+		if randSeed < 0 {
+			e = -e
+		}
+		d.excQ14[i] = e
+		randSeed += int32(pulses[i])
+	}
+
+	copy(sLPCQ14, d.sLPCQ14Buf[:])
+	pexc := d.excQ14[:]
+	pxq := xq
+	sLTPBufIdx := d.ltpMemLength
+	order := d.lpcOrder
+	for k := 0; k < d.nbSubfr; k++ {
+		presQ14 := resQ14
+		aQ12 := ctrl.predCoefQ12[k>>1][:order]
+		bQ14 := ctrl.ltpCoefQ14[k*ltpOrder : (k+1)*ltpOrder]
+		signalType := int(idx.signalType)
+
+		gainQ10 := ctrl.gainsQ16[k] >> 6
+		invGainQ31 := inverse32VarQ(ctrl.gainsQ16[k], 47)
+
+		// Scale the short-term state to the gain change
+		gainAdjQ16 := int32(1 << 16)
+		if ctrl.gainsQ16[k] != d.prevGainQ16 {
+			gainAdjQ16 = div32VarQ(d.prevGainQ16, ctrl.gainsQ16[k], 16)
+			for i := 0; i < maxLPCOrder; i++ {
+				sLPCQ14[i] = smulww(gainAdjQ16, sLPCQ14[i])
+			}
+		}
+		d.prevGainQ16 = ctrl.gainsQ16[k]
+
+		// Avoid an abrupt transition from voiced concealment to unvoiced decoding
+		if d.lossCnt != 0 && d.prevSignalType == typeVoiced && signalType != typeVoiced && k < maxNbSubfr/2 {
+			clear(bQ14)
+			bQ14[ltpOrder/2] = 4096 // 0.25 in Q14
+			signalType = typeVoiced
+			ctrl.pitchL[k] = d.lagPrev
+		}
+
+		lag := 0
+		if signalType == typeVoiced {
+			lag = ctrl.pitchL[k]
+
+			if k == 0 || (k == 2 && nlsfInterpolation) {
+				// Rewhiten the past output with the new filter
+				startIdx := d.ltpMemLength - lag - order - ltpOrder/2
+				if startIdx <= 0 {
+					startIdx = 0
+				}
+				if k == 2 {
+					copy(d.outBuf[d.ltpMemLength:], xq[:2*d.subfrLength])
+				}
+				lpcAnalysisFilter(sLTP[startIdx:], d.outBuf[startIdx+k*d.subfrLength:startIdx+k*d.subfrLength+d.ltpMemLength-startIdx], aQ12)
+
+				// The state is unscaled after the rewhitening
+				if k == 0 {
+					// Scale down the long-term prediction to reduce the inter-packet dependency
+					invGainQ31 = smulwb(invGainQ31, ctrl.ltpScaleQ14) << 2
+				}
+				for i := 0; i < lag+ltpOrder/2; i++ {
+					sLTPQ15[sLTPBufIdx-i-1] = smulwb(invGainQ31, int32(sLTP[d.ltpMemLength-i-1]))
+				}
+			} else if gainAdjQ16 != 1<<16 {
+				// Rescale the long-term state to the gain change
+				for i := 0; i < lag+ltpOrder/2; i++ {
+					sLTPQ15[sLTPBufIdx-i-1] = smulww(gainAdjQ16, sLTPQ15[sLTPBufIdx-i-1])
+				}
+			}
+		}
+
+		if signalType == typeVoiced {
+			// Long-term prediction
+			predLagIdx := sLTPBufIdx - lag + ltpOrder/2
+			for i := 0; i < d.subfrLength; i++ {
+				// Start at 2 to avoid a bias, as smlawb rounds towards -inf
+				ltpPredQ13 := int32(2)
+				for j := 0; j < ltpOrder; j++ {
+					ltpPredQ13 = smlawb(ltpPredQ13, sLTPQ15[predLagIdx-j], int32(bQ14[j]))
+				}
+				predLagIdx++
+
+				presQ14[i] = pexc[i] + ltpPredQ13<<1
+				sLTPQ15[sLTPBufIdx] = presQ14[i] << 1
+				sLTPBufIdx++
+			}
+		} else {
+			presQ14 = pexc
+		}
+
+		for i := 0; i < d.subfrLength; i++ {
+			// Short-term prediction, starting at order/2 to avoid a bias
+			lpcPredQ10 := int32(order >> 1)
+			for j := 0; j < order; j++ {
+				lpcPredQ10 = smlawb(lpcPredQ10, sLPCQ14[maxLPCOrder+i-j-1], int32(aQ12[j]))
+			}
+			sLPCQ14[maxLPCOrder+i] = presQ14[i] + lpcPredQ10<<4
+			pxq[i] = sat16From64(rshiftRound64(smulww64(sLPCQ14[maxLPCOrder+i], gainQ10), 8))
+		}
+
+		copy(sLPCQ14, sLPCQ14[d.subfrLength:d.subfrLength+maxLPCOrder])
+		pexc = pexc[d.subfrLength:]
+		pxq = pxq[d.subfrLength:]
+	}
+	copy(d.sLPCQ14Buf[:], sLPCQ14[:maxLPCOrder])
+}
@@ -0,0 +1,270 @@
+package opus
+
+// SILK decoder for one or two channels, with mid/side stereo (RFC 6716 section 4.2.8)
+
+const stereoInterpLenMS = 8
+
+type silkDecoder struct {
+	channels             [2]silkChannelDecoder
+	predPrevQ13          [2]int32
+	sMid                 [2]int16
+	sSide                [2]int16
+	nChannelsAPI         int
+	nChannelsInternal    int
+	prevDecodeOnlyMiddle bool
+}
+
+// init resets the decoder to its initial state, keeping the channel counts
+func (d *silkDecoder) init() {
+	for i := range d.channels {
+		d.channels[i].init()
+	}
+	d.predPrevQ13 = [2]int32{}
+	d.sMid = [2]int16{}
+	d.sSide = [2]int16{}
+	d.prevDecodeOnlyMiddle = false
+}
+
+// decode decodes one SILK frame of a packet into out as 48 kHz interleaved samples of apiChannels channels,
+// and returns the number of samples per channel. A lost frame is concealed.
+func (d *silkDecoder) decode(dec *rangeDecoder, out []int16, lost, newPacket bool, apiChannels, internalChannels, payloadSizeMS, internalSampleRate int) int {
+	const apiSampleRate = 48000
+	ch := &d.channels
+
+	if newPacket {
+		for n := 0; n < internalChannels; n++ {
+			ch[n].nFramesDecoded = 0
+		}
+	}
+
+	// Initialize the second channel on a mono to stereo transition in the bitstream
+	if internalChannels > d.nChannelsInternal {
+		ch[1].init()
+	}
+
+	stereoToMono := internalChannels == 1 && d.nChannelsInternal == 2 && internalSampleRate == 1000*ch[0].fsKHz
+
+	if ch[0].nFramesDecoded == 0 {
+		for n := 0; n < internalChannels; n++ {
+			switch payloadSizeMS {
+			case 20:
+				ch[n].nFramesPerPacket, ch[n].nbSubfr = 1, 4
+			case 40:
+				ch[n].nFramesPerPacket, ch[n].nbSubfr = 2, 4
+			case 60:
+				ch[n].nFramesPerPacket, ch[n].nbSubfr = 3, 4
+			default:
+				ch[n].nFramesPerPacket, ch[n].nbSubfr = 1, 2
+			}
+			ch[n].setFs((internalSampleRate>>10)+1, apiSampleRate)
+		}
+	}
+
+	if apiChannels == 2 && internalChannels == 2 && (d.nChannelsAPI == 1 || d.nChannelsInternal == 1) {
+		d.predPrevQ13 = [2]int32{}
+		d.sSide = [2]int16{}
+		ch[1].resampler = ch[0].resampler
+	}
+	d.nChannelsAPI = apiChannels
+	d.nChannelsInternal = internalChannels
+
+	var predQ13 [2]int32
+	decodeOnlyMiddle := false
+	if !lost && ch[0].nFramesDecoded == 0 {
+		// Voice activity and low bitrate redundancy flags
+		for n := 0; n < internalChannels; n++ {
+			for i := 0; i < ch[n].nFramesPerPacket; i++ {
+				ch[n].vadFlags[i] = dec.bitLogp(1)
+			}
+			ch[n].lbrrFlag = dec.bitLogp(1)
+		}
+		for n := 0; n < internalChannels; n++ {
+			ch[n].lbrrFlags = [3]bool{}
+			if !ch[n].lbrrFlag {
+				continue
+			}
+			if ch[n].nFramesPerPacket == 1 {
+				ch[n].lbrrFlags[0] = true
+				continue
+			}
+			icdf := silkLBRRFlags2ICDF[:]
+			if ch[n].nFramesPerPacket == 3 {
+				icdf = silkLBRRFlags3ICDF[:]
+			}
+			symbol := dec.icdf(icdf, 8) + 1
+			for i := 0; i < ch[n].nFramesPerPacket; i++ {
+				ch[n].lbrrFlags[i] = (symbol>>i)&1 != 0
+			}
+		}
+
+		// Skip the redundant data, which is only useful for forward error correction
+		for i := 0; i < ch[0].nFramesPerPacket; i++ {
+			for n := 0; n < internalChannels; n++ {
+				if !ch[n].lbrrFlags[i] {
+					continue
+				}
+				if internalChannels == 2 && n == 0 {
+					stereoDecodePred(dec, &predQ13)
+					if !ch[1].lbrrFlags[i] {
+						decodeOnlyMiddle = dec.icdf(silkStereoOnlyCodeMidICDF[:], 8) != 0
+					}
+				}
+				condCoding := codeIndependently
+				if i > 0 && ch[n].lbrrFlags[i-1] {
+					condCoding = codeConditionally
+				}
+				ch[n].decodeIndices(dec, i, true, condCoding)
+				pulses := make([]int16, maxFrameLength)
+				decodePulsesSILK(dec, pulses, int(ch[n].indices.signalType), int(ch[n].indices.quantOffsetType), ch[n].frameLength)
+			}
+		}
+	}
+
+	// Mid/side predictors
+	if internalChannels == 2 {
+		if !lost {
+			stereoDecodePred(dec, &predQ13)
+			if !ch[1].vadFlags[ch[0].nFramesDecoded] {
+				decodeOnlyMiddle = dec.icdf(silkStereoOnlyCodeMidICDF[:], 8) != 0
+			} else {
+				decodeOnlyMiddle = false
+			}
+		} else {
+			predQ13 = d.predPrevQ13
+		}
+	}
+
+	// Reset the side channel prediction memory for the first frame with side coding
+	if internalChannels == 2 && !decodeOnlyMiddle && d.prevDecodeOnlyMiddle {
+		side := &ch[1]
+		clear(side.outBuf[:])
+		clear(side.sLPCQ14Buf[:])
+		side.lagPrev = 100
+		side.lastGainIndex = 10
+		side.prevSignalType = typeNoVoiceActivity
+		side.firstFrameAfterReset = true
+	}
+
+	frameLength := ch[0].frameLength
+	var samples [2][]int16
+	for n := range samples {
+		samples[n] = make([]int16, frameLength+2)
+	}
+
+	hasSide := !d.prevDecodeOnlyMiddle
+	if !lost {
+		hasSide = !decodeOnlyMiddle
+	}
+	for n := 0; n < internalChannels; n++ {
+		if n == 0 || hasSide {
+			frameIndex := ch[0].nFramesDecoded - n
+			condCoding := codeConditionally
+			if frameIndex <= 0 {
+				condCoding = codeIndependently
+			} else if n > 0 && d.prevDecodeOnlyMiddle {
+				// The skipped side frame leaves a well-defined long-term state, which needs no scaling
+				condCoding = codeIndependentlyNoLTPScaling
+			}
+			ch[n].decodeFrame(dec, samples[n][2:], lost, condCoding)
+		}
+		ch[n].nFramesDecoded++
+	}
+
+	if apiChannels == 2 && internalChannels == 2 {
+		d.msToLR(samples[0], samples[1], predQ13, ch[0].fsKHz, frameLength)
+	} else {
+		copy(samples[0][:2], d.sMid[:])
+		copy(d.sMid[:], samples[0][frameLength:])
+	}
+
+	// Resample to the output rate and interleave
+	nSamplesOut := frameLength * apiSampleRate / (ch[0].fsKHz * 1000)
+	resampled := make([]int16, nSamplesOut)
+	for n := 0; n < min(apiChannels, internalChannels); n++ {
+		ch[n].resampler.resample(resampled, samples[n][1:frameLength+1])
+		for i, v := range resampled {
+			out[n+apiChannels*i] = v
+		}
+	}
+
+	// Create two output channels from a mono stream
+	if apiChannels == 2 && internalChannels == 1 {
+		if stereoToMono {
+			// Keep resampling the right channel, in case the collapse to mono just happened
+			ch[1].resampler.resample(resampled, samples[0][1:frameLength+1])
+			for i, v := range resampled {
+				out[1+2*i] = v
+			}
+		} else {
+			for i := 0; i < nSamplesOut; i++ {
+				out[1+2*i] = out[2*i]
+			}
+		}
+	}
+
+	if lost {
+		// Remove the gain clamping, so that the energy doesn't bounce back over several lost packets
+		for n := 0; n < d.nChannelsInternal; n++ {
+			ch[n].lastGainIndex = 10
+		}
+	} else {
+		d.prevDecodeOnlyMiddle = decodeOnlyMiddle
+	}
+	return nSamplesOut
+}
+
+// stereoDecodePred decodes the mid/side predictors
+func stereoDecodePred(dec *rangeDecoder, predQ13 *[2]int32) {
+	var ix [2][3]int
+	n := dec.icdf(silkStereoPredJointICDF[:], 8)
+	ix[0][2] = n / 5
+	ix[1][2] = n - 5*ix[0][2]
+	for n := 0; n < 2; n++ {
+		ix[n][0] = dec.icdf(silkUniform3ICDF[:], 8)
+		ix[n][1] = dec.icdf(silkUniform5ICDF[:], 8)
+	}
+
+	for n := 0; n < 2; n++ {
+		ix[n][0] += 3 * ix[n][2]
+		lowQ13 := silkStereoPredQuantQ13[ix[n][0]]
+		stepQ13 := smulwb(silkStereoPredQuantQ13[ix[n][0]+1]-lowQ13, 6554) // 0.5/5 in Q16
+		predQ13[n] = smlabb(lowQ13, stepQ13, int32(2*ix[n][1]+1))
+	}
+	// Subtracting the second predictor from the first helps when applying them
+	predQ13[0] -= predQ13[1]
+}
+
+// msToLR converts the mid signal x1 and the side signal x2 to left and right in place,
+// starting one sample into the buffers
+func (d *silkDecoder) msToLR(x1, x2 []int16, predQ13 [2]int32, fsKHz, frameLength int) {
+	copy(x1[:2], d.sMid[:])
+	copy(x2[:2], d.sSide[:])
+	copy(d.sMid[:], x1[frameLength:])
+	copy(d.sSide[:], x2[frameLength:])
+
+	// Interpolate the predictors and add the prediction to the side channel
+	pred0Q13, pred1Q13 := d.predPrevQ13[0], d.predPrevQ13[1]
+	denomQ16 := int32((1 << 16) / (stereoInterpLenMS * fsKHz))
+	delta0Q13 := rshiftRound(smulbb(predQ13[0]-d.predPrevQ13[0], denomQ16), 16)
+	delta1Q13 := rshiftRound(smulbb(predQ13[1]-d.predPrevQ13[1], denomQ16), 16)
+	for n := 0; n < frameLength; n++ {
+		if n < stereoInterpLenMS*fsKHz {
+			pred0Q13 += delta0Q13
+			pred1Q13 += delta1Q13
+		} else {
+			pred0Q13, pred1Q13 = predQ13[0], predQ13[1]
+		}
+		sum := (int32(x1[n]) + int32(x1[n+2]) + int32(x1[n+1])<<1) << 9 // Q11
+		sum = smlawb(int32(x2[n+1])<<8, sum, pred0Q13)                  // Q8
+		sum = smlawb(sum, int32(x1[n+1])<<11, pred1Q13)                 // Q8
+		x2[n+1] = int16(sat16(rshiftRound(sum, 8)))
+	}
+	d.predPrevQ13 = predQ13
+
+	for n := 0; n < frameLength; n++ {
+		sum := int32(x1[n+1]) + int32(x2[n+1])
+		diff := int32(x1[n+1]) - int32(x2[n+1])
+		x1[n+1] = int16(sat16(sum))
+		x2[n+1] = int16(sat16(diff))
+	}
+}
@@ -0,0 +1,300 @@
+package opus
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Fixed-point arithmetic of the SILK decoder. The names follow the SILK reference macros:
+// W is a 32-bit operand, B and T the bottom and top 16 bits, and Q the number of fractional bits.
+
+func smulwb(a, b int32) int32 {
+	return int32((int64(a) * int64(int16(b))) >> 16)
+}
+
+func smlawb(a, b, c int32) int32 {
+	return a + smulwb(b, c)
+}
+
+func smulbb(a, b int32) int32 {
+	return int32(int16(a)) * int32(int16(b))
+}
+
+func smlabb(a, b, c int32) int32 {
+	return a + smulbb(b, c)
+}
+
+func smultt(a, b int32) int32 {
+	return (a >> 16) * (b >> 16)
+}
+
+// smulww64 returns the product of a and b in Q16 without truncating it to 32 bits
+func smulww64(a, b int32) int64 {
+	return (int64(a) * int64(b)) >> 16
+}
+
+func smulww(a, b int32) int32 {
+	return int32(smulww64(a, b))
+}
+
+func smlaww(a, b, c int32) int32 {
+	return a + smulww(b, c)
+}
+
+func smmul(a, b int32) int32 {
+	return int32((int64(a) * int64(b)) >> 32)
+}
+
+// rshiftRound divides a by 2^shift, rounding to nearest
+func rshiftRound(a int32, shift int) int32 {
+	if shift == 1 {
+		return (a >> 1) + (a & 1)
+	}
+	return ((a >> (shift - 1)) + 1) >> 1
+}
+
+func rshiftRound64(a int64, shift int) int64 {
+	if shift == 1 {
+		return (a >> 1) + (a & 1)
+	}
+	return ((a >> (shift - 1)) + 1) >> 1
+}
+
+// limit32 clamps a between the two limits, which can be in either order
+func limit32(a, limit1, limit2 int32) int32 {
+	if limit1 > limit2 {
+		return min(max(a, limit2), limit1)
+	}
+	return min(max(a, limit1), limit2)
+}
+
+func lshiftSat32(a int32, shift int) int32 {
+	return limit32(a, math.MinInt32>>shift, math.MaxInt32>>shift) << shift
+}
+
+func sat16(a int32) int32 {
+	return min(max(a, -32768), 32767)
+}
+
+func sat16From64(a int64) int16 {
+	return int16(min(max(a, -32768), 32767))
+}
+
+func silkRand(seed int32) int32 {
+	return 907633515 + seed*196314165
+}
+
+func clz32(x int32) int {
+	return bits.LeadingZeros32(uint32(x))
+}
+
+func abs32(x int32) int32 {
+	if x > 0 {
+		return x
+	}
+	return -x
+}
+
+// clzFrac returns the number of leading zeros of x and the 7 bits after the leading one
+func clzFrac(x int32) (lz int, fracQ7 int32) {
+	lz = clz32(x)
+	fracQ7 = int32(bits.RotateLeft32(uint32(x), lz-24)) & 0x7f
+	return lz, fracQ7
+}
+
+// sqrtApprox approximates the square root of x within 10%
+func sqrtApprox(x int32) int32 {
+	if x <= 0 {
+		return 0
+	}
+	lz, fracQ7 := clzFrac(x)
+	y := int32(46214) // sqrt(2) * 32768
+	if lz&1 != 0 {
+		y = 32768
+	}
+	y >>= lz >> 1
+	return smlawb(y, y, smulbb(213, fracQ7))
+}
+
+// div32VarQ approximates (a << qRes) / b
+func div32VarQ(a, b int32, qRes int) int32 {
+	aHeadroom := clz32(abs32(a)) - 1
+	aNrm := a << aHeadroom
+	bHeadroom := clz32(abs32(b)) - 1
+	bNrm := b << bHeadroom
+
+	// Inverse of b, with 14 bits of precision
+	bInv := (math.MaxInt32 >> 2) / (bNrm >> 16)
+	result := smulwb(aNrm, bInv)
+	// Refine with the residual
+	aNrm -= smmul(bNrm, result) << 3
+	result = smlawb(result, aNrm, bInv)
+
+	lshift := 29 + aHeadroom - bHeadroom - qRes
+	switch {
+	case lshift < 0:
+		return lshiftSat32(result, -lshift)
+	case lshift < 32:
+		return result >> lshift
+	default:
+		return 0
+	}
+}
+
+// inverse32VarQ approximates (1 << qRes) / b
+func inverse32VarQ(b int32, qRes int) int32 {
+	bHeadroom := clz32(abs32(b)) - 1
+	bNrm := b << bHeadroom
+
+	// Inverse of b, with 14 bits of precision
+	bInv := (math.MaxInt32 >> 2) / (bNrm >> 16)
+	result := bInv << 16
+	// Refine with the residual
+	errQ32 := ((1 << 29) - smulwb(bNrm, bInv)) << 3
+	result = smlaww(result, errQ32, bInv)
+
+	lshift := 61 - bHeadroom - qRes
+	switch {
+	case lshift <= 0:
+		return lshiftSat32(result, -lshift)
+	case lshift < 32:
+		return result >> lshift
+	default:
+		return 0
+	}
+}
+
+// log2lin approximates 2^(x/128)
+func log2lin(inLogQ7 int32) int32 {
+	if inLogQ7 < 0 {
+		return 0
+	}
+	if inLogQ7 >= 3967 {
+		return math.MaxInt32
+	}
+	out := int32(1) << (inLogQ7 >> 7)
+	fracQ7 := inLogQ7 & 0x7f
+	// Piece-wise parabolic approximation
+	if inLogQ7 < 2048 {
+		return out + ((out * smlawb(fracQ7, smulbb(fracQ7, 128-fracQ7), -174)) >> 7)
+	}
+	return out + (out>>7)*smlawb(fracQ7, smulbb(fracQ7, 128-fracQ7), -174)
+}
+
+// sumSqrShift returns the energy of x, shifted right by shift so that it has two leading zeros
+func sumSqrShift(x []int16) (energy int32, shift int) {
+	n := len(x) - 1
+	var nrg int32
+	i := 0
+	for ; i < n; i += 2 {
+		nrg += int32(x[i])*int32(x[i]) + int32(x[i+1])*int32(x[i+1])
+		if nrg < 0 {
+			// Scale down
+			nrg = int32(uint32(nrg) >> 2)
+			shift = 2
+			i += 2
+			break
+		}
+	}
+	for ; i < n; i += 2 {
+		tmp := int32(x[i])*int32(x[i]) + int32(x[i+1])*int32(x[i+1])
+		nrg = int32(uint32(nrg) + uint32(tmp)>>shift)
+		if nrg < 0 {
+			// Scale down
+			nrg = int32(uint32(nrg) >> 2)
+			shift += 2
+		}
+	}
+	if i == n {
+		// One sample left to process
+		tmp := int32(x[i]) * int32(x[i])
+		nrg = int32(uint32(nrg) + uint32(tmp)>>shift)
+	}
+	// Make sure to have two leading zeros
+	if uint32(nrg)&0xC0000000 != 0 {
+		nrg = int32(uint32(nrg) >> 2)
+		shift += 2
+	}
+	return nrg, shift
+}
+
+// bwexpander chirps the AR filter ar by chirpQ16, widening the bandwidth of its poles
+func bwexpander(ar []int16, chirpQ16 int32) {
+	chirpMinusOneQ16 := chirpQ16 - 65536
+	d := len(ar)
+	for i := 0; i < d-1; i++ {
+		ar[i] = int16(rshiftRound(chirpQ16*int32(ar[i]), 16))
+		chirpQ16 += rshiftRound(chirpQ16*chirpMinusOneQ16, 16)
+	}
+	ar[d-1] = int16(rshiftRound(chirpQ16*int32(ar[d-1]), 16))
+}
+
+func bwexpander32(ar []int32, chirpQ16 int32) {
+	chirpMinusOneQ16 := chirpQ16 - 65536
+	d := len(ar)
+	for i := 0; i < d-1; i++ {
+		ar[i] = smulww(chirpQ16, ar[i])
+		chirpQ16 += rshiftRound(chirpQ16*chirpMinusOneQ16, 16)
+	}
+	ar[d-1] = smulww(chirpQ16, ar[d-1])
+}
+
+// lpcInversePredGain returns the inverse prediction gain of the Q12 filter a in Q30, or 0 if the filter is unstable
+func lpcInversePredGain(aQ12 []int16) int32 {
+	const (
+		qa     = 24
+		aLimit = 16773022 // 0.99975 in Q24
+	)
+	order := len(aQ12)
+	var aTmp [2][maxLPCOrder]int32
+	aNew := aTmp[order&1][:]
+	var dcResp int32
+	for k := range aQ12 {
+		dcResp += int32(aQ12[k])
+		aNew[k] = int32(aQ12[k]) << (qa - 12)
+	}
+	// If the DC is unstable, we don't even need to do the full calculations
+	if dcResp >= 4096 {
+		return 0
+	}
+
+	invGainQ30 := int32(1 << 30)
+	for k := order - 1; k > 0; k-- {
+		if aNew[k] > aLimit || aNew[k] < -aLimit {
+			return 0
+		}
+		// Set the reflection coefficient to the negated AR coefficient
+		rcQ31 := -(aNew[k] << (31 - qa))
+		rcMult1Q30 := (1 << 30) - smmul(rcQ31, rcQ31)
+		mult2Q := 32 - clz32(abs32(rcMult1Q30))
+		rcMult2 := inverse32VarQ(rcMult1Q30, mult2Q+30)
+		invGainQ30 = smmul(invGainQ30, rcMult1Q30) << 2
+
+		aOld := aNew
+		aNew = aTmp[k&1][:]
+		for n := 0; n < k; n++ {
+			tmp := aOld[n] - int32(rshiftRound64(int64(aOld[k-n-1])*int64(rcQ31), 31))
+			aNew[n] = int32(rshiftRound64(int64(tmp)*int64(rcMult2), mult2Q))
+		}
+	}
+	if aNew[0] > aLimit || aNew[0] < -aLimit {
+		return 0
+	}
+	rcQ31 := -(aNew[0] << (31 - qa))
+	rcMult1Q30 := (1 << 30) - smmul(rcQ31, rcQ31)
+	return smmul(invGainQ30, rcMult1Q30) << 2
+}
+
+// lpcAnalysisFilter filters in with the Q12 MA coefficients b into out; the first len(b) outputs are zero
+func lpcAnalysisFilter(out, in, b []int16) {
+	d := len(b)
+	for ix := d; ix < len(in); ix++ {
+		var outQ12 int32
+		for j := 0; j < d; j++ {
+			outQ12 += int32(in[ix-1-j]) * int32(b[j])
+		}
+		outQ12 = int32(in[ix])<<12 - outQ12
+		out[ix] = int16(sat16(rshiftRound(outQ12, 12)))
+	}
+	clear(out[:d])
+}
@@ -0,0 +1,379 @@
+package opus
+
+// SILK packet loss concealment and comfort noise generation
+
+const (
+	plcBWECoefQ16           = 64881 // 0.99 in Q16
+	vPitchGainStartMinQ14   = 11469 // 0.7 in Q14
+	vPitchGainStartMaxQ14   = 15565 // 0.95 in Q14
+	maxPitchLagMS           = 18
+	randBufSize             = 128
+	randBufMask             = randBufSize - 1
+	log2InvLPCGainHighThres = 3 // 2^3 = 8 dB LPC gain
+	log2InvLPCGainLowThres  = 8 // 2^8 = 24 dB LPC gain
+	pitchDriftFacQ16        = 655
+	cngBufMaskMax           = 255
+	cngGainSmthQ16          = 4634
+	cngNLSFSmthQ16          = 16348
+)
+
+var (
+	harmAttQ15            = [2]int32{32440, 31130} // 0.99, 0.95
+	plcRandAttenuateVQ15  = [2]int32{31130, 26214} // 0.95, 0.8
+	plcRandAttenuateUVQ15 = [2]int32{32440, 29491} // 0.99, 0.9
+)
+
+// silkPLC is the concealment state, taken from the last good frame
+type silkPLC struct {
+	pitchLQ8        int32
+	ltpCoefQ14      [ltpOrder]int16
+	prevLPCQ12      [maxLPCOrder]int16
+	lastFrameLost   bool
+	randSeed        int32
+	randScaleQ14    int16
+	concEnergy      int32
+	concEnergyShift int
+	prevLTPScaleQ14 int16
+	prevGainQ16     [2]int32
+	fsKHz           int
+	nbSubfr         int
+	subfrLength     int
+}
+
+// silkCNG is the comfort noise state
+type silkCNG struct {
+	excBufQ14   [maxFrameLength]int32
+	smthNLSFQ15 [maxLPCOrder]int16
+	synthState  [maxLPCOrder]int32
+	smthGainQ16 int32
+	randSeed    int32
+	fsKHz       int
+}
+
+func (d *silkChannelDecoder) resetPLC() {
+	d.plc.pitchLQ8 = int32(d.frameLength) << (8 - 1)
+	d.plc.prevGainQ16 = [2]int32{1 << 16, 1 << 16}
+	d.plc.subfrLength = 20
+	d.plc.nbSubfr = 2
+}
+
+// runPLC conceals a lost frame into frame, or updates the concealment state from a good one
+func (d *silkChannelDecoder) runPLC(ctrl *silkDecoderControl, frame []int16, lost bool) {
+	if d.fsKHz != d.plc.fsKHz {
+		d.resetPLC()
+		d.plc.fsKHz = d.fsKHz
+	}
+	if lost {
+		d.concealPLC(ctrl, frame)
+		d.lossCnt++
+	} else {
+		d.updatePLC(ctrl)
+	}
+}
+
+func (d *silkChannelDecoder) updatePLC(ctrl *silkDecoderControl) {
+	plc := &d.plc
+	d.prevSignalType = int(d.indices.signalType)
+	var ltpGainQ14 int32
+	if d.indices.signalType == typeVoiced {
+		// Find the parameters of the last subframe which contains a pitch pulse
+		for j := 0; j*d.subfrLength < ctrl.pitchL[d.nbSubfr-1]; j++ {
+			if j == d.nbSubfr {
+				break
+			}
+			var tmp int32
+			for i := 0; i < ltpOrder; i++ {
+				tmp += int32(ctrl.ltpCoefQ14[(d.nbSubfr-1-j)*ltpOrder+i])
+			}
+			if tmp > ltpGainQ14 {
+				ltpGainQ14 = tmp
+				copy(plc.ltpCoefQ14[:], ctrl.ltpCoefQ14[(d.nbSubfr-1-j)*ltpOrder:])
+				plc.pitchLQ8 = int32(ctrl.pitchL[d.nbSubfr-1-j]) << 8
+			}
+		}
+		clear(plc.ltpCoefQ14[:])
+		plc.ltpCoefQ14[ltpOrder/2] = int16(ltpGainQ14)
+
+		// Limit the long-term coefficients
+		if ltpGainQ14 < vPitchGainStartMinQ14 {
+			scaleQ10 := (vPitchGainStartMinQ14 << 10) / max(ltpGainQ14, 1)
+			for i := range plc.ltpCoefQ14 {
+				plc.ltpCoefQ14[i] = int16(smulbb(int32(plc.ltpCoefQ14[i]), scaleQ10) >> 10)
+			}
+		} else if ltpGainQ14 > vPitchGainStartMaxQ14 {
+			scaleQ14 := (vPitchGainStartMaxQ14 << 14) / max(ltpGainQ14, 1)
+			for i := range plc.ltpCoefQ14 {
+				plc.ltpCoefQ14[i] = int16(smulbb(int32(plc.ltpCoefQ14[i]), scaleQ14) >> 14)
+			}
+		}
+	} else {
+		plc.pitchLQ8 = int32(d.fsKHz*18) << 8
+		clear(plc.ltpCoefQ14[:])
+	}
+
+	copy(plc.prevLPCQ12[:d.lpcOrder], ctrl.predCoefQ12[1][:d.lpcOrder])
+	plc.prevLTPScaleQ14 = int16(ctrl.ltpScaleQ14)
+	copy(plc.prevGainQ16[:], ctrl.gainsQ16[d.nbSubfr-2:])
+	plc.subfrLength = d.subfrLength
+	plc.nbSubfr = d.nbSubfr
+}
+
+func (d *silkChannelDecoder) concealPLC(ctrl *silkDecoderControl, frame []int16) {
+	plc := &d.plc
+	order := d.lpcOrder
+	sLTPQ14 := make([]int32, d.ltpMemLength+d.frameLength)
+	sLTP := make([]int16, d.ltpMemLength)
+
+	prevGainQ10 := [2]int32{plc.prevGainQ16[0] >> 6, plc.prevGainQ16[1] >> 6}
+	if d.firstFrameAfterReset {
+		clear(plc.prevLPCQ12[:])
+	}
+
+	// Use the lower energy of the last two subframes as the random noise generator
+	excBuf := make([]int16, 2*d.subfrLength)
+	for k := 0; k < 2; k++ {
+		for i := 0; i < d.subfrLength; i++ {
+			v := smulww64(d.excQ14[i+(k+d.nbSubfr-2)*d.subfrLength], prevGainQ10[k]) >> 8
+			excBuf[k*d.subfrLength+i] = sat16From64(v)
+		}
+	}
+	energy1, shift1 := sumSqrShift(excBuf[:d.subfrLength])
+	energy2, shift2 := sumSqrShift(excBuf[d.subfrLength:])
+	var randBuf []int32
+	if energy1>>shift2 < energy2>>shift1 {
+		// First subframe has the lowest energy
+		randBuf = d.excQ14[max(0, (plc.nbSubfr-1)*plc.subfrLength-randBufSize):]
+	} else {
+		// Second subframe has the lowest energy
+		randBuf = d.excQ14[max(0, plc.nbSubfr*plc.subfrLength-randBufSize):]
+	}
+
+	bQ14 := plc.ltpCoefQ14[:]
+	randScaleQ14 := plc.randScaleQ14
+
+	// Attenuation gains
+	harmGainQ15 := harmAttQ15[min(1, d.lossCnt)]
+	randGainQ15 := plcRandAttenuateUVQ15[min(1, d.lossCnt)]
+	if d.prevSignalType == typeVoiced {
+		randGainQ15 = plcRandAttenuateVQ15[min(1, d.lossCnt)]
+	}
+
+	// Widen the bandwidth of the previous filter
+	bwexpander(plc.prevLPCQ12[:order], plcBWECoefQ16)
+	var aQ12 [maxLPCOrder]int16
+	copy(aQ12[:], plc.prevLPCQ12[:order])
+
+	// First lost frame
+	if d.lossCnt == 0 {
+		randScaleQ14 = 1 << 14
+		if d.prevSignalType == typeVoiced {
+			// Reduce the random noise of voiced frames
+			for i := 0; i < ltpOrder; i++ {
+				randScaleQ14 -= bQ14[i]
+			}
+			randScaleQ14 = max(3277, randScaleQ14) // 0.2
+			randScaleQ14 = int16(smulbb(int32(randScaleQ14), int32(plc.prevLTPScaleQ14)) >> 14)
+		} else {
+			// Reduce the random noise of unvoiced frames with high LPC gain
+			invGainQ30 := lpcInversePredGain(plc.prevLPCQ12[:order])
+			downScaleQ30 := min(int32(1<<30)>>log2InvLPCGainHighThres, invGainQ30)
+			downScaleQ30 = max(int32(1<<30)>>log2InvLPCGainLowThres, downScaleQ30)
+			downScaleQ30 <<= log2InvLPCGainHighThres
+			randGainQ15 = smulwb(downScaleQ30, randGainQ15) >> 14
+		}
+	}
+
+	randSeed := plc.randSeed
+	lag := int(rshiftRound(plc.pitchLQ8, 8))
+	sLTPBufIdx := d.ltpMemLength
+
+	// Rewhiten the long-term state
+	idx := max(d.ltpMemLength-lag-order-ltpOrder/2, 0)
+	lpcAnalysisFilter(sLTP[idx:], d.outBuf[idx:d.ltpMemLength], aQ12[:order])
+
+	// Scale the long-term state
+	invGainQ30 := inverse32VarQ(plc.prevGainQ16[1], 46)
+	invGainQ30 = min(invGainQ30, 1<<30-1)
+	for i := idx + order; i < d.ltpMemLength; i++ {
+		sLTPQ14[i] = smulwb(invGainQ30, int32(sLTP[i]))
+	}
+
+	// Long-term synthesis
+	for k := 0; k < d.nbSubfr; k++ {
+		predLagIdx := sLTPBufIdx - lag + ltpOrder/2
+		for i := 0; i < d.subfrLength; i++ {
+			// Start at 2 to avoid a bias, as smlawb rounds towards -inf
+			ltpPredQ12 := int32(2)
+			for j := 0; j < ltpOrder; j++ {
+				ltpPredQ12 = smlawb(ltpPredQ12, sLTPQ14[predLagIdx-j], int32(bQ14[j]))
+			}
+			predLagIdx++
+
+			// Generate the excitation
+			randSeed = silkRand(randSeed)
+			ri := (randSeed >> 25) & randBufMask
+			sLTPQ14[sLTPBufIdx] = smlawb(ltpPredQ12, randBuf[ri], int32(randScaleQ14)) << 2
+			sLTPBufIdx++
+		}
+
+		// Gradually reduce the long-term gain
+		for j := 0; j < ltpOrder; j++ {
+			bQ14[j] = int16(smulbb(harmGainQ15, int32(bQ14[j])) >> 15)
+		}
+		// Gradually reduce the excitation gain
+		randScaleQ14 = int16(smulbb(int32(randScaleQ14), randGainQ15) >> 15)
+
+		// Slowly increase the pitch lag
+		plc.pitchLQ8 = smlawb(plc.pitchLQ8, plc.pitchLQ8, pitchDriftFacQ16)
+		plc.pitchLQ8 = min(plc.pitchLQ8, int32(maxPitchLagMS*d.fsKHz)<<8)
+		lag = int(rshiftRound(plc.pitchLQ8, 8))
+	}
+
+	// Short-term synthesis
+	sLPCQ14 := sLTPQ14[d.ltpMemLength-maxLPCOrder:]
+	copy(sLPCQ14, d.sLPCQ14Buf[:])
+	for i := 0; i < d.frameLength; i++ {
+		// Start at order/2 to avoid a bias, as smlawb rounds towards -inf
+		lpcPredQ10 := int32(order >> 1)
+		for j := 0; j < order; j++ {
+			lpcPredQ10 = smlawb(lpcPredQ10, sLPCQ14[maxLPCOrder+i-j-1], int32(aQ12[j]))
+		}
+		sLPCQ14[maxLPCOrder+i] += lpcPredQ10 << 4
+		frame[i] = sat16From64(rshiftRound64(smulww64(sLPCQ14[maxLPCOrder+i], prevGainQ10[1]), 8))
+	}
+	copy(d.sLPCQ14Buf[:], sLPCQ14[d.frameLength:d.frameLength+maxLPCOrder])
+
+	plc.randSeed = randSeed
+	plc.randScaleQ14 = randScaleQ14
+	for i := range ctrl.pitchL {
+		ctrl.pitchL[i] = lag
+	}
+}
+
+// glueFrames smooths the transition from concealed frames to a good one
+func (d *silkChannelDecoder) glueFrames(frame []int16) {
+	plc := &d.plc
+	if d.lossCnt != 0 {
+		// Remember the energy of the concealed signal
+		plc.concEnergy, plc.concEnergyShift = sumSqrShift(frame)
+		plc.lastFrameLost = true
+		return
+	}
+	if plc.lastFrameLost {
+		energy, energyShift := sumSqrShift(frame)
+
+		// Normalize the energies
+		if energyShift > plc.concEnergyShift {
+			plc.concEnergy >>= energyShift - plc.concEnergyShift
+		} else if energyShift < plc.concEnergyShift {
+			energy >>= plc.concEnergyShift - energyShift
+		}
+
+		// Fade in the energy difference
+		if energy > plc.concEnergy {
+			lz := clz32(plc.concEnergy) - 1
+			plc.concEnergy <<= lz
+			energy >>= max(24-lz, 0)
+			fracQ24 := plc.concEnergy / max(energy, 1)
+			gainQ16 := sqrtApprox(fracQ24) << 4
+			slopeQ16 := ((1 << 16) - gainQ16) / int32(len(frame))
+			// Make the slope 4x steeper to avoid missing onsets after DTX
+			slopeQ16 <<= 2
+			for i := range frame {
+				frame[i] = int16(smulwb(gainQ16, int32(frame[i])))
+				gainQ16 += slopeQ16
+				if gainQ16 > 1<<16 {
+					break
+				}
+			}
+		}
+	}
+	plc.lastFrameLost = false
+}
+
+func (d *silkChannelDecoder) resetCNG() {
+	step := int16(32767 / (d.lpcOrder + 1))
+	var acc int16
+	for i := 0; i < d.lpcOrder; i++ {
+		acc += step
+		d.cng.smthNLSFQ15[i] = acc
+	}
+	d.cng.smthGainQ16 = 0
+	d.cng.randSeed = 3176576
+}
+
+// runCNG updates the comfort noise estimate, and adds the noise to frame when packets are lost
+func (d *silkChannelDecoder) runCNG(ctrl *silkDecoderControl, frame []int16) {
+	cng := &d.cng
+	if d.fsKHz != cng.fsKHz {
+		d.resetCNG()
+		cng.fsKHz = d.fsKHz
+	}
+
+	if d.lossCnt == 0 && d.prevSignalType == typeNoVoiceActivity {
+		// Smooth the NLSFs
+		for i := 0; i < d.lpcOrder; i++ {
+			cng.smthNLSFQ15[i] += int16(smulwb(int32(d.prevNLSFQ15[i])-int32(cng.smthNLSFQ15[i]), cngNLSFSmthQ16))
+		}
+		// Update the excitation buffer with the subframe with the highest gain
+		var maxGainQ16 int32
+		subfr := 0
+		for i := 0; i < d.nbSubfr; i++ {
+			if ctrl.gainsQ16[i] > maxGainQ16 {
+				maxGainQ16 = ctrl.gainsQ16[i]
+				subfr = i
+			}
+		}
+		copy(cng.excBufQ14[d.subfrLength:d.nbSubfr*d.subfrLength], cng.excBufQ14[:(d.nbSubfr-1)*d.subfrLength])
+		copy(cng.excBufQ14[:d.subfrLength], d.excQ14[subfr*d.subfrLength:])
+		// Smooth the gains
+		for i := 0; i < d.nbSubfr; i++ {
+			cng.smthGainQ16 += smulwb(ctrl.gainsQ16[i]-cng.smthGainQ16, cngGainSmthQ16)
+		}
+	}
+
+	if d.lossCnt == 0 {
+		clear(cng.synthState[:d.lpcOrder])
+		return
+	}
+
+	// Generate the excitation
+	n := len(frame)
+	sigQ10 := make([]int32, n+maxLPCOrder)
+	gainQ16 := smulww(int32(d.plc.randScaleQ14), d.plc.prevGainQ16[1])
+	if gainQ16 >= 1<<21 || cng.smthGainQ16 > 1<<23 {
+		gainQ16 = smultt(gainQ16, gainQ16)
+		gainQ16 = smultt(cng.smthGainQ16, cng.smthGainQ16) - gainQ16<<5
+		gainQ16 = sqrtApprox(gainQ16) << 16
+	} else {
+		gainQ16 = smulww(gainQ16, gainQ16)
+		gainQ16 = smulww(cng.smthGainQ16, cng.smthGainQ16) - gainQ16<<5
+		gainQ16 = sqrtApprox(gainQ16) << 8
+	}
+	excMask := int32(cngBufMaskMax)
+	for excMask > int32(n) {
+		excMask >>= 1
+	}
+	seed := cng.randSeed
+	for i := 0; i < n; i++ {
+		seed = silkRand(seed)
+		idx := (seed >> 24) & excMask
+		sigQ10[maxLPCOrder+i] = int32(sat16From64(smulww64(cng.excBufQ14[idx], gainQ16>>4)))
+	}
+	cng.randSeed = seed
+
+	// Synthesis filtering
+	var aQ12 [maxLPCOrder]int16
+	nlsf2A(aQ12[:d.lpcOrder], cng.smthNLSFQ15[:d.lpcOrder])
+	copy(sigQ10, cng.synthState[:])
+	for i := 0; i < n; i++ {
+		// Start at order/2 to avoid a bias, as smlawb rounds towards -inf
+		sumQ6 := int32(d.lpcOrder >> 1)
+		for j := 0; j < d.lpcOrder; j++ {
+			sumQ6 = smlawb(sumQ6, sigQ10[maxLPCOrder+i-j-1], int32(aQ12[j]))
+		}
+		sigQ10[maxLPCOrder+i] += sumQ6 << 4
+		frame[i] = int16(sat16(int32(frame[i]) + rshiftRound(sigQ10[maxLPCOrder+i], 10)))
+	}
+	copy(cng.synthState[:], sigQ10[n:n+maxLPCOrder])
+}
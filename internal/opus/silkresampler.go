@@ -0,0 +1,126 @@
+package opus
+
+// Resampling of the SILK output to 48 kHz, with 2x allpass upsampling followed by FIR interpolation
+
+const resamplerOrderFIR12 = 8
+
+var (
+	resamplerUp2HQ0 = [3]int32{1746, 14986, 39083 - 65536}
+	resamplerUp2HQ1 = [3]int32{6854, 25769, 55542 - 65536}
+)
+
+type silkResampler struct {
+	sIIR        [6]int32
+	sFIR        [resamplerOrderFIR12]int16
+	delayBuf    [48]int16
+	fsInKHz     int
+	fsOutKHz    int
+	batchSize   int
+	inputDelay  int
+	invRatioQ16 int32
+}
+
+// init resets r to upsample from fsIn, which is 8, 12 or 16 kHz, to fsOut, which is 48 kHz
+func (r *silkResampler) init(fsIn, fsOut int) {
+	*r = silkResampler{}
+	switch fsIn {
+	case 12000:
+		r.inputDelay = 4
+	case 16000:
+		r.inputDelay = 7
+	}
+	r.fsInKHz = fsIn / 1000
+	r.fsOutKHz = fsOut / 1000
+	r.batchSize = r.fsInKHz * 10
+
+	// Ratio of input to output samples, rounded up
+	r.invRatioQ16 = int32((fsIn<<15)/fsOut) << 2
+	for smulww(r.invRatioQ16, int32(fsOut)) < int32(fsIn)<<1 {
+		r.invRatioQ16++
+	}
+}
+
+// resample resamples in into out; in holds at least 1 ms of samples
+func (r *silkResampler) resample(out, in []int16) {
+	nSamples := r.fsInKHz - r.inputDelay
+	copy(r.delayBuf[r.inputDelay:r.fsInKHz], in[:nSamples])
+	r.resampleIIRFIR(out, r.delayBuf[:r.fsInKHz])
+	r.resampleIIRFIR(out[r.fsOutKHz:], in[nSamples:len(in)-r.inputDelay])
+	copy(r.delayBuf[:r.inputDelay], in[len(in)-r.inputDelay:])
+}
+
+func (r *silkResampler) resampleIIRFIR(out, in []int16) {
+	buf := make([]int16, 2*r.batchSize+resamplerOrderFIR12)
+	copy(buf, r.sFIR[:])
+
+	var nSamplesIn int
+	for {
+		nSamplesIn = min(len(in), r.batchSize)
+
+		// Upsample 2x
+		r.up2HQ(buf[resamplerOrderFIR12:], in[:nSamplesIn])
+
+		// Interpolate the upsampled signal
+		maxIndexQ16 := int32(nSamplesIn) << (16 + 1)
+		for indexQ16 := int32(0); indexQ16 < maxIndexQ16; indexQ16 += r.invRatioQ16 {
+			tableIndex := smulwb(indexQ16&0xFFFF, 12)
+			p := buf[indexQ16>>16:]
+			fir0, fir1 := &silkResamplerFracFIR12[tableIndex], &silkResamplerFracFIR12[11-tableIndex]
+			resQ15 := int32(p[0])*fir0[0] + int32(p[1])*fir0[1] + int32(p[2])*fir0[2] + int32(p[3])*fir0[3] +
+				int32(p[4])*fir1[3] + int32(p[5])*fir1[2] + int32(p[6])*fir1[1] + int32(p[7])*fir1[0]
+			out[0] = int16(sat16(rshiftRound(resQ15, 15)))
+			out = out[1:]
+		}
+		in = in[nSamplesIn:]
+		if len(in) == 0 {
+			break
+		}
+		// Copy the last part of the filtered signal to the beginning of the buffer
+		copy(buf, buf[nSamplesIn<<1:nSamplesIn<<1+resamplerOrderFIR12])
+	}
+	copy(r.sFIR[:], buf[nSamplesIn<<1:])
+}
+
+// up2HQ upsamples in by 2 into out with allpass filters, keeping the state in Q10
+func (r *silkResampler) up2HQ(out, in []int16) {
+	s := &r.sIIR
+	for k := range in {
+		in32 := int32(in[k]) << 10
+
+		// Allpass sections for the even output sample
+		y := in32 - s[0]
+		x := smulwb(y, resamplerUp2HQ0[0])
+		out1 := s[0] + x
+		s[0] = in32 + x
+
+		y = out1 - s[1]
+		x = smulwb(y, resamplerUp2HQ0[1])
+		out2 := s[1] + x
+		s[1] = out1 + x
+
+		y = out2 - s[2]
+		x = smlawb(y, y, resamplerUp2HQ0[2])
+		out1 = s[2] + x
+		s[2] = out2 + x
+
+		out[2*k] = int16(sat16(rshiftRound(out1, 10)))
+
+		// Allpass sections for the odd output sample
+		y = in32 - s[3]
+		x = smulwb(y, resamplerUp2HQ1[0])
+		out1 = s[3] + x
+		s[3] = in32 + x
+
+		y = out1 - s[4]
+		x = smulwb(y, resamplerUp2HQ1[1])
+		out2 = s[4] + x
+		s[4] = out1 + x
+
+		y = out2 - s[5]
+		x = smlawb(y, y, resamplerUp2HQ1[2])
+		out1 = s[5] + x
+		s[5] = out2 + x
+
+		out[2*k+1] = int16(sat16(rshiftRound(out1, 10)))
+	}
+}
@@ -0,0 +1,126 @@
+package opus
+
+import "math"
+
+// CELT pyramid vector quantization (RFC 6716 section 4.3.4)
+
+const pi = float32(3.141592653)
+
+func celtSqrt(x float32) float32 {
+	return float32(math.Sqrt(float64(x)))
+}
+
+func celtExp2(x float32) float32 {
+	return float32(math.Exp(0.6931471805599453094 * float64(x)))
+}
+
+func celtLog2(x float32) float32 {
+	return float32(1.442695040888963387 * math.Log(float64(x)))
+}
+
+// celtCosNorm returns cos(pi/2*x)
+func celtCosNorm(x float32) float32 {
+	return float32(math.Cos(float64(.5 * pi * x)))
+}
+
+func innerProd(x, y []float32) float32 {
+	var xy float32
+	for i := range x {
+		xy += x[i] * y[i]
+	}
+	return xy
+}
+
+// expRotation1 applies a series of 2D rotations of the pairs of samples stride apart
+func expRotation1(x []float32, stride int, c, s float32) {
+	ms := -s
+	for i := 0; i < len(x)-stride; i++ {
+		x1, x2 := x[i], x[i+stride]
+		x[i+stride] = c*x2 + s*x1
+		x[i] = c*x1 + ms*x2
+	}
+	for i := len(x) - 2*stride - 1; i >= 0; i-- {
+		x1, x2 := x[i], x[i+stride]
+		x[i+stride] = c*x2 + s*x1
+		x[i] = c*x1 + ms*x2
+	}
+}
+
+// expRotation spreads the pulses of each of the stride blocks of x, or undoes it if dir is negative
+func expRotation(x []float32, dir, stride, k, spread int) {
+	spreadFactor := [3]int{15, 10, 5}
+	n := len(x)
+	if 2*k >= n || spread == spreadNone {
+		return
+	}
+	factor := spreadFactor[spread-1]
+
+	gain := float32(n) / float32(n+factor*k)
+	theta := .5 * (gain * gain)
+	c := celtCosNorm(theta)
+	s := celtCosNorm(1 - theta)
+
+	stride2 := 0
+	if n >= 8*stride {
+		stride2 = 1
+		// sqrt(n/stride) with rounding
+		for (stride2*stride2+stride2)*stride+(stride>>2) < n {
+			stride2++
+		}
+	}
+	n = udiv(n, stride)
+	for i := 0; i < stride; i++ {
+		b := x[i*n : (i+1)*n]
+		if dir < 0 {
+			if stride2 != 0 {
+				expRotation1(b, stride2, s, c)
+			}
+			expRotation1(b, 1, c, s)
+		} else {
+			expRotation1(b, 1, c, -s)
+			if stride2 != 0 {
+				expRotation1(b, stride2, s, -c)
+			}
+		}
+	}
+}
+
+// extractCollapseMask returns a bit for each of the b blocks of iy which has a pulse
+func extractCollapseMask(iy []int, b int) uint {
+	if b <= 1 {
+		return 1
+	}
+	n0 := udiv(len(iy), b)
+	var mask uint
+	for i := 0; i < b; i++ {
+		tmp := 0
+		for j := 0; j < n0; j++ {
+			tmp |= iy[i*n0+j]
+		}
+		if tmp != 0 {
+			mask |= 1 << i
+		}
+	}
+	return mask
+}
+
+// algUnquant decodes a vector of k pulses into x, scaled to the norm gain, and returns its collapse mask
+func algUnquant(x []float32, k, spread, b int, dec *rangeDecoder, gain float32) uint {
+	iy := make([]int, len(x))
+	ryy := decodePulses(iy, len(x), k, dec)
+	g := 1 / celtSqrt(ryy) * gain
+	for i := range x {
+		x[i] = g * float32(iy[i])
+	}
+	expRotation(x, -1, b, k, spread)
+	return extractCollapseMask(iy, b)
+}
+
+// renormaliseVector scales x to the norm gain
+func renormaliseVector(x []float32, gain float32) {
+	e := epsilon + innerProd(x, x)
+	g := 1 / celtSqrt(e) * gain
+	for i := range x {
+		x[i] *= g
+	}
+}
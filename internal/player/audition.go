@@ -0,0 +1,58 @@
+package player
+
+import (
+	"fmt"
+	"time"
+)
+
+// --- Loop seam audition ---
+
+const (
+	// auditionLead is how much of the track is played before the loop seam
+	auditionLead = 3 * time.Second
+
+	// auditionFollow is how much of the loop start is played after the seam
+	auditionFollow = 2 * time.Second
+)
+
+// AuditionLoopSeam repeatedly plays a short window across the loop seam of the current track,
+// from shortly before the loop end to shortly after it wraps to the loop start, so the stitch can
+// be heard over and over. The seam is the loop region marked in the file, or the end of the track.
+//
+// The window is set as the A-B loop region, and the loop duration and loop count don't end
+// the track while auditioning. ClearLoopRegion, or loading another track, ends the audition;
+// the loop duration then starts over.
+func (p *MusicPlayer) AuditionLoopSeam() error {
+	if p.currentMusic == nil {
+		return fmt.Errorf("no music is loaded")
+	}
+	music := p.currentMusic
+	if music.loopLength <= 0 {
+		return fmt.Errorf("track is too short to audition its loop seam")
+	}
+
+	// The player position keeps increasing past the seam, so the window doesn't wrap
+	seam := music.introLength + music.loopLength
+	start := time.Duration(float64(seam-min(auditionLead, music.loopLength)) * p.playbackSpeed)
+	end := time.Duration(float64(seam+min(auditionFollow, music.loopLength)) * p.playbackSpeed)
+	if err := p.SetLoopRegion(start, end); err != nil {
+		return err
+	}
+	if err := p.Seek(start); err != nil {
+		return err
+	}
+	p.auditioning = true
+
+	if p.state == StateStopped {
+		return p.Play()
+	}
+	if p.isPaused {
+		p.TogglePause()
+	}
+	return nil
+}
+
+// IsAuditioningLoopSeam returns whether the loop seam of the current track is being auditioned
+func (p *MusicPlayer) IsAuditioningLoopSeam() bool {
+	return p.auditioning
+}
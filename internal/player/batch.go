@@ -0,0 +1,155 @@
+package player
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+)
+
+// --- Batch check ---
+
+const (
+	// batchCheckDuration is how much of each track is played to measure its level
+	batchCheckDuration = 3 * time.Second
+
+	// batchLoopMargin is how much is played on each side of the loop point to check the loop
+	batchLoopMargin = 100 * time.Millisecond
+)
+
+// BatchResult is the outcome of checking one music file with RunBatchCheck
+type BatchResult struct {
+	Path     string
+	Duration time.Duration
+	Decoded  bool    // The file decoded and a player was created for it
+	Looped   bool    // Playback continued from the loop start after the loop end
+	Peak     float64 // Peak level of the played part (0.0-1.0)
+	Clipped  bool    // A sample of the played part reached full scale; it doesn't fail the check
+	Err      error   // Why the check failed, if it did
+}
+
+// OK reports whether the file passed all checks
+func (r BatchResult) OK() bool {
+	return r.Err == nil && r.Decoded && r.Looped
+}
+
+// RunBatchCheck checks each music file without the UI: it decodes the file, plays the start of it,
+// and plays across the loop point to check that playback continues from the loop start.
+// The stream is read directly rather than through the created players, so no sound is made and
+// the check runs as fast as the files decode; NewNullPlayerFactory is enough as the factory.
+// An error is returned only if the check can't run at all; failures of single files are in their results.
+func RunBatchCheck(musicFiles []string, factory PlayerFactory) ([]BatchResult, error) {
+	if factory == nil {
+		return nil, fmt.Errorf("batch check: no player factory")
+	}
+	p, err := NewMusicPlayer(nil, factory)
+	if err != nil {
+		return nil, fmt.Errorf("batch check: %v", err)
+	}
+	defer p.Close()
+
+	results := make([]BatchResult, 0, len(musicFiles))
+	for _, path := range musicFiles {
+		results = append(results, p.checkFile(path))
+	}
+	return results, nil
+}
+
+// checkFile runs the batch checks on one file
+func (p *MusicPlayer) checkFile(path string) BatchResult {
+	result := BatchResult{Path: path}
+
+	duration, err := p.loader.GetDuration(path)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Duration = duration
+
+	audioStream, err := p.loader.LoadStream(path)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if closer, ok := audioStream.(io.Closer); ok {
+		defer closer.Close()
+	}
+	length, err := streamLength(path, audioStream)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	loopStream, introLength, loopLength, _ := p.newLoopStream(path, audioStream, length)
+
+	meter := newLevelMeter(loopStream)
+	player, err := p.playerFactory.NewPlayer(meter)
+	if err != nil {
+		result.Err = fmt.Errorf("failed to create audio player for %s: %v", path, err)
+		return result
+	}
+	defer player.Close()
+	result.Decoded = true
+
+	result.Peak, err = readPeak(meter, durationToBytes(batchCheckDuration, p.loader.sampleRate))
+	if err != nil {
+		result.Err = fmt.Errorf("failed to play %s: %v", path, err)
+		return result
+	}
+
+	result.Clipped = meter.Clipped()
+
+	result.Looped, err = checkLoop(meter, introLength, loopLength, p.loader.sampleRate)
+	if err != nil {
+		result.Err = fmt.Errorf("failed to play %s across the loop point: %v", path, err)
+	} else if !result.Looped {
+		result.Err = fmt.Errorf("playback of %s did not continue from the loop start", path)
+	}
+	return result
+}
+
+// readPeak reads n bytes from the meter and returns the highest peak level seen
+func readPeak(meter *levelMeter, n int64) (float64, error) {
+	buf := make([]byte, 4096)
+	var peak float64
+	for n > 0 {
+		chunk := buf[:min(int64(len(buf)), n)]
+		if _, err := io.ReadFull(meter, chunk); err != nil {
+			return 0, err
+		}
+		n -= int64(len(chunk))
+		level, _ := meter.Levels()
+		peak = max(peak, level)
+	}
+	return peak, nil
+}
+
+// checkLoop plays across the end of the loop and checks that it continues with the audio at the loop start.
+// The lengths are in bytes of the looping stream, which plays at rate.
+func checkLoop(stream io.ReadSeeker, introLength, loopLength int64, rate int) (bool, error) {
+	margin := min(durationToBytes(batchLoopMargin, rate), loopLength/bytesPerSample/2*bytesPerSample)
+	if margin <= 0 {
+		return false, fmt.Errorf("loop is too short: %d bytes", loopLength)
+	}
+
+	loopStart := make([]byte, margin)
+	if _, err := stream.Seek(introLength, io.SeekStart); err != nil {
+		return false, err
+	}
+	if _, err := io.ReadFull(stream, loopStart); err != nil {
+		return false, err
+	}
+
+	acrossEnd := make([]byte, margin*2)
+	if _, err := stream.Seek(introLength+loopLength-margin, io.SeekStart); err != nil {
+		return false, err
+	}
+	if _, err := io.ReadFull(stream, acrossEnd); err != nil {
+		return false, err
+	}
+	return bytes.Equal(acrossEnd[margin:], loopStart), nil
+}
+
+// durationToBytes converts a duration to a length of a stereo 16bit stream at rate
+func durationToBytes(d time.Duration, rate int) int64 {
+	return int64(d) * int64(rate) / int64(time.Second) * bytesPerSample
+}
@@ -0,0 +1,54 @@
+package player
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+)
+
+// --- Cancellation ---
+
+// contextFile is an audio file whose reads fail once ctx is done, so a decode in progress stops.
+// A decoded stream goes on reading the file, so it is detached from ctx once decoding succeeds.
+type contextFile struct {
+	f        *os.File
+	ctx      context.Context
+	detached atomic.Bool
+}
+
+// openContextFile opens the file for reading, failing if ctx is already done
+func openContextFile(ctx context.Context, path string) (*contextFile, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &contextFile{f: f, ctx: ctx}, nil
+}
+
+// Read reads from the file, or returns the context's error once it is done
+func (c *contextFile) Read(b []byte) (int, error) {
+	if !c.detached.Load() {
+		if err := c.ctx.Err(); err != nil {
+			return 0, err
+		}
+	}
+	return c.f.Read(b)
+}
+
+// Seek seeks the file
+func (c *contextFile) Seek(offset int64, whence int) (int64, error) {
+	return c.f.Seek(offset, whence)
+}
+
+// Close closes the file
+func (c *contextFile) Close() error {
+	return c.f.Close()
+}
+
+// detach makes reads ignore the context from now on
+func (c *contextFile) detach() {
+	c.detached.Store(true)
+}
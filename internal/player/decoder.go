@@ -0,0 +1,110 @@
+package player
+
+import (
+	"io"
+
+	"musicplayer/internal/aiff"
+	"musicplayer/internal/files"
+	"musicplayer/internal/flac"
+	"musicplayer/internal/opus"
+	"musicplayer/internal/wav"
+)
+
+// --- Decoder ---
+
+// Decoder decodes audio files for the loader, so playback can be driven by decoders other than
+// the built-in ones. The loader opens the files and detects their format; the decoder only turns
+// the content into samples.
+type Decoder interface {
+	// Decode decodes src, holding audio in the given format, to a 16bit little-endian stereo stream.
+	// The stream is resampled to sampleRate, or left at the file's own rate if sampleRate is 0.
+	// src is read as the stream is read, and is closed by the loader along with the stream.
+	// MP3 streams are expected to keep the encoder delay and padding; the loader trims them.
+	Decode(src io.ReadSeeker, format files.Format, sampleRate int) (DecodedStream, error)
+}
+
+// DecodedStream is a stream returned by a Decoder
+type DecodedStream interface {
+	io.ReadSeeker
+	Length() int64   // Length in bytes
+	SampleRate() int // Sample rate of the samples read
+}
+
+// DefaultDecoder returns the Decoder used unless another one is set: WAV, FLAC, AIFF and Opus are
+// decoded with the decoders in this module, which need no audio backend, and MP3 and OGG Vorbis
+// with Ebitengine's decoders. Building with the noebiten tag leaves out MP3 and OGG Vorbis, so the
+// package can be embedded without linking Ebitengine; those formats then need a decoder passed to
+// NewMusicPlayerWithDecoder or provided by the PlayerFactory.
+func DefaultDecoder() Decoder {
+	return defaultDecoder{}
+}
+
+// NewPlayerFactoryWithDecoder returns a PlayerFactory creating the players of factory, whose
+// files are decoded with decoder. The sample rate of factory is kept.
+func NewPlayerFactoryWithDecoder(factory PlayerFactory, decoder Decoder) PlayerFactory {
+	return decodingPlayerFactory{PlayerFactory: factory, decoder: decoder}
+}
+
+// decodingPlayerFactory adds a decoder to a PlayerFactory
+type decodingPlayerFactory struct {
+	PlayerFactory
+	decoder Decoder
+}
+
+// Decoder returns the decoder for the factory's players
+func (f decodingPlayerFactory) Decoder() Decoder {
+	return f.decoder
+}
+
+// SampleRate returns the sample rate of the wrapped factory
+func (f decodingPlayerFactory) SampleRate() int {
+	return factorySampleRate(f.PlayerFactory)
+}
+
+// factorySampleRate returns the rate tracks are decoded at for the players of factory
+func factorySampleRate(factory PlayerFactory) int {
+	if f, ok := factory.(interface{ SampleRate() int }); ok {
+		return f.SampleRate()
+	}
+	return DefaultSampleRate
+}
+
+// defaultDecoder is the built-in Decoder
+type defaultDecoder struct{}
+
+// Decode decodes the audio with the decoder for its format
+func (defaultDecoder) Decode(src io.ReadSeeker, format files.Format, sampleRate int) (DecodedStream, error) {
+	resample := sampleRate > 0
+	switch format {
+	case files.FormatWav:
+		if resample {
+			return decoded(wav.DecodeWithSampleRate(sampleRate, src))
+		}
+		return decoded(wav.DecodeWithoutResampling(src))
+	case files.FormatFlac:
+		if resample {
+			return decoded(flac.DecodeWithSampleRate(sampleRate, src))
+		}
+		return decoded(flac.DecodeWithoutResampling(src))
+	case files.FormatAiff:
+		if resample {
+			return decoded(aiff.DecodeWithSampleRate(sampleRate, src))
+		}
+		return decoded(aiff.DecodeWithoutResampling(src))
+	case files.FormatOpus:
+		if resample {
+			return decoded(opus.DecodeWithSampleRate(sampleRate, src))
+		}
+		return decoded(opus.DecodeWithoutResampling(src))
+	default:
+		return decodeCompressed(src, format, sampleRate)
+	}
+}
+
+// decoded returns the stream of a decoder as a DecodedStream, or only the error if decoding failed
+func decoded[S DecodedStream](stream S, err error) (DecodedStream, error) {
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
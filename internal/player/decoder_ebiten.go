@@ -0,0 +1,33 @@
+//go:build !noebiten
+
+package player
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/hajimehoshi/ebiten/v2/audio/mp3"
+	"github.com/hajimehoshi/ebiten/v2/audio/vorbis"
+
+	"musicplayer/internal/files"
+)
+
+// decodeCompressed decodes MP3 and OGG Vorbis with Ebitengine's decoders.
+// Building with the noebiten tag leaves them out, so the package doesn't link Ebitengine.
+func decodeCompressed(src io.ReadSeeker, format files.Format, sampleRate int) (DecodedStream, error) {
+	resample := sampleRate > 0
+	switch format {
+	case files.FormatOgg:
+		if resample {
+			return decoded(vorbis.DecodeWithSampleRate(sampleRate, src))
+		}
+		return decoded(vorbis.DecodeWithoutResampling(src))
+	case files.FormatMp3:
+		if resample {
+			return decoded(mp3.DecodeWithSampleRate(sampleRate, src))
+		}
+		return decoded(mp3.DecodeWithoutResampling(src))
+	default:
+		return nil, fmt.Errorf("unsupported audio format: %s", format)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !noebiten
+
+package player_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"musicplayer/internal/player"
+)
+
+func TestDefaultDecoder_Mp3(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "track.mp3")
+	if err := WriteTestMp3(path, 20, 576, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	// MP3 decodes without a decoder being set, trimmed of the header frame, the encoder delay and the padding
+	stream, err := player.NewMusicLoader().LoadStream(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.(interface{ Close() error }).Close()
+	if length, want := stream.(interface{ Length() int64 }).Length(), int64(20*1152-576-1000)*4; length != want {
+		t.Errorf("Expected %d samples, got %d", want/4, length/4)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build noebiten
+
+package player
+
+import (
+	"fmt"
+	"io"
+
+	"musicplayer/internal/files"
+)
+
+// decodeCompressed supports no format without Ebitengine; MP3 and OGG Vorbis need a decoder
+// passed to NewMusicPlayerWithDecoder or provided by the PlayerFactory, such as the ebitenaudio one.
+func decodeCompressed(src io.ReadSeeker, format files.Format, sampleRate int) (DecodedStream, error) {
+	return nil, fmt.Errorf("unsupported audio format: %s", format)
+}
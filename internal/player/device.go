@@ -0,0 +1,14 @@
+package player
+
+// --- Output devices ---
+
+// DefaultOutputDevice is the name of the system's default audio output device
+const DefaultOutputDevice = "default"
+
+// ListOutputDevices returns the names of the audio output devices sound can be played through.
+// It is a placeholder that enumerates nothing: Ebiten's audio context, through oto, always opens
+// the system's default device and can neither list nor open others, so DefaultOutputDevice is
+// the only name returned on every platform, and no device can be chosen until that changes.
+func ListOutputDevices() ([]string, error) {
+	return []string{DefaultOutputDevice}, nil
+}
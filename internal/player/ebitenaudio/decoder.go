@@ -0,0 +1,45 @@
+// Package ebitenaudio decodes MP3 and OGG Vorbis with Ebitengine's decoders. The player package's
+// DefaultDecoder does the same unless it is built with the noebiten tag; this package is for
+// programs that build the player that way but still decode those formats with Ebitengine.
+package ebitenaudio
+
+import (
+	"io"
+
+	"github.com/hajimehoshi/ebiten/v2/audio/mp3"
+	"github.com/hajimehoshi/ebiten/v2/audio/vorbis"
+
+	"musicplayer/internal/files"
+	"musicplayer/internal/player"
+)
+
+// Decoder is a player.Decoder decoding MP3 and OGG Vorbis with Ebitengine's decoders.
+// Other formats are decoded with player.DefaultDecoder.
+type Decoder struct{}
+
+// Decode decodes the audio with the decoder for its format
+func (Decoder) Decode(src io.ReadSeeker, format files.Format, sampleRate int) (player.DecodedStream, error) {
+	resample := sampleRate > 0
+	switch format {
+	case files.FormatOgg:
+		if resample {
+			return decoded(vorbis.DecodeWithSampleRate(sampleRate, src))
+		}
+		return decoded(vorbis.DecodeWithoutResampling(src))
+	case files.FormatMp3:
+		if resample {
+			return decoded(mp3.DecodeWithSampleRate(sampleRate, src))
+		}
+		return decoded(mp3.DecodeWithoutResampling(src))
+	default:
+		return player.DefaultDecoder().Decode(src, format, sampleRate)
+	}
+}
+
+// decoded returns the stream of a decoder as a player.DecodedStream, or only the error if decoding failed
+func decoded[S player.DecodedStream](stream S, err error) (player.DecodedStream, error) {
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
@@ -0,0 +1,86 @@
+package ebitenaudio_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"musicplayer/internal/files"
+	"musicplayer/internal/player"
+	"musicplayer/internal/player/ebitenaudio"
+)
+
+// writeSilentMp3 writes a silent MPEG-1 Layer III 48kHz stereo MP3 file of frames frames of 1152
+// samples, after a LAME Info header recording the encoder delay and padding
+func writeSilentMp3(path string, frames, delay, padding int) error {
+	const frameSize = 384 // 128kbps at 48kHz
+	frame := func() []byte {
+		b := make([]byte, frameSize)
+		copy(b, []byte{0xff, 0xfb, 0x94, 0x00})
+		return b
+	}
+
+	info := frame()
+	offset := 4 + 32 // After the side information
+	copy(info[offset:], "Info")
+	binary.BigEndian.PutUint32(info[offset+4:], 0x1) // Frame count only
+	binary.BigEndian.PutUint32(info[offset+8:], uint32(frames))
+	offset += 12
+	copy(info[offset:], "LAME3.100")
+	info[offset+21] = byte(delay >> 4)
+	info[offset+22] = byte(delay<<4) | byte(padding>>8)
+	info[offset+23] = byte(padding)
+
+	data := info
+	for range frames {
+		data = append(data, frame()...)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func TestDecoder_Mp3(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "track.mp3")
+	if err := writeSilentMp3(path, 20, 576, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	// The loader trims the header frame, the encoder delay and the padding from the decoded stream
+	loader := player.NewMusicLoader()
+	loader.SetDecoder(ebitenaudio.Decoder{})
+	stream, err := loader.LoadStream(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.(interface{ Close() error }).Close()
+	if length, want := stream.(interface{ Length() int64 }).Length(), int64(20*1152-576-1000)*4; length != want {
+		t.Errorf("Expected %d samples, got %d", want/4, length/4)
+	}
+}
+
+func TestDecoder_OtherFormats(t *testing.T) {
+	// Formats Ebitengine isn't needed for are left to the player's own decoders
+	var wav bytes.Buffer
+	wav.WriteString("RIFF")
+	binary.Write(&wav, binary.LittleEndian, uint32(36+400))
+	wav.WriteString("WAVEfmt ")
+	for _, v := range []any{uint32(16), uint16(1), uint16(2), uint32(48000), uint32(48000 * 4), uint16(4), uint16(16)} {
+		binary.Write(&wav, binary.LittleEndian, v) // PCM, stereo, 16bit
+	}
+	wav.WriteString("data")
+	binary.Write(&wav, binary.LittleEndian, uint32(400))
+	wav.Write(make([]byte, 400))
+
+	stream, err := ebitenaudio.Decoder{}.Decode(bytes.NewReader(wav.Bytes()), files.FormatWav, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stream.Length() != 400 || stream.SampleRate() != 48000 {
+		t.Errorf("Expected 400 bytes at 48000 Hz, got %d bytes at %d Hz", stream.Length(), stream.SampleRate())
+	}
+
+	if _, err := (ebitenaudio.Decoder{}).Decode(bytes.NewReader(nil), files.FormatOpus, 0); err == nil {
+		t.Error("Expected an empty Opus stream to fail to decode")
+	}
+}
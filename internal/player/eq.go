@@ -0,0 +1,196 @@
+package player
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"sync"
+)
+
+// --- Shelf EQ ---
+
+// The shelves of the preview EQ, and how far they can be turned up or down
+const (
+	eqLowShelfFrequency  = 200.0  // In Hz
+	eqHighShelfFrequency = 4000.0 // In Hz
+	MaxEQGainDB          = 12.0
+)
+
+// biquad is a second-order IIR filter, run in direct form I on both channels of a stereo stream
+type biquad struct {
+	b0, b1, b2, a1, a2 float64 // Coefficients, normalized so a0 is 1
+	x1, x2, y1, y2     [2]float64
+}
+
+// lowShelf returns a filter boosting or cutting below freq by gainDB, after the Audio EQ Cookbook
+func lowShelf(freq, gainDB float64, sampleRate int) biquad {
+	a, cosW, alpha := shelfParameters(freq, gainDB, sampleRate)
+	sqrtA2Alpha := 2 * math.Sqrt(a) * alpha
+	a0 := (a + 1) + (a-1)*cosW + sqrtA2Alpha
+	return biquad{
+		b0: a * ((a + 1) - (a-1)*cosW + sqrtA2Alpha) / a0,
+		b1: 2 * a * ((a - 1) - (a+1)*cosW) / a0,
+		b2: a * ((a + 1) - (a-1)*cosW - sqrtA2Alpha) / a0,
+		a1: -2 * ((a - 1) + (a+1)*cosW) / a0,
+		a2: ((a + 1) + (a-1)*cosW - sqrtA2Alpha) / a0,
+	}
+}
+
+// highShelf returns a filter boosting or cutting above freq by gainDB, after the Audio EQ Cookbook
+func highShelf(freq, gainDB float64, sampleRate int) biquad {
+	a, cosW, alpha := shelfParameters(freq, gainDB, sampleRate)
+	sqrtA2Alpha := 2 * math.Sqrt(a) * alpha
+	a0 := (a + 1) - (a-1)*cosW + sqrtA2Alpha
+	return biquad{
+		b0: a * ((a + 1) + (a-1)*cosW + sqrtA2Alpha) / a0,
+		b1: -2 * a * ((a - 1) + (a+1)*cosW) / a0,
+		b2: a * ((a + 1) + (a-1)*cosW - sqrtA2Alpha) / a0,
+		a1: 2 * ((a - 1) - (a+1)*cosW) / a0,
+		a2: ((a + 1) - (a-1)*cosW - sqrtA2Alpha) / a0,
+	}
+}
+
+// shelfParameters returns the amplitude, cos(w0) and alpha of a shelf with a slope of 1.
+// The frequency is kept below the Nyquist frequency, so low sample rates don't make the filter unstable.
+func shelfParameters(freq, gainDB float64, sampleRate int) (a, cosW, alpha float64) {
+	freq = min(freq, 0.45*float64(sampleRate))
+	w0 := 2 * math.Pi * freq / float64(sampleRate)
+	return math.Pow(10, gainDB/40), math.Cos(w0), math.Sin(w0) / math.Sqrt2
+}
+
+// process filters a sample of the given channel
+func (f *biquad) process(channel int, x float64) float64 {
+	y := f.b0*x + f.b1*f.x1[channel] + f.b2*f.x2[channel] - f.a1*f.y1[channel] - f.a2*f.y2[channel]
+	f.x2[channel], f.x1[channel] = f.x1[channel], x
+	f.y2[channel], f.y1[channel] = f.y1[channel], y
+	return y
+}
+
+// reset clears the filter's history, e.g. after seeking
+func (f *biquad) reset() {
+	f.x1, f.x2, f.y1, f.y2 = [2]float64{}, [2]float64{}, [2]float64{}, [2]float64{}
+}
+
+// shelfEQ passes a 16bit stereo stream through a low and a high shelf.
+// The audio player reads from its own goroutine, so the settings are guarded by a mutex.
+// Settings take effect from the next read of the stream.
+type shelfEQ struct {
+	frames     frameReader
+	sampleRate int
+	low, high  biquad // Used by the reading goroutine only
+
+	mu          sync.Mutex
+	enabled     bool
+	lowGainDB   float64
+	highGainDB  float64
+	changed     bool // Whether the filters need new coefficients
+	wasFiltered bool // Whether the last read was filtered, so the history is cleared when bypassing
+}
+
+// newShelfEQ wraps a stream at sampleRate for equalizing. It is enabled, with both shelves flat.
+func newShelfEQ(src io.ReadSeeker, sampleRate int) *shelfEQ {
+	return &shelfEQ{frames: frameReader{src: src}, sampleRate: sampleRate, enabled: true}
+}
+
+// SetGains sets the gains of the low and high shelf in dB
+func (e *shelfEQ) SetGains(lowGainDB, highGainDB float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lowGainDB, e.highGainDB = lowGainDB, highGainDB
+	e.changed = true
+}
+
+// SetEnabled sets whether the stream is equalized or passed through unchanged
+func (e *shelfEQ) SetEnabled(enabled bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.enabled = enabled
+}
+
+// Read reads whole sample frames from the stream, equalizes them and returns them
+func (e *shelfEQ) Read(b []byte) (int, error) {
+	return e.frames.read(b, e.equalize)
+}
+
+// Seek seeks the stream, dropping equalized frames that weren't read yet.
+// The filters start over, so they don't ring with audio from before the seek.
+func (e *shelfEQ) Seek(offset int64, whence int) (int64, error) {
+	e.low.reset()
+	e.high.reset()
+	return e.frames.seek(offset, whence)
+}
+
+// equalize applies the shelves to little-endian 16bit stereo frames in place
+func (e *shelfEQ) equalize(data []byte) {
+	e.mu.Lock()
+	enabled := e.enabled && (e.lowGainDB != 0 || e.highGainDB != 0)
+	if e.changed {
+		low := lowShelf(eqLowShelfFrequency, e.lowGainDB, e.sampleRate)
+		high := highShelf(eqHighShelfFrequency, e.highGainDB, e.sampleRate)
+		// The history is kept, so changing the gains while playing doesn't click
+		low.x1, low.x2, low.y1, low.y2 = e.low.x1, e.low.x2, e.low.y1, e.low.y2
+		high.x1, high.x2, high.y1, high.y2 = e.high.x1, e.high.x2, e.high.y1, e.high.y2
+		e.low, e.high = low, high
+		e.changed = false
+	}
+	if !enabled && e.wasFiltered {
+		e.low.reset()
+		e.high.reset()
+	}
+	e.wasFiltered = enabled
+	e.mu.Unlock()
+	if !enabled {
+		return
+	}
+
+	for i := 0; i+bytesPerSample <= len(data); i += bytesPerSample {
+		for channel := range 2 {
+			offset := i + channel*2
+			x := float64(int16(binary.LittleEndian.Uint16(data[offset:])))
+			y := e.high.process(channel, e.low.process(channel, x))
+			y = max(math.MinInt16, min(math.Round(y), math.MaxInt16))
+			binary.LittleEndian.PutUint16(data[offset:], uint16(int16(y)))
+		}
+	}
+}
+
+// SetEQ sets the gains of the preview EQ in dB: a low shelf below 200Hz and a high shelf above 4kHz,
+// to check how a track sits with a tweak. They are clamped to ±MaxEQGainDB and apply to every
+// track until changed. 0 leaves a band as it is.
+func (p *MusicPlayer) SetEQ(lowGainDB, highGainDB float64) {
+	p.eqLowGainDB = max(-MaxEQGainDB, min(lowGainDB, MaxEQGainDB))
+	p.eqHighGainDB = max(-MaxEQGainDB, min(highGainDB, MaxEQGainDB))
+	p.applyEQ()
+}
+
+// GetEQ returns the gains of the low and high shelf of the preview EQ in dB
+func (p *MusicPlayer) GetEQ() (lowGainDB, highGainDB float64) {
+	return p.eqLowGainDB, p.eqHighGainDB
+}
+
+// SetEQEnabled sets whether the preview EQ is applied, so the track can be compared with and
+// without it. The gains are kept while it is bypassed. It is enabled by default.
+func (p *MusicPlayer) SetEQEnabled(enabled bool) {
+	p.eqBypassed = !enabled
+	p.applyEQ()
+}
+
+// IsEQEnabled returns whether the preview EQ is applied
+func (p *MusicPlayer) IsEQEnabled() bool {
+	return !p.eqBypassed
+}
+
+// applyEQ applies the EQ settings to the loaded tracks
+func (p *MusicPlayer) applyEQ() {
+	for _, music := range []*Music{p.currentMusic, p.nextMusic} {
+		if music != nil && music.eq != nil {
+			p.configureEQ(music.eq)
+		}
+	}
+}
+
+// configureEQ applies the EQ settings to a track's EQ
+func (p *MusicPlayer) configureEQ(eq *shelfEQ) {
+	eq.SetGains(p.eqLowGainDB, p.eqHighGainDB)
+	eq.SetEnabled(!p.eqBypassed)
+}
@@ -0,0 +1,64 @@
+package player
+
+import (
+	"maps"
+	"path/filepath"
+	"slices"
+)
+
+// --- Favorites ---
+
+// Favorites are keyed like notes, by path relative to the music directory, so they stay
+// attached to their tracks when the directories move.
+
+// ToggleFavorite flags or unflags the track at path as a favorite and returns whether it is now flagged
+func (p *MusicPlayer) ToggleFavorite(path string) bool {
+	if path == "" {
+		return false
+	}
+	key := p.noteKey(path)
+	if p.favorites[key] {
+		delete(p.favorites, key)
+		return false
+	}
+	if p.favorites == nil {
+		p.favorites = make(map[string]bool)
+	}
+	p.favorites[key] = true
+	return true
+}
+
+// IsFavorite returns whether the track at path is flagged as a favorite
+func (p *MusicPlayer) IsFavorite(path string) bool {
+	if path == "" {
+		return false
+	}
+	return p.favorites[p.noteKey(path)]
+}
+
+// GetFavorites returns the favorite tracks by path relative to the music directory, in sorted
+// order, or nil if there are none. Tracks outside the music directories are listed by full path.
+func (p *MusicPlayer) GetFavorites() []string {
+	if len(p.favorites) == 0 {
+		return nil
+	}
+	return slices.Sorted(maps.Keys(p.favorites))
+}
+
+// setFavorites replaces the favorite tracks, given by relative path. Full paths, as settings of
+// earlier versions hold, are converted to relative paths under the music directories.
+func (p *MusicPlayer) setFavorites(paths []string) {
+	p.favorites = nil
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if filepath.IsAbs(filepath.FromSlash(path)) {
+			path = p.noteKey(filepath.FromSlash(path))
+		}
+		if p.favorites == nil {
+			p.favorites = make(map[string]bool)
+		}
+		p.favorites[path] = true
+	}
+}
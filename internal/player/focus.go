@@ -0,0 +1,37 @@
+package player
+
+// --- Pause on focus loss ---
+
+// IsPauseOnFocusLoss returns whether playback pauses while the window doesn't have focus
+func (p *MusicPlayer) IsPauseOnFocusLoss() bool {
+	return p.pauseOnFocusLoss
+}
+
+// SetPauseOnFocusLoss sets whether playback pauses while the window doesn't have focus.
+// The focus is reported with SetWindowFocused.
+func (p *MusicPlayer) SetPauseOnFocusLoss(enabled bool) {
+	p.pauseOnFocusLoss = enabled
+}
+
+// SetWindowFocused reports whether the window has focus; call it every frame.
+// With pause on focus loss enabled, losing focus pauses playback and regaining it resumes,
+// but a track the user paused stays paused.
+func (p *MusicPlayer) SetWindowFocused(focused bool) {
+	// Only the moment focus is lost pauses, so the user can still resume while unfocused
+	lostFocus := !focused && !p.unfocused
+	p.unfocused = !focused
+	if !focused {
+		if lostFocus && p.pauseOnFocusLoss && !p.isPaused && p.currentMusic != nil && p.state != StateStopped {
+			p.togglePause()
+			p.autoPaused = true
+		}
+		return
+	}
+
+	if p.autoPaused {
+		p.autoPaused = false
+		if p.isPaused {
+			p.togglePause()
+		}
+	}
+}
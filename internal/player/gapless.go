@@ -0,0 +1,197 @@
+package player
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"musicplayer/internal/files"
+)
+
+// --- MP3 gapless trimming ---
+
+// mp3DecoderDelay is the delay in samples added by the MP3 synthesis filterbank on top of the encoder delay
+const mp3DecoderDelay = 529
+
+// mp3EncoderTags are the encoder names whose Info/Xing header carries the LAME extension with the encoder delay
+var mp3EncoderTags = [][]byte{[]byte("LAME"), []byte("Lavc"), []byte("Lavf")}
+
+// mp3Gapless is how much silence an MP3 encoder added around the audio, from the LAME header.
+// The counts are samples per channel at the file's sample rate, relative to the decoded stream.
+type mp3Gapless struct {
+	sampleRate int
+	skip       int // Samples to drop from the start: the header frame, the encoder and the decoder delay
+	trim       int // Samples to drop from the end
+}
+
+// readMp3Gapless reads the LAME header in the first frame of an MP3 file.
+// It returns false if the file has none.
+func readMp3Gapless(r io.Reader) (mp3Gapless, bool) {
+	br := bufio.NewReader(r)
+	if err := skipID3v2(br); err != nil {
+		return mp3Gapless{}, false
+	}
+	header, err := findMp3FrameHeader(br)
+	if err != nil {
+		return mp3Gapless{}, false
+	}
+
+	// Only Layer III has the header
+	if header[1]>>1&0x3 != 1 {
+		return mp3Gapless{}, false
+	}
+	version := header[1] >> 3 & 0x3
+	mono := header[3]>>6 == 3
+	g := mp3Gapless{sampleRate: mp3SampleRates[header[2]>>2&0x3]}
+	frameSamples, sideInfo := 1152, 32
+	switch {
+	case version == 3 && mono: // MPEG-1
+		sideInfo = 17
+	case version != 3:
+		g.sampleRate /= 2
+		if version == 0 { // MPEG-2.5
+			g.sampleRate /= 2
+		}
+		frameSamples, sideInfo = 576, 17
+		if mono {
+			sideInfo = 9
+		}
+	}
+
+	// The Info/Xing header follows the side information; its flags tell which optional fields are present
+	data, _ := br.Peek(512)
+	offset := 4 + sideInfo
+	if header[1]&1 == 0 {
+		offset += 2 // The CRC follows the header when the protection bit is clear
+	}
+	if len(data) < offset+8 {
+		return mp3Gapless{}, false
+	}
+	if tag := data[offset : offset+4]; !bytes.Equal(tag, []byte("Info")) && !bytes.Equal(tag, []byte("Xing")) {
+		return mp3Gapless{}, false
+	}
+	flags := binary.BigEndian.Uint32(data[offset+4 : offset+8])
+	offset += 8
+	for _, field := range []struct {
+		flag uint32
+		size int
+	}{{0x1, 4}, {0x2, 4}, {0x4, 100}, {0x8, 4}} { // Frames, bytes, seek table, quality
+		if flags&field.flag != 0 {
+			offset += field.size
+		}
+	}
+
+	// LAME extension: encoder (9 bytes), revision, lowpass, ReplayGain (8 bytes), flags, bitrate,
+	// then the encoder delay and padding as two 12-bit numbers
+	if len(data) < offset+24 {
+		return mp3Gapless{}, false
+	}
+	known := false
+	for _, encoder := range mp3EncoderTags {
+		known = known || bytes.HasPrefix(data[offset:], encoder)
+	}
+	if !known {
+		return mp3Gapless{}, false
+	}
+	b := data[offset+21 : offset+24]
+	delay := int(b[0])<<4 | int(b[1])>>4
+	padding := int(b[1]&0x0f)<<8 | int(b[2])
+
+	// The header frame itself decodes to a frame of silence
+	g.skip = frameSamples + delay + mp3DecoderDelay
+	g.trim = max(padding-mp3DecoderDelay, 0)
+	return g, true
+}
+
+// window returns the start and length in bytes of the audio without the encoder's silence,
+// in a decoded stream of length bytes at rate. It returns false if nothing would be left.
+func (g mp3Gapless) window(rate int, length int64) (int64, int64, bool) {
+	toBytes := func(samples int) int64 {
+		return int64(samples) * int64(rate) / int64(g.sampleRate) * bytesPerSample
+	}
+	start, end := toBytes(g.skip), length-toBytes(g.trim)
+	if g.sampleRate <= 0 || end <= start {
+		return 0, length, false
+	}
+	return start, end - start, true
+}
+
+// decodeMp3 decodes an MP3 file with the decoder at rate, or at its own sample rate if rate is 0.
+// The encoder delay and padding recorded in the LAME header are trimmed, so loops are gapless.
+// Files without the header are decoded untrimmed.
+func decodeMp3(decoder Decoder, f io.ReadSeeker, rate int) (DecodedStream, error) {
+	gapless, hasGapless := readMp3Gapless(f)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind: %v", err)
+	}
+
+	stream, err := decoder.Decode(f, files.FormatMp3, rate)
+	if err != nil || !hasGapless {
+		return stream, err
+	}
+	start, length, _ := gapless.window(stream.SampleRate(), stream.Length())
+	return newTrimmedStream(stream, stream.SampleRate(), start, length)
+}
+
+// trimmedStream is a part of a decoded stream, read as if it were the whole stream
+type trimmedStream struct {
+	src        io.ReadSeeker
+	sampleRate int
+	start      int64 // Offset of the part in src, in bytes
+	length     int64 // Length of the part in bytes
+	pos        int64 // Position within the part
+}
+
+// newTrimmedStream returns the part of src starting at start, length bytes long
+func newTrimmedStream(src io.ReadSeeker, sampleRate int, start, length int64) (*trimmedStream, error) {
+	if _, err := src.Seek(start, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek: %v", err)
+	}
+	return &trimmedStream{src: src, sampleRate: sampleRate, start: start, length: length}, nil
+}
+
+// Read reads from the part, returning io.EOF at its end
+func (s *trimmedStream) Read(buf []byte) (int, error) {
+	if s.pos >= s.length {
+		return 0, io.EOF
+	}
+	if remaining := s.length - s.pos; int64(len(buf)) > remaining {
+		buf = buf[:remaining]
+	}
+	n, err := s.src.Read(buf)
+	s.pos += int64(n)
+	return n, err
+}
+
+// Seek seeks within the part
+func (s *trimmedStream) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.length
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative position: %d", offset)
+	}
+	if _, err := s.src.Seek(s.start+offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	s.pos = offset
+	return offset, nil
+}
+
+// Length returns the length of the part in bytes
+func (s *trimmedStream) Length() int64 {
+	return s.length
+}
+
+// SampleRate returns the sample rate of the stream
+func (s *trimmedStream) SampleRate() int {
+	return s.sampleRate
+}
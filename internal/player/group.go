@@ -0,0 +1,61 @@
+package player
+
+import (
+	"fmt"
+	"slices"
+
+	"musicplayer/internal/files"
+)
+
+// --- Subdirectory groups ---
+
+// GetGroups returns the groups of the full music list: the immediate subdirectories under
+// the music directories set with SetMusicDirectories, with files directly in them as files.RootGroup
+func (p *MusicPlayer) GetGroups() []string {
+	return files.GroupNames(files.GroupMusicFiles(p.allFiles, p.musicDirs...))
+}
+
+// GetGroup returns the group the music list is limited to, or an empty string if every file is listed
+func (p *MusicPlayer) GetGroup() string {
+	return p.group
+}
+
+// SetGroup limits the music list to the files in a group, or lists every file again if group is empty.
+// The playing track is closed if it is not in the group.
+func (p *MusicPlayer) SetGroup(group string) error {
+	if group != "" && !slices.Contains(p.GetGroups(), group) {
+		return fmt.Errorf("no music files in group %s", group)
+	}
+	p.group = group
+	p.applyMusicFiles(p.groupFiles())
+	return nil
+}
+
+// CycleGroup limits the music list to the next group, going from every file through each group in turn
+func (p *MusicPlayer) CycleGroup() error {
+	groups := p.GetGroups()
+	next := ""
+	if i := slices.Index(groups, p.group); i < 0 {
+		if len(groups) > 0 {
+			next = groups[0]
+		}
+	} else if i+1 < len(groups) {
+		next = groups[i+1]
+	}
+	return p.SetGroup(next)
+}
+
+// groupFiles returns the files of the full list in the chosen group.
+// If the group has no files left, the choice is dropped and every file is returned.
+func (p *MusicPlayer) groupFiles() []string {
+	if p.group == "" {
+		return p.allFiles
+	}
+	groupFiles := files.GroupMusicFiles(p.allFiles, p.musicDirs...)[p.group]
+	if len(groupFiles) == 0 {
+		p.logger.Info("Group %s has no music files left, listing every file", p.group)
+		p.group = ""
+		return p.allFiles
+	}
+	return groupFiles
+}
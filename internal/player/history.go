@@ -0,0 +1,51 @@
+package player
+
+import (
+	"fmt"
+	"slices"
+)
+
+// --- History ---
+
+// maxHistoryLength is how many recently played tracks are remembered
+const maxHistoryLength = 100
+
+// recordHistory adds a track that started playing to the history.
+// A track restarting, e.g. with RepeatOne, is recorded once.
+func (p *MusicPlayer) recordHistory(path string) {
+	if len(p.history) > 0 && p.history[len(p.history)-1] == path {
+		return
+	}
+	p.history = append(p.history, path)
+	if len(p.history) > maxHistoryLength {
+		p.history = slices.Delete(p.history, 0, len(p.history)-maxHistoryLength)
+	}
+}
+
+// GetHistory returns the recently played tracks, oldest first; the last one is the current track.
+func (p *MusicPlayer) GetHistory() []string {
+	return slices.Clone(p.history)
+}
+
+// GoBackInHistory plays the track that was played before the current one, regardless of the
+// list order or shuffle. Tracks no longer in the list are skipped.
+// It returns an error if there is no earlier track to go back to.
+func (p *MusicPlayer) GoBackInHistory() error {
+	defer p.dispatchEvents()
+
+	musicFiles := p.selector.Files()
+	for i := len(p.history) - 2; i >= 0; i-- {
+		index := slices.Index(musicFiles, p.history[i])
+		if index < 0 {
+			continue
+		}
+
+		// Loading the track records it again
+		p.history = p.history[:i]
+		if err := p.selector.SelectIndex(index); err != nil {
+			return err
+		}
+		return p.loadCurrentMusic()
+	}
+	return fmt.Errorf("no earlier track in the history")
+}
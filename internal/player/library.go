@@ -0,0 +1,154 @@
+package player
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// --- Library summary ---
+
+// GetLibrarySummary returns the number of tracks in the list and their total duration.
+// Durations that aren't known yet are computed in the background, so for a large library
+// the total grows over later calls instead of blocking. Files that fail to decode are
+// counted but left out of the total.
+func (p *MusicPlayer) GetLibrarySummary() (count int, total time.Duration) {
+	musicFiles := p.selector.Files()
+	total, missing := p.loader.cachedTotalDuration(musicFiles)
+	if len(missing) > 0 {
+		p.loader.computeDurations(missing)
+	}
+	return len(musicFiles), total
+}
+
+// cachedTotalDuration sums the cached durations of the given files, returning the files
+// whose durations haven't been computed yet.
+// The files aren't checked for changes, so this is cheap enough to call every frame.
+func (l *MusicLoader) cachedTotalDuration(paths []string) (total time.Duration, missing []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, path := range paths {
+		entry, ok := l.durations[path]
+		if !ok {
+			missing = append(missing, path)
+			continue
+		}
+		if entry.err == nil {
+			total += entry.duration
+		}
+	}
+	return total, missing
+}
+
+// computeDurations computes and caches the durations of the given files in the background,
+// on the probe worker pool. It does nothing while a previous batch is still being computed.
+func (l *MusicLoader) computeDurations(paths []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.computingDurations {
+		return
+	}
+	l.computingDurations = true
+	concurrency := l.probeConcurrency
+
+	go func() {
+		for result := range l.ProbeLibrary(context.Background(), paths, concurrency) {
+			// Decoding failures are cached and reported where the file is played
+			if result.Err != nil {
+				l.mu.Lock()
+				if _, ok := l.durations[result.Path]; !ok {
+					// The file couldn't be read at all; GetDuration retries once it can be
+					l.durations[result.Path] = durationCacheEntry{err: result.Err}
+					l.durationsVersion++
+				}
+				l.mu.Unlock()
+			}
+		}
+		l.mu.Lock()
+		l.computingDurations = false
+		l.mu.Unlock()
+	}()
+}
+
+// --- Library probing ---
+
+// ProbeResult is the outcome of probing one file of the library.
+// Info is nil when the headers couldn't be read; Err is the first error of the two steps.
+type ProbeResult struct {
+	Path     string
+	Info     *AudioInfo
+	Duration time.Duration
+	Err      error
+}
+
+// ProbeLibrary reads the audio info and the duration of each file on a pool of concurrency workers,
+// sending the results as they complete, in no particular order. Each worker probes one file at a time,
+// so concurrency also caps the open file descriptors; 0 or less uses one worker per CPU.
+// The channel is closed once every file is probed, or once ctx is done.
+// Durations are cached like GetDuration's.
+func (l *MusicLoader) ProbeLibrary(ctx context.Context, paths []string, concurrency int) <-chan ProbeResult {
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+	concurrency = min(concurrency, max(len(paths), 1))
+
+	jobs := make(chan string)
+	results := make(chan ProbeResult)
+	go func() {
+		defer close(jobs)
+		for _, path := range paths {
+			select {
+			case jobs <- path:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for range concurrency {
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				result := ProbeResult{Path: path}
+				result.Info, result.Err = l.Probe(path)
+				duration, err := l.GetDurationContext(ctx, path)
+				if result.Err == nil {
+					result.Duration, result.Err = duration, err
+				}
+				select {
+				case results <- result:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// SetProbeConcurrency sets how many files the library is probed in parallel, for the durations
+// of the library summary; 0 or less uses one worker per CPU, the default.
+func (l *MusicLoader) SetProbeConcurrency(concurrency int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.probeConcurrency = concurrency
+}
+
+// getProbeConcurrency returns the number of workers the library is probed with
+func (l *MusicLoader) getProbeConcurrency() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.probeConcurrency
+}
+
+// SetProbeConcurrency sets how many files the library is probed in parallel; see MusicLoader.SetProbeConcurrency
+func (p *MusicPlayer) SetProbeConcurrency(concurrency int) {
+	p.loader.SetProbeConcurrency(concurrency)
+}
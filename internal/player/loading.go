@@ -0,0 +1,112 @@
+package player
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// --- Background loading ---
+
+// pendingLoad is a track being decoded in the background
+type pendingLoad struct {
+	path   string
+	done   chan struct{}      // Closed once the stream is decoded
+	cancel context.CancelFunc // Stops decoding when the load is discarded
+
+	mu        sync.Mutex
+	stream    io.ReadSeeker
+	err       error
+	finished  bool
+	discarded bool // Nobody takes the stream any more, so it is closed once decoded
+}
+
+// SetBackgroundLoading sets whether tracks are decoded on a background goroutine, so decoding
+// a large file doesn't stall the caller. While a track loads the state is StateLoading,
+// and Update starts it once it is ready. Load errors are then reported through the OnLoadError
+// callback and GetLastError rather than returned. It is off by default.
+func (p *MusicPlayer) SetBackgroundLoading(enabled bool) {
+	p.backgroundLoading = enabled
+}
+
+// IsBackgroundLoading returns whether tracks are decoded on a background goroutine
+func (p *MusicPlayer) IsBackgroundLoading() bool {
+	return p.backgroundLoading
+}
+
+// startLoad starts decoding the track at path in the background, superseding any load in flight
+func (p *MusicPlayer) startLoad(path string) {
+	p.discardLoad()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	load := &pendingLoad{path: path, done: make(chan struct{}), cancel: cancel}
+	normalize := p.normalize
+	p.loading = load
+	p.loads.Add(1)
+	go func() {
+		defer p.loads.Done()
+		defer close(load.done)
+
+		stream, err := p.loader.LoadStreamContext(ctx, path)
+		if err == nil && normalize {
+			// Compute the peak for the normalization gain here rather than after the track starts
+			p.loader.ComputePeak(ctx, path)
+		}
+
+		load.mu.Lock()
+		defer load.mu.Unlock()
+		load.stream, load.err, load.finished = stream, err, true
+		if load.discarded {
+			closeStream(stream)
+		}
+	}()
+
+	p.counter = 0
+	p.isPaused = false
+	p.setState(StateLoading)
+}
+
+// finishLoad starts the track loaded in the background once it is decoded
+func (p *MusicPlayer) finishLoad() {
+	load := p.loading
+	if load == nil {
+		return
+	}
+	select {
+	case <-load.done:
+	default:
+		return
+	}
+	p.loading = nil
+	load.cancel()
+
+	music, audioStream, err := p.wrapStream(load.path, load.stream, load.err)
+	if err := p.startMusic(load.path, music, audioStream, err); err != nil {
+		p.logger.Error("Failed to load music: %v", err)
+	}
+}
+
+// discardLoad drops the track being loaded in the background, if any.
+// Decoding is cancelled, and a stream that was decoded anyway is closed.
+func (p *MusicPlayer) discardLoad() {
+	load := p.loading
+	if load == nil {
+		return
+	}
+	p.loading = nil
+	load.cancel()
+
+	load.mu.Lock()
+	defer load.mu.Unlock()
+	load.discarded = true
+	if load.finished {
+		closeStream(load.stream)
+	}
+}
+
+// closeStream closes a decoded stream if it holds resources
+func closeStream(stream io.ReadSeeker) {
+	if closer, ok := stream.(io.Closer); ok {
+		closer.Close()
+	}
+}
@@ -0,0 +1,117 @@
+package player
+
+import (
+	"fmt"
+	"io"
+)
+
+// --- Infinite loop ---
+
+// infiniteLoop plays a 16bit stereo stream forever: the intro once, then the loop region after it
+// over and over. Positions count on past the end of the stream, wrapping into the loop region,
+// so a player's position keeps increasing as the track loops.
+type infiniteLoop struct {
+	src         io.ReadSeeker
+	introLength int64 // Bytes played once before the loop
+	loopLength  int64 // Bytes of the repeating part
+	pos         int64 // Position in src; -1 until it is read from src
+}
+
+// newInfiniteLoop returns a stream looping src, the part after introLength bytes repeating
+// for loopLength bytes. The lengths are rounded down to whole frames.
+func newInfiniteLoop(src io.ReadSeeker, introLength, loopLength int64) *infiniteLoop {
+	return &infiniteLoop{
+		src:         src,
+		introLength: introLength / bytesPerSample * bytesPerSample,
+		loopLength:  loopLength / bytesPerSample * bytesPerSample,
+		pos:         -1,
+	}
+}
+
+// length returns the length of the intro and one pass of the loop region
+func (l *infiniteLoop) length() int64 {
+	return l.introLength + l.loopLength
+}
+
+// ensurePos takes the starting position from src
+func (l *infiniteLoop) ensurePos() error {
+	if l.pos >= 0 {
+		return nil
+	}
+	pos, err := l.src.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if pos >= l.length() {
+		return fmt.Errorf("loop: stream position %d is past the loop end %d", pos, l.length())
+	}
+	l.pos = pos
+	return nil
+}
+
+// rewind seeks src back to the start of the loop region
+func (l *infiniteLoop) rewind() error {
+	if _, err := l.src.Seek(l.introLength, io.SeekStart); err != nil {
+		return err
+	}
+	l.pos = l.introLength
+	return nil
+}
+
+// Read reads on from the stream, going back to the loop start at the loop end.
+// A source ending before the loop end loops from where it ends.
+func (l *infiniteLoop) Read(b []byte) (int, error) {
+	if l.loopLength <= 0 {
+		return 0, io.EOF
+	}
+	if err := l.ensurePos(); err != nil {
+		return 0, err
+	}
+
+	// Reading stops at the loop end, as a read across it would need two reads of src
+	if remaining := l.length() - l.pos; int64(len(b)) > remaining {
+		b = b[:remaining]
+	}
+	n, err := l.src.Read(b)
+	l.pos += int64(n)
+	if err != nil && err != io.EOF {
+		return n, err
+	}
+	if l.pos >= l.length() || err == io.EOF {
+		if l.pos == l.introLength && n == 0 {
+			// Nothing is left to loop
+			return 0, io.EOF
+		}
+		if err := l.rewind(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Seek seeks the stream. Positions past the loop end wrap into the loop region.
+func (l *infiniteLoop) Seek(offset int64, whence int) (int64, error) {
+	if err := l.ensurePos(); err != nil {
+		return 0, err
+	}
+
+	next := offset
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		next += l.pos
+	default:
+		return 0, fmt.Errorf("loop: whence must be io.SeekStart or io.SeekCurrent")
+	}
+	if next < 0 {
+		return 0, fmt.Errorf("loop: negative position: %d", next)
+	}
+	if next > l.introLength && l.loopLength > 0 {
+		next = (next-l.introLength)%l.loopLength + l.introLength
+	}
+	if _, err := l.src.Seek(next, io.SeekStart); err != nil {
+		return 0, err
+	}
+	l.pos = next
+	return next, nil
+}
@@ -0,0 +1,312 @@
+package player
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"musicplayer/internal/files"
+)
+
+// --- Writing loop points ---
+
+const (
+	oggContinued = 0x01       // Header type flag: the page starts in the middle of a packet
+	oggNoGranule = ^uint64(0) // Granule position of a page on which no packet ends
+)
+
+// oggPage is a page of an Ogg stream
+type oggPage struct {
+	headerType byte
+	granule    uint64
+	serial     uint32
+	sequence   uint32
+	segments   []byte // Lacing values
+	data       []byte
+}
+
+// WriteLoopPoints writes the LOOPSTART and LOOPLENGTH Vorbis comments of an OGG file, in samples
+// at the file's own sample rate, replacing any loop comments it had (LOOPEND included).
+// The other comments and the audio are kept as they are, and the loop must end within the stream.
+// The file is replaced through a temporary file, so a failed write leaves the original intact,
+// and the file as it was before is kept beside it with a ".bak" suffix.
+func (l *MusicLoader) WriteLoopPoints(path string, start, length int64) error {
+	if !files.IsOggFile(path) {
+		return fmt.Errorf("loader: loop points can only be written to OGG files: %s", path)
+	}
+	if start < 0 || length <= 0 {
+		return fmt.Errorf("loader: invalid loop points: start %d, length %d", start, length)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("loader: failed to read %s: %v", path, err)
+	}
+	rewritten, err := rewriteOggLoopPoints(data, start, length)
+	if err != nil {
+		return fmt.Errorf("loader: failed to write loop points to %s: %v", path, err)
+	}
+	if err := writeFileAtomic(path+".bak", data); err != nil {
+		return fmt.Errorf("loader: failed to back up %s: %v", path, err)
+	}
+	if err := writeFileAtomic(path, rewritten); err != nil {
+		return fmt.Errorf("loader: failed to write %s: %v", path, err)
+	}
+	return nil
+}
+
+// rewriteOggLoopPoints returns an Ogg Vorbis stream with the loop comments replaced.
+// The comment and setup headers are laid out on new pages, and the pages after them renumbered.
+func rewriteOggLoopPoints(data []byte, start, length int64) ([]byte, error) {
+	pages, err := parseOggPages(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("empty Ogg stream")
+	}
+	serial := pages[0].serial
+
+	// The identification header fills the first page by itself, and the setup header ends its page
+	var packets [][]byte
+	var packet []byte
+	headerEnd := -1
+	for i := 0; i < len(pages) && headerEnd < 0; i++ {
+		page := pages[i]
+		if page.serial != serial {
+			return nil, fmt.Errorf("multiplexed Ogg streams are not supported")
+		}
+		offset := 0
+		for j, size := range page.segments {
+			packet = append(packet, page.data[offset:offset+int(size)]...)
+			offset += int(size)
+			if size == 255 {
+				continue // The packet continues in the next segment
+			}
+
+			packets = append(packets, packet)
+			packet = nil
+			isPageEnd := j == len(page.segments)-1
+			if len(packets) == 1 && (i != 0 || !isPageEnd) {
+				return nil, fmt.Errorf("the Vorbis identification header doesn't fill the first page")
+			}
+			if len(packets) == 3 {
+				if !isPageEnd {
+					return nil, fmt.Errorf("the Vorbis setup header doesn't end its page")
+				}
+				headerEnd = i
+			}
+		}
+	}
+	if headerEnd < 0 {
+		return nil, fmt.Errorf("incomplete Vorbis headers")
+	}
+	if !strings.HasPrefix(string(packets[0]), "\x01vorbis") {
+		return nil, fmt.Errorf("missing Vorbis identification header")
+	}
+	if !strings.HasPrefix(string(packets[1]), "\x03vorbis") {
+		return nil, fmt.Errorf("missing Vorbis comment header")
+	}
+
+	// The granule position of the last audio page is the length of the stream in samples
+	var total int64
+	for _, page := range pages[headerEnd+1:] {
+		if page.granule != oggNoGranule {
+			total = int64(page.granule)
+		}
+	}
+	if start+length > total {
+		return nil, fmt.Errorf("loop end %d is past the end of the stream at %d samples", start+length, total)
+	}
+
+	vendor, comments, err := readVorbisCommentList(packets[1][7:])
+	if err != nil {
+		return nil, err
+	}
+	var kept []string
+	for _, comment := range comments {
+		name, _, _ := strings.Cut(comment, "=")
+		switch strings.ToUpper(name) {
+		case "LOOPSTART", "LOOPLENGTH", "LOOPEND":
+			continue
+		}
+		kept = append(kept, comment)
+	}
+	kept = append(kept, fmt.Sprintf("LOOPSTART=%d", start), fmt.Sprintf("LOOPLENGTH=%d", length))
+
+	headers := paginateOgg(serial, pages[0].sequence+1, vorbisCommentPacket(vendor, kept), packets[2])
+	shift := uint32(len(headers) - headerEnd) // Wraps around when the headers take fewer pages
+
+	out := pages[0].encode()
+	for _, page := range headers {
+		out = append(out, page.encode()...)
+	}
+	for _, page := range pages[headerEnd+1:] {
+		page.sequence += shift
+		out = append(out, page.encode()...)
+	}
+	return out, nil
+}
+
+// vorbisCommentPacket builds a Vorbis comment header packet
+func vorbisCommentPacket(vendor string, comments []string) []byte {
+	packet := []byte("\x03vorbis")
+	packet = binary.LittleEndian.AppendUint32(packet, uint32(len(vendor)))
+	packet = append(packet, vendor...)
+	packet = binary.LittleEndian.AppendUint32(packet, uint32(len(comments)))
+	for _, comment := range comments {
+		packet = binary.LittleEndian.AppendUint32(packet, uint32(len(comment)))
+		packet = append(packet, comment...)
+	}
+	return append(packet, 1) // Framing bit
+}
+
+// parseOggPages splits an Ogg stream into its pages
+func parseOggPages(data []byte) ([]oggPage, error) {
+	var pages []oggPage
+	for len(data) > 0 {
+		if len(data) < 27 || string(data[:4]) != "OggS" {
+			return nil, fmt.Errorf("invalid Ogg page")
+		}
+		count := int(data[26])
+		if len(data) < 27+count {
+			return nil, fmt.Errorf("truncated Ogg page")
+		}
+		segments := data[27 : 27+count]
+		size := 0
+		for _, s := range segments {
+			size += int(s)
+		}
+		end := 27 + count + size
+		if len(data) < end {
+			return nil, fmt.Errorf("truncated Ogg page")
+		}
+
+		pages = append(pages, oggPage{
+			headerType: data[5],
+			granule:    binary.LittleEndian.Uint64(data[6:14]),
+			serial:     binary.LittleEndian.Uint32(data[14:18]),
+			sequence:   binary.LittleEndian.Uint32(data[18:22]),
+			segments:   segments,
+			data:       data[27+count : end],
+		})
+		data = data[end:]
+	}
+	return pages, nil
+}
+
+// paginateOgg lays packets out on pages of up to 255 segments, numbered from sequence
+func paginateOgg(serial, sequence uint32, packets ...[]byte) []oggPage {
+	type segment struct {
+		size byte
+		last bool // Whether the packet ends with this segment
+	}
+	var segments []segment
+	var data []byte
+	for _, packet := range packets {
+		n := len(packet)
+		for ; n >= 255; n -= 255 {
+			segments = append(segments, segment{255, false})
+		}
+		segments = append(segments, segment{byte(n), true})
+		data = append(data, packet...)
+	}
+
+	var pages []oggPage
+	continued := false
+	for len(segments) > 0 {
+		count := min(len(segments), 255)
+		page := oggPage{serial: serial, sequence: sequence + uint32(len(pages)), granule: oggNoGranule}
+		if continued {
+			page.headerType = oggContinued
+		}
+		size := 0
+		for _, s := range segments[:count] {
+			page.segments = append(page.segments, s.size)
+			size += int(s.size)
+			if s.last {
+				page.granule = 0 // Header packets come before any audio
+			}
+		}
+		page.data, data = data[:size], data[size:]
+		continued = !segments[count-1].last
+		segments = segments[count:]
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+// encode returns the page with its checksum
+func (p oggPage) encode() []byte {
+	b := make([]byte, 27, 27+len(p.segments)+len(p.data))
+	copy(b, "OggS")
+	b[5] = p.headerType
+	binary.LittleEndian.PutUint64(b[6:], p.granule)
+	binary.LittleEndian.PutUint32(b[14:], p.serial)
+	binary.LittleEndian.PutUint32(b[18:], p.sequence)
+	b[26] = byte(len(p.segments))
+	b = append(b, p.segments...)
+	b = append(b, p.data...)
+	binary.LittleEndian.PutUint32(b[22:], oggChecksum(b))
+	return b
+}
+
+// oggCRCTable is the lookup table of the Ogg CRC-32 (polynomial 0x04c11db7, not reflected)
+var oggCRCTable = func() (table [256]uint32) {
+	for i := range table {
+		crc := uint32(i) << 24
+		for range 8 {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+// oggChecksum computes the checksum of a page whose checksum field is zero
+func oggChecksum(page []byte) uint32 {
+	var crc uint32
+	for _, b := range page {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// SaveLoopRegion writes the A-B loop region of the current track into the file as its loop points,
+// so a game engine plays up to B, then repeats from A. Only OGG files can be written.
+// The new loop points are used the next time the track is loaded.
+func (p *MusicPlayer) SaveLoopRegion() error {
+	path := p.GetCurrentPath()
+	if path == "" || p.currentMusic == nil {
+		return fmt.Errorf("no music is loaded")
+	}
+	if !p.hasLoopRegion || p.auditioning {
+		return fmt.Errorf("no loop region is set")
+	}
+	if !files.IsOggFile(path) {
+		return fmt.Errorf("loop points can only be written to OGG files: %s", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	srcRate, _, err := readOggVorbisHeaders(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read headers of %s: %v", path, err)
+	}
+
+	toSamples := func(d time.Duration) int64 {
+		return int64(math.Round(d.Seconds() * float64(srcRate)))
+	}
+	start := toSamples(p.loopStart)
+	return p.loader.WriteLoopPoints(path, start, toSamples(p.loopEnd)-start)
+}
@@ -0,0 +1,488 @@
+package player
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"musicplayer/internal/files"
+)
+
+// --- TrackMetadata ---
+
+// TrackMetadata holds descriptive information about a music file.
+type TrackMetadata struct {
+	Title    string // Tag title, or the file name without extension when untagged
+	Artist   string
+	Album    string
+	Duration time.Duration // Zero until the duration is cached, or when the stream can't be decoded
+}
+
+// DisplayName returns "Artist - Title" when the artist is known, or the title otherwise.
+func (m *TrackMetadata) DisplayName() string {
+	if m.Artist != "" {
+		return m.Artist + " - " + m.Title
+	}
+	return m.Title
+}
+
+// metadataCacheEntry holds the tags read from a file, valid while the file is unchanged.
+// Failures are cached too, so a broken file isn't read again for every lookup.
+type metadataCacheEntry struct {
+	modTime time.Time
+	size    int64
+	tags    TrackMetadata // Without the duration, which is cached on its own
+	err     error
+}
+
+// ReadMetadata reads the tags of the audio file at the given path.
+// ID3v2 (and ID3v1) tags are read from MP3 files, Vorbis comments from OGG and FLAC files.
+// Files without tags, such as most WAV files, get the file name as their title.
+// Tags are cached until the file's size or modification time changes, like durations.
+// The duration is only filled in when it is already cached, since computing it decodes the
+// whole file; callers that need it call GetDuration.
+func (l *MusicLoader) ReadMetadata(filePath string) (*TrackMetadata, error) {
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("loader: failed to stat audio file %s: %v", filePath, err)
+	}
+
+	l.mu.Lock()
+	entry, ok := l.metadata[filePath]
+	l.mu.Unlock()
+	if !ok || !entry.modTime.Equal(stat.ModTime()) || entry.size != stat.Size() {
+		tags, err := readTags(filePath)
+		entry = metadataCacheEntry{modTime: stat.ModTime(), size: stat.Size(), err: err}
+		if tags != nil {
+			entry.tags = *tags
+		}
+		l.mu.Lock()
+		l.metadata[filePath] = entry
+		l.mu.Unlock()
+	}
+	if entry.err != nil {
+		return nil, entry.err
+	}
+
+	metadata := entry.tags
+	l.mu.Lock()
+	if d, ok := l.durations[filePath]; ok && d.err == nil && d.modTime.Equal(stat.ModTime()) && d.size == stat.Size() {
+		metadata.Duration = d.duration
+	}
+	l.mu.Unlock()
+	return &metadata, nil
+}
+
+// readTags reads the title, artist and album of the audio file
+func readTags(filePath string) (*TrackMetadata, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("loader: failed to open audio file %s: %v", filePath, err)
+	}
+	defer f.Close()
+
+	var tags map[string]string
+	if files.IsMp3File(filePath) {
+		tags, err = readID3Tags(f)
+	} else if files.IsOggFile(filePath) {
+		_, tags, err = readOggVorbisHeaders(f)
+	} else if files.IsFlacFile(filePath) {
+		tags, err = readFlacVorbisComments(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loader: failed to read tags of %s: %v", filePath, err)
+	}
+
+	metadata := &TrackMetadata{
+		Title:  tags["TITLE"],
+		Artist: tags["ARTIST"],
+		Album:  tags["ALBUM"],
+	}
+	if metadata.Title == "" {
+		base := filepath.Base(filePath)
+		metadata.Title = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	return metadata, nil
+}
+
+// --- ID3 ---
+
+// id3Frames maps ID3v2 frame IDs (v2.3/v2.4 and v2.2) to tag names.
+var id3Frames = map[string]string{
+	"TIT2": "TITLE",
+	"TPE1": "ARTIST",
+	"TALB": "ALBUM",
+	"TT2":  "TITLE",
+	"TP1":  "ARTIST",
+	"TAL":  "ALBUM",
+}
+
+// maxID3TagSize is how much of an ID3v2 tag is read at most. The size is taken from the file, so a
+// corrupt header mustn't allocate up to 256 MB; the text frames come before any large pictures.
+const maxID3TagSize = 16 << 20
+
+// readID3Tags reads an ID3v2 tag at the start of the file, falling back to an ID3v1 tag at the end.
+// A file without tags returns an empty map.
+func readID3Tags(r io.ReadSeeker) (map[string]string, error) {
+	tags := make(map[string]string)
+
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err == nil && string(header[:3]) == "ID3" {
+		version := header[3]
+		flags := header[5]
+		size := min(syncsafe(header[6:10]), maxID3TagSize)
+		body := make([]byte, size)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, fmt.Errorf("truncated ID3v2 tag: %v", err)
+		}
+		if flags&0x80 != 0 && version < 4 {
+			// Tag-wide unsynchronisation: FF 00 is stored for FF
+			body = bytes.ReplaceAll(body, []byte{0xff, 0x00}, []byte{0xff})
+		}
+		if flags&0x40 != 0 && version >= 3 && len(body) >= 4 {
+			// Skip the extended header
+			extSize := int(binary.BigEndian.Uint32(body[:4]))
+			if version == 4 {
+				extSize = syncsafe(body[:4])
+			} else {
+				extSize += 4
+			}
+			if extSize > len(body) {
+				extSize = len(body)
+			}
+			body = body[extSize:]
+		}
+		parseID3v2Frames(body, version, tags)
+	}
+
+	if len(tags) == 0 {
+		readID3v1Tags(r, tags)
+	}
+	return tags, nil
+}
+
+// parseID3v2Frames extracts the text frames in id3Frames from an ID3v2 tag body.
+func parseID3v2Frames(body []byte, version byte, tags map[string]string) {
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+
+	for len(body) >= headerLen {
+		id := string(body[:idLen])
+		if body[0] == 0 {
+			break // Padding
+		}
+
+		var size int
+		switch version {
+		case 2:
+			size = int(body[3])<<16 | int(body[4])<<8 | int(body[5])
+		case 4:
+			size = syncsafe(body[4:8])
+		default:
+			size = int(binary.BigEndian.Uint32(body[4:8]))
+		}
+		if size < 0 || headerLen+size > len(body) {
+			break
+		}
+
+		if name, ok := id3Frames[id]; ok && size > 0 {
+			if text := decodeID3Text(body[headerLen : headerLen+size]); text != "" {
+				tags[name] = text
+			}
+		}
+		body = body[headerLen+size:]
+	}
+}
+
+// decodeID3Text decodes a text frame payload: an encoding byte followed by the text.
+func decodeID3Text(data []byte) string {
+	encoding, text := data[0], data[1:]
+
+	var s string
+	switch encoding {
+	case 1, 2: // UTF-16 with BOM, UTF-16BE
+		bigEndian := encoding == 2
+		if len(text) >= 2 {
+			if text[0] == 0xff && text[1] == 0xfe {
+				bigEndian, text = false, text[2:]
+			} else if text[0] == 0xfe && text[1] == 0xff {
+				bigEndian, text = true, text[2:]
+			}
+		}
+		units := make([]uint16, 0, len(text)/2)
+		for i := 0; i+1 < len(text); i += 2 {
+			if bigEndian {
+				units = append(units, binary.BigEndian.Uint16(text[i:]))
+			} else {
+				units = append(units, binary.LittleEndian.Uint16(text[i:]))
+			}
+		}
+		s = string(utf16.Decode(units))
+	case 3: // UTF-8
+		s = string(text)
+	default: // ISO-8859-1
+		runes := make([]rune, len(text))
+		for i, b := range text {
+			runes[i] = rune(b)
+		}
+		s = string(runes)
+	}
+
+	// Multiple values are NUL separated; keep the first
+	if i := strings.IndexRune(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// readID3v1Tags reads the fixed 128 byte ID3v1 tag at the end of the file, if any.
+func readID3v1Tags(r io.ReadSeeker, tags map[string]string) {
+	if _, err := r.Seek(-128, io.SeekEnd); err != nil {
+		return
+	}
+	tag := make([]byte, 128)
+	if _, err := io.ReadFull(r, tag); err != nil || string(tag[:3]) != "TAG" {
+		return
+	}
+
+	field := func(b []byte) string {
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		return strings.TrimSpace(string(b))
+	}
+	for name, value := range map[string]string{
+		"TITLE":  field(tag[3:33]),
+		"ARTIST": field(tag[33:63]),
+		"ALBUM":  field(tag[63:93]),
+	} {
+		if value != "" {
+			tags[name] = value
+		}
+	}
+}
+
+// syncsafe decodes a 4 byte ID3v2 syncsafe integer.
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// --- Vorbis comments ---
+
+// readOggVorbisHeaders reads the identification and comment headers, the first two packets
+// of an Ogg Vorbis stream, and returns the sample rate and the Vorbis comments.
+func readOggVorbisHeaders(r io.Reader) (int, map[string]string, error) {
+	br := bufio.NewReader(r)
+	sampleRate := 0
+
+	var packet []byte
+	packets := 0
+	for {
+		header := make([]byte, 27)
+		if _, err := io.ReadFull(br, header); err != nil {
+			return 0, nil, fmt.Errorf("failed to read Ogg page: %v", err)
+		}
+		if string(header[:4]) != "OggS" {
+			return 0, nil, fmt.Errorf("invalid Ogg page")
+		}
+		segments := make([]byte, header[26])
+		if _, err := io.ReadFull(br, segments); err != nil {
+			return 0, nil, fmt.Errorf("failed to read Ogg page: %v", err)
+		}
+
+		for _, size := range segments {
+			data := make([]byte, size)
+			if _, err := io.ReadFull(br, data); err != nil {
+				return 0, nil, fmt.Errorf("failed to read Ogg page: %v", err)
+			}
+			packet = append(packet, data...)
+			if size == 255 {
+				continue // The packet continues in the next segment
+			}
+
+			packets++
+			switch packets {
+			case 1:
+				// Identification header: version (4 bytes), channels (1 byte), then the sample rate
+				if !bytes.HasPrefix(packet, []byte("\x01vorbis")) {
+					return 0, nil, fmt.Errorf("missing Vorbis identification header")
+				}
+				if len(packet) >= 16 {
+					sampleRate = int(binary.LittleEndian.Uint32(packet[12:16]))
+				}
+			case 2:
+				if !bytes.HasPrefix(packet, []byte("\x03vorbis")) {
+					return 0, nil, fmt.Errorf("missing Vorbis comment header")
+				}
+				tags, err := parseVorbisComments(packet[7:])
+				return sampleRate, tags, err
+			}
+			packet = packet[:0]
+		}
+	}
+}
+
+// readFlacVorbisComments reads the VORBIS_COMMENT metadata block of a FLAC file.
+// A file without the block returns an empty map.
+func readFlacVorbisComments(r io.Reader) (map[string]string, error) {
+	br := bufio.NewReader(r)
+
+	marker := make([]byte, 4)
+	if _, err := io.ReadFull(br, marker); err != nil {
+		return nil, fmt.Errorf("failed to read stream marker: %v", err)
+	}
+	if string(marker) != "fLaC" {
+		return nil, fmt.Errorf("invalid stream marker")
+	}
+
+	const blockTypeVorbisComment = 4
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(br, header); err != nil {
+			return nil, fmt.Errorf("failed to read metadata block header: %v", err)
+		}
+		isLast := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+
+		if blockType == blockTypeVorbisComment {
+			block := make([]byte, length)
+			if _, err := io.ReadFull(br, block); err != nil {
+				return nil, fmt.Errorf("failed to read VORBIS_COMMENT: %v", err)
+			}
+			return parseVorbisComments(block)
+		}
+		if _, err := io.CopyN(io.Discard, br, length); err != nil {
+			return nil, fmt.Errorf("failed to skip metadata block: %v", err)
+		}
+		if isLast {
+			return map[string]string{}, nil
+		}
+	}
+}
+
+// parseVorbisComments parses a Vorbis comment list into upper-cased field names.
+// The first value wins when a field is repeated.
+func parseVorbisComments(data []byte) (map[string]string, error) {
+	_, comments, err := readVorbisCommentList(data)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]string)
+	for _, comment := range comments {
+		name, value, ok := strings.Cut(comment, "=")
+		if !ok {
+			continue
+		}
+		name = strings.ToUpper(name)
+		if _, exists := tags[name]; !exists {
+			tags[name] = value
+		}
+	}
+	return tags, nil
+}
+
+// readVorbisCommentList reads the vendor string and the comments of a Vorbis comment list, in order
+func readVorbisCommentList(data []byte) (string, []string, error) {
+	r := bytes.NewReader(data)
+	readString := func() (string, error) {
+		var length uint32
+		if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+			return "", err
+		}
+		if int64(length) > int64(r.Len()) {
+			return "", fmt.Errorf("comment length %d exceeds data", length)
+		}
+		b := make([]byte, length)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+
+	vendor, err := readString()
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid Vorbis comments: %v", err)
+	}
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return "", nil, fmt.Errorf("invalid Vorbis comments: %v", err)
+	}
+
+	var comments []string
+	for i := uint32(0); i < count; i++ {
+		comment, err := readString()
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid Vorbis comments: %v", err)
+		}
+		comments = append(comments, comment)
+	}
+	return vendor, comments, nil
+}
+
+// --- Loop points ---
+
+// LoopPoints returns the intro and loop lengths in bytes of the decoded stream, as marked by
+// the LOOPSTART and LOOPLENGTH (or LOOPEND) Vorbis comments of an OGG file.
+// The comments are in samples at the file's own sample rate and are converted for the output sample rate.
+// A zero loopLength means the loop runs to the end of the stream.
+// ok is false when the file has no loop comments.
+func (l *MusicLoader) LoopPoints(filePath string) (introLength, loopLength int64, ok bool, err error) {
+	if !files.IsOggFile(filePath) {
+		return 0, 0, false, nil
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("loader: failed to open audio file %s: %v", filePath, err)
+	}
+	defer f.Close()
+
+	srcRate, tags, err := readOggVorbisHeaders(f)
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("loader: failed to read tags of %s: %v", filePath, err)
+	}
+
+	start, ok := parseSampleCount(tags["LOOPSTART"])
+	if !ok {
+		return 0, 0, false, nil
+	}
+	length, hasLength := parseSampleCount(tags["LOOPLENGTH"])
+	if !hasLength {
+		if end, hasEnd := parseSampleCount(tags["LOOPEND"]); hasEnd && end > start {
+			length, hasLength = end-start, true
+		}
+	}
+	if srcRate <= 0 {
+		return 0, 0, false, fmt.Errorf("loader: invalid sample rate for %s: %d", filePath, srcRate)
+	}
+
+	toBytes := func(samples int64) int64 {
+		return samples * int64(l.sampleRate) / int64(srcRate) * bytesPerSample
+	}
+	introLength = toBytes(start)
+	if hasLength && length > 0 {
+		loopLength = toBytes(length)
+	}
+	return introLength, loopLength, true, nil
+}
+
+// parseSampleCount parses a non-negative sample count from a tag value
+func parseSampleCount(value string) (int64, bool) {
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,389 @@
+package player_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"musicplayer/internal/player"
+)
+
+// id3v2Frame builds an ID3v2.3 frame
+func id3v2Frame(id string, payload []byte) []byte {
+	frame := []byte(id)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(payload)))
+	frame = append(frame, 0, 0) // Flags
+	return append(frame, payload...)
+}
+
+// vorbisComments builds a Vorbis comment list
+func vorbisComments(comments ...string) []byte {
+	var buf bytes.Buffer
+	vendor := "test"
+	binary.Write(&buf, binary.LittleEndian, uint32(len(vendor)))
+	buf.WriteString(vendor)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(comments)))
+	for _, c := range comments {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(c)))
+		buf.WriteString(c)
+	}
+	return buf.Bytes()
+}
+
+// oggPage builds an Ogg page holding a single packet
+func oggPage(packet []byte) []byte {
+	var segments []byte
+	n := len(packet)
+	for n >= 255 {
+		segments = append(segments, 255)
+		n -= 255
+	}
+	segments = append(segments, byte(n))
+
+	page := []byte("OggS")
+	page = append(page, make([]byte, 22)...) // Version, type, granule, serial, sequence, CRC
+	page = append(page, byte(len(segments)))
+	page = append(page, segments...)
+	return append(page, packet...)
+}
+
+func TestMusicLoader_ReadMetadata_Wav(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bgm_03_final_v2.wav")
+	if err := WriteTestWav(path, 4800); err != nil {
+		t.Fatal(err)
+	}
+
+	loader := player.NewMusicLoader()
+	metadata, err := loader.ReadMetadata(path)
+	if err != nil {
+		t.Fatalf("ReadMetadata failed: %v", err)
+	}
+	if metadata.Title != "bgm_03_final_v2" || metadata.Artist != "" || metadata.Album != "" {
+		t.Errorf("Expected filename title only, got %+v", metadata)
+	}
+	// Reading tags doesn't decode the audio, so the duration is only known once computed
+	if metadata.Duration != 0 {
+		t.Errorf("Expected no duration before it is computed, got %v", metadata.Duration)
+	}
+	if _, err := loader.GetDuration(path); err != nil {
+		t.Fatal(err)
+	}
+	if metadata, err := loader.ReadMetadata(path); err != nil || metadata.Duration != 100*time.Millisecond {
+		t.Errorf("Expected the cached duration 100ms, got %v, %v", metadata, err)
+	}
+	if metadata.DisplayName() != "bgm_03_final_v2" {
+		t.Errorf("Expected display name of the title, got %s", metadata.DisplayName())
+	}
+}
+
+func TestMusicLoader_ReadMetadata_Mp3(t *testing.T) {
+	// UTF-16 title, ISO-8859-1 artist and UTF-8 album
+	title := []byte{1, 0xff, 0xfe}
+	for _, r := range "Théme" {
+		title = binary.LittleEndian.AppendUint16(title, uint16(r))
+	}
+	var body []byte
+	body = append(body, id3v2Frame("TIT2", title)...)
+	body = append(body, id3v2Frame("TPE1", append([]byte{0}, "Sound Team"...))...)
+	body = append(body, id3v2Frame("TALB", append([]byte{3}, "Game OST"...))...)
+	body = append(body, make([]byte, 16)...) // Padding
+
+	data := []byte{'I', 'D', '3', 3, 0, 0}
+	size := len(body)
+	data = append(data, byte(size>>21&0x7f), byte(size>>14&0x7f), byte(size>>7&0x7f), byte(size&0x7f))
+	data = append(data, body...)
+
+	path := filepath.Join(t.TempDir(), "track.mp3")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, err := player.NewMusicLoader().ReadMetadata(path)
+	if err != nil {
+		t.Fatalf("ReadMetadata failed: %v", err)
+	}
+	if metadata.Title != "Théme" || metadata.Artist != "Sound Team" || metadata.Album != "Game OST" {
+		t.Errorf("Unexpected metadata: %+v", metadata)
+	}
+	if metadata.DisplayName() != "Sound Team - Théme" {
+		t.Errorf("Expected \"Sound Team - Théme\", got %s", metadata.DisplayName())
+	}
+}
+
+func TestMusicLoader_ReadMetadata_LargeID3(t *testing.T) {
+	// A tag claiming the largest size is read only up to 16 MB
+	body := id3v2Frame("TIT2", append([]byte{0}, "Boss"...))
+	body = append(body, make([]byte, 16<<20)...)
+	data := append([]byte{'I', 'D', '3', 3, 0, 0, 0x7f, 0x7f, 0x7f, 0x7f}, body...)
+
+	path := filepath.Join(t.TempDir(), "track.mp3")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, err := player.NewMusicLoader().ReadMetadata(path)
+	if err != nil {
+		t.Fatalf("ReadMetadata failed: %v", err)
+	}
+	if metadata.Title != "Boss" {
+		t.Errorf("Expected the title before the size limit, got %+v", metadata)
+	}
+}
+
+func TestMusicLoader_ReadMetadata_Cached(t *testing.T) {
+	tag := func(title string) []byte {
+		body := id3v2Frame("TIT2", append([]byte{0}, title...))
+		size := len(body)
+		data := []byte{'I', 'D', '3', 3, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+		return append(data, body...)
+	}
+	path := filepath.Join(t.TempDir(), "track.mp3")
+	if err := os.WriteFile(path, tag("Boss"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loader := player.NewMusicLoader()
+	if metadata, err := loader.ReadMetadata(path); err != nil || metadata.Title != "Boss" {
+		t.Fatalf("Expected the title Boss, got %+v (%v)", metadata, err)
+	}
+
+	// The tags aren't read again while the size and modification time are the same
+	if err := os.WriteFile(path, tag("Town"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, stat.ModTime(), stat.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if metadata, err := loader.ReadMetadata(path); err != nil || metadata.Title != "Boss" {
+		t.Errorf("Expected the cached title Boss, got %+v (%v)", metadata, err)
+	}
+
+	// A changed file is read again
+	if err := os.WriteFile(path, tag("Field"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if metadata, err := loader.ReadMetadata(path); err != nil || metadata.Title != "Field" {
+		t.Errorf("Expected the new title Field, got %+v (%v)", metadata, err)
+	}
+}
+
+func TestMusicLoader_ReadMetadata_Ogg(t *testing.T) {
+	var data []byte
+	data = append(data, oggPage([]byte("\x01vorbis identification"))...)
+	data = append(data, oggPage(append([]byte("\x03vorbis"), vorbisComments("title=Field", "ARTIST=Composer", "Album=Demo")...))...)
+
+	path := filepath.Join(t.TempDir(), "track.ogg")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, err := player.NewMusicLoader().ReadMetadata(path)
+	if err != nil {
+		t.Fatalf("ReadMetadata failed: %v", err)
+	}
+	if metadata.Title != "Field" || metadata.Artist != "Composer" || metadata.Album != "Demo" {
+		t.Errorf("Unexpected metadata: %+v", metadata)
+	}
+}
+
+func TestMusicLoader_ReadMetadata_Flac(t *testing.T) {
+	comments := vorbisComments("TITLE=Dungeon", "ARTIST=Composer")
+
+	data := []byte("fLaC")
+	data = append(data, 0, 0, 0, 34) // STREAMINFO
+	data = append(data, make([]byte, 34)...)
+	data = append(data, 0x80|4, byte(len(comments)>>16), byte(len(comments)>>8), byte(len(comments))) // Last block: VORBIS_COMMENT
+	data = append(data, comments...)
+
+	path := filepath.Join(t.TempDir(), "track.flac")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, err := player.NewMusicLoader().ReadMetadata(path)
+	if err != nil {
+		t.Fatalf("ReadMetadata failed: %v", err)
+	}
+	if metadata.Title != "Dungeon" || metadata.Artist != "Composer" || metadata.Album != "" {
+		t.Errorf("Unexpected metadata: %+v", metadata)
+	}
+}
+
+// writeTestOgg writes Ogg Vorbis identification and comment headers without audio data
+func writeTestOgg(path string, sampleRate uint32, comments ...string) error {
+	identification := []byte("\x01vorbis")
+	identification = binary.LittleEndian.AppendUint32(identification, 0) // Version
+	identification = append(identification, 2)                           // Channels
+	identification = binary.LittleEndian.AppendUint32(identification, sampleRate)
+
+	var data []byte
+	data = append(data, oggPage(identification)...)
+	data = append(data, oggPage(append([]byte("\x03vorbis"), vorbisComments(comments...)...))...)
+	return os.WriteFile(path, data, 0644)
+}
+
+func TestMusicLoader_LoopPoints(t *testing.T) {
+	tempDir := t.TempDir()
+	loader := player.NewMusicLoader()
+
+	tests := []struct {
+		name          string
+		sampleRate    uint32
+		comments      []string
+		ok            bool
+		expectedIntro int64
+		expectedLoop  int64
+	}{
+		{"No loop comments", 48000, []string{"TITLE=Field"}, false, 0, 0},
+		{"Start and length", 48000, []string{"LOOPSTART=48000", "LOOPLENGTH=96000"}, true, 48000 * 4, 96000 * 4},
+		{"Start and end", 48000, []string{"LOOPSTART=48000", "LOOPEND=144000"}, true, 48000 * 4, 96000 * 4},
+		{"Start only loops to the end", 48000, []string{"LOOPSTART=1000"}, true, 1000 * 4, 0},
+		{"Converted from 44.1kHz", 44100, []string{"LOOPSTART=44100", "LOOPLENGTH=88200"}, true, 48000 * 4, 96000 * 4},
+		{"Invalid start", 48000, []string{"LOOPSTART=abc"}, false, 0, 0},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tempDir, fmt.Sprintf("loop%d.ogg", i))
+			if err := writeTestOgg(path, tt.sampleRate, tt.comments...); err != nil {
+				t.Fatal(err)
+			}
+
+			intro, loop, ok, err := loader.LoopPoints(path)
+			if err != nil {
+				t.Fatalf("LoopPoints failed: %v", err)
+			}
+			if ok != tt.ok || intro != tt.expectedIntro || loop != tt.expectedLoop {
+				t.Errorf("LoopPoints() = (%d, %d, %v), want (%d, %d, %v)", intro, loop, ok, tt.expectedIntro, tt.expectedLoop, tt.ok)
+			}
+		})
+	}
+
+	// Other formats have no loop points
+	wavPath := filepath.Join(tempDir, "track.wav")
+	if err := WriteTestWav(wavPath, 4800); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok, err := loader.LoopPoints(wavPath); ok || err != nil {
+		t.Errorf("Expected no loop points for WAV, got ok %v err %v", ok, err)
+	}
+}
+
+// writeTestOggStream writes Ogg Vorbis headers followed by an audio page ending at samples,
+// on pages numbered in order
+func writeTestOggStream(path string, sampleRate uint32, samples uint64, comments ...string) error {
+	identification := []byte("\x01vorbis")
+	identification = binary.LittleEndian.AppendUint32(identification, 0) // Version
+	identification = append(identification, 2)                           // Channels
+	identification = binary.LittleEndian.AppendUint32(identification, sampleRate)
+
+	pages := [][]byte{
+		oggPage(identification),
+		oggPage(append([]byte("\x03vorbis"), vorbisComments(comments...)...)),
+		oggPage(append([]byte("\x05vorbis"), bytes.Repeat([]byte{0xaa}, 300)...)), // Spans two segments
+		oggPage(bytes.Repeat([]byte{0x55}, 64)),
+	}
+	binary.LittleEndian.PutUint64(pages[3][6:], samples)
+
+	var data []byte
+	for i, page := range pages {
+		binary.LittleEndian.PutUint32(page[18:], uint32(i))
+		data = append(data, page...)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func TestMusicLoader_WriteLoopPoints(t *testing.T) {
+	tempDir := t.TempDir()
+	loader := player.NewMusicLoader()
+
+	path := filepath.Join(tempDir, "loop.ogg")
+	if err := writeTestOggStream(path, 44100, 441000, "TITLE=Field", "LOOPSTART=10", "LOOPEND=20"); err != nil {
+		t.Fatal(err)
+	}
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loader.WriteLoopPoints(path, 44100, 88200); err != nil {
+		t.Fatalf("WriteLoopPoints failed: %v", err)
+	}
+	// The original is backed up, and the rewritten file keeps its permissions
+	if backup, err := os.ReadFile(path + ".bak"); err != nil || !bytes.Equal(backup, original) {
+		t.Errorf("Expected the original to be backed up, got err %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the permissions to be kept, got %v", info.Mode())
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(tempDir, "*.tmp")); len(leftovers) > 0 {
+		t.Errorf("Expected no temporary files to be left, got %v", leftovers)
+	}
+	intro, loop, ok, err := loader.LoopPoints(path)
+	if err != nil || !ok {
+		t.Fatalf("LoopPoints() = ok %v, err %v", ok, err)
+	}
+	if intro != 48000*4 || loop != 96000*4 {
+		t.Errorf("LoopPoints() = (%d, %d), want (%d, %d)", intro, loop, 48000*4, 96000*4)
+	}
+	metadata, err := loader.ReadMetadata(path)
+	if err != nil {
+		t.Fatalf("ReadMetadata failed: %v", err)
+	}
+	if metadata.Title != "Field" {
+		t.Errorf("Expected the other comments to be kept, got title %q", metadata.Title)
+	}
+
+	// The setup header and the audio are kept as they were, on renumbered pages with checksums
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, bytes.Repeat([]byte{0xaa}, 300)) || !bytes.HasSuffix(data, bytes.Repeat([]byte{0x55}, 64)) {
+		t.Error("Expected the setup header and the audio to be kept")
+	}
+	for sequence, offset := uint32(0), 0; offset < len(data); sequence++ {
+		if got := binary.LittleEndian.Uint32(data[offset+18:]); got != sequence {
+			t.Errorf("Page at %d has sequence number %d, want %d", offset, got, sequence)
+		}
+		if binary.LittleEndian.Uint32(data[offset+22:]) == 0 {
+			t.Errorf("Page at %d has no checksum", offset)
+		}
+		count := int(data[offset+26])
+		offset += 27 + count
+		for _, size := range data[offset-count : offset] {
+			offset += int(size)
+		}
+	}
+
+	// Loops past the end of the stream and other formats are refused, leaving the file alone
+	if err := loader.WriteLoopPoints(path, 400000, 88200); err == nil {
+		t.Error("Expected an error for a loop past the end of the stream")
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(after, data) {
+		t.Error("Expected a refused write to leave the file unchanged")
+	}
+	wavPath := filepath.Join(tempDir, "track.wav")
+	if err := WriteTestWav(wavPath, 4800); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.WriteLoopPoints(wavPath, 0, 100); err == nil {
+		t.Error("Expected an error for a WAV file")
+	}
+}
@@ -0,0 +1,104 @@
+package player
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"sync"
+)
+
+// --- Level metering ---
+
+// clipLevel is the level of a full-scale sample; a track reaching it clips
+const clipLevel = math.MaxInt16 / 32768.0
+
+// levelMeter passes a 16bit stereo stream through and measures the level of the samples read.
+// The audio player reads from its own goroutine, so the levels are guarded by a mutex.
+type levelMeter struct {
+	src io.ReadSeeker
+
+	mu   sync.Mutex
+	peak float64 // Peak amplitude of the last read (0.0-1.0)
+	rms  float64 // RMS level of the last read (0.0-1.0)
+	odd  []byte  // Trailing byte of a sample split across reads
+
+	clipped bool // Whether any sample read reached full scale, until reset
+}
+
+// newLevelMeter wraps a stream for metering
+func newLevelMeter(src io.ReadSeeker) *levelMeter {
+	return &levelMeter{src: src}
+}
+
+// Read reads from the stream and updates the levels from the samples read
+func (m *levelMeter) Read(b []byte) (int, error) {
+	n, err := m.src.Read(b)
+	if n > 0 {
+		m.measure(b[:n])
+	}
+	return n, err
+}
+
+// Seek seeks the stream
+func (m *levelMeter) Seek(offset int64, whence int) (int64, error) {
+	m.mu.Lock()
+	m.odd = nil
+	m.mu.Unlock()
+	return m.src.Seek(offset, whence)
+}
+
+// Levels returns the peak and RMS levels of the most recently read samples
+func (m *levelMeter) Levels() (peak, rms float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.peak, m.rms
+}
+
+// Clipped reports whether any sample read since the meter was created or reset reached full scale
+func (m *levelMeter) Clipped() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.clipped
+}
+
+// ResetClipped clears the clipping flag
+func (m *levelMeter) ResetClipped() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clipped = false
+}
+
+// setClipped sets the clipping flag, carrying it over from a meter the track was read through before
+func (m *levelMeter) setClipped(clipped bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clipped = clipped
+}
+
+// measure computes the levels of little-endian 16bit samples, regardless of channel
+func (m *levelMeter) measure(data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.odd) > 0 {
+		data = append(m.odd, data...)
+		m.odd = nil
+	}
+	if len(data)%2 != 0 {
+		m.odd = []byte{data[len(data)-1]}
+		data = data[:len(data)-1]
+	}
+	if len(data) == 0 {
+		return
+	}
+
+	var peak, sum float64
+	for i := 0; i < len(data); i += 2 {
+		v := math.Abs(float64(int16(binary.LittleEndian.Uint16(data[i:]))) / 32768)
+		peak = math.Max(peak, v)
+		sum += v * v
+	}
+	m.peak = peak
+	m.clipped = m.clipped || peak >= clipLevel
+	m.rms = math.Sqrt(sum / float64(len(data)/2))
+}
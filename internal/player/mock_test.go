@@ -1,22 +1,23 @@
 package player_test
 
 import (
-	"fmt"
+	"encoding/binary"
 	"io"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"musicplayer/internal/files"
 	"musicplayer/internal/player"
-
-	"github.com/hajimehoshi/ebiten/v2/audio"
 )
 
 // MockAudioPlayer implements the player.Player interface for testing
 type MockAudioPlayer struct {
 	volumeValue float64
 	isPlaying   bool
+	position    time.Duration
+	closed      bool
 	mu          sync.Mutex
 }
 
@@ -57,40 +58,52 @@ func (m *MockAudioPlayer) Volume() float64 {
 	return m.volumeValue
 }
 
-func (m *MockAudioPlayer) Current() int64 {
-	return 0
+func (m *MockAudioPlayer) Current() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.position
 }
 
-func (m *MockAudioPlayer) Rewind() error {
-	return nil
+// SetCurrent sets the position reported by Current
+func (m *MockAudioPlayer) SetCurrent(position time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.position = position
 }
 
-func (m *MockAudioPlayer) Close() error {
+func (m *MockAudioPlayer) SetPosition(offset time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.position = offset
 	return nil
 }
 
-// MockAudioContext implements the audio.Context interface for testing
-type MockAudioContext struct {
-	sampleRate int
-	nextPlayer *MockAudioPlayer
+func (m *MockAudioPlayer) Rewind() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.position = 0
+	return nil
 }
 
-func NewMockAudioContext(sampleRate int) *MockAudioContext {
-	return &MockAudioContext{
-		sampleRate: sampleRate,
-		nextPlayer: NewMockAudioPlayer(),
-	}
+func (m *MockAudioPlayer) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	m.isPlaying = false
+	return nil
 }
 
-func (m *MockAudioContext) NewPlayer(stream io.Reader) (*audio.Player, error) {
-	// This mock always returns nil instead of an actual audio.Player
-	// because we cannot access actual audio devices in the test environment
-	return nil, nil
+// IsClosed returns whether Close has been called
+func (m *MockAudioPlayer) IsClosed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.closed
 }
 
 // MockPlayerFactory implements the player.PlayerFactory interface for testing
 type MockPlayerFactory struct {
 	audioPlayers []*MockAudioPlayer
+	streams      []io.Reader
 }
 
 func NewMockPlayerFactory() *MockPlayerFactory {
@@ -103,6 +116,7 @@ func (f *MockPlayerFactory) NewPlayer(stream io.Reader) (player.Player, error) {
 	// Create a mock player for testing
 	mockPlayer := NewMockAudioPlayer()
 	f.audioPlayers = append(f.audioPlayers, mockPlayer)
+	f.streams = append(f.streams, stream)
 
 	// Return as player.Player interface
 	return mockPlayer, nil
@@ -117,6 +131,14 @@ func (f *MockPlayerFactory) GetLastPlayer() *MockAudioPlayer {
 	return f.audioPlayers[len(f.audioPlayers)-1]
 }
 
+// GetLastStream returns the stream given to the last created mock player
+func (f *MockPlayerFactory) GetLastStream() io.Reader {
+	if len(f.streams) == 0 {
+		return nil
+	}
+	return f.streams[len(f.streams)-1]
+}
+
 // MockReadSeeker implements io.ReadSeeker for testing
 type MockReadSeeker struct {
 	data        []byte
@@ -208,16 +230,84 @@ func (md TestMusicDirectory) EnsureMusicDirectory() (string, error) {
 
 // GetUsageInstructions returns instructions for using the application
 func (md TestMusicDirectory) GetUsageInstructions() string {
-	return fmt.Sprintf(`No music files found in the '%s' directory.
-
-Instructions:
-1. Place .wav, .ogg, or .mp3 files in the '%s' directory
-2. Restart the application
-3. Use the list to select and play music
-4. Space: Toggle pause
-5. N: Skip to next track
-6. Use sliders to adjust loop and interval durations
-`, md.Path(), md.Path())
+	return files.MusicDirectory(md.Path()).GetUsageInstructions()
+}
+
+// WriteTestWav writes a silent 16bit stereo 48kHz WAV file with the given number of samples
+func WriteTestWav(path string, samples int) error {
+	return WriteTestWavPCM(path, make([]int16, samples*2))
+}
+
+// WriteTestWavPCM writes a 16bit stereo 48kHz WAV file with the given interleaved samples
+func WriteTestWavPCM(path string, pcm []int16) error {
+	dataSize := len(pcm) * 2
+
+	header := make([]byte, 44)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(36+dataSize))
+	copy(header[8:], "WAVE")
+	copy(header[12:], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)      // fmt chunk size
+	binary.LittleEndian.PutUint16(header[20:], 1)       // PCM
+	binary.LittleEndian.PutUint16(header[22:], 2)       // Channels
+	binary.LittleEndian.PutUint32(header[24:], 48000)   // Sample rate
+	binary.LittleEndian.PutUint32(header[28:], 48000*4) // Byte rate
+	binary.LittleEndian.PutUint16(header[32:], 4)       // Block align
+	binary.LittleEndian.PutUint16(header[34:], 16)      // Bits per sample
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(dataSize))
+
+	data := make([]byte, dataSize)
+	for i, v := range pcm {
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(v))
+	}
+	return os.WriteFile(path, append(header, data...), 0644)
+}
+
+// WriteTestMp3 writes a silent MPEG-1 Layer III 48kHz stereo MP3 file with the given number of frames
+// of 1152 samples. If delay or padding is non-negative, a LAME Info header recording them comes first.
+func WriteTestMp3(path string, frames, delay, padding int) error {
+	return writeTestMp3(path, frames, delay, padding, false)
+}
+
+// WriteTestMp3WithCRC is WriteTestMp3 with CRC-protected frames, each header followed by a 2-byte CRC
+func WriteTestMp3WithCRC(path string, frames, delay, padding int) error {
+	return writeTestMp3(path, frames, delay, padding, true)
+}
+
+// writeTestMp3 implements WriteTestMp3 and WriteTestMp3WithCRC
+func writeTestMp3(path string, frames, delay, padding int, crc bool) error {
+	const frameSize = 384 // 128kbps at 48kHz
+	header := []byte{0xff, 0xfb, 0x94, 0x00}
+	sideInfo := 4
+	if crc {
+		header[1] &^= 1 // The protection bit is clear when there is a CRC
+		sideInfo += 2
+	}
+	frame := func() []byte {
+		b := make([]byte, frameSize)
+		copy(b, header)
+		return b
+	}
+
+	var data []byte
+	if delay >= 0 && padding >= 0 {
+		info := frame()
+		offset := sideInfo + 32 // After the side information
+		copy(info[offset:], "Info")
+		binary.BigEndian.PutUint32(info[offset+4:], 0x1) // Frame count only
+		binary.BigEndian.PutUint32(info[offset+8:], uint32(frames))
+		offset += 12
+		copy(info[offset:], "LAME3.100")
+		info[offset+21] = byte(delay >> 4)
+		info[offset+22] = byte(delay<<4) | byte(padding>>8)
+		info[offset+23] = byte(padding)
+		data = append(data, info...)
+	}
+	for range frames {
+		data = append(data, frame()...)
+	}
+	return os.WriteFile(path, data, 0644)
 }
 
 // TestHelper contains functions that help with testing
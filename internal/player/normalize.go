@@ -0,0 +1,85 @@
+package player
+
+// --- Normalization ---
+
+const (
+	// normalizationTargetPeak is the peak level tracks are scaled to (about -6 dBFS)
+	normalizationTargetPeak = 0.5
+
+	// maxNormalizationGain limits how much a quiet track is boosted
+	maxNormalizationGain = 4.0
+)
+
+// IsNormalizationEnabled returns whether track volumes are normalized
+func (p *MusicPlayer) IsNormalizationEnabled() bool {
+	return p.normalize
+}
+
+// SetNormalizationEnabled sets whether each track's volume is scaled so that its peak level
+// matches the others, to audition tracks of different loudness at similar levels.
+//
+// This is a preview aid based on the sample peak, not a loudness measurement like ReplayGain,
+// and the volume can't exceed full volume: quiet tracks are only boosted as far as the master
+// volume leaves room. The peak of a track is computed in the background, along with its waveform,
+// so a track is rescaled on the first Update after its peak is known.
+func (p *MusicPlayer) SetNormalizationEnabled(enabled bool) {
+	if p.normalize == enabled {
+		return
+	}
+	p.normalize = enabled
+
+	if p.currentMusic != nil {
+		p.updateGain(p.currentMusic)
+	}
+	if p.nextMusic != nil {
+		p.updateGain(p.nextMusic)
+	}
+}
+
+// GetTrackGain returns the normalization gain applied to the current track; 1 when normalization is off.
+func (p *MusicPlayer) GetTrackGain() float64 {
+	if p.currentMusic == nil {
+		return 1
+	}
+	return p.currentMusic.gain
+}
+
+// updateGain sets the normalization gain of the music and applies it to the volume.
+// While the peak of the track is being computed in the background the gain is 1 and left pending,
+// for updatePendingGains to set once the peak is known; the same decode gives the UI's waveform.
+func (p *MusicPlayer) updateGain(m *Music) {
+	gain, ready := p.normalizationGain(m.path)
+	m.gain, m.gainPending = gain, !ready
+	m.SetVolume(m.volume)
+}
+
+// updatePendingGains sets the normalization gains that were waiting for the peaks of their tracks
+func (p *MusicPlayer) updatePendingGains() {
+	for _, m := range []*Music{p.currentMusic, p.nextMusic} {
+		if m != nil && m.gainPending {
+			p.updateGain(m)
+		}
+	}
+}
+
+// normalizationGain returns the gain that brings the peak of the file to the target level,
+// or 1 when normalization is off or the peak can't be determined.
+// ready is false while the peak is being computed in the background.
+func (p *MusicPlayer) normalizationGain(path string) (gain float64, ready bool) {
+	if !p.normalize {
+		return 1, true
+	}
+
+	peak, ready, err := p.loader.peak(path)
+	if !ready {
+		return 1, false
+	}
+	if err != nil {
+		p.logger.Warn("not normalizing %s: %v", path, err)
+		return 1, true
+	}
+	if peak <= 0 {
+		return 1, true // Silence stays as it is
+	}
+	return min(normalizationTargetPeak/float64(peak), maxNormalizationGain), true
+}
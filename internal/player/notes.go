@@ -0,0 +1,67 @@
+package player
+
+import (
+	"maps"
+
+	"musicplayer/internal/files"
+)
+
+// --- Notes ---
+
+// SetMusicDirectories sets the directories notes and favorites are keyed relative to,
+// so they stay attached to their tracks when the directories move.
+// Tracks are also grouped by their subdirectory under them; see SetGroup.
+func (p *MusicPlayer) SetMusicDirectories(dirs ...files.MusicDirectory) {
+	p.musicDirs = dirs
+}
+
+// noteKey returns the key of the note and the favorite flag for the track at path
+func (p *MusicPlayer) noteKey(path string) string {
+	return files.RelativeToMusicDir(path, p.musicDirs...)
+}
+
+// SetNote sets the reviewer's note for the track at path. Empty text removes the note.
+func (p *MusicPlayer) SetNote(path, text string) {
+	if path == "" {
+		return
+	}
+	key := p.noteKey(path)
+	if text == "" {
+		delete(p.notes, key)
+		return
+	}
+	if p.notes == nil {
+		p.notes = make(map[string]string)
+	}
+	p.notes[key] = text
+}
+
+// GetNote returns the reviewer's note for the track at path, or an empty string if there is none
+func (p *MusicPlayer) GetNote(path string) string {
+	if path == "" {
+		return ""
+	}
+	return p.notes[p.noteKey(path)]
+}
+
+// getNotes returns the notes keyed by relative path, or nil if there are none
+func (p *MusicPlayer) getNotes() map[string]string {
+	if len(p.notes) == 0 {
+		return nil
+	}
+	return maps.Clone(p.notes)
+}
+
+// setNotes replaces the notes, keyed by relative path
+func (p *MusicPlayer) setNotes(notes map[string]string) {
+	p.notes = nil
+	for key, text := range notes {
+		if key == "" || text == "" {
+			continue
+		}
+		if p.notes == nil {
+			p.notes = make(map[string]string)
+		}
+		p.notes[key] = text
+	}
+}
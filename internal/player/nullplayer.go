@@ -0,0 +1,92 @@
+package player
+
+import (
+	"io"
+	"time"
+)
+
+// --- Null player ---
+
+// nullPlayerFactory creates players that produce no sound
+type nullPlayerFactory struct {
+	sampleRate int
+}
+
+// NewNullPlayerFactory returns a PlayerFactory whose players produce no sound.
+// It stands in for the audio device when there is none, so files can still be listed and inspected.
+func NewNullPlayerFactory() PlayerFactory {
+	return nullPlayerFactory{sampleRate: DefaultSampleRate}
+}
+
+// NewNullPlayerFactoryWithSampleRate returns a silent PlayerFactory whose tracks are decoded at
+// the sample rate, as they would be for an audio context at that rate.
+func NewNullPlayerFactoryWithSampleRate(sampleRate int) PlayerFactory {
+	if sampleRate <= 0 {
+		sampleRate = DefaultSampleRate
+	}
+	return nullPlayerFactory{sampleRate: sampleRate}
+}
+
+// SampleRate returns the rate the factory's tracks are decoded at.
+func (f nullPlayerFactory) SampleRate() int {
+	return f.sampleRate
+}
+
+// NewPlayer creates a silent player. The stream is never read.
+func (nullPlayerFactory) NewPlayer(stream io.Reader) (Player, error) {
+	return &nullPlayer{}, nil
+}
+
+// nullPlayer is a silent Player whose position advances with the clock while playing,
+// so the playback state behaves as it would with sound.
+type nullPlayer struct {
+	playing   bool
+	startedAt time.Time     // When Play was last called
+	offset    time.Duration // Position when Play was last called
+}
+
+// Play starts advancing the position
+func (p *nullPlayer) Play() {
+	if p.playing {
+		return
+	}
+	p.playing = true
+	p.startedAt = time.Now()
+}
+
+// Pause stops advancing the position
+func (p *nullPlayer) Pause() {
+	if !p.playing {
+		return
+	}
+	p.offset = p.Current()
+	p.playing = false
+}
+
+// Close does nothing
+func (p *nullPlayer) Close() error {
+	return nil
+}
+
+// SetVolume does nothing
+func (p *nullPlayer) SetVolume(volume float64) {}
+
+// Current returns the position
+func (p *nullPlayer) Current() time.Duration {
+	if !p.playing {
+		return p.offset
+	}
+	return p.offset + time.Since(p.startedAt)
+}
+
+// SetPosition moves the position
+func (p *nullPlayer) SetPosition(offset time.Duration) error {
+	p.offset = offset
+	p.startedAt = time.Now()
+	return nil
+}
+
+// Rewind moves the position to the start
+func (p *nullPlayer) Rewind() error {
+	return p.SetPosition(0)
+}
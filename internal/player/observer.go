@@ -0,0 +1,81 @@
+package player
+
+// --- PlaybackObserver ---
+
+// PlaybackObserver receives playback events from a MusicPlayer.
+//
+// Events are delivered after the player call that caused them has finished updating its state,
+// so observers may call back into the player.
+type PlaybackObserver interface {
+	// OnTrackChanged is called when a track is loaded, including when it restarts under RepeatOne.
+	OnTrackChanged(path string)
+	// OnStateChanged is called when the player state changes.
+	OnStateChanged(oldState, newState PlayerState)
+	// OnTrackFinished is called when a track ends on its own: after its fade-out,
+	// when a crossfade completes, or when its loop count is reached. Skipping and stopping don't count.
+	OnTrackFinished(path string)
+}
+
+// playbackEvent is a pending notification for an observer
+type playbackEvent func(observer PlaybackObserver)
+
+// AddObserver registers an observer for playback events. nil is ignored.
+func (p *MusicPlayer) AddObserver(observer PlaybackObserver) {
+	if observer == nil {
+		return
+	}
+	p.observers = append(p.observers, observer)
+}
+
+// RemoveObserver unregisters an observer. Unknown observers are ignored.
+func (p *MusicPlayer) RemoveObserver(observer PlaybackObserver) {
+	for i, o := range p.observers {
+		if o == observer {
+			p.observers = append(p.observers[:i:i], p.observers[i+1:]...)
+			return
+		}
+	}
+}
+
+// setState changes the player state and queues a notification.
+func (p *MusicPlayer) setState(state PlayerState) {
+	if p.state == state {
+		return
+	}
+	oldState := p.state
+	p.state = state
+	p.queueEvent(func(o PlaybackObserver) { o.OnStateChanged(oldState, state) })
+}
+
+// trackChanged queues a notification that the current track was loaded.
+func (p *MusicPlayer) trackChanged(path string) {
+	p.queueEvent(func(o PlaybackObserver) { o.OnTrackChanged(path) })
+}
+
+// trackFinished queues a notification that a track ended on its own.
+func (p *MusicPlayer) trackFinished(path string) {
+	p.queueEvent(func(o PlaybackObserver) { o.OnTrackFinished(path) })
+}
+
+func (p *MusicPlayer) queueEvent(event playbackEvent) {
+	if len(p.observers) == 0 {
+		return
+	}
+	p.pendingEvents = append(p.pendingEvents, event)
+}
+
+// dispatchEvents delivers the queued events. Public methods that change the state defer it,
+// so observers run once the player is consistent again.
+func (p *MusicPlayer) dispatchEvents() {
+	for len(p.pendingEvents) > 0 {
+		events := p.pendingEvents
+		p.pendingEvents = nil
+		// Copy so observers can add or remove observers while being notified
+		observers := append([]PlaybackObserver(nil), p.observers...)
+		for _, event := range events {
+			for _, observer := range observers {
+				event(observer)
+			}
+		}
+	}
+}
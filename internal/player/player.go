@@ -1,19 +1,20 @@
 package player
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"math"
+	"math/rand"
 	"os"
+	"slices"
 	"sync"
 	"time"
 
-	"github.com/hajimehoshi/ebiten/v2/audio"
-	"github.com/hajimehoshi/ebiten/v2/audio/mp3"
-	"github.com/hajimehoshi/ebiten/v2/audio/vorbis"
-	"github.com/hajimehoshi/ebiten/v2/audio/wav"
-
 	"musicplayer/internal/files"
+	"musicplayer/internal/logging"
+	"musicplayer/internal/resample"
 )
 
 // --- MusicSelector ---
@@ -23,6 +24,25 @@ type MusicSelector struct {
 	musicFiles   []string
 	currentIndex int
 	mu           sync.RWMutex
+
+	// Shuffle playback order
+	shuffle  bool
+	order    []int // Permutation of indices into musicFiles
+	orderPos int   // Position of currentIndex in order
+	rng      *rand.Rand
+
+	// List order; durationOf is used by files.SortByDuration
+	sortMode   files.SortMode
+	durationOf files.DurationFunc
+	resorts    int // Times the list was sorted again in the background, once durations were known
+
+	// sourceFiles is the list as last given to Update, in the order the files were found.
+	// The list is arranged from it, so SortNone restores that order.
+	sourceFiles []string
+
+	// customOrder is the order the user arranged the list in, overriding the sort mode.
+	// Files not in it follow in the sort order.
+	customOrder []string
 }
 
 // NewMusicSelector creates a new MusicSelector.
@@ -30,21 +50,208 @@ func NewMusicSelector() *MusicSelector {
 	return &MusicSelector{
 		musicFiles:   make([]string, 0),
 		currentIndex: -1, // No initial selection
+		rng:          rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// SetShuffle enables or disables shuffled playback order.
+// Enabling it creates a new permutation starting from the current track.
+func (s *MusicSelector) SetShuffle(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.shuffle = enabled
+	if enabled {
+		s.reshuffle()
+	} else {
+		s.order = nil
+		s.orderPos = 0
+	}
+}
+
+// IsShuffle returns whether shuffled playback order is enabled.
+func (s *MusicSelector) IsShuffle() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.shuffle
+}
+
+// SetShuffleSeed reseeds the shuffle so the permutation is deterministic (e.g. in tests).
+func (s *MusicSelector) SetShuffleSeed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rng = rand.New(rand.NewSource(seed))
+	if s.shuffle {
+		s.reshuffle()
+	}
+}
+
+// reshuffle creates a new permutation with the current track first.
+// The caller must hold the lock.
+func (s *MusicSelector) reshuffle() {
+	s.order = s.rng.Perm(len(s.musicFiles))
+	s.orderPos = 0
+	for i, index := range s.order {
+		if index == s.currentIndex {
+			s.order[0], s.order[i] = s.order[i], s.order[0]
+			break
+		}
+	}
+}
+
+// SetSortMode sets the order of the music file list and re-sorts it, preserving the current selection.
+func (s *MusicSelector) SetSortMode(mode files.SortMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sortMode = mode
+	// Choosing a sort order replaces the custom order
+	s.customOrder = nil
+	s.update(s.sourceFiles)
+}
+
+// resort sorts the list again if it is still in the sort mode, preserving the current selection,
+// for when the values it is sorted by have changed
+func (s *MusicSelector) resort(mode files.SortMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sortMode == mode && s.customOrder == nil {
+		s.update(s.sourceFiles)
+		s.resorts++
+	}
+}
+
+// Resorts returns the number of times the list was sorted again in the background
+func (s *MusicSelector) Resorts() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.resorts
+}
+
+// CustomOrder returns the order the user arranged the list in, or nil if the sort mode applies.
+func (s *MusicSelector) CustomOrder() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.customOrder)
+}
+
+// SetCustomOrder arranges the list in the given order, preserving the current selection.
+// Files not in the order follow in the sort order; nil goes back to the sort order.
+func (s *MusicSelector) SetCustomOrder(order []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.customOrder = slices.Clone(order)
+	s.update(s.sourceFiles)
+}
+
+// Move moves the file at index from to index to, shifting the files in between,
+// and keeps the same track selected. The new list order becomes the custom order.
+func (s *MusicSelector) Move(from, to int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if from < 0 || from >= len(s.musicFiles) || to < 0 || to >= len(s.musicFiles) {
+		return fmt.Errorf("selector index out of range: %d to %d (count: %d)", from, to, len(s.musicFiles))
+	}
+	if from == to {
+		return nil
+	}
+
+	// newIndex maps the old index of each file to its index after the move
+	newIndex := make([]int, len(s.musicFiles))
+	for i := range newIndex {
+		switch {
+		case i == from:
+			newIndex[i] = to
+		case from < to && i > from && i <= to:
+			newIndex[i] = i - 1
+		case to < from && i >= to && i < from:
+			newIndex[i] = i + 1
+		default:
+			newIndex[i] = i
+		}
+	}
+
+	moved := s.musicFiles[from]
+	s.musicFiles = slices.Insert(slices.Delete(s.musicFiles, from, from+1), to, moved)
+	if s.currentIndex >= 0 {
+		s.currentIndex = newIndex[s.currentIndex]
+	}
+	// The shuffled playback order refers to the same tracks
+	for i, index := range s.order {
+		s.order[i] = newIndex[index]
 	}
+	s.customOrder = slices.Clone(s.musicFiles)
+	return nil
+}
+
+// arrange returns the files in list order: sorted by the sort mode, then in the custom order.
+// The caller must hold the lock.
+func (s *MusicSelector) arrange(musicFiles []string) []string {
+	sorted := files.SortMusicFiles(musicFiles, s.sortMode, s.durationOf)
+	if s.customOrder == nil {
+		return sorted
+	}
+
+	position := make(map[string]int, len(s.customOrder))
+	for i, path := range s.customOrder {
+		if _, ok := position[path]; !ok {
+			position[path] = i
+		}
+	}
+	// Files in the custom order come first, in that order; the rest keep the sort order
+	slices.SortStableFunc(sorted, func(a, b string) int {
+		posA, okA := position[a]
+		posB, okB := position[b]
+		switch {
+		case okA && okB:
+			return posA - posB
+		case okA:
+			return -1
+		case okB:
+			return 1
+		default:
+			return 0
+		}
+	})
+	return sorted
+}
+
+// SortMode returns the order of the music file list.
+func (s *MusicSelector) SortMode() files.SortMode {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sortMode
+}
+
+// SetDurationFunc sets the function used to look up durations when sorting by duration.
+func (s *MusicSelector) SetDurationFunc(durationOf files.DurationFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.durationOf = durationOf
 }
 
 // Update updates the list of music files, trying to preserve the current selection.
+// The list is sorted according to the sort mode.
 func (s *MusicSelector) Update(newFiles []string) (indexChanged bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.update(newFiles)
+}
 
+// update implements Update. The caller must hold the lock.
+func (s *MusicSelector) update(newFiles []string) (indexChanged bool) {
 	currentPath := ""
 	if s.currentIndex >= 0 && s.currentIndex < len(s.musicFiles) {
 		currentPath = s.musicFiles[s.currentIndex]
 	}
 
 	oldIndex := s.currentIndex
-	s.musicFiles = newFiles
+	s.sourceFiles = slices.Clone(newFiles)
+	s.musicFiles = s.arrange(s.sourceFiles)
 	newIndex := -1
 
 	// Find the index of the preserved track in the new list
@@ -67,6 +274,9 @@ func (s *MusicSelector) Update(newFiles []string) (indexChanged bool) {
 	}
 
 	s.currentIndex = newIndex
+	if s.shuffle {
+		s.reshuffle()
+	}
 	return oldIndex != s.currentIndex
 }
 
@@ -103,6 +313,12 @@ func (s *MusicSelector) SelectNext() bool {
 	}
 
 	oldIndex := s.currentIndex
+	if s.shuffle {
+		s.orderPos = (s.orderPos + 1) % len(s.order)
+		s.currentIndex = s.order[s.orderPos]
+		return oldIndex != s.currentIndex
+	}
+
 	s.currentIndex++
 	if s.currentIndex >= len(s.musicFiles) {
 		s.currentIndex = 0
@@ -110,6 +326,96 @@ func (s *MusicSelector) SelectNext() bool {
 	return oldIndex != s.currentIndex
 }
 
+// SelectPrevious selects the previous file in the list, looping back to the end if necessary.
+// Returns true if the index changed.
+func (s *MusicSelector) SelectPrevious() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.musicFiles) == 0 {
+		s.currentIndex = -1
+		return false // No change if list is empty
+	}
+
+	oldIndex := s.currentIndex
+	if s.shuffle {
+		s.orderPos = (s.orderPos - 1 + len(s.order)) % len(s.order)
+		s.currentIndex = s.order[s.orderPos]
+		return oldIndex != s.currentIndex
+	}
+
+	s.currentIndex--
+	if s.currentIndex < 0 {
+		s.currentIndex = len(s.musicFiles) - 1
+	}
+	return oldIndex != s.currentIndex
+}
+
+// SelectRandom selects a uniformly random file other than the current one, if there is another.
+// The list order and shuffle mode are unchanged, so SelectNext continues from the selected file.
+// Returns true if the index changed.
+func (s *MusicSelector) SelectRandom() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.musicFiles) == 0 {
+		s.currentIndex = -1
+		return false // No change if list is empty
+	}
+
+	oldIndex := s.currentIndex
+	if oldIndex < 0 || oldIndex >= len(s.musicFiles) {
+		s.currentIndex = s.rng.Intn(len(s.musicFiles))
+	} else if len(s.musicFiles) > 1 {
+		// Pick among the others by skipping over the current index
+		s.currentIndex = s.rng.Intn(len(s.musicFiles) - 1)
+		if s.currentIndex >= oldIndex {
+			s.currentIndex++
+		}
+	}
+	if s.shuffle {
+		for i, orderIndex := range s.order {
+			if orderIndex == s.currentIndex {
+				s.orderPos = i
+				break
+			}
+		}
+	}
+	return oldIndex != s.currentIndex
+}
+
+// PeekNext returns the path SelectNext would select, without changing the selection.
+func (s *MusicSelector) PeekNext() (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.musicFiles) == 0 {
+		return "", false
+	}
+	if s.shuffle {
+		return s.musicFiles[s.order[(s.orderPos+1)%len(s.order)]], true
+	}
+	nextIndex := s.currentIndex + 1
+	if nextIndex >= len(s.musicFiles) {
+		nextIndex = 0
+	}
+	return s.musicFiles[nextIndex], true
+}
+
+// IsLast reports whether the current track is the last one in playback order.
+func (s *MusicSelector) IsLast() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.musicFiles) == 0 {
+		return true
+	}
+	if s.shuffle {
+		return s.orderPos >= len(s.order)-1
+	}
+	return s.currentIndex >= len(s.musicFiles)-1
+}
+
 // SelectIndex attempts to select the file at the given index.
 // Returns an error if the index is out of bounds.
 func (s *MusicSelector) SelectIndex(index int) error {
@@ -120,6 +426,14 @@ func (s *MusicSelector) SelectIndex(index int) error {
 		return fmt.Errorf("selector index out of range: %d (count: %d)", index, len(s.musicFiles))
 	}
 	s.currentIndex = index
+	if s.shuffle {
+		for i, orderIndex := range s.order {
+			if orderIndex == index {
+				s.orderPos = i
+				break
+			}
+		}
+	}
 	return nil
 }
 
@@ -134,57 +448,255 @@ func (s *MusicSelector) CurrentIndex() int {
 
 // MusicLoader handles loading audio streams from file paths.
 type MusicLoader struct {
-	// No fields needed for now, could add configuration later (e.g., sample rate)
+	durations          map[string]durationCacheEntry
+	metadata           map[string]metadataCacheEntry
+	waveforms          map[string]waveformCacheEntry
+	peaks              map[string]peakCacheEntry
+	waveformBuckets    int             // Resolution of the waveform last requested with Waveform
+	pendingWaveforms   map[string]bool // Waveforms being computed in the background
+	computingDurations bool            // Whether durations are being computed in the background
+	durationsVersion   int             // Incremented whenever a duration is cached
+	probeConcurrency   int             // Workers probing the library; 0 or less is one per CPU
+	sampleRate         int             // Rate streams are decoded at
+	decoder            Decoder
+	logger             logging.Logger
+	mu                 sync.Mutex
 }
 
-// NewMusicLoader creates a new MusicLoader.
+// durationCacheEntry is a cached track duration, valid while the file is unchanged.
+// Failures are cached too, so a broken file isn't decoded again for every lookup.
+type durationCacheEntry struct {
+	modTime  time.Time
+	size     int64
+	duration time.Duration
+	err      error
+}
+
+// NewMusicLoader creates a new MusicLoader decoding at DefaultSampleRate.
 func NewMusicLoader() *MusicLoader {
-	return &MusicLoader{}
+	return NewMusicLoaderWithSampleRate(DefaultSampleRate)
+}
+
+// NewMusicLoaderWithSampleRate creates a new MusicLoader decoding streams at the sample rate.
+// It must be the rate of the audio context the streams are played through.
+// A rate of 0 or less uses DefaultSampleRate.
+func NewMusicLoaderWithSampleRate(sampleRate int) *MusicLoader {
+	if sampleRate <= 0 {
+		sampleRate = DefaultSampleRate
+	}
+	return &MusicLoader{
+		durations:        make(map[string]durationCacheEntry),
+		metadata:         make(map[string]metadataCacheEntry),
+		waveforms:        make(map[string]waveformCacheEntry),
+		peaks:            make(map[string]peakCacheEntry),
+		pendingWaveforms: make(map[string]bool),
+		sampleRate:       sampleRate,
+		decoder:          DefaultDecoder(),
+		logger:           logging.Default(),
+	}
+}
+
+// SampleRate returns the sample rate streams are decoded at.
+func (l *MusicLoader) SampleRate() int {
+	return l.sampleRate
+}
+
+// SetLogger sets the logger for decoding problems; nil discards them.
+func (l *MusicLoader) SetLogger(logger logging.Logger) {
+	if logger == nil {
+		logger = logging.Discard()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logger = logger
+}
+
+// SetDecoder sets the decoder for the audio files; nil restores DefaultDecoder.
+// Cached durations and waveforms are kept, so it should be set before files are loaded.
+func (l *MusicLoader) SetDecoder(decoder Decoder) {
+	if decoder == nil {
+		decoder = DefaultDecoder()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.decoder = decoder
+}
+
+// getDecoder returns the decoder; it is used from background decodes too
+func (l *MusicLoader) getDecoder() Decoder {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.decoder
+}
+
+// decode decodes f with the decoder. MP3 files are trimmed of the silence the encoder added,
+// whichever decoder is set.
+func (l *MusicLoader) decode(f io.ReadSeeker, format files.Format, sampleRate int) (DecodedStream, error) {
+	if format == files.FormatMp3 {
+		return decodeMp3(l.getDecoder(), f, sampleRate)
+	}
+	return l.getDecoder().Decode(f, format, sampleRate)
+}
+
+// getLogger returns the logger, which may be replaced while waveforms are computed in the background
+func (l *MusicLoader) getLogger() logging.Logger {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.logger
 }
 
 // LoadStream opens and decodes an audio file from the given path.
 // It returns a readable and seekable stream, or an error.
 func (l *MusicLoader) LoadStream(filePath string) (io.ReadSeeker, error) {
+	return l.LoadStreamContext(context.Background(), filePath)
+}
+
+// LoadStreamContext is LoadStream, giving up on decoding once ctx is done.
+// The returned stream isn't bound to ctx, so it keeps playing after ctx is cancelled.
+func (l *MusicLoader) LoadStreamContext(ctx context.Context, filePath string) (io.ReadSeeker, error) {
 	// Open the file
-	f, err := os.Open(filePath)
+	f, err := openContextFile(ctx, filePath)
 	if err != nil {
 		return nil, fmt.Errorf("loader: failed to open audio file %s: %v", filePath, err)
 	}
 
-	// Decode based on file extension
-	var audioStream io.ReadSeeker
-	var decodeErr error
+	// Decode based on the actual content, so mislabeled files still play
+	format := detectFormat(filePath)
+	if extFormat := files.FormatFromExtension(filePath); format != extFormat {
+		l.getLogger().Warn("%s contains %s data despite its extension", filePath, format)
+	}
 
-	if files.IsWavFile(filePath) {
-		audioStream, decodeErr = wav.DecodeWithSampleRate(sampleRate, f)
-	} else if files.IsOggFile(filePath) {
-		audioStream, decodeErr = vorbis.DecodeWithSampleRate(sampleRate, f)
-	} else if files.IsMp3File(filePath) {
-		audioStream, decodeErr = mp3.DecodeWithSampleRate(sampleRate, f)
-	} else {
-		f.Close() // Close the file if format is unsupported
-		return nil, fmt.Errorf("loader: unsupported audio format: %s", filePath)
+	audioStream, err := l.decode(f, format, l.sampleRate)
+	if err != nil {
+		f.Close() // Close the file if decoding fails
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("loader: decoding %s was cancelled: %v", filePath, ctx.Err())
+		}
+		return nil, fmt.Errorf("loader: failed to decode audio %s: %v", filePath, err)
+	}
+	f.detach()
+
+	// The decoder reads the file as the stream is played, so the file is closed along with the stream.
+	// The stream should be closed by the consumer (e.g., Music.Close).
+	return &fileStream{DecodedStream: audioStream, file: f}, nil
+}
+
+// fileStream is a decoded stream that closes the file it decodes when it is closed
+type fileStream struct {
+	DecodedStream
+	file io.Closer
+}
+
+// Close closes the file
+func (s *fileStream) Close() error {
+	return s.file.Close()
+}
+
+// detectFormat returns the format of the file by its content, falling back to the extension
+// when the content isn't recognized.
+func detectFormat(filePath string) files.Format {
+	format, err := files.DetectFormat(filePath)
+	if err != nil {
+		return files.FormatFromExtension(filePath)
+	}
+	return format
+}
+
+// GetDuration returns the duration of the audio file at the given path.
+// Results are cached until the file's size or modification time changes.
+func (l *MusicLoader) GetDuration(filePath string) (time.Duration, error) {
+	return l.GetDurationContext(context.Background(), filePath)
+}
+
+// GetDurationContext is GetDuration, giving up on decoding once ctx is done.
+// A cancelled decode isn't cached.
+func (l *MusicLoader) GetDurationContext(ctx context.Context, filePath string) (time.Duration, error) {
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("loader: failed to stat audio file %s: %v", filePath, err)
+	}
+
+	l.mu.Lock()
+	entry, ok := l.durations[filePath]
+	l.mu.Unlock()
+	if ok && entry.modTime.Equal(stat.ModTime()) && entry.size == stat.Size() {
+		return entry.duration, entry.err
+	}
+
+	duration, err := l.decodeDuration(ctx, filePath)
+	if ctx.Err() != nil {
+		return 0, fmt.Errorf("loader: decoding %s was cancelled: %v", filePath, ctx.Err())
+	}
+
+	l.mu.Lock()
+	l.durations[filePath] = durationCacheEntry{
+		modTime:  stat.ModTime(),
+		size:     stat.Size(),
+		duration: duration,
+		err:      err,
+	}
+	l.durationsVersion++
+	l.mu.Unlock()
+
+	return duration, err
+}
+
+// cachedDuration returns the cached duration of the audio file without decoding it,
+// or an error if it hasn't been computed yet
+func (l *MusicLoader) cachedDuration(filePath string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.durations[filePath]
+	if !ok {
+		return 0, fmt.Errorf("loader: duration of %s isn't known yet", filePath)
+	}
+	return entry.duration, entry.err
+}
+
+// decodeDuration decodes the audio file to measure its duration
+func (l *MusicLoader) decodeDuration(ctx context.Context, filePath string) (time.Duration, error) {
+	f, err := openContextFile(ctx, filePath)
+	if err != nil {
+		return 0, fmt.Errorf("loader: failed to open audio file %s: %v", filePath, err)
 	}
+	defer f.Close()
 
+	// Decode without resampling; only the length and sample rate are needed
+	stream, decodeErr := l.decode(f, detectFormat(filePath), 0)
 	if decodeErr != nil {
-		f.Close() // Close the file if decoding fails
-		return nil, fmt.Errorf("loader: failed to decode audio %s: %v", filePath, decodeErr)
+		return 0, fmt.Errorf("loader: failed to decode audio %s: %v", filePath, decodeErr)
+	}
+	if stream.SampleRate() <= 0 {
+		return 0, fmt.Errorf("loader: invalid sample rate for %s: %d", filePath, stream.SampleRate())
 	}
 
-	// Note: The file 'f' is kept open by the stream decoder (wav, vorbis, mp3).
-	// The stream (and thus the file) should be closed by the consumer (e.g., Player.Close).
-	return audioStream, nil
+	bytesPerSecond := int64(stream.SampleRate()) * bytesPerSample
+	return time.Duration(stream.Length()) * time.Second / time.Duration(bytesPerSecond), nil
 }
 
 // --- Constants & PlayerState ---
 
+// DefaultSampleRate is the sample rate tracks are decoded and played at unless the
+// PlayerFactory reports another one
+const DefaultSampleRate = 48000
+
+// DefaultLoopPresets are the loop durations in minutes that CycleLoopPreset steps through
+// unless SetLoopPresets sets others
+var DefaultLoopPresets = []float64{0.5, 1, 2, 5}
+
 // Constants for the player
 const (
-	sampleRate     = 48000
 	bytesPerSample = 4
 
+	// defaultTPS is the number of Update calls per second unless set with SetTPS
+	defaultTPS = 60
+
 	// Fade-out constants
-	fadeOutDuration = 2 * time.Second // 2 second fadeout
+	defaultFadeOutDuration = 2 * time.Second // 2 second fadeout
+
+	// Playback speed range
+	minPlaybackSpeed = 0.25
+	maxPlaybackSpeed = 4.0
 )
 
 // Player state enum
@@ -195,17 +707,108 @@ const (
 	StatePlaying
 	StateFadingOut
 	StateInterval
+	StateLoading // Waiting for the track to be decoded in the background; see SetBackgroundLoading
+)
+
+// String returns the name of the state
+func (s PlayerState) String() string {
+	switch s {
+	case StateStopped:
+		return "Stopped"
+	case StatePlaying:
+		return "Playing"
+	case StateFadingOut:
+		return "FadingOut"
+	case StateInterval:
+		return "Interval"
+	case StateLoading:
+		return "Loading"
+	default:
+		return fmt.Sprintf("PlayerState(%d)", int(s))
+	}
+}
+
+// RepeatMode controls what happens when a track finishes
+type RepeatMode int
+
+const (
+	RepeatAll RepeatMode = iota // Advance and wrap around at the end of the list
+	RepeatOne                   // Keep replaying the current track
+	RepeatOff                   // Advance and stop after the last track
+)
+
+// String returns a display name for the repeat mode
+func (m RepeatMode) String() string {
+	switch m {
+	case RepeatAll:
+		return "All"
+	case RepeatOne:
+		return "One"
+	case RepeatOff:
+		return "Off"
+	default:
+		return fmt.Sprintf("RepeatMode(%d)", int(m))
+	}
+}
+
+// Next returns the repeat mode that follows m when cycling through modes
+func (m RepeatMode) Next() RepeatMode {
+	switch m {
+	case RepeatAll:
+		return RepeatOne
+	case RepeatOne:
+		return RepeatOff
+	default:
+		return RepeatAll
+	}
+}
+
+// FadeCurve is how the volume changes over a fade
+type FadeCurve int
+
+const (
+	FadeLinear     FadeCurve = iota // Volume falls in a straight line; crossfades dip in the middle
+	FadeEqualPower                  // Cosine/sine gains, keeping the combined power constant in a crossfade
 )
 
+// String returns a display name for the fade curve
+func (c FadeCurve) String() string {
+	switch c {
+	case FadeLinear:
+		return "Linear"
+	case FadeEqualPower:
+		return "Equal power"
+	default:
+		return fmt.Sprintf("FadeCurve(%d)", int(c))
+	}
+}
+
+// Gains returns the volume (0.0-1.0) of the track fading out and of the one fading in,
+// at the given progress of the fade from 0 to 1.
+func (c FadeCurve) Gains(progress float64) (out, in float64) {
+	progress = min(max(progress, 0), 1)
+	if c == FadeEqualPower {
+		return math.Cos(progress * math.Pi / 2), math.Sin(progress * math.Pi / 2)
+	}
+	return 1 - progress, progress
+}
+
 // Player interface abstracts audio player operations
 type Player interface {
 	Play()
 	Pause()
 	Close() error
 	SetVolume(volume float64)
+	Current() time.Duration
+	SetPosition(offset time.Duration) error
+	Rewind() error
 }
 
-// PlayerFactory interface abstracts audio player creation
+// PlayerFactory interface abstracts audio player creation.
+// A factory that also has a SampleRate() int method, as audio.Context does, sets the rate tracks
+// are decoded at, so the streams always match the context; others get DefaultSampleRate.
+// A factory that also has a Decoder() Decoder method decodes the files for its players, unless
+// NewMusicPlayerWithDecoder is given a decoder; others get DefaultDecoder.
 type PlayerFactory interface {
 	NewPlayer(stream io.Reader) (Player, error)
 }
@@ -214,8 +817,23 @@ type PlayerFactory interface {
 
 // Music wraps a Player instance and holds metadata or state related to a specific track.
 type Music struct {
-	player Player // The underlying audio player
-	// Future fields: isImpressive bool, notes string, etc.
+	player Player        // The underlying audio player
+	path   string        // File the stream was loaded from
+	stream io.ReadSeeker // Decoded stream the player reads, closed along with it
+
+	// Loop structure of the stream in player time, to count how often the track has played through
+	introLength   time.Duration // Part played once before the loop
+	loopLength    time.Duration // Repeating part
+	hasLoopPoints bool          // Whether the file marks a loop region, rather than looping whole
+
+	meter *levelMeter  // Measures the samples as the player reads them
+	mixer *stereoMixer // Pans the stream or folds it to mono
+	eq    *shelfEQ     // Preview EQ, after panning
+	gain  float64      // Normalization gain applied on top of the volume
+	// Whether the gain waits for the peak of the track, which is computed in the background
+	gainPending bool
+	volume      float64 // Volume as last set, before the gain
+	// Favorites are kept by path in MusicPlayer, so they outlive the loaded stream
 }
 
 // NewMusic creates a new Music instance wrapping a Player.
@@ -223,15 +841,22 @@ func NewMusic(player Player) *Music {
 	if player == nil {
 		return nil // Avoid creating Music with a nil player
 	}
-	return &Music{player: player}
+	return &Music{player: player, gain: 1, volume: 1}
 }
 
-// Close closes the underlying player.
+// Close closes the underlying player, then the decoded stream so its file isn't left open.
 func (m *Music) Close() error {
-	if m.player == nil {
-		return nil
+	var err error
+	if m.player != nil {
+		err = m.player.Close()
 	}
-	return m.player.Close()
+	if closer, ok := m.stream.(io.Closer); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	m.stream = nil
+	return err
 }
 
 // Delegate methods to the underlying player
@@ -248,36 +873,191 @@ func (m *Music) Pause() {
 	}
 }
 
+// SetVolume sets the volume scaled by the normalization gain, up to full volume.
 func (m *Music) SetVolume(volume float64) {
+	m.volume = volume
 	if m.player != nil {
-		m.player.SetVolume(volume)
+		m.player.SetVolume(min(volume*m.gain, 1))
 	}
 }
 
-// --- MusicPlayer ---
+func (m *Music) Current() time.Duration {
+	if m.player != nil {
+		return m.player.Current()
+	}
+	return 0
+}
 
-// MusicPlayer handles music playback orchestration
-type MusicPlayer struct {
-	playerFactory PlayerFactory
-	loader        *MusicLoader
-	currentMusic  *Music        // Changed from player Player to currentMusic *Music
-	audioStream   io.ReadSeeker // Keep track for potential explicit close if needed
-	selector      *MusicSelector
+func (m *Music) SetPosition(offset time.Duration) error {
+	if m.player != nil {
+		return m.player.SetPosition(offset)
+	}
+	return nil
+}
 
-	// Control variables
-	state            PlayerState
-	counter          int
-	isPaused         bool
-	loopDuration     float64 // in minutes
-	intervalDuration float64 // in seconds
-	volume           float64 // Current volume (0.0-1.0)
+func (m *Music) Rewind() error {
+	if m.player != nil {
+		return m.player.Rewind()
+	}
+	return nil
 }
 
-// NewMusicPlayer creates a new music player
-func NewMusicPlayer(initialMusicFiles []string, playerFactory PlayerFactory) (*MusicPlayer, error) {
+// Levels returns the peak and RMS levels (0.0-1.0) of the samples most recently read by the player
+func (m *Music) Levels() (peak, rms float64) {
+	if m.meter == nil {
+		return 0, 0
+	}
+	return m.meter.Levels()
+}
+
+// DidClip reports whether any sample the player read reached full scale
+func (m *Music) DidClip() bool {
+	return m.meter != nil && m.meter.Clipped()
+}
+
+// loopsAt returns how many times the track has played through at the given player position.
+// The position keeps increasing while the stream loops, as with audio.Player.
+func (m *Music) loopsAt(pos time.Duration) int {
+	if m.loopLength <= 0 || pos < m.introLength {
+		return 0
+	}
+	return int((pos - m.introLength) / m.loopLength)
+}
+
+// trackPosition returns the position within the stream, wrapping the loops played back to the loop start
+func (m *Music) trackPosition(pos time.Duration) time.Duration {
+	return pos - time.Duration(m.loopsAt(pos))*m.loopLength
+}
+
+// --- MusicPlayer ---
+
+// MusicPlayer handles music playback orchestration.
+//
+// MusicPlayer is not safe for concurrent use: call its methods from a single goroutine,
+// the one calling Update. Music lists found on other goroutines, such as by a DirectoryWatcher,
+// are handed over with QueueMusicFiles, the only method safe to call from any goroutine.
+type MusicPlayer struct {
+	playerFactory PlayerFactory
+	loader        *MusicLoader
+	currentMusic  *Music        // Changed from player Player to currentMusic *Music
+	audioStream   io.ReadSeeker // Keep track for potential explicit close if needed
+	selector      *MusicSelector
+
+	// Normalization: each track's volume is scaled so their peaks match
+	normalize bool
+
+	// Crossfade: the next track is loaded while the current one fades out
+	crossfadeEnabled bool
+	fadeCurve        FadeCurve // Shape of the fade-out and of the crossfade's fade-in
+	nextMusic        *Music
+	nextAudioStream  io.ReadSeeker
+
+	// Calibration tone, played in place of the paused track; see PlayTestTone
+	testTone      *Music
+	testToneLabel string
+
+	// Control variables
+	state            PlayerState
+	counter          int // Updates since the state began
+	tps              int // Updates per second, to convert durations to counts
+	isPaused         bool
+	loopDuration     float64   // in minutes
+	loopPresets      []float64 // Loop durations in minutes for CycleLoopPreset, in ascending order
+	intervalDuration float64   // in seconds
+	fadeOutDuration  time.Duration
+	volume           float64 // Current fade level (0.0-1.0)
+	masterVolume     float64 // User-selected volume (0.0-1.0), applied on top of fades
+	muted            bool
+	unmutedVolume    float64 // Master volume to restore when unmuting
+	repeatMode       RepeatMode
+	autoAdvance      bool    // Whether a finished track is followed by the next; see SetAutoAdvance
+	playbackSpeed    float64 // Playback rate; pitch changes along with speed
+	pan              float64 // Balance from -1 (left) to 1 (right)
+	forceMono        bool
+	speedRemainder   float64 // Fraction of a track frame carried over to the next Update
+
+	// Preview EQ; see SetEQ
+	eqLowGainDB  float64
+	eqHighGainDB float64
+	eqBypassed   bool
+
+	// Load errors, so a broken file can be reported to the user
+	lastError   error
+	onLoadError func(path string, err error)
+
+	// A-B loop region within the current track
+	hasLoopRegion bool
+	loopStart     time.Duration
+	loopEnd       time.Duration
+	auditioning   bool // The loop region is the window across the loop seam; see AuditionLoopSeam
+
+	// Observers of playback events, and events waiting to be delivered to them
+	observers     []PlaybackObserver
+	pendingEvents []playbackEvent
+
+	// Recently started tracks, oldest first
+	history []string
+
+	// Pause on focus loss; autoPaused marks a pause made by losing focus rather than by the user
+	pauseOnFocusLoss bool
+	autoPaused       bool
+	unfocused        bool
+
+	logger logging.Logger
+
+	// A/B comparison: comparing is set while compareTrack plays in place of the selected track
+	compareTrack string
+	comparing    bool
+
+	// Tracks flagged as favorites while reviewing, keyed by path
+	favorites map[string]bool
+
+	// Reviewer's notes, keyed by path relative to musicDirs
+	notes     map[string]string
+	musicDirs []files.MusicDirectory
+
+	// Full music list, and the group it is filtered to ("" lists every file)
+	allFiles []string
+	group    string
+
+	// Loop count limit: the track stops after looping loopCount times (0 means forever)
+	loopCount    int
+	loopsPlayed  int
+	lastPosition time.Duration // Player position at the last Update
+
+	// Decoding tracks in the background: the load in flight, and every load goroutine still running
+	backgroundLoading bool
+	loading           *pendingLoad
+	loads             sync.WaitGroup
+
+	// Cancels the durations being computed to sort the list again, if any
+	cancelResort context.CancelFunc
+
+	// Music list handed over from another goroutine, waiting for ApplyQueuedMusicFiles
+	queueMu     sync.Mutex
+	queuedFiles []string
+	hasQueued   bool
+}
+
+// NewMusicPlayer creates a new music player
+func NewMusicPlayer(initialMusicFiles []string, playerFactory PlayerFactory) (*MusicPlayer, error) {
+	return NewMusicPlayerWithDecoder(initialMusicFiles, playerFactory, nil)
+}
+
+// NewMusicPlayerWithDecoder creates a new music player decoding its files with the decoder, so it
+// can play through an audio backend other than Ebitengine's; nil uses the decoder of playerFactory,
+// or DefaultDecoder.
+// The player plays whatever the decoded streams hold through the players of playerFactory.
+func NewMusicPlayerWithDecoder(initialMusicFiles []string, playerFactory PlayerFactory, decoder Decoder) (*MusicPlayer, error) {
 	// Create player components
 	selector := NewMusicSelector()
-	loader := NewMusicLoader() // Create loader
+	rate := factorySampleRate(playerFactory)
+	if f, ok := playerFactory.(interface{ Decoder() Decoder }); ok && decoder == nil {
+		decoder = f.Decoder()
+	}
+	loader := NewMusicLoaderWithSampleRate(rate) // Create loader decoding at the context's rate
+	loader.SetDecoder(decoder)
+	selector.SetDurationFunc(loader.cachedDuration)
 
 	player := &MusicPlayer{
 		playerFactory: playerFactory,
@@ -285,9 +1065,18 @@ func NewMusicPlayer(initialMusicFiles []string, playerFactory PlayerFactory) (*M
 		selector:      selector,
 		// currentMusic is initially nil
 		state:            StateStopped,
+		tps:              defaultTPS,
 		loopDuration:     5.0,
+		loopPresets:      slices.Clone(DefaultLoopPresets),
 		intervalDuration: 10.0,
+		fadeOutDuration:  defaultFadeOutDuration,
 		volume:           1.0,
+		masterVolume:     1.0,
+		repeatMode:       RepeatAll,
+		autoAdvance:      true,
+		playbackSpeed:    1.0,
+		logger:           logging.Default(),
+		allFiles:         slices.Clone(initialMusicFiles),
 	}
 
 	// Update selector with the initial list but DO NOT load the music yet.
@@ -297,38 +1086,141 @@ func NewMusicPlayer(initialMusicFiles []string, playerFactory PlayerFactory) (*M
 	return player, nil // Return player even if initial load failed
 }
 
+// SampleRate returns the sample rate tracks are decoded and played at.
+func (p *MusicPlayer) SampleRate() int {
+	return p.loader.SampleRate()
+}
+
+// Logger returns the logger the player reports problems to
+func (p *MusicPlayer) Logger() logging.Logger {
+	return p.logger
+}
+
+// SetLogger sets the logger the player and its loader report problems to; nil discards them.
+// The standard logger is used by default.
+func (p *MusicPlayer) SetLogger(logger logging.Logger) {
+	if logger == nil {
+		logger = logging.Discard()
+	}
+	p.logger = logger
+	p.loader.SetLogger(logger)
+}
+
+// NewMusicPlayerFromPlaylist creates a new music player with the files listed in an M3U playlist.
+// Skipped entries, and the player's later problems, are reported to logger; nil discards them.
+func NewMusicPlayerFromPlaylist(playlistPath string, playerFactory PlayerFactory, logger logging.Logger) (*MusicPlayer, error) {
+	musicFiles, err := files.LoadPlaylist(playlistPath, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load playlist %s: %v", playlistPath, err)
+	}
+	player, err := NewMusicPlayer(musicFiles, playerFactory)
+	if err != nil {
+		return nil, err
+	}
+	player.SetLogger(logger)
+	return player, nil
+}
+
 // UpdateMusicFiles updates the music list and loads if necessary.
+// When a group is chosen with SetGroup, only the files in it are listed; the full list is kept.
+// The playing track plays on, uninterrupted, if it is still in the list, wherever the new order puts
+// it; so does a track still loading in the background. If its file was removed, it is closed
+// and the newly selected track is loaded, or playback stops when no files remain.
 func (p *MusicPlayer) UpdateMusicFiles(newFiles []string) {
-	indexChanged := p.selector.Update(newFiles)
+	p.allFiles = slices.Clone(newFiles)
+	p.applyMusicFiles(p.groupFiles())
+}
 
-	if indexChanged {
-		if _, ok := p.selector.CurrentFile(); ok {
-			if err := p.loadCurrentMusic(); err != nil {
-				log.Printf("Failed to load music after file changes: %v", err)
-			}
-		} else {
-			if p.currentMusic != nil {
-				p.currentMusic.Close() // Close the wrapped player
-				p.currentMusic = nil
-			}
-			p.state = StateStopped
-			p.isPaused = false
+// applyMusicFiles implements UpdateMusicFiles for the files to list
+func (p *MusicPlayer) applyMusicFiles(newFiles []string) {
+	defer p.dispatchEvents()
+
+	previousPath, _ := p.selector.CurrentFile()
+	p.selector.Update(newFiles)
+
+	// Drop tracks whose files are gone
+	if p.nextMusic != nil && !slices.Contains(newFiles, p.nextMusic.path) {
+		p.closeNextMusic()
+	}
+	if p.compareTrack != "" && !slices.Contains(newFiles, p.compareTrack) {
+		p.compareTrack = ""
+	}
+
+	if p.currentMusic != nil && p.currentMusic.path != "" {
+		if slices.Contains(newFiles, p.currentMusic.path) {
+			// The loaded track is still there, so it plays on even if its index moved
+			return
+		}
+		// The file being played was removed: close it rather than play on from a stale stream
+		p.currentMusic.Close()
+		p.currentMusic = nil
+		p.comparing = false
+	} else if currentPath, _ := p.selector.CurrentFile(); currentPath == previousPath {
+		// The selection is the same track even if its index moved, so a load in flight carries on
+		return
+	}
+
+	if _, ok := p.selector.CurrentFile(); ok {
+		if err := p.loadCurrentMusic(); err != nil {
+			p.logger.Error("Failed to load music after file changes: %v", err)
+		}
+	} else {
+		p.discardLoad()
+		if p.currentMusic != nil {
+			p.currentMusic.Close() // Close the wrapped player
+			p.currentMusic = nil
 		}
+		p.setState(StateStopped)
+		p.isPaused = false
+	}
+}
+
+// QueueMusicFiles hands a new music list over to the player. It is safe to call from any goroutine,
+// so it can be a DirectoryWatcher handler; the latest list is applied by ApplyQueuedMusicFiles.
+func (p *MusicPlayer) QueueMusicFiles(newFiles []string) {
+	p.queueMu.Lock()
+	defer p.queueMu.Unlock()
+	p.queuedFiles = slices.Clone(newFiles)
+	p.hasQueued = true
+}
+
+// ApplyQueuedMusicFiles applies the music list last passed to QueueMusicFiles with UpdateMusicFiles,
+// and returns whether there was one. Call it from the goroutine calling Update, e.g. once per tick.
+func (p *MusicPlayer) ApplyQueuedMusicFiles() bool {
+	p.queueMu.Lock()
+	newFiles, ok := p.queuedFiles, p.hasQueued
+	p.queuedFiles, p.hasQueued = nil, false
+	p.queueMu.Unlock()
+
+	if !ok {
+		return false
 	}
+	p.UpdateMusicFiles(newFiles)
+	return true
 }
 
 // Close cleans up resources
 func (p *MusicPlayer) Close() error {
+	defer p.dispatchEvents()
+
+	// Wait for decoding in the background to end, so no file is left open
+	p.discardLoad()
+	if p.cancelResort != nil {
+		p.cancelResort()
+		p.cancelResort = nil
+	}
+	p.loads.Wait()
+
+	p.closeNextMusic()
+	p.StopTestTone()
 	if p.currentMusic != nil {
 		if err := p.currentMusic.Close(); err != nil { // Close the wrapped player
 			return fmt.Errorf("failed to close music: %v", err)
 		}
 		p.currentMusic = nil
 	}
-	// audioStream might be managed by the player, but explicit close is safer if needed
-	// if closer, ok := p.audioStream.(io.Closer); ok {
-	// 	 closer.Close()
-	// }
+	p.audioStream = nil
+	p.setState(StateStopped)
 	return nil
 }
 
@@ -339,6 +1231,10 @@ func (p *MusicPlayer) GetMusicFiles() []string {
 
 // GetCurrentPath returns the path of the currently playing music from the selector.
 func (p *MusicPlayer) GetCurrentPath() string {
+	// The compare track plays in place of the selected one
+	if p.comparing && p.currentMusic != nil {
+		return p.currentMusic.path
+	}
 	path, _ := p.selector.CurrentFile()
 	return path
 }
@@ -348,6 +1244,11 @@ func (p *MusicPlayer) GetState() PlayerState {
 	return p.state
 }
 
+// GetStateName returns the name of the current state, e.g. "Playing"
+func (p *MusicPlayer) GetStateName() string {
+	return p.state.String()
+}
+
 // IsPaused returns whether the player is paused
 func (p *MusicPlayer) IsPaused() bool {
 	return p.isPaused
@@ -358,6 +1259,326 @@ func (p *MusicPlayer) GetCounter() int {
 	return p.counter
 }
 
+// GetElapsed returns the time spent in the current state, as counted by Update.
+// While playing it is in track time, like the loop duration.
+func (p *MusicPlayer) GetElapsed() time.Duration {
+	return time.Duration(p.counter) * time.Second / time.Duration(p.tps)
+}
+
+// GetRemainingInterval returns the time left before the next track starts.
+// It returns 0 outside the interval.
+func (p *MusicPlayer) GetRemainingInterval() time.Duration {
+	if p.state != StateInterval {
+		return 0
+	}
+	remaining := p.secondsToCount(p.intervalDuration) - p.counter
+	return max(time.Duration(remaining)*time.Second/time.Duration(p.tps), 0)
+}
+
+// GetFadeProgress returns how far the fade-out has progressed, from 0 to 1.
+// It returns 0 outside the fade-out.
+func (p *MusicPlayer) GetFadeProgress() float64 {
+	if p.state != StateFadingOut {
+		return 0
+	}
+	frames := p.fadeOutFrames()
+	if frames == 0 {
+		return 1
+	}
+	return min(float64(p.counter)/float64(frames), 1)
+}
+
+// fadeOutFrames returns the length of the fade-out in Update calls
+// Zero means there is no fade-out.
+func (p *MusicPlayer) fadeOutFrames() int {
+	if p.fadeOutDuration <= 0 {
+		return 0
+	}
+	// Always advance, even for durations shorter than a frame
+	return max(p.secondsToCount(p.fadeOutDuration.Seconds()), 1)
+}
+
+// GetTPS returns the number of Update calls per second
+func (p *MusicPlayer) GetTPS() int {
+	return p.tps
+}
+
+// SetTPS sets the number of Update calls per second, which Update uses to measure time.
+// It should match the game's ticks per second; values below 1 are ignored.
+// The time already spent in the current state is kept.
+func (p *MusicPlayer) SetTPS(tps int) {
+	if tps < 1 || tps == p.tps {
+		return
+	}
+	p.counter = p.counter * tps / p.tps
+	p.tps = tps
+}
+
+// secondsToCount converts seconds to a number of Update calls
+func (p *MusicPlayer) secondsToCount(seconds float64) int {
+	return int(seconds * float64(p.tps))
+}
+
+// GetDuration returns the duration of the given music file
+func (p *MusicPlayer) GetDuration(path string) (time.Duration, error) {
+	return p.loader.GetDuration(path)
+}
+
+// GetCachedDuration returns the duration of the given music file if it is already known,
+// without decoding it; durations are computed by the library summary and the waveform.
+// It is cheap enough to call every frame.
+func (p *MusicPlayer) GetCachedDuration(path string) (time.Duration, bool) {
+	duration, err := p.loader.cachedDuration(path)
+	return duration, err == nil
+}
+
+// GetDurationsVersion returns a number that changes whenever a duration is cached, so that
+// lists showing GetCachedDuration know when to refresh. It is cheap enough to call every frame.
+func (p *MusicPlayer) GetDurationsVersion() int {
+	p.loader.mu.Lock()
+	defer p.loader.mu.Unlock()
+	return p.loader.durationsVersion
+}
+
+// GetMetadata returns the tags and the cached duration of the given music file; see MusicLoader.ReadMetadata
+func (p *MusicPlayer) GetMetadata(path string) (*TrackMetadata, error) {
+	return p.loader.ReadMetadata(path)
+}
+
+// GetPlaybackPosition returns the actual playback position of the current music, in track time
+func (p *MusicPlayer) GetPlaybackPosition() time.Duration {
+	if p.currentMusic == nil {
+		return 0
+	}
+	// The player counts real time, which runs slower than track time when sped up
+	return time.Duration(float64(p.currentMusic.Current()) * p.playbackSpeed)
+}
+
+// GetTrackPosition returns the position within the current track, going back to the loop start
+// each time the track loops, unlike GetPlaybackPosition.
+func (p *MusicPlayer) GetTrackPosition() time.Duration {
+	if p.currentMusic == nil {
+		return 0
+	}
+	return time.Duration(float64(p.currentMusic.trackPosition(p.currentMusic.Current())) * p.playbackSpeed)
+}
+
+// GetLoopBody returns the part of the current track that repeats, in track time:
+// the A-B region when one is set, otherwise the loop region marked in the file.
+// ok is false when the whole track repeats.
+func (p *MusicPlayer) GetLoopBody() (start, end time.Duration, ok bool) {
+	if p.hasLoopRegion {
+		return p.loopStart, p.loopEnd, true
+	}
+	if p.currentMusic == nil || !p.currentMusic.hasLoopPoints {
+		return 0, 0, false
+	}
+	start = time.Duration(float64(p.currentMusic.introLength) * p.playbackSpeed)
+	end = time.Duration(float64(p.currentMusic.introLength+p.currentMusic.loopLength) * p.playbackSpeed)
+	return start, end, true
+}
+
+// GetCurrentLevels returns the peak and RMS levels (0.0-1.0) of the current track as it plays.
+// The levels are measured before the volume is applied, so they reflect the asset itself.
+// Both are 0 while nothing is audible: stopped, paused or during the interval.
+func (p *MusicPlayer) GetCurrentLevels() (peak, rms float64) {
+	if p.currentMusic == nil || p.isPaused || p.state == StateStopped || p.state == StateInterval {
+		return 0, 0
+	}
+	return p.currentMusic.Levels()
+}
+
+// DidClip reports whether the current track has reached full scale since it was loaded or
+// ResetClip was called. Every track starts unclipped.
+// Only the samples actually played are checked; see Report for whole files.
+func (p *MusicPlayer) DidClip() bool {
+	return p.currentMusic != nil && p.currentMusic.DidClip()
+}
+
+// ResetClip clears the clipping flag of the current track, e.g. after a seek past the loud part.
+func (p *MusicPlayer) ResetClip() {
+	if p.currentMusic != nil && p.currentMusic.meter != nil {
+		p.currentMusic.meter.ResetClipped()
+	}
+}
+
+// setMusicPosition moves the current music to the given position in track time
+func (p *MusicPlayer) setMusicPosition(pos time.Duration) error {
+	playerPos := time.Duration(float64(pos) / p.playbackSpeed)
+	// A jump is not playing through the track
+	p.lastPosition = playerPos
+	return p.currentMusic.SetPosition(playerPos)
+}
+
+// GetLoopCount returns how many times a track plays before stopping (0 means forever)
+func (p *MusicPlayer) GetLoopCount() int {
+	return p.loopCount
+}
+
+// SetLoopCount sets how many times a track plays before stopping; 0 loops forever.
+// Once the count is reached, the interval starts as if the loop duration had elapsed,
+// and the next track follows the repeat mode. The loop duration still applies if it is shorter.
+func (p *MusicPlayer) SetLoopCount(n int) {
+	if n < 0 {
+		n = 0
+	}
+	p.loopCount = n
+}
+
+// GetLoopsPlayed returns how many times the current track has played through
+func (p *MusicPlayer) GetLoopsPlayed() int {
+	return p.loopsPlayed
+}
+
+// resetLoopsPlayed restarts counting loops from the beginning of the track
+func (p *MusicPlayer) resetLoopsPlayed() {
+	p.loopsPlayed = 0
+	p.lastPosition = 0
+}
+
+// countLoops counts the loop boundaries passed since the last Update and
+// reports whether the loop count is reached.
+func (p *MusicPlayer) countLoops() bool {
+	pos := p.currentMusic.Current()
+	if pos < p.lastPosition {
+		// The position went back without a seek: the stream wrapped around
+		p.loopsPlayed++
+	} else {
+		p.loopsPlayed += p.currentMusic.loopsAt(pos) - p.currentMusic.loopsAt(p.lastPosition)
+	}
+	p.lastPosition = pos
+	return p.loopCount > 0 && p.loopsPlayed >= p.loopCount
+}
+
+// GetPlaybackSpeed returns the playback speed
+func (p *MusicPlayer) GetPlaybackSpeed() float64 {
+	return p.playbackSpeed
+}
+
+// SetPlaybackSpeed changes the playback speed, clamped to 0.25-4.0. The pitch changes along with the speed.
+//
+// The loaded track is rebuilt at the new speed and continues from the same position.
+// The loop duration is measured in track time, so it passes faster when sped up.
+// A track being faded in for a crossfade is dropped.
+func (p *MusicPlayer) SetPlaybackSpeed(rate float64) {
+	defer p.dispatchEvents()
+
+	if rate < minPlaybackSpeed {
+		rate = minPlaybackSpeed
+	} else if rate > maxPlaybackSpeed {
+		rate = maxPlaybackSpeed
+	}
+	if rate == p.playbackSpeed {
+		return
+	}
+
+	pos := p.GetPlaybackPosition()
+	p.playbackSpeed = rate
+	p.speedRemainder = 0
+	if p.currentMusic == nil || p.audioStream == nil {
+		return
+	}
+
+	// The compare track may be playing rather than the selected one.
+	// The new player reads the same stream, so it is handed over rather than closed.
+	path := p.currentMusic.path
+	clipped := p.currentMusic.DidClip()
+	p.closeNextMusic()
+	p.currentMusic.stream = nil
+	if err := p.currentMusic.Close(); err != nil {
+		p.logger.Warn("failed to close music: %v", err)
+	}
+	p.currentMusic = nil
+
+	music, err := p.newMusic(path, p.audioStream)
+	if err != nil {
+		p.logger.Error("Failed to change playback speed: %v", err)
+		closeStream(p.audioStream)
+		p.audioStream = nil
+		p.setState(StateStopped)
+		p.isPaused = false
+		return
+	}
+	music.stream = p.audioStream
+	music.meter.setClipped(clipped) // The track hasn't changed, so neither has whether it clipped
+	p.currentMusic = music
+	p.currentMusic.SetVolume(p.volume * p.masterVolume)
+	if err := p.setMusicPosition(pos); err != nil {
+		p.logger.Error("Failed to restore position after changing speed: %v", err)
+	}
+	if (p.state == StatePlaying || p.state == StateFadingOut) && !p.isPaused {
+		p.currentMusic.Play()
+	}
+}
+
+// Seek jumps to the given position in the current track.
+//
+// The elapsed loop time is set to pos, so seeking past the loop duration starts the fade-out
+// on the next Update. The stream is wrapped in an infinite loop, so a position past the
+// end of the track wraps around into the loop (the whole track, or the loop region after the intro).
+// Seeking while fading out or during the interval cancels them and resumes playback.
+// A stopped track stays stopped at the new position.
+func (p *MusicPlayer) Seek(pos time.Duration) error {
+	defer p.dispatchEvents()
+
+	if p.currentMusic == nil {
+		return fmt.Errorf("no music is loaded")
+	}
+	if pos < 0 {
+		return fmt.Errorf("invalid seek position: %v", pos)
+	}
+
+	if err := p.setMusicPosition(pos); err != nil {
+		return fmt.Errorf("failed to seek: %v", err)
+	}
+	p.counter = p.secondsToCount(pos.Seconds())
+	p.speedRemainder = 0
+
+	if p.state == StateFadingOut || p.state == StateInterval {
+		p.closeNextMusic()
+		p.setState(StatePlaying)
+		p.volume = 1.0
+		p.currentMusic.SetVolume(p.volume * p.masterVolume)
+		if !p.isPaused {
+			p.currentMusic.Play()
+		}
+	}
+	return nil
+}
+
+// SetLoopRegion makes playback loop between a and b within the current track.
+// The region is cleared when another track is loaded.
+func (p *MusicPlayer) SetLoopRegion(a, b time.Duration) error {
+	if a < 0 {
+		return fmt.Errorf("invalid loop region start: %v", a)
+	}
+	if a >= b {
+		return fmt.Errorf("invalid loop region: start %v must be before end %v", a, b)
+	}
+	p.hasLoopRegion = true
+	p.loopStart = a
+	p.loopEnd = b
+	return nil
+}
+
+// ClearLoopRegion returns to looping the whole track, ending a loop seam audition
+func (p *MusicPlayer) ClearLoopRegion() {
+	p.hasLoopRegion = false
+	p.loopStart = 0
+	p.loopEnd = 0
+	if p.auditioning {
+		// The audition crossed the seam repeatedly and held off the fade-out, so both start over
+		p.auditioning = false
+		p.counter = 0
+		p.resetLoopsPlayed()
+	}
+}
+
+// GetLoopRegion returns the A-B loop region and whether one is set
+func (p *MusicPlayer) GetLoopRegion() (a, b time.Duration, ok bool) {
+	return p.loopStart, p.loopEnd, p.hasLoopRegion
+}
+
 // GetLoopDurationMinutes returns the loop duration in minutes
 func (p *MusicPlayer) GetLoopDurationMinutes() float64 {
 	return p.loopDuration
@@ -368,6 +1589,39 @@ func (p *MusicPlayer) SetLoopDurationMinutes(minutes float64) {
 	p.loopDuration = minutes
 }
 
+// GetLoopPresets returns the loop duration presets in minutes, in ascending order
+func (p *MusicPlayer) GetLoopPresets() []float64 {
+	return slices.Clone(p.loopPresets)
+}
+
+// SetLoopPresets sets the loop durations in minutes that CycleLoopPreset steps through.
+// They are sorted and duplicates dropped; an empty list or a duration that isn't positive is an error.
+func (p *MusicPlayer) SetLoopPresets(minutes []float64) error {
+	if len(minutes) == 0 {
+		return fmt.Errorf("no loop duration presets")
+	}
+	for _, m := range minutes {
+		if !(m > 0) {
+			return fmt.Errorf("invalid loop duration preset: %v", m)
+		}
+	}
+	presets := slices.Clone(minutes)
+	slices.Sort(presets)
+	p.loopPresets = slices.Compact(presets)
+	return nil
+}
+
+// CycleLoopPreset sets the loop duration to the next preset longer than the current one,
+// wrapping around to the shortest, and returns it
+func (p *MusicPlayer) CycleLoopPreset() float64 {
+	next := p.loopPresets[0]
+	if i := slices.IndexFunc(p.loopPresets, func(m float64) bool { return m > p.loopDuration }); i >= 0 {
+		next = p.loopPresets[i]
+	}
+	p.SetLoopDurationMinutes(next)
+	return next
+}
+
 // GetIntervalSeconds returns the interval duration in seconds
 func (p *MusicPlayer) GetIntervalSeconds() float64 {
 	return p.intervalDuration
@@ -378,6 +1632,204 @@ func (p *MusicPlayer) SetIntervalSeconds(seconds float64) {
 	p.intervalDuration = seconds
 }
 
+// GetFadeOutDuration returns the fade-out duration
+func (p *MusicPlayer) GetFadeOutDuration() time.Duration {
+	return p.fadeOutDuration
+}
+
+// SetFadeOutDuration sets the fade-out duration.
+// Zero skips the fade-out, so with a zero interval tracks follow each other without a gap.
+// Negative durations are treated as zero; durations shorter than one frame still fade over one frame.
+func (p *MusicPlayer) SetFadeOutDuration(d time.Duration) {
+	p.fadeOutDuration = max(d, 0)
+}
+
+// GetMasterVolume returns the master volume (0.0-1.0)
+func (p *MusicPlayer) GetMasterVolume() float64 {
+	return p.masterVolume
+}
+
+// SetMasterVolume sets the master volume, clamped to 0.0-1.0, and applies it immediately.
+// Changing the volume while muted unmutes.
+func (p *MusicPlayer) SetMasterVolume(v float64) {
+	if p.muted && v != p.masterVolume {
+		p.muted = false
+	}
+	p.setMasterVolume(v)
+}
+
+// IsMuted returns whether the player is muted
+func (p *MusicPlayer) IsMuted() bool {
+	return p.muted
+}
+
+// ToggleMute silences the player, or restores the master volume from before muting.
+// Fades keep running while muted, so unmuting mid-fade restores the fade-adjusted level.
+func (p *MusicPlayer) ToggleMute() {
+	if p.muted {
+		p.muted = false
+		p.setMasterVolume(p.unmutedVolume)
+		return
+	}
+	p.unmutedVolume = p.masterVolume
+	p.muted = true
+	p.setMasterVolume(0)
+}
+
+// setMasterVolume implements SetMasterVolume without changing the mute state
+func (p *MusicPlayer) setMasterVolume(v float64) {
+	if v < 0 {
+		v = 0
+	} else if v > 1 {
+		v = 1
+	}
+	p.masterVolume = v
+	if p.currentMusic != nil {
+		p.currentMusic.SetVolume(p.volume * p.masterVolume)
+	}
+	if p.nextMusic != nil {
+		p.nextMusic.SetVolume((1.0 - p.volume) * p.masterVolume)
+	}
+}
+
+// GetRepeatMode returns the repeat mode
+func (p *MusicPlayer) GetRepeatMode() RepeatMode {
+	return p.repeatMode
+}
+
+// SetRepeatMode sets the repeat mode
+func (p *MusicPlayer) SetRepeatMode(mode RepeatMode) {
+	p.repeatMode = mode
+}
+
+// IsAutoAdvance returns whether a finished track is followed by the next one
+func (p *MusicPlayer) IsAutoAdvance() bool {
+	return p.autoAdvance
+}
+
+// SetAutoAdvance sets whether a track that finished on its own, after its loop duration and
+// fade-out or its loop count, is followed by the next one. When off, playback stops on the
+// finished track, rewound, instead of starting the interval, and there is no crossfade.
+// RepeatOne takes precedence: its track keeps repeating either way. Skipping by hand, including
+// SkipInterval, still advances. It is on by default.
+func (p *MusicPlayer) SetAutoAdvance(enabled bool) {
+	p.autoAdvance = enabled
+}
+
+// advancesAutomatically reports whether a finished track is followed by another playthrough
+func (p *MusicPlayer) advancesAutomatically() bool {
+	return p.autoAdvance || p.repeatMode == RepeatOne
+}
+
+// stayOnTrack stops on the finished track instead of advancing when auto-advance is off,
+// and returns whether it did
+func (p *MusicPlayer) stayOnTrack() bool {
+	if p.advancesAutomatically() {
+		return false
+	}
+	if err := p.Stop(); err != nil {
+		p.logger.Error("Failed to stop after the track: %v", err)
+	}
+	return true
+}
+
+// IsShuffleEnabled returns whether shuffled playback order is enabled
+func (p *MusicPlayer) IsShuffleEnabled() bool {
+	return p.selector.IsShuffle()
+}
+
+// SetShuffleEnabled enables or disables shuffled playback order
+func (p *MusicPlayer) SetShuffleEnabled(enabled bool) {
+	p.selector.SetShuffle(enabled)
+}
+
+// GetSortMode returns the order of the music file list
+func (p *MusicPlayer) GetSortMode() files.SortMode {
+	return p.selector.SortMode()
+}
+
+// SetSortMode sets the order of the music file list, which is also the playback order.
+// The current track stays selected.
+//
+// Sorting by duration uses the durations known so far, placing the other tracks last; their
+// durations are computed in the background and the list is sorted again once they are known.
+// Poll GetSortVersion to show the list once it is sorted again.
+func (p *MusicPlayer) SetSortMode(mode files.SortMode) {
+	// A sort still waiting for durations is superseded
+	if p.cancelResort != nil {
+		p.cancelResort()
+		p.cancelResort = nil
+	}
+
+	p.selector.SetSortMode(mode)
+	if mode != files.SortByDuration {
+		return
+	}
+	if _, missing := p.loader.cachedTotalDuration(p.selector.Files()); len(missing) > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		p.cancelResort = cancel
+		p.loads.Add(1)
+		go func() {
+			defer p.loads.Done()
+			for range p.loader.ProbeLibrary(ctx, missing, p.loader.getProbeConcurrency()) {
+			}
+			if ctx.Err() == nil {
+				p.selector.resort(mode)
+			}
+		}()
+	}
+}
+
+// GetSortVersion returns a number that changes whenever the list is sorted again in the background
+// after SetSortMode, so the list shown can be refreshed. It is cheap enough to call every frame.
+func (p *MusicPlayer) GetSortVersion() int {
+	return p.selector.Resorts()
+}
+
+// HasCustomOrder returns whether the list is in an order arranged by the user rather than the sort mode
+func (p *MusicPlayer) HasCustomOrder() bool {
+	return p.selector.CustomOrder() != nil
+}
+
+// GetCustomOrder returns the order the user arranged the list in, or nil if the sort mode applies
+func (p *MusicPlayer) GetCustomOrder() []string {
+	return p.selector.CustomOrder()
+}
+
+// SetCustomOrder arranges the list in the given order. Files not in it follow in the sort order.
+// nil goes back to the sort mode.
+func (p *MusicPlayer) SetCustomOrder(order []string) {
+	p.selector.SetCustomOrder(order)
+}
+
+// MoveTrack moves the track at index from to index to in the list, keeping the current track playing.
+// The resulting order is kept until the sort mode is changed.
+func (p *MusicPlayer) MoveTrack(from, to int) error {
+	return p.selector.Move(from, to)
+}
+
+// IsCrossfadeEnabled returns whether crossfading between tracks is enabled
+func (p *MusicPlayer) IsCrossfadeEnabled() bool {
+	return p.crossfadeEnabled
+}
+
+// SetCrossfadeEnabled enables or disables crossfading.
+// When enabled, the next track fades in while the current one fades out, and the interval is skipped.
+func (p *MusicPlayer) SetCrossfadeEnabled(enabled bool) {
+	p.crossfadeEnabled = enabled
+}
+
+// GetFadeCurve returns the shape of the fades
+func (p *MusicPlayer) GetFadeCurve() FadeCurve {
+	return p.fadeCurve
+}
+
+// SetFadeCurve sets the shape of the fade-out and of the fade-in of a crossfade.
+// FadeLinear is the default; FadeEqualPower avoids the loudness dip in the middle of a crossfade.
+func (p *MusicPlayer) SetFadeCurve(curve FadeCurve) {
+	p.fadeCurve = curve
+}
+
 // GetCurrentIndex returns the current selection index from the selector.
 func (p *MusicPlayer) GetCurrentIndex() int {
 	return p.selector.CurrentIndex()
@@ -385,6 +1837,8 @@ func (p *MusicPlayer) GetCurrentIndex() int {
 
 // SetCurrentIndex selects the music at the given index using the selector.
 func (p *MusicPlayer) SetCurrentIndex(index int) error {
+	defer p.dispatchEvents()
+
 	if err := p.selector.SelectIndex(index); err != nil {
 		return err
 	}
@@ -396,133 +1850,556 @@ func (p *MusicPlayer) SetCurrentIndex(index int) error {
 func (p *MusicPlayer) loadCurrentMusic() error {
 	currentPath, ok := p.selector.CurrentFile()
 	if !ok {
+		p.discardLoad()
 		if p.currentMusic != nil {
 			if err := p.currentMusic.Close(); err != nil {
-				log.Printf("Error closing music while stopping: %v", err)
+				p.logger.Error("Error closing music while stopping: %v", err)
 			}
 			p.currentMusic = nil
 		}
-		p.state = StateStopped
+		p.setState(StateStopped)
 		return fmt.Errorf("no music file selected")
 	}
 
 	// Close existing music/player if active
+	p.closeNextMusic()
 	if p.currentMusic != nil {
 		if err := p.currentMusic.Close(); err != nil {
-			log.Printf("Warning: failed to close previous music: %v", err)
+			p.logger.Warn("failed to close previous music: %v", err)
 		}
 		p.currentMusic = nil
 	}
 
-	// Load the audio stream using the loader
-	audioStream, err := p.loader.LoadStream(currentPath)
+	if p.backgroundLoading {
+		p.startLoad(currentPath)
+		return nil
+	}
+	p.discardLoad()
+	music, audioStream, err := p.loadMusic(currentPath)
+	return p.startMusic(currentPath, music, audioStream, err)
+}
+
+// startMusic makes a newly loaded track current and starts playing it from the beginning.
+// If loading failed, playback stops and the error is returned.
+func (p *MusicPlayer) startMusic(currentPath string, music *Music, audioStream io.ReadSeeker, err error) error {
 	if err != nil {
-		return fmt.Errorf("failed to load audio stream for %s: %v", currentPath, err)
+		p.setState(StateStopped)
+		p.isPaused = false
+		return err
 	}
+	p.lastError = nil
+	p.StopTestTone()
+	p.trackChanged(currentPath)
+	p.recordHistory(currentPath)
+	p.currentMusic = music
 	p.audioStream = audioStream // Keep track of the raw stream
+	p.comparing = false
+	p.ClearLoopRegion()
+	p.resetLoopsPlayed()
+	// A new track always starts at full volume, even when a fade-out was in progress
+	p.volume = 1.0
+	p.currentMusic.SetVolume(p.volume * p.masterVolume)
 
-	// Create infinite loop stream
-	streamLength, ok := audioStream.(interface{ Length() int64 })
-	if !ok {
-		if closer, okCloser := audioStream.(io.Closer); okCloser {
-			closer.Close()
-		}
-		return fmt.Errorf("loaded audio stream for %s does not support Length()", currentPath)
+	// Reset counter and state
+	p.counter = 0
+	p.setState(StatePlaying)
+	p.isPaused = false
+
+	// Start playing
+	p.currentMusic.Play()
+
+	return nil
+}
+
+// loadMusic loads the given file and wraps a new looping player for it in a Music.
+// The returned Music is not playing yet.
+func (p *MusicPlayer) loadMusic(path string) (*Music, io.ReadSeeker, error) {
+	// Load the audio stream using the loader
+	audioStream, err := p.loader.LoadStream(path)
+	return p.wrapStream(path, audioStream, err)
+}
+
+// wrapStream wraps a new looping player for a decoded stream in a Music,
+// reporting the error if the stream couldn't be decoded
+func (p *MusicPlayer) wrapStream(path string, audioStream io.ReadSeeker, err error) (*Music, io.ReadSeeker, error) {
+	if err != nil {
+		p.reportLoadError(path, err)
+		return nil, nil, p.lastError
 	}
-	loopStream := audio.NewInfiniteLoop(audioStream, streamLength.Length())
 
-	// Create the actual player instance
-	newPlayer, err := p.playerFactory.NewPlayer(loopStream)
+	music, err := p.newMusic(path, audioStream)
 	if err != nil {
-		if closer, okCloser := audioStream.(io.Closer); okCloser {
-			closer.Close()
+		closeStream(audioStream)
+		if errors.Is(err, errNoSamples) {
+			// The file decodes but can't be played, so it is reported like a broken one
+			p.logger.Warn("%s contains no audio to play; skipping it", path)
+			p.reportLoadError(path, err)
 		}
-		return fmt.Errorf("failed to create audio player for %s: %v", currentPath, err)
+		return nil, nil, err
+	}
+	music.stream = audioStream
+	return music, audioStream, nil
+}
+
+// reportLoadError records a failure to decode a file and notifies the OnLoadError callback.
+func (p *MusicPlayer) reportLoadError(path string, err error) {
+	p.lastError = fmt.Errorf("failed to load audio stream for %s: %v", path, err)
+	if p.onLoadError != nil {
+		p.onLoadError(path, err)
+	}
+}
+
+// GetLastError returns the error of the last failed load, or nil once a track loads successfully
+func (p *MusicPlayer) GetLastError() error {
+	return p.lastError
+}
+
+// SetOnLoadError sets the callback function that is called with the path and decoder error
+// whenever a music file fails to load.
+func (p *MusicPlayer) SetOnLoadError(callback func(path string, err error)) {
+	p.onLoadError = callback
+}
+
+// errNoSamples is returned for a stream that decodes to no samples, which can't be looped
+var errNoSamples = errors.New("no audio samples")
+
+// streamLength returns the length of a decoded stream in bytes.
+// Streams without samples, e.g. of header-only files, are errNoSamples.
+func streamLength(path string, audioStream io.ReadSeeker) (int64, error) {
+	s, ok := audioStream.(interface{ Length() int64 })
+	if !ok {
+		return 0, fmt.Errorf("loaded audio stream for %s does not support Length()", path)
+	}
+	if s.Length() < bytesPerSample {
+		return 0, fmt.Errorf("%s: %w", path, errNoSamples)
+	}
+	return s.Length(), nil
+}
+
+// newMusic creates a looping player at the current playback speed for a decoded stream.
+func (p *MusicPlayer) newMusic(path string, audioStream io.ReadSeeker) (*Music, error) {
+	// Create infinite loop stream; an empty one would loop without ever producing a sample
+	length, err := streamLength(path, audioStream)
+	if err != nil {
+		return nil, err
+	}
+	loopStream, introLength, loopLength, hasLoopPoints := p.newLoopStream(path, audioStream, length)
+
+	// Create the actual player instance, metering what it reads after panning and the EQ
+	mixer := newStereoMixer(loopStream)
+	mixer.SetPan(p.pan)
+	mixer.SetMono(p.forceMono)
+	eq := newShelfEQ(mixer, p.loader.sampleRate)
+	p.configureEQ(eq)
+	meter := newLevelMeter(eq)
+	newPlayer, err := p.playerFactory.NewPlayer(meter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audio player for %s: %v", path, err)
 	}
 
 	// Wrap the player in a Music struct
-	p.currentMusic = NewMusic(newPlayer)
-	if p.currentMusic == nil { // Should not happen if NewPlayer succeeded
-		return fmt.Errorf("failed to wrap player in Music struct for %s", currentPath)
+	music := NewMusic(newPlayer)
+	if music == nil { // Should not happen if NewPlayer succeeded
+		return nil, fmt.Errorf("failed to wrap player in Music struct for %s", path)
 	}
-	p.currentMusic.SetVolume(p.volume)
+	music.introLength = bytesToDuration(introLength, p.loader.sampleRate)
+	music.loopLength = bytesToDuration(loopLength, p.loader.sampleRate)
+	music.hasLoopPoints = hasLoopPoints
+	music.path = path
+	music.meter = meter
+	music.mixer = mixer
+	music.eq = eq
+	p.updateGain(music)
+	return music, nil
+}
 
-	// Reset counter and state
-	p.counter = 0
-	p.state = StatePlaying
-	p.isPaused = false
+// bytesToDuration converts a length of a stereo 16bit stream at rate to a duration
+func bytesToDuration(n int64, rate int) time.Duration {
+	return time.Duration(n) * time.Second / time.Duration(rate*bytesPerSample)
+}
 
-	// Start playing
-	p.currentMusic.Play()
+// newLoopStream wraps the stream so it loops forever. When the file marks a loop region,
+// the part before it is played once as an intro and only the region repeats.
+// The lengths of the intro and the repeating part are returned in bytes of the looping stream,
+// along with whether the loop region was used.
+func (p *MusicPlayer) newLoopStream(path string, audioStream io.ReadSeeker, length int64) (*infiniteLoop, int64, int64, bool) {
+	introLength, loopLength, ok, err := p.loader.LoopPoints(path)
+	if err != nil {
+		p.logger.Warn("failed to read loop points of %s: %v", path, err)
+	}
 
-	return nil
+	// Treating the stream as if it had a higher sample rate speeds it up
+	src := audioStream
+	if p.playbackSpeed != 1 {
+		rate := p.loader.sampleRate
+		from := int(float64(rate) * p.playbackSpeed)
+		scale := func(n int64) int64 {
+			return n * int64(rate) / int64(from) / bytesPerSample * bytesPerSample
+		}
+		resampled := resample.NewReader(audioStream, length, from, rate)
+		src = resampled
+		length = resampled.Length()
+		introLength = scale(introLength)
+		loopLength = scale(loopLength)
+	}
+
+	if !ok || introLength >= length {
+		return newInfiniteLoop(src, 0, length), 0, length, false
+	}
+	if loopLength <= 0 || introLength+loopLength > length {
+		loopLength = length - introLength
+	}
+	return newInfiniteLoop(src, introLength, loopLength), introLength, loopLength, true
+}
+
+// startCrossfade loads the upcoming track silently so it can fade in during the fade-out.
+// On failure the player falls back to the regular fade-out and interval.
+func (p *MusicPlayer) startCrossfade() {
+	nextPath, ok := p.selector.PeekNext()
+	if !ok || p.isAtEnd() || !p.advancesAutomatically() {
+		return
+	}
+	if p.repeatMode == RepeatOne {
+		nextPath, _ = p.selector.CurrentFile()
+	}
+
+	music, audioStream, err := p.loadMusic(nextPath)
+	if err != nil {
+		p.logger.Error("Failed to load next track for crossfade: %v", err)
+		return
+	}
+	p.nextMusic = music
+	p.nextAudioStream = audioStream
+	p.nextMusic.SetVolume(0)
+	p.nextMusic.Play()
+}
+
+// finishCrossfade replaces the faded-out track with the one faded in.
+func (p *MusicPlayer) finishCrossfade() {
+	if p.currentMusic != nil {
+		if err := p.currentMusic.Close(); err != nil {
+			p.logger.Warn("failed to close previous music: %v", err)
+		}
+	}
+	p.finishCurrentTrack()
+	if p.repeatMode != RepeatOne {
+		p.selector.SelectNext()
+	}
+	if nextPath, ok := p.selector.CurrentFile(); ok {
+		p.trackChanged(nextPath)
+		p.recordHistory(nextPath)
+	}
+
+	p.currentMusic = p.nextMusic
+	p.audioStream = p.nextAudioStream
+	p.comparing = false
+	p.ClearLoopRegion()
+	p.resetLoopsPlayed()
+	p.nextMusic = nil
+	p.nextAudioStream = nil
+
+	p.volume = 1.0
+	p.currentMusic.SetVolume(p.volume * p.masterVolume)
+	p.counter = 0
+	p.setState(StatePlaying)
+}
+
+// closeNextMusic discards a track loaded for a crossfade in progress.
+func (p *MusicPlayer) closeNextMusic() {
+	if p.nextMusic == nil {
+		return
+	}
+	if err := p.nextMusic.Close(); err != nil {
+		p.logger.Warn("failed to close next music: %v", err)
+	}
+	p.nextMusic = nil
+	p.nextAudioStream = nil
 }
 
-// TogglePause toggles pause state
+// TogglePause toggles pause state. It has no effect while stopped; use Play to resume.
 func (p *MusicPlayer) TogglePause() {
-	if p.currentMusic == nil { // Check currentMusic instead of player
+	// The user's choice isn't undone when the window regains focus
+	p.autoPaused = false
+	p.togglePause()
+}
+
+// togglePause implements TogglePause
+func (p *MusicPlayer) togglePause() {
+	if p.currentMusic == nil || p.state == StateStopped { // Check currentMusic instead of player
 		return
 	}
 
 	if p.isPaused {
-		p.currentMusic.Play() // Delegate to Music
+		p.StopTestTone()
+		// The track stays silent when resuming during the interval
+		if p.state != StateInterval {
+			p.currentMusic.Play() // Delegate to Music
+		}
+		if p.nextMusic != nil {
+			p.nextMusic.Play()
+		}
 		p.isPaused = false
 	} else {
 		p.currentMusic.Pause() // Delegate to Music
+		if p.nextMusic != nil {
+			p.nextMusic.Pause()
+		}
 		p.isPaused = true
 	}
 }
 
 // Update updates the player state
 func (p *MusicPlayer) Update() error {
-	p.counter++
+	defer p.dispatchEvents()
+
+	// Nothing plays until a track loading in the background is ready
+	if p.state == StateLoading {
+		p.finishLoad()
+		return nil
+	}
+
+	p.updatePendingGains()
+
+	// Time doesn't pass while paused or stopped
+	if p.isPaused || p.state == StateStopped {
+		return nil
+	}
+
+	if p.state == StatePlaying {
+		// The loop duration is in track time, which runs at the playback speed
+		p.speedRemainder += p.playbackSpeed
+		frames := int(p.speedRemainder)
+		p.speedRemainder -= float64(frames)
+		p.counter += frames
+	} else {
+		p.counter++
+	}
 
 	switch p.state {
 	case StatePlaying:
-		loopDurationFrames := int(p.loopDuration * 60 * 60)
-		if p.counter >= loopDurationFrames {
-			p.state = StateFadingOut
+		// Stop once the track has looped the given number of times
+		if p.currentMusic != nil && p.countLoops() && !p.auditioning {
+			p.finishCurrentTrack()
+			if p.stayOnTrack() {
+				break
+			}
+			p.setState(StateInterval)
 			p.counter = 0
+			p.currentMusic.Pause()
+			break
 		}
 
-	case StateFadingOut:
-		fadeOutFrames := int(fadeOutDuration.Seconds() * 60)
-		if p.counter >= fadeOutFrames {
-			p.state = StateInterval
+		// Jump back to A once playback passes B
+		if p.hasLoopRegion && p.currentMusic != nil && p.GetPlaybackPosition() >= p.loopEnd {
+			if err := p.setMusicPosition(p.loopStart); err != nil {
+				p.logger.Error("Failed to seek to loop region start: %v", err)
+			}
+		}
+
+		if !p.auditioning && p.counter >= p.secondsToCount(p.loopDuration*60) {
+			p.setState(StateFadingOut)
 			p.counter = 0
-			if p.currentMusic != nil {
-				p.currentMusic.Pause() // Pause the wrapped player
+			if p.crossfadeEnabled {
+				p.startCrossfade()
 			}
+		}
+
+	case StateFadingOut:
+		if p.counter >= p.fadeOutFrames() {
+			p.endFadeOut()
 		} else {
-			fadeRatio := 1.0 - float64(p.counter)/float64(fadeOutFrames)
-			p.volume = fadeRatio
+			out, in := p.fadeCurve.Gains(p.GetFadeProgress())
+			p.volume = out
 			if p.currentMusic != nil {
-				p.currentMusic.SetVolume(fadeRatio) // Set volume on Music
+				p.currentMusic.SetVolume(out * p.masterVolume) // Set volume on Music
+			}
+			if p.nextMusic != nil {
+				p.nextMusic.SetVolume(in * p.masterVolume) // Fade the next track in
 			}
 		}
 
 	case StateInterval:
-		intervalFrames := int(p.intervalDuration * 60)
-		if p.counter >= intervalFrames {
-			p.volume = 1.0
-			err := p.SkipToNext()
-			if err != nil {
-				return fmt.Errorf("failed to skip to next track: %v", err)
-			}
+		if p.counter >= p.secondsToCount(p.intervalDuration) {
+			p.endInterval()
 		}
 	}
 
+	// A zero-length fade-out or interval ends in the same Update it starts,
+	// so the next track follows without a gap
+	if p.state == StateFadingOut && p.fadeOutFrames() == 0 {
+		p.endFadeOut()
+	}
+	if p.state == StateInterval && p.secondsToCount(p.intervalDuration) == 0 {
+		p.endInterval()
+	}
+
 	return nil
 }
 
-// SkipToNext skips to the next track
+// endFadeOut finishes the fade-out: the crossfaded track takes over, or the interval starts
+func (p *MusicPlayer) endFadeOut() {
+	if p.nextMusic != nil {
+		p.finishCrossfade()
+		return
+	}
+	p.finishCurrentTrack()
+	if p.stayOnTrack() {
+		return
+	}
+	p.setState(StateInterval)
+	p.counter = 0
+	if p.currentMusic != nil {
+		p.currentMusic.Pause() // Pause the wrapped player
+	}
+}
+
+// endInterval finishes the interval and plays the next track
+func (p *MusicPlayer) endInterval() {
+	p.volume = 1.0
+	// A track that fails to load stops the player and is reported through GetLastError
+	if err := p.SkipToNext(); err != nil {
+		p.logger.Error("Failed to skip to next track: %v", err)
+	}
+}
+
+// finishCurrentTrack notifies observers that the current track ended on its own
+func (p *MusicPlayer) finishCurrentTrack() {
+	if path, ok := p.selector.CurrentFile(); ok {
+		p.trackFinished(path)
+	}
+}
+
+// SkipToNext skips to the next track, honoring the repeat mode
 func (p *MusicPlayer) SkipToNext() error {
+	defer p.dispatchEvents()
+
+	switch p.repeatMode {
+	case RepeatOne:
+		if _, ok := p.selector.CurrentFile(); !ok {
+			return nil
+		}
+		return p.loadCurrentMusic()
+	case RepeatOff:
+		if p.isAtEnd() {
+			p.stopAtEnd()
+			return nil
+		}
+	}
+
 	nextIndexChanged := p.selector.SelectNext()
 	if !nextIndexChanged {
+		// A single track wraps around to itself
+		if _, ok := p.selector.CurrentFile(); !ok {
+			return nil
+		}
+	}
+
+	return p.loadCurrentMusic()
+}
+
+// SkipInterval ends the fade-out or interval and starts the next track at full volume right away,
+// as if the gap had run its course. It has no effect in other states.
+func (p *MusicPlayer) SkipInterval() error {
+	switch p.state {
+	case StateFadingOut:
+		if p.nextMusic != nil {
+			defer p.dispatchEvents()
+			p.finishCrossfade()
+			return nil
+		}
+		p.finishCurrentTrack()
+	case StateInterval:
+	default:
 		return nil
 	}
 
+	return p.SkipToNext()
+}
+
+// isAtEnd reports whether advancing would stop playback under RepeatOff.
+func (p *MusicPlayer) isAtEnd() bool {
+	return p.repeatMode == RepeatOff && p.selector.IsLast()
+}
+
+// stopAtEnd stops playback after the last track.
+func (p *MusicPlayer) stopAtEnd() {
+	p.closeNextMusic()
+	if p.currentMusic != nil {
+		if err := p.currentMusic.Close(); err != nil {
+			p.logger.Warn("failed to close music: %v", err)
+		}
+		p.currentMusic = nil
+	}
+	p.counter = 0
+	p.volume = 1.0
+	p.setState(StateStopped)
+	p.isPaused = false
+}
+
+// Stop stops playback and rewinds the current track to the beginning.
+// The track stays loaded so Play can resume it without reloading.
+func (p *MusicPlayer) Stop() error {
+	defer p.dispatchEvents()
+
+	p.discardLoad()
+	p.closeNextMusic()
+	p.StopTestTone()
+	p.counter = 0
 	p.volume = 1.0
+	p.setState(StateStopped)
+	p.isPaused = false
+
+	if p.currentMusic == nil {
+		return nil
+	}
+	p.currentMusic.Pause()
+	p.currentMusic.SetVolume(p.volume * p.masterVolume)
+	p.resetLoopsPlayed()
+	if err := p.currentMusic.Rewind(); err != nil {
+		return fmt.Errorf("failed to rewind music: %v", err)
+	}
+	return nil
+}
+
+// Play starts playback from the stopped state.
+// The stopped track is resumed as is, or the selected track is loaded if none is loaded.
+func (p *MusicPlayer) Play() error {
+	defer p.dispatchEvents()
+
+	if p.state != StateStopped {
+		return nil
+	}
+	if p.currentMusic == nil {
+		return p.loadCurrentMusic()
+	}
+
+	p.StopTestTone()
+	p.setState(StatePlaying)
+	p.isPaused = false
+	p.currentMusic.Play()
+	return nil
+}
+
+// SkipToPrevious skips to the previous track
+func (p *MusicPlayer) SkipToPrevious() error {
+	defer p.dispatchEvents()
+
+	prevIndexChanged := p.selector.SelectPrevious()
+	if !prevIndexChanged {
+		return nil
+	}
+
+	return p.loadCurrentMusic()
+}
+
+// SkipToRandom jumps to a random track other than the current one, leaving the playback order as it is.
+// With a single track, nothing happens.
+func (p *MusicPlayer) SkipToRandom() error {
+	defer p.dispatchEvents()
+
+	if !p.selector.SelectRandom() {
+		return nil
+	}
 	return p.loadCurrentMusic()
 }
 
@@ -1,10 +1,26 @@
 package player_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"musicplayer/internal/files"
+	"musicplayer/internal/logging"
 	"musicplayer/internal/player"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // TestMain handles the setup for all tests
@@ -30,11 +46,16 @@ func createTestMusicPlayer(t *testing.T) (*player.MusicPlayer, *MockPlayerFactor
 	}
 	t.Cleanup(func() { os.RemoveAll(tempDir) })
 
-	// Define initial test files (paths only, files aren't created here)
+	// Define initial test files and write them as short, decodable WAV files
 	initialFiles := []string{
-		filepath.Join(tempDir, "test1.mp3"),
+		filepath.Join(tempDir, "test1.wav"),
 		filepath.Join(tempDir, "test2.wav"),
 	}
+	for _, path := range initialFiles {
+		if err := WriteTestWav(path, 4800); err != nil {
+			t.Fatal(err)
+		}
+	}
 
 	// Create mock factory
 	mockFactory := NewMockPlayerFactory()
@@ -120,6 +141,23 @@ func TestGetCounter(t *testing.T) {
 	}
 }
 
+func TestGetPlaybackPosition(t *testing.T) {
+	p, _ := createTestMusicPlayer(t)
+
+	// No music loaded yet
+	if pos := p.GetPlaybackPosition(); pos != 0 {
+		t.Errorf("Expected position 0 without music, got %v", pos)
+	}
+
+	mockPlayer := NewMockAudioPlayer()
+	mockPlayer.SetCurrent(90 * time.Second)
+	p.TestSetPlayer(mockPlayer)
+
+	if pos := p.GetPlaybackPosition(); pos != 90*time.Second {
+		t.Errorf("Expected position 1m30s, got %v", pos)
+	}
+}
+
 func TestLoopDurationMinutes(t *testing.T) {
 	p, _ := createTestMusicPlayer(t)
 
@@ -154,6 +192,74 @@ func TestIntervalSeconds(t *testing.T) {
 	}
 }
 
+func TestFadeOutDuration(t *testing.T) {
+	p, _ := createTestMusicPlayer(t)
+
+	// Verify default value
+	if d := p.GetFadeOutDuration(); d != 2*time.Second {
+		t.Errorf("Expected default fade-out duration to be 2s, got %v", d)
+	}
+
+	// Change value and verify
+	p.SetFadeOutDuration(500 * time.Millisecond)
+	if d := p.GetFadeOutDuration(); d != 500*time.Millisecond {
+		t.Errorf("Expected fade-out duration to be 500ms after setting, got %v", d)
+	}
+
+	// Zero skips the fade-out; negative durations are clamped to zero
+	for _, d := range []time.Duration{0, -time.Second} {
+		p.SetFadeOutDuration(d)
+		if got := p.GetFadeOutDuration(); got != 0 {
+			t.Errorf("Expected SetFadeOutDuration(%v) to clamp to zero, got %v", d, got)
+		}
+	}
+}
+
+func TestSetTPS(t *testing.T) {
+	p, _ := createTestMusicPlayer(t)
+	defer p.Close()
+
+	if p.GetTPS() != 60 {
+		t.Errorf("Expected 60 updates per second by default, got %d", p.GetTPS())
+	}
+	p.SetTPS(0)
+	if p.GetTPS() != 60 {
+		t.Errorf("Expected SetTPS(0) to be ignored, got %d", p.GetTPS())
+	}
+
+	// At 10 updates per second, a 0.6 second loop takes 6 updates
+	p.SetTPS(10)
+	p.SetLoopDurationMinutes(0.01)
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.GetState() != player.StatePlaying {
+		t.Fatalf("Expected state Playing after 5 updates, got %v", p.GetState())
+	}
+	if p.GetElapsed() != 500*time.Millisecond {
+		t.Errorf("Expected 500ms elapsed, got %v", p.GetElapsed())
+	}
+
+	// Changing the rate keeps the elapsed time
+	p.SetTPS(20)
+	if p.GetElapsed() != 500*time.Millisecond || p.GetCounter() != 10 {
+		t.Errorf("Expected 500ms (10 updates) elapsed after changing the rate, got %v (%d)", p.GetElapsed(), p.GetCounter())
+	}
+	for i := 0; i < 2; i++ {
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.GetState() != player.StateFadingOut {
+		t.Errorf("Expected state FadingOut after 0.6 seconds, got %v", p.GetState())
+	}
+}
+
 func TestSetCurrentIndex(t *testing.T) {
 	p, _ := createTestMusicPlayer(t)
 
@@ -258,3 +364,3447 @@ func TestUpdate(t *testing.T) {
 		t.Errorf("Expected state to be StateStopped after Close, got %v", p.GetState())
 	}
 }
+
+func TestNewMusicPlayerFromPlaylist(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"b.wav", "a.wav"} {
+		if err := WriteTestWav(filepath.Join(tempDir, name), 4800); err != nil {
+			t.Fatal(err)
+		}
+	}
+	playlist := filepath.Join(tempDir, "list.m3u")
+	if err := os.WriteFile(playlist, []byte("#EXTM3U\nb.wav\nmissing.wav\na.wav\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := player.NewMusicPlayerFromPlaylist(playlist, NewMockPlayerFactory(), nil)
+	if err != nil {
+		t.Fatalf("NewMusicPlayerFromPlaylist failed: %v", err)
+	}
+	defer p.Close()
+
+	// Playlist order is kept and missing entries are skipped
+	musicFiles := p.GetMusicFiles()
+	expected := []string{filepath.Join(tempDir, "b.wav"), filepath.Join(tempDir, "a.wav")}
+	if len(musicFiles) != len(expected) || musicFiles[0] != expected[0] || musicFiles[1] != expected[1] {
+		t.Errorf("Expected files %v, got %v", expected, musicFiles)
+	}
+
+	if _, err := player.NewMusicPlayerFromPlaylist(filepath.Join(tempDir, "missing.m3u"), NewMockPlayerFactory(), nil); err == nil {
+		t.Error("Expected an error for a missing playlist")
+	}
+}
+
+func TestMusicLoader_LoadStream_UnsupportedFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("not audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := player.NewMusicLoader().LoadStream(path)
+	if err == nil {
+		t.Fatal("Expected LoadStream to fail for an unknown extension")
+	}
+	if !strings.Contains(err.Error(), "unsupported audio format") {
+		t.Errorf("Expected unsupported format error, got: %v", err)
+	}
+}
+
+func TestMusicLoader_GetDuration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "track.wav")
+	if err := WriteTestWav(path, 4800); err != nil { // 0.1s at 48kHz
+		t.Fatal(err)
+	}
+
+	loader := player.NewMusicLoader()
+	d, err := loader.GetDuration(path)
+	if err != nil {
+		t.Fatalf("GetDuration failed: %v", err)
+	}
+	if d != 100*time.Millisecond {
+		t.Errorf("Expected duration 100ms, got %v", d)
+	}
+
+	// A changed file is decoded again instead of using the cached duration
+	if err := WriteTestWav(path, 96000); err != nil { // 2s at 48kHz
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	d, err = loader.GetDuration(path)
+	if err != nil {
+		t.Fatalf("GetDuration failed: %v", err)
+	}
+	if d != 2*time.Second {
+		t.Errorf("Expected duration 2s after the file changed, got %v", d)
+	}
+
+	if _, err := loader.GetDuration(filepath.Join(t.TempDir(), "missing.wav")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestMusicLoader_MislabeledFile(t *testing.T) {
+	// WAV data with an MP3 extension is decoded as WAV
+	path := filepath.Join(t.TempDir(), "mislabeled.mp3")
+	if err := WriteTestWav(path, 4800); err != nil {
+		t.Fatal(err)
+	}
+
+	loader := player.NewMusicLoader()
+	stream, err := loader.LoadStream(path)
+	if err != nil {
+		t.Fatalf("LoadStream failed: %v", err)
+	}
+	if closer, ok := stream.(io.Closer); ok {
+		closer.Close()
+	}
+
+	d, err := loader.GetDuration(path)
+	if err != nil {
+		t.Fatalf("GetDuration failed: %v", err)
+	}
+	if d != 100*time.Millisecond {
+		t.Errorf("Expected duration 100ms, got %v", d)
+	}
+}
+
+func TestMusicSelector_SelectPrevious(t *testing.T) {
+	s := player.NewMusicSelector()
+
+	// Empty list: no change
+	if s.SelectPrevious() {
+		t.Error("Expected SelectPrevious on empty list to report no change")
+	}
+	if s.CurrentIndex() != -1 {
+		t.Errorf("Expected index -1 on empty list, got %d", s.CurrentIndex())
+	}
+
+	s.Update([]string{"a.wav", "b.wav", "c.wav"})
+
+	// Index 0 wraps to the last track
+	if !s.SelectPrevious() {
+		t.Error("Expected SelectPrevious to report a change")
+	}
+	if s.CurrentIndex() != 2 {
+		t.Errorf("Expected index 2 after wrapping, got %d", s.CurrentIndex())
+	}
+
+	s.SelectPrevious()
+	if path, _ := s.CurrentFile(); path != "b.wav" {
+		t.Errorf("Expected b.wav, got %s", path)
+	}
+
+	// Single element list: index doesn't change
+	s.Update([]string{"only.wav"})
+	if s.SelectPrevious() {
+		t.Error("Expected SelectPrevious on single-element list to report no change")
+	}
+}
+
+func TestCrossfade(t *testing.T) {
+	p, mockFactory := createTestMusicPlayer(t)
+
+	if p.IsCrossfadeEnabled() {
+		t.Error("Expected crossfade to be disabled by default")
+	}
+	p.SetCrossfadeEnabled(true)
+	p.SetLoopDurationMinutes(1.0 / 3600) // One frame
+	p.SetFadeOutDuration(time.Second)    // 60 frames
+
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatalf("Failed to set initial index: %v", err)
+	}
+	firstPath := p.GetCurrentPath()
+	firstPlayer := mockFactory.GetLastPlayer()
+
+	// Loop duration elapses: fade-out starts and the next track is loaded
+	if err := p.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetState() != player.StateFadingOut {
+		t.Fatalf("Expected StateFadingOut, got %v", p.GetState())
+	}
+	nextPlayer := mockFactory.GetLastPlayer()
+	if nextPlayer == firstPlayer {
+		t.Fatal("Expected the next track to be loaded when the fade-out starts")
+	}
+	if !nextPlayer.IsPlaying() {
+		t.Error("Expected the next track to be playing during the crossfade")
+	}
+	if p.GetCurrentPath() != firstPath {
+		t.Errorf("Expected current path to stay %s during the crossfade, got %s", firstPath, p.GetCurrentPath())
+	}
+
+	// Halfway through, both tracks are at roughly half volume
+	for i := 0; i < 30; i++ {
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v := firstPlayer.Volume(); v < 0.4 || v > 0.6 {
+		t.Errorf("Expected fading-out volume around 0.5, got %f", v)
+	}
+	if v := nextPlayer.Volume(); v < 0.4 || v > 0.6 {
+		t.Errorf("Expected fading-in volume around 0.5, got %f", v)
+	}
+
+	// Fade completes: the next track becomes current without an interval
+	for i := 0; i < 30; i++ {
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.GetState() != player.StatePlaying {
+		t.Errorf("Expected StatePlaying after the crossfade, got %v", p.GetState())
+	}
+	if p.GetCurrentPath() == firstPath {
+		t.Error("Expected the current track to change after the crossfade")
+	}
+	if nextPlayer.Volume() != 1.0 {
+		t.Errorf("Expected the new track at full volume, got %f", nextPlayer.Volume())
+	}
+}
+
+func TestFadeCurve(t *testing.T) {
+	tests := []struct {
+		curve       player.FadeCurve
+		out, in     float64 // Volumes at the midpoint
+		outQuarter  float64 // Volume of the fading-out track a quarter of the way in
+		description string
+	}{
+		{player.FadeLinear, 0.5, 0.5, 0.75, "Linear"},
+		{player.FadeEqualPower, math.Sqrt(0.5), math.Sqrt(0.5), math.Cos(math.Pi / 8), "Equal power"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			if out, _ := tt.curve.Gains(0.25); math.Abs(out-tt.outQuarter) > 1e-9 {
+				t.Errorf("Gains(0.25) out = %v, want %v", out, tt.outQuarter)
+			}
+
+			p, mockFactory := createTestMusicPlayer(t)
+			p.SetCrossfadeEnabled(true)
+			p.SetFadeCurve(tt.curve)
+			p.SetLoopDurationMinutes(1.0 / 3600) // One frame
+			p.SetFadeOutDuration(time.Second)    // 60 frames
+			if p.GetFadeCurve() != tt.curve {
+				t.Errorf("GetFadeCurve() = %v, want %v", p.GetFadeCurve(), tt.curve)
+			}
+
+			if err := p.SetCurrentIndex(0); err != nil {
+				t.Fatalf("Failed to set initial index: %v", err)
+			}
+			firstPlayer := mockFactory.GetLastPlayer()
+			if err := p.Update(); err != nil {
+				t.Fatal(err)
+			}
+			nextPlayer := mockFactory.GetLastPlayer()
+
+			// Run the fade to its midpoint; each Update sets the volumes for the progress it reached
+			for p.GetFadeProgress() < 0.5 {
+				if err := p.Update(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if v := firstPlayer.Volume(); math.Abs(v-tt.out) > 1e-9 {
+				t.Errorf("Fading-out volume at the midpoint = %v, want %v", v, tt.out)
+			}
+			if v := nextPlayer.Volume(); math.Abs(v-tt.in) > 1e-9 {
+				t.Errorf("Fading-in volume at the midpoint = %v, want %v", v, tt.in)
+			}
+		})
+	}
+}
+
+func TestCrossfadeDisabled(t *testing.T) {
+	p, mockFactory := createTestMusicPlayer(t)
+	p.SetLoopDurationMinutes(1.0 / 3600) // One frame
+	p.SetFadeOutDuration(time.Second)    // 60 frames
+
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatalf("Failed to set initial index: %v", err)
+	}
+	firstPlayer := mockFactory.GetLastPlayer()
+
+	for i := 0; i < 61; i++ {
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if mockFactory.GetLastPlayer() != firstPlayer {
+		t.Error("Expected no additional track to be loaded without crossfade")
+	}
+	if p.GetState() != player.StateInterval {
+		t.Errorf("Expected StateInterval after the fade-out, got %v", p.GetState())
+	}
+}
+
+func TestAutoAdvanceDisabled(t *testing.T) {
+	p, mockFactory := createTestMusicPlayer(t)
+	p.SetLoopDurationMinutes(1.0 / 3600) // One frame
+	p.SetFadeOutDuration(time.Second)    // 60 frames
+	p.SetAutoAdvance(false)
+
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatalf("Failed to set initial index: %v", err)
+	}
+	path := p.GetCurrentPath()
+	firstPlayer := mockFactory.GetLastPlayer()
+
+	for i := 0; i < 61; i++ {
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.GetState() != player.StateStopped {
+		t.Errorf("Expected StateStopped after the fade-out, got %v", p.GetState())
+	}
+	if p.GetCurrentPath() != path {
+		t.Errorf("Expected to stay on %s, got %s", path, p.GetCurrentPath())
+	}
+	if mockFactory.GetLastPlayer() != firstPlayer {
+		t.Error("Expected no additional track to be loaded without auto-advance")
+	}
+
+	// RepeatOne takes precedence and keeps the track repeating
+	p.SetRepeatMode(player.RepeatOne)
+	if err := p.Play(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 61; i++ {
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.GetState() != player.StateInterval {
+		t.Errorf("Expected StateInterval with RepeatOne, got %v", p.GetState())
+	}
+}
+
+func TestLoopPresets(t *testing.T) {
+	p, _ := createTestMusicPlayer(t)
+
+	if !slices.Equal(p.GetLoopPresets(), player.DefaultLoopPresets) {
+		t.Errorf("Expected the default presets %v, got %v", player.DefaultLoopPresets, p.GetLoopPresets())
+	}
+
+	if err := p.SetLoopPresets([]float64{3, 0.5, 1.5, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []float64{0.5, 1.5, 3}; !slices.Equal(p.GetLoopPresets(), want) {
+		t.Errorf("Expected sorted presets %v, got %v", want, p.GetLoopPresets())
+	}
+
+	// Cycling steps to the next longer preset from the current duration and wraps around
+	p.SetLoopDurationMinutes(1)
+	for _, want := range []float64{1.5, 3, 0.5, 1.5} {
+		if got := p.CycleLoopPreset(); got != want || p.GetLoopDurationMinutes() != want {
+			t.Errorf("Expected loop duration %v, got %v (%v)", want, got, p.GetLoopDurationMinutes())
+		}
+	}
+
+	for _, invalid := range [][]float64{nil, {1, 0}, {-2}} {
+		if err := p.SetLoopPresets(invalid); err == nil {
+			t.Errorf("Expected an error for presets %v", invalid)
+		}
+	}
+	if want := []float64{0.5, 1.5, 3}; !slices.Equal(p.GetLoopPresets(), want) {
+		t.Errorf("Expected invalid presets to be ignored, got %v", p.GetLoopPresets())
+	}
+}
+
+func TestRepeatMode(t *testing.T) {
+	p, _ := createTestMusicPlayer(t)
+
+	if p.GetRepeatMode() != player.RepeatAll {
+		t.Errorf("Expected default repeat mode RepeatAll, got %v", p.GetRepeatMode())
+	}
+
+	if err := p.SetCurrentIndex(1); err != nil {
+		t.Fatalf("Failed to set initial index: %v", err)
+	}
+
+	// RepeatAll wraps from the last track to the first
+	if err := p.SkipToNext(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetCurrentIndex() != 0 {
+		t.Errorf("Expected RepeatAll to wrap to index 0, got %d", p.GetCurrentIndex())
+	}
+
+	// RepeatOne reloads the current track
+	p.SetRepeatMode(player.RepeatOne)
+	if err := p.SkipToNext(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetCurrentIndex() != 0 || p.GetState() != player.StatePlaying {
+		t.Errorf("Expected RepeatOne to replay index 0, got index %d state %v", p.GetCurrentIndex(), p.GetState())
+	}
+
+	// RepeatOff advances, then stops after the last track
+	p.SetRepeatMode(player.RepeatOff)
+	if err := p.SkipToNext(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetCurrentIndex() != 1 || p.GetState() != player.StatePlaying {
+		t.Errorf("Expected RepeatOff to advance to index 1, got index %d state %v", p.GetCurrentIndex(), p.GetState())
+	}
+	if err := p.SkipToNext(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetCurrentIndex() != 1 {
+		t.Errorf("Expected RepeatOff not to wrap, got index %d", p.GetCurrentIndex())
+	}
+	if p.GetState() != player.StateStopped {
+		t.Errorf("Expected StateStopped after the last track, got %v", p.GetState())
+	}
+}
+
+func TestRepeatMode_Next(t *testing.T) {
+	mode := player.RepeatAll
+	expected := []player.RepeatMode{player.RepeatOne, player.RepeatOff, player.RepeatAll}
+	for _, want := range expected {
+		mode = mode.Next()
+		if mode != want {
+			t.Errorf("Expected %v, got %v", want, mode)
+		}
+	}
+}
+
+func TestMusicSelector_Shuffle(t *testing.T) {
+	files := []string{"a.wav", "b.wav", "c.wav", "d.wav", "e.wav"}
+
+	// Collect the playback order of a full cycle
+	collectOrder := func(seed int64) []string {
+		s := player.NewMusicSelector()
+		s.Update(files)
+		s.SetShuffleSeed(seed)
+		s.SetShuffle(true)
+
+		order := []string{}
+		for i := 0; i < len(files); i++ {
+			path, _ := s.CurrentFile()
+			order = append(order, path)
+			s.SelectNext()
+		}
+		return order
+	}
+
+	order := collectOrder(42)
+
+	// The current track stays the starting point
+	if order[0] != "a.wav" {
+		t.Errorf("Expected shuffle to start from the current track a.wav, got %s", order[0])
+	}
+
+	// Every track is visited exactly once per cycle
+	seen := make(map[string]bool)
+	for _, path := range order {
+		seen[path] = true
+	}
+	if len(seen) != len(files) {
+		t.Errorf("Expected all %d tracks in one cycle, got %v", len(files), order)
+	}
+
+	// The same seed produces the same order
+	again := collectOrder(42)
+	for i := range order {
+		if order[i] != again[i] {
+			t.Fatalf("Expected deterministic order for the same seed, got %v and %v", order, again)
+		}
+	}
+}
+
+func TestMusicSelector_ShuffleUpdateKeepsCurrent(t *testing.T) {
+	s := player.NewMusicSelector()
+	s.Update([]string{"a.wav", "b.wav", "c.wav"})
+	s.SetShuffleSeed(1)
+	s.SetShuffle(true)
+	s.SelectNext()
+	current, _ := s.CurrentFile()
+
+	// Adding a file reshuffles, with the playing track as the new start
+	s.Update([]string{"a.wav", "b.wav", "c.wav", "d.wav"})
+	if path, _ := s.CurrentFile(); path != current {
+		t.Errorf("Expected current track %s to be preserved, got %s", current, path)
+	}
+
+	// Next and previous follow the new permutation
+	next, _ := s.PeekNext()
+	s.SelectNext()
+	if path, _ := s.CurrentFile(); path != next {
+		t.Errorf("Expected SelectNext to match PeekNext %s, got %s", next, path)
+	}
+	s.SelectPrevious()
+	if path, _ := s.CurrentFile(); path != current {
+		t.Errorf("Expected SelectPrevious to return to %s, got %s", current, path)
+	}
+}
+
+func TestMusicSelector_SelectRandom(t *testing.T) {
+	s := player.NewMusicSelector()
+	if s.SelectRandom() {
+		t.Error("Expected no change for an empty list")
+	}
+
+	// A single track can't jump anywhere else
+	s.Update([]string{"a.wav"})
+	s.SelectIndex(0)
+	if s.SelectRandom() || s.CurrentIndex() != 0 {
+		t.Errorf("Expected a single track to stay selected, got index %d", s.CurrentIndex())
+	}
+
+	// Every other track is reached, and never the current one
+	s.Update([]string{"a.wav", "b.wav", "c.wav", "d.wav"})
+	s.SetShuffleSeed(1)
+	s.SelectIndex(0)
+	seen := map[int]bool{}
+	for range 100 {
+		previous := s.CurrentIndex()
+		if !s.SelectRandom() {
+			t.Fatal("Expected SelectRandom to change the index")
+		}
+		if s.CurrentIndex() == previous {
+			t.Fatalf("Expected a track other than %d", previous)
+		}
+		seen[s.CurrentIndex()] = true
+	}
+	if len(seen) != 4 {
+		t.Errorf("Expected every track to be selected, got %v", seen)
+	}
+
+	// The order continues from the selected track, without changing the mode
+	s.SelectIndex(0)
+	s.SelectRandom()
+	current := s.CurrentIndex()
+	s.SelectNext()
+	if s.CurrentIndex() != (current+1)%4 || s.IsShuffle() {
+		t.Errorf("Expected SelectNext to continue in list order from %d, got %d", current, s.CurrentIndex())
+	}
+
+	// In shuffle mode, next continues along the permutation from the selected track
+	s.SetShuffle(true)
+	s.SelectRandom()
+	next, _ := s.PeekNext()
+	s.SelectNext()
+	if path, _ := s.CurrentFile(); path != next || !s.IsShuffle() {
+		t.Errorf("Expected SelectNext to match PeekNext %s in shuffle mode, got %s", next, path)
+	}
+}
+
+func TestMusicSelector_SortMode(t *testing.T) {
+	s := player.NewMusicSelector()
+	s.SetDurationFunc(func(path string) (time.Duration, error) {
+		return map[string]time.Duration{"/b/a.wav": 3, "/a/c.wav": 1, "/a/b.wav": 2}[path], nil
+	})
+	s.Update([]string{"/b/a.wav", "/a/c.wav", "/a/b.wav"})
+	if err := s.SelectIndex(1); err != nil {
+		t.Fatal(err)
+	}
+
+	s.SetSortMode(files.SortByName)
+	if got := strings.Join(s.Files(), ","); got != "/b/a.wav,/a/b.wav,/a/c.wav" {
+		t.Errorf("Expected files sorted by name, got %s", got)
+	}
+	if path, _ := s.CurrentFile(); path != "/a/c.wav" {
+		t.Errorf("Expected the current track to stay selected, got %s", path)
+	}
+
+	// Playback order follows the sorted list
+	s.SetSortMode(files.SortByDuration)
+	s.SelectNext()
+	if path, _ := s.CurrentFile(); path != "/a/b.wav" {
+		t.Errorf("Expected the next track by duration to be /a/b.wav, got %s", path)
+	}
+
+	// New files are sorted as they arrive
+	s.Update([]string{"/b/a.wav", "/a/b.wav"})
+	if got := strings.Join(s.Files(), ","); got != "/a/b.wav,/b/a.wav" {
+		t.Errorf("Expected updated files sorted by duration, got %s", got)
+	}
+
+	// No sorting goes back to the order the files were found in
+	s.SetSortMode(files.SortNone)
+	if got := strings.Join(s.Files(), ","); got != "/b/a.wav,/a/b.wav" {
+		t.Errorf("Expected files in the order they were found, got %s", got)
+	}
+}
+
+func TestSetSortMode_Duration(t *testing.T) {
+	dir := t.TempDir()
+	long, short := filepath.Join(dir, "a.wav"), filepath.Join(dir, "b.wav")
+	if err := WriteTestWav(long, 9600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteTestWav(short, 4800); err != nil {
+		t.Fatal(err)
+	}
+	decoder := &durationGateDecoder{release: make(chan struct{})}
+	p, err := player.NewMusicPlayerWithDecoder([]string{long, short}, NewMockPlayerFactory(), decoder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// Durations aren't decoded while sorting, so the order stays until they are known
+	p.SetSortMode(files.SortByDuration)
+	if got := p.GetMusicFiles(); !slices.Equal(got, []string{long, short}) {
+		t.Errorf("Expected files without known durations to keep their order, got %v", got)
+	}
+
+	// The list is sorted again once the background job has them, which the sort version tells
+	version := p.GetSortVersion()
+	close(decoder.release)
+	deadline := time.Now().Add(5 * time.Second)
+	for p.GetSortVersion() == version && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := p.GetMusicFiles(); !slices.Equal(got, []string{short, long}) {
+		t.Errorf("Expected files sorted by duration, got %v", got)
+	}
+}
+
+func TestSetSortMode_DurationClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.wav")
+	if err := WriteTestWav(path, 4800); err != nil {
+		t.Fatal(err)
+	}
+	decoder := &durationGateDecoder{release: make(chan struct{})}
+	p, err := player.NewMusicPlayerWithDecoder([]string{path}, NewMockPlayerFactory(), decoder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetSortMode(files.SortByDuration)
+
+	// Close cancels the durations being computed for the sort and waits for the job to end
+	closed := make(chan struct{})
+	go func() {
+		p.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not cancel the background sort")
+	}
+}
+
+// durationGateDecoder holds back decoding durations until release is closed, or the decode is cancelled
+type durationGateDecoder struct {
+	release chan struct{}
+}
+
+func (d *durationGateDecoder) Decode(src io.ReadSeeker, format files.Format, sampleRate int) (player.DecodedStream, error) {
+	// Durations are decoded at the native rate; reads fail once their decode is cancelled
+	for released := sampleRate != 0; !released; {
+		select {
+		case <-d.release:
+			released = true
+		case <-time.After(time.Millisecond):
+		}
+		if _, err := src.Read(make([]byte, 1)); err != nil {
+			return nil, err
+		}
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	return player.DefaultDecoder().Decode(src, format, sampleRate)
+}
+
+func TestMusicSelector_Move(t *testing.T) {
+	s := player.NewMusicSelector()
+	s.Update([]string{"a.wav", "b.wav", "c.wav", "d.wav"})
+	if err := s.SelectIndex(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Move(3, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(s.Files(), ","); got != "d.wav,a.wav,b.wav,c.wav" {
+		t.Errorf("Expected d.wav moved to the top, got %s", got)
+	}
+	if path, _ := s.CurrentFile(); path != "b.wav" {
+		t.Errorf("Expected the current track to stay selected, got %s", path)
+	}
+	s.SelectNext()
+	if path, _ := s.CurrentFile(); path != "c.wav" {
+		t.Errorf("Expected playback to follow the new order, got %s", path)
+	}
+
+	// Moving the current track keeps it selected
+	if err := s.Move(3, 1); err != nil {
+		t.Fatal(err)
+	}
+	if path, _ := s.CurrentFile(); path != "c.wav" || s.CurrentIndex() != 1 {
+		t.Errorf("Expected c.wav selected at index 1, got %s at %d", path, s.CurrentIndex())
+	}
+
+	if err := s.Move(0, 4); err == nil {
+		t.Error("Expected an error for an out of range index")
+	}
+
+	// The custom order survives file changes; new files follow in the sort order
+	s.Update([]string{"a.wav", "b.wav", "c.wav", "d.wav", "0.wav"})
+	if got := strings.Join(s.Files(), ","); got != "d.wav,c.wav,a.wav,b.wav,0.wav" {
+		t.Errorf("Expected the custom order kept, got %s", got)
+	}
+
+	// Choosing a sort order replaces it
+	s.SetSortMode(files.SortByName)
+	if s.CustomOrder() != nil {
+		t.Error("Expected the custom order cleared by SetSortMode")
+	}
+	if got := strings.Join(s.Files(), ","); got != "0.wav,a.wav,b.wav,c.wav,d.wav" {
+		t.Errorf("Expected files sorted by name, got %s", got)
+	}
+}
+
+func TestMasterVolume(t *testing.T) {
+	p, mockFactory := createTestMusicPlayer(t)
+	defer p.Close()
+
+	if p.GetMasterVolume() != 1.0 {
+		t.Errorf("Expected default master volume 1.0, got %f", p.GetMasterVolume())
+	}
+
+	// Clamped to 0.0-1.0
+	p.SetMasterVolume(1.5)
+	if p.GetMasterVolume() != 1.0 {
+		t.Errorf("Expected master volume clamped to 1.0, got %f", p.GetMasterVolume())
+	}
+	p.SetMasterVolume(-0.5)
+	if p.GetMasterVolume() != 0.0 {
+		t.Errorf("Expected master volume clamped to 0.0, got %f", p.GetMasterVolume())
+	}
+
+	// Applied immediately to the playing track
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatalf("Failed to set initial index: %v", err)
+	}
+	p.SetMasterVolume(0.5)
+	if v := mockFactory.GetLastPlayer().Volume(); v != 0.5 {
+		t.Errorf("Expected volume 0.5 after SetMasterVolume, got %f", v)
+	}
+
+	// Kept across track changes
+	if err := p.SkipToNext(); err != nil {
+		t.Fatal(err)
+	}
+	if v := mockFactory.GetLastPlayer().Volume(); v != 0.5 {
+		t.Errorf("Expected volume 0.5 after skipping, got %f", v)
+	}
+
+	// Fade-out is scaled by the master volume
+	p.SetLoopDurationMinutes(1.0 / 3600) // One frame
+	p.SetFadeOutDuration(time.Second)    // 60 frames
+	for i := 0; i < 31; i++ {
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.GetState() != player.StateFadingOut {
+		t.Fatalf("Expected StateFadingOut, got %v", p.GetState())
+	}
+	if v := mockFactory.GetLastPlayer().Volume(); v < 0.2 || v > 0.3 {
+		t.Errorf("Expected fading-out volume around 0.25, got %f", v)
+	}
+}
+
+func TestToggleMute(t *testing.T) {
+	p, mockFactory := createTestMusicPlayer(t)
+	defer p.Close()
+
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatalf("Failed to set initial index: %v", err)
+	}
+	p.SetMasterVolume(0.8)
+
+	p.ToggleMute()
+	if !p.IsMuted() || p.GetMasterVolume() != 0 {
+		t.Fatalf("Expected muted with volume 0, got muted %v volume %f", p.IsMuted(), p.GetMasterVolume())
+	}
+	if v := mockFactory.GetLastPlayer().Volume(); v != 0 {
+		t.Errorf("Expected silent player while muted, got %f", v)
+	}
+	if p.Settings().Volume != 0.8 {
+		t.Errorf("Expected settings to keep the unmuted volume 0.8, got %f", p.Settings().Volume)
+	}
+
+	// Fading out stays silent while muted
+	p.SetLoopDurationMinutes(1.0 / 3600) // One frame
+	p.SetFadeOutDuration(time.Second)    // 60 frames
+	for i := 0; i < 31; i++ {
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.GetState() != player.StateFadingOut {
+		t.Fatalf("Expected StateFadingOut, got %v", p.GetState())
+	}
+	if v := mockFactory.GetLastPlayer().Volume(); v != 0 {
+		t.Errorf("Expected silent fade while muted, got %f", v)
+	}
+
+	// Unmuting mid-fade restores the fade-adjusted level
+	p.ToggleMute()
+	if p.IsMuted() || p.GetMasterVolume() != 0.8 {
+		t.Fatalf("Expected unmuted with volume 0.8, got muted %v volume %f", p.IsMuted(), p.GetMasterVolume())
+	}
+	if v := mockFactory.GetLastPlayer().Volume(); v < 0.3 || v > 0.5 {
+		t.Errorf("Expected fade-adjusted volume around 0.4, got %f", v)
+	}
+
+	// Changing the volume while muted unmutes
+	p.ToggleMute()
+	p.SetMasterVolume(0.3)
+	if p.IsMuted() || p.GetMasterVolume() != 0.3 {
+		t.Errorf("Expected SetMasterVolume to unmute, got muted %v volume %f", p.IsMuted(), p.GetMasterVolume())
+	}
+}
+
+func TestSeek(t *testing.T) {
+	p, mockFactory := createTestMusicPlayer(t)
+	defer p.Close()
+
+	// Nothing to seek before music is loaded
+	if err := p.Seek(time.Second); err == nil {
+		t.Error("Expected an error when seeking without music")
+	}
+
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatalf("Failed to set initial index: %v", err)
+	}
+	if err := p.Seek(-time.Second); err == nil {
+		t.Error("Expected an error for a negative position")
+	}
+
+	// Seek moves the playback position and the loop counter
+	if err := p.Seek(30 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetPlaybackPosition() != 30*time.Second {
+		t.Errorf("Expected position 30s, got %v", p.GetPlaybackPosition())
+	}
+	if p.GetCounter() != 30*60 {
+		t.Errorf("Expected counter %d, got %d", 30*60, p.GetCounter())
+	}
+
+	// Seeking past the loop duration starts the fade-out
+	p.SetLoopDurationMinutes(1.0)
+	if err := p.Seek(2 * time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetState() != player.StateFadingOut {
+		t.Fatalf("Expected StateFadingOut, got %v", p.GetState())
+	}
+
+	// Seeking during the fade-out resumes playback at full volume
+	if err := p.Seek(0); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetState() != player.StatePlaying {
+		t.Errorf("Expected StatePlaying after seeking, got %v", p.GetState())
+	}
+	mockPlayer := mockFactory.GetLastPlayer()
+	if mockPlayer.Volume() != 1.0 || !mockPlayer.IsPlaying() {
+		t.Errorf("Expected the track playing at full volume, got volume %f playing %v", mockPlayer.Volume(), mockPlayer.IsPlaying())
+	}
+}
+
+func TestStopAndPlay(t *testing.T) {
+	p, mockFactory := createTestMusicPlayer(t)
+	defer p.Close()
+
+	// Play from the initial state loads the selected track
+	if err := p.Play(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetState() != player.StatePlaying {
+		t.Fatalf("Expected StatePlaying after Play, got %v", p.GetState())
+	}
+	mockPlayer := mockFactory.GetLastPlayer()
+	createdPlayers := len(mockFactory.audioPlayers)
+
+	mockPlayer.SetCurrent(42 * time.Second)
+	for i := 0; i < 10; i++ {
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Stop pauses and rewinds
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetState() != player.StateStopped {
+		t.Errorf("Expected StateStopped after Stop, got %v", p.GetState())
+	}
+	if mockPlayer.IsPlaying() {
+		t.Error("Expected the track to be paused after Stop")
+	}
+	if p.GetPlaybackPosition() != 0 || p.GetCounter() != 0 {
+		t.Errorf("Expected position and counter reset, got %v and %d", p.GetPlaybackPosition(), p.GetCounter())
+	}
+
+	// Time doesn't pass and pause has no effect while stopped
+	if err := p.Update(); err != nil {
+		t.Fatal(err)
+	}
+	p.TogglePause()
+	if p.GetCounter() != 0 || p.IsPaused() {
+		t.Errorf("Expected stopped player to stay idle, got counter %d paused %v", p.GetCounter(), p.IsPaused())
+	}
+
+	// Play resumes the same track without reloading
+	if err := p.Play(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetState() != player.StatePlaying || !mockPlayer.IsPlaying() {
+		t.Errorf("Expected the track playing after Play, got state %v", p.GetState())
+	}
+	if len(mockFactory.audioPlayers) != createdPlayers {
+		t.Error("Expected Play to resume without creating a new player")
+	}
+}
+
+func TestLoopRegion(t *testing.T) {
+	p, mockFactory := createTestMusicPlayer(t)
+	defer p.Close()
+
+	if _, _, ok := p.GetLoopRegion(); ok {
+		t.Error("Expected no loop region by default")
+	}
+	if err := p.SetLoopRegion(10*time.Second, 10*time.Second); err == nil {
+		t.Error("Expected an error when A equals B")
+	}
+	if err := p.SetLoopRegion(20*time.Second, 10*time.Second); err == nil {
+		t.Error("Expected an error when A is after B")
+	}
+
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatalf("Failed to set initial index: %v", err)
+	}
+	mockPlayer := mockFactory.GetLastPlayer()
+
+	if err := p.SetLoopRegion(10*time.Second, 20*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// Inside the region playback continues
+	mockPlayer.SetCurrent(15 * time.Second)
+	if err := p.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetPlaybackPosition() != 15*time.Second {
+		t.Errorf("Expected position to stay at 15s, got %v", p.GetPlaybackPosition())
+	}
+
+	// Passing B jumps back to A
+	mockPlayer.SetCurrent(20 * time.Second)
+	if err := p.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetPlaybackPosition() != 10*time.Second {
+		t.Errorf("Expected position 10s after passing B, got %v", p.GetPlaybackPosition())
+	}
+
+	// Without a region the whole track plays through
+	p.ClearLoopRegion()
+	mockPlayer.SetCurrent(30 * time.Second)
+	if err := p.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetPlaybackPosition() != 30*time.Second {
+		t.Errorf("Expected position 30s without a region, got %v", p.GetPlaybackPosition())
+	}
+
+	// Loading another track clears the region
+	if err := p.SetLoopRegion(10*time.Second, 20*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SkipToNext(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := p.GetLoopRegion(); ok {
+		t.Error("Expected the loop region to be cleared after changing tracks")
+	}
+}
+
+func TestPlayerState_String(t *testing.T) {
+	tests := []struct {
+		state    player.PlayerState
+		expected string
+	}{
+		{player.StateStopped, "Stopped"},
+		{player.StatePlaying, "Playing"},
+		{player.StateFadingOut, "FadingOut"},
+		{player.StateInterval, "Interval"},
+		{player.PlayerState(99), "PlayerState(99)"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.state.String(); got != tt.expected {
+			t.Errorf("PlayerState(%d).String() = %s, want %s", int(tt.state), got, tt.expected)
+		}
+	}
+
+	p, _ := createTestMusicPlayer(t)
+	if p.GetStateName() != "Stopped" {
+		t.Errorf("Expected initial state name Stopped, got %s", p.GetStateName())
+	}
+}
+
+func TestPlaybackSpeed(t *testing.T) {
+	p, mockFactory := createTestMusicPlayer(t)
+	defer p.Close()
+
+	if p.GetPlaybackSpeed() != 1.0 {
+		t.Errorf("Expected default speed 1.0, got %f", p.GetPlaybackSpeed())
+	}
+
+	// Clamped to 0.25-4.0
+	p.SetPlaybackSpeed(10)
+	if p.GetPlaybackSpeed() != 4.0 {
+		t.Errorf("Expected speed clamped to 4.0, got %f", p.GetPlaybackSpeed())
+	}
+	p.SetPlaybackSpeed(0)
+	if p.GetPlaybackSpeed() != 0.25 {
+		t.Errorf("Expected speed clamped to 0.25, got %f", p.GetPlaybackSpeed())
+	}
+	p.SetPlaybackSpeed(1.0)
+
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatalf("Failed to set initial index: %v", err)
+	}
+	mockFactory.GetLastPlayer().SetCurrent(10 * time.Second)
+
+	// Changing speed rebuilds the player at the same track position
+	p.SetPlaybackSpeed(2.0)
+	mockPlayer := mockFactory.GetLastPlayer()
+	if mockPlayer.Current() != 5*time.Second {
+		t.Errorf("Expected the new player at 5s of real time, got %v", mockPlayer.Current())
+	}
+	if p.GetPlaybackPosition() != 10*time.Second {
+		t.Errorf("Expected track position 10s, got %v", p.GetPlaybackPosition())
+	}
+	if !mockPlayer.IsPlaying() {
+		t.Error("Expected the rebuilt player to keep playing")
+	}
+
+	// The loop duration counts track time
+	counter := p.GetCounter()
+	for i := 0; i < 10; i++ {
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := p.GetCounter() - counter; got != 20 {
+		t.Errorf("Expected 20 track frames in 10 updates at 2x, got %d", got)
+	}
+
+	p.SetPlaybackSpeed(0.5)
+	counter = p.GetCounter()
+	for i := 0; i < 10; i++ {
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := p.GetCounter() - counter; got != 5 {
+		t.Errorf("Expected 5 track frames in 10 updates at 0.5x, got %d", got)
+	}
+}
+
+func TestLoadError(t *testing.T) {
+	tempDir := t.TempDir()
+	good := filepath.Join(tempDir, "good.wav")
+	broken := filepath.Join(tempDir, "broken.wav")
+	if err := WriteTestWav(good, 4800); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(broken, []byte("not a wav file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := player.NewMusicPlayer([]string{good, broken}, NewMockPlayerFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	var reportedPath string
+	var reportedErr error
+	p.SetOnLoadError(func(path string, err error) {
+		reportedPath = path
+		reportedErr = err
+	})
+
+	if err := p.SetCurrentIndex(1); err == nil {
+		t.Fatal("Expected an error loading a broken file")
+	}
+	if reportedPath != broken || reportedErr == nil {
+		t.Errorf("Expected OnLoadError for %s, got %q (%v)", broken, reportedPath, reportedErr)
+	}
+	if err := p.GetLastError(); err == nil || !strings.Contains(err.Error(), broken) {
+		t.Errorf("Expected GetLastError to include the path, got %v", err)
+	}
+	if p.GetState() != player.StateStopped {
+		t.Errorf("Expected StateStopped after a load error, got %v", p.GetState())
+	}
+
+	// A successful load clears the error
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.GetLastError(); err != nil {
+		t.Errorf("Expected no error after a successful load, got %v", err)
+	}
+
+	// Advancing to a broken file stops the player instead of failing Update
+	p.SetLoopDurationMinutes(1.0 / 3600)
+	p.SetFadeOutDuration(0)
+	p.SetIntervalSeconds(0)
+	for i := 0; i < 10; i++ {
+		if err := p.Update(); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+	}
+	if p.GetState() != player.StateStopped || p.GetLastError() == nil {
+		t.Errorf("Expected the player stopped with an error, got %v and %v", p.GetState(), p.GetLastError())
+	}
+}
+
+func TestLoopCount(t *testing.T) {
+	p, mockFactory := createTestMusicPlayer(t) // 100ms tracks
+	defer p.Close()
+
+	if p.GetLoopCount() != 0 {
+		t.Errorf("Expected infinite looping by default, got %d", p.GetLoopCount())
+	}
+	p.SetLoopCount(-1)
+	if p.GetLoopCount() != 0 {
+		t.Errorf("Expected negative loop count clamped to 0, got %d", p.GetLoopCount())
+	}
+
+	p.SetLoopCount(2)
+	p.SetIntervalSeconds(10)
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+	mock := mockFactory.GetLastPlayer()
+
+	step := func(pos time.Duration) {
+		t.Helper()
+		mock.SetCurrent(pos)
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The position keeps increasing while the stream loops
+	step(50 * time.Millisecond)
+	step(150 * time.Millisecond)
+	if p.GetLoopsPlayed() != 1 || p.GetState() != player.StatePlaying {
+		t.Fatalf("Expected 1 loop while playing, got %d in %v", p.GetLoopsPlayed(), p.GetState())
+	}
+
+	// Seeking back doesn't count as a loop
+	if err := p.Seek(10 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	step(20 * time.Millisecond)
+	if p.GetLoopsPlayed() != 1 {
+		t.Errorf("Expected seeking not to count as a loop, got %d", p.GetLoopsPlayed())
+	}
+
+	// A position going back without a seek also counts as wrapping around
+	step(5 * time.Millisecond)
+	if p.GetState() != player.StateInterval {
+		t.Errorf("Expected StateInterval after 2 loops, got %v", p.GetState())
+	}
+	if mock.IsPlaying() {
+		t.Error("Expected the track to stop playing after the loop count")
+	}
+
+	// The count restarts with the next track
+	if err := p.SkipToNext(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetLoopsPlayed() != 0 {
+		t.Errorf("Expected the loop count reset for a new track, got %d", p.GetLoopsPlayed())
+	}
+}
+
+// recordingObserver records playback events as strings
+type recordingObserver struct {
+	events []string
+}
+
+func (o *recordingObserver) OnTrackChanged(path string) {
+	o.events = append(o.events, "changed "+filepath.Base(path))
+}
+
+func (o *recordingObserver) OnStateChanged(oldState, newState player.PlayerState) {
+	o.events = append(o.events, oldState.String()+"->"+newState.String())
+}
+
+func (o *recordingObserver) OnTrackFinished(path string) {
+	o.events = append(o.events, "finished "+filepath.Base(path))
+}
+
+func TestPlaybackObserver(t *testing.T) {
+	p, _ := createTestMusicPlayer(t)
+	defer p.Close()
+
+	observer := &recordingObserver{}
+	p.AddObserver(observer)
+	p.AddObserver(nil) // Ignored
+
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+	p.SetLoopDurationMinutes(1.0 / 3600)   // One frame
+	p.SetFadeOutDuration(time.Second / 60) // One frame
+	p.SetIntervalSeconds(1.0 / 60)         // One frame
+	for i := 0; i < 3; i++ {
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []string{
+		"changed test1.wav", "Stopped->Playing",
+		"Playing->FadingOut",
+		"finished test1.wav", "FadingOut->Interval",
+		"changed test2.wav", "Interval->Playing",
+	}
+	if strings.Join(observer.events, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("Unexpected events:\n got %v\nwant %v", observer.events, expected)
+	}
+
+	// Stopping changes the state without finishing the track
+	observer.events = nil
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(observer.events, ", ") != "Playing->Stopped" {
+		t.Errorf("Expected only a state change on Stop, got %v", observer.events)
+	}
+
+	// Removed observers receive nothing
+	observer.events = nil
+	p.RemoveObserver(observer)
+	if err := p.Play(); err != nil {
+		t.Fatal(err)
+	}
+	if len(observer.events) != 0 {
+		t.Errorf("Expected no events after RemoveObserver, got %v", observer.events)
+	}
+}
+
+// skippingObserver skips to the next track when one finishes, calling back into the player
+type skippingObserver struct {
+	recordingObserver
+	p *player.MusicPlayer
+}
+
+func (o *skippingObserver) OnTrackFinished(path string) {
+	o.recordingObserver.OnTrackFinished(path)
+	o.p.SkipToNext()
+}
+
+func TestPlaybackObserver_CallsBackIntoPlayer(t *testing.T) {
+	p, mockFactory := createTestMusicPlayer(t)
+	defer p.Close()
+
+	observer := &skippingObserver{p: p}
+	p.AddObserver(observer)
+
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+	p.SetLoopDurationMinutes(1.0 / 3600)
+	p.SetFadeOutDuration(time.Second / 60) // One frame
+	for i := 0; i < 2; i++ {
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The skip happens after Update has paused the finished track, so the new one plays
+	if p.GetState() != player.StatePlaying || p.GetCurrentIndex() != 1 {
+		t.Errorf("Expected the observer to skip to track 1, got %v at %d", p.GetState(), p.GetCurrentIndex())
+	}
+	if !mockFactory.GetLastPlayer().IsPlaying() {
+		t.Error("Expected the skipped-to track to be playing")
+	}
+}
+
+func TestGetCurrentLevels(t *testing.T) {
+	// Left at half scale, right at negative half scale
+	pcm := make([]int16, 4800*2)
+	for i := range pcm {
+		pcm[i] = 16384
+		if i%2 == 1 {
+			pcm[i] = -16384
+		}
+	}
+	path := filepath.Join(t.TempDir(), "half.wav")
+	if err := WriteTestWavPCM(path, pcm); err != nil {
+		t.Fatal(err)
+	}
+
+	mockFactory := NewMockPlayerFactory()
+	p, err := player.NewMusicPlayer([]string{path}, mockFactory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if peak, rms := p.GetCurrentLevels(); peak != 0 || rms != 0 {
+		t.Errorf("Expected no levels before playing, got %v, %v", peak, rms)
+	}
+
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read from the stream as the audio player would
+	buf := make([]byte, 4096)
+	if _, err := io.ReadFull(mockFactory.GetLastStream(), buf); err != nil {
+		t.Fatal(err)
+	}
+
+	peak, rms := p.GetCurrentLevels()
+	if math.Abs(peak-0.5) > 1e-3 || math.Abs(rms-0.5) > 1e-3 {
+		t.Errorf("GetCurrentLevels() = %v, %v, want 0.5, 0.5", peak, rms)
+	}
+
+	p.TogglePause()
+	if peak, rms := p.GetCurrentLevels(); peak != 0 || rms != 0 {
+		t.Errorf("Expected no levels while paused, got %v, %v", peak, rms)
+	}
+}
+
+// TestNewTestTone tests that the tone peaks at its level and loops seamlessly
+func TestNewTestTone(t *testing.T) {
+	tone := player.NewTestTone(player.DefaultTestToneFrequency, 48000)
+	if tone.Length() != 48000*4 || tone.SampleRate() != 48000 {
+		t.Fatalf("Expected a second of 48kHz stereo, got %d bytes at %d Hz", tone.Length(), tone.SampleRate())
+	}
+	data, err := io.ReadAll(tone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// -12 dBFS peaks at a quarter of full scale
+	want := math.Pow(10, -12.0/20) * math.MaxInt16
+	var peak float64
+	for i := 0; i+4 <= len(data); i += 4 {
+		left := int16(binary.LittleEndian.Uint16(data[i:]))
+		right := int16(binary.LittleEndian.Uint16(data[i+2:]))
+		if left != right {
+			t.Fatalf("Expected the same tone on both channels at byte %d", i)
+		}
+		peak = max(peak, math.Abs(float64(left)))
+	}
+	if math.Abs(peak-want) > 1 {
+		t.Errorf("Expected a peak of %.0f, got %.0f", want, peak)
+	}
+
+	// Whole cycles: the first sample of the next loop follows on from the last one
+	first := int16(binary.LittleEndian.Uint16(data))
+	last := int16(binary.LittleEndian.Uint16(data[len(data)-4:]))
+	if first != 0 || last >= 0 || last < -int16(want*2*math.Pi*1000/48000)-1 {
+		t.Errorf("Expected the tone to loop seamlessly, got last sample %d before %d", last, first)
+	}
+
+	if quiet := player.NewTestToneWithLevel(440.5, 3, 44100); quiet.Length()%4 != 0 {
+		t.Errorf("Expected whole stereo samples, got %d bytes", quiet.Length())
+	}
+}
+
+func TestMusicPlayer_PlayTestTone(t *testing.T) {
+	p, mockFactory := createTestMusicPlayer(t)
+	defer p.Close()
+	p.SetMasterVolume(0.5)
+
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+	trackPlayer := mockFactory.GetLastPlayer()
+
+	if err := p.PlayTestTone(player.DefaultTestToneFrequency, player.DefaultTestToneLevel); err != nil {
+		t.Fatal(err)
+	}
+	tonePlayer := mockFactory.GetLastPlayer()
+	if tonePlayer == trackPlayer || !tonePlayer.IsPlaying() {
+		t.Fatal("Expected the tone to play on a player of its own")
+	}
+	if trackPlayer.IsPlaying() || !p.IsPaused() {
+		t.Error("Expected the track to be paused for the tone")
+	}
+	if tonePlayer.Volume() != 1 {
+		t.Errorf("Expected the tone to ignore the master volume, got volume %v", tonePlayer.Volume())
+	}
+	if label, ok := p.GetTestTone(); !ok || label != "1000 Hz, -12 dBFS" {
+		t.Errorf("Expected the tone to be described, got %q, %v", label, ok)
+	}
+
+	// Resuming the track stops the tone
+	p.TogglePause()
+	if !tonePlayer.IsClosed() || !trackPlayer.IsPlaying() {
+		t.Error("Expected resuming the track to stop the tone")
+	}
+	if _, ok := p.GetTestTone(); ok {
+		t.Error("Expected no tone after resuming")
+	}
+
+	for _, freq := range []float64{0, -1, 24000} {
+		if err := p.PlayTestTone(freq, player.DefaultTestToneLevel); err == nil {
+			t.Errorf("Expected an error for a %v Hz tone", freq)
+		}
+	}
+}
+
+// TestMusicPlayer_DidClip tests that reading a full-scale sample trips the clip flag of the track
+func TestMusicPlayer_DidClip(t *testing.T) {
+	dir := t.TempDir()
+	clipping := filepath.Join(dir, "clipping.wav")
+	clean := filepath.Join(dir, "clean.wav")
+	pcm := make([]int16, 4800*2)
+	pcm[1000] = math.MinInt16
+	if err := WriteTestWavPCM(clipping, pcm); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteTestWav(clean, 4800); err != nil {
+		t.Fatal(err)
+	}
+
+	mockFactory := NewMockPlayerFactory()
+	p, err := player.NewMusicPlayer([]string{clipping, clean}, mockFactory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+	if p.DidClip() {
+		t.Error("Expected no clipping before anything is played")
+	}
+	buf := make([]byte, 8192)
+	if _, err := io.ReadFull(mockFactory.GetLastStream(), buf); err != nil {
+		t.Fatal(err)
+	}
+	if !p.DidClip() {
+		t.Error("Expected clipping after reading a full-scale sample")
+	}
+
+	// The flag stays set through quieter parts until reset
+	if _, err := io.ReadFull(mockFactory.GetLastStream(), buf); err != nil {
+		t.Fatal(err)
+	}
+	if !p.DidClip() {
+		t.Error("Expected clipping to stay flagged")
+	}
+	p.ResetClip()
+	if p.DidClip() {
+		t.Error("Expected no clipping after ResetClip")
+	}
+
+	if err := p.SetCurrentIndex(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(mockFactory.GetLastStream(), buf); err != nil {
+		t.Fatal(err)
+	}
+	if p.DidClip() {
+		t.Error("Expected a silent track not to clip")
+	}
+
+	// The report checks whole files
+	for _, entry := range p.Report() {
+		if want := entry.Path == clipping; entry.Clipped != want {
+			t.Errorf("Report entry %s: Clipped = %v, want %v", entry.Path, entry.Clipped, want)
+		}
+	}
+}
+
+func TestMusicLoader_ComputeWaveform(t *testing.T) {
+	// Silent first half, half scale second half
+	pcm := make([]int16, 4800*2)
+	for i := len(pcm) / 2; i < len(pcm); i++ {
+		pcm[i] = 16384
+	}
+	path := filepath.Join(t.TempDir(), "wave.wav")
+	if err := WriteTestWavPCM(path, pcm); err != nil {
+		t.Fatal(err)
+	}
+
+	loader := player.NewMusicLoader()
+	peaks, err := loader.ComputeWaveform(path, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float32{0, 0, 0.5, 0.5}
+	if len(peaks) != len(want) {
+		t.Fatalf("ComputeWaveform() returned %d buckets, want %d", len(peaks), len(want))
+	}
+	for i := range want {
+		if math.Abs(float64(peaks[i]-want[i])) > 1e-3 {
+			t.Errorf("ComputeWaveform()[%d] = %v, want %v", i, peaks[i], want[i])
+		}
+	}
+
+	if _, err := loader.ComputeWaveform(path, 0); err == nil {
+		t.Error("Expected an error for zero buckets")
+	}
+
+	// Changing the file invalidates the cache
+	if err := WriteTestWav(path, 4800); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	peaks, err = loader.ComputeWaveform(path, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, peak := range peaks {
+		if peak != 0 {
+			t.Errorf("Expected silence after the file changed, got %v in bucket %d", peak, i)
+		}
+	}
+}
+
+func TestMusicLoader_Waveform(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "silence.wav")
+	if err := WriteTestWav(path, 4800); err != nil {
+		t.Fatal(err)
+	}
+
+	loader := player.NewMusicLoader()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		peaks, ok := loader.Waveform(path, 8)
+		if ok {
+			if len(peaks) != 8 {
+				t.Errorf("Expected 8 buckets, got %d", len(peaks))
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Waveform was not computed in the background")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A broken file is reported as ready with no peaks
+	broken := filepath.Join(t.TempDir(), "broken.wav")
+	if err := os.WriteFile(broken, []byte("not a wav file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loader.ComputeWaveform(broken, 8); err == nil {
+		t.Error("Expected an error for a broken file")
+	}
+	if peaks, ok := loader.Waveform(broken, 8); !ok || peaks != nil {
+		t.Errorf("Waveform() = %v, %v, want nil, true", peaks, ok)
+	}
+}
+
+func TestGetLoopBody(t *testing.T) {
+	p, _ := createTestMusicPlayer(t)
+	defer p.Close()
+
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+
+	// A WAV file without loop points repeats whole
+	if _, _, ok := p.GetLoopBody(); ok {
+		t.Error("Expected no loop body for a track that loops whole")
+	}
+
+	// The A-B region is the loop body while it is set
+	if err := p.SetLoopRegion(10*time.Millisecond, 60*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	start, end, ok := p.GetLoopBody()
+	if !ok || start != 10*time.Millisecond || end != 60*time.Millisecond {
+		t.Errorf("GetLoopBody() = %v, %v, %v, want 10ms, 60ms, true", start, end, ok)
+	}
+
+	p.ClearLoopRegion()
+	if _, _, ok := p.GetLoopBody(); ok {
+		t.Error("Expected no loop body after clearing the region")
+	}
+}
+
+// rawDecoder is a Decoder reading files as raw 16bit stereo samples at DefaultSampleRate
+type rawDecoder struct {
+	formats []files.Format // Formats it was asked to decode
+}
+
+func (d *rawDecoder) Decode(src io.ReadSeeker, format files.Format, sampleRate int) (player.DecodedStream, error) {
+	d.formats = append(d.formats, format)
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+	return rawStream{bytes.NewReader(data)}, nil
+}
+
+type rawStream struct {
+	*bytes.Reader
+}
+
+func (s rawStream) Length() int64   { return s.Size() }
+func (s rawStream) SampleRate() int { return player.DefaultSampleRate }
+
+func TestNewMusicPlayerWithDecoder(t *testing.T) {
+	// Raw PCM isn't supported by the default decoder
+	path := filepath.Join(t.TempDir(), "raw.pcm")
+	if err := os.WriteFile(path, make([]byte, 4800*4), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := player.NewMusicLoader().LoadStream(path); err == nil || !strings.Contains(err.Error(), "unsupported audio format") {
+		t.Errorf("Expected the default decoder to reject raw PCM, got %v", err)
+	}
+
+	decoder := &rawDecoder{}
+	p, err := player.NewMusicPlayerWithDecoder([]string{path}, NewMockPlayerFactory(), decoder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatalf("Expected the custom decoder to load the track: %v", err)
+	}
+	if p.GetState() != player.StatePlaying {
+		t.Errorf("Expected state Playing, got %v", p.GetState())
+	}
+	if d, err := p.GetDuration(path); err != nil || d != 100*time.Millisecond {
+		t.Errorf("GetDuration() = %v, %v, want 100ms", d, err)
+	}
+	if len(decoder.formats) == 0 || decoder.formats[0] != files.FormatUnknown {
+		t.Errorf("Expected the decoder to be asked for the unknown format, got %v", decoder.formats)
+	}
+
+	// A factory with a decoder decodes the files for its players
+	factoryDecoder := &rawDecoder{}
+	p2, err := player.NewMusicPlayer([]string{path}, player.NewPlayerFactoryWithDecoder(NewMockPlayerFactory(), factoryDecoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p2.Close()
+	if err := p2.SetCurrentIndex(0); err != nil {
+		t.Fatalf("Expected the factory's decoder to load the track: %v", err)
+	}
+	if len(factoryDecoder.formats) == 0 {
+		t.Error("Expected the factory's decoder to be used")
+	}
+}
+
+func TestMusicPlayer_EmptyStream(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.wav")
+	good := filepath.Join(dir, "good.wav")
+	if err := os.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(good, make([]byte, 4800*4), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The raw decoder turns the empty file into a stream whose Length() is 0
+	p, err := player.NewMusicPlayerWithDecoder([]string{empty, good}, NewMockPlayerFactory(), &rawDecoder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	var failed []string
+	p.SetOnLoadError(func(path string, err error) {
+		failed = append(failed, path)
+	})
+
+	if err := p.SetCurrentIndex(0); err == nil {
+		t.Fatal("Expected an empty stream to fail to load")
+	}
+	if p.GetState() != player.StateStopped {
+		t.Errorf("Expected state Stopped, got %v", p.GetState())
+	}
+	if err := p.GetLastError(); err == nil || !strings.Contains(err.Error(), "no audio samples") {
+		t.Errorf("Expected the empty track to be reported, got %v", err)
+	}
+	if !slices.Equal(failed, []string{empty}) {
+		t.Errorf("Expected OnLoadError for %s, got %v", empty, failed)
+	}
+
+	// Other tracks still play
+	if err := p.SetCurrentIndex(1); err != nil {
+		t.Fatalf("Expected the next track to load: %v", err)
+	}
+	if p.GetState() != player.StatePlaying {
+		t.Errorf("Expected state Playing, got %v", p.GetState())
+	}
+}
+
+func TestNullPlayerFactory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "silence.wav")
+	if err := WriteTestWav(path, 4800); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := player.NewMusicPlayer([]string{path}, player.NewNullPlayerFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatalf("Expected a silent player to load the track: %v", err)
+	}
+	if p.GetState() != player.StatePlaying {
+		t.Errorf("Expected state Playing, got %v", p.GetState())
+	}
+
+	// The position advances while playing and stops while paused
+	time.Sleep(10 * time.Millisecond)
+	if p.GetPlaybackPosition() <= 0 {
+		t.Error("Expected the position to advance while playing")
+	}
+	p.TogglePause()
+	paused := p.GetPlaybackPosition()
+	time.Sleep(10 * time.Millisecond)
+	if p.GetPlaybackPosition() != paused {
+		t.Errorf("Expected the position to stay at %v while paused, got %v", paused, p.GetPlaybackPosition())
+	}
+
+	if err := p.Seek(50 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetPlaybackPosition() != 50*time.Millisecond {
+		t.Errorf("Expected position 50ms after seeking, got %v", p.GetPlaybackPosition())
+	}
+}
+
+// TestSampleRate tests that the player decodes at the rate of its factory
+func TestSampleRate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "silence.wav")
+	if err := WriteTestWav(path, 4800); err != nil {
+		t.Fatal(err)
+	}
+
+	// Factories without a rate get the default one
+	p, err := player.NewMusicPlayer(nil, NewMockPlayerFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.SampleRate() != player.DefaultSampleRate {
+		t.Errorf("Expected the default sample rate %d, got %d", player.DefaultSampleRate, p.SampleRate())
+	}
+	p.Close()
+
+	p, err = player.NewMusicPlayer([]string{path}, player.NewNullPlayerFactoryWithSampleRate(44100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if p.SampleRate() != 44100 {
+		t.Errorf("Expected the factory's sample rate 44100, got %d", p.SampleRate())
+	}
+	if warning := p.FormatWarning(path); !strings.Contains(warning, "48000 Hz is resampled to 44100 Hz") {
+		t.Errorf("Expected a resampling warning, got %q", warning)
+	}
+
+	// 0.1s of 48kHz audio is resampled to 4410 samples
+	stream, err := player.NewMusicLoaderWithSampleRate(44100).LoadStream(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.(io.Closer).Close()
+	if got := stream.(interface{ Length() int64 }).Length(); got != 4410*4 {
+		t.Errorf("Expected a stream of %d bytes, got %d", 4410*4, got)
+	}
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatalf("Expected the track to load: %v", err)
+	}
+}
+
+func TestRunBatchCheck(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// A ramp, so a loop that doesn't return to the start would be noticed, with one half scale sample
+	pcm := make([]int16, 4800*2)
+	for i := range pcm {
+		pcm[i] = int16(i / 2 % 100)
+	}
+	pcm[0] = 16384
+	good := filepath.Join(tempDir, "good.wav")
+	if err := WriteTestWavPCM(good, pcm); err != nil {
+		t.Fatal(err)
+	}
+	broken := filepath.Join(tempDir, "broken.wav")
+	if err := os.WriteFile(broken, []byte("not a wav file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := player.RunBatchCheck([]string{good}, nil); err == nil {
+		t.Error("Expected an error without a player factory")
+	}
+
+	results, err := player.RunBatchCheck([]string{good, broken}, player.NewNullPlayerFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+
+	if r := results[0]; !r.OK() || r.Path != good || r.Duration != 100*time.Millisecond || math.Abs(r.Peak-0.5) > 1e-3 {
+		t.Errorf("Unexpected result for a good file: %+v", r)
+	}
+	if r := results[1]; r.OK() || r.Decoded || r.Err == nil {
+		t.Errorf("Expected a broken file to fail to decode: %+v", r)
+	}
+}
+
+func TestNormalization(t *testing.T) {
+	// Peaks at a quarter of full scale, so normalizing doubles the volume
+	pcm := make([]int16, 4800*2)
+	for i := range pcm {
+		pcm[i] = 8192
+	}
+	path := filepath.Join(t.TempDir(), "quiet.wav")
+	if err := WriteTestWavPCM(path, pcm); err != nil {
+		t.Fatal(err)
+	}
+
+	mockFactory := NewMockPlayerFactory()
+	p, err := player.NewMusicPlayer([]string{path}, mockFactory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if p.IsNormalizationEnabled() {
+		t.Error("Expected normalization to be off by default")
+	}
+
+	p.SetMasterVolume(0.4)
+	p.SetNormalizationEnabled(true)
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+	mock := mockFactory.GetLastPlayer()
+
+	// The peak is computed in the background, and the gain applied by Update once it is known
+	deadline := time.Now().Add(5 * time.Second)
+	for p.GetTrackGain() == 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if math.Abs(p.GetTrackGain()-2) > 1e-3 || math.Abs(mock.Volume()-0.8) > 1e-3 {
+		t.Errorf("Expected gain 2 and volume 0.8, got %v and %v", p.GetTrackGain(), mock.Volume())
+	}
+
+	// The boost stops at full volume
+	p.SetMasterVolume(1)
+	if mock.Volume() != 1 {
+		t.Errorf("Expected volume clamped to 1, got %v", mock.Volume())
+	}
+
+	// Turning it off restores the plain volume of the current track
+	p.SetMasterVolume(0.4)
+	p.SetNormalizationEnabled(false)
+	if p.GetTrackGain() != 1 || math.Abs(mock.Volume()-0.4) > 1e-9 {
+		t.Errorf("Expected gain 1 and volume 0.4 after disabling, got %v and %v", p.GetTrackGain(), mock.Volume())
+	}
+}
+
+func TestGetCachedDuration(t *testing.T) {
+	p, _ := createTestMusicPlayer(t)
+	defer p.Close()
+	path := p.GetMusicFiles()[1]
+
+	if _, ok := p.GetCachedDuration(path); ok {
+		t.Error("Expected no duration before the track is decoded")
+	}
+	version := p.GetDurationsVersion()
+
+	// Computing the waveform gives the duration along with it
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := p.GetWaveform(path, 8); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Waveform was not computed in the background")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if duration, ok := p.GetCachedDuration(path); !ok || duration != 100*time.Millisecond {
+		t.Errorf("GetCachedDuration() = %v, %v, want 100ms, true", duration, ok)
+	}
+	if p.GetDurationsVersion() == version {
+		t.Error("Expected the durations version to change once the duration is cached")
+	}
+}
+
+func TestMusicLoader_ComputePeak(t *testing.T) {
+	pcm := make([]int16, 4800*2)
+	pcm[100] = 16384
+	path := filepath.Join(t.TempDir(), "peak.wav")
+	if err := WriteTestWavPCM(path, pcm); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The peak is taken from the waveform the UI shows, rather than decoding the file again
+	loader := player.NewMusicLoader()
+	if _, err := loader.ComputeWaveform(path, 800); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteTestWavPCM(path, make([]int16, 4800*2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, stat.ModTime(), stat.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if peak, err := loader.ComputePeak(context.Background(), path); err != nil || peak != 0.5 {
+		t.Errorf("ComputePeak() = %v, %v, want the cached 0.5", peak, err)
+	}
+
+	// A changed file is decoded again
+	if err := WriteTestWavPCM(path, make([]int16, 4800*4)); err != nil {
+		t.Fatal(err)
+	}
+	if peak, err := loader.ComputePeak(context.Background(), path); err != nil || peak != 0 {
+		t.Errorf("ComputePeak() = %v, %v, want 0 for silence", peak, err)
+	}
+}
+
+func TestPlayHistory(t *testing.T) {
+	p, _ := createTestMusicPlayer(t)
+	defer p.Close()
+	musicFiles := p.GetMusicFiles()
+
+	if err := p.GoBackInHistory(); err == nil {
+		t.Error("Expected an error with an empty history")
+	}
+
+	// Play out of list order, restarting one track
+	for _, index := range []int{1, 0, 0} {
+		if err := p.SetCurrentIndex(index); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history := p.GetHistory()
+	if len(history) != 2 || history[0] != musicFiles[1] || history[1] != musicFiles[0] {
+		t.Fatalf("GetHistory() = %v, want [%s %s]", history, musicFiles[1], musicFiles[0])
+	}
+
+	// Going back plays the previously played track, not the previous one in the list
+	if err := p.GoBackInHistory(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetCurrentPath() != musicFiles[1] {
+		t.Errorf("Expected %s after going back, got %s", musicFiles[1], p.GetCurrentPath())
+	}
+	if history := p.GetHistory(); len(history) != 1 || history[0] != musicFiles[1] {
+		t.Errorf("Expected the history to end at the track gone back to, got %v", history)
+	}
+	if err := p.GoBackInHistory(); err == nil {
+		t.Error("Expected an error at the start of the history")
+	}
+
+	// The history is bounded
+	for i := 0; i < 150; i++ {
+		if err := p.SetCurrentIndex(i % 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(p.GetHistory()) != 100 {
+		t.Errorf("Expected the history to be capped at 100 tracks, got %d", len(p.GetHistory()))
+	}
+}
+
+func TestPauseOnFocusLoss(t *testing.T) {
+	p, _ := createTestMusicPlayer(t)
+	defer p.Close()
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Disabled by default
+	p.SetWindowFocused(false)
+	if p.IsPaused() {
+		t.Fatal("Expected playback to continue with pause on focus loss disabled")
+	}
+	p.SetWindowFocused(true)
+
+	p.SetPauseOnFocusLoss(true)
+	p.SetWindowFocused(false)
+	if !p.IsPaused() {
+		t.Fatal("Expected losing focus to pause playback")
+	}
+	p.SetWindowFocused(false) // Reported every frame
+	p.SetWindowFocused(true)
+	if p.IsPaused() {
+		t.Error("Expected regaining focus to resume playback")
+	}
+
+	// A pause made by the user isn't undone by regaining focus
+	p.TogglePause()
+	p.SetWindowFocused(false)
+	p.SetWindowFocused(true)
+	if !p.IsPaused() {
+		t.Error("Expected a manual pause to survive a focus change")
+	}
+	p.TogglePause()
+
+	// Resuming manually while unfocused isn't paused again
+	p.SetWindowFocused(false)
+	p.TogglePause()
+	p.SetWindowFocused(false)
+	if p.IsPaused() {
+		t.Error("Expected a manual resume to stick while unfocused")
+	}
+	p.SetWindowFocused(true)
+	if p.IsPaused() {
+		t.Error("Expected playback to continue after regaining focus")
+	}
+}
+
+func TestGetRemainingIntervalAndFadeProgress(t *testing.T) {
+	p, _ := createTestMusicPlayer(t)
+	defer p.Close()
+
+	// At 10 updates per second: 0.6 second loop, 1 second fade-out, 2 second interval
+	p.SetTPS(10)
+	p.SetLoopDurationMinutes(0.01)
+	p.SetFadeOutDuration(time.Second)
+	p.SetIntervalSeconds(2)
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+
+	update := func(n int) {
+		for i := 0; i < n; i++ {
+			if err := p.Update(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if p.GetRemainingInterval() != 0 || p.GetFadeProgress() != 0 {
+		t.Error("Expected zero values while playing")
+	}
+
+	update(6 + 4)
+	if p.GetState() != player.StateFadingOut {
+		t.Fatalf("Expected state FadingOut, got %v", p.GetState())
+	}
+	if got := p.GetFadeProgress(); math.Abs(got-0.4) > 1e-9 {
+		t.Errorf("GetFadeProgress() = %v, want 0.4", got)
+	}
+	if p.GetRemainingInterval() != 0 {
+		t.Error("Expected no remaining interval while fading out")
+	}
+
+	update(6 + 5)
+	if p.GetState() != player.StateInterval {
+		t.Fatalf("Expected state Interval, got %v", p.GetState())
+	}
+	if got := p.GetRemainingInterval(); got != 1500*time.Millisecond {
+		t.Errorf("GetRemainingInterval() = %v, want 1.5s", got)
+	}
+	if p.GetFadeProgress() != 0 {
+		t.Error("Expected no fade progress during the interval")
+	}
+}
+
+func TestSkipInterval(t *testing.T) {
+	p, mockFactory := createTestMusicPlayer(t)
+	defer p.Close()
+	musicFiles := p.GetMusicFiles()
+
+	p.SetMasterVolume(0.8)
+	p.SetLoopDurationMinutes(1.0 / 3600) // One frame
+	p.SetFadeOutDuration(time.Second)    // 60 frames
+	p.SetIntervalSeconds(10)
+
+	// Outside the gap it does nothing
+	if err := p.SkipInterval(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SkipInterval(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetCurrentPath() != musicFiles[0] || p.GetState() != player.StatePlaying {
+		t.Fatalf("Expected SkipInterval to be ignored while playing, got %s in %v", p.GetCurrentPath(), p.GetState())
+	}
+
+	// Partway through the fade-out, the volume is low
+	for i := 0; i < 1+30; i++ {
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.GetState() != player.StateFadingOut {
+		t.Fatalf("Expected StateFadingOut, got %v", p.GetState())
+	}
+	if err := p.SkipInterval(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetState() != player.StatePlaying || p.GetCurrentPath() != musicFiles[1] {
+		t.Fatalf("Expected the next track to play after skipping the fade-out, got %s in %v", p.GetCurrentPath(), p.GetState())
+	}
+	if v := mockFactory.GetLastPlayer().Volume(); math.Abs(v-0.8) > 1e-9 {
+		t.Errorf("Expected the next track at master volume 0.8 after skipping the fade-out, got %f", v)
+	}
+
+	// Through the fade-out into the interval
+	for i := 0; i < 1+60; i++ {
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.GetState() != player.StateInterval {
+		t.Fatalf("Expected StateInterval, got %v", p.GetState())
+	}
+	if err := p.SkipInterval(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetState() != player.StatePlaying || p.GetCurrentPath() != musicFiles[2%len(musicFiles)] {
+		t.Fatalf("Expected the next track to play after skipping the interval, got %s in %v", p.GetCurrentPath(), p.GetState())
+	}
+	if v := mockFactory.GetLastPlayer().Volume(); math.Abs(v-0.8) > 1e-9 {
+		t.Errorf("Expected the next track at master volume 0.8 after skipping the interval, got %f", v)
+	}
+}
+
+func TestManualTrackChangeDuringFadeOut(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(p *player.MusicPlayer) error
+	}{
+		{"SkipToNext", func(p *player.MusicPlayer) error { return p.SkipToNext() }},
+		{"SkipToPrevious", func(p *player.MusicPlayer) error { return p.SkipToPrevious() }},
+		{"SetCurrentIndex", func(p *player.MusicPlayer) error { return p.SetCurrentIndex(0) }},
+		{"GoBackInHistory", func(p *player.MusicPlayer) error { return p.GoBackInHistory() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, mockFactory := createTestMusicPlayer(t)
+			defer p.Close()
+
+			p.SetMasterVolume(0.6)
+			p.SetLoopDurationMinutes(1.0 / 3600) // One frame
+			p.SetFadeOutDuration(time.Second)    // 60 frames
+			for _, index := range []int{0, 1} {
+				if err := p.SetCurrentIndex(index); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Fade out partway, lowering the volume
+			for i := 0; i < 1+20; i++ {
+				if err := p.Update(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if p.GetState() != player.StateFadingOut {
+				t.Fatalf("Expected StateFadingOut, got %v", p.GetState())
+			}
+			if v := mockFactory.GetLastPlayer().Volume(); v >= 0.6 {
+				t.Fatalf("Expected the volume to be lowered by the fade-out, got %f", v)
+			}
+
+			if err := tt.change(p); err != nil {
+				t.Fatal(err)
+			}
+			if p.GetState() != player.StatePlaying {
+				t.Errorf("Expected StatePlaying after the track change, got %v", p.GetState())
+			}
+			if v := mockFactory.GetLastPlayer().Volume(); math.Abs(v-0.6) > 1e-9 {
+				t.Errorf("Expected the new track at master volume 0.6, got %f", v)
+			}
+		})
+	}
+}
+
+func TestListOutputDevices(t *testing.T) {
+	devices, err := player.ListOutputDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(devices, player.DefaultOutputDevice) {
+		t.Errorf("Expected the default device to be listed, got %v", devices)
+	}
+}
+
+func TestCompareTrack(t *testing.T) {
+	p, _ := createTestMusicPlayer(t)
+	defer p.Close()
+	musicFiles := p.GetMusicFiles()
+
+	// A shorter track to compare with, not in the list
+	comparePath := filepath.Join(t.TempDir(), "compare.wav")
+	if err := WriteTestWav(comparePath, 4800); err != nil { // 0.1 seconds
+		t.Fatal(err)
+	}
+
+	if err := p.ToggleCompare(); err == nil {
+		t.Error("Expected an error without a compare track")
+	}
+	if err := p.SetCompareTrack(comparePath); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ToggleCompare(); err == nil {
+		t.Error("Expected an error with no music loaded")
+	}
+
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Seek(50 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.ToggleCompare(); err != nil {
+		t.Fatal(err)
+	}
+	if !p.IsComparing() || p.GetCurrentPath() != comparePath {
+		t.Fatalf("Expected the compare track to play, got %s", p.GetCurrentPath())
+	}
+	if p.GetCurrentIndex() != 0 {
+		t.Errorf("Expected the selection to stay at 0, got %d", p.GetCurrentIndex())
+	}
+	if pos := p.GetTrackPosition(); pos != 50*time.Millisecond {
+		t.Errorf("Expected the compare track at 50ms, got %v", pos)
+	}
+
+	if err := p.ToggleCompare(); err != nil {
+		t.Fatal(err)
+	}
+	if p.IsComparing() || p.GetCurrentPath() != musicFiles[0] {
+		t.Fatalf("Expected the selected track to play again, got %s", p.GetCurrentPath())
+	}
+
+	// Past the end of the shorter track, the position wraps around
+	if err := p.Seek(150 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ToggleCompare(); err != nil {
+		t.Fatal(err)
+	}
+	if pos := p.GetTrackPosition(); pos >= 100*time.Millisecond {
+		t.Errorf("Expected the position to wrap within the 100ms compare track, got %v", pos)
+	}
+
+	// Changing tracks plays the selected track again
+	if err := p.SkipToNext(); err != nil {
+		t.Fatal(err)
+	}
+	if p.IsComparing() || p.GetCurrentPath() != musicFiles[1] {
+		t.Errorf("Expected the next selected track after skipping, got %s", p.GetCurrentPath())
+	}
+	if p.GetCompareTrack() != comparePath {
+		t.Error("Expected the compare track to stay set across track changes")
+	}
+
+	// Clearing the compare track while it plays switches back
+	if err := p.ToggleCompare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetCompareTrack(""); err != nil {
+		t.Fatal(err)
+	}
+	if p.IsComparing() || p.GetCurrentPath() != musicFiles[1] {
+		t.Errorf("Expected the selected track after clearing the compare track, got %s", p.GetCurrentPath())
+	}
+}
+
+func TestSetLogger(t *testing.T) {
+	p, _ := createTestMusicPlayer(t)
+	defer p.Close()
+
+	buf := &bytes.Buffer{}
+	p.SetLogger(logging.NewStdLogger(log.New(buf, "", 0), logging.LevelWarn))
+
+	// A mislabeled file logs a warning through the loader
+	mislabeled := filepath.Join(t.TempDir(), "mislabeled.mp3")
+	if err := WriteTestWav(mislabeled, 4800); err != nil {
+		t.Fatal(err)
+	}
+	p.UpdateMusicFiles([]string{mislabeled})
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "Warning: "+mislabeled+" contains WAV data despite its extension") {
+		t.Errorf("Expected the warning in the set logger, got %q", buf.String())
+	}
+
+	// nil silences the player
+	p.SetLogger(nil)
+	if p.Logger() == nil {
+		t.Error("Expected a logger that discards messages, got nil")
+	}
+	p.Logger().Error("dropped")
+}
+
+func TestGetLibrarySummary(t *testing.T) {
+	dir := t.TempDir()
+	one := filepath.Join(dir, "one.wav")
+	two := filepath.Join(dir, "two.wav")
+	broken := filepath.Join(dir, "broken.wav")
+	missing := filepath.Join(dir, "missing.wav")
+	if err := WriteTestWav(one, 48000); err != nil { // 1 second
+		t.Fatal(err)
+	}
+	if err := WriteTestWav(two, 96000); err != nil { // 2 seconds
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(broken, []byte("not audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := player.NewMusicPlayer([]string{one, two, broken, missing}, NewMockPlayerFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// Durations are computed in the background; the count is known right away
+	var count int
+	var total time.Duration
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		count, total = p.GetLibrarySummary()
+		if count != 4 {
+			t.Fatalf("Expected 4 tracks, got %d", count)
+		}
+		if total == 3*time.Second || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if total != 3*time.Second {
+		t.Errorf("Expected a total of 3s leaving out unreadable files, got %v", total)
+	}
+}
+
+func TestProbeLibrary(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i := range 10 {
+		path := filepath.Join(dir, fmt.Sprintf("track%d.wav", i))
+		if err := WriteTestWav(path, 4800*(i+1)); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	broken := filepath.Join(dir, "broken.wav")
+	if err := os.WriteFile(broken, []byte("not audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	paths = append(paths, broken)
+
+	loader := player.NewMusicLoader()
+	results := make(map[string]player.ProbeResult)
+	for result := range loader.ProbeLibrary(context.Background(), paths, 3) {
+		if _, ok := results[result.Path]; ok {
+			t.Errorf("%s was probed twice", result.Path)
+		}
+		results[result.Path] = result
+	}
+	if len(results) != len(paths) {
+		t.Fatalf("Expected %d results, got %d", len(paths), len(results))
+	}
+	for i, path := range paths[:10] {
+		result := results[path]
+		want := time.Duration(i+1) * 100 * time.Millisecond
+		if result.Err != nil || result.Duration != want || result.Info == nil || result.Info.SampleRate != 48000 {
+			t.Errorf("Unexpected result for %s: %+v, want duration %v", path, result, want)
+		}
+	}
+	if results[broken].Err == nil {
+		t.Error("Expected an error for a broken file")
+	}
+
+	// Cancelling stops the results and closes the channel
+	ctx, cancel := context.WithCancel(context.Background())
+	results2 := player.NewMusicLoader().ProbeLibrary(ctx, paths, 2)
+	<-results2
+	cancel()
+	for range results2 {
+		// Drained until the workers notice the cancellation
+	}
+}
+
+func TestMusicLoader_Context(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "track.wav")
+	if err := WriteTestWav(path, 48000); err != nil {
+		t.Fatal(err)
+	}
+	loader := player.NewMusicLoader()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := loader.LoadStreamContext(ctx, path); err == nil {
+		t.Error("Expected LoadStreamContext to fail with a cancelled context")
+	}
+	if _, err := loader.GetDurationContext(ctx, path); err == nil {
+		t.Error("Expected GetDurationContext to fail with a cancelled context")
+	}
+	if _, err := loader.ComputeWaveformContext(ctx, path, 10); err == nil {
+		t.Error("Expected ComputeWaveformContext to fail with a cancelled context")
+	}
+
+	// Cancelled decodes aren't cached, so the file decodes afterwards
+	if duration, err := loader.GetDuration(path); err != nil || duration <= 0 {
+		t.Errorf("GetDuration() = %v, %v after a cancelled decode", duration, err)
+	}
+	if peaks, err := loader.ComputeWaveform(path, 10); err != nil || len(peaks) != 10 {
+		t.Errorf("ComputeWaveform() = %v, %v after a cancelled decode", peaks, err)
+	}
+
+	// A stream keeps playing after the context it was loaded with is cancelled
+	ctx, cancel = context.WithCancel(context.Background())
+	stream, err := loader.LoadStreamContext(ctx, path)
+	if err != nil {
+		t.Fatalf("LoadStreamContext failed: %v", err)
+	}
+	cancel()
+	if n, err := stream.Read(make([]byte, 4096)); n == 0 || err != nil {
+		t.Errorf("Expected the stream to read after cancelling, got %d bytes, %v", n, err)
+	}
+}
+
+// writeBenchmarkLibrary writes count WAV files, each a few seconds long
+func writeBenchmarkLibrary(b *testing.B, count int) []string {
+	b.Helper()
+	dir := b.TempDir()
+	var paths []string
+	for i := range count {
+		path := filepath.Join(dir, fmt.Sprintf("track%d.wav", i))
+		if err := WriteTestWav(path, 48000*5); err != nil {
+			b.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// BenchmarkGetDuration measures decoding a file for its duration
+func BenchmarkGetDuration(b *testing.B) {
+	path := writeBenchmarkLibrary(b, 1)[0]
+	b.ResetTimer()
+	for range b.N {
+		// A new loader each time, so the duration isn't cached
+		if _, err := player.NewMusicLoader().GetDuration(path); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkProbeLibrary compares probing a library one file at a time with the worker pool
+func BenchmarkProbeLibrary(b *testing.B) {
+	paths := writeBenchmarkLibrary(b, 32)
+	for _, bench := range []struct {
+		name        string
+		concurrency int
+	}{
+		{"sequential", 1},
+		{"pool", 0},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			for range b.N {
+				for result := range player.NewMusicLoader().ProbeLibrary(context.Background(), paths, bench.concurrency) {
+					if result.Err != nil {
+						b.Fatal(result.Err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFavorites(t *testing.T) {
+	p, _ := createTestMusicPlayer(t)
+	defer p.Close()
+
+	files := p.GetMusicFiles()
+	if p.GetFavorites() != nil {
+		t.Errorf("Expected no favorites on a new player, got %v", p.GetFavorites())
+	}
+
+	if !p.ToggleFavorite(files[1]) || !p.ToggleFavorite(files[0]) {
+		t.Fatal("Expected ToggleFavorite to flag the tracks")
+	}
+	if !p.IsFavorite(files[0]) || !p.IsFavorite(files[1]) {
+		t.Error("Expected both tracks to be favorites")
+	}
+	if got := p.GetFavorites(); !slices.Equal(got, []string{files[0], files[1]}) {
+		t.Errorf("Expected sorted favorites, got %v", got)
+	}
+
+	if p.ToggleFavorite(files[1]) || p.IsFavorite(files[1]) {
+		t.Error("Expected ToggleFavorite to unflag the track")
+	}
+
+	// Favorites are part of the persistent settings
+	settings := p.Settings()
+	if !slices.Equal(settings.Favorites, []string{files[0]}) {
+		t.Errorf("Expected favorites in the settings, got %v", settings.Favorites)
+	}
+	settings.Favorites = []string{files[1]}
+	p.ApplySettings(settings)
+	if p.IsFavorite(files[0]) || !p.IsFavorite(files[1]) {
+		t.Error("Expected ApplySettings to replace the favorites")
+	}
+}
+
+func TestFavorites_MusicDirectory(t *testing.T) {
+	p, _ := createTestMusicPlayer(t)
+	defer p.Close()
+
+	path := p.GetMusicFiles()[0]
+	p.SetMusicDirectories(files.MusicDirectory(filepath.Dir(path)))
+	p.ToggleFavorite(path)
+
+	// Favorites are persisted keyed by the path relative to the music directory
+	settings := p.Settings()
+	if !slices.Equal(settings.Favorites, []string{filepath.Base(path)}) {
+		t.Errorf("Expected the favorite keyed by relative path in the settings, got %v", settings.Favorites)
+	}
+
+	// So they follow the tracks when the directory moves
+	moved := filepath.Join(t.TempDir(), "moved")
+	p.SetMusicDirectories(files.MusicDirectory(moved))
+	p.ApplySettings(settings)
+	if !p.IsFavorite(filepath.Join(moved, filepath.Base(path))) {
+		t.Error("Expected the favorite found under the moved directory")
+	}
+
+	// Full paths of earlier settings are converted to relative paths
+	p.SetMusicDirectories(files.MusicDirectory(filepath.Dir(path)))
+	settings.Favorites = []string{filepath.ToSlash(path)}
+	p.ApplySettings(settings)
+	if !p.IsFavorite(path) {
+		t.Error("Expected the favorite stored by full path to be kept")
+	}
+	if got := p.Settings().Favorites; !slices.Equal(got, []string{filepath.Base(path)}) {
+		t.Errorf("Expected the favorite migrated to a relative path, got %v", got)
+	}
+}
+
+func TestNotes(t *testing.T) {
+	p, _ := createTestMusicPlayer(t)
+	defer p.Close()
+
+	path := p.GetMusicFiles()[0]
+	dir := files.MusicDirectory(filepath.Dir(path))
+	p.SetMusicDirectories(dir)
+
+	if p.GetNote(path) != "" {
+		t.Errorf("Expected no note on a new player, got %q", p.GetNote(path))
+	}
+	p.SetNote(path, "loop click at 0:42")
+	if got := p.GetNote(path); got != "loop click at 0:42" {
+		t.Errorf("Expected the note to be stored, got %q", got)
+	}
+
+	// Notes are persisted keyed by the path relative to the music directory
+	settings := p.Settings()
+	if got := settings.Notes[filepath.Base(path)]; got != "loop click at 0:42" {
+		t.Errorf("Expected the note keyed by relative path in the settings, got %v", settings.Notes)
+	}
+
+	// So they follow the tracks when the directory moves
+	moved := filepath.Join(t.TempDir(), "moved")
+	p.SetMusicDirectories(files.MusicDirectory(moved))
+	p.ApplySettings(settings)
+	if got := p.GetNote(filepath.Join(moved, filepath.Base(path))); got != "loop click at 0:42" {
+		t.Errorf("Expected the note found under the moved directory, got %q", got)
+	}
+
+	// Empty text removes the note
+	p.SetNote(filepath.Join(moved, filepath.Base(path)), "")
+	if p.Settings().Notes != nil {
+		t.Errorf("Expected no notes left, got %v", p.Settings().Notes)
+	}
+}
+
+func TestLastTrack(t *testing.T) {
+	p, mockFactory := createTestMusicPlayer(t)
+	defer p.Close()
+
+	musicFiles := p.GetMusicFiles()
+	p.SetMusicDirectories(files.MusicDirectory(filepath.Dir(musicFiles[0])))
+
+	// The selected track is persisted relative to the music directory
+	if got := p.Settings().LastTrack; got != filepath.Base(musicFiles[0]) {
+		t.Errorf("Expected the first track remembered, got %q", got)
+	}
+
+	// The remembered track is selected on startup, but not played
+	settings := p.Settings()
+	settings.LastTrack = filepath.Base(musicFiles[1])
+	p.ApplySettings(settings)
+	if got := p.GetCurrentPath(); got != musicFiles[1] {
+		t.Errorf("Expected the remembered track selected, got %q", got)
+	}
+	if p.GetState() != player.StateStopped || mockFactory.GetLastStream() != nil {
+		t.Error("Expected the remembered track not to be played")
+	}
+	if got := p.Settings().LastTrack; got != filepath.Base(musicFiles[1]) {
+		t.Errorf("Expected the selection remembered, got %q", got)
+	}
+
+	// A track that is gone leaves the selection as it is
+	p2, _ := createTestMusicPlayer(t)
+	defer p2.Close()
+	settings.LastTrack = "gone.wav"
+	p2.ApplySettings(settings)
+	if got := p2.GetCurrentPath(); got != p2.GetMusicFiles()[0] {
+		t.Errorf("Expected the first track selected, got %q", got)
+	}
+}
+
+func TestExportReport(t *testing.T) {
+	dir := t.TempDir()
+	loud := filepath.Join(dir, "loud.wav")
+	quiet := filepath.Join(dir, "quiet.wav")
+	pcm := make([]int16, 48000*2) // 1 second
+	pcm[100] = 16384
+	if err := WriteTestWavPCM(loud, pcm); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteTestWav(quiet, 24000); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := player.NewMusicPlayer([]string{loud, quiet}, NewMockPlayerFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.SetMusicDirectories(files.MusicDirectory(dir))
+	p.ToggleFavorite(loud)
+	p.SetNote(loud, "clips, \"too hot\"")
+
+	var buf bytes.Buffer
+	if err := p.ExportReport(&buf, player.ReportCSV); err != nil {
+		t.Fatalf("ExportReport(CSV) failed: %v", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV report: %v", err)
+	}
+	want := [][]string{
+		{"path", "duration_seconds", "favorite", "note", "peak", "clipped", "error"},
+		{"loud.wav", "1.000", "true", "clips, \"too hot\"", "0.500", "false", ""},
+		{"quiet.wav", "0.500", "false", "", "0.000", "false", ""},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("CSV report = %v, want %v", records, want)
+	}
+
+	buf.Reset()
+	if err := p.ExportReport(&buf, player.ReportJSON); err != nil {
+		t.Fatalf("ExportReport(JSON) failed: %v", err)
+	}
+	var entries []player.ReportEntry
+	if err := json.Unmarshal(buf.Bytes(), &entries); err != nil {
+		t.Fatalf("Failed to parse JSON report: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Path != "loud.wav" || !entries[0].Favorite || entries[0].Peak != 0.5 || entries[1].DurationSeconds != 0.5 {
+		t.Errorf("Unexpected JSON report: %+v", entries)
+	}
+
+	// The file is named after the time in the given directory
+	path, err := p.ExportReportFile(dir, player.ReportJSON, time.Date(2025, 5, 1, 12, 30, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("ExportReportFile failed: %v", err)
+	}
+	if filepath.Base(path) != "review-report-20250501-123000.json" {
+		t.Errorf("Unexpected report file name: %s", path)
+	}
+
+	// Written in the background, the report is the same
+	result := <-p.ExportReportFileInBackground(context.Background(), dir, player.ReportCSV, time.Date(2025, 5, 1, 12, 31, 0, 0, time.UTC))
+	if result.Err != nil {
+		t.Fatalf("ExportReportFileInBackground failed: %v", result.Err)
+	}
+	f, err := os.Open(result.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if records, err := csv.NewReader(f).ReadAll(); err != nil || !reflect.DeepEqual(records, want) {
+		t.Errorf("Background CSV report = %v, %v, want %v", records, err, want)
+	}
+
+	// A cancelled export writes no file
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result = <-p.ExportReportFileInBackground(ctx, dir, player.ReportCSV, time.Date(2025, 5, 1, 12, 32, 0, 0, time.UTC))
+	if result.Err == nil {
+		t.Error("Expected an error for a cancelled export")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "review-report-20250501-123200.csv")); !os.IsNotExist(err) {
+		t.Errorf("Expected no report file after cancelling, got %v", err)
+	}
+}
+
+func TestAuditionLoopSeam(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ten.wav")
+	if err := WriteTestWav(path, 48000*10); err != nil {
+		t.Fatal(err)
+	}
+	mockFactory := NewMockPlayerFactory()
+	p, err := player.NewMusicPlayer([]string{path}, mockFactory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if err := p.AuditionLoopSeam(); err == nil {
+		t.Error("Expected an error with no music loaded")
+	}
+
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+	mockPlayer := mockFactory.GetLastPlayer()
+	p.TogglePause()
+
+	if err := p.AuditionLoopSeam(); err != nil {
+		t.Fatalf("AuditionLoopSeam failed: %v", err)
+	}
+	if !p.IsAuditioningLoopSeam() || p.IsPaused() {
+		t.Error("Expected the audition to start playing")
+	}
+	// The window runs from 3s before the end of the track to 2s into the wrapped loop
+	a, b, ok := p.GetLoopRegion()
+	if !ok || a != 7*time.Second || b != 12*time.Second {
+		t.Errorf("Expected the loop region 7s-12s, got %v-%v (set: %v)", a, b, ok)
+	}
+	if p.GetPlaybackPosition() != 7*time.Second {
+		t.Errorf("Expected playback from 7s, got %v", p.GetPlaybackPosition())
+	}
+
+	// The loop duration doesn't end the audition
+	p.SetLoopDurationMinutes(0.001)
+	for i := 0; i < 30; i++ {
+		mockPlayer.SetCurrent(time.Duration(7+i%5) * time.Second)
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.GetState() != player.StatePlaying {
+		t.Errorf("Expected playing while auditioning, got %v", p.GetState())
+	}
+
+	// Passing the end of the window jumps back before the seam
+	mockPlayer.SetCurrent(12 * time.Second)
+	if err := p.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetPlaybackPosition() != 7*time.Second {
+		t.Errorf("Expected a jump back to 7s, got %v", p.GetPlaybackPosition())
+	}
+
+	p.ClearLoopRegion()
+	if p.IsAuditioningLoopSeam() {
+		t.Error("Expected ClearLoopRegion to end the audition")
+	}
+}
+
+func TestUpdateMusicFiles_CurrentFileRemoved(t *testing.T) {
+	p, mockFactory := createTestMusicPlayer(t)
+	defer p.Close()
+
+	musicFiles := p.GetMusicFiles()
+	first, second := musicFiles[0], musicFiles[1]
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+	firstPlayer := mockFactory.GetLastPlayer()
+
+	// A file added before the playing one moves its index but doesn't restart it
+	added := filepath.Join(filepath.Dir(first), "a_added.wav")
+	if err := WriteTestWav(added, 4800); err != nil {
+		t.Fatal(err)
+	}
+	p.UpdateMusicFiles([]string{added, first, second})
+	if mockFactory.GetLastPlayer() != firstPlayer || p.GetCurrentPath() != first {
+		t.Error("Expected the playing track to continue when its index moved")
+	}
+
+	// Removing the playing file closes it and plays the newly selected track,
+	// even though the selection falls back to the same index
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+	addedPlayer := mockFactory.GetLastPlayer()
+	p.UpdateMusicFiles([]string{first, second})
+	if !addedPlayer.IsClosed() {
+		t.Error("Expected the removed track to be closed")
+	}
+	if p.GetCurrentPath() != first || p.GetState() != player.StatePlaying {
+		t.Errorf("Expected %s to play, got %q in state %v", first, p.GetCurrentPath(), p.GetState())
+	}
+	if mockFactory.GetLastPlayer() == addedPlayer {
+		t.Error("Expected a new player for the next track")
+	}
+
+	// Removing every file stops playback
+	lastPlayer := mockFactory.GetLastPlayer()
+	p.UpdateMusicFiles(nil)
+	if !lastPlayer.IsClosed() || p.GetCurrentPath() != "" || p.GetState() != player.StateStopped {
+		t.Errorf("Expected a clean stop with no files, got %q in state %v", p.GetCurrentPath(), p.GetState())
+	}
+}
+
+// gatedDecoder holds the first track load until released, counting the loads
+type gatedDecoder struct {
+	started chan struct{} // Closed once the first load is decoding
+	release chan struct{} // Closed to let the first load finish
+	mu      sync.Mutex
+	loads   int
+}
+
+func (d *gatedDecoder) Decode(src io.ReadSeeker, format files.Format, sampleRate int) (player.DecodedStream, error) {
+	// Durations are decoded at the native rate; only track loads resample
+	if sampleRate > 0 {
+		d.mu.Lock()
+		d.loads++
+		first := d.loads == 1
+		d.mu.Unlock()
+		if first {
+			close(d.started)
+			<-d.release
+		}
+	}
+	return player.DefaultDecoder().Decode(src, format, sampleRate)
+}
+
+func (d *gatedDecoder) Loads() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.loads
+}
+
+func TestUpdateMusicFiles_Reordered(t *testing.T) {
+	p, mockFactory := createTestMusicPlayer(t)
+	defer p.Close()
+	p.SetSortMode(files.SortByName)
+
+	musicFiles := p.GetMusicFiles()
+	first, second := musicFiles[0], musicFiles[1]
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+	firstPlayer := mockFactory.GetLastPlayer()
+	for i := 0; i < 30; i++ {
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	elapsed := p.GetElapsed()
+
+	// A rescan listing a file that sorts before the playing one moves it down without interrupting it
+	added := filepath.Join(filepath.Dir(first), "a_added.wav")
+	if err := WriteTestWav(added, 4800); err != nil {
+		t.Fatal(err)
+	}
+	p.UpdateMusicFiles([]string{first, second, added})
+	if got := p.GetMusicFiles(); !slices.Equal(got, []string{added, first, second}) {
+		t.Fatalf("Expected the files sorted by name, got %v", got)
+	}
+	if mockFactory.GetLastPlayer() != firstPlayer || firstPlayer.IsClosed() || !firstPlayer.IsPlaying() {
+		t.Error("Expected the playing track to continue without being reloaded")
+	}
+	if p.GetCurrentPath() != first || p.GetCurrentIndex() != 1 || p.GetState() != player.StatePlaying {
+		t.Errorf("Expected %s to play at index 1, got %q at %d in state %v", first, p.GetCurrentPath(), p.GetCurrentIndex(), p.GetState())
+	}
+	if p.GetElapsed() < elapsed {
+		t.Errorf("Expected the elapsed time to carry on from %v, got %v", elapsed, p.GetElapsed())
+	}
+
+	// Skipping follows the new order
+	if err := p.SkipToNext(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetCurrentPath() != second {
+		t.Errorf("Expected %s to follow in the new order, got %s", second, p.GetCurrentPath())
+	}
+
+	// A track still loading in the background keeps loading rather than starting over
+	decoder := &gatedDecoder{started: make(chan struct{}), release: make(chan struct{})}
+	loading, err := player.NewMusicPlayerWithDecoder([]string{first, second}, NewMockPlayerFactory(), decoder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loading.Close()
+	loading.SetSortMode(files.SortByName)
+	loading.SetBackgroundLoading(true)
+	if err := loading.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+	<-decoder.started
+	loading.UpdateMusicFiles([]string{first, second, added})
+	close(decoder.release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for loading.GetState() == player.StateLoading {
+		if time.Now().After(deadline) {
+			t.Fatal("Track did not finish loading")
+		}
+		time.Sleep(time.Millisecond)
+		if err := loading.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if loading.GetCurrentPath() != first || loading.GetState() != player.StatePlaying {
+		t.Errorf("Expected %s to play after loading, got %q in state %v", first, loading.GetCurrentPath(), loading.GetState())
+	}
+	if loads := decoder.Loads(); loads != 1 {
+		t.Errorf("Expected the track to be loaded once, got %d loads", loads)
+	}
+}
+
+func TestQueueMusicFiles(t *testing.T) {
+	p, _ := createTestMusicPlayer(t)
+	defer p.Close()
+
+	musicFiles := p.GetMusicFiles()
+	if p.ApplyQueuedMusicFiles() {
+		t.Error("Expected nothing to apply before a list is queued")
+	}
+
+	// Lists are queued from other goroutines, like a DirectoryWatcher handler,
+	// while the player is updated on this one
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				p.QueueMusicFiles(musicFiles[:1])
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		p.ApplyQueuedMusicFiles()
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	// The latest list wins
+	p.QueueMusicFiles(musicFiles)
+	if !p.ApplyQueuedMusicFiles() {
+		t.Fatal("Expected the queued list to be applied")
+	}
+	if got := p.GetMusicFiles(); !slices.Equal(got, musicFiles) {
+		t.Errorf("Expected %v after applying, got %v", musicFiles, got)
+	}
+	if p.ApplyQueuedMusicFiles() {
+		t.Error("Expected a queued list to be applied only once")
+	}
+}
+
+func TestProbe(t *testing.T) {
+	dir := t.TempDir()
+	loader := player.NewMusicLoader()
+
+	// The test WAV files are 48kHz 16bit stereo, matching the playback format
+	wavPath := filepath.Join(dir, "match.wav")
+	if err := WriteTestWav(wavPath, 480); err != nil {
+		t.Fatal(err)
+	}
+	info, err := loader.Probe(wavPath)
+	if err != nil {
+		t.Fatalf("Probe failed: %v", err)
+	}
+	want := player.AudioInfo{Format: files.FormatWav, SampleRate: 48000, Channels: 2, BitsPerSample: 16}
+	if *info != want {
+		t.Errorf("Probe() = %+v, want %+v", *info, want)
+	}
+	if len(info.Mismatches()) != 0 {
+		t.Errorf("Expected no mismatches, got %v", info.Mismatches())
+	}
+
+	// A 44.1kHz mono 24bit WAV header; the audio itself isn't read
+	header := make([]byte, 36)
+	copy(header[0:], "RIFF")
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1)
+	binary.LittleEndian.PutUint16(header[22:], 1)
+	binary.LittleEndian.PutUint32(header[24:], 44100)
+	binary.LittleEndian.PutUint16(header[34:], 24)
+	mismatchPath := filepath.Join(dir, "mismatch.wav")
+	if err := os.WriteFile(mismatchPath, header, 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err = loader.Probe(mismatchPath)
+	if err != nil {
+		t.Fatalf("Probe failed: %v", err)
+	}
+	if info.SampleRate != 44100 || info.Channels != 1 || info.BitsPerSample != 24 {
+		t.Errorf("Unexpected probe of the mismatched file: %+v", *info)
+	}
+	if len(info.Mismatches()) != 3 {
+		t.Errorf("Expected sample rate, channel and bit depth mismatches, got %v", info.Mismatches())
+	}
+
+	// MPEG-1 Layer III, 128kbps, 44.1kHz, mono, after an empty ID3v2 tag
+	mp3Path := filepath.Join(dir, "frame.mp3")
+	mp3 := append([]byte("ID3\x03\x00\x00\x00\x00\x00\x00"), 0x00, 0xff, 0xfb, 0x90, 0xc0)
+	if err := os.WriteFile(mp3Path, mp3, 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err = loader.Probe(mp3Path)
+	if err != nil {
+		t.Fatalf("Probe failed: %v", err)
+	}
+	if info.SampleRate != 44100 || info.Channels != 1 {
+		t.Errorf("Unexpected probe of the MP3 frame: %+v", *info)
+	}
+
+	if _, err := loader.Probe(filepath.Join(dir, "missing.wav")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestZeroFadeOutAndInterval(t *testing.T) {
+	p, mockFactory := createTestMusicPlayer(t)
+	defer p.Close()
+
+	observer := &recordingObserver{}
+	p.AddObserver(observer)
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+	firstPlayer := mockFactory.GetLastPlayer()
+	p.SetLoopDurationMinutes(1.0 / 3600) // One frame
+	p.SetFadeOutDuration(0)
+	p.SetIntervalSeconds(0)
+	observer.events = nil
+
+	// The next track starts in the same Update the loop duration elapses
+	if err := p.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetState() != player.StatePlaying || p.GetCurrentIndex() != 1 {
+		t.Errorf("Expected track 1 playing after one Update, got %v at %d", p.GetState(), p.GetCurrentIndex())
+	}
+	if firstPlayer.IsPlaying() || !mockFactory.GetLastPlayer().IsPlaying() {
+		t.Error("Expected the first track stopped and the next one playing")
+	}
+	// Observers still see every stage
+	expected := []string{
+		"Playing->FadingOut",
+		"finished test1.wav", "FadingOut->Interval",
+		"changed test2.wav", "Interval->Playing",
+	}
+	if strings.Join(observer.events, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("Unexpected events:\n got %v\nwant %v", observer.events, expected)
+	}
+
+	// A zero fade-out with an interval goes straight to the interval, which still waits
+	p.SetIntervalSeconds(2.0 / 60) // Two frames
+	if err := p.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetState() != player.StateInterval || p.GetFadeProgress() != 0 {
+		t.Errorf("Expected the interval right after the loop duration, got %v", p.GetState())
+	}
+	for i := 0; i < 2; i++ {
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.GetState() != player.StatePlaying || p.GetCurrentIndex() != 0 {
+		t.Errorf("Expected track 0 playing after the interval, got %v at %d", p.GetState(), p.GetCurrentIndex())
+	}
+
+	// A fade-out with a zero interval skips only the interval
+	p.SetFadeOutDuration(50 * time.Millisecond) // Three frames
+	p.SetIntervalSeconds(0)
+	states := []player.PlayerState{}
+	for i := 0; i < 4; i++ {
+		if err := p.Update(); err != nil {
+			t.Fatal(err)
+		}
+		states = append(states, p.GetState())
+	}
+	want := []player.PlayerState{player.StateFadingOut, player.StateFadingOut, player.StateFadingOut, player.StatePlaying}
+	if !slices.Equal(states, want) {
+		t.Errorf("Expected states %v, got %v", want, states)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "title.wav")
+	bgm := filepath.Join(dir, "bgm", "stage1.wav")
+	sfx := filepath.Join(dir, "sfx", "jump.wav")
+	for _, path := range []string{root, bgm, sfx} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteTestWav(path, 4800); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := player.NewMusicPlayer([]string{root, bgm, sfx}, NewMockPlayerFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.SetMusicDirectories(files.MusicDirectory(dir))
+
+	if groups := p.GetGroups(); !reflect.DeepEqual(groups, []string{files.RootGroup, "bgm", "sfx"}) {
+		t.Fatalf("Expected the root group and each subdirectory, got %v", groups)
+	}
+
+	if err := p.SetGroup("bgm"); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.GetMusicFiles(); !reflect.DeepEqual(got, []string{bgm}) {
+		t.Errorf("Expected only the bgm files to be listed, got %v", got)
+	}
+
+	// The full list is remembered while filtered, and file changes are filtered too
+	extra := filepath.Join(dir, "bgm", "stage2.wav")
+	p.UpdateMusicFiles([]string{root, bgm, extra, sfx})
+	if got := p.GetMusicFiles(); !reflect.DeepEqual(got, []string{bgm, extra}) {
+		t.Errorf("Expected the new bgm file to be listed, got %v", got)
+	}
+
+	// Cycling goes through the remaining groups, then back to every file
+	for _, expected := range []string{"sfx", ""} {
+		if err := p.CycleGroup(); err != nil {
+			t.Fatal(err)
+		}
+		if p.GetGroup() != expected {
+			t.Errorf("Expected group %q after cycling, got %q", expected, p.GetGroup())
+		}
+	}
+	if got := len(p.GetMusicFiles()); got != 4 {
+		t.Errorf("Expected every file to be listed again, got %d", got)
+	}
+
+	if err := p.SetGroup("jingles"); err == nil {
+		t.Error("Expected an error for a group without files")
+	}
+
+	// A group whose files are all removed falls back to every file
+	if err := p.SetGroup("sfx"); err != nil {
+		t.Fatal(err)
+	}
+	p.UpdateMusicFiles([]string{root, bgm})
+	if p.GetGroup() != "" || len(p.GetMusicFiles()) != 2 {
+		t.Errorf("Expected every file to be listed once the group is empty, got group %q with %v", p.GetGroup(), p.GetMusicFiles())
+	}
+}
+
+// mp3FrameDecoder decodes the files of WriteTestMp3 to the silence of their frames at 48kHz,
+// as an MP3 decoder would
+type mp3FrameDecoder struct{}
+
+func (mp3FrameDecoder) Decode(src io.ReadSeeker, format files.Format, sampleRate int) (player.DecodedStream, error) {
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+	return rawStream{bytes.NewReader(make([]byte, len(data)/384*1152*4))}, nil
+}
+
+func TestLoadStream_Mp3Gapless(t *testing.T) {
+	dir := t.TempDir()
+	tagged := filepath.Join(dir, "tagged.mp3")
+	untagged := filepath.Join(dir, "untagged.mp3")
+	protected := filepath.Join(dir, "protected.mp3")
+	if err := WriteTestMp3(tagged, 20, 576, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteTestMp3(untagged, 20, -1, -1); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteTestMp3WithCRC(protected, 20, 576, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		samples int
+	}{
+		// The header frame, the encoder delay and the padding are trimmed
+		{"LAME header", tagged, 20*1152 - 576 - 1000},
+		{"No header", untagged, 20 * 1152},
+		// The Info header comes after the CRC
+		{"CRC-protected", protected, 20*1152 - 576 - 1000},
+	}
+
+	// The loader trims the stream whichever decoder decodes it
+	loader := player.NewMusicLoader()
+	loader.SetDecoder(mp3FrameDecoder{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := loader.LoadStream(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			length := stream.(interface{ Length() int64 }).Length()
+			if length != int64(tt.samples)*4 {
+				t.Errorf("Expected %d samples, got %d", tt.samples, length/4)
+			}
+
+			// Reading stops at the trimmed end
+			read, err := io.Copy(io.Discard, stream)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if read != length {
+				t.Errorf("Expected to read %d bytes, got %d", length, read)
+			}
+
+			duration, err := loader.GetDuration(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := time.Duration(tt.samples) * time.Second / 48000; duration != expected {
+				t.Errorf("Expected duration %v, got %v", expected, duration)
+			}
+		})
+	}
+}
+
+func TestPanAndForceMono(t *testing.T) {
+	// Left at 16000, right at -8000
+	pcm := make([]int16, 4800*2)
+	for i := range pcm {
+		pcm[i] = 16000
+		if i%2 == 1 {
+			pcm[i] = -8000
+		}
+	}
+	path := filepath.Join(t.TempDir(), "wide.wav")
+	if err := WriteTestWavPCM(path, pcm); err != nil {
+		t.Fatal(err)
+	}
+
+	mockFactory := NewMockPlayerFactory()
+	p, err := player.NewMusicPlayer([]string{path}, mockFactory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+
+	// readFrame reads two sample frames as the audio player would, split across reads, and returns the second
+	readFrame := func() (int16, int16) {
+		t.Helper()
+		buf := make([]byte, 8)
+		if _, err := io.ReadFull(mockFactory.GetLastStream(), buf[:3]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(mockFactory.GetLastStream(), buf[3:]); err != nil {
+			t.Fatal(err)
+		}
+		return int16(binary.LittleEndian.Uint16(buf[4:])), int16(binary.LittleEndian.Uint16(buf[6:]))
+	}
+
+	tests := []struct {
+		name          string
+		pan           float64
+		mono          bool
+		expectedPan   float64
+		expectedFrame [2]int16
+	}{
+		{"Unchanged", 0, false, 0, [2]int16{16000, -8000}},
+		{"Mono sum", 0, true, 0, [2]int16{4000, 4000}},
+		{"Half right", 0.5, false, 0.5, [2]int16{8000, -8000}},
+		{"Full left", -1, false, -1, [2]int16{16000, 0}},
+		{"Mono panned right", 0.25, true, 0.25, [2]int16{3000, 4000}},
+		{"Clamped", 3, false, 1, [2]int16{0, -8000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.SetPan(tt.pan)
+			p.SetForceMono(tt.mono)
+			if p.GetPan() != tt.expectedPan || p.IsForceMono() != tt.mono {
+				t.Errorf("Expected pan %v and mono %v, got %v and %v", tt.expectedPan, tt.mono, p.GetPan(), p.IsForceMono())
+			}
+			if left, right := readFrame(); left != tt.expectedFrame[0] || right != tt.expectedFrame[1] {
+				t.Errorf("Expected frame %v, got [%d %d]", tt.expectedFrame, left, right)
+			}
+		})
+	}
+}
+
+func TestMusicPlayer_SetEQ(t *testing.T) {
+	pcm := make([]int16, 9600) // 4800 stereo frames of DC
+	for i := range pcm {
+		pcm[i] = 4000
+	}
+	path := filepath.Join(t.TempDir(), "dc.wav")
+	if err := WriteTestWavPCM(path, pcm); err != nil {
+		t.Fatal(err)
+	}
+
+	mockFactory := NewMockPlayerFactory()
+	p, err := player.NewMusicPlayer([]string{path}, mockFactory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if !p.IsEQEnabled() {
+		t.Error("Expected the EQ to be enabled by default")
+	}
+	p.SetEQ(20, -6)
+	if low, high := p.GetEQ(); low != player.MaxEQGainDB || high != -6 {
+		t.Errorf("Expected gains of %v and -6 dB, got %v and %v", player.MaxEQGainDB, low, high)
+	}
+	p.SetEQEnabled(false)
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+
+	// readSample reads a chunk as the audio player would and returns its last left sample
+	readSample := func() int16 {
+		t.Helper()
+		buf := make([]byte, 4000)
+		if _, err := io.ReadFull(mockFactory.GetLastStream(), buf); err != nil {
+			t.Fatal(err)
+		}
+		return int16(binary.LittleEndian.Uint16(buf[len(buf)-4:]))
+	}
+	if got := readSample(); got != 4000 {
+		t.Errorf("Expected the bypassed EQ to leave the track unchanged, got %d", got)
+	}
+
+	// Enabling it while playing boosts the bass of the loaded track
+	p.SetEQEnabled(true)
+	readSample()
+	if got := readSample(); got <= 4000 {
+		t.Errorf("Expected the low shelf to boost the DC level, got %d", got)
+	}
+}
+
+func TestBackgroundLoading(t *testing.T) {
+	dir := t.TempDir()
+	paths := make([]string, 3)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("track%d.wav", i))
+		if err := WriteTestWav(paths[i], 4800); err != nil {
+			t.Fatal(err)
+		}
+	}
+	broken := filepath.Join(dir, "track3.wav")
+	if err := os.WriteFile(broken, []byte("not a wav file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mockFactory := NewMockPlayerFactory()
+	p, err := player.NewMusicPlayer(append(paths, broken), mockFactory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.SetBackgroundLoading(true)
+
+	var failed []string
+	p.SetOnLoadError(func(path string, err error) {
+		failed = append(failed, path)
+	})
+
+	// waitForLoad updates the player until the load in the background has finished
+	waitForLoad := func() {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for p.GetState() == player.StateLoading {
+			if time.Now().After(deadline) {
+				t.Fatal("Track did not finish loading")
+			}
+			time.Sleep(time.Millisecond)
+			if err := p.Update(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// A second request supersedes the one in flight, whose track is never started
+	if err := p.SetCurrentIndex(1); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetState() != player.StateLoading {
+		t.Errorf("Expected the Loading state while decoding, got %v", p.GetState())
+	}
+	if err := p.SetCurrentIndex(2); err != nil {
+		t.Fatal(err)
+	}
+	waitForLoad()
+	if p.GetState() != player.StatePlaying || p.GetCurrentPath() != paths[2] {
+		t.Errorf("Expected %s to play, got %v with %s", paths[2], p.GetState(), p.GetCurrentPath())
+	}
+	if len(mockFactory.audioPlayers) != 1 || !mockFactory.GetLastPlayer().IsPlaying() {
+		t.Errorf("Expected a single playing player for the latest request, got %d", len(mockFactory.audioPlayers))
+	}
+
+	// Errors are reported through the callback rather than returned
+	if err := p.SetCurrentIndex(3); err != nil {
+		t.Fatalf("Expected no error until the track is decoded, got %v", err)
+	}
+	waitForLoad()
+	if p.GetState() != player.StateStopped || p.GetLastError() == nil {
+		t.Errorf("Expected playback to stop with an error, got %v and %v", p.GetState(), p.GetLastError())
+	}
+	if !reflect.DeepEqual(failed, []string{broken}) {
+		t.Errorf("Expected the load error callback for %s, got %v", broken, failed)
+	}
+
+	// Closing while a track loads waits for the decoding to end
+	if err := p.SetCurrentIndex(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GetState() != player.StateStopped {
+		t.Errorf("Expected the Stopped state after closing, got %v", p.GetState())
+	}
+}
@@ -0,0 +1,270 @@
+package player
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"musicplayer/internal/aiff"
+	"musicplayer/internal/files"
+	"musicplayer/internal/flac"
+)
+
+// --- Probe ---
+
+// AudioInfo is the native sample format of an audio file, before it is converted for playback.
+type AudioInfo struct {
+	Format        files.Format
+	SampleRate    int
+	Channels      int
+	BitsPerSample int // 0 for compressed formats, which have no fixed bit depth
+}
+
+// String returns a short description such as "WAV 44100 Hz stereo 24-bit"
+func (i *AudioInfo) String() string {
+	channels := fmt.Sprintf("%d channels", i.Channels)
+	switch i.Channels {
+	case 1:
+		channels = "mono"
+	case 2:
+		channels = "stereo"
+	}
+	s := fmt.Sprintf("%s %d Hz %s", i.Format, i.SampleRate, channels)
+	if i.BitsPerSample > 0 {
+		s += fmt.Sprintf(" %d-bit", i.BitsPerSample)
+	}
+	return s
+}
+
+// Mismatches describes how the file differs from the default playback format, 16bit stereo at
+// DefaultSampleRate, i.e. what is converted when it is played. It is empty when the file already matches.
+func (i *AudioInfo) Mismatches() []string {
+	return i.MismatchesAt(DefaultSampleRate)
+}
+
+// MismatchesAt is Mismatches for playback at the sample rate.
+func (i *AudioInfo) MismatchesAt(rate int) []string {
+	var mismatches []string
+	if i.SampleRate != rate {
+		mismatches = append(mismatches, fmt.Sprintf("%d Hz is resampled to %d Hz", i.SampleRate, rate))
+	}
+	switch {
+	case i.Channels == 1:
+		mismatches = append(mismatches, "mono is played on both channels")
+	case i.Channels > 2:
+		mismatches = append(mismatches, fmt.Sprintf("%d channels are not supported", i.Channels))
+	}
+	if i.BitsPerSample > 16 {
+		mismatches = append(mismatches, fmt.Sprintf("%d-bit samples are reduced to 16-bit", i.BitsPerSample))
+	}
+	return mismatches
+}
+
+// Probe reads the native sample rate, channel count and bit depth of the audio file from its
+// headers, without decoding the audio.
+func (l *MusicLoader) Probe(filePath string) (*AudioInfo, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("loader: failed to open audio file %s: %v", filePath, err)
+	}
+	defer f.Close()
+
+	format := detectFormat(filePath)
+	info := &AudioInfo{Format: format}
+	r := bufio.NewReader(f)
+
+	switch format {
+	case files.FormatWav:
+		err = probeWav(r, info)
+	case files.FormatOgg, files.FormatOpus:
+		err = probeOgg(r, info)
+	case files.FormatMp3:
+		err = probeMp3(r, info)
+	case files.FormatFlac:
+		var fi *flac.Info
+		if fi, err = flac.ReadInfo(r); err == nil {
+			info.SampleRate, info.Channels, info.BitsPerSample = fi.SampleRate, fi.Channels, fi.BitsPerSample
+		}
+	case files.FormatAiff:
+		var ai *aiff.Info
+		if ai, err = aiff.ReadInfo(r); err == nil {
+			info.SampleRate, info.Channels, info.BitsPerSample = ai.SampleRate, ai.Channels, ai.BitsPerSample
+		}
+	default:
+		return nil, fmt.Errorf("loader: unsupported audio format: %s", filePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loader: failed to probe audio %s: %v", filePath, err)
+	}
+	return info, nil
+}
+
+// probeWav reads the fmt chunk of a RIFF WAVE file
+func probeWav(r io.Reader, info *AudioInfo) error {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("failed to read RIFF header: %v", err)
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return fmt.Errorf("invalid RIFF header")
+	}
+
+	chunkHeader := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunkHeader); err != nil {
+			return fmt.Errorf("missing fmt chunk: %v", err)
+		}
+		size := int64(binary.LittleEndian.Uint32(chunkHeader[4:8]))
+		if string(chunkHeader[0:4]) != "fmt " {
+			// Chunks are padded to an even size
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return fmt.Errorf("failed to skip chunk: %v", err)
+			}
+			continue
+		}
+		if size < 16 {
+			return fmt.Errorf("fmt chunk too short")
+		}
+		chunk := make([]byte, 16)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return fmt.Errorf("failed to read fmt chunk: %v", err)
+		}
+		info.Channels = int(binary.LittleEndian.Uint16(chunk[2:4]))
+		info.SampleRate = int(binary.LittleEndian.Uint32(chunk[4:8]))
+		info.BitsPerSample = int(binary.LittleEndian.Uint16(chunk[14:16]))
+		return nil
+	}
+}
+
+// probeOgg reads the identification header, the first packet of an Ogg Vorbis or Opus stream
+func probeOgg(r io.Reader, info *AudioInfo) error {
+	header := make([]byte, 27)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("failed to read Ogg page: %v", err)
+	}
+	if string(header[:4]) != "OggS" {
+		return fmt.Errorf("invalid Ogg page")
+	}
+	segments := make([]byte, header[26])
+	if _, err := io.ReadFull(r, segments); err != nil {
+		return fmt.Errorf("failed to read Ogg page: %v", err)
+	}
+	// The identification header always fits in the first page
+	var size int
+	for _, s := range segments {
+		size += int(s)
+		if s < 255 {
+			break
+		}
+	}
+	packet := make([]byte, size)
+	if _, err := io.ReadFull(r, packet); err != nil {
+		return fmt.Errorf("failed to read Ogg page: %v", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")) && len(packet) >= 16:
+		// Version (4 bytes), channels (1 byte), sample rate (4 bytes)
+		info.Format = files.FormatOgg
+		info.Channels = int(packet[11])
+		info.SampleRate = int(binary.LittleEndian.Uint32(packet[12:16]))
+	case bytes.HasPrefix(packet, []byte("OpusHead")) && len(packet) >= 10:
+		// Opus always decodes at 48kHz; the rate of the original input is informational only
+		info.Format = files.FormatOpus
+		info.Channels = int(packet[9])
+		info.SampleRate = 48000
+	default:
+		return fmt.Errorf("unknown Ogg codec")
+	}
+	return nil
+}
+
+// mp3SampleRates are the sample rates of MPEG-1 audio; MPEG-2 halves them and MPEG-2.5 quarters them
+var mp3SampleRates = [3]int{44100, 48000, 32000}
+
+// mp3SyncSearchLimit is how far past the tags the first frame header is searched for
+const mp3SyncSearchLimit = 64 * 1024
+
+// probeMp3 reads the header of the first MPEG audio frame, after any ID3v2 tag
+func probeMp3(r *bufio.Reader, info *AudioInfo) error {
+	if err := skipID3v2(r); err != nil {
+		return err
+	}
+	header, err := findMp3FrameHeader(r)
+	if err != nil {
+		return err
+	}
+
+	info.SampleRate = mp3SampleRates[header[2]>>2&0x3]
+	switch header[1] >> 3 & 0x3 {
+	case 2: // MPEG-2
+		info.SampleRate /= 2
+	case 0: // MPEG-2.5
+		info.SampleRate /= 4
+	}
+	info.Channels = 2
+	if header[3]>>6 == 3 {
+		info.Channels = 1
+	}
+	return nil
+}
+
+// skipID3v2 skips the ID3v2 tag at the start of an MP3 file, if there is one
+func skipID3v2(r *bufio.Reader) error {
+	header, err := r.Peek(10)
+	if err != nil || string(header[:3]) != "ID3" {
+		return nil
+	}
+	size := int64(syncsafe(header[6:10])) + 10
+	if header[5]&0x10 != 0 {
+		size += 10 // Footer
+	}
+	if _, err := io.CopyN(io.Discard, r, size); err != nil {
+		return fmt.Errorf("failed to skip ID3 tag: %v", err)
+	}
+	return nil
+}
+
+// findMp3FrameHeader skips to the first MPEG audio frame and returns its 4-byte header without consuming it
+func findMp3FrameHeader(r *bufio.Reader) ([]byte, error) {
+	for skipped := 0; skipped < mp3SyncSearchLimit; skipped++ {
+		header, err := r.Peek(4)
+		if err != nil {
+			return nil, fmt.Errorf("no MPEG audio frame found: %v", err)
+		}
+		version := header[1] >> 3 & 0x3
+		layer := header[1] >> 1 & 0x3
+		bitrate := header[2] >> 4
+		rate := header[2] >> 2 & 0x3
+		if header[0] == 0xff && header[1]&0xe0 == 0xe0 && version != 1 && layer != 0 && bitrate != 0xf && rate != 3 {
+			return header, nil
+		}
+		if _, err := r.Discard(1); err != nil {
+			return nil, fmt.Errorf("no MPEG audio frame found: %v", err)
+		}
+	}
+	return nil, fmt.Errorf("no MPEG audio frame found")
+}
+
+// GetAudioInfo returns the native sample format of the music file; see MusicLoader.Probe
+func (p *MusicPlayer) GetAudioInfo(path string) (*AudioInfo, error) {
+	return p.loader.Probe(path)
+}
+
+// FormatWarning returns a warning describing how the music file is converted for playback,
+// or an empty string if it already matches the playback format or can't be probed.
+func (p *MusicPlayer) FormatWarning(path string) string {
+	info, err := p.loader.Probe(path)
+	if err != nil {
+		return ""
+	}
+	mismatches := info.MismatchesAt(p.SampleRate())
+	if len(mismatches) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s: %s", info, strings.Join(mismatches, ", "))
+}
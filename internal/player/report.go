@@ -0,0 +1,217 @@
+package player
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// --- Review report ---
+
+// ReportFormat is the file format of a review report
+type ReportFormat int
+
+const (
+	ReportCSV ReportFormat = iota
+	ReportJSON
+)
+
+// String returns the name of the report format
+func (f ReportFormat) String() string {
+	switch f {
+	case ReportCSV:
+		return "CSV"
+	case ReportJSON:
+		return "JSON"
+	default:
+		return "Unknown"
+	}
+}
+
+// Extension returns the file extension of the report format, including the dot
+func (f ReportFormat) Extension() string {
+	switch f {
+	case ReportJSON:
+		return ".json"
+	default:
+		return ".csv"
+	}
+}
+
+// ReportEntry is the review result of one track
+type ReportEntry struct {
+	Path            string  `json:"path"` // Relative to the music directory
+	DurationSeconds float64 `json:"durationSeconds"`
+	Favorite        bool    `json:"favorite"`
+	Note            string  `json:"note,omitempty"`
+	Peak            float64 `json:"peak"`            // Peak level of the whole track (0.0-1.0)
+	Clipped         bool    `json:"clipped"`         // Whether the track reaches full scale anywhere
+	Error           string  `json:"error,omitempty"` // Why the duration or peak couldn't be read
+}
+
+// Report returns the review results of the tracks in list order.
+// Every track is decoded to find its peak level, unless its waveform is cached, so this takes
+// a while for a large library; see ExportReportFileInBackground.
+func (p *MusicPlayer) Report() []ReportEntry {
+	entries, _ := p.loader.measureReport(context.Background(), p.reportEntries())
+	return p.relativeReport(entries)
+}
+
+// reportEntries returns the entries of the tracks in list order without the measurements.
+// Favorites and notes are read here, so it is called on the goroutine calling Update.
+func (p *MusicPlayer) reportEntries() []ReportEntry {
+	musicFiles := p.GetMusicFiles()
+	entries := make([]ReportEntry, 0, len(musicFiles))
+	for _, path := range musicFiles {
+		entries = append(entries, ReportEntry{
+			Path:     path,
+			Favorite: p.IsFavorite(path),
+			Note:     p.GetNote(path),
+		})
+	}
+	return entries
+}
+
+// measureReport fills in the duration and peak of the entries, whose paths are the full paths of the tracks.
+// Cached durations and peaks are used, so tracks the UI has shown aren't decoded again.
+func (l *MusicLoader) measureReport(ctx context.Context, entries []ReportEntry) ([]ReportEntry, error) {
+	for i := range entries {
+		entry := &entries[i]
+		path := entry.Path
+		if duration, err := l.GetDurationContext(ctx, path); err != nil {
+			entry.Error = err.Error()
+		} else {
+			entry.DurationSeconds = duration.Seconds()
+		}
+		if peak, err := l.ComputePeak(ctx, path); err != nil {
+			if entry.Error == "" {
+				entry.Error = err.Error()
+			}
+		} else {
+			entry.Peak = float64(peak)
+			entry.Clipped = entry.Peak >= clipLevel
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// ExportReport writes the review results of the tracks to w: each track's relative path,
+// duration, favorite flag, note, peak level and whether it clips.
+func (p *MusicPlayer) ExportReport(w io.Writer, format ReportFormat) error {
+	return writeReport(w, format, p.Report())
+}
+
+// relativeReport returns the entries with their paths relative to the music directory
+func (p *MusicPlayer) relativeReport(entries []ReportEntry) []ReportEntry {
+	for i := range entries {
+		entries[i].Path = p.noteKey(entries[i].Path)
+	}
+	return entries
+}
+
+// writeReport writes the entries to w in the format
+func writeReport(w io.Writer, format ReportFormat, entries []ReportEntry) error {
+	switch format {
+	case ReportCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"path", "duration_seconds", "favorite", "note", "peak", "clipped", "error"}); err != nil {
+			return fmt.Errorf("failed to write report: %v", err)
+		}
+		for _, entry := range entries {
+			record := []string{
+				entry.Path,
+				strconv.FormatFloat(entry.DurationSeconds, 'f', 3, 64),
+				strconv.FormatBool(entry.Favorite),
+				entry.Note,
+				strconv.FormatFloat(entry.Peak, 'f', 3, 64),
+				strconv.FormatBool(entry.Clipped),
+				entry.Error,
+			}
+			if err := cw.Write(record); err != nil {
+				return fmt.Errorf("failed to write report: %v", err)
+			}
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return fmt.Errorf("failed to write report: %v", err)
+		}
+		return nil
+	case ReportJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(entries); err != nil {
+			return fmt.Errorf("failed to write report: %v", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown report format: %d", format)
+	}
+}
+
+// ExportReportFile writes the review report to a new file in dir, named after the time,
+// and returns its path.
+func (p *MusicPlayer) ExportReportFile(dir string, format ReportFormat, now time.Time) (string, error) {
+	return writeReportFile(dir, format, now, p.Report())
+}
+
+// ReportExportResult is the outcome of a report written in the background
+type ReportExportResult struct {
+	Path string // Path of the report file; empty on failure
+	Err  error
+}
+
+// ExportReportFileInBackground is ExportReportFile, decoding the tracks on a background goroutine
+// so a large library doesn't stall the caller. The track list, favorites and notes are taken when
+// it is called, so call it from the goroutine calling Update.
+// The result is sent on the returned channel, which is then closed. Once ctx is done decoding
+// stops and no file is written.
+func (p *MusicPlayer) ExportReportFileInBackground(ctx context.Context, dir string, format ReportFormat, now time.Time) <-chan ReportExportResult {
+	entries := p.reportEntries()
+	keys := make([]string, len(entries))
+	for i, entry := range entries {
+		keys[i] = p.noteKey(entry.Path)
+	}
+
+	result := make(chan ReportExportResult, 1)
+	go func() {
+		defer close(result)
+		entries, err := p.loader.measureReport(ctx, entries)
+		if err != nil {
+			result <- ReportExportResult{Err: fmt.Errorf("report export was cancelled: %v", err)}
+			return
+		}
+		for i := range entries {
+			entries[i].Path = keys[i]
+		}
+		path, err := writeReportFile(dir, format, now, entries)
+		result <- ReportExportResult{Path: path, Err: err}
+	}()
+	return result
+}
+
+// writeReportFile writes the entries to a new file in dir, named after the time, and returns its path
+func writeReportFile(dir string, format ReportFormat, now time.Time, entries []ReportEntry) (string, error) {
+	path := filepath.Join(dir, "review-report-"+now.Format("20060102-150405")+format.Extension())
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create report: %v", err)
+	}
+	if err := writeReport(f, format, entries); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("failed to write report: %v", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,283 @@
+package player
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"musicplayer/internal/files"
+)
+
+// --- Settings ---
+
+// settingsFileName is the name of the settings file in the config directory
+const settingsFileName = "settings.json"
+
+// Settings holds the user-adjustable player settings that persist across restarts.
+type Settings struct {
+	LoopDurationMinutes float64           `json:"loopDurationMinutes"`
+	IntervalSeconds     float64           `json:"intervalSeconds"`
+	Volume              float64           `json:"volume"`
+	RepeatMode          RepeatMode        `json:"repeatMode"`
+	Shuffle             bool              `json:"shuffle"`
+	AutoAdvance         bool              `json:"autoAdvance"` // Whether a finished track is followed by the next
+	PauseOnFocusLoss    bool              `json:"pauseOnFocusLoss"`
+	Favorites           []string          `json:"favorites,omitempty"` // Favorite tracks by path relative to the music directory
+	Notes               map[string]string `json:"notes,omitempty"`     // Notes keyed by path relative to the music directory
+	LastTrack           string            `json:"lastTrack,omitempty"` // Path of the selected track relative to the music directory
+	UI                  UISettings        `json:"ui"`
+}
+
+// UISettings holds the settings of the UI layout. They are saved along with the player settings,
+// but the player neither sets nor uses them: Settings leaves them zero and ApplySettings ignores them.
+type UISettings struct {
+	MiniMode bool `json:"miniMode"` // Whether the window shows the compact transport bar
+}
+
+// Equal reports whether both settings hold the same values.
+func (s Settings) Equal(other Settings) bool {
+	return s.LoopDurationMinutes == other.LoopDurationMinutes &&
+		s.IntervalSeconds == other.IntervalSeconds &&
+		s.Volume == other.Volume &&
+		s.RepeatMode == other.RepeatMode &&
+		s.Shuffle == other.Shuffle &&
+		s.AutoAdvance == other.AutoAdvance &&
+		s.PauseOnFocusLoss == other.PauseOnFocusLoss &&
+		slices.Equal(s.Favorites, other.Favorites) &&
+		maps.Equal(s.Notes, other.Notes) &&
+		s.LastTrack == other.LastTrack &&
+		s.UI == other.UI
+}
+
+// DefaultSettings returns the settings of a new MusicPlayer.
+func DefaultSettings() Settings {
+	return Settings{
+		LoopDurationMinutes: 5.0,
+		IntervalSeconds:     10.0,
+		Volume:              1.0,
+		RepeatMode:          RepeatAll,
+		Shuffle:             false,
+		AutoAdvance:         true,
+		PauseOnFocusLoss:    false,
+	}
+}
+
+// DefaultSettingsPath returns the settings file path in the user's config directory.
+func DefaultSettingsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find config directory: %v", err)
+	}
+	return filepath.Join(dir, "musicassettester", settingsFileName), nil
+}
+
+// LoadSettings reads settings from a JSON file.
+//
+// A missing file is not an error and yields the defaults. A malformed file yields the
+// defaults along with the error. Missing or out of range fields fall back to their defaults.
+func LoadSettings(path string) (Settings, error) {
+	settings := DefaultSettings()
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, fmt.Errorf("failed to read settings: %v", err)
+	}
+
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return DefaultSettings(), fmt.Errorf("failed to parse settings %s: %v", path, err)
+	}
+
+	return settings.sanitized(), nil
+}
+
+// SaveSettings writes settings to a JSON file, creating its directory if necessary.
+func SaveSettings(path string, settings Settings) error {
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode settings: %v", err)
+	}
+
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write settings: %v", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to path, creating its directory if necessary.
+// The data goes to a temporary file in the same directory first, synced to disk before it replaces
+// the file, so a crash never leaves a truncated file and concurrent writers don't share a temporary
+// file. A replaced file keeps its permissions.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// --- Custom Order ---
+
+// customOrderFileName is the name of the custom list order file, kept beside the settings file
+const customOrderFileName = "order.json"
+
+// CustomOrderPath returns the custom list order file path for the given settings file path.
+func CustomOrderPath(settingsPath string) string {
+	return filepath.Join(filepath.Dir(settingsPath), customOrderFileName)
+}
+
+// LoadCustomOrder reads the custom list order from a JSON file.
+// A missing file is not an error and yields nil, meaning the sort mode applies.
+func LoadCustomOrder(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read custom order: %v", err)
+	}
+
+	var order []string
+	if err := json.Unmarshal(data, &order); err != nil {
+		return nil, fmt.Errorf("failed to parse custom order %s: %v", path, err)
+	}
+	return order, nil
+}
+
+// SaveCustomOrder writes the custom list order to a JSON file.
+// A nil order removes the file, so the sort mode applies on the next start.
+func SaveCustomOrder(path string, order []string) error {
+	if order == nil {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove custom order: %v", err)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(order, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode custom order: %v", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write custom order: %v", err)
+	}
+	return nil
+}
+
+// sanitized replaces values that are out of range with their defaults.
+func (s Settings) sanitized() Settings {
+	defaults := DefaultSettings()
+	if s.LoopDurationMinutes <= 0 {
+		s.LoopDurationMinutes = defaults.LoopDurationMinutes
+	}
+	if s.IntervalSeconds < 0 {
+		s.IntervalSeconds = defaults.IntervalSeconds
+	}
+	if s.Volume < 0 || s.Volume > 1 {
+		s.Volume = defaults.Volume
+	}
+	if s.RepeatMode < RepeatAll || s.RepeatMode > RepeatOff {
+		s.RepeatMode = defaults.RepeatMode
+	}
+	return s
+}
+
+// Settings returns the current persistent settings of the player, without the UI settings.
+// While muted, the volume from before muting is returned.
+func (p *MusicPlayer) Settings() Settings {
+	volume := p.masterVolume
+	if p.muted {
+		volume = p.unmutedVolume
+	}
+	return Settings{
+		LoopDurationMinutes: p.loopDuration,
+		IntervalSeconds:     p.intervalDuration,
+		Volume:              volume,
+		RepeatMode:          p.repeatMode,
+		Shuffle:             p.selector.IsShuffle(),
+		AutoAdvance:         p.autoAdvance,
+		PauseOnFocusLoss:    p.pauseOnFocusLoss,
+		Favorites:           p.GetFavorites(),
+		Notes:               p.getNotes(),
+		LastTrack:           p.lastTrack(),
+	}
+}
+
+// ApplySettings applies persistent settings to the player.
+func (p *MusicPlayer) ApplySettings(settings Settings) {
+	p.SetLoopDurationMinutes(settings.LoopDurationMinutes)
+	p.SetIntervalSeconds(settings.IntervalSeconds)
+	p.SetMasterVolume(settings.Volume)
+	p.SetRepeatMode(settings.RepeatMode)
+	if p.selector.IsShuffle() != settings.Shuffle {
+		p.SetShuffleEnabled(settings.Shuffle)
+	}
+	p.SetAutoAdvance(settings.AutoAdvance)
+	p.SetPauseOnFocusLoss(settings.PauseOnFocusLoss)
+	p.setFavorites(settings.Favorites)
+	p.setNotes(settings.Notes)
+	p.selectLastTrack(settings.LastTrack)
+}
+
+// lastTrack returns the path of the selected track relative to the music directory,
+// or an empty string if there is none
+func (p *MusicPlayer) lastTrack() string {
+	path, ok := p.selector.CurrentFile()
+	if !ok {
+		return ""
+	}
+	return files.RelativeToMusicDir(path, p.musicDirs...)
+}
+
+// selectLastTrack selects the track remembered from the last session without playing it.
+// Nothing changes if a track is already loaded or the remembered one is gone,
+// so the first track stays selected.
+func (p *MusicPlayer) selectLastTrack(relPath string) {
+	if relPath == "" || p.currentMusic != nil {
+		return
+	}
+	for i, path := range p.selector.Files() {
+		if files.RelativeToMusicDir(path, p.musicDirs...) == relPath {
+			p.selector.SelectIndex(i)
+			return
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package player_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"musicplayer/internal/player"
+)
+
+func TestSettings_SaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config", "settings.json")
+
+	want := player.Settings{
+		LoopDurationMinutes: 12.5,
+		IntervalSeconds:     3,
+		Volume:              0.4,
+		RepeatMode:          player.RepeatOne,
+		Shuffle:             true,
+		AutoAdvance:         false,
+		PauseOnFocusLoss:    true,
+		Favorites:           []string{"/music/a.wav", "/music/b.wav"},
+		LastTrack:           "sub/b.wav",
+		UI:                  player.UISettings{MiniMode: true},
+	}
+	if err := player.SaveSettings(path, want); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+
+	got, err := player.LoadSettings(path)
+	if err != nil {
+		t.Fatalf("LoadSettings failed: %v", err)
+	}
+	if !got.Equal(want) {
+		t.Errorf("LoadSettings() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCustomOrder_SaveAndLoad(t *testing.T) {
+	path := player.CustomOrderPath(filepath.Join(t.TempDir(), "config", "settings.json"))
+
+	// Missing file means no custom order
+	order, err := player.LoadCustomOrder(path)
+	if err != nil || order != nil {
+		t.Fatalf("LoadCustomOrder() = %v, %v, want nil, nil", order, err)
+	}
+
+	want := []string{"/music/b.wav", "/music/a.wav"}
+	if err := player.SaveCustomOrder(path, want); err != nil {
+		t.Fatalf("SaveCustomOrder failed: %v", err)
+	}
+	order, err = player.LoadCustomOrder(path)
+	if err != nil {
+		t.Fatalf("LoadCustomOrder failed: %v", err)
+	}
+	if !slices.Equal(order, want) {
+		t.Errorf("LoadCustomOrder() = %v, want %v", order, want)
+	}
+
+	// Saving nil removes the file
+	if err := player.SaveCustomOrder(path, nil); err != nil {
+		t.Fatalf("SaveCustomOrder(nil) failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the order file removed, got %v", err)
+	}
+}
+
+func TestSettings_LoadFallback(t *testing.T) {
+	tempDir := t.TempDir()
+
+	tests := []struct {
+		name      string
+		content   string // Empty means the file doesn't exist
+		expectErr bool
+		expected  player.Settings
+	}{
+		{"Missing file", "", false, player.DefaultSettings()},
+		{"Malformed file", "{not json", true, player.DefaultSettings()},
+		{
+			"Partial file",
+			`{"intervalSeconds": 30}`,
+			false,
+			player.Settings{LoopDurationMinutes: 5, IntervalSeconds: 30, Volume: 1, RepeatMode: player.RepeatAll, AutoAdvance: true},
+		},
+		{
+			"Out of range values",
+			`{"loopDurationMinutes": -1, "volume": 3, "repeatMode": 9, "shuffle": true}`,
+			false,
+			player.Settings{LoopDurationMinutes: 5, IntervalSeconds: 10, Volume: 1, RepeatMode: player.RepeatAll, Shuffle: true, AutoAdvance: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tempDir, "missing.json")
+			if tt.content != "" {
+				path = filepath.Join(tempDir, tt.name+".json")
+				if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := player.LoadSettings(path)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("LoadSettings() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if !got.Equal(tt.expected) {
+				t.Errorf("LoadSettings() = %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMusicPlayer_ApplySettings(t *testing.T) {
+	p, _ := createTestMusicPlayer(t)
+	defer p.Close()
+
+	musicFiles := p.GetMusicFiles()
+	defaults := player.DefaultSettings()
+	defaults.LastTrack = filepath.ToSlash(musicFiles[0])
+	if !p.Settings().Equal(defaults) {
+		t.Errorf("Expected default settings with the first track on a new player, got %+v", p.Settings())
+	}
+
+	want := player.Settings{
+		LoopDurationMinutes: 2,
+		IntervalSeconds:     20,
+		Volume:              0.5,
+		RepeatMode:          player.RepeatOff,
+		Shuffle:             true,
+		AutoAdvance:         false,
+		PauseOnFocusLoss:    true,
+		LastTrack:           filepath.ToSlash(musicFiles[1]),
+	}
+	p.ApplySettings(want)
+	if !p.Settings().Equal(want) {
+		t.Errorf("Settings() = %+v, want %+v", p.Settings(), want)
+	}
+
+	// The UI settings are left to the UI
+	withUI := want
+	withUI.UI.MiniMode = true
+	p.ApplySettings(withUI)
+	if !p.Settings().Equal(want) {
+		t.Errorf("Expected ApplySettings to ignore the UI settings, got %+v", p.Settings())
+	}
+	if !p.IsShuffleEnabled() || p.GetMasterVolume() != 0.5 {
+		t.Error("Expected ApplySettings to update shuffle and volume")
+	}
+}
@@ -0,0 +1,156 @@
+package player
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"sync"
+)
+
+// --- Stereo field ---
+
+// frameReader reads whole 16bit stereo frames from a stream for processing before they are played
+type frameReader struct {
+	src io.ReadSeeker
+
+	buf     []byte
+	pending []byte // Processed bytes not read yet
+	err     error  // Error of the read that filled pending, returned once it is read
+}
+
+// read reads whole sample frames from the stream, passes them to process to be changed in place
+// and returns them
+func (f *frameReader) read(b []byte, process func(data []byte)) (int, error) {
+	if len(f.pending) == 0 && f.err != nil {
+		err := f.err
+		f.err = nil
+		return 0, err
+	}
+	if len(f.pending) == 0 {
+		// Frames must not be split between reads to be processed, so reads smaller than a frame are buffered
+		size := max(len(b)/bytesPerSample*bytesPerSample, bytesPerSample)
+		if cap(f.buf) < size {
+			f.buf = make([]byte, size)
+		}
+		n, err := io.ReadFull(f.src, f.buf[:size])
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		if n == 0 {
+			return 0, err
+		}
+		process(f.buf[:n])
+		f.pending, f.err = f.buf[:n], err
+	}
+	n := copy(b, f.pending)
+	f.pending = f.pending[n:]
+	return n, nil
+}
+
+// seek seeks the stream, dropping processed frames that weren't read yet
+func (f *frameReader) seek(offset int64, whence int) (int64, error) {
+	f.pending, f.err = nil, nil
+	return f.src.Seek(offset, whence)
+}
+
+// stereoMixer passes a 16bit stereo stream through, folding it to mono and panning it.
+// The audio player reads from its own goroutine, so the settings are guarded by a mutex.
+// Settings take effect from the next read of the stream.
+type stereoMixer struct {
+	frames frameReader
+
+	mu   sync.Mutex
+	pan  float64 // Balance from -1 (left only) to 1 (right only)
+	mono bool    // Whether both channels carry the average of the two
+}
+
+// newStereoMixer wraps a stream for panning and folding to mono
+func newStereoMixer(src io.ReadSeeker) *stereoMixer {
+	return &stereoMixer{frames: frameReader{src: src}}
+}
+
+// SetPan sets the balance from -1 (left only) through 0 (unchanged) to 1 (right only)
+func (s *stereoMixer) SetPan(pan float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pan = pan
+}
+
+// SetMono sets whether both channels carry the average of the two
+func (s *stereoMixer) SetMono(mono bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mono = mono
+}
+
+// Read reads whole sample frames from the stream, mixes them and returns them
+func (s *stereoMixer) Read(b []byte) (int, error) {
+	return s.frames.read(b, s.mix)
+}
+
+// Seek seeks the stream, dropping mixed frames that weren't read yet
+func (s *stereoMixer) Seek(offset int64, whence int) (int64, error) {
+	return s.frames.seek(offset, whence)
+}
+
+// mix applies the settings to little-endian 16bit stereo frames in place
+func (s *stereoMixer) mix(data []byte) {
+	s.mu.Lock()
+	pan, mono := s.pan, s.mono
+	s.mu.Unlock()
+	if pan == 0 && !mono {
+		return
+	}
+
+	// Panning turns down the opposite channel, keeping the panned-to channel at full level
+	leftGain, rightGain := 1.0, 1.0
+	if pan > 0 {
+		leftGain = 1 - pan
+	} else if pan < 0 {
+		rightGain = 1 + pan
+	}
+
+	for i := 0; i+bytesPerSample <= len(data); i += bytesPerSample {
+		left := float64(int16(binary.LittleEndian.Uint16(data[i:])))
+		right := float64(int16(binary.LittleEndian.Uint16(data[i+2:])))
+		if mono {
+			left = (left + right) / 2
+			right = left
+		}
+		binary.LittleEndian.PutUint16(data[i:], uint16(int16(math.Round(left*leftGain))))
+		binary.LittleEndian.PutUint16(data[i+2:], uint16(int16(math.Round(right*rightGain))))
+	}
+}
+
+// SetPan sets the balance of playback from -1 (left only) through 0 (centered) to 1 (right only),
+// to check how wide a track is. It is clamped to that range.
+func (p *MusicPlayer) SetPan(pan float64) {
+	p.pan = max(-1, min(pan, 1))
+	p.applyStereo()
+}
+
+// GetPan returns the balance of playback from -1 (left only) to 1 (right only)
+func (p *MusicPlayer) GetPan() float64 {
+	return p.pan
+}
+
+// SetForceMono sets whether playback is folded to mono, to check the track collapses well
+func (p *MusicPlayer) SetForceMono(mono bool) {
+	p.forceMono = mono
+	p.applyStereo()
+}
+
+// IsForceMono returns whether playback is folded to mono
+func (p *MusicPlayer) IsForceMono() bool {
+	return p.forceMono
+}
+
+// applyStereo applies the pan and mono settings to the loaded tracks
+func (p *MusicPlayer) applyStereo() {
+	for _, music := range []*Music{p.currentMusic, p.nextMusic, p.testTone} {
+		if music != nil && music.mixer != nil {
+			music.mixer.SetPan(p.pan)
+			music.mixer.SetMono(p.forceMono)
+		}
+	}
+}
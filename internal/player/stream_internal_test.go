@@ -0,0 +1,228 @@
+package player
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// closeTracker is a stream that records whether it was closed
+type closeTracker struct {
+	io.ReadSeeker
+	closed bool
+}
+
+func (c *closeTracker) Close() error {
+	c.closed = true
+	return nil
+}
+
+// silentPlayer is a Player that plays nothing
+type silentPlayer struct{}
+
+func (*silentPlayer) Play()                           {}
+func (*silentPlayer) Pause()                          {}
+func (*silentPlayer) Close() error                    { return nil }
+func (*silentPlayer) SetVolume(float64)               {}
+func (*silentPlayer) Current() time.Duration          { return 0 }
+func (*silentPlayer) SetPosition(time.Duration) error { return nil }
+func (*silentPlayer) Rewind() error                   { return nil }
+
+// silentPlayerFactory creates silentPlayers
+type silentPlayerFactory struct{}
+
+func (silentPlayerFactory) NewPlayer(io.Reader) (Player, error) {
+	return &silentPlayer{}, nil
+}
+
+// writeSilentWav writes a 48kHz 16bit stereo WAV file of silence
+func writeSilentWav(path string, samples int) error {
+	dataSize := samples * bytesPerSample
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(36+dataSize))
+	b.WriteString("WAVEfmt ")
+	for _, v := range []any{uint32(16), uint16(1), uint16(2), uint32(DefaultSampleRate), uint32(DefaultSampleRate * bytesPerSample), uint16(bytesPerSample), uint16(16)} {
+		binary.Write(&b, binary.LittleEndian, v) // PCM, stereo, 16bit
+	}
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(dataSize))
+	b.Write(make([]byte, dataSize))
+	return os.WriteFile(path, b.Bytes(), 0644)
+}
+
+// TestMusicPlayer_ClosesStreams tests that the decoded stream of a track is closed when the
+// track is replaced or the player closes, but not when its player is recreated for a new speed
+func TestMusicPlayer_ClosesStreams(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "one.wav"), filepath.Join(dir, "two.wav")}
+	for _, path := range paths {
+		if err := writeSilentWav(path, 4800); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := NewMusicPlayer(paths, silentPlayerFactory{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err := p.Play(); err != nil {
+		t.Fatalf("Play failed: %v", err)
+	}
+	if _, ok := p.currentMusic.stream.(io.Closer); !ok {
+		t.Fatalf("Expected the loaded stream to be closable, got %T", p.currentMusic.stream)
+	}
+
+	// Switching tracks closes the previous stream
+	tracker := &closeTracker{ReadSeeker: bytes.NewReader(nil)}
+	p.currentMusic.stream = tracker
+	if err := p.SkipToNext(); err != nil {
+		t.Fatalf("SkipToNext failed: %v", err)
+	}
+	if !tracker.closed {
+		t.Error("Expected the previous stream to be closed on track switch")
+	}
+
+	// Changing speed hands the open stream over to the new player
+	stream := p.currentMusic.stream
+	p.SetPlaybackSpeed(1.5)
+	if p.currentMusic.stream != stream {
+		t.Error("Expected the stream to be handed over when the speed changes")
+	}
+	if _, err := stream.Read(make([]byte, 16)); err != nil {
+		t.Errorf("Expected the stream to stay readable after changing speed, got %v", err)
+	}
+
+	// Closing the player closes the current stream
+	tracker = &closeTracker{ReadSeeker: bytes.NewReader(nil)}
+	p.currentMusic.stream = tracker
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !tracker.closed {
+		t.Error("Expected the current stream to be closed with the player")
+	}
+}
+
+func TestShelfEQ(t *testing.T) {
+	const rate = 48000
+
+	// pcmStream returns frames holding value on both channels, after an impulse if impulse is set
+	pcmStream := func(value int16, impulse bool) []byte {
+		data := make([]byte, rate/10*bytesPerSample)
+		for i := 0; i < len(data); i += bytesPerSample {
+			v := value
+			if impulse && i == 0 {
+				v = math.MaxInt16
+			}
+			binary.LittleEndian.PutUint16(data[i:], uint16(v))
+			binary.LittleEndian.PutUint16(data[i+2:], uint16(v))
+		}
+		return data
+	}
+	// run equalizes the data, read in small chunks as the audio player would, and returns the output
+	run := func(eq *shelfEQ) []byte {
+		t.Helper()
+		var out bytes.Buffer
+		buf := make([]byte, 1000)
+		for {
+			n, err := eq.Read(buf)
+			out.Write(buf[:n])
+			if err == io.EOF {
+				return out.Bytes()
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	lastSample := func(data []byte) int16 {
+		return int16(binary.LittleEndian.Uint16(data[len(data)-bytesPerSample:]))
+	}
+
+	// A step settles at the gain of the low shelf, as it is all low frequency
+	step := pcmStream(4000, false)
+	eq := newShelfEQ(bytes.NewReader(step), rate)
+	eq.SetGains(6, -6)
+	got := lastSample(run(eq))
+	if want := 4000 * math.Pow(10, 6.0/20); math.Abs(float64(got)-want) > 2 {
+		t.Errorf("Expected the step to settle at %.0f, got %d", want, got)
+	}
+
+	// An impulse through both shelves at full gain stays finite and within range
+	eq = newShelfEQ(bytes.NewReader(pcmStream(0, true)), rate)
+	eq.SetGains(MaxEQGainDB, MaxEQGainDB)
+	out := run(eq)
+	for channel := range 2 {
+		for _, v := range []float64{eq.low.y1[channel], eq.high.y1[channel]} {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				t.Fatalf("Expected finite filter output, got %v", v)
+			}
+		}
+	}
+	if first := int16(binary.LittleEndian.Uint16(out)); first != math.MaxInt16 {
+		t.Errorf("Expected the boosted impulse to clip at full scale, got %d", first)
+	}
+	if last := lastSample(out); last < -1 || last > 1 {
+		t.Errorf("Expected the impulse response to decay, got %d", last)
+	}
+
+	// Bypassed, or with both shelves flat, the stream passes through unchanged
+	eq = newShelfEQ(bytes.NewReader(step), rate)
+	eq.SetGains(6, -6)
+	eq.SetEnabled(false)
+	if !bytes.Equal(run(eq), step) {
+		t.Error("Expected the bypassed EQ to pass the stream through")
+	}
+	eq = newShelfEQ(bytes.NewReader(step), rate)
+	if !bytes.Equal(run(eq), step) {
+		t.Error("Expected the flat EQ to pass the stream through")
+	}
+}
+
+// TestInfiniteLoop tests that the intro plays once and the loop region repeats, on reads and seeks
+func TestInfiniteLoop(t *testing.T) {
+	// Frames numbered 0 to 9: an intro of 2 frames and a loop region of 5
+	data := make([]byte, 10*bytesPerSample)
+	for i := range 10 {
+		binary.LittleEndian.PutUint16(data[i*bytesPerSample:], uint16(i))
+	}
+	frames := func(b []byte) []int {
+		var out []int
+		for i := 0; i+bytesPerSample <= len(b); i += bytesPerSample {
+			out = append(out, int(binary.LittleEndian.Uint16(b[i:])))
+		}
+		return out
+	}
+
+	loop := newInfiniteLoop(bytes.NewReader(data), 2*bytesPerSample, 5*bytesPerSample+1)
+	buf := make([]byte, 12*bytesPerSample)
+	if _, err := io.ReadFull(loop, buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := frames(buf), []int{0, 1, 2, 3, 4, 5, 6, 2, 3, 4, 5, 6}; !slices.Equal(got, want) {
+		t.Errorf("Expected frames %v, got %v", want, got)
+	}
+
+	// Positions past the loop end wrap into the loop region
+	pos, err := loop.Seek(9*bytesPerSample, io.SeekStart)
+	if err != nil || pos != 4*bytesPerSample {
+		t.Errorf("Seek() = %d, %v, want %d", pos, err, 4*bytesPerSample)
+	}
+	if _, err := loop.Seek(0, io.SeekEnd); err == nil {
+		t.Error("Expected seeking from the end to fail")
+	}
+
+	// A loop with nothing to repeat ends
+	empty := newInfiniteLoop(bytes.NewReader(nil), 0, 0)
+	if _, err := empty.Read(buf); err != io.EOF {
+		t.Errorf("Expected io.EOF from an empty loop, got %v", err)
+	}
+}
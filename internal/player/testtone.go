@@ -0,0 +1,109 @@
+package player
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// --- Test tone ---
+
+// The reference tone for calibrating the monitoring level
+const (
+	DefaultTestToneFrequency = 1000.0 // In Hz
+	DefaultTestToneLevel     = -12.0  // Peak level in dBFS
+)
+
+// TestTone is a sine wave as a 16bit little-endian stereo stream. It holds whole cycles,
+// so it loops without a click.
+type TestTone struct {
+	*bytes.Reader
+	sampleRate int
+}
+
+// NewTestTone creates a sine wave of freq Hz at sampleRate, peaking at DefaultTestToneLevel.
+// freq must be positive.
+func NewTestTone(freq float64, sampleRate int) *TestTone {
+	return NewTestToneWithLevel(freq, DefaultTestToneLevel, sampleRate)
+}
+
+// NewTestToneWithLevel creates a sine wave of freq Hz at sampleRate, peaking at levelDB dBFS.
+// Levels above full scale are treated as 0 dBFS. freq must be positive.
+func NewTestToneWithLevel(freq, levelDB float64, sampleRate int) *TestTone {
+	amplitude := math.Pow(10, min(levelDB, 0)/20) * math.MaxInt16
+
+	// About a second of whole cycles
+	cycles := max(1, math.Round(freq))
+	frames := max(1, int(math.Round(cycles*float64(sampleRate)/freq)))
+
+	data := make([]byte, frames*bytesPerSample)
+	for i := range frames {
+		v := uint16(int16(math.Round(amplitude * math.Sin(2*math.Pi*freq*float64(i)/float64(sampleRate)))))
+		binary.LittleEndian.PutUint16(data[i*bytesPerSample:], v)   // Left
+		binary.LittleEndian.PutUint16(data[i*bytesPerSample+2:], v) // Right
+	}
+	return &TestTone{Reader: bytes.NewReader(data), sampleRate: sampleRate}
+}
+
+// Length returns the length of the tone in bytes
+func (t *TestTone) Length() int64 {
+	return t.Size()
+}
+
+// SampleRate returns the sample rate of the tone
+func (t *TestTone) SampleRate() int {
+	return t.sampleRate
+}
+
+// PlayTestTone plays a sine wave of freq Hz peaking at levelDB dBFS, e.g. DefaultTestToneFrequency
+// at DefaultTestToneLevel, to calibrate the monitoring level before auditioning tracks.
+// The playing track is paused for it. The tone keeps its level regardless of the master volume
+// and its pitch regardless of the playback speed, but is panned and folded to mono like tracks.
+// It plays until StopTestTone or Stop is called, or playback of a track resumes.
+func (p *MusicPlayer) PlayTestTone(freq, levelDB float64) error {
+	rate := p.loader.sampleRate
+	if !(freq > 0) || freq >= float64(rate)/2 {
+		return fmt.Errorf("invalid test tone frequency: %v Hz", freq)
+	}
+	p.StopTestTone()
+
+	tone := NewTestToneWithLevel(freq, levelDB, rate)
+	mixer := newStereoMixer(newInfiniteLoop(tone, 0, tone.Length()))
+	mixer.SetPan(p.pan)
+	mixer.SetMono(p.forceMono)
+	meter := newLevelMeter(mixer)
+	newPlayer, err := p.playerFactory.NewPlayer(meter)
+	if err != nil {
+		return fmt.Errorf("failed to create audio player for the test tone: %v", err)
+	}
+	music := NewMusic(newPlayer)
+	music.meter = meter
+	music.mixer = mixer
+
+	if p.currentMusic != nil && !p.isPaused && p.state != StateStopped {
+		p.TogglePause()
+	}
+	music.SetVolume(1)
+	music.Play()
+	p.testTone = music
+	p.testToneLabel = fmt.Sprintf("%g Hz, %g dBFS", freq, min(levelDB, 0))
+	return nil
+}
+
+// StopTestTone stops the test tone, if it is playing. The paused track stays paused.
+func (p *MusicPlayer) StopTestTone() {
+	if p.testTone == nil {
+		return
+	}
+	if err := p.testTone.Close(); err != nil {
+		p.logger.Error("Failed to close the test tone: %v", err)
+	}
+	p.testTone = nil
+}
+
+// GetTestTone returns a description of the playing test tone, e.g. "1000 Hz, -12 dBFS",
+// and whether one is playing
+func (p *MusicPlayer) GetTestTone() (string, bool) {
+	return p.testToneLabel, p.testTone != nil
+}
@@ -0,0 +1,261 @@
+package player
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// --- Waveform ---
+
+// defaultPeakBuckets is the waveform resolution peaks are computed at until a waveform is
+// requested with Waveform; any resolution has the same peak
+const defaultPeakBuckets = 256
+
+// waveformCacheEntry is a computed waveform, valid while the file is unchanged.
+// Failures are cached too, so a broken file isn't decoded again every frame.
+type waveformCacheEntry struct {
+	modTime time.Time
+	size    int64
+	buckets int
+	peaks   []float32
+	err     error
+}
+
+// peakCacheEntry is the peak amplitude of a whole file, valid while the file is unchanged.
+// It is kept apart from the waveform, so it outlives waveforms computed at other resolutions.
+type peakCacheEntry struct {
+	modTime time.Time
+	size    int64
+	peak    float32
+	err     error
+}
+
+// ComputeWaveform decodes the audio file and returns the peak amplitude (0.0-1.0) of each of
+// the given number of equal parts of the track.
+// Decoding a whole file is slow, so results are cached until the file's size or modification time changes.
+func (l *MusicLoader) ComputeWaveform(filePath string, buckets int) ([]float32, error) {
+	return l.ComputeWaveformContext(context.Background(), filePath, buckets)
+}
+
+// ComputeWaveformContext is ComputeWaveform, giving up on decoding once ctx is done.
+// A cancelled decode isn't cached.
+func (l *MusicLoader) ComputeWaveformContext(ctx context.Context, filePath string, buckets int) ([]float32, error) {
+	if buckets <= 0 {
+		return nil, fmt.Errorf("loader: invalid waveform bucket count: %d", buckets)
+	}
+
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("loader: failed to stat audio file %s: %v", filePath, err)
+	}
+	if entry, ok := l.cachedWaveform(filePath, stat, buckets); ok {
+		return entry.peaks, entry.err
+	}
+
+	peaks, duration, err := l.decodeWaveform(ctx, filePath, buckets)
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("loader: decoding %s was cancelled: %v", filePath, ctx.Err())
+	}
+
+	l.mu.Lock()
+	// The decode gives the duration too, so it isn't decoded again for GetDuration
+	if _, ok := l.durations[filePath]; !ok && err == nil {
+		l.durations[filePath] = durationCacheEntry{
+			modTime:  stat.ModTime(),
+			size:     stat.Size(),
+			duration: duration,
+		}
+		l.durationsVersion++
+	}
+	l.waveforms[filePath] = waveformCacheEntry{
+		modTime: stat.ModTime(),
+		size:    stat.Size(),
+		buckets: buckets,
+		peaks:   peaks,
+		err:     err,
+	}
+	l.peaks[filePath] = peakCacheEntry{
+		modTime: stat.ModTime(),
+		size:    stat.Size(),
+		peak:    maxPeak(peaks),
+		err:     err,
+	}
+	l.mu.Unlock()
+
+	return peaks, err
+}
+
+// Waveform returns the waveform of the audio file if it has been computed, without blocking.
+// Otherwise it starts computing it in the background and returns false; call again on a later frame.
+// Peaks are nil if the file couldn't be decoded.
+func (l *MusicLoader) Waveform(filePath string, buckets int) ([]float32, bool) {
+	// Peaks are computed at the resolution shown, so the file is decoded once for both
+	l.mu.Lock()
+	l.waveformBuckets = buckets
+	l.mu.Unlock()
+	return l.waveform(filePath, buckets)
+}
+
+// waveform implements Waveform
+func (l *MusicLoader) waveform(filePath string, buckets int) ([]float32, bool) {
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return nil, true
+	}
+	if entry, ok := l.cachedWaveform(filePath, stat, buckets); ok {
+		return entry.peaks, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.pendingWaveforms[filePath] {
+		return nil, false
+	}
+	l.pendingWaveforms[filePath] = true
+
+	go func() {
+		if _, err := l.ComputeWaveform(filePath, buckets); err != nil {
+			l.getLogger().Warn("failed to compute waveform: %v", err)
+		}
+		l.mu.Lock()
+		delete(l.pendingWaveforms, filePath)
+		l.mu.Unlock()
+	}()
+	return nil, false
+}
+
+// cachedWaveform returns the cached waveform if it matches the file and bucket count
+func (l *MusicLoader) cachedWaveform(filePath string, stat os.FileInfo, buckets int) (waveformCacheEntry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.waveforms[filePath]
+	if !ok || !entry.modTime.Equal(stat.ModTime()) || entry.size != stat.Size() || entry.buckets != buckets {
+		return waveformCacheEntry{}, false
+	}
+	return entry, true
+}
+
+// ComputePeak returns the peak amplitude (0.0-1.0) of the whole audio file.
+// It is taken from the file's waveform, so the file is decoded once for both, and cached
+// until the file's size or modification time changes.
+func (l *MusicLoader) ComputePeak(ctx context.Context, filePath string) (float32, error) {
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("loader: failed to stat audio file %s: %v", filePath, err)
+	}
+	if entry, ok := l.cachedPeak(filePath, stat); ok {
+		return entry.peak, entry.err
+	}
+	peaks, err := l.ComputeWaveformContext(ctx, filePath, l.peakBuckets())
+	return maxPeak(peaks), err
+}
+
+// peak returns the peak amplitude of the audio file if it is known, without blocking.
+// Otherwise it starts computing the waveform in the background and returns false.
+func (l *MusicLoader) peak(filePath string) (peak float32, ready bool, err error) {
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return 0, true, fmt.Errorf("loader: failed to stat audio file %s: %v", filePath, err)
+	}
+	if entry, ok := l.cachedPeak(filePath, stat); ok {
+		return entry.peak, true, entry.err
+	}
+	l.waveform(filePath, l.peakBuckets())
+	return 0, false, nil
+}
+
+// cachedPeak returns the cached peak if it matches the file
+func (l *MusicLoader) cachedPeak(filePath string, stat os.FileInfo) (peakCacheEntry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.peaks[filePath]
+	if !ok || !entry.modTime.Equal(stat.ModTime()) || entry.size != stat.Size() {
+		return peakCacheEntry{}, false
+	}
+	return entry, true
+}
+
+// peakBuckets returns the waveform resolution to compute peaks at: that of the waveform last requested
+func (l *MusicLoader) peakBuckets() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.waveformBuckets > 0 {
+		return l.waveformBuckets
+	}
+	return defaultPeakBuckets
+}
+
+// maxPeak returns the highest of the peaks
+func maxPeak(peaks []float32) float32 {
+	var peak float32
+	for _, v := range peaks {
+		peak = max(peak, v)
+	}
+	return peak
+}
+
+// decodeWaveform reads the whole decoded stream and reduces it to per-bucket peaks,
+// also returning the duration of the stream
+func (l *MusicLoader) decodeWaveform(ctx context.Context, filePath string, buckets int) ([]float32, time.Duration, error) {
+	stream, err := l.LoadStreamContext(ctx, filePath)
+	if err != nil {
+		return nil, 0, err
+	}
+	if closer, ok := stream.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	streamLength, ok := stream.(interface{ Length() int64 })
+	if !ok {
+		return nil, 0, fmt.Errorf("loader: audio stream for %s does not support Length()", filePath)
+	}
+	duration := bytesToDuration(streamLength.Length(), l.sampleRate)
+	frames := streamLength.Length() / bytesPerSample
+	peaks := make([]float32, buckets)
+	if frames <= 0 {
+		return peaks, duration, nil
+	}
+
+	buf := make([]byte, 64*1024)
+	var frame int64
+	var carry []byte
+	for {
+		// The stream is detached from ctx once decoded, so the context is checked here
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		n, err := stream.Read(buf)
+		data := append(carry, buf[:n]...)
+		whole := len(data) / bytesPerSample * bytesPerSample
+		for i := 0; i < whole && frame < frames; i += bytesPerSample {
+			bucket := frame * int64(buckets) / frames
+			for _, offset := range []int{0, 2} {
+				v := float32(math.Abs(float64(int16(binary.LittleEndian.Uint16(data[i+offset:]))) / 32768))
+				if v > peaks[bucket] {
+					peaks[bucket] = v
+				}
+			}
+			frame++
+		}
+		carry = append(carry[:0:0], data[whole:]...)
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("loader: failed to decode audio %s: %v", filePath, err)
+		}
+	}
+	return peaks, duration, nil
+}
+
+// GetWaveform returns the waveform of the given music file if it is ready.
+// It is computed in the background the first time it is requested; see MusicLoader.Waveform.
+func (p *MusicPlayer) GetWaveform(path string, buckets int) ([]float32, bool) {
+	return p.loader.Waveform(path, buckets)
+}
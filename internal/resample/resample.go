@@ -0,0 +1,207 @@
+// Package resample converts the sample rate of signed 16bit little endian stereo PCM streams,
+// the format the decoders of this module produce, without depending on an audio backend.
+package resample
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	// bytesPerSample is the size of a stereo frame of 16bit samples
+	bytesPerSample = 4
+
+	// taps is the number of source frames weighted on each side of an output frame
+	// when the rate is raised; lowering the rate widens the filter by the ratio
+	taps = 8
+
+	// kernelResolution is the number of kernel values per source frame in the lookup table
+	kernelResolution = 512
+
+	// compactFrames is how many frames the filter moves past before they are dropped from the window
+	compactFrames = 4096
+)
+
+// Reader reads a stream at another sample rate. Each output frame is interpolated from the
+// surrounding source frames with a Hann windowed sinc filter, which also cuts off the frequencies
+// above the new Nyquist frequency when the rate is lowered.
+//
+// The source is read sequentially; seeking the Reader seeks the source.
+type Reader struct {
+	src       io.ReadSeeker
+	srcFrames int64 // Length of the source in frames
+	from, to  int
+
+	halfWidth int       // Source frames weighted on each side
+	kernel    []float64 // Filter kernel by distance in source frames, kernelResolution values per frame
+
+	pos        int64   // Position in output frames
+	window     []int16 // Source frames from windowPos up to windowEnd, interleaved
+	windowPos  int64   // First source frame in window
+	windowEnd  int64   // Source frame the source is positioned at
+	readBuffer []byte
+}
+
+// NewReader returns a Reader converting src, size bytes long at the sample rate from, to the rate to.
+func NewReader(src io.ReadSeeker, size int64, from, to int) *Reader {
+	cutoff := min(1, float64(to)/float64(from))
+	halfWidth := int(math.Ceil(taps / cutoff))
+
+	kernel := make([]float64, halfWidth*kernelResolution+1)
+	for i := range kernel {
+		d := float64(i) / kernelResolution
+		window := 0.5 + 0.5*math.Cos(math.Pi*d/float64(halfWidth))
+		x := math.Pi * d * cutoff
+		sinc := 1.0
+		if x != 0 {
+			sinc = math.Sin(x) / x
+		}
+		kernel[i] = sinc * window
+	}
+
+	return &Reader{
+		src:       src,
+		srcFrames: size / bytesPerSample,
+		from:      from,
+		to:        to,
+		halfWidth: halfWidth,
+		kernel:    kernel,
+		windowPos: -1,
+	}
+}
+
+// Length returns the length of the converted stream in bytes.
+func (r *Reader) Length() int64 {
+	return r.frames() * bytesPerSample
+}
+
+// frames returns the length of the converted stream in frames
+func (r *Reader) frames() int64 {
+	return r.srcFrames * int64(r.to) / int64(r.from)
+}
+
+// Read is implementation of io.Reader's Read.
+func (r *Reader) Read(p []byte) (int, error) {
+	frames := r.frames()
+	if r.pos >= frames {
+		return 0, io.EOF
+	}
+
+	n := 0
+	for ; n+bytesPerSample <= len(p) && r.pos < frames; n += bytesPerSample {
+		left, right, err := r.at(r.pos)
+		if err != nil {
+			return n, err
+		}
+		binary.LittleEndian.PutUint16(p[n:], uint16(left))
+		binary.LittleEndian.PutUint16(p[n+2:], uint16(right))
+		r.pos++
+	}
+	return n, nil
+}
+
+// Seek is implementation of io.Seeker's Seek. The position is rounded down to a whole frame.
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos * bytesPerSample
+	case io.SeekEnd:
+		offset += r.Length()
+	default:
+		return 0, fmt.Errorf("resample: invalid whence: %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("resample: negative position: %d", offset)
+	}
+	r.pos = min(offset/bytesPerSample, r.frames())
+	return r.pos * bytesPerSample, nil
+}
+
+// at returns the output frame at the given position
+func (r *Reader) at(pos int64) (int16, int16, error) {
+	// Position in the source, in source frames
+	center := float64(pos) * float64(r.from) / float64(r.to)
+	first := int64(math.Floor(center)) - int64(r.halfWidth) + 1
+	last := int64(math.Floor(center)) + int64(r.halfWidth)
+	if err := r.fill(max(first, 0), min(last, r.srcFrames-1)); err != nil {
+		return 0, 0, err
+	}
+
+	var left, right, total float64
+	for i := first; i <= last; i++ {
+		w := r.weight(math.Abs(center - float64(i)))
+		total += w
+		if i < 0 || i >= r.srcFrames {
+			continue // Silence beyond the ends
+		}
+		offset := (i - r.windowPos) * 2
+		left += w * float64(r.window[offset])
+		right += w * float64(r.window[offset+1])
+	}
+	// Normalizing keeps a constant level constant whatever the phase
+	if total != 0 {
+		left, right = left/total, right/total
+	}
+	return clamp(left), clamp(right), nil
+}
+
+// weight returns the filter kernel at the distance in source frames
+func (r *Reader) weight(d float64) float64 {
+	i := d * kernelResolution
+	index := int(i)
+	if index >= len(r.kernel)-1 {
+		return 0
+	}
+	frac := i - float64(index)
+	return r.kernel[index]*(1-frac) + r.kernel[index+1]*frac
+}
+
+// fill makes the window hold the source frames from first to last.
+// Moving forwards reads on from the source; moving back seeks it.
+func (r *Reader) fill(first, last int64) error {
+	if last < first {
+		return nil
+	}
+	if r.windowPos < 0 || first < r.windowPos || first > r.windowEnd {
+		if _, err := r.src.Seek(first*bytesPerSample, io.SeekStart); err != nil {
+			return fmt.Errorf("resample: failed to seek: %v", err)
+		}
+		r.window = r.window[:0]
+		r.windowPos, r.windowEnd = first, first
+	} else if drop := first - r.windowPos; drop >= compactFrames {
+		// Frames behind the filter are dropped in batches rather than on every frame
+		r.window = append(r.window[:0], r.window[drop*2:]...)
+		r.windowPos = first
+	}
+
+	for r.windowEnd <= last {
+		want := int(max(last+1-r.windowEnd, compactFrames)) * bytesPerSample
+		if cap(r.readBuffer) < want {
+			r.readBuffer = make([]byte, want)
+		}
+		buf := r.readBuffer[:want]
+		n, err := io.ReadFull(r.src, buf)
+		n = n / bytesPerSample * bytesPerSample
+		for i := 0; i < n; i += 2 {
+			r.window = append(r.window, int16(binary.LittleEndian.Uint16(buf[i:])))
+		}
+		r.windowEnd += int64(n / bytesPerSample)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// The source is shorter than its stated size: the rest is silence
+			r.srcFrames = min(r.srcFrames, r.windowEnd)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("resample: failed to read: %v", err)
+		}
+	}
+	return nil
+}
+
+// clamp converts a sample value to 16bit, clipping it to full scale
+func clamp(v float64) int16 {
+	return int16(max(min(math.Round(v), math.MaxInt16), math.MinInt16))
+}
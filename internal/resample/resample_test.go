@@ -0,0 +1,100 @@
+package resample_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"musicplayer/internal/resample"
+)
+
+// pcm builds a stereo stream with the value of f for each frame on both channels
+func pcm(frames int, f func(i int) float64) []byte {
+	data := make([]byte, frames*4)
+	for i := range frames {
+		v := uint16(int16(math.Round(f(i))))
+		binary.LittleEndian.PutUint16(data[i*4:], v)
+		binary.LittleEndian.PutUint16(data[i*4+2:], v)
+	}
+	return data
+}
+
+// left returns the left channel of a stereo stream
+func left(data []byte) []int16 {
+	samples := make([]int16, len(data)/4)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(data[i*4:]))
+	}
+	return samples
+}
+
+func TestReader_Length(t *testing.T) {
+	data := pcm(4410, func(int) float64 { return 0 })
+	r := resample.NewReader(bytes.NewReader(data), int64(len(data)), 44100, 48000)
+	assert.Equal(t, int64(4800*4), r.Length())
+
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Len(t, out, 4800*4)
+}
+
+func TestReader_ConstantLevel(t *testing.T) {
+	for _, rates := range [][2]int{{44100, 48000}, {48000, 44100}, {48000, 24000}} {
+		data := pcm(4800, func(int) float64 { return 10000 })
+		r := resample.NewReader(bytes.NewReader(data), int64(len(data)), rates[0], rates[1])
+		out, err := io.ReadAll(r)
+		require.NoError(t, err)
+
+		// Away from the ends, which fade against the silence beyond them, the level is kept
+		samples := left(out)
+		for i := 100; i < len(samples)-100; i++ {
+			require.InDelta(t, 10000, samples[i], 1, "%d Hz to %d Hz, frame %d", rates[0], rates[1], i)
+		}
+	}
+}
+
+func TestReader_Sine(t *testing.T) {
+	// A 1kHz tone at 44.1kHz is still a 1kHz tone at 48kHz
+	data := pcm(44100, func(i int) float64 { return 16000 * math.Sin(2*math.Pi*1000*float64(i)/44100) })
+	r := resample.NewReader(bytes.NewReader(data), int64(len(data)), 44100, 48000)
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	samples := left(out)
+	for i := 1000; i < 2000; i++ {
+		want := 16000 * math.Sin(2*math.Pi*1000*float64(i)/48000)
+		require.InDelta(t, want, samples[i], 50, "frame %d", i)
+	}
+}
+
+func TestReader_Seek(t *testing.T) {
+	data := pcm(4800, func(i int) float64 { return float64(i) })
+	r := resample.NewReader(bytes.NewReader(data), int64(len(data)), 48000, 44100)
+	whole, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	// Reading after seeking back gives the same frames as reading through
+	for _, offset := range []int64{0, 400, 17 * 4, 4000} {
+		pos, err := r.Seek(offset+1, io.SeekStart)
+		require.NoError(t, err)
+		assert.Equal(t, offset, pos, "the position is rounded down to a whole frame")
+
+		part := make([]byte, 64)
+		_, err = io.ReadFull(r, part)
+		require.NoError(t, err)
+		assert.Equal(t, whole[offset:offset+64], part, "offset %d", offset)
+	}
+
+	_, err = r.Seek(-4, io.SeekStart)
+	assert.Error(t, err)
+	pos, err := r.Seek(0, io.SeekEnd)
+	require.NoError(t, err)
+	assert.Equal(t, r.Length(), pos)
+	_, err = r.Read(make([]byte, 4))
+	assert.Equal(t, io.EOF, err)
+}
@@ -1,14 +1,19 @@
 package ui
 
 import (
+	"context"
 	"fmt"
 	"image"
-	"log"
+	"image/color"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	// Keep time for potential future use in Update
 	// Keep time for potential future use in Update
 	// Needed for HandleFileChanges
+	"musicplayer/internal/files"
 	"musicplayer/internal/player"
 	"musicplayer/internal/ui/widgets" // Keep widgets for Slider
 
@@ -22,31 +27,131 @@ import (
 
 const (
 	ScreenWidth  = 800
-	ScreenHeight = 400
+	ScreenHeight = 480
+
+	// Window size of mini mode, which shows only the now playing text and the transport controls
+	MiniScreenWidth  = 400
+	MiniScreenHeight = 126
+
+	// playbackSpeedStep is the change in playback speed per key press
+	playbackSpeedStep = 0.25
+
+	// volumeStep is the change in master volume per key press
+	volumeStep = 0.05
+
+	// panStep is the change in pan per key press
+	panStep = 0.25
+
+	// eqStepDB is the change in gain of a preview EQ shelf per key press
+	eqStepDB = 3.0
+
+	// waveformBuckets is the number of peaks computed for the waveform
+	waveformBuckets = 800
+
+	// settingsSaveDelayFrames is how long settings must stay unchanged before they are saved
+	settingsSaveDelayFrames = 60
+
+	// trackNumberTimeoutFrames is how long a typed track number waits for Enter before it is discarded
+	trackNumberTimeoutFrames = 120
+
+	// loadingSpinnerFrames is how long each step of the loading spinner is shown
+	loadingSpinnerFrames = 6
 )
 
+// loadingSpinner are the steps of the spinner shown while a track is decoded
+var loadingSpinner = []string{"|", "/", "-", "\\"}
+
 // Root is the root widget of the application
 type Root struct {
 	guigui.DefaultWidget
 
-	player *player.MusicPlayer
+	player    *player.MusicPlayer
+	musicDirs []files.MusicDirectory // Paths are shown relative to these
 
 	// UI components (Value types for basicwidget again)
 	background         basicwidget.Background
-	musicList          basicwidget.TextList[string]
+	bannerText         basicwidget.Text
+	bannerButton       basicwidget.TextButton
+	filterInput        widgets.TextInput
+	librarySummaryText basicwidget.Text
+	musicList          widgets.ReorderableList[string]
+	usageText          basicwidget.Text // Shown in place of the music list while there are no files
+	warningText        basicwidget.Text
 	nowPlayingText     basicwidget.Text
+	noteInput          widgets.TextInput
+	waveform           widgets.Waveform
+	seekBar            widgets.ProgressBar
+	vuMeter            widgets.VUMeter
 	timeText           basicwidget.Text
 	settingsText       basicwidget.Text
+	volumeSlider       widgets.Slider
 	loopDurationSlider widgets.Slider
 	intervalSlider     widgets.Slider
+	helpBackground     basicwidget.Background
+	helpColumns        [2]basicwidget.Text
+	previousButton     basicwidget.TextButton
+	playButton         basicwidget.TextButton
+	stopButton         basicwidget.TextButton
+	nextButton         basicwidget.TextButton
 	initialized        bool // 初期化フラグ
+
+	// syncingSelection is set while the list selection is changed to follow the player,
+	// so OnItemSelected only reacts to the user selecting a row
+	syncingSelection bool
+
+	// focusedPath is the track highlighted with the arrow keys, which is played with Enter.
+	// While it is set, the list selection stays on it rather than following the player.
+	focusedPath string
+
+	// showHelp is set while the list of controls is drawn over the UI
+	showHelp bool
+
+	// miniMode is set while the window shows only the compact transport bar.
+	// It is saved in the UI part of the settings.
+	miniMode bool
+
+	// Problems to show in the banner until they are dismissed, oldest first
+	warnings []string
+
+	// watcherHealthy reports whether directory changes are noticed; nil when there is no watcher
+	watcherHealthy func() bool
+
+	// Durations and sort versions the list rows were built with; the rows are rebuilt as durations
+	// are computed, and when the list is sorted again in the background
+	listDurationsVersion int
+	listSortVersion      int
+
+	// Track the note input is showing the note of
+	notePath string
+
+	// Format warning of the current track, probed when the track changes
+	formatWarningPath string
+	formatWarning     string
+
+	// Frames spent loading, to animate the spinner
+	loadingFrames int
+
+	// Track number being typed to jump to, and the frames since the last digit
+	trackNumber       string
+	trackNumberFrames int
+
+	// Review report being written in the background, and how to cancel it
+	reportExport       <-chan player.ReportExportResult
+	cancelReportExport context.CancelFunc
+
+	// Settings persistence
+	settingsPath          string
+	savedSettings         player.Settings
+	pendingSettings       player.Settings
+	settingsChangedFrames int
 }
 
 // NewRoot creates a new root widget
 func NewRoot(player *player.MusicPlayer) *Root {
 	// Initialize struct with zero values for value types and initial state
 	r := &Root{
-		player: player,
+		player:    player,
+		musicDirs: []files.MusicDirectory{files.DefaultMusicDir},
 		// initialized is false by default
 	}
 
@@ -55,6 +160,59 @@ func NewRoot(player *player.MusicPlayer) *Root {
 	return r
 }
 
+// SetSettingsPath enables saving the settings to the given file when they change
+func (r *Root) SetSettingsPath(path string) {
+	r.settingsPath = path
+	r.savedSettings = r.Settings()
+	r.pendingSettings = r.savedSettings
+}
+
+// Settings returns the persistent settings of the player along with those of the UI
+func (r *Root) Settings() player.Settings {
+	settings := r.player.Settings()
+	settings.UI = player.UISettings{MiniMode: r.miniMode}
+	return settings
+}
+
+// ApplyUISettings applies the UI part of the persistent settings; the player applies the rest.
+// Call it before the UI is run.
+func (r *Root) ApplyUISettings(settings player.UISettings) {
+	r.miniMode = settings.MiniMode
+}
+
+// SetMusicDirectories sets the music directories that paths are shown relative to
+func (r *Root) SetMusicDirectories(dirs []files.MusicDirectory) {
+	r.musicDirs = dirs
+}
+
+// SetWatcherHealthFunc sets how to tell whether changes to the music directories are noticed,
+// e.g. files.DirectoryWatcher.IsHealthy, so the UI can warn while live updates aren't working
+func (r *Root) SetWatcherHealthFunc(healthy func() bool) {
+	r.watcherHealthy = healthy
+}
+
+// AddWarning shows a problem in the banner at the top of the window until it is dismissed,
+// for users who never see the console. A warning already in the banner isn't added twice.
+// It must be called on the UI goroutine, e.g. from the player's load error callback.
+func (r *Root) AddWarning(message string) {
+	if message == "" || slices.Contains(r.warnings, message) {
+		return
+	}
+	r.warnings = append(r.warnings, message)
+}
+
+// bannerMessage returns the text of the warning banner: the latest warning and how many came before it
+func (r *Root) bannerMessage() string {
+	if len(r.warnings) == 0 {
+		return ""
+	}
+	message := r.warnings[len(r.warnings)-1]
+	if len(r.warnings) > 1 {
+		message = fmt.Sprintf("%s (+%d more)", message, len(r.warnings)-1)
+	}
+	return message
+}
+
 // Layout lays out the root widget
 func (r *Root) Build(context *guigui.Context, appender *guigui.ChildWidgetAppender) error {
 	faceSources := []*text.GoTextFaceSource{
@@ -72,21 +230,45 @@ func (r *Root) Build(context *guigui.Context, appender *guigui.ChildWidgetAppend
 		faceSources = append(faceSources, cjkfont.FaceSourceJP())
 	}
 	basicwidget.SetFaceSources(faceSources)
+	r.filterInput.SetFaceSources(faceSources)
+	r.noteInput.SetFaceSources(faceSources)
+
+	// Match the basicwidget widgets to the theme of the custom widgets
+	context.SetColorMode(widgets.CurrentTheme().ColorMode)
 
 	appender.AppendChildWidgetWithBounds(&r.background, context.AppBounds())
 
 	// Configure Text widgets (Safe to call Setters here)
 	r.nowPlayingText.SetBold(true)
 	r.nowPlayingText.SetScale(1.5)
-	r.settingsText.SetText("Settings")
 	r.settingsText.SetBold(true)
+	r.warningText.SetColor(color.RGBA{0xff, 0x40, 0x40, 0xff})
+	r.bannerText.SetColor(color.RGBA{0xff, 0x40, 0x40, 0xff})
+	r.bannerText.SetBold(true)
+	r.bannerText.SetVerticalAlign(basicwidget.VerticalAlignMiddle)
+	r.bannerText.SetText(r.bannerMessage())
+	r.bannerButton.SetText("Dismiss")
+	r.filterInput.SetPlaceholder("Filter...")
+	r.noteInput.SetPlaceholder("Note for this track...")
+	r.librarySummaryText.SetHorizontalAlign(basicwidget.HorizontalAlignEnd)
+	r.librarySummaryText.SetVerticalAlign(basicwidget.VerticalAlignMiddle)
 
 	// Configure Sliders Min/Max (Safe to call Setters here)
-	r.loopDurationSlider.SetMinimum(1)
-	r.loopDurationSlider.SetMaximum(60)
-	r.intervalSlider.SetMinimum(1)
+	r.volumeSlider.SetMinimum(0)
+	r.volumeSlider.SetMaximum(100)
+	// The range covers every loop duration preset, so they aren't clamped when the slider follows them
+	presets := r.player.GetLoopPresets()
+	r.loopDurationSlider.SetMinimum(min(1, presets[0]))
+	r.loopDurationSlider.SetMaximum(max(60, presets[len(presets)-1]))
+	r.intervalSlider.SetMinimum(0) // No interval: the next track follows right away
 	r.intervalSlider.SetMaximum(60)
 
+	// Mini mode has a layout of its own
+	if r.miniMode {
+		r.buildMini(context, appender)
+		return nil
+	}
+
 	// --- Position and Append Widgets ---
 	bounds := context.Bounds(r)
 	appSize := context.AppSize() // Get root size
@@ -99,7 +281,16 @@ func (r *Root) Build(context *guigui.Context, appender *guigui.ChildWidgetAppend
 
 	// 各ウィジェットの高さを定義
 	const (
+		bannerHeight         = 24
+		bannerButtonWidth    = 80
+		filterInputHeight    = 24
+		librarySummaryWidth  = 200
+		warningTextHeight    = 20
 		nowPlayingTextHeight = 30
+		noteInputHeight      = 24
+		waveformHeight       = 48
+		seekBarHeight        = 12
+		vuMeterHeight        = 8
 		timeTextHeight       = 20
 		settingsTextHeight   = 30
 		sliderHeight         = 20
@@ -115,24 +306,105 @@ func (r *Root) Build(context *guigui.Context, appender *guigui.ChildWidgetAppend
 	// settingsText
 	settingsTextY := loopDurationSliderY - margin - settingsTextHeight
 
+	// volumeSlider
+	volumeSliderY := settingsTextY - margin - sliderHeight
+
 	// timeText
-	timeTextY := settingsTextY - margin - timeTextHeight
+	timeTextY := volumeSliderY - margin - timeTextHeight
+
+	// vuMeter
+	vuMeterY := timeTextY - margin - vuMeterHeight
+
+	// seekBar
+	seekBarY := vuMeterY - margin - seekBarHeight
+
+	// waveform
+	waveformY := seekBarY - margin - waveformHeight
+
+	// noteInput
+	noteInputY := waveformY - margin - noteInputHeight
 
 	// nowPlayingText
-	nowPlayingTextY := timeTextY - margin - nowPlayingTextHeight
+	nowPlayingTextY := noteInputY - margin - nowPlayingTextHeight
+
+	// warningText
+	warningTextY := nowPlayingTextY - margin - warningTextHeight
+
+	// filterInput, below the banner while it shows warnings
+	filterInputY := margin
+	if len(r.warnings) > 0 {
+		filterInputY += bannerHeight + margin
+	}
 
 	// musicList （残りの高さを全て使用）
-	musicListHeight := nowPlayingTextY - margin*2
-	musicListY := margin
+	musicListY := filterInputY + filterInputHeight + margin
+	musicListHeight := warningTextY - margin - musicListY
 
 	// ウィジェットの配置と追加
-	// Music List
+	// Warning Banner, with the dismiss button on its right
+	if len(r.warnings) > 0 {
+		bannerTextWidth := availableWidth - margin - bannerButtonWidth
+		appender.AppendChildWidgetWithBounds(
+			&r.bannerText,
+			image.Rect(bounds.Min.X+margin,
+				bounds.Min.Y+margin,
+				bounds.Min.X+margin+bannerTextWidth,
+				bounds.Min.Y+margin+bannerHeight,
+			),
+		)
+		appender.AppendChildWidgetWithBounds(
+			&r.bannerButton,
+			image.Rect(bounds.Min.X+margin+bannerTextWidth+margin,
+				bounds.Min.Y+margin,
+				bounds.Min.X+margin+availableWidth,
+				bounds.Min.Y+margin+bannerHeight,
+			),
+		)
+	}
+
+	// Filter Input, leaving room for the library summary on its right
+	filterInputWidth := availableWidth - margin - librarySummaryWidth
 	appender.AppendChildWidgetWithBounds(
-		&r.musicList,
+		&r.filterInput,
 		image.Rect(bounds.Min.X+margin,
-			bounds.Min.Y+musicListY,
+			bounds.Min.Y+filterInputY,
+			bounds.Min.X+margin+filterInputWidth,
+			bounds.Min.Y+filterInputY+filterInputHeight,
+		),
+	)
+
+	// Library Summary
+	appender.AppendChildWidgetWithBounds(
+		&r.librarySummaryText,
+		image.Rect(bounds.Min.X+margin+filterInputWidth+margin,
+			bounds.Min.Y+filterInputY,
+			bounds.Min.X+margin+availableWidth,
+			bounds.Min.Y+filterInputY+filterInputHeight,
+		),
+	)
+
+	// Music List, or how to add files while there are none
+	musicListBounds := image.Rect(bounds.Min.X+margin,
+		bounds.Min.Y+musicListY,
+		bounds.Min.X+margin+availableWidth,
+		bounds.Min.Y+musicListY+musicListHeight,
+	)
+	if len(r.player.GetMusicFiles()) == 0 {
+		r.usageText.SetText(r.usageInstructions())
+		r.usageText.SetMultiline(true)
+		r.usageText.SetAutoWrap(true)
+		appender.AppendChildWidgetWithBounds(&r.usageText, musicListBounds)
+	} else {
+		appender.AppendChildWidgetWithBounds(&r.musicList, musicListBounds)
+	}
+
+	// Warning Text
+	appender.AppendChildWidgetWithBounds(
+		&r.warningText,
+		image.Rect(bounds.Min.X+margin,
+			bounds.Min.Y+warningTextY,
 			bounds.Min.X+margin+availableWidth,
-			bounds.Min.Y+musicListY+musicListHeight,
+			bounds.Min.Y+warningTextY+warningTextHeight,
 		),
 	)
 
@@ -145,6 +417,46 @@ func (r *Root) Build(context *guigui.Context, appender *guigui.ChildWidgetAppend
 			bounds.Min.Y+nowPlayingTextY+nowPlayingTextHeight,
 		),
 	)
+	// Note Input
+	appender.AppendChildWidgetWithBounds(
+		&r.noteInput,
+		image.Rect(bounds.Min.X+margin,
+			bounds.Min.Y+noteInputY,
+			bounds.Min.X+margin+availableWidth,
+			bounds.Min.Y+noteInputY+noteInputHeight,
+		),
+	)
+
+	// Waveform
+	appender.AppendChildWidgetWithBounds(
+		&r.waveform,
+		image.Rect(bounds.Min.X+margin,
+			bounds.Min.Y+waveformY,
+			bounds.Min.X+margin+availableWidth,
+			bounds.Min.Y+waveformY+waveformHeight,
+		),
+	)
+
+	// Seek Bar
+	appender.AppendChildWidgetWithBounds(
+		&r.seekBar,
+		image.Rect(bounds.Min.X+margin,
+			bounds.Min.Y+seekBarY,
+			bounds.Min.X+margin+availableWidth,
+			bounds.Min.Y+seekBarY+seekBarHeight,
+		),
+	)
+
+	// VU Meter
+	appender.AppendChildWidgetWithBounds(
+		&r.vuMeter,
+		image.Rect(bounds.Min.X+margin,
+			bounds.Min.Y+vuMeterY,
+			bounds.Min.X+margin+availableWidth,
+			bounds.Min.Y+vuMeterY+vuMeterHeight,
+		),
+	)
+
 	// Time Text
 	appender.AppendChildWidgetWithBounds(
 		&r.timeText,
@@ -155,6 +467,16 @@ func (r *Root) Build(context *guigui.Context, appender *guigui.ChildWidgetAppend
 		),
 	)
 
+	// Volume Slider
+	appender.AppendChildWidgetWithBounds(
+		&r.volumeSlider,
+		image.Rect(bounds.Min.X+margin,
+			bounds.Min.Y+volumeSliderY,
+			bounds.Min.X+margin+availableWidth,
+			bounds.Min.Y+volumeSliderY+sliderHeight,
+		),
+	)
+
 	// Settings Text
 	appender.AppendChildWidgetWithBounds(
 		&r.settingsText,
@@ -185,9 +507,164 @@ func (r *Root) Build(context *guigui.Context, appender *guigui.ChildWidgetAppend
 		),
 	)
 
+	// Help Overlay, over everything else
+	if r.showHelp {
+		appender.AppendChildWidgetWithBounds(&r.helpBackground, context.AppBounds())
+		columnWidth := (availableWidth - margin) / len(r.helpColumns)
+		for i := range r.helpColumns {
+			r.helpColumns[i].SetText(r.helpColumnText(i))
+			r.helpColumns[i].SetMultiline(true)
+			x := bounds.Min.X + margin + i*(columnWidth+margin)
+			appender.AppendChildWidgetWithBounds(
+				&r.helpColumns[i],
+				image.Rect(x, bounds.Min.Y+margin, x+columnWidth, bounds.Max.Y-margin),
+			)
+		}
+	}
+
 	return nil
 }
 
+// buildMini lays out mini mode from the top down: the now playing text, the seek bar,
+// the time and a row of transport buttons
+func (r *Root) buildMini(context *guigui.Context, appender *guigui.ChildWidgetAppender) {
+	bounds := context.Bounds(r)
+	appSize := context.AppSize()
+
+	const margin int = 8
+	availableWidth := appSize.X - margin*2
+
+	const (
+		nowPlayingTextHeight = 30
+		seekBarHeight        = 12
+		timeTextHeight       = 20
+		buttonHeight         = 24
+	)
+	nowPlayingTextY := margin
+	seekBarY := nowPlayingTextY + nowPlayingTextHeight + margin
+	timeTextY := seekBarY + seekBarHeight + margin
+	buttonY := timeTextY + timeTextHeight + margin
+
+	// Now Playing Text
+	appender.AppendChildWidgetWithBounds(
+		&r.nowPlayingText,
+		image.Rect(bounds.Min.X+margin,
+			bounds.Min.Y+nowPlayingTextY,
+			bounds.Min.X+margin+availableWidth,
+			bounds.Min.Y+nowPlayingTextY+nowPlayingTextHeight,
+		),
+	)
+
+	// Seek Bar
+	appender.AppendChildWidgetWithBounds(
+		&r.seekBar,
+		image.Rect(bounds.Min.X+margin,
+			bounds.Min.Y+seekBarY,
+			bounds.Min.X+margin+availableWidth,
+			bounds.Min.Y+seekBarY+seekBarHeight,
+		),
+	)
+
+	// Time Text
+	appender.AppendChildWidgetWithBounds(
+		&r.timeText,
+		image.Rect(bounds.Min.X+margin,
+			bounds.Min.Y+timeTextY,
+			bounds.Min.X+margin+availableWidth,
+			bounds.Min.Y+timeTextY+timeTextHeight,
+		),
+	)
+
+	// Transport Buttons, sharing the row evenly
+	r.previousButton.SetText("Prev")
+	if r.player.GetState() == player.StateStopped || r.player.IsPaused() {
+		r.playButton.SetText("Play")
+	} else {
+		r.playButton.SetText("Pause")
+	}
+	r.stopButton.SetText("Stop")
+	r.nextButton.SetText("Next")
+	buttons := []*basicwidget.TextButton{&r.previousButton, &r.playButton, &r.stopButton, &r.nextButton}
+	buttonWidth := (availableWidth - margin*(len(buttons)-1)) / len(buttons)
+	for i, button := range buttons {
+		x := bounds.Min.X + margin + i*(buttonWidth+margin)
+		appender.AppendChildWidgetWithBounds(
+			button,
+			image.Rect(x, bounds.Min.Y+buttonY, x+buttonWidth, bounds.Min.Y+buttonY+buttonHeight),
+		)
+	}
+}
+
+// setMiniMode switches between the full window and mini mode, remembering the choice in the settings
+func (r *Root) setMiniMode(mini bool) {
+	r.miniMode = mini
+	r.applyWindowMode()
+}
+
+// applyWindowMode sizes the window for the current layout. The mini window floats over other windows,
+// so it stays visible on a second monitor.
+func (r *Root) applyWindowMode() {
+	if r.miniMode {
+		ebiten.SetWindowSize(MiniScreenWidth, MiniScreenHeight)
+	} else {
+		ebiten.SetWindowSize(ScreenWidth, ScreenHeight)
+	}
+	ebiten.SetWindowFloating(r.miniMode)
+}
+
+// togglePlayback toggles pause, or plays when stopped
+func (r *Root) togglePlayback() {
+	if r.player.GetState() == player.StateStopped {
+		if err := r.player.Play(); err != nil {
+			r.player.Logger().Error("Failed to play: %v", err)
+		}
+	} else {
+		r.player.TogglePause()
+	}
+}
+
+// skipToNext skips to the next track
+func (r *Root) skipToNext() {
+	if err := r.player.SkipToNext(); err != nil {
+		r.player.Logger().Error("Failed to skip to next track: %v", err)
+	}
+}
+
+// skipToRandom jumps to a random track
+func (r *Root) skipToRandom() {
+	if err := r.player.SkipToRandom(); err != nil {
+		r.player.Logger().Error("Failed to skip to a random track: %v", err)
+	}
+}
+
+// skipToPrevious skips to the previous track
+func (r *Root) skipToPrevious() {
+	if err := r.player.SkipToPrevious(); err != nil {
+		r.player.Logger().Error("Failed to skip to previous track: %v", err)
+	}
+}
+
+// usageInstructions returns how to add music files, for the first of the music directories
+func (r *Root) usageInstructions() string {
+	if len(r.musicDirs) == 0 {
+		return files.GetUsageInstructions()
+	}
+	return r.musicDirs[0].GetUsageInstructions()
+}
+
+// helpColumnText returns the text of a column of the help overlay.
+// The controls are taken from files.KeyBindings and split evenly between the columns.
+func (r *Root) helpColumnText(column int) string {
+	lines := []string{"Controls (H or Escape to close)", ""}
+	for _, binding := range files.KeyBindings {
+		lines = append(lines, binding.String())
+	}
+	perColumn := (len(lines) + len(r.helpColumns) - 1) / len(r.helpColumns)
+	start := min(column*perColumn, len(lines))
+	end := min(start+perColumn, len(lines))
+	return strings.Join(lines[start:end], "\n")
+}
+
 // Update updates the root widget
 func (r *Root) Update(context *guigui.Context) error {
 	// --- One-time Initialization ---
@@ -197,13 +674,100 @@ func (r *Root) Update(context *guigui.Context) error {
 	}
 
 	// --- Regular Update Logic ---
+	// The player measures time in updates, so it follows changes made with ebiten.SetTPS
+	r.player.SetTPS(ebiten.TPS())
+	r.player.SetWindowFocused(ebiten.IsFocused())
+
+	// Directory changes arrive on the watcher goroutine and are applied here, on the UI goroutine
+	if r.player.ApplyQueuedMusicFiles() {
+		r.updateMusicList(r.player.GetMusicFiles())
+	}
+	// Durations computed by the library summary show up in the rows as they arrive, and the
+	// order of a sort by duration once the missing durations are known
+	if r.player.GetDurationsVersion() != r.listDurationsVersion || r.player.GetSortVersion() != r.listSortVersion {
+		r.updateMusicList(r.player.GetMusicFiles())
+	}
+
 	// Access value types directly for reads/method calls
 	if err := r.player.Update(); err != nil {
 		return err
 	}
 
 	r.updateCurrentMusicState()
+	r.updateNote()
+	r.updateLibrarySummary()
+	r.updateReportExport()
+	r.updateTrackNumber()
+	r.saveSettingsIfChanged()
+
+	// Show which file failed to load, or else whether file watching is broken, or else whether the
+	// current track clipped, or else how it is converted for playback
+	if err := r.player.GetLastError(); err != nil {
+		r.warningText.SetText("Warning: " + err.Error())
+	} else if r.watcherHealthy != nil && !r.watcherHealthy() {
+		r.warningText.SetText("Warning: changes to the music directories aren't noticed until the watcher recovers")
+	} else if r.player.DidClip() {
+		r.warningText.SetText("CLIP: the current track reached full scale")
+	} else if warning := r.currentFormatWarning(); warning != "" {
+		r.warningText.SetText("Warning: " + warning)
+	} else {
+		r.warningText.SetText("")
+	}
+
+	shuffle := "Off"
+	if r.player.IsShuffleEnabled() {
+		shuffle = "On"
+	}
+	sort := r.player.GetSortMode().String()
+	if r.player.HasCustomOrder() {
+		sort = "Custom"
+	}
+	settings := fmt.Sprintf("Settings (Repeat: %s, Shuffle: %s, Sort: %s, Speed: x%.2f)", r.player.GetRepeatMode(), shuffle, sort, r.player.GetPlaybackSpeed())
+	if group := r.player.GetGroup(); group != "" {
+		settings += " GROUP " + group
+	}
+	if r.player.IsNormalizationEnabled() {
+		settings += fmt.Sprintf(" NORMALIZED (x%.2f)", r.player.GetTrackGain())
+	}
+	if !r.player.IsAutoAdvance() {
+		settings += " STOP AFTER TRACK"
+	}
+	if r.player.IsPauseOnFocusLoss() {
+		settings += " AUTO-PAUSE"
+	}
+	if r.player.IsAuditioningLoopSeam() {
+		settings += " SEAM AUDITION"
+	}
+	if compareTrack := r.player.GetCompareTrack(); compareTrack != "" {
+		side := "A"
+		if r.player.IsComparing() {
+			side = "B"
+		}
+		settings += fmt.Sprintf(" COMPARE %s (B: %s)", side, files.RelativeToMusicDir(compareTrack, r.musicDirs...))
+	}
+	if pan := r.player.GetPan(); pan < 0 {
+		settings += fmt.Sprintf(" PAN L%.0f", -pan*100)
+	} else if pan > 0 {
+		settings += fmt.Sprintf(" PAN R%.0f", pan*100)
+	}
+	if r.player.IsForceMono() {
+		settings += " MONO"
+	}
+	if r.player.IsMuted() {
+		settings += " MUTED"
+	}
+	if low, high := r.player.GetEQ(); low != 0 || high != 0 {
+		settings += fmt.Sprintf(" EQ L%+.0f H%+.0f", low, high)
+		if !r.player.IsEQEnabled() {
+			settings += " (BYPASSED)"
+		}
+	}
+	if tone, ok := r.player.GetTestTone(); ok {
+		settings += " TEST TONE " + tone
+	}
+	r.settingsText.SetText(settings)
 
+	r.volumeSlider.SetValue(r.player.GetMasterVolume() * 100)
 	r.loopDurationSlider.SetValue(float64(r.player.GetLoopDurationMinutes()))
 	r.intervalSlider.SetValue(float64(r.player.GetIntervalSeconds()))
 
@@ -214,26 +778,47 @@ func (r *Root) Update(context *guigui.Context) error {
 func (r *Root) updateCurrentMusicState() {
 	currentPath := r.player.GetCurrentPath()
 	if currentPath != "" {
-		relPath := currentPath
-		if strings.HasPrefix(relPath, "musics/") || strings.HasPrefix(relPath, "musics\\") {
-			relPath = relPath[len("musics/"):]
-		}
+		relPath := files.RelativeToMusicDir(currentPath, r.musicDirs...)
 		statusText := "Now Playing: " + relPath
 		if r.player.IsPaused() {
 			statusText = "PAUSED: " + relPath
+		} else if r.player.GetState() == player.StateStopped {
+			statusText = "STOPPED: " + relPath
+		} else if r.player.GetState() == player.StateLoading {
+			statusText = "LOADING " + loadingSpinner[r.loadingFrames/loadingSpinnerFrames%len(loadingSpinner)] + " " + relPath
 		}
 		r.nowPlayingText.SetText(statusText) // Call method on value
 
-		// 選択状態の更新はここでは行わない (無限ループの原因)
-		// currentIndex := r.player.GetCurrentIndex()
-		// r.musicList.SetSelectedItemIndex(currentIndex)
+		// Follow the player, e.g. when it advances to the next track after the interval
+		r.selectCurrentTrack()
 	} else {
-		r.nowPlayingText.SetText("No track playing. Locate music files in musics/ directory.")
+		dirs := make([]string, 0, len(r.musicDirs))
+		for _, dir := range r.musicDirs {
+			dirs = append(dirs, dir.Path())
+		}
+		r.nowPlayingText.SetText(fmt.Sprintf("No track playing. Locate music files in %s directory.", strings.Join(dirs, ", ")))
+	}
+
+	// The seek bar shows the elapsed part of the loop duration
+	loopDuration := time.Duration(r.player.GetLoopDurationMinutes() * float64(time.Minute))
+	switch r.player.GetState() {
+	case player.StatePlaying:
+		r.seekBar.SetValue(float64(r.player.GetElapsed()) / float64(loopDuration))
+	case player.StateFadingOut, player.StateInterval:
+		r.seekBar.SetValue(1)
+	default:
+		r.seekBar.SetValue(0)
 	}
+	r.seekBar.SetSeekable(r.player.GetState() != player.StateStopped && r.player.GetState() != player.StateLoading)
+
+	peak, _ := r.player.GetCurrentLevels()
+	r.vuMeter.SetLevel(peak)
+
+	r.updateWaveform(currentPath)
 
 	switch r.player.GetState() {
 	case player.StatePlaying:
-		currentTimeSec := r.player.GetCounter() / 60
+		currentTimeSec := int(r.player.GetPlaybackPosition().Seconds())
 		totalTimeSec := int(r.player.GetLoopDurationMinutes() * 60)
 		r.timeText.SetText(fmt.Sprintf("%d:%02d / %d:%02d",
 			currentTimeSec/60, currentTimeSec%60,
@@ -241,27 +826,207 @@ func (r *Root) updateCurrentMusicState() {
 	case player.StateFadingOut:
 		r.timeText.SetText("Fading out...")
 	case player.StateInterval:
-		intervalSec := (int(r.player.GetIntervalSeconds())*60 - r.player.GetCounter()) / 60
+		intervalSec := int(r.player.GetRemainingInterval().Seconds())
 		r.timeText.SetText(fmt.Sprintf("Next track in: %d seconds", intervalSec))
+	case player.StateLoading:
+		r.loadingFrames++
+		r.timeText.SetText("Decoding...")
 	default:
 		r.timeText.SetText("")
 	}
 }
 
+// updateNote shows the note of the current track when the track changes
+func (r *Root) updateNote() {
+	currentPath := r.player.GetCurrentPath()
+	if currentPath == r.notePath {
+		return
+	}
+	// notePath is switched first so the OnChange callback stores into the new track's note
+	r.notePath = currentPath
+	r.noteInput.SetFocused(false)
+	r.noteInput.SetText(r.player.GetNote(currentPath))
+}
+
+// currentFormatWarning returns the format warning of the current track, probing it only when the track changes
+func (r *Root) currentFormatWarning() string {
+	currentPath := r.player.GetCurrentPath()
+	if currentPath != r.formatWarningPath {
+		r.formatWarningPath = currentPath
+		r.formatWarning = ""
+		if currentPath != "" {
+			r.formatWarning = r.player.FormatWarning(currentPath)
+		}
+	}
+	return r.formatWarning
+}
+
+// startReportExport starts writing the review report into the working directory in the background
+func (r *Root) startReportExport(format player.ReportFormat) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.reportExport = r.player.ExportReportFileInBackground(ctx, ".", format, time.Now())
+	r.cancelReportExport = cancel
+	r.player.Logger().Info("Exporting review report as %s...", format)
+}
+
+// updateReportExport shows the outcome of the review report in the banner once it is written
+func (r *Root) updateReportExport() {
+	if r.reportExport == nil {
+		return
+	}
+	var result player.ReportExportResult
+	select {
+	case result = <-r.reportExport:
+	default:
+		return
+	}
+	r.cancelReportExport()
+	r.reportExport = nil
+	r.cancelReportExport = nil
+
+	if result.Err != nil {
+		r.player.Logger().Error("Failed to export report: %v", result.Err)
+		r.AddWarning("Failed to export report: " + result.Err.Error())
+		return
+	}
+	r.player.Logger().Info("Exported review report to %s", result.Path)
+	r.AddWarning("Exported review report to " + result.Path)
+}
+
+// updateLibrarySummary shows the number of tracks and their total duration, e.g. "42 tracks, 1h 13m total".
+// The total grows as durations are computed in the background.
+func (r *Root) updateLibrarySummary() {
+	count, total := r.player.GetLibrarySummary()
+	tracks := "tracks"
+	if count == 1 {
+		tracks = "track"
+	}
+	sec := int(total.Seconds())
+	length := fmt.Sprintf("%dm %ds", sec/60, sec%60)
+	if sec >= 3600 {
+		length = fmt.Sprintf("%dh %dm", sec/3600, sec%3600/60)
+	}
+	r.librarySummaryText.SetText(fmt.Sprintf("%d %s, %s total", count, tracks, length))
+}
+
+// updateWaveform shows the waveform of the current track, once it has been computed in the background.
+func (r *Root) updateWaveform(currentPath string) {
+	if currentPath == "" {
+		r.waveform.SetPeaks(nil)
+		r.waveform.SetPosition(0)
+		r.waveform.SetLoopRegion(0, 0)
+		return
+	}
+
+	if peaks, ok := r.player.GetWaveform(currentPath, waveformBuckets); ok {
+		r.waveform.SetPeaks(peaks)
+	} else {
+		r.waveform.SetPeaks(nil)
+	}
+
+	// The duration comes from the decode of the waveform, so nothing is decoded here
+	duration, ok := r.player.GetCachedDuration(currentPath)
+	if !ok || duration <= 0 {
+		r.waveform.SetPosition(0)
+		r.waveform.SetLoopRegion(0, 0)
+		return
+	}
+	r.waveform.SetPosition(float64(r.player.GetTrackPosition()) / float64(duration))
+
+	// Follows A-B region changes as they are made
+	if start, end, ok := r.player.GetLoopBody(); ok {
+		r.waveform.SetLoopRegion(float64(start)/float64(duration), float64(end)/float64(duration))
+	} else {
+		r.waveform.SetLoopRegion(0, 0)
+	}
+}
+
+// saveSettingsIfChanged saves the settings once they have stopped changing,
+// so dragging a slider doesn't write the file every frame.
+func (r *Root) saveSettingsIfChanged() {
+	if r.settingsPath == "" {
+		return
+	}
+
+	current := r.Settings()
+	if current.Equal(r.savedSettings) {
+		r.pendingSettings = current
+		r.settingsChangedFrames = 0
+		return
+	}
+	if !current.Equal(r.pendingSettings) {
+		r.pendingSettings = current
+		r.settingsChangedFrames = 0
+		return
+	}
+
+	r.settingsChangedFrames++
+	if r.settingsChangedFrames < settingsSaveDelayFrames {
+		return
+	}
+	if err := player.SaveSettings(r.settingsPath, current); err != nil {
+		r.player.Logger().Error("Failed to save settings: %v", err)
+	}
+	r.savedSettings = current
+}
+
 // initialize performs the one-time setup for the root widget.
 // This should be called only once from Update.
 func (r *Root) initialize() {
 	// Configure List OnItemSelected callback
+	// The list may be filtered, so the selected item is looked up in the full list by its path
 	r.musicList.SetOnItemSelected(func(index int) {
-		musicFiles := r.player.GetMusicFiles()
-		if index >= 0 && index < len(musicFiles) {
-			if err := r.player.SetCurrentIndex(index); err != nil {
-				log.Printf("Failed to set current index: %v", err)
-			}
+		if r.syncingSelection {
+			return
+		}
+		r.playListItem(index)
+	})
+	r.musicList.SetOnItemDropped(r.onItemDropped)
+
+	// Dismiss every warning in the banner
+	r.bannerButton.SetOnUp(func() {
+		r.warnings = nil
+	})
+
+	// Transport buttons of mini mode
+	r.previousButton.SetOnUp(r.skipToPrevious)
+	r.playButton.SetOnUp(r.togglePlayback)
+	r.stopButton.SetOnUp(func() {
+		if err := r.player.Stop(); err != nil {
+			r.player.Logger().Error("Failed to stop: %v", err)
+		}
+	})
+	r.nextButton.SetOnUp(r.skipToNext)
+
+	// Restore the window size of the mini mode remembered in the settings
+	if r.miniMode {
+		r.applyWindowMode()
+	}
+
+	// Refilter the list as the filter text changes
+	r.filterInput.SetOnChange(func(string) {
+		r.updateMusicList(r.player.GetMusicFiles())
+	})
+
+	// Store the note as it is typed
+	r.noteInput.SetOnChange(func(text string) {
+		r.player.SetNote(r.notePath, text)
+	})
+
+	// Configure seek bar callback
+	r.seekBar.SetOnSeek(func(ratio float64) {
+		loopDuration := time.Duration(r.player.GetLoopDurationMinutes() * float64(time.Minute))
+		if err := r.player.Seek(time.Duration(ratio * float64(loopDuration))); err != nil {
+			r.player.Logger().Error("Failed to seek: %v", err)
 		}
 	})
 
 	// Set initial slider values and configure callbacks
+	r.volumeSlider.SetValue(r.player.GetMasterVolume() * 100)
+	r.volumeSlider.SetOnChange(func(value float64) {
+		r.player.SetMasterVolume(value / 100)
+	})
+
 	r.loopDurationSlider.SetValue(float64(r.player.GetLoopDurationMinutes()))
 	r.loopDurationSlider.SetOnChange(func(value float64) {
 		r.player.SetLoopDurationMinutes(value)
@@ -276,20 +1041,47 @@ func (r *Root) initialize() {
 	r.updateMusicList(r.player.GetMusicFiles())
 }
 
-// updateMusicList updates the music list widget
-// Called by HandleFileChanges and initialize
+// updateMusicList updates the music list widget, showing only the files matching the filter text
+// Called by HandleFileChanges, initialize and the filter input
 func (r *Root) updateMusicList(musicFiles []string) {
+	r.listDurationsVersion = r.player.GetDurationsVersion()
+	r.listSortVersion = r.player.GetSortVersion()
+
 	// Access value type directly
 	listItems := make([]basicwidget.TextListItem[string], 0, len(musicFiles))
+	filter := strings.ToLower(r.filterInput.Text())
+
+	for i, path := range musicFiles {
+		relPath := files.RelativeToMusicDir(path, r.musicDirs...)
+		if !strings.Contains(strings.ToLower(relPath), filter) {
+			continue
+		}
 
-	for _, path := range musicFiles {
-		relPath := path
-		if strings.HasPrefix(path, "musics/") || strings.HasPrefix(path, "musics\\") {
-			relPath = path[len("musics/"):]
+		// Prefer "Artist - Title" from tags and append the track length once it is known.
+		// Only cached durations are shown, since computing one decodes the whole file;
+		// the library summary computes the others in the background.
+		text := relPath
+		if metadata, err := r.player.GetMetadata(path); err == nil && metadata.Artist != "" {
+			text = metadata.DisplayName()
+		}
+		if duration, ok := r.player.GetCachedDuration(path); ok && duration > 0 {
+			sec := int(duration.Seconds())
+			text = fmt.Sprintf("%s (%d:%02d)", text, sec/60, sec%60)
+		}
+
+		// Tagged with the format by extension, e.g. "[WAV]", to spot strays in a mixed library
+		if format := files.FormatFromExtension(path); format != files.FormatUnknown {
+			text = fmt.Sprintf("%s [%s]", text, strings.ToUpper(format.String()))
+		}
+
+		// Numbered in player order, even when filtered, for jumping to a track by number
+		text = fmt.Sprintf("%d. %s", i+1, text)
+		if r.player.IsFavorite(path) {
+			text = "* " + text
 		}
 
 		item := basicwidget.TextListItem[string]{
-			Text: relPath, // ListItem still needs a Widget (pointer)
+			Text: text, // ListItem still needs a Widget (pointer)
 			Tag:  path,
 		}
 		listItems = append(listItems, item)
@@ -298,13 +1090,90 @@ func (r *Root) updateMusicList(musicFiles []string) {
 	// Call method on value type
 	r.musicList.SetItems(listItems)
 
-	// 現在再生中の曲のインデックスを選択状態にする
-	currentIndex := r.player.GetCurrentIndex()
-	if currentIndex >= 0 && currentIndex < len(musicFiles) {
-		r.musicList.SelectItemByIndex(currentIndex)
+	// 現在再生中の曲を選択状態にする
+	r.selectCurrentTrack()
+}
+
+// selectCurrentTrack selects the row of the current track without treating it as the user's choice.
+// Selecting a row calls OnItemSelected, which would otherwise reload the track.
+// The row is looked up by path, so the selection follows the track when a rescan reorders the list,
+// and is cleared when the track isn't listed.
+func (r *Root) selectCurrentTrack() {
+	// A focused track whose file is gone can't be played with Enter; the selection follows the player again
+	if r.focusedPath != "" && !slices.Contains(r.player.GetMusicFiles(), r.focusedPath) {
+		r.focusedPath = ""
+	}
+
+	currentPath := r.player.GetCurrentPath()
+	if r.focusedPath != "" {
+		currentPath = r.focusedPath
+	}
+	r.syncingSelection = true
+	defer func() { r.syncingSelection = false }()
+	if currentPath == "" {
+		r.musicList.SelectItemByIndex(-1)
+		return
+	}
+	r.musicList.SelectItemByTag(currentPath)
+}
+
+// playListItem plays the track in the given row of the list.
+// The list may be filtered, so the track is looked up in the full list by its path.
+func (r *Root) playListItem(index int) {
+	item, ok := r.musicList.ItemByIndex(index)
+	if !ok {
+		return
+	}
+	for i, path := range r.player.GetMusicFiles() {
+		if path == item.Tag {
+			if err := r.player.SetCurrentIndex(i); err != nil {
+				r.player.Logger().Error("Failed to set current index: %v", err)
+			}
+			return
+		}
 	}
 }
 
+// handleListNavigation moves the highlighted row with the arrow keys and plays it with Enter,
+// while the music list has focus. It returns whether a key was handled.
+func (r *Root) handleListNavigation(context *guigui.Context) bool {
+	if !context.HasFocusedChildWidget(&r.musicList) {
+		// The selection follows the player again once the list loses focus
+		r.focusedPath = ""
+		return false
+	}
+
+	step := 0
+	if widgets.IsKeyRepeated(ebiten.KeyArrowUp) {
+		step = -1
+	} else if widgets.IsKeyRepeated(ebiten.KeyArrowDown) {
+		step = 1
+	}
+	if step != 0 {
+		count := r.musicList.ItemsCount()
+		if count == 0 {
+			return true
+		}
+		index := max(0, min(count-1, r.musicList.SelectedItemIndex()+step))
+		item, _ := r.musicList.ItemByIndex(index)
+		r.focusedPath = item.Tag
+		r.selectCurrentTrack()
+		r.musicList.JumpToItemIndex(index)
+		return true
+	}
+
+	if r.focusedPath != "" && (inpututil.IsKeyJustPressed(ebiten.KeyEnter) || inpututil.IsKeyJustPressed(ebiten.KeyNumpadEnter)) {
+		r.focusedPath = ""
+		r.playListItem(r.musicList.SelectedItemIndex())
+		return true
+	}
+	if r.focusedPath != "" && inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		r.focusedPath = ""
+		return true
+	}
+	return false
+}
+
 // CursorShape returns the cursor shape for this widget
 func (r *Root) CursorShape(context *guigui.Context) (ebiten.CursorShapeType, bool) {
 	return ebiten.CursorShapeDefault, true
@@ -312,29 +1181,376 @@ func (r *Root) CursorShape(context *guigui.Context) (ebiten.CursorShapeType, boo
 
 // HandleInput handles global key presses
 func (r *Root) HandleInput(context *guigui.Context) guigui.HandleInputResult {
-	// Space key to toggle pause
+	// Keys are typed into the filter or the note while it has focus
+	if r.filterInput.IsFocused() || r.noteInput.IsFocused() {
+		return guigui.HandleInputResult{}
+	}
+
+	// H or ? to toggle the list of controls, Escape to close it
+	if inpututil.IsKeyJustPressed(ebiten.KeyH) || (inpututil.IsKeyJustPressed(ebiten.KeySlash) && ebiten.IsKeyPressed(ebiten.KeyShift)) {
+		r.showHelp = !r.showHelp
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+	if r.showHelp && inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		r.showHelp = false
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// W key to switch between the full window and mini mode
+	if inpututil.IsKeyJustPressed(ebiten.KeyW) {
+		r.setMiniMode(!r.miniMode)
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// Digit keys followed by Enter to jump to a track by number
+	if r.handleTrackNumberInput() {
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// Up and down arrow keys to move through the music list while it has focus, Enter to play
+	if !ebiten.IsKeyPressed(ebiten.KeyAlt) && r.handleListNavigation(context) {
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// Space key to toggle pause, or to play when stopped
 	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
-		r.player.TogglePause()
+		r.togglePlayback()
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// X key to stop and rewind, or to play when stopped
+	if inpututil.IsKeyJustPressed(ebiten.KeyX) {
+		if r.player.GetState() == player.StateStopped {
+			if err := r.player.Play(); err != nil {
+				r.player.Logger().Error("Failed to play: %v", err)
+			}
+		} else if err := r.player.Stop(); err != nil {
+			r.player.Logger().Error("Failed to stop: %v", err)
+		}
 		return guigui.HandleInputByWidget(r) // Input handled by this widget
 	}
 
 	// N key to skip to next track
 	if inpututil.IsKeyJustPressed(ebiten.KeyN) {
-		if err := r.player.SkipToNext(); err != nil {
-			log.Printf("Failed to skip to next track: %v", err)
+		r.skipToNext()
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// J key to jump to a random track
+	if inpututil.IsKeyJustPressed(ebiten.KeyJ) {
+		r.skipToRandom()
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// I key to skip the rest of the fade-out and interval
+	if inpututil.IsKeyJustPressed(ebiten.KeyI) {
+		if err := r.player.SkipInterval(); err != nil {
+			r.player.Logger().Error("Failed to skip interval: %v", err)
 		}
 		return guigui.HandleInputByWidget(r) // Input handled by this widget
 	}
 
+	// P key to skip to previous track
+	if inpututil.IsKeyJustPressed(ebiten.KeyP) {
+		r.skipToPrevious()
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// Shift+R to toggle whether a finished track is followed by the next
+	if inpututil.IsKeyJustPressed(ebiten.KeyR) && ebiten.IsKeyPressed(ebiten.KeyShift) {
+		r.player.SetAutoAdvance(!r.player.IsAutoAdvance())
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// A and Z keys to cut the low and high shelf of the preview EQ, with Shift to boost them
+	if inpututil.IsKeyJustPressed(ebiten.KeyA) || inpututil.IsKeyJustPressed(ebiten.KeyZ) {
+		step := -eqStepDB
+		if ebiten.IsKeyPressed(ebiten.KeyShift) {
+			step = eqStepDB
+		}
+		low, high := r.player.GetEQ()
+		if inpututil.IsKeyJustPressed(ebiten.KeyA) {
+			low += step
+		} else {
+			high += step
+		}
+		r.player.SetEQ(low, high)
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// Q key to bypass the preview EQ, to compare the track with and without it
+	if inpututil.IsKeyJustPressed(ebiten.KeyQ) {
+		r.player.SetEQEnabled(!r.player.IsEQEnabled())
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// T key to play the reference tone for calibrating the monitoring level, or stop it
+	if inpututil.IsKeyJustPressed(ebiten.KeyT) {
+		if _, ok := r.player.GetTestTone(); ok {
+			r.player.StopTestTone()
+		} else if err := r.player.PlayTestTone(player.DefaultTestToneFrequency, player.DefaultTestToneLevel); err != nil {
+			r.player.Logger().Error("Failed to play the test tone: %v", err)
+		}
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// D key to cycle loop duration presets; the slider follows the new value
+	if inpututil.IsKeyJustPressed(ebiten.KeyD) {
+		r.player.CycleLoopPreset()
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// R key to cycle repeat mode
+	if inpututil.IsKeyJustPressed(ebiten.KeyR) {
+		r.player.SetRepeatMode(r.player.GetRepeatMode().Next())
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// S key to toggle shuffle
+	if inpututil.IsKeyJustPressed(ebiten.KeyS) {
+		r.player.SetShuffleEnabled(!r.player.IsShuffleEnabled())
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// Shift+M to fold playback to mono, to check the track collapses well
+	if inpututil.IsKeyJustPressed(ebiten.KeyM) && ebiten.IsKeyPressed(ebiten.KeyShift) {
+		r.player.SetForceMono(!r.player.IsForceMono())
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// , and . keys to pan playback left and right
+	if inpututil.IsKeyJustPressed(ebiten.KeyComma) {
+		r.player.SetPan(r.player.GetPan() - panStep)
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyPeriod) {
+		r.player.SetPan(r.player.GetPan() + panStep)
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// M key to toggle mute
+	if inpututil.IsKeyJustPressed(ebiten.KeyM) {
+		r.player.ToggleMute()
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// U key to toggle pausing while the window is unfocused
+	if inpututil.IsKeyJustPressed(ebiten.KeyU) {
+		r.player.SetPauseOnFocusLoss(!r.player.IsPauseOnFocusLoss())
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// Shift+F to flag the current track as a favorite
+	if inpututil.IsKeyJustPressed(ebiten.KeyF) && ebiten.IsKeyPressed(ebiten.KeyShift) {
+		if currentPath := r.player.GetCurrentPath(); currentPath != "" {
+			r.player.ToggleFavorite(currentPath)
+			r.updateMusicList(r.player.GetMusicFiles())
+		}
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// L key to toggle auditioning the loop seam of the current track
+	if inpututil.IsKeyJustPressed(ebiten.KeyL) {
+		if r.player.IsAuditioningLoopSeam() {
+			r.player.ClearLoopRegion()
+		} else if err := r.player.AuditionLoopSeam(); err != nil {
+			r.player.Logger().Error("Failed to audition loop seam: %v", err)
+		}
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// E to export the review report as CSV, Shift+E as JSON, into the working directory.
+	// It is written in the background; E again before it is done cancels it.
+	if inpututil.IsKeyJustPressed(ebiten.KeyE) {
+		if r.cancelReportExport != nil {
+			r.cancelReportExport()
+		} else {
+			format := player.ReportCSV
+			if ebiten.IsKeyPressed(ebiten.KeyShift) {
+				format = player.ReportJSON
+			}
+			r.startReportExport(format)
+		}
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// Shift+C to mark the current track for comparison, C to switch between it and the selected track
+	if inpututil.IsKeyJustPressed(ebiten.KeyC) {
+		if ebiten.IsKeyPressed(ebiten.KeyShift) {
+			if err := r.player.SetCompareTrack(r.player.GetCurrentPath()); err != nil {
+				r.player.Logger().Error("Failed to set compare track: %v", err)
+			}
+		} else if err := r.player.ToggleCompare(); err != nil {
+			r.player.Logger().Error("Failed to toggle compare track: %v", err)
+		}
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// B key to go back to the previously played track, even when shuffled
+	if inpututil.IsKeyJustPressed(ebiten.KeyB) {
+		if err := r.player.GoBackInHistory(); err != nil {
+			r.player.Logger().Error("Failed to go back in history: %v", err)
+		}
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// Shift+G to limit the list to the next subdirectory of the music directory
+	if inpututil.IsKeyJustPressed(ebiten.KeyG) && ebiten.IsKeyPressed(ebiten.KeyShift) {
+		if err := r.player.CycleGroup(); err != nil {
+			r.player.Logger().Error("Failed to change group: %v", err)
+		}
+		r.updateMusicList(r.player.GetMusicFiles())
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// G key to toggle volume normalization
+	if inpututil.IsKeyJustPressed(ebiten.KeyG) {
+		r.player.SetNormalizationEnabled(!r.player.IsNormalizationEnabled())
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// F key to show the current track in the file manager
+	if inpututil.IsKeyJustPressed(ebiten.KeyF) {
+		if currentPath := r.player.GetCurrentPath(); currentPath != "" {
+			if err := files.OpenInFileManager(currentPath); err != nil {
+				r.player.Logger().Error("Failed to open file manager: %v", err)
+			}
+		}
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// O key to cycle the sort order of the list
+	if inpututil.IsKeyJustPressed(ebiten.KeyO) {
+		r.player.SetSortMode(r.player.GetSortMode().Next())
+		r.updateMusicList(r.player.GetMusicFiles())
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
+	// Alt+Up and Alt+Down to move the current track within the list
+	if ebiten.IsKeyPressed(ebiten.KeyAlt) {
+		if current := r.player.GetCurrentIndex(); current >= 0 {
+			if widgets.IsKeyRepeated(ebiten.KeyArrowUp) {
+				r.onReorder(current, current-1)
+				return guigui.HandleInputByWidget(r) // Input handled by this widget
+			}
+			if widgets.IsKeyRepeated(ebiten.KeyArrowDown) {
+				r.onReorder(current, current+1)
+				return guigui.HandleInputByWidget(r) // Input handled by this widget
+			}
+		}
+	}
+
+	// Up and down arrow keys to change volume, repeating while held.
+	// They are left to the music list while it has focus.
+	if !context.HasFocusedChildWidget(&r.musicList) {
+		if widgets.IsKeyRepeated(ebiten.KeyArrowUp) {
+			r.player.SetMasterVolume(r.player.GetMasterVolume() + volumeStep)
+			r.volumeSlider.SetValue(r.player.GetMasterVolume() * 100)
+			return guigui.HandleInputByWidget(r) // Input handled by this widget
+		}
+		if widgets.IsKeyRepeated(ebiten.KeyArrowDown) {
+			r.player.SetMasterVolume(r.player.GetMasterVolume() - volumeStep)
+			r.volumeSlider.SetValue(r.player.GetMasterVolume() * 100)
+			return guigui.HandleInputByWidget(r) // Input handled by this widget
+		}
+	}
+
+	// [ and ] keys to change playback speed
+	if inpututil.IsKeyJustPressed(ebiten.KeyBracketLeft) {
+		r.player.SetPlaybackSpeed(r.player.GetPlaybackSpeed() - playbackSpeedStep)
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyBracketRight) {
+		r.player.SetPlaybackSpeed(r.player.GetPlaybackSpeed() + playbackSpeedStep)
+		return guigui.HandleInputByWidget(r) // Input handled by this widget
+	}
+
 	// If not handled, return zero value to let guigui propagate to children
 	return guigui.HandleInputResult{}
 }
 
+// handleTrackNumberInput collects a typed track number and jumps to it on Enter.
+// It returns whether the input was handled.
+func (r *Root) handleTrackNumberInput() bool {
+	for i := 0; i <= 9; i++ {
+		if inpututil.IsKeyJustPressed(ebiten.KeyDigit0+ebiten.Key(i)) || inpututil.IsKeyJustPressed(ebiten.KeyNumpad0+ebiten.Key(i)) {
+			r.trackNumber += strconv.Itoa(i)
+			r.trackNumberFrames = 0
+			return true
+		}
+	}
+
+	if r.trackNumber == "" {
+		return false
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		r.trackNumber = ""
+		return true
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) || inpututil.IsKeyJustPressed(ebiten.KeyNumpadEnter) {
+		// Out of range numbers are reported by SetCurrentIndex and ignored
+		if n, err := strconv.Atoi(r.trackNumber); err != nil {
+			r.player.Logger().Error("Invalid track number %q: %v", r.trackNumber, err)
+		} else if err := r.player.SetCurrentIndex(n - 1); err != nil {
+			r.player.Logger().Error("Failed to jump to track %d: %v", n, err)
+		}
+		r.trackNumber = ""
+		return true
+	}
+	return false
+}
+
+// updateTrackNumber discards a typed track number after a while and shows it while it is pending.
+func (r *Root) updateTrackNumber() {
+	if r.trackNumber == "" {
+		return
+	}
+	r.trackNumberFrames++
+	if r.trackNumberFrames >= trackNumberTimeoutFrames {
+		r.trackNumber = ""
+		return
+	}
+	r.timeText.SetText(fmt.Sprintf("Go to track: %s (Enter to play, %d tracks)", r.trackNumber, len(r.player.GetMusicFiles())))
+}
+
+// onItemDropped moves a track dragged to a new row of the list.
+// The list may be filtered, so the rows are looked up in the full list by their paths:
+// the track takes the place of the track in the row it was dropped on.
+func (r *Root) onItemDropped(from, to int) {
+	fromItem, ok := r.musicList.ItemByIndex(from)
+	if !ok {
+		return
+	}
+	toItem, ok := r.musicList.ItemByIndex(to)
+	if !ok {
+		return
+	}
+	musicFiles := r.player.GetMusicFiles()
+	fromIndex := slices.Index(musicFiles, fromItem.Tag)
+	toIndex := slices.Index(musicFiles, toItem.Tag)
+	if fromIndex < 0 || toIndex < 0 {
+		return
+	}
+	r.onReorder(fromIndex, toIndex)
+}
+
+// onReorder moves a track within the list, from and to being indexes in the player's order.
+// Moves past either end of the list are ignored.
+func (r *Root) onReorder(from, to int) {
+	if to < 0 || to >= len(r.player.GetMusicFiles()) {
+		return
+	}
+	if err := r.player.MoveTrack(from, to); err != nil {
+		r.player.Logger().Error("Failed to move track: %v", err)
+		return
+	}
+	r.updateMusicList(r.player.GetMusicFiles())
+}
+
 // HandleFileChanges is the event handler for directory changes.
+// It is called on the watcher goroutine, so the files are only queued for the player;
+// Update applies them and refreshes the list on the UI goroutine.
 func (r *Root) HandleFileChanges(musicFiles []string) {
-	// Update the music list UI
-	r.updateMusicList(musicFiles)
-
-	// Request redraw or relayout if needed (might be handled by guigui automatically)
-	// guigui.RequestLayout(r)
+	r.player.QueueMusicFiles(musicFiles)
 }
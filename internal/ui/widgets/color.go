@@ -1,13 +1,88 @@
 package widgets
 
 import (
+	"fmt"
 	"image/color"
+
+	"github.com/hajimehoshi/guigui"
 )
 
-// Colors returns the default colors for the UI
+// Theme is the set of colors used to draw the UI
+type Theme struct {
+	// ColorMode is the guigui color mode, which styles the basicwidget widgets to match
+	ColorMode guigui.ColorMode
+
+	Text          color.Color
+	Background    color.Color
+	Highlight     color.Color
+	Accent        color.Color // Progress and focused borders
+	Disabled      color.Color // Read-only progress
+	Placeholder   color.Color
+	Border        color.Color
+	SliderTrack   color.Color
+	SliderHandle  color.Color
+	ProgressTrack color.Color
+}
+
+// DarkTheme returns the default dark theme
+func DarkTheme() Theme {
+	return Theme{
+		ColorMode:     guigui.ColorModeDark,
+		Text:          color.White,
+		Background:    color.Black,
+		Highlight:     color.RGBA{R: 0x33, G: 0x33, B: 0x33, A: 0xFF},
+		Accent:        color.RGBA{0, 200, 100, 255},
+		Disabled:      color.RGBA{160, 160, 160, 255},
+		Placeholder:   color.RGBA{128, 128, 128, 255},
+		Border:        color.RGBA{150, 150, 150, 255},
+		SliderTrack:   color.RGBA{200, 200, 200, 255},
+		SliderHandle:  color.RGBA{100, 100, 100, 255},
+		ProgressTrack: color.RGBA{100, 100, 100, 255},
+	}
+}
+
+// LightTheme returns a light theme
+func LightTheme() Theme {
+	return Theme{
+		ColorMode:     guigui.ColorModeLight,
+		Text:          color.Black,
+		Background:    color.White,
+		Highlight:     color.RGBA{R: 0xDD, G: 0xDD, B: 0xDD, A: 0xFF},
+		Accent:        color.RGBA{0, 150, 75, 255},
+		Disabled:      color.RGBA{140, 140, 140, 255},
+		Placeholder:   color.RGBA{150, 150, 150, 255},
+		Border:        color.RGBA{120, 120, 120, 255},
+		SliderTrack:   color.RGBA{210, 210, 210, 255},
+		SliderHandle:  color.RGBA{90, 90, 90, 255},
+		ProgressTrack: color.RGBA{210, 210, 210, 255},
+	}
+}
+
+// ThemeByName returns the theme with the given name ("dark" or "light")
+func ThemeByName(name string) (Theme, error) {
+	switch name {
+	case "dark":
+		return DarkTheme(), nil
+	case "light":
+		return LightTheme(), nil
+	default:
+		return Theme{}, fmt.Errorf("unknown theme: %s", name)
+	}
+}
+
+var currentTheme = DarkTheme()
+
+// SetTheme sets the theme used by all widgets
+func SetTheme(theme Theme) {
+	currentTheme = theme
+}
+
+// CurrentTheme returns the theme used by all widgets
+func CurrentTheme() Theme {
+	return currentTheme
+}
+
+// Colors returns the text, background and highlight colors of the current theme
 func Colors() (text, background, highlight color.Color) {
-	text = color.White
-	background = color.Black
-	highlight = color.RGBA{R: 0x33, G: 0x33, B: 0x33, A: 0xFF}
-	return
+	return currentTheme.Text, currentTheme.Background, currentTheme.Highlight
 }
@@ -0,0 +1,39 @@
+package widgets_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"musicplayer/internal/ui/widgets"
+)
+
+// TestSetTheme changes the package-level theme, so it doesn't run in parallel
+func TestSetTheme(t *testing.T) {
+	defer widgets.SetTheme(widgets.DarkTheme())
+
+	text, background, highlight := widgets.Colors()
+	dark := widgets.DarkTheme()
+	assert.Equal(t, dark.Text, text, "dark theme should be the default")
+	assert.Equal(t, dark.Background, background)
+	assert.Equal(t, dark.Highlight, highlight)
+
+	light := widgets.LightTheme()
+	widgets.SetTheme(light)
+	text, background, highlight = widgets.Colors()
+	assert.Equal(t, light.Text, text)
+	assert.Equal(t, light.Background, background)
+	assert.Equal(t, light.Highlight, highlight)
+	assert.Equal(t, light, widgets.CurrentTheme())
+}
+
+func TestThemeByName(t *testing.T) {
+	t.Parallel()
+
+	theme, err := widgets.ThemeByName("light")
+	assert.NoError(t, err)
+	assert.Equal(t, widgets.LightTheme(), theme)
+
+	_, err = widgets.ThemeByName("sepia")
+	assert.Error(t, err)
+}
@@ -0,0 +1,22 @@
+package widgets
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+const (
+	// keyRepeatDelay is the number of frames a key must be held before it repeats
+	keyRepeatDelay = 30
+	// keyRepeatInterval is the number of frames between repeats while a key is held
+	keyRepeatInterval = 4
+)
+
+// IsKeyRepeated reports whether the key was just pressed or is repeating while held.
+func IsKeyRepeated(key ebiten.Key) bool {
+	d := inpututil.KeyPressDuration(key)
+	if d == 1 {
+		return true
+	}
+	return d >= keyRepeatDelay && (d-keyRepeatDelay)%keyRepeatInterval == 0
+}
@@ -1,20 +1,22 @@
 package widgets
 
 import (
-	"image/color"
-
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/vector"
 	"github.com/hajimehoshi/guigui"
 )
 
-// ProgressBar is a custom widget for displaying progress
+// ProgressBar is a custom widget for displaying progress.
+// When seekable, clicking it reports the clicked position through the OnSeek callback.
 type ProgressBar struct {
 	guigui.DefaultWidget
 
-	value  float64
-	width  int
-	height int
+	value    float64
+	width    int
+	height   int
+	seekable bool
+	onSeek   func(float64)
 }
 
 // NewProgressBar creates a new progress bar
@@ -42,6 +44,24 @@ func (p *ProgressBar) Value() float64 {
 	return p.value
 }
 
+// SetSeekable sets whether the progress bar accepts clicks to seek
+func (p *ProgressBar) SetSeekable(seekable bool) {
+	if p.seekable != seekable {
+		p.seekable = seekable
+		guigui.RequestRedraw(p)
+	}
+}
+
+// IsSeekable returns whether the progress bar accepts clicks to seek
+func (p *ProgressBar) IsSeekable() bool {
+	return p.seekable
+}
+
+// SetOnSeek sets the callback function that is called with the clicked ratio (0.0 to 1.0).
+func (p *ProgressBar) SetOnSeek(callback func(float64)) {
+	p.onSeek = callback
+}
+
 // SetSize sets the size of the progress bar
 func (p *ProgressBar) SetSize(width, height int) {
 	p.width = width
@@ -57,16 +77,56 @@ func (p *ProgressBar) Size(context *guigui.Context) (int, int) {
 func (p *ProgressBar) Draw(context *guigui.Context, dst *ebiten.Image) {
 	// Draw background
 	bounds := context.Bounds(p)
+	theme := CurrentTheme()
 
-	// Background (gray)
-	vector.DrawFilledRect(dst, float32(bounds.Min.X), float32(bounds.Min.Y), float32(bounds.Dx()), float32(bounds.Dy()), color.RGBA{100, 100, 100, 255}, false)
+	// Background
+	vector.DrawFilledRect(dst, float32(bounds.Min.X), float32(bounds.Min.Y), float32(bounds.Dx()), float32(bounds.Dy()), theme.ProgressTrack, false)
 
-	// Progress (green)
+	// Progress (accent, or disabled while read-only)
+	progressColor := theme.Accent
+	if !p.seekable {
+		progressColor = theme.Disabled
+	}
 	progressWidth := float32(float64(bounds.Dx()) * p.value)
 	if progressWidth > 0 {
-		vector.DrawFilledRect(dst, float32(bounds.Min.X), float32(bounds.Min.Y), progressWidth, float32(bounds.Dy()), color.RGBA{0, 200, 100, 255}, false)
+		vector.DrawFilledRect(dst, float32(bounds.Min.X), float32(bounds.Min.Y), progressWidth, float32(bounds.Dy()), progressColor, false)
 	}
 
 	// Border
-	vector.StrokeRect(dst, float32(bounds.Min.X), float32(bounds.Min.Y), float32(bounds.Dx()), float32(bounds.Dy()), 1, color.RGBA{150, 150, 150, 255}, false)
+	vector.StrokeRect(dst, float32(bounds.Min.X), float32(bounds.Min.Y), float32(bounds.Dx()), float32(bounds.Dy()), 1, theme.Border, false)
+}
+
+// Update handles clicks to seek.
+func (p *ProgressBar) Update(context *guigui.Context) error {
+	if !p.seekable || !inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		return nil
+	}
+
+	bounds := context.Bounds(p)
+	x, y := ebiten.CursorPosition()
+	if x < bounds.Min.X || x >= bounds.Max.X || y < bounds.Min.Y || y >= bounds.Max.Y {
+		return nil
+	}
+
+	ratio := float64(x-bounds.Min.X) / float64(bounds.Dx())
+	p.SetValue(ratio)
+	guigui.RequestRedraw(p)
+	if p.onSeek != nil {
+		p.onSeek(p.value)
+	}
+	return nil
+}
+
+// CursorShape returns the cursor shape for the progress bar.
+func (p *ProgressBar) CursorShape(context *guigui.Context) (ebiten.CursorShapeType, bool) {
+	bounds := context.Bounds(p)
+	x, y := ebiten.CursorPosition()
+
+	// Change cursor to pointer when seekable and over the bar
+	if p.seekable && x >= bounds.Min.X && x < bounds.Max.X &&
+		y >= bounds.Min.Y && y < bounds.Max.Y {
+		return ebiten.CursorShapePointer, true
+	}
+
+	return ebiten.CursorShapeDefault, true
 }
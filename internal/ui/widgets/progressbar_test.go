@@ -53,6 +53,19 @@ func TestProgressBar_SetValue(t *testing.T) {
 	}
 }
 
+func TestProgressBar_SetSeekable(t *testing.T) {
+	t.Parallel()
+
+	pb := widgets.NewProgressBar()
+	assert.False(t, pb.IsSeekable(), "progress bar should be read-only by default")
+
+	pb.SetSeekable(true)
+	assert.True(t, pb.IsSeekable())
+
+	pb.SetSeekable(false)
+	assert.False(t, pb.IsSeekable())
+}
+
 func TestProgressBar_SetSize(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,272 @@
+package widgets
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"github.com/hajimehoshi/guigui"
+	"github.com/hajimehoshi/guigui/basicwidget"
+)
+
+// reorderDragThreshold is how far in pixels the pointer must move with the button held before a press becomes a drag
+const reorderDragThreshold = 4
+
+// ReorderableList is a text list whose rows can be dragged to a new position.
+// It takes the same items as basicwidget.TextList, whose own drop callback isn't wired up,
+// and reports drops through SetOnItemDropped.
+type ReorderableList[T comparable] struct {
+	guigui.DefaultWidget
+
+	list      basicwidget.List[T]
+	items     []basicwidget.TextListItem[T]
+	rows      []reorderableListRow
+	listItems []basicwidget.ListItem[T]
+
+	onItemDropped func(from, to int)
+
+	// Row pressed to start a drag, and the pointer position it was pressed at; 0 while not pressed
+	dragFromPlus1 int
+	dragStartY    int
+	// Row the dragged row would be inserted before, from 0 to the item count; 0 while not dragging
+	dropBeforePlus1 int
+}
+
+// NewReorderableList creates a new reorderable list
+func NewReorderableList[T comparable]() *ReorderableList[T] {
+	return &ReorderableList[T]{}
+}
+
+// SetOnItemSelected sets the callback called when a row is selected, by the user or with SelectItemByIndex and SelectItemByTag
+func (l *ReorderableList[T]) SetOnItemSelected(callback func(index int)) {
+	l.list.SetOnItemSelected(callback)
+}
+
+// SetOnItemDropped sets the callback called when a row is dragged to a new position.
+// from is the row that was dragged and to the row it ends up at once it is moved.
+func (l *ReorderableList[T]) SetOnItemDropped(callback func(from, to int)) {
+	l.onItemDropped = callback
+}
+
+// SetItems sets the rows of the list. A drag in progress is cancelled, as its rows may be gone.
+func (l *ReorderableList[T]) SetItems(items []basicwidget.TextListItem[T]) {
+	l.items = append(l.items[:0], items...)
+	if len(l.rows) < len(items) {
+		l.rows = append(l.rows, make([]reorderableListRow, len(items)-len(l.rows))...)
+	}
+	l.rows = l.rows[:len(items)]
+	l.listItems = l.listItems[:0]
+	for i, item := range l.items {
+		l.rows[i].setItem(item.Text, item.Color)
+		l.listItems = append(l.listItems, basicwidget.ListItem[T]{
+			Content:    &l.rows[i],
+			Selectable: !item.Header && !item.Disabled && !item.Border,
+			Tag:        item.Tag,
+		})
+	}
+	l.list.SetItems(l.listItems)
+	l.resetDrag()
+}
+
+// ItemsCount returns the number of rows
+func (l *ReorderableList[T]) ItemsCount() int {
+	return len(l.items)
+}
+
+// ItemByIndex returns the item of a row
+func (l *ReorderableList[T]) ItemByIndex(index int) (basicwidget.TextListItem[T], bool) {
+	if index < 0 || index >= len(l.items) {
+		return basicwidget.TextListItem[T]{}, false
+	}
+	return l.items[index], true
+}
+
+// SelectedItemIndex returns the selected row, or -1 when there is none
+func (l *ReorderableList[T]) SelectedItemIndex() int {
+	return l.list.SelectedItemIndex()
+}
+
+// SelectItemByIndex selects a row; -1 clears the selection
+func (l *ReorderableList[T]) SelectItemByIndex(index int) {
+	l.list.SelectItemByIndex(index)
+}
+
+// SelectItemByTag selects the row with the tag
+func (l *ReorderableList[T]) SelectItemByTag(tag T) {
+	l.list.SelectItemByTag(tag)
+}
+
+// JumpToItemIndex scrolls the list to a row
+func (l *ReorderableList[T]) JumpToItemIndex(index int) {
+	l.list.JumpToItemIndex(index)
+}
+
+// Build lays out the list and its rows.
+func (l *ReorderableList[T]) Build(context *guigui.Context, appender *guigui.ChildWidgetAppender) error {
+	context.SetSize(&l.list, context.Size(l))
+	appender.AppendChildWidgetWithPosition(&l.list, context.Position(l))
+
+	focused := context.HasFocusedChildWidget(l)
+	for i := range l.rows {
+		row := &l.rows[i]
+		switch {
+		case focused && l.list.SelectedItemIndex() == i:
+			row.text.SetColor(basicwidget.DefaultActiveListItemTextColor(context))
+		default:
+			row.text.SetColor(row.color)
+		}
+		row.dropMarker = reorderDropMarkerNone
+		context.SetSize(row, image.Pt(guigui.DefaultSize, guigui.DefaultSize))
+	}
+
+	// The marker is drawn at the top of the row the dragged row goes before, or under the last row
+	switch before := l.dropBeforePlus1 - 1; {
+	case before < 0:
+	case before < len(l.rows):
+		l.rows[before].dropMarker = reorderDropMarkerAbove
+	case len(l.rows) > 0:
+		l.rows[len(l.rows)-1].dropMarker = reorderDropMarkerBelow
+	}
+	return nil
+}
+
+// Update follows a row being dragged with the left button and reports where it is dropped.
+// The inner list takes the pointer input to select rows, so the drag is followed here as the slider does.
+func (l *ReorderableList[T]) Update(context *guigui.Context) error {
+	x, y := ebiten.CursorPosition()
+	switch {
+	case inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft):
+		l.resetDrag()
+		if context.IsWidgetHitAt(&l.list, image.Pt(x, y)) {
+			l.dragFromPlus1 = l.rowAt(context, y) + 1
+			l.dragStartY = y
+		}
+
+	case ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft):
+		if l.dragFromPlus1 == 0 {
+			return nil
+		}
+		if l.dropBeforePlus1 == 0 && abs(y-l.dragStartY) < reorderDragThreshold {
+			return nil
+		}
+		// The pointer is kept inside the list, so dragging past an end drops at that end
+		bounds := context.Bounds(l)
+		y = max(bounds.Min.Y, min(bounds.Max.Y-1, y))
+		l.setDropBefore(l.dropIndexAt(context, y))
+
+	default:
+		from, before := l.dragFromPlus1-1, l.dropBeforePlus1-1
+		l.resetDrag()
+		if from < 0 || before < 0 {
+			return nil
+		}
+		// Removing the row shifts the rows after it up by one
+		to := before
+		if before > from {
+			to--
+		}
+		if to != from && l.onItemDropped != nil {
+			l.onItemDropped(from, to)
+		}
+	}
+	return nil
+}
+
+// resetDrag forgets the pressed row and hides the drop marker
+func (l *ReorderableList[T]) resetDrag() {
+	l.dragFromPlus1 = 0
+	l.dragStartY = 0
+	l.setDropBefore(-1)
+}
+
+// setDropBefore moves the drop marker
+func (l *ReorderableList[T]) setDropBefore(index int) {
+	if l.dropBeforePlus1 != index+1 {
+		l.dropBeforePlus1 = index + 1
+		guigui.RequestRedraw(l)
+	}
+}
+
+// rowAt returns the row under the vertical position y, or -1 when there is none
+func (l *ReorderableList[T]) rowAt(context *guigui.Context, y int) int {
+	for i := range l.rows {
+		if b := context.Bounds(&l.rows[i]); b.Min.Y <= y && y < b.Max.Y {
+			return i
+		}
+	}
+	return -1
+}
+
+// dropIndexAt returns the row a row dropped at the vertical position y goes before:
+// the first row whose middle is below y, or the item count past the last row.
+// The rows are scrolled with the list, so their bounds already take the scroll position into account.
+func (l *ReorderableList[T]) dropIndexAt(context *guigui.Context, y int) int {
+	for i := range l.rows {
+		if b := context.Bounds(&l.rows[i]); y < (b.Min.Y+b.Max.Y)/2 {
+			return i
+		}
+	}
+	return len(l.rows)
+}
+
+// abs returns the absolute value of an int
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// reorderDropMarker is where a row draws the line showing where a dragged row will go
+type reorderDropMarker int
+
+const (
+	reorderDropMarkerNone reorderDropMarker = iota
+	reorderDropMarkerAbove
+	reorderDropMarkerBelow
+)
+
+// reorderableListRow is one row of a ReorderableList: its text, and the drop marker while a row is dragged
+type reorderableListRow struct {
+	guigui.DefaultWidget
+
+	text       basicwidget.Text
+	color      color.Color
+	dropMarker reorderDropMarker
+}
+
+// setItem sets the text of the row and its color when it isn't selected
+func (r *reorderableListRow) setItem(text string, c color.Color) {
+	r.text.SetText(text)
+	r.color = c
+}
+
+// Build lays out the text of the row.
+func (r *reorderableListRow) Build(context *guigui.Context, appender *guigui.ChildWidgetAppender) error {
+	context.SetSize(&r.text, context.Size(r))
+	r.text.SetVerticalAlign(basicwidget.VerticalAlignMiddle)
+	appender.AppendChildWidgetWithPosition(&r.text, context.Position(r))
+	return nil
+}
+
+// Draw draws the drop marker
+func (r *reorderableListRow) Draw(context *guigui.Context, dst *ebiten.Image) {
+	bounds := context.Bounds(r)
+	var y float32
+	switch r.dropMarker {
+	case reorderDropMarkerAbove:
+		y = float32(bounds.Min.Y) + 1
+	case reorderDropMarkerBelow:
+		y = float32(bounds.Max.Y) - 1
+	default:
+		return
+	}
+	vector.StrokeLine(dst, float32(bounds.Min.X), y, float32(bounds.Max.X), y, 2, CurrentTheme().Accent, false)
+}
+
+// DefaultSize returns the width of the text and the height of a line
+func (r *reorderableListRow) DefaultSize(context *guigui.Context) image.Point {
+	return image.Pt(r.text.TextSize(context).X, int(basicwidget.LineHeight(context)))
+}
@@ -0,0 +1,53 @@
+package widgets_test
+
+import (
+	"testing"
+
+	"github.com/hajimehoshi/guigui/basicwidget"
+	"github.com/stretchr/testify/assert"
+
+	"musicplayer/internal/ui/widgets"
+)
+
+func TestNewReorderableList(t *testing.T) {
+	t.Parallel()
+
+	l := widgets.NewReorderableList[string]()
+	assert.NotNil(t, l)
+	assert.Equal(t, 0, l.ItemsCount())
+	assert.Equal(t, -1, l.SelectedItemIndex())
+
+	_, ok := l.ItemByIndex(0)
+	assert.False(t, ok)
+}
+
+func TestReorderableList_Items(t *testing.T) {
+	t.Parallel()
+
+	l := widgets.NewReorderableList[string]()
+	var selected []int
+	l.SetOnItemSelected(func(index int) {
+		selected = append(selected, index)
+	})
+	l.SetItems([]basicwidget.TextListItem[string]{
+		{Text: "1. a", Tag: "a"},
+		{Text: "2. b", Tag: "b"},
+		{Text: "3. c", Tag: "c"},
+	})
+	assert.Equal(t, 3, l.ItemsCount())
+
+	item, ok := l.ItemByIndex(1)
+	assert.True(t, ok)
+	assert.Equal(t, "2. b", item.Text)
+	assert.Equal(t, "b", item.Tag)
+
+	l.SelectItemByTag("c")
+	assert.Equal(t, 2, l.SelectedItemIndex())
+	assert.Equal(t, []int{2}, selected)
+
+	// Fewer items drop the rows past the end
+	l.SetItems([]basicwidget.TextListItem[string]{{Text: "1. a", Tag: "a"}})
+	assert.Equal(t, 1, l.ItemsCount())
+	_, ok = l.ItemByIndex(1)
+	assert.False(t, ok)
+}
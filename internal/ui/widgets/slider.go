@@ -1,8 +1,6 @@
 package widgets
 
 import (
-	"image/color"
-
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/vector"
@@ -97,8 +95,7 @@ func (s *Slider) Draw(context *guigui.Context, dst *ebiten.Image) {
 	bounds := context.Bounds(s)
 
 	// Draw background
-	bgColor := color.RGBA{200, 200, 200, 255}
-	vector.DrawFilledRect(dst, float32(bounds.Min.X), float32(bounds.Min.Y), float32(bounds.Dx()), float32(bounds.Dy()), bgColor, false)
+	vector.DrawFilledRect(dst, float32(bounds.Min.X), float32(bounds.Min.Y), float32(bounds.Dx()), float32(bounds.Dy()), CurrentTheme().SliderTrack, false)
 
 	// --- 元のハンドル描画 ---
 	valueRange := s.maximum - s.minimum
@@ -118,8 +115,7 @@ func (s *Slider) Draw(context *guigui.Context, dst *ebiten.Image) {
 	handleHeight := float32(bounds.Dy())
 
 	// Draw handle
-	handleColor := color.RGBA{100, 100, 100, 255}
-	vector.DrawFilledRect(dst, handleX-handleWidth/2, handleY, handleWidth, handleHeight, handleColor, false)
+	vector.DrawFilledRect(dst, handleX-handleWidth/2, handleY, handleWidth, handleHeight, CurrentTheme().SliderHandle, false)
 	// ---
 }
 
@@ -0,0 +1,199 @@
+package widgets
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"github.com/hajimehoshi/guigui"
+)
+
+// textInputFontSize is the font size of the text input
+const textInputFontSize = 14
+
+// TextInput is a single-line text box.
+// Clicking it gives it keyboard focus; clicking elsewhere, Enter or Escape releases it.
+type TextInput struct {
+	guigui.DefaultWidget
+
+	text        string
+	placeholder string
+	focused     bool
+	width       int
+	height      int
+	faceSources []*text.GoTextFaceSource
+	onChange    func(string)
+}
+
+// NewTextInput creates a new text input
+func NewTextInput() *TextInput {
+	return &TextInput{
+		width:  200,
+		height: 24,
+	}
+}
+
+// SetText sets the text, calling the OnChange callback if it changed
+func (t *TextInput) SetText(str string) {
+	if t.text == str {
+		return
+	}
+	t.text = str
+	guigui.RequestRedraw(t)
+	if t.onChange != nil {
+		t.onChange(str)
+	}
+}
+
+// Text returns the text
+func (t *TextInput) Text() string {
+	return t.text
+}
+
+// SetPlaceholder sets the text shown while the input is empty
+func (t *TextInput) SetPlaceholder(placeholder string) {
+	t.placeholder = placeholder
+	guigui.RequestRedraw(t)
+}
+
+// SetOnChange sets the callback function that is called when the text changes.
+func (t *TextInput) SetOnChange(callback func(string)) {
+	t.onChange = callback
+}
+
+// SetFocused sets whether the input receives keyboard input
+func (t *TextInput) SetFocused(focused bool) {
+	if t.focused != focused {
+		t.focused = focused
+		guigui.RequestRedraw(t)
+	}
+}
+
+// IsFocused returns whether the input receives keyboard input
+func (t *TextInput) IsFocused() bool {
+	return t.focused
+}
+
+// SetFaceSources sets the fonts used to draw the text; later sources are fallbacks
+func (t *TextInput) SetFaceSources(faceSources []*text.GoTextFaceSource) {
+	t.faceSources = faceSources
+	guigui.RequestRedraw(t)
+}
+
+// SetSize sets the size of the text input
+func (t *TextInput) SetSize(width, height int) {
+	t.width = width
+	t.height = height
+	guigui.RequestRedraw(t)
+}
+
+// Size returns the size of the text input
+func (t *TextInput) Size(context *guigui.Context) (int, int) {
+	return t.width, t.height
+}
+
+// Draw draws the text input
+func (t *TextInput) Draw(context *guigui.Context, dst *ebiten.Image) {
+	bounds := context.Bounds(t)
+	theme := CurrentTheme()
+	textColor, background, highlight := Colors()
+
+	vector.DrawFilledRect(dst, float32(bounds.Min.X), float32(bounds.Min.Y), float32(bounds.Dx()), float32(bounds.Dy()), background, false)
+
+	borderColor := highlight
+	if t.focused {
+		borderColor = theme.Accent
+	}
+	vector.StrokeRect(dst, float32(bounds.Min.X), float32(bounds.Min.Y), float32(bounds.Dx()), float32(bounds.Dy()), 1, borderColor, false)
+
+	face := t.face()
+	if face == nil {
+		return
+	}
+
+	str := t.text
+	if str == "" && !t.focused {
+		str = t.placeholder
+		textColor = theme.Placeholder
+	}
+
+	const padding = 4
+	op := &text.DrawOptions{}
+	op.GeoM.Translate(float64(bounds.Min.X+padding), float64(bounds.Min.Y)+float64(bounds.Dy())/2)
+	op.ColorScale.ScaleWithColor(textColor)
+	op.PrimaryAlign = text.AlignStart
+	op.SecondaryAlign = text.AlignCenter
+	text.Draw(dst, str, face, op)
+
+	// Cursor at the end of the text
+	if t.focused {
+		x := float32(bounds.Min.X+padding) + float32(text.Advance(t.text, face))
+		vector.StrokeLine(dst, x+1, float32(bounds.Min.Y+padding), x+1, float32(bounds.Max.Y-padding), 1, textColor, false)
+	}
+}
+
+// face returns the font face for the text, or nil if no face sources are set
+func (t *TextInput) face() text.Face {
+	faces := make([]text.Face, 0, len(t.faceSources))
+	for _, source := range t.faceSources {
+		faces = append(faces, &text.GoTextFace{Source: source, Size: textInputFontSize})
+	}
+	switch len(faces) {
+	case 0:
+		return nil
+	case 1:
+		return faces[0]
+	default:
+		face, err := text.NewMultiFace(faces...)
+		if err != nil {
+			return faces[0]
+		}
+		return face
+	}
+}
+
+// Layout lays out the text input.
+func (t *TextInput) Layout(context *guigui.Context, appender *guigui.ChildWidgetAppender) {
+	// TextInput has no children
+}
+
+// Update handles focus changes and keyboard input.
+func (t *TextInput) Update(context *guigui.Context) error {
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		bounds := context.Bounds(t)
+		x, y := ebiten.CursorPosition()
+		t.SetFocused(x >= bounds.Min.X && x < bounds.Max.X && y >= bounds.Min.Y && y < bounds.Max.Y)
+	}
+
+	if !t.focused {
+		return nil
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) || inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		t.SetFocused(false)
+		return nil
+	}
+
+	str := t.text
+	if IsKeyRepeated(ebiten.KeyBackspace) && len(str) > 0 {
+		runes := []rune(str)
+		str = string(runes[:len(runes)-1])
+	}
+	str += string(ebiten.AppendInputChars(nil))
+	t.SetText(str)
+
+	return nil
+}
+
+// CursorShape returns the cursor shape for the text input.
+func (t *TextInput) CursorShape(context *guigui.Context) (ebiten.CursorShapeType, bool) {
+	bounds := context.Bounds(t)
+	x, y := ebiten.CursorPosition()
+
+	if x >= bounds.Min.X && x < bounds.Max.X &&
+		y >= bounds.Min.Y && y < bounds.Max.Y {
+		return ebiten.CursorShapeText, true
+	}
+
+	return ebiten.CursorShapeDefault, true
+}
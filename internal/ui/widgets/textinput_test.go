@@ -0,0 +1,50 @@
+package widgets_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"musicplayer/internal/ui/widgets"
+)
+
+func TestNewTextInput(t *testing.T) {
+	t.Parallel()
+
+	ti := widgets.NewTextInput()
+	assert.NotNil(t, ti)
+	assert.Equal(t, "", ti.Text())
+	assert.False(t, ti.IsFocused(), "text input should not have focus by default")
+
+	w, h := ti.Size(nil)
+	assert.Equal(t, 200, w)
+	assert.Equal(t, 24, h)
+}
+
+func TestTextInput_SetText(t *testing.T) {
+	t.Parallel()
+
+	ti := widgets.NewTextInput()
+	var changes []string
+	ti.SetOnChange(func(str string) {
+		changes = append(changes, str)
+	})
+
+	ti.SetText("bgm")
+	ti.SetText("bgm") // Unchanged text doesn't call the callback
+	ti.SetText("")
+
+	assert.Equal(t, "", ti.Text())
+	assert.Equal(t, []string{"bgm", ""}, changes)
+}
+
+func TestTextInput_SetFocused(t *testing.T) {
+	t.Parallel()
+
+	ti := widgets.NewTextInput()
+	ti.SetFocused(true)
+	assert.True(t, ti.IsFocused())
+
+	ti.SetFocused(false)
+	assert.False(t, ti.IsFocused())
+}
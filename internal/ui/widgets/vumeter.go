@@ -0,0 +1,133 @@
+package widgets
+
+import (
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"github.com/hajimehoshi/guigui"
+)
+
+const (
+	// vuMeterPeakHoldFrames is how long the peak marker stays before it starts to fall
+	vuMeterPeakHoldFrames = 30
+
+	// vuMeterPeakDecay is how far the peak marker falls per frame after the hold
+	vuMeterPeakDecay = 0.01
+)
+
+// VUMeter is a horizontal level meter.
+// The bar is colored green to yellow to red with the level, and a peak marker holds the recent maximum.
+type VUMeter struct {
+	guigui.DefaultWidget
+
+	level     float64
+	peak      float64
+	holdCount int
+	width     int
+	height    int
+}
+
+// NewVUMeter creates a new VU meter
+func NewVUMeter() *VUMeter {
+	return &VUMeter{
+		width:  100,
+		height: 8,
+	}
+}
+
+// SetLevel sets the level (0.0 to 1.0), raising the peak marker if it is exceeded
+func (m *VUMeter) SetLevel(level float64) {
+	if level < 0 {
+		level = 0
+	}
+	if level > 1 {
+		level = 1
+	}
+	if m.level != level {
+		m.level = level
+		guigui.RequestRedraw(m)
+	}
+	if level >= m.peak {
+		m.peak = level
+		m.holdCount = vuMeterPeakHoldFrames
+	}
+}
+
+// Level returns the level
+func (m *VUMeter) Level() float64 {
+	return m.level
+}
+
+// Peak returns the position of the peak marker
+func (m *VUMeter) Peak() float64 {
+	return m.peak
+}
+
+// SetSize sets the size of the VU meter
+func (m *VUMeter) SetSize(width, height int) {
+	m.width = width
+	m.height = height
+}
+
+// Size returns the size of the VU meter
+func (m *VUMeter) Size(context *guigui.Context) (int, int) {
+	return m.width, m.height
+}
+
+// Draw draws the VU meter
+func (m *VUMeter) Draw(context *guigui.Context, dst *ebiten.Image) {
+	bounds := context.Bounds(m)
+	theme := CurrentTheme()
+
+	// Background
+	vector.DrawFilledRect(dst, float32(bounds.Min.X), float32(bounds.Min.Y), float32(bounds.Dx()), float32(bounds.Dy()), theme.ProgressTrack, false)
+
+	// Level, one column at a time so the color follows the position
+	levelWidth := int(float64(bounds.Dx()) * m.level)
+	for x := 0; x < levelWidth; x++ {
+		c := vuMeterColor(float64(x) / float64(bounds.Dx()))
+		vector.DrawFilledRect(dst, float32(bounds.Min.X+x), float32(bounds.Min.Y), 1, float32(bounds.Dy()), c, false)
+	}
+
+	// Peak marker
+	if m.peak > 0 {
+		x := float32(bounds.Min.X) + float32(float64(bounds.Dx())*m.peak)
+		if x > float32(bounds.Max.X-2) {
+			x = float32(bounds.Max.X - 2)
+		}
+		vector.DrawFilledRect(dst, x, float32(bounds.Min.Y), 2, float32(bounds.Dy()), theme.Text, false)
+	}
+
+	// Border
+	vector.StrokeRect(dst, float32(bounds.Min.X), float32(bounds.Min.Y), float32(bounds.Dx()), float32(bounds.Dy()), 1, theme.Border, false)
+}
+
+// vuMeterColor returns the bar color at a position (0.0 to 1.0): green, through yellow at the middle, to red
+func vuMeterColor(ratio float64) color.RGBA {
+	if ratio < 0.5 {
+		return color.RGBA{R: uint8(255 * ratio * 2), G: 200, B: 0, A: 255}
+	}
+	return color.RGBA{R: 255, G: uint8(200 * (1 - ratio) * 2), B: 0, A: 255}
+}
+
+// Layout lays out the VU meter.
+func (m *VUMeter) Layout(context *guigui.Context, appender *guigui.ChildWidgetAppender) {
+	// VUMeter has no children
+}
+
+// Update holds the peak marker for a while and then lets it fall back to the level.
+func (m *VUMeter) Update(context *guigui.Context) error {
+	if m.holdCount > 0 {
+		m.holdCount--
+		return nil
+	}
+	if m.peak > m.level {
+		m.peak -= vuMeterPeakDecay
+		if m.peak < m.level {
+			m.peak = m.level
+		}
+		guigui.RequestRedraw(m)
+	}
+	return nil
+}
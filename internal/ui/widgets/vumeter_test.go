@@ -0,0 +1,72 @@
+package widgets_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"musicplayer/internal/ui/widgets"
+)
+
+func TestNewVUMeter(t *testing.T) {
+	t.Parallel()
+
+	m := widgets.NewVUMeter()
+	assert.NotNil(t, m)
+	assert.Equal(t, 0.0, m.Level())
+	assert.Equal(t, 0.0, m.Peak())
+
+	w, h := m.Size(nil)
+	assert.Equal(t, 100, w)
+	assert.Equal(t, 8, h)
+}
+
+func TestVUMeter_SetLevel(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		input    float64
+		expected float64
+	}{
+		{"normal value", 0.5, 0.5},
+		{"minimum bound", -0.1, 0.0},
+		{"maximum bound", 1.1, 1.0},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			m := widgets.NewVUMeter()
+			m.SetLevel(tt.input)
+			assert.Equal(t, tt.expected, m.Level())
+			assert.Equal(t, tt.expected, m.Peak())
+		})
+	}
+}
+
+func TestVUMeter_PeakHold(t *testing.T) {
+	t.Parallel()
+
+	m := widgets.NewVUMeter()
+	m.SetLevel(0.8)
+	m.SetLevel(0.2)
+	assert.Equal(t, 0.2, m.Level())
+	assert.Equal(t, 0.8, m.Peak(), "peak should hold the maximum")
+
+	// The peak holds for a while before falling
+	for i := 0; i < 30; i++ {
+		assert.NoError(t, m.Update(nil))
+	}
+	assert.Equal(t, 0.8, m.Peak())
+
+	assert.NoError(t, m.Update(nil))
+	assert.Less(t, m.Peak(), 0.8, "peak should fall after the hold")
+
+	// It falls no further than the level
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, m.Update(nil))
+	}
+	assert.Equal(t, 0.2, m.Peak())
+}
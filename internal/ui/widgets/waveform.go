@@ -0,0 +1,149 @@
+package widgets
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"github.com/hajimehoshi/guigui"
+)
+
+// Waveform draws the peak amplitudes of a track, mirrored around the center line,
+// with the repeating part shaded and a marker at the playback position.
+type Waveform struct {
+	guigui.DefaultWidget
+
+	peaks     []float32
+	position  float64
+	loopStart float64
+	loopEnd   float64
+	width     int
+	height    int
+}
+
+// NewWaveform creates a new waveform
+func NewWaveform() *Waveform {
+	return &Waveform{
+		width:  100,
+		height: 40,
+	}
+}
+
+// SetPeaks sets the peak amplitudes (0.0 to 1.0) to draw from left to right; nil draws nothing
+func (w *Waveform) SetPeaks(peaks []float32) {
+	// The same cached peaks are set every frame
+	if len(w.peaks) == len(peaks) && (len(peaks) == 0 || &w.peaks[0] == &peaks[0]) {
+		return
+	}
+	w.peaks = peaks
+	guigui.RequestRedraw(w)
+}
+
+// Peaks returns the peak amplitudes
+func (w *Waveform) Peaks() []float32 {
+	return w.peaks
+}
+
+// SetPosition sets the playback position marker (0.0 to 1.0)
+func (w *Waveform) SetPosition(position float64) {
+	position = clampRatio(position)
+	if w.position != position {
+		w.position = position
+		guigui.RequestRedraw(w)
+	}
+}
+
+// Position returns the playback position marker
+func (w *Waveform) Position() float64 {
+	return w.position
+}
+
+// SetLoopRegion sets the repeating part of the track to shade (0.0 to 1.0).
+// An empty region, such as 0, 0, hides it.
+func (w *Waveform) SetLoopRegion(start, end float64) {
+	start = clampRatio(start)
+	end = clampRatio(end)
+	if end < start {
+		end = start
+	}
+	if w.loopStart != start || w.loopEnd != end {
+		w.loopStart = start
+		w.loopEnd = end
+		guigui.RequestRedraw(w)
+	}
+}
+
+// LoopRegion returns the shaded loop region
+func (w *Waveform) LoopRegion() (start, end float64) {
+	return w.loopStart, w.loopEnd
+}
+
+// clampRatio clamps a value to 0.0-1.0
+func clampRatio(value float64) float64 {
+	if value < 0 {
+		return 0
+	}
+	if value > 1 {
+		return 1
+	}
+	return value
+}
+
+// SetSize sets the size of the waveform
+func (w *Waveform) SetSize(width, height int) {
+	w.width = width
+	w.height = height
+}
+
+// Size returns the size of the waveform
+func (w *Waveform) Size(context *guigui.Context) (int, int) {
+	return w.width, w.height
+}
+
+// Draw draws the waveform
+func (w *Waveform) Draw(context *guigui.Context, dst *ebiten.Image) {
+	bounds := context.Bounds(w)
+	theme := CurrentTheme()
+
+	// Background
+	vector.DrawFilledRect(dst, float32(bounds.Min.X), float32(bounds.Min.Y), float32(bounds.Dx()), float32(bounds.Dy()), theme.ProgressTrack, false)
+
+	// Loop region, as a band behind the waveform with lines at its ends
+	if w.loopEnd > w.loopStart {
+		startX := float32(bounds.Min.X) + float32(float64(bounds.Dx())*w.loopStart)
+		endX := float32(bounds.Min.X) + float32(float64(bounds.Dx())*w.loopEnd)
+		vector.DrawFilledRect(dst, startX, float32(bounds.Min.Y), endX-startX, float32(bounds.Dy()), theme.Highlight, false)
+		vector.StrokeLine(dst, startX, float32(bounds.Min.Y), startX, float32(bounds.Max.Y), 1, theme.Disabled, false)
+		vector.StrokeLine(dst, endX, float32(bounds.Min.Y), endX, float32(bounds.Max.Y), 1, theme.Disabled, false)
+	}
+
+	// One line per column, taking the loudest bucket that falls into it
+	if len(w.peaks) > 0 {
+		centerY := float32(bounds.Min.Y) + float32(bounds.Dy())/2
+		for x := 0; x < bounds.Dx(); x++ {
+			from := x * len(w.peaks) / bounds.Dx()
+			to := max((x+1)*len(w.peaks)/bounds.Dx(), from+1)
+			var peak float32
+			for _, p := range w.peaks[from:min(to, len(w.peaks))] {
+				peak = max(peak, p)
+			}
+			h := max(peak*float32(bounds.Dy())/2, 0.5)
+			vector.StrokeLine(dst, float32(bounds.Min.X+x)+0.5, centerY-h, float32(bounds.Min.X+x)+0.5, centerY+h, 1, theme.Accent, false)
+		}
+	}
+
+	// Playback position
+	x := float32(bounds.Min.X) + float32(float64(bounds.Dx())*w.position)
+	vector.StrokeLine(dst, x, float32(bounds.Min.Y), x, float32(bounds.Max.Y), 1, theme.Text, false)
+
+	// Border
+	vector.StrokeRect(dst, float32(bounds.Min.X), float32(bounds.Min.Y), float32(bounds.Dx()), float32(bounds.Dy()), 1, theme.Border, false)
+}
+
+// Layout lays out the waveform.
+func (w *Waveform) Layout(context *guigui.Context, appender *guigui.ChildWidgetAppender) {
+	// Waveform has no children
+}
+
+// Update updates the waveform.
+func (w *Waveform) Update(context *guigui.Context) error {
+	return nil
+}
@@ -0,0 +1,45 @@
+package widgets_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"musicplayer/internal/ui/widgets"
+)
+
+func TestNewWaveform(t *testing.T) {
+	t.Parallel()
+
+	w := widgets.NewWaveform()
+	assert.NotNil(t, w)
+	assert.Nil(t, w.Peaks())
+	assert.Equal(t, 0.0, w.Position())
+
+	width, height := w.Size(nil)
+	assert.Equal(t, 100, width)
+	assert.Equal(t, 40, height)
+}
+
+func TestWaveform_Markers(t *testing.T) {
+	t.Parallel()
+
+	w := widgets.NewWaveform()
+	w.SetPeaks([]float32{0.1, 0.5})
+	assert.Equal(t, []float32{0.1, 0.5}, w.Peaks())
+
+	w.SetPosition(0.25)
+	assert.Equal(t, 0.25, w.Position())
+	w.SetPosition(1.5)
+	assert.Equal(t, 1.0, w.Position(), "position should be clamped")
+
+	w.SetLoopRegion(-0.1, 0.6)
+	start, end := w.LoopRegion()
+	assert.Equal(t, 0.0, start, "loop start should be clamped")
+	assert.Equal(t, 0.6, end)
+
+	w.SetLoopRegion(0.3, 0.2)
+	start, end = w.LoopRegion()
+	assert.Equal(t, 0.3, start)
+	assert.Equal(t, 0.3, end, "an inverted region should be empty")
+}
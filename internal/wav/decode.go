@@ -0,0 +1,311 @@
+// Package wav provides a WAV decoder producing 16bit stereo PCM streams, as Ebitengine's audio package plays them.
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"musicplayer/internal/resample"
+)
+
+const (
+	// Output format: signed 16bit little endian, 2 channels
+	bytesPerSample = 4
+
+	// Format tags of the fmt chunk
+	formatPCM        = 0x0001
+	formatFloat      = 0x0003
+	formatExtensible = 0xfffe
+)
+
+// Stream is a decoded WAV stream.
+//
+// The format is signed 16bit integer little endian PCM. The channel count is 2.
+type Stream struct {
+	inner      io.ReadSeeker
+	size       int64
+	sampleRate int
+}
+
+// Read is implementation of io.Reader's Read.
+func (s *Stream) Read(p []byte) (int, error) {
+	return s.inner.Read(p)
+}
+
+// Seek is implementation of io.Seeker's Seek.
+func (s *Stream) Seek(offset int64, whence int) (int64, error) {
+	return s.inner.Seek(offset, whence)
+}
+
+// Length returns the size of decoded stream in bytes.
+func (s *Stream) Length() int64 {
+	return s.size
+}
+
+// SampleRate returns the sample rate of the decoded stream.
+func (s *Stream) SampleRate() int {
+	return s.sampleRate
+}
+
+// format holds the fields of the fmt chunk needed for decoding.
+type format struct {
+	tag           int
+	channels      int
+	sampleRate    int
+	bitsPerSample int
+}
+
+// DecodeWithoutResampling decodes WAV data to playable stream in signed 16bit integer, little endian, 2 channels (stereo) format.
+//
+// Integer PCM of 8 to 32 bits and 32bit float samples are accepted, also in the extensible format.
+// The source must be 1 or 2 channels.
+//
+// If src is an io.ReadSeeker, the samples are converted as the stream is read, and src must stay
+// open while the stream is used. Otherwise the sample data is read into memory.
+func DecodeWithoutResampling(src io.Reader) (*Stream, error) {
+	f, size, err := readChunks(src)
+	if err != nil {
+		return nil, err
+	}
+
+	rs, ok := src.(io.ReadSeeker)
+	start := int64(0)
+	if ok {
+		if start, err = rs.Seek(0, io.SeekCurrent); err != nil {
+			return nil, fmt.Errorf("wav: failed to locate data chunk: %v", err)
+		}
+	} else {
+		data, err := io.ReadAll(io.LimitReader(src, size))
+		if err != nil {
+			return nil, fmt.Errorf("wav: failed to read data chunk: %v", err)
+		}
+		rs, size = bytes.NewReader(data), int64(len(data))
+	}
+
+	c := newConverter(rs, start, size, f)
+	return &Stream{
+		inner:      c,
+		size:       c.frames * bytesPerSample,
+		sampleRate: f.sampleRate,
+	}, nil
+}
+
+// DecodeWithSampleRate decodes WAV data to playable stream in signed 16bit integer, little endian, 2 channels (stereo) format.
+//
+// DecodeWithSampleRate automatically resamples the stream to fit with sampleRate if necessary.
+func DecodeWithSampleRate(sampleRate int, src io.Reader) (*Stream, error) {
+	s, err := DecodeWithoutResampling(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if sampleRate == s.sampleRate {
+		return s, nil
+	}
+
+	r := resample.NewReader(s.inner, s.size, s.sampleRate, sampleRate)
+	return &Stream{
+		inner:      r,
+		size:       r.Length(),
+		sampleRate: sampleRate,
+	}, nil
+}
+
+// readChunks checks the RIFF header and reads up to the sample data, returning the fmt chunk
+// and the size of the data chunk. src is left at the start of the sample data.
+func readChunks(r io.Reader) (*format, int64, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, 0, fmt.Errorf("wav: failed to read RIFF header: %v", err)
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return nil, 0, fmt.Errorf("wav: invalid RIFF header")
+	}
+
+	var f *format
+	chunkHeader := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunkHeader); err != nil {
+			if err == io.EOF && f == nil {
+				return nil, 0, fmt.Errorf("wav: missing fmt chunk")
+			}
+			if err == io.EOF {
+				return nil, 0, fmt.Errorf("wav: missing data chunk")
+			}
+			return nil, 0, fmt.Errorf("wav: failed to read chunk header: %v", err)
+		}
+		id := string(chunkHeader[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunkHeader[4:8]))
+		// Chunks are padded to an even size
+		padded := size + size%2
+
+		switch id {
+		case "fmt ":
+			chunk := make([]byte, padded)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return nil, 0, fmt.Errorf("wav: failed to read fmt chunk: %v", err)
+			}
+			parsed, err := parseFormat(chunk[:size])
+			if err != nil {
+				return nil, 0, err
+			}
+			f = parsed
+		case "data":
+			if f == nil {
+				return nil, 0, fmt.Errorf("wav: data chunk before fmt chunk")
+			}
+			return f, size, nil
+		default:
+			if _, err := io.CopyN(io.Discard, r, padded); err != nil {
+				return nil, 0, fmt.Errorf("wav: failed to skip %q chunk: %v", id, err)
+			}
+		}
+	}
+}
+
+// parseFormat parses the fmt chunk. The extensible format carries the actual format tag
+// at the start of its subformat GUID.
+func parseFormat(chunk []byte) (*format, error) {
+	if len(chunk) < 16 {
+		return nil, fmt.Errorf("wav: fmt chunk too short")
+	}
+	f := &format{
+		tag:           int(binary.LittleEndian.Uint16(chunk[0:2])),
+		channels:      int(binary.LittleEndian.Uint16(chunk[2:4])),
+		sampleRate:    int(binary.LittleEndian.Uint32(chunk[4:8])),
+		bitsPerSample: int(binary.LittleEndian.Uint16(chunk[14:16])),
+	}
+	if f.tag == formatExtensible {
+		if len(chunk) < 26 {
+			return nil, fmt.Errorf("wav: fmt chunk too short for the extensible format")
+		}
+		f.tag = int(binary.LittleEndian.Uint16(chunk[24:26]))
+	}
+
+	switch {
+	case f.tag == formatPCM && f.bitsPerSample >= 1 && f.bitsPerSample <= 32:
+	case f.tag == formatFloat && f.bitsPerSample == 32:
+	case f.tag == formatPCM || f.tag == formatFloat:
+		return nil, fmt.Errorf("wav: unsupported bits per sample: %d", f.bitsPerSample)
+	default:
+		return nil, fmt.Errorf("wav: unsupported format tag: 0x%04x", f.tag)
+	}
+	if f.channels != 1 && f.channels != 2 {
+		return nil, fmt.Errorf("wav: unsupported channel count: %d", f.channels)
+	}
+	if f.sampleRate <= 0 {
+		return nil, fmt.Errorf("wav: invalid sample rate")
+	}
+	return f, nil
+}
+
+// converter converts the sample data, size bytes starting at start in src, to 16bit stereo PCM as it is read
+type converter struct {
+	src             io.ReadSeeker
+	start           int64
+	format          *format
+	bytesPerChannel int
+	frameSize       int   // Bytes per source frame
+	frames          int64 // Length in frames
+	pos             int64 // Position in frames
+	buf             []byte
+}
+
+// newConverter returns a converter positioned at the start of the sample data
+func newConverter(src io.ReadSeeker, start, size int64, f *format) *converter {
+	bytesPerChannel := (f.bitsPerSample + 7) / 8
+	frameSize := bytesPerChannel * f.channels
+	return &converter{
+		src:             src,
+		start:           start,
+		format:          f,
+		bytesPerChannel: bytesPerChannel,
+		frameSize:       frameSize,
+		frames:          size / int64(frameSize),
+	}
+}
+
+// Read is implementation of io.Reader's Read.
+// A source shorter than its data chunk states ends the stream early.
+func (c *converter) Read(p []byte) (int, error) {
+	if c.pos >= c.frames {
+		return 0, io.EOF
+	}
+	frames := min(int64(len(p)/bytesPerSample), c.frames-c.pos)
+	if frames == 0 {
+		return 0, nil // p can't hold a frame
+	}
+	want := int(frames) * c.frameSize
+	if cap(c.buf) < want {
+		c.buf = make([]byte, want)
+	}
+	buf := c.buf[:want]
+	n, err := io.ReadFull(c.src, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		c.frames = c.pos + int64(n/c.frameSize)
+		err = nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("wav: failed to read samples: %v", err)
+	}
+
+	read := n / c.frameSize
+	for i := range read {
+		frame := buf[i*c.frameSize:]
+		// Mono is duplicated into both channels
+		left := c.sample(frame)
+		right := left
+		if c.format.channels > 1 {
+			right = c.sample(frame[c.bytesPerChannel:])
+		}
+		binary.LittleEndian.PutUint16(p[i*4:], uint16(left))
+		binary.LittleEndian.PutUint16(p[i*4+2:], uint16(right))
+	}
+	c.pos += int64(read)
+	if read == 0 {
+		return 0, io.EOF
+	}
+	return read * bytesPerSample, nil
+}
+
+// Seek is implementation of io.Seeker's Seek. The position is rounded down to a whole frame.
+func (c *converter) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += c.pos * bytesPerSample
+	case io.SeekEnd:
+		offset += c.frames * bytesPerSample
+	default:
+		return 0, fmt.Errorf("wav: invalid whence: %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("wav: negative position: %d", offset)
+	}
+	pos := min(offset/bytesPerSample, c.frames)
+	if _, err := c.src.Seek(c.start+pos*int64(c.frameSize), io.SeekStart); err != nil {
+		return 0, fmt.Errorf("wav: failed to seek: %v", err)
+	}
+	c.pos = pos
+	return pos * bytesPerSample, nil
+}
+
+// sample reads one sample and scales it to 16bit.
+// Integer samples are left-justified within their bytes, so the most significant bits are kept.
+func (c *converter) sample(b []byte) int16 {
+	if c.format.tag == formatFloat {
+		v := float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		return int16(max(min(math.Round(v*math.MaxInt16), math.MaxInt16), math.MinInt16))
+	}
+	switch c.bytesPerChannel {
+	case 1:
+		// 8bit samples are unsigned
+		return int16(int(b[0])-128) << 8
+	default:
+		// The two most significant bytes come last
+		return int16(binary.LittleEndian.Uint16(b[c.bytesPerChannel-2:]))
+	}
+}
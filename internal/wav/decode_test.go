@@ -0,0 +1,194 @@
+package wav_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"musicplayer/internal/wav"
+)
+
+// encode builds a WAV file with the given fmt chunk fields and sample data.
+// An odd sized chunk is put before the sample data to check that padding is skipped.
+func encode(tag, channels, sampleRate, bitsPerSample int, data []byte) []byte {
+	format := &bytes.Buffer{}
+	blockAlign := channels * (bitsPerSample + 7) / 8
+	binary.Write(format, binary.LittleEndian, uint16(tag))
+	binary.Write(format, binary.LittleEndian, uint16(channels))
+	binary.Write(format, binary.LittleEndian, uint32(sampleRate))
+	binary.Write(format, binary.LittleEndian, uint32(sampleRate*blockAlign))
+	binary.Write(format, binary.LittleEndian, uint16(blockAlign))
+	binary.Write(format, binary.LittleEndian, uint16(bitsPerSample))
+	if tag == 0xfffe {
+		binary.Write(format, binary.LittleEndian, uint16(22)) // Extension size
+		binary.Write(format, binary.LittleEndian, uint16(bitsPerSample))
+		binary.Write(format, binary.LittleEndian, uint32(0)) // Channel mask
+		binary.Write(format, binary.LittleEndian, uint16(1)) // PCM subformat
+		format.Write(make([]byte, 14))
+	}
+
+	body := &bytes.Buffer{}
+	body.WriteString("WAVE")
+	writeChunk := func(id string, data []byte) {
+		body.WriteString(id)
+		binary.Write(body, binary.LittleEndian, uint32(len(data)))
+		body.Write(data)
+		if len(data)%2 == 1 {
+			body.WriteByte(0)
+		}
+	}
+	writeChunk("fmt ", format.Bytes())
+	writeChunk("LIST", []byte("odd"))
+	writeChunk("data", data)
+
+	out := &bytes.Buffer{}
+	out.WriteString("RIFF")
+	binary.Write(out, binary.LittleEndian, uint32(body.Len()))
+	out.Write(body.Bytes())
+	return out.Bytes()
+}
+
+// interleave returns 16bit samples of the channels, interleaved
+func interleave(channels ...[]int16) []byte {
+	data := &bytes.Buffer{}
+	for i := range channels[0] {
+		for _, ch := range channels {
+			binary.Write(data, binary.LittleEndian, ch[i])
+		}
+	}
+	return data.Bytes()
+}
+
+// decoded returns the left and right samples of a decoded stream
+func decoded(t *testing.T, s *wav.Stream) ([]int16, []int16) {
+	t.Helper()
+	pcm, err := io.ReadAll(s)
+	require.NoError(t, err)
+	var left, right []int16
+	for i := 0; i < len(pcm); i += 4 {
+		left = append(left, int16(binary.LittleEndian.Uint16(pcm[i:])))
+		right = append(right, int16(binary.LittleEndian.Uint16(pcm[i+2:])))
+	}
+	return left, right
+}
+
+func TestDecodeWithoutResampling(t *testing.T) {
+	left := []int16{0, 1000, -1000, 32767, -32768}
+	right := []int16{5, -5, 12345, -12345, 0}
+
+	for _, tag := range []int{0x0001, 0xfffe} {
+		data := encode(tag, 2, 44100, 16, interleave(left, right))
+
+		// Seekable sources are converted as they are read, others are read into memory
+		for name, src := range map[string]io.Reader{
+			"seeker": bytes.NewReader(data),
+			"reader": bytes.NewBuffer(data),
+		} {
+			t.Run(name, func(t *testing.T) {
+				s, err := wav.DecodeWithoutResampling(src)
+				require.NoError(t, err)
+				assert.Equal(t, 44100, s.SampleRate())
+				assert.Equal(t, int64(len(left)*4), s.Length())
+
+				l, r := decoded(t, s)
+				require.Len(t, l, len(left))
+				assert.Equal(t, left, l, "format 0x%04x", tag)
+				assert.Equal(t, right, r, "format 0x%04x", tag)
+			})
+		}
+	}
+}
+
+func TestDecodeWithoutResampling_Formats(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  int
+		bits int
+		data []byte
+	}{
+		{"8bit", 0x0001, 8, []byte{0x80, 0xc0, 0x00}},
+		{"24bit", 0x0001, 24, []byte{0x00, 0x00, 0x00, 0xff, 0x00, 0x40, 0x00, 0x00, 0x80}},
+		{"32bit", 0x0001, 32, []byte{0, 0, 0, 0, 0, 0, 0, 0x40, 0, 0, 0, 0x80}},
+		{"float", 0x0003, 32, func() []byte {
+			data := &bytes.Buffer{}
+			for _, v := range []float32{0, 0.5, -1} {
+				binary.Write(data, binary.LittleEndian, math.Float32bits(v))
+			}
+			return data.Bytes()
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := wav.DecodeWithoutResampling(bytes.NewReader(encode(tt.tag, 1, 48000, tt.bits, tt.data)))
+			require.NoError(t, err)
+
+			// Silence, half scale and negative full scale; mono is duplicated into both channels
+			l, r := decoded(t, s)
+			want := []int16{0, 0x4000, -0x8000}
+			if tt.tag == 0x0003 {
+				want = []int16{0, 16384, -32767}
+			}
+			assert.Equal(t, want, l)
+			assert.Equal(t, want, r)
+		})
+	}
+}
+
+func TestDecodeWithoutResampling_Seek(t *testing.T) {
+	samples := make([]int16, 100)
+	for i := range samples {
+		samples[i] = int16(i)
+	}
+	s, err := wav.DecodeWithoutResampling(bytes.NewReader(encode(0x0001, 1, 48000, 16, interleave(samples))))
+	require.NoError(t, err)
+
+	pos, err := s.Seek(40*4+1, io.SeekStart)
+	require.NoError(t, err)
+	assert.Equal(t, int64(40*4), pos, "the position is rounded down to a whole frame")
+	l, _ := decoded(t, s)
+	assert.Equal(t, samples[40:], l)
+
+	_, err = s.Seek(-4, io.SeekStart)
+	assert.Error(t, err)
+}
+
+func TestDecodeWithoutResampling_Truncated(t *testing.T) {
+	data := encode(0x0001, 2, 48000, 16, interleave(make([]int16, 100), make([]int16, 100)))
+
+	// The stream ends where the file does
+	s, err := wav.DecodeWithoutResampling(bytes.NewReader(data[:len(data)-40*4-2]))
+	require.NoError(t, err)
+	l, _ := decoded(t, s)
+	assert.Len(t, l, 59)
+}
+
+func TestDecodeWithSampleRate(t *testing.T) {
+	samples := make([]int16, 4410)
+	data := encode(0x0001, 2, 44100, 16, interleave(samples, samples))
+
+	s, err := wav.DecodeWithSampleRate(48000, bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 48000, s.SampleRate())
+	assert.InDelta(t, 4800*4, s.Length(), 8)
+
+	_, err = s.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	_, err := wav.DecodeWithoutResampling(bytes.NewReader([]byte("FORM0000AIFF")))
+	assert.Error(t, err)
+
+	// Compressed formats such as A-law aren't supported
+	_, err = wav.DecodeWithoutResampling(bytes.NewReader(encode(0x0006, 1, 8000, 8, []byte{0})))
+	assert.Error(t, err)
+
+	// Neither are more than two channels
+	_, err = wav.DecodeWithoutResampling(bytes.NewReader(encode(0x0001, 6, 48000, 16, make([]byte, 12))))
+	assert.Error(t, err)
+}
@@ -1,125 +1,382 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"image"
 	"io"
 	"log"
+	"os"
+	"strconv"
+	"strings"
 
 	"github.com/hajimehoshi/ebiten/v2/audio"
 	"github.com/hajimehoshi/guigui"
 
 	"musicplayer/internal/files"
+	"musicplayer/internal/logging"
 	"musicplayer/internal/player"
 	"musicplayer/internal/ui"
+	"musicplayer/internal/ui/widgets"
 )
 
-// Sample rate for audio player
-const sampleRate = 48000
+// logger receives the application's log messages; the -log-level flag sets its level
+var logger = logging.NewStdLogger(nil, logging.LevelInfo)
+
+// musicDirEnv is the environment variable naming the music directory when no -dir flag is given
+const musicDirEnv = "MUSIC_DIR"
 
 // AudioContextWrapper wraps audio.Context to implement the player.PlayerFactory interface
 type AudioContextWrapper struct {
 	*audio.Context
+	fallback player.PlayerFactory // Silent factory used once the audio device has failed
 }
 
-// NewPlayer wraps audio.Context.NewPlayer to return a player.Player
+// NewPlayer wraps audio.Context.NewPlayer to return a player.Player.
+// If the audio device fails, this and later players are silent.
 func (w *AudioContextWrapper) NewPlayer(stream io.Reader) (player.Player, error) {
+	if w.fallback != nil {
+		return w.fallback.NewPlayer(stream)
+	}
 	p, err := w.Context.NewPlayer(stream)
 	if err != nil {
-		return nil, err
+		logger.Warn("audio device is unavailable, playing silently: %v", err)
+		w.fallback = player.NewNullPlayerFactory()
+		return w.fallback.NewPlayer(stream)
 	}
 	return p, nil
 }
 
+// newPlayerFactory returns a factory playing through the default audio device at the sample rate,
+// or a silent one if silent is set or the audio context can't be created.
+func newPlayerFactory(silent bool, sampleRate int) (factory player.PlayerFactory) {
+	if silent {
+		return player.NewNullPlayerFactoryWithSampleRate(sampleRate)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Warn("audio device is unavailable, playing silently: %v", r)
+			factory = player.NewNullPlayerFactoryWithSampleRate(sampleRate)
+		}
+	}()
+	return &AudioContextWrapper{Context: audio.NewContext(sampleRate)}
+}
+
 // Game represents the Ebiten game
 type Game struct {
-	player  *player.MusicPlayer
-	watcher *files.DirectoryWatcher
+	player   *player.MusicPlayer
+	watcher  *files.DirectoryWatcher
+	warnings []string // Problems while starting up, shown in the UI as well as logged
 }
 
-// NewGame creates a new game
-func NewGame() (*Game, error) {
-	// Set up music directory
-	musicDir := files.DefaultMusicDir
-
-	// Ensure the music directory exists
-	absDir, err := musicDir.EnsureMusicDirectory()
+// NewGameFromPlaylist creates a new game playing the files listed in an M3U playlist.
+// The music directory is not watched in this mode.
+func NewGameFromPlaylist(playlistPath string, playerFactory player.PlayerFactory) (*Game, error) {
+	musicPlayer, err := player.NewMusicPlayerFromPlaylist(playlistPath, playerFactory, logger)
 	if err != nil {
 		return nil, err
 	}
+	logger.Info("Loaded %d music files from %s", len(musicPlayer.GetMusicFiles()), playlistPath)
+
+	return &Game{player: musicPlayer}, nil
+}
+
+// NewGame creates a new game playing the files in the given music directories.
+// Subdirectories are included when recursive is true, and directories reached through
+// symlinks as well when followSymlinks is also true.
+func NewGame(musicDirs []files.MusicDirectory, recursive, followSymlinks bool, playerFactory player.PlayerFactory) (*Game, error) {
+	var warnings []string
+	warn := func(format string, args ...any) {
+		logger.Warn(format, args...)
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	// Ensure the music directories exist
+	absDirs := make([]string, 0, len(musicDirs))
+	for _, musicDir := range musicDirs {
+		absDir, err := musicDir.EnsureMusicDirectory()
+		if err != nil {
+			return nil, err
+		}
+		absDirs = append(absDirs, absDir)
+	}
 
 	// Check if we have any music files (logging purposes)
-	musicFiles, err := musicDir.FindMusicFiles()
+	findMusicFiles, watchDirectories := files.FindMusicFilesIn, files.WatchDirectories
+	switch {
+	case !recursive:
+		findMusicFiles, watchDirectories = files.FindMusicFilesInShallow, files.WatchDirectoriesShallow
+	case followSymlinks:
+		findMusicFiles, watchDirectories = files.FindMusicFilesInFollowingSymlinks, files.WatchDirectoriesFollowingSymlinks
+	}
+	musicFiles, err := findMusicFiles(musicDirs...)
 	if err != nil {
 		// Log warning but continue
-		log.Printf("Warning: Failed to initially find music files: %v", err)
+		warn("Failed to initially find music files: %v", err)
 	}
-	log.Printf("Found %d music files in %s", len(musicFiles), absDir)
-
-	// Initialize audio context as PlayerFactory
-	audioContext := audio.NewContext(sampleRate)
-
-	// Create wrapper
-	playerFactory := &AudioContextWrapper{Context: audioContext}
+	logger.Info("Found %d music files in %s", len(musicFiles), strings.Join(absDirs, ", "))
 
 	// Initialize the music player with the initial list of files
 	musicPlayer, err := player.NewMusicPlayer(musicFiles, playerFactory)
 	if err != nil {
 		// Log warning but continue as player might recover if files are added
-		log.Printf("Warning: Failed to initialize music player: %v", err)
+		warn("Failed to initialize music player: %v", err)
 		// Ensure musicPlayer is nil if initialization truly failed, though NewMusicPlayer currently doesn't return errors
 		// musicPlayer = nil
+	} else {
+		musicPlayer.SetLogger(logger)
 	}
 
 	// Create and start the directory watcher
-	watcher, err := musicDir.Watch()
+	watcher, err := watchDirectories(musicDirs...)
 	if err != nil {
 		// Log warning but continue, file watching won't work
-		log.Printf("Warning: Failed to start directory watcher: %v", err)
+		warn("Failed to start directory watcher: %v", err)
 		watcher = nil // Ensure watcher is nil if creation failed
+	} else {
+		watcher.SetLogger(logger)
 	}
 
 	// Create and return the game
 	g := &Game{
-		player:  musicPlayer,
-		watcher: watcher,
+		player:   musicPlayer,
+		watcher:  watcher,
+		warnings: warnings,
 	}
 
 	return g, nil
 }
 
+// runBatchCheck checks the music files, decoded at the sample rate, without opening a window
+// and prints a report. It returns the exit status: 0 if every file passed, 1 otherwise.
+func runBatchCheck(musicDirs []files.MusicDirectory, playlistPath string, recursive, followSymlinks bool, sampleRate int) int {
+	var musicFiles []string
+	var err error
+	switch {
+	case playlistPath != "":
+		musicFiles, err = files.LoadPlaylist(playlistPath, logger)
+	case !recursive:
+		musicFiles, err = files.FindMusicFilesInShallow(musicDirs...)
+	case followSymlinks:
+		musicFiles, err = files.FindMusicFilesInFollowingSymlinks(musicDirs...)
+	default:
+		musicFiles, err = files.FindMusicFilesIn(musicDirs...)
+	}
+	if err != nil {
+		logger.Error("Failed to find music files: %v", err)
+		return 1
+	}
+
+	// The check reads the streams itself, so no audio device is needed
+	factory := player.NewNullPlayerFactoryWithSampleRate(sampleRate)
+	results, err := player.RunBatchCheck(musicFiles, factory)
+	if err != nil {
+		logger.Error("Failed to run the check: %v", err)
+		return 1
+	}
+
+	failed := 0
+	for _, r := range results {
+		path := files.RelativeToMusicDir(r.Path, musicDirs...)
+		sec := int(r.Duration.Seconds())
+		if r.OK() {
+			clip := ""
+			if r.Clipped {
+				clip = ", CLIP"
+			}
+			fmt.Printf("OK    %s (%d:%02d, peak %.2f%s)\n", path, sec/60, sec%60, r.Peak, clip)
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL  %s: %v\n", path, r.Err)
+	}
+	fmt.Printf("%d files checked, %d failed\n", len(results), failed)
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// parseLoopPresets parses a comma-separated list of loop durations in minutes, e.g. "0.5,1,2,5"
+func parseLoopPresets(s string) ([]float64, error) {
+	var presets []float64
+	for _, field := range strings.Split(s, ",") {
+		minutes, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, err
+		}
+		presets = append(presets, minutes)
+	}
+	return presets, nil
+}
+
 func main() {
+	playlistPath := flag.String("playlist", "", "M3U playlist to play instead of scanning the musics directory")
+	musicDirFlag := flag.String("dir", "", "Music directory to play (default $"+musicDirEnv+" or \""+files.DefaultMusicDir.Path()+"\")")
+	shallow := flag.Bool("shallow", false, "Only scan the top level of the music directories, ignoring subdirectories")
+	followSymlinks := flag.Bool("follow-symlinks", false, "Also scan directories reached through symlinks in the music directories")
+	rescan := flag.Duration("rescan", 0, "Also rescan the music directories at this interval, e.g. 10s, where file changes aren't noticed (0 disables)")
+	themeName := flag.String("theme", "dark", "UI color theme (dark or light)")
+	silent := flag.Bool("silent", false, "Play without an audio device, e.g. on a headless machine")
+	probeJobs := flag.Int("probe-jobs", 0, "Number of files probed in parallel for the library durations (0 uses one per CPU)")
+	check := flag.Bool("check", false, "Check that every music file decodes and loops, print a report and exit")
+	sampleRate := flag.Int("samplerate", player.DefaultSampleRate, "Sample rate in Hz that tracks are decoded and played at")
+	listDevices := flag.Bool("list-devices", false, "Print the audio output device sound is played through and exit; only the system's default device is supported, as devices can't be enumerated or chosen yet")
+	logLevel := flag.String("log-level", "info", "Minimum level of log messages (debug, info, warn, error or off)")
+	loopPresets := flag.String("loop-presets", "", "Comma-separated loop durations in minutes that the D key cycles through (default \"0.5,1,2,5\")")
+	flag.Parse()
+
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		log.Fatalf("Invalid -log-level: %v", err)
+	}
+	logger.SetLevel(level)
+	if *sampleRate <= 0 {
+		log.Fatalf("Invalid -samplerate: %d", *sampleRate)
+	}
+
+	if *listDevices {
+		devices, err := player.ListOutputDevices()
+		if err != nil {
+			log.Fatalf("Failed to list output devices: %v", err)
+		}
+		// The list is a placeholder until the audio backend can enumerate devices
+		for _, d := range devices {
+			if d == player.DefaultOutputDevice {
+				d += " (the system's default output device; other devices can't be listed or chosen yet)"
+			}
+			fmt.Println(d)
+		}
+		return
+	}
+
+	theme, err := widgets.ThemeByName(*themeName)
+	if err != nil {
+		log.Fatalf("Invalid -theme: %v", err)
+	}
+	widgets.SetTheme(theme)
+
+	// The -dir flag and remaining arguments are music directories to watch,
+	// falling back to $MUSIC_DIR and then the default directory
+	musicDirs := []files.MusicDirectory{}
+	if *musicDirFlag != "" {
+		musicDirs = append(musicDirs, files.MusicDirectory(*musicDirFlag))
+	}
+	for _, arg := range flag.Args() {
+		musicDirs = append(musicDirs, files.MusicDirectory(arg))
+	}
+	if len(musicDirs) == 0 {
+		if dir := os.Getenv(musicDirEnv); dir != "" {
+			musicDirs = append(musicDirs, files.MusicDirectory(dir))
+		} else {
+			musicDirs = append(musicDirs, files.DefaultMusicDir)
+		}
+	}
+
+	if *check {
+		os.Exit(runBatchCheck(musicDirs, *playlistPath, !*shallow, *followSymlinks, *sampleRate))
+	}
+
 	// Set up the game
-	game, err := NewGame()
+	playerFactory := newPlayerFactory(*silent, *sampleRate)
+	var game *Game
+	if *playlistPath != "" {
+		game, err = NewGameFromPlaylist(*playlistPath, playerFactory)
+	} else {
+		game, err = NewGame(musicDirs, !*shallow, *followSymlinks, playerFactory)
+	}
 	if err != nil {
 		log.Fatalf("Failed to initialize game: %v", err)
 	}
 
+	game.player.SetMusicDirectories(musicDirs...)
+	// Decode tracks in the background so large files don't freeze the window
+	game.player.SetBackgroundLoading(true)
+	game.player.SetProbeConcurrency(*probeJobs)
+	if *loopPresets != "" {
+		presets, err := parseLoopPresets(*loopPresets)
+		if err == nil {
+			err = game.player.SetLoopPresets(presets)
+		}
+		if err != nil {
+			log.Fatalf("Invalid -loop-presets: %v", err)
+		}
+	}
+
+	// Restore the settings from the last session; the UI part is applied once the UI is created
+	var uiSettings player.UISettings
+	settingsPath, err := player.DefaultSettingsPath()
+	if err != nil {
+		logger.Warn("settings will not be saved: %v", err)
+	} else {
+		settings, err := player.LoadSettings(settingsPath)
+		if err != nil {
+			logger.Warn("using default settings: %v", err)
+		}
+		game.player.ApplySettings(settings)
+		uiSettings = settings.UI
+
+		order, err := player.LoadCustomOrder(player.CustomOrderPath(settingsPath))
+		if err != nil {
+			logger.Warn("using the sort order: %v", err)
+		}
+		game.player.SetCustomOrder(order)
+	}
+
+	// Settings saved on exit; the UI settings are included once the UI is created
+	currentSettings := game.player.Settings
+
 	// Ensure cleanup on exit
 	defer func() {
 		if game.player != nil {
+			if settingsPath != "" {
+				if err := player.SaveSettings(settingsPath, currentSettings()); err != nil {
+					logger.Error("Error saving settings: %v", err)
+				}
+				if err := player.SaveCustomOrder(player.CustomOrderPath(settingsPath), game.player.GetCustomOrder()); err != nil {
+					logger.Error("Error saving custom order: %v", err)
+				}
+			}
 			if err := game.player.Close(); err != nil {
-				log.Printf("Error closing player: %v", err)
+				logger.Error("Error closing player: %v", err)
 			}
 		}
 		// Close the watcher as well
 		if game.watcher != nil {
 			if err := game.watcher.Close(); err != nil {
-				log.Printf("Error closing watcher: %v", err)
+				logger.Error("Error closing watcher: %v", err)
 			}
 		}
 	}()
 
 	// Create the root widget
 	root := ui.NewRoot(game.player)
+	root.SetMusicDirectories(musicDirs)
+	root.ApplyUISettings(uiSettings)
+	currentSettings = root.Settings
+	if settingsPath != "" {
+		root.SetSettingsPath(settingsPath)
+	}
+
+	// Show problems in the window too, for users who never see the console
+	for _, warning := range game.warnings {
+		root.AddWarning(warning)
+	}
+	game.player.SetOnLoadError(func(path string, err error) {
+		logger.Warn("failed to decode %s: %v", path, err)
+		root.AddWarning(fmt.Sprintf("Failed to decode %s: %v", files.RelativeToMusicDir(path, musicDirs...), err))
+	})
 
 	// ---- Connect Watcher to Root's Handler ----
 	if game.watcher != nil {
 		// Add Root's HandleFileChanges as a handler
 		game.watcher.AddHandler(root.HandleFileChanges)
+		game.watcher.SetPollInterval(*rescan)
+		root.SetWatcherHealthFunc(game.watcher.IsHealthy)
 
-		// Optionally trigger initial notification if needed,
-		// although NewRoot already handles initial state.
-		// game.watcher.NotifyChange() // Depends on DirectoryWatcher implementation
+		// No initial notification is needed since Root lists the player's files when it initializes.
+		// Call game.watcher.NotifyChange() to force a rescan.
 	}
 	// ---- End Connection ----
 